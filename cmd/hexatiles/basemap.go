@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// basemap is the layer drawn under the cells in the preview: raster tiles, a MapLibre style
+// the cells are added on top of, or neither for a plain background.
+type basemap struct {
+	Tiles       string
+	Attribution string
+	StyleURL    string
+}
+
+const cartoAttribution = "© OpenStreetMap contributors © CARTO"
+
+var basemaps = map[string]basemap{
+	"osm":      {Tiles: "https://tile.openstreetmap.org/{z}/{x}/{y}.png", Attribution: "© OpenStreetMap contributors"},
+	"positron": {Tiles: "https://basemaps.cartocdn.com/light_all/{z}/{x}/{y}.png", Attribution: cartoAttribution},
+	"dark":     {Tiles: "https://basemaps.cartocdn.com/dark_all/{z}/{x}/{y}.png", Attribution: cartoAttribution},
+	"none":     {},
+}
+
+// basemapNames lists the named basemaps for the flag help.
+func basemapNames() []string {
+	names := make([]string, 0, len(basemaps))
+	for name := range basemaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveBasemap returns the named basemap, or the MapLibre style at an http(s) URL.
+func resolveBasemap(name string) (basemap, error) {
+	if b, ok := basemaps[strings.ToLower(name)]; ok {
+		return b, nil
+	}
+	u, err := url.Parse(name)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return basemap{}, fmt.Errorf("%q is not %s or the http(s) URL of a MapLibre style", name, strings.Join(basemapNames(), ", "))
+	}
+	return basemap{StyleURL: name}, nil
+}
+
+// Style returns the MapLibre style of a raster or empty basemap; a style URL is fetched by the
+// page instead.
+func (b basemap) Style() template.JS {
+	style := map[string]any{"version": 8, "sources": map[string]any{}}
+	if b.Tiles == "" {
+		style["layers"] = []any{map[string]any{
+			"id":    "background",
+			"type":  "background",
+			"paint": map[string]any{"background-color": "#f4f4f2"},
+		}}
+	} else {
+		style["sources"] = map[string]any{"basemap": map[string]any{
+			"type":        "raster",
+			"tiles":       []string{b.Tiles},
+			"tileSize":    256,
+			"attribution": b.Attribution,
+		}}
+		style["layers"] = []any{map[string]any{"id": "basemap", "type": "raster", "source": "basemap", "minzoom": 0, "maxzoom": 19}}
+	}
+	data, _ := json.Marshal(style)
+	return template.JS(data)
+}
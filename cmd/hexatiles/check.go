@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/planar"
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	inputpkg "github.com/hexatiles/hexatiles/internal/input"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/props"
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// checkExampleLimit caps the failing rows listed per failure kind and property.
+const checkExampleLimit = 5
+
+func newCheckCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check --in data.parquet --pmtiles out.pmtiles",
+		Short: "Verify that sampled input rows survive into the built tiles",
+		Long: "Samples --sample rows of the input, finds each cell in the tile holding its center at the archive's\n" +
+			"deepest zoom (or --zoom), and checks that the feature is there, covers the cell's center and carries\n" +
+			"the input's property values after the build's --types, --value-map, string cleaning, --reserved-keys,\n" +
+			"--nonfinite and --quantize. Rows the build dropped on purpose are skipped: these settings, --where and\n" +
+			"the resolution filter come from the archive's metadata, from the report.json next to an older\n" +
+			"archive, or for --where and --quantize from the flags of the same name. Properties missing from\n" +
+			"every sampled feature are reported as not tiled rather than failing. Exits non-zero when any row\n" +
+			"fails.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := checkOptions{minRes: -1, maxRes: -1}
+			opts.grid, _ = cmd.Flags().GetString("grid")
+			opts.input, _ = cmd.Flags().GetString("in")
+			opts.pmtiles, _ = cmd.Flags().GetString("pmtiles")
+			opts.sample, _ = cmd.Flags().GetInt("sample")
+			opts.zoom, _ = cmd.Flags().GetInt("zoom")
+			opts.tolerance, _ = cmd.Flags().GetFloat64("tolerance")
+			opts.inputFormat, _ = cmd.Flags().GetString("input-format")
+			reportPath, _ := cmd.Flags().GetString("report")
+			asJSON, _ := cmd.Flags().GetBool("json")
+			if opts.sample <= 0 {
+				return fmt.Errorf("--sample must be positive")
+			}
+
+			recorded, err := opts.applyMetadata()
+			if err != nil {
+				return err
+			}
+			if reportPath == "" && !recorded {
+				candidate := filepath.Join(filepath.Dir(opts.pmtiles), "report.json")
+				if built, ok := reportOutput(candidate); ok && sameFile(built, opts.pmtiles) {
+					reportPath = candidate
+				}
+			}
+			if reportPath != "" {
+				if err := opts.applyReport(reportPath); err != nil {
+					return err
+				}
+				recorded = true
+			}
+			if !recorded && !cmd.Flags().Changed("where") && !cmd.Flags().Changed("quantize") {
+				return fmt.Errorf("%s records no build settings and no report.json describes it: pass --report, or --where and --quantize as built (empty for none)", opts.pmtiles)
+			}
+			// Flags given explicitly override the report.
+			if cmd.Flags().Changed("grid") {
+				opts.grid, _ = cmd.Flags().GetString("grid")
+			}
+			if cmd.Flags().Changed("where") {
+				opts.where, _ = cmd.Flags().GetString("where")
+			}
+			if cmd.Flags().Changed("quantize") {
+				opts.quantize, _ = cmd.Flags().GetString("quantize")
+			}
+
+			result, err := runCheck(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+			} else {
+				printCheck(cmd.OutOrStdout(), result)
+			}
+			if !result.Passed {
+				return fmt.Errorf("check failed: %d of %d sampled rows do not match the tiles", result.Failed, result.Checked)
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("in", "", "Input the archive was built from (Parquet, H3 text or NDJSON, local or remote)")
+	cmd.Flags().String("pmtiles", "", "Built PMTiles archive to check")
+	cmd.Flags().Int("sample", 1000, "Number of input rows to check, drawn at random with a fixed seed from the whole input")
+	cmd.Flags().Int("zoom", -1, "Zoom to look the cells up at (default: the archive's max zoom)")
+	cmd.Flags().Float64("tolerance", 1e-6, "Relative difference allowed between numeric values after quantization")
+	cmd.Flags().String("report", "", "report.json of the build, for archives that do not record their settings (default: the one next to the archive, when it describes it)")
+	cmd.Flags().String("grid", "h3", "Cell grid of the input column: "+strings.Join(grid.Names(), "|")+" (default: as built)")
+	cmd.Flags().String("where", "", "--where of the build; rows it rejects are skipped (default: as built)")
+	cmd.Flags().String("quantize", "", "--quantize of the build, applied to input values before comparing (default: as built)")
+	cmd.Flags().String("input-format", "", "Input format: "+strings.Join(inputpkg.Formats(), "|")+" (default: from file extension)")
+	cmd.Flags().Bool("json", false, "Print the result as JSON")
+	cmd.MarkFlagRequired("in")
+	cmd.MarkFlagRequired("pmtiles")
+	return cmd
+}
+
+type checkOptions struct {
+	input, pmtiles, inputFormat string
+	sample, zoom                int
+	tolerance                   float64
+	grid, where, quantize       string
+	// minRes and maxRes are the resolution filter of the build, -1 when open.
+	minRes, maxRes int
+	// aggregated is set when the build merged rows, so tile values are not row values.
+	aggregated bool
+	// flattenNested keys nested Parquet fields as the build did.
+	flattenNested bool
+	// types, valueMaps, nonFinite, reserved and stringMaxBytes are the property settings of
+	// the build, replayed on input values before comparing.
+	types, nonFinite, reserved string
+	valueMaps                  []string
+	stringMaxBytes             int
+}
+
+// applyMetadata takes the filters and quantization of the build from the "hexatiles.pipeline"
+// entry of the archive metadata, reporting whether the archive has one.
+func (o *checkOptions) applyMetadata() (bool, error) {
+	archive, err := tiler.OpenPMTiles(o.pmtiles)
+	if err != nil {
+		return false, err
+	}
+	defer archive.Close()
+	metadata, err := archive.Metadata()
+	if err != nil {
+		return false, err
+	}
+	hexatiles, _ := metadata["hexatiles"].(map[string]any)
+	pipeline, ok := hexatiles["pipeline"].(map[string]any)
+	if !ok {
+		return false, nil
+	}
+	if dissolveBy, _ := pipeline["dissolve_by"].([]any); len(dissolveBy) > 0 {
+		return false, fmt.Errorf("%s: --dissolve-by builds merge cells into polygons without cell IDs; check cannot match them", o.pmtiles)
+	}
+	o.where, _ = pipeline["where"].(string)
+	o.quantize, _ = pipeline["quantize"].(string)
+	if res, ok := pipeline["min_resolution"].(float64); ok {
+		o.minRes = int(res)
+	}
+	if res, ok := pipeline["max_resolution"].(float64); ok {
+		o.maxRes = int(res)
+	}
+	aggregate, _ := pipeline["aggregate"].(string)
+	o.aggregated = aggregate != ""
+	o.flattenNested, _ = pipeline["flatten_nested"].(bool)
+	o.types = strings.Join(metadataStrings(pipeline["types"]), ",")
+	o.valueMaps = metadataStrings(pipeline["value_maps"])
+	o.nonFinite, _ = pipeline["nonfinite"].(string)
+	o.reserved, _ = pipeline["reserved_keys"].(string)
+	if n, ok := pipeline["string_max_bytes"].(float64); ok {
+		o.stringMaxBytes = int(n)
+	}
+	if g, _ := pipeline["grid"].(string); g != "" {
+		o.grid = g
+	}
+	return true, nil
+}
+
+// applyReport takes the filters and quantization of the build from its report.json, for
+// archives built before the settings were recorded in the metadata.
+func (o *checkOptions) applyReport(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read report: %w", err)
+	}
+	var rep struct {
+		Config  report.Config    `json:"config"`
+		Sources []*report.Source `json:"sources"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(rep.Config.DissolveBy) > 0 {
+		return fmt.Errorf("%s: --dissolve-by builds merge cells into polygons without cell IDs; check cannot match them", path)
+	}
+	o.where, o.quantize = rep.Config.Where, rep.Config.QuantizeSpec
+	if rep.Config.ResolutionFilter {
+		o.minRes, o.maxRes = rep.Config.MinResolution, rep.Config.MaxResolution
+	}
+	o.aggregated = rep.Config.Aggregate != ""
+	o.flattenNested = rep.Config.FlattenNested
+	if len(rep.Config.ValueMaps) > 0 {
+		return fmt.Errorf("%s records --value-map tables only for display; check cannot replay them", path)
+	}
+	o.types = strings.Join(rep.Config.Types, ",")
+	o.nonFinite, o.reserved = rep.Config.NonFinitePolicy, rep.Config.ReservedKeyPolicy
+	o.stringMaxBytes = rep.Config.StringMaxBytes
+	if len(rep.Sources) > 0 && rep.Sources[0].Config.Grid != "" {
+		o.grid = rep.Sources[0].Config.Grid
+	}
+	return nil
+}
+
+// metadataStrings reads a JSON array of strings from the archive metadata.
+func metadataStrings(value any) []string {
+	list, _ := value.([]any)
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// propertySteps replays the property steps of the build on input values, so they compare
+// with the tiles' values.
+type propertySteps struct {
+	valueMaps props.ValueMaps
+	coercions props.Coercions
+	sanitizer props.StringSanitizer
+	reserved  props.ReservedKeyPolicy
+	nonFinite props.NonFinitePolicy
+	quantizer props.Quantizer
+}
+
+func newPropertySteps(opts checkOptions) (*propertySteps, error) {
+	var steps propertySteps
+	var err error
+	if steps.valueMaps, err = props.ParseValueMaps(opts.valueMaps); err != nil {
+		return nil, fmt.Errorf("--value-map of the build: %w", err)
+	}
+	if steps.coercions, err = props.ParseCoercions(opts.types); err != nil {
+		return nil, fmt.Errorf("--types of the build: %w", err)
+	}
+	if steps.reserved, err = props.ParseReservedKeyPolicy(opts.reserved); err != nil {
+		return nil, err
+	}
+	if steps.nonFinite, err = props.ParseNonFinitePolicy(opts.nonFinite); err != nil {
+		return nil, err
+	}
+	if steps.quantizer, err = props.Parse(opts.quantize); err != nil {
+		return nil, fmt.Errorf("--quantize: %w", err)
+	}
+	steps.sanitizer = props.StringSanitizer{MaxBytes: opts.stringMaxBytes}
+	return &steps, nil
+}
+
+// apply rewrites properties in place in the order the build's buildFeature does.
+func (p *propertySteps) apply(properties map[string]any, cellGrid grid.CellGeometry, cell string, resolution int) error {
+	p.valueMaps.Apply(properties)
+	p.coercions.Apply(properties)
+	p.sanitizer.Apply(properties)
+	for _, system := range [...]struct {
+		key   string
+		value any
+	}{{cellGrid.Name(), cell}, {"resolution", resolution}} {
+		if _, err := p.reserved.Apply(properties, system.key, system.value); err != nil {
+			return err
+		}
+	}
+	p.nonFinite.Apply(properties)
+	p.quantizer.Apply(properties)
+	return nil
+}
+
+// checkResult is the outcome of a check. A row fails at most once, for the first problem found.
+type checkResult struct {
+	Input   string `json:"input"`
+	PMTiles string `json:"pmtiles"`
+	Zoom    int    `json:"zoom"`
+	// Read counts the input rows read; Skipped those the build dropped on purpose or could not
+	// read.
+	Read    int64 `json:"read"`
+	Skipped int64 `json:"skipped"`
+	Checked int   `json:"checked"`
+	Matched int   `json:"matched"`
+	Failed  int   `json:"failed"`
+	Passed  bool  `json:"passed"`
+	// Failures counts failing rows by kind: missing_tile, missing_feature, geometry or
+	// properties.
+	Failures map[string]int `json:"failures"`
+	// Properties lists the mismatching rows per property.
+	Properties map[string]int `json:"properties"`
+	// NotTiled lists the input properties absent from every located feature.
+	NotTiled []string       `json:"not_tiled"`
+	Examples []checkExample `json:"examples"`
+}
+
+type checkExample struct {
+	Row      int64  `json:"row"`
+	Cell     string `json:"cell"`
+	Tile     string `json:"tile"`
+	Kind     string `json:"kind"`
+	Property string `json:"property,omitempty"`
+	Input    any    `json:"input,omitempty"`
+	Tiles    any    `json:"tiles,omitempty"`
+}
+
+type checkSample struct {
+	row        int64
+	cell       grid.Cell
+	token      string
+	properties map[string]any
+	center     orb.Point
+	tile       maptile.Tile
+	feature    *geojson.Feature
+}
+
+func runCheck(ctx context.Context, opts checkOptions) (*checkResult, error) {
+	cellGrid, err := grid.Lookup(opts.grid)
+	if err != nil {
+		return nil, err
+	}
+	where, err := props.ParseWhere(opts.where)
+	if err != nil {
+		return nil, fmt.Errorf("--where: %w", err)
+	}
+	steps, err := newPropertySteps(opts)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := tiler.OpenPMTiles(opts.pmtiles)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	h := archive.Header()
+	zoom := h.MaxZoom
+	if opts.zoom >= 0 {
+		if opts.zoom < h.MinZoom || opts.zoom > h.MaxZoom {
+			return nil, fmt.Errorf("--zoom %d is outside the archive zooms z%d-z%d", opts.zoom, h.MinZoom, h.MaxZoom)
+		}
+		zoom = opts.zoom
+	}
+
+	result := &checkResult{
+		Input:      opts.input,
+		PMTiles:    opts.pmtiles,
+		Zoom:       zoom,
+		Failures:   make(map[string]int),
+		Properties: make(map[string]int),
+		NotTiled:   []string{},
+		Examples:   []checkExample{},
+	}
+	samples, err := sampleRows(ctx, opts, cellGrid, where, steps, result)
+	if err != nil {
+		return nil, err
+	}
+	for i := range samples {
+		s := &samples[i]
+		polygon, err := cellGrid.Polygon(s.cell)
+		if err != nil {
+			return nil, fmt.Errorf("polygonize %s: %w", s.token, err)
+		}
+		// The center of the cell's bounds lies inside every grid's cells, which are convex.
+		s.center = polygon.Bound().Center()
+		s.tile = maptile.At(s.center, maptile.Zoom(zoom))
+	}
+	// Rows sharing a tile are checked together, so each tile is decoded once.
+	sort.Slice(samples, func(a, b int) bool {
+		if samples[a].tile != samples[b].tile {
+			return samples[a].tile.Quadkey() < samples[b].tile.Quadkey()
+		}
+		return samples[a].row < samples[b].row
+	})
+
+	examples := make(map[string]int)
+	fail := func(s *checkSample, kind string, ex checkExample) {
+		key := kind + "/" + ex.Property
+		if examples[key] < checkExampleLimit {
+			ex.Row, ex.Cell, ex.Tile, ex.Kind = s.row, s.token, fmt.Sprintf("%d/%d/%d", s.tile.Z, s.tile.X, s.tile.Y), kind
+			result.Examples = append(result.Examples, ex)
+		}
+		examples[key]++
+	}
+
+	// Locate every feature first: a property absent from one feature is only a mismatch when
+	// other features carry it.
+	var layers mvt.Layers
+	var loaded maptile.Tile
+	haveTile := false
+	tiled := make(map[string]bool)
+	for i := range samples {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s := &samples[i]
+		result.Checked++
+		if !haveTile || s.tile != loaded {
+			if layers, err = archive.Layers(zoom, int(s.tile.X), int(s.tile.Y)); err != nil {
+				return nil, err
+			}
+			layers.ProjectToWGS84(s.tile)
+			loaded, haveTile = s.tile, true
+		}
+		if layers == nil {
+			result.Failures["missing_tile"]++
+			fail(s, "missing_tile", checkExample{})
+			continue
+		}
+		feature := findCellFeature(layers, cellGrid, s.cell)
+		if feature == nil {
+			result.Failures["missing_feature"]++
+			fail(s, "missing_feature", checkExample{})
+			continue
+		}
+		if !geometryContains(feature.Geometry, s.center) {
+			result.Failures["geometry"]++
+			fail(s, "geometry", checkExample{})
+			continue
+		}
+		s.feature = feature
+		for key := range feature.Properties {
+			tiled[key] = true
+		}
+	}
+
+	notTiled := make(map[string]bool)
+	for i := range samples {
+		s := &samples[i]
+		if s.feature == nil {
+			continue
+		}
+		mismatched := false
+		for _, key := range sortedKeys(s.properties) {
+			want := s.properties[key]
+			if want == nil || opts.aggregated {
+				continue
+			}
+			if !tiled[key] {
+				notTiled[key] = true
+				continue
+			}
+			got, ok := s.feature.Properties[key]
+			if !ok || !checkValuesEqual(want, got, opts.tolerance) {
+				result.Properties[key]++
+				fail(s, "properties", checkExample{Property: key, Input: want, Tiles: got})
+				mismatched = true
+			}
+		}
+		if mismatched {
+			result.Failures["properties"]++
+			continue
+		}
+		result.Matched++
+	}
+	result.NotTiled = sortedKeys(notTiled)
+	result.Failed = result.Checked - result.Matched
+	result.Passed = result.Failed == 0 && result.Checked > 0
+	return result, nil
+}
+
+// sampleRows reads the whole input and keeps a seeded random sample of the rows the build
+// would have tiled, their properties rewritten by steps as the build rewrote them.
+func sampleRows(ctx context.Context, opts checkOptions, cellGrid grid.CellGeometry, where *props.Where, steps *propertySteps, result *checkResult) ([]checkSample, error) {
+	reader, err := inputpkg.Open(opts.input, opts.inputFormat, parquetreader.ReaderOptions{Grid: cellGrid, FlattenNested: opts.flattenNested})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	var samples []checkSample
+	var eligible int64
+	for {
+		row, err := reader.NextContext(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read input row: %w", err)
+		}
+		result.Read++
+		if row.Err != nil || (opts.minRes >= 0 && row.Resolution < opts.minRes) || (opts.maxRes >= 0 && row.Resolution > opts.maxRes) || !where.Match(row.Properties) {
+			result.Skipped++
+			continue
+		}
+		eligible++
+		slot := len(samples)
+		if slot >= opts.sample {
+			if j := rng.Int63n(eligible); j < int64(opts.sample) {
+				slot = int(j)
+			} else {
+				continue
+			}
+		}
+		s := checkSample{row: row.RowNumber, cell: row.Cell, token: row.CellString, properties: make(map[string]any, len(row.Properties))}
+		for k, v := range row.Properties {
+			s.properties[k] = v
+		}
+		if err := steps.apply(s.properties, cellGrid, row.CellString, row.Resolution); err != nil {
+			return nil, fmt.Errorf("row %d: %w (--reserved-keys %s)", row.RowNumber, err, steps.reserved)
+		}
+		if slot == len(samples) {
+			samples = append(samples, s)
+		} else {
+			samples[slot] = s
+		}
+	}
+	return samples, nil
+}
+
+// findCellFeature returns the feature whose cell attribute is cell or, after --compact or
+// --pyramid, one of its parents.
+func findCellFeature(layers mvt.Layers, cellGrid grid.CellGeometry, cell grid.Cell) *geojson.Feature {
+	var parent *geojson.Feature
+	for _, layer := range layers {
+		for _, f := range layer.Features {
+			id, _ := f.Properties[cellGrid.Name()].(string)
+			if id == "" {
+				continue
+			}
+			other, _, err := cellGrid.Parse(id)
+			if err != nil {
+				continue
+			}
+			if other == cell {
+				return f
+			}
+			if res := cellGrid.Resolution(other); parent == nil && res < cellGrid.Resolution(cell) && cellGrid.Parent(cell, res) == other {
+				parent = f
+			}
+		}
+	}
+	return parent
+}
+
+// geometryContains reports whether the polygon or multipolygon g covers point.
+func geometryContains(g orb.Geometry, point orb.Point) bool {
+	switch g := g.(type) {
+	case orb.Polygon:
+		return planar.PolygonContains(g, point)
+	case orb.MultiPolygon:
+		return planar.MultiPolygonContains(g, point)
+	}
+	return false
+}
+
+// checkValuesEqual compares an input value with its tile counterpart: numbers within a relative
+// tolerance, since vector tiles may store them at another width, and anything else by its
+// string form.
+func checkValuesEqual(want, got any, tolerance float64) bool {
+	if a, ok := props.Number(want); ok {
+		b, ok := props.Number(got)
+		if !ok {
+			return false
+		}
+		return math.Abs(a-b) <= tolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	}
+	if a, ok := want.(bool); ok {
+		b, ok := got.(bool)
+		return ok && a == b
+	}
+	return fmt.Sprint(want) == fmt.Sprint(got)
+}
+
+func printCheck(w io.Writer, r *checkResult) {
+	fmt.Fprintf(w, "%s → %s (z%d)\n", r.Input, r.PMTiles, r.Zoom)
+	fmt.Fprintf(w, "  rows read: %d (%d skipped: unreadable or dropped by the build's filters)\n", r.Read, r.Skipped)
+	fmt.Fprintf(w, "  rows checked: %d\n", r.Checked)
+	fmt.Fprintf(w, "  matched: %d\n", r.Matched)
+	for _, kind := range []struct{ key, label string }{
+		{"missing_tile", "tile missing"},
+		{"missing_feature", "cell missing from its tile"},
+		{"geometry", "feature does not cover the cell center"},
+		{"properties", "property values differ"},
+	} {
+		if n := r.Failures[kind.key]; n > 0 {
+			fmt.Fprintf(w, "  ✘ %s: %d\n", kind.label, n)
+		}
+	}
+	for _, key := range sortedKeys(r.Properties) {
+		fmt.Fprintf(w, "      %s: %d rows\n", key, r.Properties[key])
+	}
+	if len(r.NotTiled) > 0 {
+		fmt.Fprintf(w, "  not tiled (absent from every located feature): %s\n", strings.Join(r.NotTiled, ", "))
+	}
+	if len(r.Examples) > 0 {
+		fmt.Fprintf(w, "  examples:\n")
+		for _, ex := range r.Examples {
+			detail := ex.Kind
+			if ex.Property != "" {
+				detail = fmt.Sprintf("%s: input %v, tiles %v", ex.Property, ex.Input, ex.Tiles)
+			}
+			fmt.Fprintf(w, "    row %d (%s) in %s: %s\n", ex.Row, ex.Cell, ex.Tile, detail)
+		}
+	}
+	if r.Passed {
+		fmt.Fprintf(w, "  result: PASS\n")
+	} else {
+		fmt.Fprintf(w, "  result: FAIL\n")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
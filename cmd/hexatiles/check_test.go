@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexatiles/hexatiles/internal/build"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// TestCheckReplaysPropertySteps builds cells whose properties the build rewrites, then checks
+// the archive against its input with the settings recorded in its metadata.
+func TestCheckReplaysPropertySteps(t *testing.T) {
+	dir := t.TempDir()
+	cells, err := h3.GridDisk(h3.Cell(h3.IndexFromString("8828308281fffff")), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines strings.Builder
+	for i, c := range cells {
+		fmt.Fprintf(&lines, "{\"h3\": %q, \"kind\": %d, \"open\": %q, \"name\": \"district %d\", \"resolution\": 3, \"score\": %g}\n",
+			c.String(), i%3, []string{"yes", "no"}[i%2], i, float64(i)+0.37)
+	}
+	input := filepath.Join(dir, "cells.ndjson")
+	table := filepath.Join(dir, "kinds.csv")
+	for path, data := range map[string]string{input: lines.String(), table: "code,label\n0,park\n1,school\n2,market\n"} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(dir, "cells.pmtiles")
+	_, err = build.Run(context.Background(), build.Options{
+		InputPath:         input,
+		OutputPMTiles:     output,
+		OutputFormat:      build.FormatPMTiles,
+		Grid:              "h3",
+		Tiler:             tiler.TilerNative,
+		ZoomCap:           build.DefaultZoomCap,
+		CoverageThreshold: build.DefaultCoverageThreshold,
+		MinZoom:           8,
+		MaxZoom:           8,
+		MinResolution:     -1,
+		MaxResolution:     -1,
+		PropertyInclude:   []string{"kind", "open", "name", "resolution", "score"},
+		ValueMaps:         []string{"kind=" + table},
+		Types:             "open:bool",
+		StringMaxBytes:    5,
+		ReservedKeys:      "rename",
+		NonFinite:         "null",
+		QuantizeSpec:      "score=0.1",
+		PropertyByteCap:   2048,
+		ReportFormats:     []string{"none"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	opts := checkOptions{input: input, pmtiles: output, sample: 1000, zoom: -1, tolerance: 1e-6, grid: "h3", minRes: -1, maxRes: -1}
+	if recorded, err := opts.applyMetadata(); err != nil || !recorded {
+		t.Fatalf("metadata: recorded %v, error %v", recorded, err)
+	}
+	result, err := runCheck(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed || result.Checked != len(cells) || len(result.NotTiled) > 0 {
+		t.Fatalf("checked %d of %d cells: failures %v, properties %v, not tiled %v, examples %+v",
+			result.Checked, len(cells), result.Failures, result.Properties, result.NotTiled, result.Examples)
+	}
+
+	// Without the build's string limit the full names no longer match the truncated tiles.
+	opts.stringMaxBytes = 0
+	if result, err = runCheck(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed || result.Properties["name"] != len(cells) {
+		t.Errorf("without the string limit: properties %v; want every name to differ", result.Properties)
+	}
+}
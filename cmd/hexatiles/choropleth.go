@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+
+	"github.com/hexatiles/hexatiles/internal/classify"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// choroplethSampleSize bounds the values read from the tiles when the archive records no breaks.
+const choroplethSampleSize = 100000
+
+// noDataColor fills cells without a numeric value of the --color-by property.
+const noDataColor = "#bdbdbd"
+
+// choropleth colours cells by class of one numeric property.
+type choropleth struct {
+	Property string
+	Breaks   []float64
+	Colors   []string
+	// Source says where the breaks came from, for the startup message.
+	Source string
+}
+
+type legendEntry struct {
+	Color string
+	Label string
+}
+
+// newChoropleth resolves the class breaks of property in the archive at path, preferring the
+// breaks build --classify recorded, then the min and max build recorded (equal-interval only),
+// and finally a sample of the deepest zoom's tiles.
+func newChoropleth(ctx context.Context, path, property, breaks, palette string) (*choropleth, error) {
+	specs, err := classify.ParseSpecs(property + ":" + breaks)
+	if err != nil {
+		return nil, fmt.Errorf("--breaks: %w", err)
+	}
+	if len(specs) != 1 {
+		return nil, fmt.Errorf("--color-by takes a single property, got %q", property)
+	}
+	spec := specs[0]
+	colors, err := classify.Palette(palette, spec.Classes)
+	if err != nil {
+		return nil, fmt.Errorf("--palette: %w", err)
+	}
+
+	archive, err := tiler.OpenPMTiles(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	metadata, err := archive.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	hexatiles, _ := metadata["hexatiles"].(map[string]any)
+
+	c := &choropleth{Property: spec.Property, Colors: colors}
+	if recorded, ok := recordedBreaks(hexatiles, spec); ok {
+		c.Breaks, c.Source = recorded, "the breaks recorded by build --classify"
+		return c, nil
+	}
+	if spec.Method == classify.EqualInterval {
+		if min, max, ok := recordedRange(hexatiles, spec.Property); ok {
+			classes, err := classify.New(spec, []float64{min, max})
+			if err != nil {
+				return nil, err
+			}
+			c.Breaks, c.Source = classes.Breaks, "the min and max recorded at build"
+			return c, nil
+		}
+	}
+
+	values, seen, err := tiler.PropertySample(ctx, archive, spec.Property, choroplethSampleSize)
+	if err != nil {
+		return nil, fmt.Errorf("sample %s: %w", spec.Property, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no numeric values of %q in the z%d tiles", spec.Property, archive.Header().MaxZoom)
+	}
+	classes, err := classify.New(spec, values)
+	if err != nil {
+		return nil, err
+	}
+	c.Breaks = classes.Breaks
+	c.Source = fmt.Sprintf("%d of %d values in the z%d tiles", len(values), seen, archive.Header().MaxZoom)
+	return c, nil
+}
+
+// recordedBreaks returns the breaks under hexatiles.classes when they were computed with the
+// same method and class count.
+func recordedBreaks(hexatiles map[string]any, spec classify.Spec) ([]float64, bool) {
+	classes, _ := hexatiles["classes"].(map[string]any)
+	entry, _ := classes[spec.Property].(map[string]any)
+	if entry == nil || entry["method"] != spec.Method {
+		return nil, false
+	}
+	if n, _ := entry["classes"].(float64); int(n) != spec.Classes {
+		return nil, false
+	}
+	raw, _ := entry["breaks"].([]any)
+	if len(raw) != spec.Classes+1 {
+		return nil, false
+	}
+	breaks := make([]float64, len(raw))
+	for i, v := range raw {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, false
+		}
+		breaks[i] = f
+	}
+	return breaks, true
+}
+
+// recordedRange returns the min and max under hexatiles.stats.
+func recordedRange(hexatiles map[string]any, property string) (float64, float64, bool) {
+	stats, _ := hexatiles["stats"].(map[string]any)
+	entry, _ := stats[property].(map[string]any)
+	min, okMin := entry["min"].(float64)
+	max, okMax := entry["max"].(float64)
+	return min, max, okMin && okMax
+}
+
+// classStarts returns the lower bound and colour of each class that can hold a value. Quantile
+// breaks of skewed data repeat; a class whose lower bound does not exceed the previous one is
+// empty and dropped, since MapLibre step stops must strictly increase.
+func (c *choropleth) classStarts() ([]float64, []string) {
+	starts := []float64{c.Breaks[0]}
+	colors := []string{c.Colors[0]}
+	for i := 1; i < len(c.Colors); i++ {
+		if c.Breaks[i] <= starts[len(starts)-1] {
+			colors[len(colors)-1] = c.Colors[i]
+			continue
+		}
+		starts = append(starts, c.Breaks[i])
+		colors = append(colors, c.Colors[i])
+	}
+	return starts, colors
+}
+
+// FillColor returns the MapLibre expression colouring each cell by its class, and cells
+// without a numeric value grey.
+func (c *choropleth) FillColor() template.JS {
+	starts, colors := c.classStarts()
+	step := []any{"step", []any{"get", c.Property}, colors[0]}
+	for i := 1; i < len(starts); i++ {
+		step = append(step, starts[i], colors[i])
+	}
+	expr := []any{"case", []any{"==", []any{"typeof", []any{"get", c.Property}}, "number"}, step, noDataColor}
+	data, _ := json.Marshal(expr)
+	return template.JS(data)
+}
+
+// Legend lists the classes from low to high, then the no-data colour.
+func (c *choropleth) Legend() []legendEntry {
+	starts, colors := c.classStarts()
+	entries := make([]legendEntry, 0, len(starts)+1)
+	for i, start := range starts {
+		end := c.Breaks[len(c.Breaks)-1]
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		label := formatBreak(start) + " – " + formatBreak(end)
+		if start == end {
+			label = formatBreak(start)
+		}
+		entries = append(entries, legendEntry{Color: colors[i], Label: label})
+	}
+	return append(entries, legendEntry{Color: noDataColor, Label: "no data"})
+}
+
+func formatBreak(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+func newDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff a.pmtiles b.pmtiles",
+		Short: "Compare two PMTiles archives",
+		Long: "Compares two builds tile by tile and lists, per zoom, the tiles added, removed and changed with\n" +
+			"the size of each side, then the vector_layers fields added, removed or retyped and the header and\n" +
+			"metadata values that differ. Tiles are compared by their decompressed contents. With --exit-code\n" +
+			"the command fails when the archives differ, so a pipeline change that alters the output stops CI.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			exitCode, _ := cmd.Flags().GetBool("exit-code")
+
+			diff, err := tiler.DiffPMTiles(cmd.Context(), args[0], args[1])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(diff); err != nil {
+					return err
+				}
+			} else if err := printDiff(cmd.OutOrStdout(), args[0], args[1], diff); err != nil {
+				return err
+			}
+			if exitCode && !diff.Identical() {
+				return fmt.Errorf("%s and %s differ", args[0], args[1])
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().Bool("json", false, "Print the comparison as JSON")
+	cmd.Flags().Bool("exit-code", false, "Fail when the archives differ")
+	return cmd
+}
+
+func printDiff(w io.Writer, pathA, pathB string, diff tiler.PMTilesDiff) error {
+	total := diff.Total()
+	if diff.Identical() {
+		fmt.Fprintf(w, "✔ %s and %s are identical (%d tiles)\n", pathA, pathB, total.TilesA)
+		return nil
+	}
+	fmt.Fprintf(w, "a: %s\nb: %s\n\n", pathA, pathB)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "zoom\ttiles a\ttiles b\tadded\tremoved\tchanged\tsize a\tsize b\tdelta\t")
+	row := func(label string, z tiler.ZoomDiff) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t\n", label, z.TilesA, z.TilesB, z.Added, z.Removed, z.Changed,
+			formatBytes(z.BytesA), formatBytes(z.BytesB), formatDelta(z.BytesA, z.BytesB))
+	}
+	for _, z := range diff.Zooms {
+		row(fmt.Sprintf("z%d", z.Zoom), z)
+	}
+	row("total", total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(diff.Schema) > 0 {
+		fmt.Fprintln(w, "\nschema:")
+		for _, c := range diff.Schema {
+			name := c.Layer
+			if c.Field != "" {
+				name += "." + c.Field
+			}
+			switch {
+			case c.Before == "":
+				fmt.Fprintf(w, "  + %s (%s)\n", name, c.After)
+			case c.After == "":
+				fmt.Fprintf(w, "  - %s (%s)\n", name, c.Before)
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s → %s\n", name, c.Before, c.After)
+			}
+		}
+	}
+	if len(diff.Metadata) > 0 {
+		fmt.Fprintln(w, "\nmetadata:")
+		for _, c := range diff.Metadata {
+			switch {
+			case c.Before == "":
+				fmt.Fprintf(w, "  + %s: %s\n", c.Key, truncateValue(c.After))
+			case c.After == "":
+				fmt.Fprintf(w, "  - %s: %s\n", c.Key, truncateValue(c.Before))
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s → %s\n", c.Key, truncateValue(c.Before), truncateValue(c.After))
+			}
+		}
+	}
+	return nil
+}
+
+// formatDelta prints the change from a to b in bytes and percent.
+func formatDelta(a, b int64) string {
+	if a == b {
+		return "0"
+	}
+	sign := "+"
+	if b < a {
+		sign = "-"
+	}
+	delta := formatBytes(max(a, b) - min(a, b))
+	if a == 0 {
+		return sign + delta
+	}
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign, delta, float64(b-a)/float64(a)*100)
+}
+
+// truncateValue shortens long metadata values, such as property statistics, for the terminal;
+// --json prints them in full.
+func truncateValue(value string) string {
+	const limit = 60
+	if runes := []rune(value); len(runes) > limit {
+		return string(runes[:limit]) + "…"
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/hexatiles/hexatiles/internal/publish"
+)
+
+// exportedAssets are the local names of the pinned scripts in an exported preview.
+var exportedAssets = previewAssets{
+	MapLibreCSS: "maplibre-gl.css",
+	MapLibreJS:  "maplibre-gl.js",
+	PMTilesJS:   "pmtiles.js",
+}
+
+// exportPreview writes the preview page into dir with the archives and the scripts it loads,
+// so the directory can be dropped onto any static host that answers HTTP Range requests. Only
+// a style --basemap and the basemap tiles still come from the network.
+func exportPreview(ctx context.Context, dir, pmtilesPath, comparePath string, extrude bool, base basemap, fill *choropleth, out io.Writer) error {
+	absPath, absCompare, err := resolveArchives(pmtilesPath, comparePath)
+	if err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("resolve --export path: %w", err)
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", absDir, err)
+	}
+
+	page := newPreviewPage(absPath, absCompare, extrude, base, fill)
+	page.TilesPath, page.ComparePath = "tiles.pmtiles", "compare.pmtiles"
+	page.Assets = exportedAssets
+
+	for _, asset := range []struct{ url, name string }{
+		{cdnAssets.MapLibreCSS, exportedAssets.MapLibreCSS},
+		{cdnAssets.MapLibreJS, exportedAssets.MapLibreJS},
+		{cdnAssets.PMTilesJS, exportedAssets.PMTilesJS},
+	} {
+		if err := downloadAsset(ctx, asset.url, filepath.Join(absDir, asset.name)); err != nil {
+			return err
+		}
+	}
+
+	publisher, err := publish.Open(absDir)
+	if err != nil {
+		return err
+	}
+	archives := []publish.Artifact{{Path: absPath, Name: page.TilesPath}}
+	if absCompare != "" {
+		archives = append(archives, publish.Artifact{Path: absCompare, Name: page.ComparePath})
+	}
+	for _, archive := range archives {
+		if _, err := publisher.Publish(ctx, archive, publish.Meta{}); err != nil {
+			return fmt.Errorf("copy %s: %w", archive.Path, err)
+		}
+	}
+
+	var html bytes.Buffer
+	if err := previewTemplate.Execute(&html, page); err != nil {
+		return fmt.Errorf("render preview: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(absDir, "index.html"), html.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write index.html: %w", err)
+	}
+
+	fmt.Fprintf(out, "Exported preview to %s\n", absDir)
+	fmt.Fprintf(out, "  index.html, %s, %s, %s\n", exportedAssets.MapLibreJS, exportedAssets.MapLibreCSS, exportedAssets.PMTilesJS)
+	for _, archive := range archives {
+		fmt.Fprintf(out, "  %s (from %s)\n", archive.Name, filepath.Base(archive.Path))
+	}
+	fmt.Fprintf(out, "Serve it from a static host that answers Range requests; opening index.html from disk does not load the tiles.\n")
+	return nil
+}
+
+// downloadAsset saves the script or stylesheet at url to path.
+func downloadAsset(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", url, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
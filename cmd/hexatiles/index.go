@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/index"
+)
+
+func newIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Convert latitude/longitude points to H3 Parquet",
+		Long: "Reads Parquet, CSV (with a header row) or NDJSON with latitude/longitude columns and writes Parquet with\n" +
+			"an h3 column at the chosen resolution, ready for build. Rows without usable coordinates are skipped.\n\n" +
+			"--aggregate merges the points of each cell into one row, e.g. --aggregate count,sum:amount,mean:score\n" +
+			"writes count, amount_sum and score_mean columns (min:prop and max:prop are also available).",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in, _ := cmd.Flags().GetString("in")
+			output, _ := cmd.Flags().GetString("out")
+			resolution, _ := cmd.Flags().GetInt("resolution")
+			lat, _ := cmd.Flags().GetString("lat")
+			lng, _ := cmd.Flags().GetString("lng")
+			keepCoords, _ := cmd.Flags().GetBool("keep-coords")
+			aggregate, _ := cmd.Flags().GetString("aggregate")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			if output == "" {
+				output = index.DeriveOutput(in)
+			}
+
+			res, err := index.Run(cmd.Context(), index.Options{
+				InputPath:       in,
+				InputFormat:     inputFormat,
+				OutputPath:      output,
+				Resolution:      resolution,
+				Lat:             lat,
+				Lng:             lng,
+				KeepCoordinates: keepCoords,
+				Aggregate:       parseList(aggregate),
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "✔ indexed %d rows at r%d in %s (%s, %s)\n", res.Rows, resolution, formatDuration(res.Duration), res.Lat, res.Lng)
+			fmt.Fprintf(cmd.OutOrStdout(), "  output: %s (%d rows)\n", output, res.Written)
+			if len(res.Columns) > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  columns: h3, %s\n", strings.Join(res.Columns, ", "))
+			}
+			if res.Skipped > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  skipped: %d rows with missing or out-of-range coordinates\n", res.Skipped)
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("in", "", "Input Parquet, CSV, TSV or NDJSON file with latitude/longitude columns")
+	cmd.Flags().String("out", "", "Output Parquet file (default: <input>_h3.parquet next to the input)")
+	cmd.Flags().IntP("resolution", "r", 8, "H3 resolution (0-15)")
+	cmd.Flags().String("lat", "", "Latitude column (default: lat or latitude)")
+	cmd.Flags().String("lng", "", "Longitude column (default: lng, lon, long or longitude)")
+	cmd.Flags().Bool("keep-coords", false, "Keep the latitude/longitude columns in the output")
+	cmd.Flags().String("aggregate", "", "Merge rows per cell: count, sum:prop, mean:prop, min:prop, max:prop (comma-separated)")
+	cmd.Flags().String("input-format", "", "Input format: parquet, csv or ndjson (default: from file extension)")
+	cmd.MarkFlagRequired("in")
+
+	return cmd
+}
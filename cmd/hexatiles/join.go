@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/input"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+func newJoinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "join --pmtiles tiles.pmtiles --in values.parquet",
+		Short: "Refresh the properties of a built tileset without re-tiling",
+		Long: "Replaces the properties of the features of an existing tileset with the values of a new file of\n" +
+			"per-cell rows, keyed by the cell attribute the build wrote. Tiles are decoded and re-encoded, not\n" +
+			"regenerated, so daily metric refreshes keep the geometry of the original build. Features whose\n" +
+			"cell has no row keep their old values; both they and rows matching no feature are counted.\n" +
+			"vector_layers, tilestats and the property statistics are recomputed for the joined columns.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pmtiles, _ := cmd.Flags().GetString("pmtiles")
+			inPath, _ := cmd.Flags().GetString("in")
+			output, _ := cmd.Flags().GetString("out")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			gridName, _ := cmd.Flags().GetString("grid")
+			propsKeepStr, _ := cmd.Flags().GetString("props")
+			if output == "" {
+				output = pmtiles
+			}
+
+			cellGrid, err := grid.Lookup(gridName)
+			if err != nil {
+				return err
+			}
+			values, columns, err := loadJoinValues(cmd.Context(), inPath, inputFormat, cellGrid, parseList(propsKeepStr))
+			if err != nil {
+				return err
+			}
+			result, err := tiler.JoinProperties(cmd.Context(), pmtiles, output, values.rows, tiler.JoinOptions{
+				Key:     cellGrid.Name(),
+				Columns: columns,
+			})
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "✔ joined %d columns from %s into %s\n", len(columns), inPath, output)
+			fmt.Fprintf(out, "  tiles: %d, %d rewritten\n", result.Tiles, result.Rewritten)
+			fmt.Fprintf(out, "  features: %d updated", result.Updated)
+			if result.Unmatched > 0 {
+				fmt.Fprintf(out, ", %d without a row kept their values", result.Unmatched)
+			}
+			fmt.Fprintln(out)
+			stderr := cmd.ErrOrStderr()
+			if result.Unused > 0 {
+				fmt.Fprintf(stderr, "warning: %d rows matched no feature of %s\n", result.Unused, pmtiles)
+			}
+			if values.invalid > 0 {
+				fmt.Fprintf(stderr, "warning: %d rows had no valid %s cell and were skipped\n", values.invalid, cellGrid.Name())
+			}
+			if values.duplicates > 0 {
+				fmt.Fprintf(stderr, "warning: %d rows repeated an earlier cell; the last one was joined\n", values.duplicates)
+			}
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(stderr, "warning: %s\n", warning)
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("pmtiles", "", "PMTiles archive to refresh")
+	cmd.Flags().String("in", "", "Parquet, NDJSON or H3 text file of per-cell values")
+	cmd.Flags().String("out", "", "Archive to write (default: replace --pmtiles)")
+	cmd.Flags().String("input-format", "", "Input format: "+strings.Join(input.Formats(), "|")+" (default: from file extension)")
+	cmd.Flags().String("grid", "h3", "Cell grid of the tileset and the input column")
+	cmd.Flags().String("props", "", "Comma-separated properties to join (default: every property column)")
+	cmd.MarkFlagRequired("pmtiles")
+	cmd.MarkFlagRequired("in")
+	return cmd
+}
+
+// joinValues are the rows of the join input by cell token.
+type joinValues struct {
+	rows       map[string]map[string]any
+	invalid    int64
+	duplicates int64
+}
+
+// loadJoinValues reads the join input into memory and returns its rows with the property
+// columns to join: keep, or every property column of the file.
+func loadJoinValues(ctx context.Context, path, format string, cellGrid grid.CellGeometry, keep []string) (joinValues, []string, error) {
+	values := joinValues{rows: make(map[string]map[string]any)}
+	src, err := input.Open(path, format, parquetreader.ReaderOptions{Grid: cellGrid, Columns: keep})
+	if err != nil {
+		return values, nil, err
+	}
+	defer src.Close()
+
+	columns := keep
+	if len(columns) == 0 {
+		columns = slices.Sorted(maps.Keys(src.PropertyTypes()))
+	}
+	for {
+		row, err := src.NextContext(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return values, nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if row.Err != nil || row.CellString == "" {
+			values.invalid++
+			continue
+		}
+		if _, ok := values.rows[row.CellString]; ok {
+			values.duplicates++
+		}
+		values.rows[row.CellString] = row.Properties
+	}
+	return values, columns, nil
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/parquet-go/parquet-go"
-	h3 "github.com/uber/h3-go/v4"
+	"github.com/spf13/pflag"
 
 	"github.com/hexatiles/hexatiles/internal/build"
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/input"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+	"github.com/hexatiles/hexatiles/internal/publish"
+	"github.com/hexatiles/hexatiles/internal/telemetry"
 	"github.com/hexatiles/hexatiles/internal/tiler"
 	"github.com/hexatiles/hexatiles/internal/validate"
 )
@@ -25,7 +33,20 @@ var (
 )
 
 func main() {
-	if err := newRootCommand().Execute(); err != nil {
+	// Under HEXATILES_FAKE_TOOLS the tippecanoe and pmtiles stubs re-execute this binary.
+	tiler.RunFakeTool()
+
+	// Ctrl-C cancels the command context so builds and scans stop at the next read.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, usage := telemetry.WithUsage(ctx)
+	start := time.Now()
+	cmd, err := newRootCommand().ExecuteContextC(ctx)
+	stop()
+	if cmd != nil && cmd.Name() != "telemetry" {
+		// Records nothing unless the user opted in; its errors never fail the command.
+		_ = telemetry.Record(context.Background(), cmd.Name(), time.Since(start), err == nil, usage, version)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -53,6 +74,17 @@ func newRootCommand() *cobra.Command {
 	cmd.AddCommand(newPreviewCommand())
 	cmd.AddCommand(newSchemaCommand())
 	cmd.AddCommand(newSampleCommand())
+	cmd.AddCommand(newZoomsCommand())
+	cmd.AddCommand(newIndexCommand())
+	cmd.AddCommand(newPolyfillCommand())
+	cmd.AddCommand(newQueryCommand())
+	cmd.AddCommand(newMergeCommand())
+	cmd.AddCommand(newJoinCommand())
+	cmd.AddCommand(newDiffCommand())
+	cmd.AddCommand(newUploadCommand())
+	cmd.AddCommand(newServeCommand())
+	cmd.AddCommand(newCheckCommand())
+	cmd.AddCommand(newTelemetryCommand())
 
 	return cmd
 }
@@ -65,6 +97,23 @@ func newBuildCommand() *cobra.Command {
 			input, _ := cmd.Flags().GetString("in")
 			output, _ := cmd.Flags().GetString("out")
 			keepNDJSON, _ := cmd.Flags().GetBool("keep-ndjson")
+			ndjsonFormat, _ := cmd.Flags().GetString("ndjson-format")
+			noProgress, _ := cmd.Flags().GetBool("no-progress")
+			cacheDir, _ := cmd.Flags().GetString("cache-dir")
+			ndjsonBBox, _ := cmd.Flags().GetBool("ndjson-bbox")
+			winding, _ := cmd.Flags().GetString("winding")
+			quickPreview, _ := cmd.Flags().GetBool("quick-preview")
+			flattenNested, _ := cmd.Flags().GetBool("flatten-nested")
+			keepMBTiles, _ := cmd.Flags().GetBool("keep-mbtiles")
+			skipPMTiles, _ := cmd.Flags().GetBool("skip-pmtiles")
+			directPMTiles, _ := cmd.Flags().GetBool("direct-pmtiles")
+			outputFormat, _ := cmd.Flags().GetString("output-format")
+			emptyTiles, _ := cmd.Flags().GetString("empty-tiles")
+			tilerName, _ := cmd.Flags().GetString("tiler")
+			strict, _ := cmd.Flags().GetBool("strict")
+			coverageThreshold, _ := cmd.Flags().GetFloat64("coverage-threshold")
+			lenient, _ := cmd.Flags().GetBool("lenient")
+			zoomCap, _ := cmd.Flags().GetInt("zoom-cap")
 			minZoom, _ := cmd.Flags().GetInt("minzoom")
 			maxZoom, _ := cmd.Flags().GetInt("maxzoom")
 			minRes, _ := cmd.Flags().GetInt("min-res")
@@ -74,6 +123,8 @@ func newBuildCommand() *cobra.Command {
 			quantizeSpec, _ := cmd.Flags().GetString("quantize")
 			simplify, _ := cmd.Flags().GetBool("simplify")
 			threads, _ := cmd.Flags().GetInt("threads")
+			decodeThreads, _ := cmd.Flags().GetInt("decode-threads")
+			encodeThreads, _ := cmd.Flags().GetInt("encode-threads")
 			propertyCap, _ := cmd.Flags().GetInt("property-cap")
 			tippecanoeBin, _ := cmd.Flags().GetString("tippecanoe-bin")
 			pmtilesBin, _ := cmd.Flags().GetString("pmtiles-bin")
@@ -81,71 +132,307 @@ func newBuildCommand() *cobra.Command {
             description, _ := cmd.Flags().GetString("description")
             attribution, _ := cmd.Flags().GetString("attribution")
             version, _ := cmd.Flags().GetString("tileset-version")
+			profile, _ := cmd.Flags().GetString("profile")
+			nonFinite, _ := cmd.Flags().GetString("nonfinite")
+			reservedKeys, _ := cmd.Flags().GetString("reserved-keys")
+			stringMaxBytes, _ := cmd.Flags().GetInt("string-max-bytes")
+			gridName, _ := cmd.Flags().GetString("grid")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			arcsInput, _ := cmd.Flags().GetString("arcs")
+			sourceRetries, _ := cmd.Flags().GetInt("retries")
+			keepGoing, _ := cmd.Flags().GetBool("keep-going")
+			if sourceRetries < 0 {
+				return fmt.Errorf("--retries must not be negative")
+			}
+			extrudeBy, _ := cmd.Flags().GetString("extrude-by")
+			extrudeScale, _ := cmd.Flags().GetFloat64("extrude-scale")
+			classifySpec, _ := cmd.Flags().GetString("classify")
+			keepUnusable, _ := cmd.Flags().GetBool("keep-unusable")
+			expectFile, _ := cmd.Flags().GetString("expect")
+			emitCommands, _ := cmd.Flags().GetString("emit-commands")
+			valueMaps, _ := cmd.Flags().GetStringArray("value-map")
+			where, _ := cmd.Flags().GetString("where")
+			if filter, _ := cmd.Flags().GetString("filter"); filter != "" {
+				if where != "" {
+					return fmt.Errorf("--filter is an alias of --where; set only one")
+				}
+				where = filter
+			}
+			topPerParent, _ := cmd.Flags().GetString("top-per-parent")
+			featureLimit, _ := cmd.Flags().GetInt("feature-limit")
+			conserve, _ := cmd.Flags().GetString("conserve")
+			aggregate, _ := cmd.Flags().GetString("aggregate")
+			tracePath, _ := cmd.Flags().GetString("trace")
+			debugDrops, _ := cmd.Flags().GetString("debug-drops")
+			types, _ := cmd.Flags().GetString("types")
+			tippecanoeArgs, _ := cmd.Flags().GetStringArray("tippecanoe-arg")
+			pyramid, _ := cmd.Flags().GetString("pyramid")
+			adaptiveMaxZoom, _ := cmd.Flags().GetString("adaptive-maxzoom")
+			compact, _ := cmd.Flags().GetBool("compact")
+			dissolveBy, _ := cmd.Flags().GetString("dissolve-by")
+			reportFormat, _ := cmd.Flags().GetString("report-format")
+			publishSpecs, _ := cmd.Flags().GetStringArray("publish")
+			if output == "" {
+				derivedOut, derivedName := build.DeriveOutput(input)
+				output = derivedOut
+				if name == "" {
+					name = derivedName
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "→ --out not set; writing %s (tileset name %q)\n", output, name)
+			}
 
 			opts := build.Options{
-				InputPath:       input,
-				OutputPMTiles:   output,
-				KeepNDJSON:      keepNDJSON,
-				MinZoom:         minZoom,
-				MaxZoom:         maxZoom,
-				MinResolution:   minRes,
-				MaxResolution:   maxRes,
-				PropertyInclude: parseList(propsKeepStr),
-				PropertyDrop:    parseList(propsDropStr),
-				QuantizeSpec:    quantizeSpec,
-				Simplify:        simplify,
-				Threads:         threads,
-				PropertyByteCap: propertyCap,
-				TippecanoePath:  tippecanoeBin,
-				PMTilesPath:     pmtilesBin,
-                Metadata: map[string]string{
-                    "name":        name,
-                    "description": description,
-                    "attribution": attribution,
-                    "version":     version,
-                },
+				InputPath:           input,
+				InputFormat:         inputFormat,
+				FlattenNested:       flattenNested,
+				OutputPMTiles:       output,
+				SkipPMTiles:         skipPMTiles,
+				DirectPMTiles:       directPMTiles,
+				OutputFormat:        outputFormat,
+				EmptyTiles:          emptyTiles,
+				Tiler:               tilerName,
+				Strict:              strict,
+				CoverageThreshold:   coverageThreshold,
+				Lenient:             lenient,
+				ZoomCap:             zoomCap,
+				KeepNDJSON:          keepNDJSON,
+				NDJSONFormat:        ndjsonFormat,
+				NDJSONBBox:          ndjsonBBox,
+				Winding:             winding,
+				KeepMBTiles:         keepMBTiles,
+				MinZoom:             minZoom,
+				MaxZoom:             maxZoom,
+				MinResolution:       minRes,
+				MaxResolution:       maxRes,
+				PropertyInclude:     parseList(propsKeepStr),
+				PropertyDrop:        parseList(propsDropStr),
+				QuantizeSpec:        quantizeSpec,
+				Simplify:            simplify,
+				Threads:             threads,
+				DecodeThreads:       decodeThreads,
+				EncodeThreads:       encodeThreads,
+				PropertyByteCap:     propertyCap,
+				TippecanoePath:      tippecanoeBin,
+				PMTilesPath:         pmtilesBin,
+				ExtraTippecanoeArgs: tippecanoeArgs,
+				Metadata: map[string]string{
+					"name":        name,
+					"description": description,
+					"attribution": attribution,
+					"version":     version,
+				},
+				Profile:         profile,
+				Explicit:        changedFlags(cmd),
+				NonFinite:       nonFinite,
+				ReservedKeys:    reservedKeys,
+				StringMaxBytes:  stringMaxBytes,
+				Grid:            gridName,
+				ArcsInput:       arcsInput,
+				SourceRetries:   sourceRetries,
+				KeepGoing:       keepGoing,
+				ExtrudeBy:       extrudeBy,
+				ExtrudeScale:    extrudeScale,
+				Classify:        classifySpec,
+				KeepUnusable:    keepUnusable,
+				ExpectFile:      expectFile,
+				EmitCommands:    emitCommands,
+				ValueMaps:       valueMaps,
+				Where:           where,
+				TopPerParent:    topPerParent,
+				FeatureLimit:    featureLimit,
+				Conserve:        parseList(conserve),
+				Aggregate:       aggregate,
+				Pyramid:         pyramid,
+				AdaptiveMaxZoom: adaptiveMaxZoom,
+				Compact:         compact,
+				DissolveBy:      parseList(dissolveBy),
+				Trace:           tracePath,
+				CacheDir:        cacheDir,
+				QuickPreview:    quickPreview,
+				DebugDrops:      debugDrops,
+				Types:           types,
+				ReportFormats:   parseList(reportFormat),
 			}
 
+			// The tileset owns stdout when streamed; progress goes to stderr.
+			status := cmd.OutOrStdout()
+			if output == build.Stdout {
+				status = cmd.ErrOrStderr()
+				opts.Stdout = cmd.OutOrStdout()
+			}
+			if !noProgress && isTerminal(cmd.ErrOrStderr()) {
+				opts.Progress = cmd.ErrOrStderr()
+			}
+			// Destinations are checked up front so a typo does not surface after the build.
+			var publishers []publish.Publisher
+			for _, spec := range publishSpecs {
+				if output == build.Stdout {
+					return fmt.Errorf("--publish needs a file output, not --out -")
+				}
+				publisher, err := publish.Open(spec)
+				if err != nil {
+					return err
+				}
+				if err := publisher.Validate(cmd.Context()); err != nil {
+					return fmt.Errorf("--publish %s: %w", spec, err)
+				}
+				publishers = append(publishers, publisher)
+			}
 			result, err := build.Run(cmd.Context(), opts)
-			if err != nil {
+			// A --keep-going build that left out a layer still wrote and publishes the tileset;
+			// the error only sets the exit status at the end.
+			var partial *build.PartialError
+			if err != nil && !errors.As(err, &partial) {
 				return err
 			}
+			telemetry.SetRows(cmd.Context(), result.Report.Metrics.TotalRows)
 
-			rep := result.Report
-			dropped := rep.Metrics.TotalRows - rep.Metrics.EmittedFeatures
-			fmt.Fprintf(cmd.OutOrStdout(), "✔ build complete in %s\n", formatDuration(rep.Metrics.Duration))
-			fmt.Fprintf(cmd.OutOrStdout(), "  tiles: %s (%s)\n", rep.Metrics.PMTilesPath, formatBytes(rep.Metrics.PMTilesSize))
-			fmt.Fprintf(cmd.OutOrStdout(), "  features: %d emitted, %d dropped\n", rep.Metrics.EmittedFeatures, dropped)
-			fmt.Fprintf(cmd.OutOrStdout(), "  report: %s\n", filepath.Join(filepath.Dir(rep.Config.OutputPMTiles), "report.html"))
+			fmt.Fprintf(status, "✔ build complete in %s\n", formatDuration(result.Durations.Total))
+			tiles := result.OutputPath
+			if tiles == build.Stdout {
+				tiles = "stdout"
+			}
+			fmt.Fprintf(status, "  tiles: %s (%s)\n", tiles, formatBytes(result.Size))
+			fmt.Fprintf(status, "  features: %d emitted, %d dropped\n", result.FeatureCount, result.DroppedCount)
+			if result.RollupCount > 0 {
+				fmt.Fprintf(status, "  pyramid: %d parent cells (%s)\n", result.RollupCount, result.Report.Config.Pyramid)
+			}
+			if zooms := result.Report.Metrics.AdaptiveZooms; len(zooms) > 0 {
+				parts := make([]string, len(zooms))
+				for i, z := range zooms {
+					parts[i] = fmt.Sprintf("z%d %d", z.MaxZoom, z.Regions)
+				}
+				fmt.Fprintf(status, "  adaptive max zoom: regions per max zoom %s\n", strings.Join(parts, ", "))
+			}
+			if result.Report.Config.Compact {
+				fmt.Fprintf(status, "  compact: %d cells became %d hexagons\n", result.FeatureCount, result.CompactedCount)
+			}
+			if len(result.Report.Config.DissolveBy) > 0 {
+				fmt.Fprintf(status, "  dissolve: %d cells became %d polygons\n", result.FeatureCount, result.DissolvedCount)
+			}
+			if inherited := result.Report.Config.InheritedMetadata; len(inherited) > 0 {
+				fmt.Fprintf(status, "  metadata: %s from the input\n", strings.Join(inherited, ", "))
+			}
+			if result.MBTilesPath != "" {
+				fmt.Fprintf(status, "  mbtiles: %s\n", result.MBTilesPath)
+			}
+			if result.PreviewPath != "" {
+				fmt.Fprintf(status, "  preview: %s (%s)\n", result.PreviewPath, formatBytes(result.Report.Metrics.PreviewSize))
+			}
+			if cached := result.Report.Metrics.CachedStages; len(cached) > 0 {
+				fmt.Fprintf(status, "  cache: reused %s\n", strings.Join(cached, ", "))
+			}
+			if result.ReportPath != "" {
+				fmt.Fprintf(status, "  report: %s\n", result.ReportPath)
+			}
+			if result.ReportJSONPath != "" {
+				fmt.Fprintf(status, "  report: %s\n", result.ReportJSONPath)
+			}
+			if result.CommandsPath != "" {
+				fmt.Fprintf(status, "  commands: %s\n", result.CommandsPath)
+			}
+			if result.TracePath != "" {
+				fmt.Fprintf(status, "  trace: %s\n", result.TracePath)
+			}
+			if result.DropsPath != "" {
+				fmt.Fprintf(status, "  drops: %s\n", result.DropsPath)
+			}
+			if partial != nil {
+				for _, src := range partial.Failed {
+					fmt.Fprintf(status, "  left out: %s layer after %d attempts (%s)\n", src.Config.Layer, src.Metrics.Retries+1, src.Metrics.Failure)
+				}
+			}
 
+			if len(publishers) > 0 {
+				plan, err := planUpload(result.OutputPath, "", true, false, "")
+				if err != nil {
+					return err
+				}
+				if err := publishPlan(cmd.Context(), status, publishers, plan); err != nil {
+					return err
+				}
+			}
+			if partial != nil {
+				return partial
+			}
 			return nil
 		},
 	}
 
 	cmd.SilenceUsage = true
 
-	cmd.Flags().String("in", "", "Input Parquet file")
-	cmd.Flags().String("out", "", "Output PMTiles file path")
+	cmd.Flags().String("in", "", "Input Parquet file, Hive-partitioned directory, s3://, gs:// or https:// URL, or - for NDJSON on stdin")
+	cmd.Flags().String("out", "", "Output PMTiles file path, or - to stream the tileset to stdout (default: dist/<input-basename>.pmtiles)")
+	cmd.Flags().String("output-format", build.FormatPMTiles, "Tileset format: pmtiles or mbtiles (mbtiles is the same as --skip-pmtiles)")
+	cmd.Flags().String("grid", "h3", "Cell grid of the input column: "+strings.Join(grid.Names(), "|"))
+	cmd.Flags().String("input-format", "", "Input format: "+strings.Join(input.Formats(), "|")+" (default: from file extension)")
+	cmd.Flags().String("arcs", "", "Optional Parquet file of h3_origin,h3_dest,count rows to tile as an \"arcs\" layer")
+	cmd.Flags().Int("retries", 0, "Attempt a failed open of --in, its prescan or the read of --arcs this many more times, waiting 1s, 2s, 4s... in between (a read failing partway through tiling --in still stops the build)")
+	cmd.Flags().Bool("keep-going", false, "Write the tileset without the --arcs layer when it fails every attempt, then exit non-zero")
+	cmd.Flags().String("extrude-by", "", "Numeric property to normalize into a \"height\" attribute for fill-extrusion")
+	cmd.Flags().Float64("extrude-scale", 1000, "Height in meters given to the largest --extrude-by value")
+	cmd.Flags().String("classify", "", "Classify numeric properties into a <prop>_class attribute (prop:quantile|jenks|equal-interval:classes, comma-separated)")
+	cmd.Flags().String("where", "", "Only tile rows matching an expression such as \"score > 0 && category != 'test'\" (==, !=, <, <=, >, >=, &&, ||, !)")
+	cmd.Flags().String("filter", "", "Alias of --where")
+	cmd.Flags().Int("feature-limit", 0, "Keep at most this many cells per tile below --maxzoom (0: no limit; tippecanoe drops, the native tiler thins)")
+	cmd.Flags().String("aggregate", "", "Merge rows sharing a cell into one feature, e.g. score=mean,count=sum,category=mode (sum, mean, min, max, count, mode or first; other properties come from the first row)")
+	cmd.Flags().Bool("compact", false, "Merge complete sets of sibling H3 cells with identical (quantized) properties into their parents")
+	cmd.Flags().String("dissolve-by", "", "Comma-separated properties: union touching H3 cells with equal values into one polygon per region, keeping only these properties and a cells count")
+	cmd.Flags().String("pyramid", "", "Tile parent cells at coarser resolutions for the low zooms, e.g. 5,7 or 5:0-6,7:7-9; values roll up with --aggregate")
+	cmd.Flags().String("adaptive-maxzoom", "", "End the tiles of sparse regions early: FLOOR[:RES] gives each resolution-RES parent (default 3) a max zoom by its cell count, from the max zoom for the densest down to FLOOR")
+	cmd.Flags().String("conserve", "", "Comma-separated numeric properties whose totals survive dropping: dropped cells add their values to nearby kept cells")
+	cmd.Flags().String("top-per-parent", "", "Keep only the top N cells under each coarser parent cell, ranked by a numeric property (res=5,n=1000,by=score)")
+	cmd.Flags().Bool("flatten-nested", false, "Read each leaf of a nested Parquet field as its own property keyed by its dotted path (address.city) instead of one property holding the field's JSON text")
+	cmd.Flags().String("types", "", "Coerce properties to declared types before quantization and encoding (score:float,flag:bool,zip:string); values that do not convert become null")
+	cmd.Flags().StringArray("value-map", nil, "Replace property codes with labels from a code,label CSV (prop=table.csv; prop:code=table.csv maps labels to codes; repeatable)")
+	cmd.Flags().Bool("skip-pmtiles", false, "Stop after tippecanoe and keep the MBTiles (next to --out) as the output")
+	cmd.Flags().String("empty-tiles", "elide", "Featureless tiles inside the bounds: elide (sparse archive) or write (explicit empty tiles)")
+	cmd.Flags().Bool("direct-pmtiles", false, "Have tippecanoe (2.17+) write --out directly, skipping the intermediate MBTiles")
+	cmd.Flags().String("tiler", tiler.TilerTippecanoe, "Tile generator: tippecanoe, or native to encode tiles in-process without tippecanoe")
 	cmd.Flags().Bool("keep-ndjson", false, "Keep intermediate NDJSON output")
+	cmd.Flags().String("cache-dir", "", "Keep the NDJSON and tiles in this directory, keyed by the input contents and options, so a rerun skips unchanged stages")
+	cmd.Flags().Bool("no-progress", false, "Do not draw a progress bar on stderr (drawn only when stderr is a terminal)")
+	cmd.Flags().String("ndjson-format", ndjson.FormatNDJSON, "Format of the intermediate features: ndjson|geojsonseq (RFC 8142 text sequences)")
+	cmd.Flags().Bool("quick-preview", false, "Also write <out>.preview.pmtiles: a 1% sample of the features up to z8, for a quick look while the full archive deploys")
+	cmd.Flags().Bool("ndjson-bbox", false, "Write each feature's bounding box into the intermediate NDJSON (tippecanoe does not use it)")
+	cmd.Flags().String("winding", string(ndjson.WindingCCW), "Polygon ring order of the NDJSON features: ccw (RFC 7946 right-hand rule) or cw for legacy consumers; tiles follow the MVT spec either way")
+	cmd.Flags().Bool("keep-mbtiles", false, "Keep the intermediate MBTiles next to --out after converting it to PMTiles")
+	cmd.Flags().String("report-format", build.ReportHTML, "Reports written next to the output: comma-separated html and json, or none")
+	cmd.Flags().StringArray("publish", nil, "Publish the tileset and reports after the build (repeatable): a directory or "+strings.Join(publish.Names(), ", ")+" destination")
+	cmd.Flags().String("trace", "", "Write a Chrome trace of the build phases, workers and queues to this JSON file (open in ui.perfetto.dev)")
+	cmd.Flags().String("debug-drops", "", "Write the first rows dropped by the property cap, with their full properties and per-column sizes, to this NDJSON file")
+	cmd.Flags().String("emit-commands", "", "Write the resolved tippecanoe and pmtiles commands to this shell script (implies --keep-ndjson)")
 	cmd.Flags().Int("minzoom", -1, "Minimum zoom level (default: derived)")
 	cmd.Flags().Int("maxzoom", -1, "Maximum zoom level (default: derived)")
+	cmd.Flags().Int("zoom-cap", build.DefaultZoomCap, "Deepest zoom generated, whether derived, set with --maxzoom or reached by tippecanoe extending zooms (max 24)")
+	cmd.Flags().Bool("strict", false, "Fail instead of warning when --maxzoom does not suit the data resolution (see 'hexatiles zooms') or a zoom falls below --coverage-threshold")
+	cmd.Flags().Float64("coverage-threshold", build.DefaultCoverageThreshold, "Share of the tiles holding input cells each zoom must contain before it is flagged as sparse; negative disables the check")
+	cmd.Flags().Bool("lenient", false, "Warn instead of failing when fewer or more rows are read than the Parquet footer declares (truncated or corrupt input)")
 	cmd.Flags().Int("min-res", -1, "Minimum allowed H3 resolution")
 	cmd.Flags().Int("max-res", -1, "Maximum allowed H3 resolution")
 	cmd.Flags().String("props", "", "Comma-separated whitelist of properties to keep")
 	cmd.Flags().String("props-drop", "", "Glob pattern of properties to drop")
+	cmd.Flags().String("expect", "", "YAML file of assertions such as 'emitted_features >= 1_000_000'; a failing assertion fails the build")
+	cmd.Flags().Bool("keep-unusable", false, "Keep entirely null, constant and binary columns that keep-all or --props-drop would otherwise let through")
 	cmd.Flags().String("quantize", "", "Quantization directives (float=0.01,int=1)")
 	cmd.Flags().Bool("simplify", false, "Simplify polygons (default false)")
 	cmd.Flags().Int("threads", 0, "Number of worker threads (default: runtime.NumCPU())")
+	cmd.Flags().Int("decode-threads", 0, "Row groups read and decoded concurrently (default: --threads)")
+	cmd.Flags().Int("encode-threads", 0, "Polygonization/JSON workers (default: --threads)")
+	cmd.Flags().String("nonfinite", "null", "Handling of NaN/Inf numeric properties: drop|null|clamp")
+	cmd.Flags().String("reserved-keys", "rename", "Input properties named like the cell field or resolution holding another value: rename (to <key>_src)|drop|fail")
+	cmd.Flags().Int("string-max-bytes", 0, "Truncate string properties to this many bytes (0 to disable)")
 	cmd.Flags().Int("property-cap", 2048, "Maximum property bytes per feature (0 to disable)")
 	cmd.Flags().String("tippecanoe-bin", "", "Override tippecanoe binary path")
+	cmd.Flags().StringArray("tippecanoe-arg", nil, "Extra tippecanoe argument in --flag=value form, e.g. --drop-rate=2 (repeatable)")
 	cmd.Flags().String("pmtiles-bin", "", "Override pmtiles binary path")
-	cmd.Flags().String("name", "", "Tileset name (metadata)")
-	cmd.Flags().String("description", "", "Tileset description (metadata)")
-	cmd.Flags().String("attribution", "", "Tileset attribution (metadata)")
+	cmd.Flags().String("name", "", "Tileset name (metadata; defaults to the input basename when --out is omitted, else to the Parquet name or title metadata)")
+	cmd.Flags().String("description", "", "Tileset description (metadata; defaults to the Parquet description metadata)")
+	cmd.Flags().String("attribution", "", "Tileset attribution (metadata; defaults to the Parquet attribution or license metadata)")
 	cmd.Flags().String("tileset-version", "", "Tileset semantic version (metadata)")
+	cmd.Flags().String("profile", "", "Tiling preset: "+strings.Join(build.ProfileNames(), "|"))
 
 	cmd.MarkFlagRequired("in")
-	cmd.MarkFlagRequired("out")
 
 	return cmd
 }
@@ -162,28 +449,91 @@ func newValidateCommand() *cobra.Command {
 			minRes, _ := cmd.Flags().GetInt("min-res")
 			maxRes, _ := cmd.Flags().GetInt("max-res")
 			sampleLimit, _ := cmd.Flags().GetInt("sample")
+			gridName, _ := cmd.Flags().GetString("grid")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			offset, _ := cmd.Flags().GetInt64("offset")
+			limitRows, _ := cmd.Flags().GetInt64("limit-rows")
+			timeBudget, _ := cmd.Flags().GetDuration("time-budget")
+			if offset < 0 || limitRows < 0 || timeBudget < 0 {
+				return fmt.Errorf("--offset, --limit-rows and --time-budget must not be negative")
+			}
+			useCache, _ := cmd.Flags().GetBool("cache")
+			cacheFile, _ := cmd.Flags().GetString("cache-file")
+			var cache *validate.Cache
+			if useCache || cacheFile != "" {
+				if cacheFile == "" {
+					dir, err := os.UserCacheDir()
+					if err != nil {
+						return fmt.Errorf("locate cache directory: %w (set --cache-file)", err)
+					}
+					if err := os.MkdirAll(filepath.Join(dir, "hexatiles"), 0o755); err != nil {
+						return fmt.Errorf("create cache directory: %w", err)
+					}
+					cacheFile = filepath.Join(dir, "hexatiles", "validate.json")
+				}
+				var err error
+				if cache, err = validate.OpenCache(cacheFile); err != nil {
+					return err
+				}
+				defer func() {
+					if err := cache.Save(); err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "warning: %v\n", err)
+					}
+				}()
+			}
 
 			hasErrors := false
+			var scannedRows int64
 
 			for _, path := range inputs {
 				opts := validate.Options{
 					InputPath:     path,
+					InputFormat:   inputFormat,
 					MinResolution: minRes,
 					MaxResolution: maxRes,
 					SampleLimit:   sampleLimit,
+					Grid:          gridName,
+					Offset:        offset,
+					LimitRows:     limitRows,
+					TimeBudget:    timeBudget,
 				}
 
-				res, err := validate.Run(cmd.Context(), opts)
+				res, err := validate.RunCached(cmd.Context(), opts, cache)
 				if err != nil {
 					return fmt.Errorf("%s: %w", path, err)
 				}
+				scannedRows += res.TotalRows
+				telemetry.SetRows(cmd.Context(), scannedRows)
 
 				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", path)
-				fmt.Fprintf(cmd.OutOrStdout(), "  rows: %d valid: %d invalid: %d filtered: %d\n", res.TotalRows, res.ValidRows, res.InvalidCells, res.ResolutionFiltered)
+				if res.Cached {
+					fmt.Fprintf(cmd.OutOrStdout(), "  cached: unchanged since the last validation\n")
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "  rows: %d valid: %d invalid: %d null: %d filtered: %d\n", res.TotalRows, res.ValidRows, res.InvalidCells, res.NullCells, res.ResolutionFiltered)
+				if res.MissingColumn > 0 {
+					hasErrors = true
+					fmt.Fprintf(cmd.OutOrStdout(), "  missing cell column: %d rows (check the --grid column names)\n", res.MissingColumn)
+				}
 				if res.MinResolutionSeen >= 0 {
 					fmt.Fprintf(cmd.OutOrStdout(), "  resolutions: r%d -> r%d\n", res.MinResolutionSeen, res.MaxResolutionSeen)
 				}
 				fmt.Fprintf(cmd.OutOrStdout(), "  duration: %s\n", formatDuration(res.Duration))
+				if res.Partial() {
+					scope := fmt.Sprintf("rows %d-%d", res.Offset+1, res.Offset+res.TotalRows)
+					if res.Estimate != nil && res.Estimate.FileRows >= 0 {
+						scope += fmt.Sprintf(" of %d", res.Estimate.FileRows)
+					}
+					if res.Stopped != "" {
+						scope += fmt.Sprintf(" (stopped: %s)", res.Stopped)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "  checked: %s\n", scope)
+				}
+				if est := res.Estimate; est != nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "  estimated invalid rate: %.4f%% (95%% CI %.4f%%-%.4f%%)\n", est.InvalidRate*100, est.RateLow*100, est.RateHigh*100)
+					if est.FileRows >= 0 {
+						fmt.Fprintf(cmd.OutOrStdout(), "  estimated invalid rows in file: %d (95%% CI %d-%d)\n", est.Invalid, est.InvalidLow, est.InvalidHigh)
+					}
+				}
 
 				if res.InvalidCells > 0 {
 					hasErrors = true
@@ -198,7 +548,7 @@ func newValidateCommand() *cobra.Command {
 			}
 
 			if hasErrors {
-				return fmt.Errorf("validation failed: invalid H3 cells detected")
+				return fmt.Errorf("validation failed: invalid H3 cells or missing cell column")
 			}
 
 			return nil
@@ -211,6 +561,13 @@ func newValidateCommand() *cobra.Command {
 	cmd.Flags().Int("min-res", -1, "Minimum allowed H3 resolution")
 	cmd.Flags().Int("max-res", -1, "Maximum allowed H3 resolution")
 	cmd.Flags().Int("sample", 5, "Number of invalid samples to display")
+	cmd.Flags().String("grid", "h3", "Cell grid of the input column: "+strings.Join(grid.Names(), "|"))
+	cmd.Flags().String("input-format", "", "Input format: "+strings.Join(input.Formats(), "|")+" (default: from file extension)")
+	cmd.Flags().Int64("offset", 0, "Skip this many rows before validating")
+	cmd.Flags().Int64("limit-rows", 0, "Validate at most this many rows (0 = all); partial scans report an extrapolated invalid rate")
+	cmd.Flags().Duration("time-budget", 0, "Stop validating after this long, e.g. 5m (0 = no limit)")
+	cmd.Flags().Bool("cache", false, "Skip files whose size, mtime or checksum match a previous full validation with the same options")
+	cmd.Flags().String("cache-file", "", "Validation cache file (implies --cache; default: hexatiles/validate.json in the user cache directory)")
 	cmd.MarkFlagRequired("in")
 
 	return cmd
@@ -223,6 +580,10 @@ func newInspectCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			input, _ := cmd.Flags().GetString("in")
 			binPath, _ := cmd.Flags().GetString("pmtiles-bin")
+			if serve, _ := cmd.Flags().GetBool("serve"); serve {
+				port, _ := cmd.Flags().GetInt("port")
+				return serveArchive(cmd.Context(), input, port, cmd.OutOrStdout())
+			}
 			converter, err := tiler.NewPMTilesConverter(binPath)
 			if err != nil {
 				return err
@@ -256,6 +617,8 @@ func newInspectCommand() *cobra.Command {
 
 	cmd.Flags().String("in", "", "PMTiles file to inspect")
 	cmd.Flags().String("pmtiles-bin", "", "Override pmtiles binary path")
+	cmd.Flags().Bool("serve", false, "Serve /metadata, /tilejson and /tiles/{z}/{x}/{y} from the archive over HTTP until interrupted")
+	cmd.Flags().Int("port", 0, "Port for --serve (0 selects a random port)")
 	cmd.MarkFlagRequired("in")
 	return cmd
 }
@@ -282,95 +645,22 @@ func parseList(value string) []string {
 	return out
 }
 
-func newSampleCommand() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "sample",
-		Short: "Generate a sample Parquet file with H3 hexagons for testing",
-		Long:  "Generate a sample Parquet file containing H3 hexagons around Boston Common with demo data (score, category).",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			output, _ := cmd.Flags().GetString("out")
-			count, _ := cmd.Flags().GetInt("count")
-			resolution, _ := cmd.Flags().GetInt("resolution")
-			
-			return generateSampleData(output, count, resolution)
-		},
-	}
-
-	cmd.Flags().StringP("out", "o", "dist/sample.parquet", "Output Parquet file path")
-	cmd.Flags().IntP("count", "c", 5, "Number of rings around center point")
-	cmd.Flags().IntP("resolution", "r", 8, "H3 resolution (0-15)")
-
-	return cmd
+// changedFlags returns the names of the flags given on the command line.
+func changedFlags(cmd *cobra.Command) map[string]bool {
+	changed := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) { changed[f.Name] = true })
+	return changed
 }
 
-// SampleRow represents a row in the sample Parquet file
-type SampleRow struct {
-	H3       string
-	Score    float64
-	Category string
-}
-
-func generateSampleData(outputPath string, ringCount int, resolution int) error {
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	// Generate H3 hexagons around Boston Common (42.355, -71.065)
-	lat, lng := 42.355, -71.065
-	centerHex, err := h3.LatLngToCell(h3.LatLng{Lat: lat, Lng: lng}, resolution)
-	if err != nil {
-		return fmt.Errorf("failed to convert lat/lng to H3 cell: %w", err)
-	}
-	
-	// Get hexagons in rings around the center
-	hexes, err := h3.GridDisk(centerHex, ringCount)
-	if err != nil {
-		return fmt.Errorf("failed to generate H3 grid disk: %w", err)
-	}
-	
-	// Create sample data rows
-	rows := make([]SampleRow, 0, len(hexes))
-	for i, hex := range hexes {
-		score := float64(i%10) * 0.1
-		category := "demo"
-		if i%2 == 1 {
-			category = "test"
-		}
-		rows = append(rows, SampleRow{
-			H3:       h3.IndexToString(uint64(hex)),
-			Score:    score,
-			Category: category,
-		})
-	}
-
-	// Create Parquet file
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create parquet file: %w", err)
-	}
-	defer file.Close()
-
-	// Create Parquet writer with explicit schema
-	schema := parquet.SchemaOf(SampleRow{})
-	writer := parquet.NewGenericWriter[SampleRow](file, schema)
-
-	// Write rows to Parquet
-	_, err = writer.Write(rows)
-	if err != nil {
-		return fmt.Errorf("failed to write parquet data: %w", err)
+// isTerminal reports whether w is a character device, such as a terminal, rather than a file
+// or pipe that a redrawn progress line would clutter.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
 	}
-
-	// Close writer
-	err = writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close parquet writer: %w", err)
-	}
-
-	fmt.Printf("Generated sample data with %d H3 hexagons at resolution %d\n", len(rows), resolution)
-	fmt.Printf("Written to: %s\n", outputPath)
-
-	return nil
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func formatDuration(d time.Duration) string {
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+func newMergeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge --out merged.pmtiles a.pmtiles b.pmtiles...",
+		Short: "Combine PMTiles archives into one",
+		Long: "Merges tilesets built separately, such as one build per region, into one archive. Tiles found in\n" +
+			"several inputs have their layers unioned; bounds and zooms cover every input, and vector_layers,\n" +
+			"tilestats and the property statistics describe the union. The native joiner needs no external\n" +
+			"tools; --joiner tile-join runs tippecanoe's tile-join instead.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("out")
+			joiner, _ := cmd.Flags().GetString("joiner")
+			tileJoinPath, _ := cmd.Flags().GetString("tile-join-path")
+			name, _ := cmd.Flags().GetString("name")
+
+			result, err := tiler.MergePMTiles(cmd.Context(), args, output, tiler.MergeOptions{
+				Joiner:       joiner,
+				TileJoinPath: tileJoinPath,
+				Name:         name,
+			})
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "✔ merged %d archives into %s\n", len(args), output)
+			if result.Overlapping > 0 {
+				fmt.Fprintf(out, "  tiles: %d, %d combined from several inputs\n", result.Tiles, result.Overlapping)
+			} else if result.Tiles > 0 {
+				fmt.Fprintf(out, "  tiles: %d\n", result.Tiles)
+			}
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("out", "", "Merged PMTiles archive to write")
+	cmd.Flags().String("joiner", tiler.JoinerNative, "How to merge: native or tile-join")
+	cmd.Flags().String("tile-join-path", "", "Path to tile-join (default: TILE_JOIN_PATH or PATH)")
+	cmd.Flags().String("name", "", "Name of the merged tileset (default: the first input's)")
+	cmd.MarkFlagRequired("out")
+	return cmd
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/index"
+	"github.com/hexatiles/hexatiles/internal/polyfill"
+)
+
+func newPolyfillCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "polyfill",
+		Short: "Cover GeoJSON or GeoParquet polygons with H3 cells",
+		Long: "Reads polygons from GeoJSON or GeoParquet (WKB geometry) and writes Parquet with one row per H3 cell\n" +
+			"covering them at the chosen resolution, with the feature's attributes copied to each cell, ready for build.\n\n" +
+			"--containment decides which cells cover a polygon: center (cell centre inside, the default), full (cell\n" +
+			"entirely inside) or overlap (cell touches the polygon). A cell covered by several features keeps the\n" +
+			"attributes of the first one.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in, _ := cmd.Flags().GetString("in")
+			output, _ := cmd.Flags().GetString("out")
+			resolution, _ := cmd.Flags().GetInt("resolution")
+			propsFlag, _ := cmd.Flags().GetString("props")
+			geometry, _ := cmd.Flags().GetString("geometry")
+			containment, _ := cmd.Flags().GetString("containment")
+			maxCells, _ := cmd.Flags().GetInt64("max-cells")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			if output == "" {
+				output = index.DeriveOutput(in)
+			}
+			var properties []string
+			if cmd.Flags().Changed("props") {
+				properties = append([]string{}, parseList(propsFlag)...)
+			}
+
+			res, err := polyfill.Run(cmd.Context(), polyfill.Options{
+				InputPath:   in,
+				InputFormat: inputFormat,
+				OutputPath:  output,
+				Resolution:  resolution,
+				Properties:  properties,
+				Geometry:    geometry,
+				Containment: containment,
+				MaxCells:    maxCells,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "✔ covered %d of %d features at r%d in %s (%s)\n", res.Covered, res.Features, resolution, formatDuration(res.Duration), res.Geometry)
+			fmt.Fprintf(cmd.OutOrStdout(), "  output: %s (%d cells)\n", output, res.Written)
+			if len(res.Columns) > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  columns: h3, %s\n", strings.Join(res.Columns, ", "))
+			}
+			if res.Empty > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  empty: %d polygons hold no cell at r%d (try a finer resolution or --containment overlap)\n", res.Empty, resolution)
+			}
+			if res.Skipped > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  skipped: %d features without a polygon geometry\n", res.Skipped)
+			}
+			if res.Duplicates > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  overlaps: %d cells already covered by an earlier feature were not repeated\n", res.Duplicates)
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("in", "", "Input GeoJSON or GeoParquet file (Parquet with a WKB geometry column)")
+	cmd.Flags().String("out", "", "Output Parquet file (default: <input>_h3.parquet next to the input)")
+	cmd.Flags().IntP("resolution", "r", 8, "H3 resolution (0-15)")
+	cmd.Flags().String("props", "", "Comma-separated attributes to copy to each cell (default: all)")
+	cmd.Flags().String("geometry", "", "GeoParquet geometry column (default: geometry, geom, wkb_geometry or the_geom)")
+	cmd.Flags().String("containment", polyfill.ContainCenter, "Cells covering a polygon: center, full or overlap")
+	cmd.Flags().Int64("max-cells", polyfill.DefaultMaxCells, "Fail before a single feature would need more cells than this")
+	cmd.Flags().String("input-format", "", "Input format: geojson or geoparquet (default: from file extension)")
+	cmd.MarkFlagRequired("in")
+
+	return cmd
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -13,9 +14,13 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/classify"
+	"github.com/hexatiles/hexatiles/internal/grid"
 )
 
 func newPreviewCommand() *cobra.Command {
@@ -24,9 +29,35 @@ func newPreviewCommand() *cobra.Command {
 		Short: "Preview PMTiles locally",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			pmtiles, _ := cmd.Flags().GetString("pmtiles")
+			compare, _ := cmd.Flags().GetString("compare")
 			port, _ := cmd.Flags().GetInt("port")
 			autoOpen, _ := cmd.Flags().GetBool("open")
-			return startPreview(cmd.Context(), pmtiles, port, autoOpen, cmd.OutOrStdout())
+			extrude, _ := cmd.Flags().GetBool("extrude")
+			logRanges, _ := cmd.Flags().GetBool("log-ranges")
+			colorBy, _ := cmd.Flags().GetString("color-by")
+			breaks, _ := cmd.Flags().GetString("breaks")
+			palette, _ := cmd.Flags().GetString("palette")
+			basemapName, _ := cmd.Flags().GetString("basemap")
+			export, _ := cmd.Flags().GetString("export")
+			base, err := resolveBasemap(basemapName)
+			if err != nil {
+				return fmt.Errorf("--basemap: %w", err)
+			}
+			var rangeLog io.Writer
+			if logRanges {
+				rangeLog = cmd.ErrOrStderr()
+			}
+			var fill *choropleth
+			if colorBy != "" {
+				if fill, err = newChoropleth(cmd.Context(), pmtiles, colorBy, breaks, palette); err != nil {
+					return fmt.Errorf("--color-by %s: %w", colorBy, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Coloring by %s in %d classes from %s\n", fill.Property, len(fill.Legend())-1, fill.Source)
+			}
+			if export != "" {
+				return exportPreview(cmd.Context(), export, pmtiles, compare, extrude, base, fill, cmd.OutOrStdout())
+			}
+			return startPreview(cmd.Context(), pmtiles, compare, port, autoOpen, extrude, base, fill, cmd.OutOrStdout(), rangeLog)
 		},
 	}
 
@@ -35,40 +66,161 @@ func newPreviewCommand() *cobra.Command {
 	cmd.Flags().String("pmtiles", "", "PMTiles file to preview")
 	cmd.Flags().Int("port", 0, "Port for the preview server (0 selects a random port)")
 	cmd.Flags().Bool("open", false, "Open the preview in your default browser")
+	cmd.Flags().Bool("extrude", false, "Render cells as 3D columns using the height attribute from --extrude-by")
+	cmd.Flags().String("compare", "", "Second PMTiles file shown beside --pmtiles in a synchronized map, to compare two builds")
+	cmd.Flags().String("color-by", "", "Color cells by class of this numeric property, with a legend")
+	cmd.Flags().String("breaks", "quantile:7", "Class breaks of --color-by as method:classes (quantile, jenks or equal-interval)")
+	cmd.Flags().String("palette", classify.DefaultPalette, "Color ramp of --color-by: "+strings.Join(classify.Palettes(), ", ")+" (prefix - to reverse)")
+	cmd.Flags().String("basemap", "osm", "Map under the cells: "+strings.Join(basemapNames(), ", ")+" or the http(s) URL of a MapLibre style")
+	cmd.Flags().String("export", "", "Write the preview to this directory with the archives and pinned scripts, for a static host, instead of serving it")
+	cmd.Flags().Bool("log-ranges", false, "Print the byte range, status and size of each archive request to stderr")
 	cmd.MarkFlagRequired("pmtiles")
 	return cmd
 }
 
-func startPreview(parentCtx context.Context, pmtilesPath string, port int, autoOpen bool, out io.Writer) error {
+// previewAssets locates the MapLibre and PMTiles scripts the preview page loads.
+type previewAssets struct {
+	MapLibreCSS string
+	MapLibreJS  string
+	PMTilesJS   string
+}
+
+// cdnAssets pins the script versions the page is written against.
+var cdnAssets = previewAssets{
+	MapLibreCSS: "https://unpkg.com/maplibre-gl@2.4.0/dist/maplibre-gl.css",
+	MapLibreJS:  "https://unpkg.com/maplibre-gl@2.4.0/dist/maplibre-gl.js",
+	PMTilesJS:   "https://unpkg.com/pmtiles@3.2.1/dist/pmtiles.js",
+}
+
+// previewPage is the data of the preview template. The archive paths are resolved against the
+// page's own URL, so the page works from the preview server and from any static host.
+type previewPage struct {
+	TilesPath   string
+	TilesName   string
+	Compare     bool
+	ComparePath string
+	CompareName string
+	Extrude     bool
+	Basemap     basemap
+	Fill        *choropleth
+	GridKeys    template.JS
+	Assets      previewAssets
+}
+
+func newPreviewPage(absPath, absCompare string, extrude bool, base basemap, fill *choropleth) previewPage {
+	// The inspector lists the cell ID and resolution before the other attributes.
+	keys, _ := json.Marshal(append(grid.Names(), "resolution"))
+	return previewPage{
+		TilesPath:   "/tiles.pmtiles",
+		TilesName:   filepath.Base(absPath),
+		Compare:     absCompare != "",
+		ComparePath: "/compare.pmtiles",
+		CompareName: filepath.Base(absCompare),
+		Extrude:     extrude,
+		Basemap:     base,
+		Fill:        fill,
+		GridKeys:    template.JS(keys),
+		Assets:      cdnAssets,
+	}
+}
+
+// resolveArchives returns the absolute paths of --pmtiles and --compare, checking both exist.
+func resolveArchives(pmtilesPath, comparePath string) (string, string, error) {
 	absPath, err := filepath.Abs(pmtilesPath)
 	if err != nil {
-		return fmt.Errorf("resolve pmtiles path: %w", err)
+		return "", "", fmt.Errorf("resolve pmtiles path: %w", err)
 	}
 	if _, err := os.Stat(absPath); err != nil {
-		return fmt.Errorf("pmtiles file: %w", err)
+		return "", "", fmt.Errorf("pmtiles file: %w", err)
+	}
+	var absCompare string
+	if comparePath != "" {
+		if absCompare, err = filepath.Abs(comparePath); err != nil {
+			return "", "", fmt.Errorf("resolve --compare path: %w", err)
+		}
+		if _, err := os.Stat(absCompare); err != nil {
+			return "", "", fmt.Errorf("--compare file: %w", err)
+		}
+	}
+	return absPath, absCompare, nil
+}
+
+func startPreview(parentCtx context.Context, pmtilesPath, comparePath string, port int, autoOpen, extrude bool, base basemap, fill *choropleth, out, rangeLog io.Writer) error {
+	absPath, absCompare, err := resolveArchives(pmtilesPath, comparePath)
+	if err != nil {
+		return err
 	}
 
 	ctx, stop := signal.NotifyContext(parentCtx, os.Interrupt)
 	defer stop()
 
+	page := newPreviewPage(absPath, absCompare, extrude, base, fill)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if err := previewTemplate.Execute(w, map[string]string{
-			"TilesPath": "/tiles.pmtiles",
-		}); err != nil {
+		if err := previewTemplate.Execute(w, page); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
-	mux.HandleFunc("/tiles.pmtiles", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, absPath)
+	archiveHandler := func(path string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if rangeLog == nil {
+				serveArchiveRange(w, r, path)
+				return
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			serveArchiveRange(rec, r, path)
+			requested := r.Header.Get("Range")
+			if requested == "" {
+				requested = "whole file"
+			}
+			fmt.Fprintf(rangeLog, "%s %s %s %d %s\n", filepath.Base(path), r.Method, requested, rec.status, formatBytes(rec.bytes))
+		}
+	}
+	mux.HandleFunc("/tiles.pmtiles", archiveHandler(absPath))
+	if absCompare != "" {
+		mux.HandleFunc("/compare.pmtiles", archiveHandler(absCompare))
+	}
+
+	return runServer(ctx, mux, fmt.Sprintf("127.0.0.1:%d", port), func(url string) {
+		fmt.Fprintf(out, "Preview available at %s\n", url)
+		if autoOpen {
+			if err := openBrowser(url); err != nil {
+				fmt.Fprintf(out, "(failed to open browser: %v)\n", err)
+			}
+		}
 	})
+}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+// serveArchiveRange answers the Range requests the PMTiles client reads the archive with, so
+// only the header, directories and tiles in view are transferred, however large the archive.
+// The file is opened per request and revalidated on every load, so a rebuild during the preview
+// is picked up on reload; its modification time doubles as the validator for If-Range.
+func serveArchiveRange(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.pmtiles")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
+
+// runServer serves handler on addr (port 0 picks a free port), calls ready with the base URL
+// once it listens, and stops when ctx is cancelled or the server fails.
+func runServer(ctx context.Context, handler http.Handler, addr string, ready func(url string)) error {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("listen: %w", err)
 	}
 
-	server := &http.Server{Handler: mux}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -78,14 +230,7 @@ func startPreview(parentCtx context.Context, pmtilesPath string, port int, autoO
 		close(errCh)
 	}()
 
-	url := fmt.Sprintf("http://%s", listener.Addr().String())
-	fmt.Fprintf(out, "Preview available at %s\n", url)
-
-	if autoOpen {
-		if err := openBrowser(url); err != nil {
-			fmt.Fprintf(out, "(failed to open browser: %v)\n", err)
-		}
-	}
+	ready(fmt.Sprintf("http://%s", listener.Addr().String()))
 
 	select {
 	case <-ctx.Done():
@@ -117,67 +262,170 @@ var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE htm
 <head>
 <meta charset="utf-8" />
 <title>HexaTiles Preview</title>
-<link href="https://unpkg.com/maplibre-gl@2.4.0/dist/maplibre-gl.css" rel="stylesheet" />
-<script src="https://unpkg.com/maplibre-gl@2.4.0/dist/maplibre-gl.js"></script>
-<script src="https://unpkg.com/pmtiles@3.2.1/dist/pmtiles.js"></script>
+<link href="{{ .Assets.MapLibreCSS }}" rel="stylesheet" />
+<script src="{{ .Assets.MapLibreJS }}"></script>
+<script src="{{ .Assets.PMTilesJS }}"></script>
 <style>
   html, body { height: 100%; margin: 0; }
   #map { height: 100%; width: 100%; }
+  #legend { position: absolute; bottom: 30px; left: 10px; background: rgba(255, 255, 255, 0.9); padding: 8px 10px; border-radius: 4px; font: 12px/1.5 sans-serif; box-shadow: 0 1px 4px rgba(0, 0, 0, 0.3); }
+  #info { position: absolute; top: 10px; left: 10px; width: 220px; max-height: calc(100% - 180px); overflow-y: auto; background: rgba(255, 255, 255, 0.9); padding: 8px 10px; border-radius: 4px; font: 12px/1.5 sans-serif; box-shadow: 0 1px 4px rgba(0, 0, 0, 0.3); }
+  #info h3 { margin: 6px 0 2px; font-size: 12px; }
+  #info ul { margin: 0; padding-left: 16px; }
+  .inspect table { border-collapse: collapse; font: 12px/1.4 sans-serif; }
+  .inspect th { text-align: left; padding-right: 8px; color: #555; font-weight: normal; white-space: nowrap; }
+  .inspect td { font-family: monospace; word-break: break-all; }
+  .inspect tr.lead td { font-weight: bold; }
+  body.compare #map { position: absolute; top: 0; bottom: 0; left: 0; width: 50%; }
+  #compare-map { position: absolute; top: 0; bottom: 0; right: 0; width: 50%; border-left: 2px solid #fff; box-sizing: border-box; }
+  .map-label { position: absolute; top: 10px; transform: translateX(-50%); background: rgba(29, 53, 87, 0.85); color: #fff; padding: 2px 8px; border-radius: 3px; font: bold 12px/1.5 sans-serif; pointer-events: none; }
+  #legend .swatch { display: inline-block; width: 14px; height: 14px; margin-right: 6px; vertical-align: middle; border: 1px solid rgba(0, 0, 0, 0.2); }
 </style>
 </head>
-<body>
+<body{{ if .Compare }} class="compare"{{ end }}>
 <div id="map"></div>
+{{ if .Compare }}<div id="compare-map"></div>
+<div class="map-label" style="left: 25%">{{ .TilesName }}</div>
+<div class="map-label" style="left: 75%">{{ .CompareName }}</div>
+{{ end }}<div id="info">
+  <div>Zoom <strong id="info-zoom"></strong> · <span id="info-count">0</span> features in view</div>
+  <div id="info-tiles"></div>
+  <div id="info-layers"></div>
+</div>
+{{ with .Fill }}<div id="legend">
+  <strong>{{ .Property }}</strong>
+  {{ range .Legend }}<div><span class="swatch" style="background: {{ .Color }}"></span>{{ .Label }}</div>
+  {{ end }}
+</div>{{ end }}
 <script>
 (async function() {
   const protocol = new pmtiles.Protocol();
   maplibregl.addProtocol("pmtiles", protocol.tile);
 
-  const tilesUrl = window.location.origin + "{{.TilesPath}}";
+  const tilesUrl = new URL("{{.TilesPath}}", window.location.href).href;
   const pmtilesInstance = new pmtiles.PMTiles(tilesUrl);
   protocol.add(pmtilesInstance);
 
-  const map = new maplibregl.Map({
-    container: "map",
-    style: {
-      version: 8,
-      sources: {
-        "raster-tiles": {
-          type: "raster",
-          tiles: ["https://tile.openstreetmap.org/{z}/{x}/{y}.png"],
-          tileSize: 256,
-          attribution: "© OpenStreetMap contributors"
-        },
-        h3: {
-          type: "vector",
-          url: "pmtiles://" + tilesUrl
+  // Each map copies the basemap style and adds the cells on top; a style URL is fetched once.
+  {{ if .Basemap.StyleURL }}const basemapResponse = await fetch({{ .Basemap.StyleURL }});
+  if (!basemapResponse.ok) throw new Error("basemap style: HTTP " + basemapResponse.status);
+  const basemapStyle = await basemapResponse.json();
+  {{ else }}const basemapStyle = {{ .Basemap.Style }};
+  {{ end }}
+  function mapStyle(url) {
+    const style = JSON.parse(JSON.stringify(basemapStyle));
+    style.sources.h3 = {
+      type: "vector",
+      url: "pmtiles://" + url
+    };
+    style.layers.push(
+      {{ if .Extrude }}{
+        id: "h3-extrusion",
+        type: "fill-extrusion",
+        source: "h3",
+        "source-layer": "h3",
+        paint: {
+          "fill-extrusion-color": {{ if .Fill }}{{ .Fill.FillColor }}{{ else }}"#277da1"{{ end }},
+          "fill-extrusion-height": ["coalesce", ["get", "height"], 0],
+          "fill-extrusion-opacity": 0.8
         }
-      },
-      layers: [
-        {
-          id: "osm-tiles",
-          type: "raster",
-          source: "raster-tiles",
-          minzoom: 0,
-          maxzoom: 19
-        },
-        {
-          id: "h3-fill",
-          type: "fill",
-          source: "h3",
-          "source-layer": "h3",
-          paint: {
-            "fill-color": "#277da1",
-            "fill-opacity": 0.65,
-            "fill-outline-color": "#1d3557"
-          }
+      }{{ else }}{
+        id: "h3-fill",
+        type: "fill",
+        source: "h3",
+        "source-layer": "h3",
+        paint: {
+          "fill-color": {{ if .Fill }}{{ .Fill.FillColor }}{{ else }}"#277da1"{{ end }},
+          "fill-opacity": {{ if .Fill }}0.8{{ else }}0.65{{ end }},
+          "fill-outline-color": "#1d3557"
         }
-      ]
-    },
+      }{{ end }}
+    );
+    return style;
+  }
+
+  const map = new maplibregl.Map({
+    container: "map",
+    style: mapStyle(tilesUrl),
     center: [-71.059570, 42.326054], // Default to Boston area based on sample data
-    zoom: 10
+    zoom: 10{{ if .Extrude }},
+    pitch: 50{{ end }}
   });
 
   map.addControl(new maplibregl.NavigationControl());
+  {{ if .Compare }}
+  // The second build renders with the same style beside the first; moving either map moves
+  // the other, and the flag keeps the echo from bouncing back.
+  const compareUrl = new URL("{{.ComparePath}}", window.location.href).href;
+  protocol.add(new pmtiles.PMTiles(compareUrl));
+  const compareMap = new maplibregl.Map({
+    container: "compare-map",
+    style: mapStyle(compareUrl),
+    center: map.getCenter(),
+    zoom: map.getZoom(),
+    pitch: map.getPitch()
+  });
+  compareMap.addControl(new maplibregl.NavigationControl());
+  let syncing = false;
+  function follow(from, to) {
+    from.on("move", function() {
+      if (syncing) return;
+      syncing = true;
+      to.jumpTo({ center: from.getCenter(), zoom: from.getZoom(), bearing: from.getBearing(), pitch: from.getPitch() });
+      syncing = false;
+    });
+  }
+  follow(map, compareMap);
+  follow(compareMap, map);
+  {{ end }}
+
+  // Feature inspector: hovering shows the attributes of the cell under the cursor; a click pins
+  // them in a popup that stays until closed.
+  const inspectLayer = {{ if .Extrude }}"h3-extrusion"{{ else }}"h3-fill"{{ end }};
+  const leadKeys = {{ .GridKeys }};
+  function inspectTable(feature) {
+    const table = document.createElement("table");
+    table.className = "inspect";
+    const props = feature.properties || {};
+    const keys = Object.keys(props);
+    const lead = leadKeys.filter(function(k) { return k in props; });
+    const rest = keys.filter(function(k) { return !lead.includes(k); }).sort();
+    lead.concat(rest).forEach(function(key) {
+      const row = table.insertRow();
+      if (lead.includes(key)) row.className = "lead";
+      const th = document.createElement("th");
+      th.textContent = key;
+      row.appendChild(th);
+      row.insertCell().textContent = String(props[key]);
+    });
+    return table;
+  }
+  function inspect(m) {
+    const hoverPopup = new maplibregl.Popup({ closeButton: false, closeOnClick: false, maxWidth: "360px" });
+    m.on("mousemove", inspectLayer, function(e) {
+      m.getCanvas().style.cursor = "pointer";
+      hoverPopup.setLngLat(e.lngLat).setDOMContent(inspectTable(e.features[0])).addTo(m);
+    });
+    m.on("mouseleave", inspectLayer, function() {
+      m.getCanvas().style.cursor = "";
+      hoverPopup.remove();
+    });
+    m.on("click", inspectLayer, function(e) {
+      hoverPopup.remove();
+      new maplibregl.Popup({ maxWidth: "360px" }).setLngLat(e.lngLat).setDOMContent(inspectTable(e.features[0])).addTo(m);
+    });
+  }
+  inspect(map);{{ if .Compare }}
+  inspect(compareMap);{{ end }}
+
+  function updateInfo() {
+    document.getElementById("info-zoom").textContent = map.getZoom().toFixed(2);
+    if (map.getLayer(inspectLayer)) {
+      document.getElementById("info-count").textContent = map.queryRenderedFeatures({ layers: [inspectLayer] }).length;
+    }
+  }
+  map.on("zoom", updateInfo);
+  map.on("idle", updateInfo);
 
   // Wait for the map to load before trying to access metadata
   map.on('load', async function() {
@@ -185,6 +433,29 @@ var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE htm
       console.log('Loading PMTiles metadata...');
       const metadata = await pmtilesInstance.getMetadata();
       console.log('Metadata loaded:', metadata);
+      const header = await pmtilesInstance.getHeader();
+      document.getElementById("info-tiles").textContent = "Tiles z" + header.minZoom + "–z" + header.maxZoom;
+      const layersInfo = document.getElementById("info-layers");
+      ((metadata && metadata.vector_layers) || []).forEach(function(layer) {
+        const title = document.createElement("h3");
+        title.textContent = "Layer " + layer.id + " (z" + layer.minzoom + "–z" + layer.maxzoom + ")";
+        layersInfo.appendChild(title);
+        const fields = document.createElement("ul");
+        Object.keys(layer.fields || {}).sort().forEach(function(name) {
+          const item = document.createElement("li");
+          item.textContent = name + ": " + layer.fields[name];
+          fields.appendChild(item);
+        });
+        layersInfo.appendChild(fields);
+      });
+      {{ if .Extrude }}
+      const extrusion = metadata && metadata.hexatiles && metadata.hexatiles.extrusion;
+      if (extrusion) {
+        console.log('Extruding ' + extrusion.property + ' (' + extrusion.min + ' to ' + extrusion.max + ') up to ' + extrusion.scale + ' m');
+      } else {
+        console.warn('No extrusion metadata found; build with --extrude-by to set feature heights');
+      }
+      {{ end }}
       
       if (metadata && metadata.center && metadata.center.length >= 3) {
         console.log('Using center from metadata:', metadata.center);
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/spf13/cobra"
+
+	h3geom "github.com/hexatiles/hexatiles/internal/h3"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+func newQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Look up an H3 cell in a built PMTiles archive",
+		Long: "Finds the tile containing the cell's center at every zoom of the archive, decodes it and prints the\n" +
+			"features whose h3 attribute is the cell or one of its parents (from --pyramid or --compact), with\n" +
+			"their properties. Zooms where the tile is missing or the cell is absent are listed too, which shows\n" +
+			"where a hexagon was dropped.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pmtiles, _ := cmd.Flags().GetString("pmtiles")
+			cellFlag, _ := cmd.Flags().GetString("h3")
+			zoom, _ := cmd.Flags().GetInt("zoom")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			cell, err := h3geom.ParseCell(cellFlag)
+			if err != nil {
+				return err
+			}
+			archive, err := tiler.OpenPMTiles(pmtiles)
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			results, err := queryCell(archive, cell, zoom)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+			printQuery(cmd.OutOrStdout(), cell, results)
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("pmtiles", "", "PMTiles archive to query")
+	cmd.Flags().String("h3", "", "H3 cell to look up")
+	cmd.Flags().Int("zoom", -1, "Only query this zoom (default: every zoom of the archive)")
+	cmd.Flags().Bool("json", false, "Print the matches as JSON")
+	cmd.MarkFlagRequired("pmtiles")
+	cmd.MarkFlagRequired("h3")
+	return cmd
+}
+
+// zoomQuery is what one zoom of the archive holds for the queried cell.
+type zoomQuery struct {
+	Zoom int    `json:"zoom"`
+	Tile string `json:"tile"`
+	// Missing is set when the archive has no tile there.
+	Missing  bool         `json:"missing,omitempty"`
+	Features int          `json:"features"`
+	Matches  []queryMatch `json:"matches"`
+}
+
+type queryMatch struct {
+	Layer string `json:"layer"`
+	// Cell is the h3 attribute of the feature: the queried cell or a parent standing in for it.
+	Cell       string         `json:"cell"`
+	Parent     bool           `json:"parent,omitempty"`
+	Properties map[string]any `json:"properties"`
+}
+
+// queryCell looks the cell up in the tile containing its center at zoom, or at every zoom of
+// the archive when zoom is negative.
+func queryCell(archive *tiler.PMTilesArchive, cell h3.Cell, zoom int) ([]zoomQuery, error) {
+	h := archive.Header()
+	minZoom, maxZoom := h.MinZoom, h.MaxZoom
+	if zoom >= 0 {
+		if zoom < h.MinZoom || zoom > h.MaxZoom {
+			return nil, fmt.Errorf("--zoom %d is outside the archive zooms z%d-z%d", zoom, h.MinZoom, h.MaxZoom)
+		}
+		minZoom, maxZoom = zoom, zoom
+	}
+	center, err := cell.LatLng()
+	if err != nil {
+		return nil, fmt.Errorf("cell center: %w", err)
+	}
+	point := orb.Point{center.Lng, center.Lat}
+
+	var results []zoomQuery
+	for z := minZoom; z <= maxZoom; z++ {
+		t := maptile.At(point, maptile.Zoom(z))
+		result := zoomQuery{Zoom: z, Tile: fmt.Sprintf("%d/%d/%d", z, t.X, t.Y), Matches: []queryMatch{}}
+		layers, err := archive.Layers(z, int(t.X), int(t.Y))
+		if err != nil {
+			return nil, err
+		}
+		result.Missing = layers == nil
+		for _, layer := range layers {
+			result.Features += len(layer.Features)
+			for _, feature := range layer.Features {
+				id, _ := feature.Properties["h3"].(string)
+				if id == "" {
+					continue
+				}
+				match, parent := matchCell(cell, id)
+				if !match {
+					continue
+				}
+				result.Matches = append(result.Matches, queryMatch{
+					Layer:      layer.Name,
+					Cell:       id,
+					Parent:     parent,
+					Properties: feature.Properties,
+				})
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// matchCell reports whether id is cell or, with parent set, one of its ancestors.
+func matchCell(cell h3.Cell, id string) (match, parent bool) {
+	other, err := h3geom.ParseCell(id)
+	if err != nil {
+		return false, false
+	}
+	if other == cell {
+		return true, false
+	}
+	if other.Resolution() >= cell.Resolution() {
+		return false, false
+	}
+	ancestor, err := cell.Parent(other.Resolution())
+	return err == nil && ancestor == other, true
+}
+
+func printQuery(w io.Writer, cell h3.Cell, results []zoomQuery) {
+	fmt.Fprintf(w, "%s (r%d)\n", cell, cell.Resolution())
+	for _, r := range results {
+		switch {
+		case r.Missing:
+			fmt.Fprintf(w, "  z%-2d %s: no tile\n", r.Zoom, r.Tile)
+			continue
+		case len(r.Matches) == 0:
+			fmt.Fprintf(w, "  z%-2d %s: not found among %d features\n", r.Zoom, r.Tile, r.Features)
+			continue
+		}
+		fmt.Fprintf(w, "  z%-2d %s:\n", r.Zoom, r.Tile)
+		for _, m := range r.Matches {
+			label := "cell"
+			if m.Parent {
+				label = "parent " + m.Cell
+			}
+			props, _ := json.Marshal(m.Properties)
+			fmt.Fprintf(w, "    %s in layer %s: %s\n", label, m.Layer, props)
+		}
+	}
+}
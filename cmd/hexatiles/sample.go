@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+func newSampleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sample",
+		Short: "Generate a sample Parquet file with H3 hexagons for testing",
+		Long: "Generate a sample Parquet file containing H3 hexagons around Boston Common with demo data (score, category).\n\n" +
+			"Property values are drawn from seeded distributions, so the same flags always produce the same file.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("out")
+			count, _ := cmd.Flags().GetInt("count")
+			resolution, _ := cmd.Flags().GetInt("resolution")
+			seed, _ := cmd.Flags().GetInt64("seed")
+			scoreDist, _ := cmd.Flags().GetString("score-dist")
+			categories, _ := cmd.Flags().GetInt("categories")
+			categoryDist, _ := cmd.Flags().GetString("category-dist")
+			nullRate, _ := cmd.Flags().GetFloat64("null-rate")
+
+			gen, err := newSampleGenerator(seed, scoreDist, categories, categoryDist, nullRate)
+			if err != nil {
+				return err
+			}
+			return generateSampleData(output, count, resolution, gen)
+		},
+	}
+
+	cmd.Flags().StringP("out", "o", "dist/sample.parquet", "Output Parquet file path")
+	cmd.Flags().IntP("count", "c", 5, "Number of rings around center point")
+	cmd.Flags().IntP("resolution", "r", 8, "H3 resolution (0-15)")
+	cmd.Flags().Int64("seed", 1, "Random seed for property values")
+	cmd.Flags().String("score-dist", "uniform:0,1", "Score distribution: uniform:MIN,MAX or normal:MEAN,STDDEV")
+	cmd.Flags().Int("categories", 2, "Number of distinct category values")
+	cmd.Flags().String("category-dist", "uniform", "Category distribution: uniform or zipf[:S] (S > 1, default 1.5)")
+	cmd.Flags().Float64("null-rate", 0, "Fraction of property values written as null (0-1)")
+
+	return cmd
+}
+
+// sampleGenerator draws the property values of sample rows. Each property is nulled
+// independently with probability nullRate.
+type sampleGenerator struct {
+	rng      *rand.Rand
+	score    func() float64
+	category func() string
+	nullRate float64
+}
+
+func newSampleGenerator(seed int64, scoreDist string, categories int, categoryDist string, nullRate float64) (*sampleGenerator, error) {
+	if nullRate < 0 || nullRate > 1 {
+		return nil, fmt.Errorf("--null-rate must be between 0 and 1")
+	}
+	if categories < 1 {
+		return nil, fmt.Errorf("--categories must be at least 1")
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	gen := &sampleGenerator{rng: rng, nullRate: nullRate}
+
+	name, params, err := parseDistribution(scoreDist)
+	if err != nil {
+		return nil, fmt.Errorf("--score-dist: %w", err)
+	}
+	switch name {
+	case "uniform":
+		lo, hi, err := twoParams(params, 0, 1)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("--score-dist: expected uniform:MIN,MAX with MIN <= MAX")
+		}
+		gen.score = func() float64 { return lo + rng.Float64()*(hi-lo) }
+	case "normal":
+		mean, stddev, err := twoParams(params, 0, 1)
+		if err != nil || stddev < 0 {
+			return nil, fmt.Errorf("--score-dist: expected normal:MEAN,STDDEV with STDDEV >= 0")
+		}
+		gen.score = func() float64 { return mean + rng.NormFloat64()*stddev }
+	default:
+		return nil, fmt.Errorf("--score-dist: unknown distribution %q (expected uniform or normal)", name)
+	}
+
+	labels := make([]string, categories)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("c%d", i)
+	}
+	name, params, err = parseDistribution(categoryDist)
+	if err != nil {
+		return nil, fmt.Errorf("--category-dist: %w", err)
+	}
+	switch name {
+	case "uniform":
+		if len(params) > 0 {
+			return nil, fmt.Errorf("--category-dist: uniform takes no parameters")
+		}
+		gen.category = func() string { return labels[rng.Intn(len(labels))] }
+	case "zipf":
+		s := 1.5
+		if len(params) > 1 {
+			return nil, fmt.Errorf("--category-dist: expected zipf[:S]")
+		}
+		if len(params) == 1 {
+			s = params[0]
+		}
+		if s <= 1 {
+			return nil, fmt.Errorf("--category-dist: zipf exponent must be greater than 1")
+		}
+		// Category c0 is the most frequent, c1 the next, and so on.
+		zipf := rand.NewZipf(rng, s, 1, uint64(len(labels)-1))
+		gen.category = func() string { return labels[zipf.Uint64()] }
+	default:
+		return nil, fmt.Errorf("--category-dist: unknown distribution %q (expected uniform or zipf)", name)
+	}
+
+	return gen, nil
+}
+
+// row returns the properties of the next sample row. Values are always drawn, even when
+// nulled, so the null rate does not shift the values of other rows.
+func (g *sampleGenerator) row() map[string]any {
+	props := map[string]any{
+		"score":    g.score(),
+		"category": g.category(),
+	}
+	for _, key := range []string{"score", "category"} {
+		if g.nullRate > 0 && g.rng.Float64() < g.nullRate {
+			props[key] = nil
+		}
+	}
+	return props
+}
+
+// parseDistribution splits "name:p1,p2" into its name and numeric parameters.
+func parseDistribution(spec string) (string, []float64, error) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	var params []float64
+	if rest != "" {
+		for _, field := range strings.Split(rest, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid parameter %q in %q", field, spec)
+			}
+			params = append(params, v)
+		}
+	}
+	return name, params, nil
+}
+
+// twoParams returns both parameters, or the defaults when none were given.
+func twoParams(params []float64, a, b float64) (float64, float64, error) {
+	switch len(params) {
+	case 0:
+		return a, b, nil
+	case 2:
+		return params[0], params[1], nil
+	default:
+		return 0, 0, fmt.Errorf("expected two parameters")
+	}
+}
+
+func generateSampleData(outputPath string, ringCount int, resolution int, gen *sampleGenerator) error {
+	// Generate H3 hexagons around Boston Common (42.355, -71.065)
+	lat, lng := 42.355, -71.065
+	centerHex, err := h3.LatLngToCell(h3.LatLng{Lat: lat, Lng: lng}, resolution)
+	if err != nil {
+		return fmt.Errorf("failed to convert lat/lng to H3 cell: %w", err)
+	}
+
+	// Get hexagons in rings around the center
+	hexes, err := h3.GridDisk(centerHex, ringCount)
+	if err != nil {
+		return fmt.Errorf("failed to generate H3 grid disk: %w", err)
+	}
+
+	writer, err := parquetreader.NewWriter(outputPath, []parquetreader.Column{
+		{Name: "score", Kind: "float"},
+		{Name: "category", Kind: "string"},
+	})
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	for _, hex := range hexes {
+		if err := writer.Write(h3.IndexToString(uint64(hex)), gen.row()); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated sample data with %d H3 hexagons at resolution %d\n", writer.Rows(), resolution)
+	fmt.Printf("Written to: %s\n", outputPath)
+
+	return nil
+}
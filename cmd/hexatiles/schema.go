@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/hexatiles/hexatiles/internal/grid"
+	inputpkg "github.com/hexatiles/hexatiles/internal/input"
 	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
 )
 
@@ -20,13 +23,20 @@ type propertyInfo struct {
 func newSchemaCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "schema",
-		Short: "Inspect the schema of a Parquet file",
+		Short: "Inspect the schema of a Parquet or H3 text file",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			input, _ := cmd.Flags().GetString("in")
 			sampleLimit, _ := cmd.Flags().GetInt("sample")
-			reader, err := parquetreader.NewReader(input, parquetreader.ReaderOptions{BatchSize: sampleLimit, Parallel: 1})
+			gridName, _ := cmd.Flags().GetString("grid")
+			inputFormat, _ := cmd.Flags().GetString("input-format")
+			withSparsity, _ := cmd.Flags().GetBool("sparsity")
+			cellGrid, err := grid.Lookup(gridName)
 			if err != nil {
-				return fmt.Errorf("open parquet reader: %w", err)
+				return err
+			}
+			reader, err := inputpkg.Open(input, inputFormat, parquetreader.ReaderOptions{BatchSize: sampleLimit, Parallel: 1, Grid: cellGrid})
+			if err != nil {
+				return err
 			}
 			defer reader.Close()
 
@@ -37,9 +47,13 @@ func newSchemaCommand() *cobra.Command {
 			invalidSamples := make([]string, 0, 5)
 			invalidRows := int64(0)
 			sampled := 0
+			var sparse *sparsity
+			if withSparsity {
+				sparse = newSparsity()
+			}
 
 			for sampled < sampleLimit {
-				row, err := reader.Next()
+				row, err := reader.NextContext(cmd.Context())
 				if err == io.EOF {
 					break
 				}
@@ -58,6 +72,9 @@ func newSchemaCommand() *cobra.Command {
 				}
 
 				resHistogram[row.Resolution]++
+				if sparse != nil {
+					sparse.add(row.Properties)
+				}
 
 				for key, value := range row.Properties {
 					info := props[key]
@@ -77,7 +94,11 @@ func newSchemaCommand() *cobra.Command {
 			}
 
 			fmt.Fprintf(cmd.OutOrStdout(), "%s\n", input)
-			fmt.Fprintf(cmd.OutOrStdout(), "  total rows: %d\n", totalRows)
+			if totalRows >= 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "  total rows: %d\n", totalRows)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "  total rows: unknown\n")
+			}
 			fmt.Fprintf(cmd.OutOrStdout(), "  sampled rows: %d (limit %d)\n", sampled, sampleLimit)
 			fmt.Fprintf(cmd.OutOrStdout(), "  invalid rows: %d\n", invalidRows)
 			if len(invalidSamples) > 0 {
@@ -126,14 +147,21 @@ func newSchemaCommand() *cobra.Command {
 				}
 			}
 
+			if sparse != nil {
+				sparse.write(cmd.OutOrStdout())
+			}
+
 			return nil
 		},
 	}
 
 	cmd.SilenceUsage = true
 
-	cmd.Flags().String("in", "", "Input Parquet file")
+	cmd.Flags().String("in", "", "Input Parquet file, Hive-partitioned directory, or s3://, gs:// or https:// URL")
 	cmd.Flags().Int("sample", 5000, "Number of rows to sample for schema detection")
+	cmd.Flags().String("grid", "h3", "Cell grid of the input column: "+strings.Join(grid.Names(), "|"))
+	cmd.Flags().String("input-format", "", "Input format: "+strings.Join(inputpkg.Formats(), "|")+" (default: from file extension)")
+	cmd.Flags().Bool("sparsity", false, "Show how often each property is populated, which are populated together, and whether to split them into separate tilesets")
 	cmd.MarkFlagRequired("in")
 	return cmd
 }
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// tileContentTypes maps PMTiles tile types to the Content-Type of /tiles responses.
+var tileContentTypes = map[string]string{
+	"mvt":  "application/vnd.mapbox-vector-tile",
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+	"avif": "image/avif",
+}
+
+func newServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve [name=]archive.pmtiles ...",
+		Short: "Serve PMTiles archives as z/x/y tiles and TileJSON",
+		Long: "Serves one or more archives until interrupted or terminated. Each archive is named by its file name\n" +
+			"without extension, or by the name before '=', and exposes:\n" +
+			"  /{name}/{z}/{x}/{y}   tiles; an extension such as .mvt or .pbf is ignored\n" +
+			"  /{name}.json          TileJSON 3.0.0\n" +
+			"  /{name}/metadata      the archive metadata\n" +
+			"  /{name}.pmtiles       the archive itself, with HTTP range requests, for PMTiles clients\n" +
+			"  /                     the tilesets served; /healthz answers ok\n" +
+			"Archives may be local files or s3://, gs:// and https:// URLs, read with range requests as\n" +
+			"tiles are asked for. Tiles carry an ETag and --cache-control; CORS allows the --cors origins.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			addr, _ := cmd.Flags().GetString("addr")
+			cors, _ := cmd.Flags().GetString("cors")
+			cacheControl, _ := cmd.Flags().GetString("cache-control")
+			baseURL, _ := cmd.Flags().GetString("base-url")
+			accessLog, _ := cmd.Flags().GetBool("access-log")
+
+			ts := &tileServer{
+				tilesets:     make(map[string]*tileset),
+				cacheControl: cacheControl,
+				baseURL:      strings.TrimSuffix(baseURL, "/"),
+			}
+			defer ts.Close()
+			for _, arg := range args {
+				// A '=' inside a path or URL, such as a signed query string, does not name the tileset.
+				name, path, ok := strings.Cut(arg, "=")
+				if !ok || strings.ContainsAny(name, "/:") {
+					name, path = strings.TrimSuffix(objstore.Base(arg), ".pmtiles"), arg
+				}
+				if err := ts.add(cmd.Context(), name, path); err != nil {
+					return err
+				}
+			}
+
+			handler := withCORS(ts.handler(), splitList(cors))
+			if accessLog {
+				handler = withAccessLog(handler, cmd.ErrOrStderr())
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			out := cmd.OutOrStdout()
+			return runServer(ctx, handler, addr, func(url string) {
+				fmt.Fprintf(out, "Serving %d tileset(s) at %s\n", len(ts.names), url)
+				for _, name := range ts.names {
+					fmt.Fprintf(out, "  %s: %s/%s/{z}/{x}/{y} (tilejson: %s/%s.json)\n", name, url, name, url, name)
+				}
+			})
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("addr", ":8080", "Address to listen on, host:port")
+	cmd.Flags().String("cors", "*", "Comma-separated origins allowed by CORS (* for any, empty to send no CORS headers)")
+	cmd.Flags().String("cache-control", "public, max-age=3600", "Cache-Control of tiles and TileJSON (empty to omit)")
+	cmd.Flags().String("base-url", "", "Public URL of the server for TileJSON tile URLs, e.g. behind a proxy (default: from the request)")
+	cmd.Flags().Bool("access-log", false, "Log each request to stderr")
+	return cmd
+}
+
+// tileServer serves a set of named archives.
+type tileServer struct {
+	tilesets     map[string]*tileset
+	names        []string
+	cacheControl string
+	baseURL      string
+}
+
+// tileset is an archive of tileServer. modTime is zero for remote archives.
+type tileset struct {
+	archive  *tiler.PMTilesArchive
+	metadata map[string]any
+	modTime  time.Time
+}
+
+func (ts *tileServer) add(ctx context.Context, name, path string) error {
+	if name == "" || strings.ContainsAny(name, "/.") {
+		return fmt.Errorf("%s: invalid tileset name %q (use name=path)", path, name)
+	}
+	if _, ok := ts.tilesets[name]; ok {
+		return fmt.Errorf("%s: tileset name %q is already used (use name=path)", path, name)
+	}
+	archive, err := tiler.OpenPMTilesObject(ctx, path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	metadata, err := archive.Metadata()
+	if err != nil {
+		archive.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	t := &tileset{archive: archive, metadata: metadata}
+	if info, err := os.Stat(path); err == nil {
+		t.modTime = info.ModTime()
+	}
+	ts.tilesets[name] = t
+	ts.names = append(ts.names, name)
+	slices.Sort(ts.names)
+	return nil
+}
+
+func (ts *tileServer) Close() {
+	for _, t := range ts.tilesets {
+		t.archive.Close()
+	}
+}
+
+func (ts *tileServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		base := ts.base(r)
+		tilesets := make([]map[string]any, 0, len(ts.names))
+		for _, name := range ts.names {
+			tilesets = append(tilesets, map[string]any{
+				"name":     name,
+				"tilejson": base + "/" + name + ".json",
+				"tiles":    base + "/" + name + "/{z}/{x}/{y}",
+				"pmtiles":  base + "/" + name + ".pmtiles",
+			})
+		}
+		writeJSON(w, map[string]any{"tilesets": tilesets})
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("GET /{file}", func(w http.ResponseWriter, r *http.Request) {
+		file := r.PathValue("file")
+		if name, ok := strings.CutSuffix(file, ".json"); ok && ts.tilesets[name] != nil {
+			t := ts.tilesets[name]
+			ts.setCacheControl(w)
+			writeJSON(w, tileJSON(t.archive.Header(), t.metadata, ts.base(r)+"/"+name))
+			return
+		}
+		if name, ok := strings.CutSuffix(file, ".pmtiles"); ok && ts.tilesets[name] != nil {
+			t := ts.tilesets[name]
+			w.Header().Set("Content-Type", "application/vnd.pmtiles")
+			ts.setCacheControl(w)
+			http.ServeContent(w, r, file, t.modTime, t.archive.Contents())
+			return
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /{name}/metadata", func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := ts.tilesets[r.PathValue("name")]; ok {
+			writeJSON(w, t.metadata)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /{name}/{z}/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := ts.tilesets[r.PathValue("name")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		ts.setCacheControl(w)
+		serveTile(w, r, t.archive)
+	})
+	return mux
+}
+
+// base is the URL clients reach the server at: --base-url, or the scheme and host of r.
+func (ts *tileServer) base(r *http.Request) string {
+	if ts.baseURL != "" {
+		return ts.baseURL
+	}
+	return requestBase(r)
+}
+
+// requestBase is the scheme and host r reached the server at, https behind TLS or a proxy
+// that says so in X-Forwarded-Proto.
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (ts *tileServer) setCacheControl(w http.ResponseWriter) {
+	if ts.cacheControl != "" {
+		w.Header().Set("Cache-Control", ts.cacheControl)
+	}
+}
+
+// serveArchive exposes a PMTiles archive read-only over HTTP, so tools such as QGIS can open it
+// as an XYZ vector tile layer without a tile server: /metadata returns the archive metadata,
+// /tilejson a TileJSON 3.0.0 document and /tiles/{z}/{x}/{y} the decoded tiles.
+func serveArchive(parentCtx context.Context, path string, port int, out io.Writer) error {
+	archive, err := tiler.OpenPMTiles(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	metadata, err := archive.Metadata()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(parentCtx, os.Interrupt)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metadata", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, metadata)
+	})
+	mux.HandleFunc("GET /tilejson", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, tileJSON(archive.Header(), metadata, requestBase(r)+"/tiles"))
+	})
+	mux.HandleFunc("GET /tiles/{z}/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+		serveTile(w, r, archive)
+	})
+
+	return runServer(ctx, withCORS(mux, []string{"*"}), fmt.Sprintf("127.0.0.1:%d", port), func(url string) {
+		fmt.Fprintf(out, "Serving %s at %s\n", path, url)
+		fmt.Fprintf(out, "  tiles: %s/tiles/{z}/{x}/{y}\n", url)
+		fmt.Fprintf(out, "  tilejson: %s/tilejson\n", url)
+	})
+}
+
+// tileJSON describes the archive for clients that read TileJSON, with the tiles under tilesURL.
+func tileJSON(h tiler.PMTilesHeader, metadata map[string]any, tilesURL string) map[string]any {
+	doc := map[string]any{
+		"tilejson": "3.0.0",
+		"scheme":   "xyz",
+		"tiles":    []string{tilesURL + "/{z}/{x}/{y}"},
+		"minzoom":  h.MinZoom,
+		"maxzoom":  h.MaxZoom,
+		"bounds":   h.Bounds[:],
+		"center":   h.Center[:],
+	}
+	for _, key := range []string{"name", "description", "attribution", "version", "vector_layers"} {
+		if value, ok := metadata[key]; ok {
+			doc[key] = value
+		}
+	}
+	return doc
+}
+
+// serveTile writes one tile. Gzip-compressed tiles are sent as stored to clients that accept
+// gzip and decompressed for the rest; tiles the archive does not hold get 204 No Content. The
+// ETag hashes the bytes sent, so a client revalidating an unchanged tile gets 304 Not Modified.
+func serveTile(w http.ResponseWriter, r *http.Request, archive *tiler.PMTilesArchive) {
+	z, errZ := strconv.Atoi(r.PathValue("z"))
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	// Clients often add an extension such as .mvt or .pbf.
+	yPart, _, _ := strings.Cut(r.PathValue("y"), ".")
+	y, errY := strconv.Atoi(yPart)
+	if errZ != nil || errX != nil || errY != nil {
+		http.Error(w, "tile coordinates must be integers", http.StatusBadRequest)
+		return
+	}
+
+	tile, err := archive.Tile(z, x, y)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tile == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h := archive.Header()
+	if contentType, ok := tileContentTypes[h.TileType]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if h.TileGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+		} else if tile, err = gunzip(tile); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	sum := fnv.New64a()
+	sum.Write(tile)
+	etag := fmt.Sprintf("%q", strconv.FormatUint(sum.Sum64(), 16))
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == "*" || slices.Contains(splitList(match), etag)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(tile)))
+	_, _ = w.Write(tile)
+}
+
+// withCORS lets the origins read the responses of next, all of them for "*", and answers
+// preflight requests. It adds nothing when origins is empty.
+func withCORS(next http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	allowAll := slices.Contains(origins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case allowAll:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case slices.Contains(origins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		// PMTiles clients read the archive with Range requests and need to see the full length.
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Range, Content-Length")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Range, If-None-Match, If-Match")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withAccessLog writes a line per request to out: method, path, status, bytes and duration.
+func withAccessLog(next http.Handler, out io.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		fmt.Fprintf(out, "%s %s %s %d %d %s\n", start.Format(time.RFC3339), r.Method, r.URL.RequestURI(), rec.status, rec.bytes, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// statusRecorder remembers the status and size of a response for withAccessLog.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// splitList splits a comma-separated header or flag value, dropping blanks.
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress tile: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress tile: %w", err)
+	}
+	return out, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
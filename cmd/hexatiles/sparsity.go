@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// sparsityMatrixLimit caps the properties of the co-occurrence matrix; wider tables get the
+	// fill rates and patterns only.
+	sparsityMatrixLimit = 30
+	// sparsityPatternLimit caps the population patterns listed.
+	sparsityPatternLimit = 10
+)
+
+// sparsity records which properties each sampled row populates, to show the properties that are
+// filled together and those that are mostly null. A property is populated when its value is
+// neither null nor an empty string.
+type sparsity struct {
+	rows  int
+	index map[string]int
+	names []string
+	// present holds a bitset of the rows populating each property.
+	present  [][]uint64
+	patterns map[string]int
+}
+
+func newSparsity() *sparsity {
+	return &sparsity{index: make(map[string]int), patterns: make(map[string]int)}
+}
+
+func (s *sparsity) add(properties map[string]any) {
+	row := s.rows
+	s.rows++
+	var populated []int
+	for key, value := range properties {
+		i, ok := s.index[key]
+		if !ok {
+			i = len(s.names)
+			s.index[key] = i
+			s.names = append(s.names, key)
+			s.present = append(s.present, nil)
+		}
+		if value == nil || value == "" {
+			continue
+		}
+		for len(s.present[i]) <= row/64 {
+			s.present[i] = append(s.present[i], 0)
+		}
+		s.present[i][row/64] |= 1 << (row % 64)
+		populated = append(populated, i)
+	}
+	sort.Ints(populated)
+	key := make([]string, len(populated))
+	for j, i := range populated {
+		key[j] = strconv.Itoa(i)
+	}
+	s.patterns[strings.Join(key, ",")]++
+}
+
+// count returns the rows populating property i, or both i and j when j >= 0.
+func (s *sparsity) count(i, j int) int {
+	n := 0
+	for w, word := range s.present[i] {
+		if j >= 0 {
+			if w >= len(s.present[j]) {
+				break
+			}
+			word &= s.present[j][w]
+		}
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+func (s *sparsity) percent(n int) float64 {
+	if s.rows == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(s.rows)
+}
+
+// write prints the fill rate of each property, the co-occurrence matrix, the most common
+// population patterns and, when groups of properties are never populated together, a
+// suggestion to split them into separate tilesets.
+func (s *sparsity) write(out io.Writer) {
+	fmt.Fprintf(out, "  sparsity (populated = neither null nor empty string):\n")
+	if s.rows == 0 || len(s.names) == 0 {
+		fmt.Fprintf(out, "    no properties sampled\n")
+		return
+	}
+	order := make([]int, len(s.names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return s.names[order[a]] < s.names[order[b]] })
+	width := 0
+	for _, name := range s.names {
+		width = max(width, len(name))
+	}
+
+	filled := 0
+	fmt.Fprintf(out, "    fill rate:\n")
+	for _, i := range order {
+		n := s.count(i, -1)
+		filled += n
+		fmt.Fprintf(out, "      %-*s %6.1f%%\n", width, s.names[i], s.percent(n))
+	}
+	nullShare := 100 - 100*float64(filled)/float64(s.rows*len(s.names))
+	fmt.Fprintf(out, "    null or empty values: %.1f%% of %d (rows × properties)\n", nullShare, s.rows*len(s.names))
+
+	if len(s.names) <= sparsityMatrixLimit {
+		fmt.Fprintf(out, "    co-occurrence (%% of rows populating the row's property that also populate the column's):\n")
+		fmt.Fprintf(out, "      %*s ", width+3, "")
+		for c := range order {
+			fmt.Fprintf(out, "%4d", c+1)
+		}
+		fmt.Fprintln(out)
+		for r, i := range order {
+			fmt.Fprintf(out, "      %2d %-*s ", r+1, width, s.names[i])
+			base := s.count(i, -1)
+			for _, j := range order {
+				if base == 0 {
+					fmt.Fprintf(out, "%4s", "-")
+					continue
+				}
+				fmt.Fprintf(out, "%4.0f", 100*float64(s.count(i, j))/float64(base))
+			}
+			fmt.Fprintln(out)
+		}
+	} else {
+		fmt.Fprintf(out, "    co-occurrence: omitted for %d properties (limit %d)\n", len(s.names), sparsityMatrixLimit)
+	}
+
+	type pattern struct {
+		names []string
+		rows  int
+	}
+	patterns := make([]pattern, 0, len(s.patterns))
+	for key, rows := range s.patterns {
+		p := pattern{rows: rows}
+		if key != "" {
+			for _, field := range strings.Split(key, ",") {
+				i, _ := strconv.Atoi(field)
+				p.names = append(p.names, s.names[i])
+			}
+			sort.Strings(p.names)
+		}
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(a, b int) bool {
+		if patterns[a].rows != patterns[b].rows {
+			return patterns[a].rows > patterns[b].rows
+		}
+		return strings.Join(patterns[a].names, ",") < strings.Join(patterns[b].names, ",")
+	})
+	fmt.Fprintf(out, "    patterns (%d distinct):\n", len(patterns))
+	for k, p := range patterns {
+		if k == sparsityPatternLimit {
+			fmt.Fprintf(out, "      ... %d more\n", len(patterns)-k)
+			break
+		}
+		names := strings.Join(p.names, ", ")
+		if names == "" {
+			names = "(none)"
+		}
+		fmt.Fprintf(out, "      %5.1f%%  %s\n", s.percent(p.rows), names)
+	}
+
+	if groups := s.exclusiveGroups(order); len(groups) > 1 {
+		var always []string
+		for _, i := range order {
+			if s.count(i, -1) == s.rows {
+				always = append(always, s.names[i])
+			}
+		}
+		fmt.Fprintf(out, "    suggestion: these property groups are never populated in the same row; building each\n")
+		fmt.Fprintf(out, "    with --props into its own tileset avoids shipping the others as nulls in every feature:\n")
+		for _, group := range groups {
+			fmt.Fprintf(out, "      --props %s\n", strings.Join(append(always[:len(always):len(always)], group...), ","))
+		}
+	}
+}
+
+// exclusiveGroups splits the properties populated in some but not all rows into groups that
+// never share a row: two properties belong to the same group when a row populates both, or
+// through a chain of such properties.
+func (s *sparsity) exclusiveGroups(order []int) [][]string {
+	parent := make([]int, len(s.names))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	var partial []int
+	for _, i := range order {
+		if n := s.count(i, -1); n > 0 && n < s.rows {
+			partial = append(partial, i)
+		}
+	}
+	for a, i := range partial {
+		for _, j := range partial[a+1:] {
+			if s.count(i, j) > 0 {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	var groups [][]string
+	slot := make(map[int]int)
+	for _, i := range partial {
+		root := find(i)
+		k, ok := slot[root]
+		if !ok {
+			k = len(groups)
+			slot[root] = k
+			groups = append(groups, nil)
+		}
+		groups[k] = append(groups[k], s.names[i])
+	}
+	return groups
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/telemetry"
+)
+
+func newTelemetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry on|off|status|flush",
+		Short: "Opt in to or out of anonymous usage statistics",
+		Long: "Telemetry is off unless you turn it on. When on, each command queues an event with the command\n" +
+			"name, its duration, a row count bucket (<1K, 1K-100K, ...), success, OS, architecture and version:\n" +
+			"no paths, property names or values. Events are sent to the --endpoint you configure and otherwise\n" +
+			"stay in a local queue. `off` deletes the queue; HEXATILES_TELEMETRY=off or DO_NOT_TRACK=1 disable\n" +
+			"telemetry whatever the configuration says.",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"on", "off", "status", "flush"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			cfg, err := telemetry.LoadConfig()
+			if err != nil {
+				return err
+			}
+			path, err := telemetry.ConfigPath()
+			if err != nil {
+				return err
+			}
+
+			switch args[0] {
+			case "on":
+				cfg.Enabled = true
+				if cmd.Flags().Changed("endpoint") {
+					cfg.Endpoint, _ = cmd.Flags().GetString("endpoint")
+				}
+				if err := telemetry.SaveConfig(cfg); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "✔ telemetry on (%s)\n", path)
+				if cfg.Endpoint == "" {
+					fmt.Fprintln(out, "  no endpoint: events are queued locally only")
+				}
+			case "off":
+				cfg.Enabled = false
+				if err := telemetry.SaveConfig(cfg); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "✔ telemetry off, queue deleted (%s)\n", path)
+			case "status":
+				state := "off"
+				if cfg.Enabled {
+					state = "on"
+				}
+				if env := telemetry.Disabled(); env != "" && cfg.Enabled {
+					state = "off (" + env + " is set)"
+				}
+				fmt.Fprintf(out, "telemetry: %s\n", state)
+				fmt.Fprintf(out, "  config: %s\n", path)
+				if cfg.Endpoint != "" {
+					fmt.Fprintf(out, "  endpoint: %s\n", cfg.Endpoint)
+				}
+				events, err := telemetry.Queued()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "  queued: %d events\n", len(events))
+				for _, ev := range events {
+					rows := ev.Rows
+					if rows == "" {
+						rows = "-"
+					}
+					fmt.Fprintf(out, "    %s %dms rows=%s success=%t %s/%s %s\n", ev.Command, ev.DurationMS, rows, ev.Success, ev.OS, ev.Arch, ev.Version)
+				}
+			case "flush":
+				if cfg.Endpoint == "" {
+					return fmt.Errorf("no telemetry endpoint configured; set one with `hexatiles telemetry on --endpoint URL`")
+				}
+				if err := telemetry.Flush(cmd.Context(), cfg.Endpoint); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "✔ queue sent to %s\n", cfg.Endpoint)
+			default:
+				return fmt.Errorf("unknown action %q (expected on, off, status or flush)", args[0])
+			}
+			return nil
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("endpoint", "", "With on: URL that receives queued events as NDJSON POST requests")
+	return cmd
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hexatiles/hexatiles/internal/publish"
+)
+
+// Cache-Control defaults of upload: versioned keys never change, so they are cached for good;
+// the archive under a fixed key is revalidated after a few minutes and the documents
+// describing it on every request.
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	cacheArchive   = "public, max-age=300"
+	cacheDocument  = "no-cache"
+)
+
+// uploadContentTypes maps the extensions upload publishes to their Content-Type.
+var uploadContentTypes = map[string]string{
+	".pmtiles": "application/vnd.pmtiles",
+	".mbtiles": "application/vnd.sqlite3",
+	".html":    "text/html; charset=utf-8",
+	".json":    "application/json",
+}
+
+func newUploadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upload --pmtiles dist/metrics.pmtiles --to s3://bucket/tiles/",
+		Short: "Publish a built archive to S3, R2, GCS, an HTTP server or a directory",
+		Long: "Uploads the archive, with the report.html and report.json of its build and an optional style, under\n" +
+			"the --to destination with the right Content-Type and Cache-Control. The destination is s3://, r2://,\n" +
+			"gs://, http(s):// (PUT) or a local directory; credentials come from the environment as for s3:// and\n" +
+			"gs:// inputs, and r2:// needs R2_ACCOUNT_ID. --versioned puts the files under a prefix named by the\n" +
+			"archive's content hash and marks them immutable, so a new build never replaces what clients have\n" +
+			"cached.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pmtiles, _ := cmd.Flags().GetString("pmtiles")
+			to, _ := cmd.Flags().GetString("to")
+			versioned, _ := cmd.Flags().GetBool("versioned")
+			cacheControl, _ := cmd.Flags().GetString("cache-control")
+			style, _ := cmd.Flags().GetString("style")
+			noReport, _ := cmd.Flags().GetBool("no-report")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			publisher, err := publish.Open(to)
+			if err != nil {
+				return err
+			}
+			if err := publisher.Validate(cmd.Context()); err != nil {
+				return fmt.Errorf("--to %s: %w", to, err)
+			}
+			plan, err := planUpload(pmtiles, style, !noReport, versioned, cacheControl)
+			if err != nil {
+				return err
+			}
+			for _, warning := range plan.warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+			if dryRun {
+				for _, a := range plan.artifacts {
+					fmt.Fprintf(cmd.OutOrStdout(), "would upload %s → %s (%s, %s)\n", a.Path, a.Name, a.ContentType, a.CacheControl)
+				}
+				return nil
+			}
+			return publishPlan(cmd.Context(), cmd.OutOrStdout(), []publish.Publisher{publisher}, plan)
+		},
+	}
+
+	cmd.SilenceUsage = true
+
+	cmd.Flags().String("pmtiles", "", "Archive to publish (PMTiles, or MBTiles from --skip-pmtiles)")
+	cmd.Flags().String("to", "", "Destination: s3://, r2:// or gs://bucket/path/, http(s)://host/path/ or a directory")
+	cmd.Flags().Bool("versioned", false, "Upload under <to>/<first 12 hex digits of the archive SHA-256>/ with immutable caching")
+	cmd.Flags().String("cache-control", "", "Cache-Control of the archive (default: immutable when --versioned, else max-age=300)")
+	cmd.Flags().String("style", "", "MapLibre style JSON to publish beside the archive")
+	cmd.Flags().Bool("no-report", false, "Do not publish the report.html and report.json next to the archive")
+	cmd.Flags().Bool("dry-run", false, "Print what would be uploaded without uploading")
+	cmd.MarkFlagRequired("pmtiles")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// uploadPlan lists the artifacts upload and build --publish write, in order: the archive
+// first, so the documents never point at an archive that is not there yet.
+type uploadPlan struct {
+	artifacts []publish.Artifact
+	meta      publish.Meta
+	warnings  []string
+}
+
+func planUpload(archive, style string, reports, versioned bool, cacheControl string) (uploadPlan, error) {
+	plan := uploadPlan{meta: publish.Meta{Tileset: strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))}}
+	var prefix string
+	if versioned {
+		version, err := archiveVersion(archive)
+		if err != nil {
+			return plan, err
+		}
+		plan.meta.Version = version
+		prefix = version + "/"
+	}
+
+	archiveCache, documentCache := cacheArchive, cacheDocument
+	if versioned {
+		archiveCache, documentCache = cacheImmutable, cacheImmutable
+	}
+	if cacheControl != "" {
+		archiveCache = cacheControl
+	}
+	add := func(src, cache string) error {
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("stat %s: %w", src, err)
+		}
+		contentType := uploadContentTypes[strings.ToLower(filepath.Ext(src))]
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		plan.artifacts = append(plan.artifacts, publish.Artifact{
+			Path:         src,
+			Name:         prefix + filepath.Base(src),
+			ContentType:  contentType,
+			CacheControl: cache,
+		})
+		return nil
+	}
+
+	if err := add(archive, archiveCache); err != nil {
+		return plan, err
+	}
+	if reports {
+		dir := filepath.Dir(archive)
+		if built, ok := reportOutput(filepath.Join(dir, "report.json")); ok && !sameFile(built, archive) {
+			plan.warnings = append(plan.warnings, fmt.Sprintf("the reports in %s describe %s, not %s; not uploaded", dir, built, archive))
+		} else {
+			for _, name := range []string{"report.html", "report.json"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					if err := add(filepath.Join(dir, name), documentCache); err != nil {
+						return plan, err
+					}
+				}
+			}
+		}
+	}
+	if style != "" {
+		if err := add(style, documentCache); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// publishPlan publishes the artifacts of plan to each destination in turn.
+func publishPlan(ctx context.Context, out io.Writer, publishers []publish.Publisher, plan uploadPlan) error {
+	for _, publisher := range publishers {
+		for _, a := range plan.artifacts {
+			dest, err := publisher.Publish(ctx, a, plan.meta)
+			if err != nil {
+				return err
+			}
+			var size int64
+			if info, err := os.Stat(a.Path); err == nil {
+				size = info.Size()
+			}
+			fmt.Fprintf(out, "✔ uploaded %s → %s (%s)\n", a.Path, dest, formatBytes(size))
+		}
+	}
+	if plan.meta.Version != "" {
+		fmt.Fprintf(out, "  version: %s\n", plan.meta.Version)
+	}
+	return nil
+}
+
+// archiveVersion names a versioned upload by the first 12 hex digits of the archive's SHA-256,
+// so uploading the same build twice lands on the same keys.
+func archiveVersion(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// reportOutput returns the archive a report.json was written for.
+func reportOutput(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var rep struct {
+		Config struct {
+			OutputPMTiles string
+		} `json:"config"`
+	}
+	if json.Unmarshal(data, &rep) != nil || rep.Config.OutputPMTiles == "" {
+		return "", false
+	}
+	return rep.Config.OutputPMTiles, true
+}
+
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
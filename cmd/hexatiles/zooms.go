@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	h3geom "github.com/hexatiles/hexatiles/internal/h3"
+)
+
+func newZoomsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "zooms",
+		Short: "Show which tile zooms suit each H3 resolution",
+		Long: "Lists, per H3 resolution, the zoom at which cells first span a pixel, the zoom at which they are\n" +
+			"comfortably visible, and the last zoom worth generating. build warns when --maxzoom falls outside\n" +
+			"min..max for the finest resolution in the data (--strict makes it an error).",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintln(w, "res\tavg edge\tmin zoom\tideal zoom\tmax zoom\t")
+			for _, s := range h3geom.ZoomTable() {
+				fmt.Fprintf(w, "%d\t%s\tz%d\tz%d\tz%d\t\n", s.Resolution, formatMeters(s.EdgeMeters), s.MinZoom, s.IdealZoom, s.MaxZoom)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func formatMeters(m float64) string {
+	if m >= 1000 {
+		return fmt.Sprintf("%.1f km", m/1000)
+	}
+	return fmt.Sprintf("%.1f m", m)
+}
@@ -0,0 +1,163 @@
+package build
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// defaultAdaptiveResolution is the region size of --adaptive-maxzoom when none is given: H3
+// resolution 3 cells cover about 12,000 km², the scale of a metropolitan area.
+const defaultAdaptiveResolution = 3
+
+// AdaptiveZoom varies the maximum zoom across the map by data density, so a continental
+// dataset is tiled deep in its cities without tiling its sparse countryside just as deep. The
+// input is split into regions, the parents of its cells at Resolution. The densest region
+// keeps the tileset's max zoom; every fourfold drop in cells below it ends the region's tiles
+// one zoom earlier, down to Floor, which keeps the features per tile about even. The zoom is
+// written on each feature as tippecanoe's per-feature maxzoom, which the native tiler honours
+// too, so one pass tiles every region.
+type AdaptiveZoom struct {
+	Floor      int
+	Resolution int
+	grid       grid.CellGeometry
+	counts     map[grid.Cell]int64
+	// maxResolution is the finest resolution among the observed cells, from which the max
+	// zoom is derived when --maxzoom is not given.
+	maxResolution int
+	// ceiling is the max zoom of the densest region, set by finish.
+	ceiling int
+	zooms   map[grid.Cell]int
+	ranges  map[int]*ndjson.ZoomRange
+	base    *ndjson.ZoomRange
+}
+
+// parseAdaptiveZoom reads "FLOOR" or "FLOOR:RESOLUTION", such as "10" or "10:4".
+func parseAdaptiveZoom(spec string, g grid.CellGeometry) (*AdaptiveZoom, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	floorPart, resPart, hasRes := strings.Cut(spec, ":")
+	floor, err := strconv.Atoi(strings.TrimSpace(floorPart))
+	if err != nil || floor < 0 {
+		return nil, fmt.Errorf("invalid --adaptive-maxzoom %q: %q is not a zoom", spec, floorPart)
+	}
+	a := &AdaptiveZoom{Floor: floor, Resolution: defaultAdaptiveResolution, grid: g, counts: make(map[grid.Cell]int64)}
+	if hasRes {
+		res, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(resPart), "r"))
+		if err != nil || res < 0 {
+			return nil, fmt.Errorf("invalid --adaptive-maxzoom %q: %q is not a resolution", spec, resPart)
+		}
+		a.Resolution = res
+	} else if g.Name() != "h3" {
+		return nil, fmt.Errorf("invalid --adaptive-maxzoom %q: give the %s region resolution, such as %d:4", spec, g.Name(), floor)
+	}
+	return a, nil
+}
+
+// String returns the resolved spec, such as "10:3".
+func (a *AdaptiveZoom) String() string {
+	if a == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", a.Floor, a.Resolution)
+}
+
+// observe counts a cell the build will write in its region, after the resolution filter,
+// --where and --top-per-parent.
+func (a *AdaptiveZoom) observe(cell grid.Cell) {
+	a.counts[a.grid.Parent(cell, a.Resolution)]++
+	a.maxResolution = max(a.maxResolution, a.grid.Resolution(cell))
+}
+
+// reset forgets the cells counted so far, for a prescan that starts over.
+func (a *AdaptiveZoom) reset() {
+	if a != nil {
+		a.counts = make(map[grid.Cell]int64)
+		a.maxResolution = 0
+	}
+}
+
+// finish fixes the max zoom of every region once all cells are counted. The densest region
+// reaches the max zoom the build derives, or --maxzoom. base is the zoom range of the input
+// cells without --adaptive-maxzoom, from --pyramid; no region ends before it starts.
+func (a *AdaptiveZoom) finish(opts Options, base *ndjson.ZoomRange) {
+	cells := &report.Source{Metrics: report.SourceMetrics{MaxResolutionSeen: a.maxResolution}}
+	_, a.ceiling = deriveZooms(opts, cells, a.grid)
+	a.base = base
+
+	var densest int64
+	for _, n := range a.counts {
+		densest = max(densest, n)
+	}
+	a.zooms = make(map[grid.Cell]int, len(a.counts))
+	a.ranges = make(map[int]*ndjson.ZoomRange)
+	for region, n := range a.counts {
+		// Each zoom quarters the area of a tile, so a region with a quarter of the cells
+		// reaches the same features per tile one zoom later.
+		drop := int(math.Floor(math.Log(float64(densest)/float64(n)) / math.Log(4)))
+		z := min(a.ceiling, max(a.Floor, a.ceiling-drop))
+		if base != nil {
+			z = max(z, base.Min)
+		}
+		a.zooms[region] = z
+		if _, ok := a.ranges[z]; !ok && z < a.ceiling {
+			r := &ndjson.ZoomRange{Max: z}
+			if base != nil {
+				r.Min = base.Min
+			}
+			a.ranges[z] = r
+		}
+	}
+}
+
+// zoomRange returns the zoom range written on the feature of an input cell: nil or the
+// pyramid's range where the region reaches the max zoom, and a range ending at the region's
+// max zoom elsewhere.
+func (a *AdaptiveZoom) zoomRange(cell grid.Cell) *ndjson.ZoomRange {
+	if r, ok := a.ranges[a.zooms[a.grid.Parent(cell, a.Resolution)]]; ok {
+		return r
+	}
+	return a.base
+}
+
+// Zooms summarises how many regions and cells end at each max zoom, deepest first.
+func (a *AdaptiveZoom) Zooms() []report.AdaptiveZoom {
+	byZoom := make(map[int]*report.AdaptiveZoom)
+	for region, z := range a.zooms {
+		entry := byZoom[z]
+		if entry == nil {
+			entry = &report.AdaptiveZoom{MaxZoom: z}
+			byZoom[z] = entry
+		}
+		entry.Regions++
+		entry.Cells += a.counts[region]
+	}
+	zooms := make([]report.AdaptiveZoom, 0, len(byZoom))
+	for _, entry := range byZoom {
+		zooms = append(zooms, *entry)
+	}
+	sort.Slice(zooms, func(i, j int) bool { return zooms[i].MaxZoom > zooms[j].MaxZoom })
+	return zooms
+}
+
+// Metadata returns the description recorded in the PMTiles metadata.
+func (a *AdaptiveZoom) Metadata() map[string]any {
+	regions := make(map[string]int)
+	for _, entry := range a.Zooms() {
+		regions[strconv.Itoa(entry.MaxZoom)] = entry.Regions
+	}
+	return map[string]any{
+		"floor":      a.Floor,
+		"resolution": a.Resolution,
+		"maxzoom":    a.ceiling,
+		"regions":    regions,
+	}
+}
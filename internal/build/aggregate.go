@@ -0,0 +1,334 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// Aggregation merges the rows that share a cell into one feature. Each spec names a property
+// and how its values combine; properties without a spec keep the value of the cell's first row.
+type Aggregation struct {
+	specs []aggregateSpec
+	// kinds holds the input kind of every aggregated property, set by check.
+	kinds map[string]string
+}
+
+type aggregateSpec struct {
+	Property string
+	Func     string
+}
+
+// parseAggregation reads "score=mean,count=sum,category=mode".
+func parseAggregation(spec string) (*Aggregation, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	a := &Aggregation{}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		property, fn, ok := strings.Cut(part, "=")
+		property, fn = strings.TrimSpace(property), strings.ToLower(strings.TrimSpace(fn))
+		if !ok || property == "" || fn == "" {
+			return nil, fmt.Errorf("invalid --aggregate %q (expected prop=fn,...)", spec)
+		}
+		switch fn {
+		case "sum", "mean", "min", "max", "count", "mode", "first":
+		default:
+			return nil, fmt.Errorf("invalid --aggregate %s=%s: unknown function (expected sum, mean, min, max, count, mode or first)", property, fn)
+		}
+		if seen[property] {
+			return nil, fmt.Errorf("invalid --aggregate %q: %s is aggregated twice", spec, property)
+		}
+		seen[property] = true
+		a.specs = append(a.specs, aggregateSpec{Property: property, Func: fn})
+	}
+	return a, nil
+}
+
+// String returns the normalized spec for the report.
+func (a *Aggregation) String() string {
+	if a == nil {
+		return ""
+	}
+	parts := make([]string, len(a.specs))
+	for i, s := range a.specs {
+		parts[i] = s.Property + "=" + s.Func
+	}
+	return strings.Join(parts, ",")
+}
+
+// Properties lists the aggregated properties, which must be read even when no filter keeps them.
+func (a *Aggregation) Properties() []string {
+	if a == nil {
+		return nil
+	}
+	out := make([]string, len(a.specs))
+	for i, s := range a.specs {
+		out[i] = s.Property
+	}
+	return out
+}
+
+// check validates the specs against the input schema: sum, mean, min and max need numbers.
+func (a *Aggregation) check(types map[string]string) error {
+	if a == nil {
+		return nil
+	}
+	a.kinds = make(map[string]string, len(a.specs))
+	for _, s := range a.specs {
+		switch s.Func {
+		case "sum", "mean", "min", "max":
+			if err := requireNumeric(types, s.Property, "aggregate"); err != nil {
+				return err
+			}
+		default:
+			if _, ok := types[s.Property]; !ok {
+				return fmt.Errorf("aggregate property %q not found in input", s.Property)
+			}
+		}
+		a.kinds[s.Property] = types[s.Property]
+	}
+	return nil
+}
+
+// Types returns types with the kinds of the aggregated values: means are floats and counts
+// are integers; the other functions keep the input kind.
+func (a *Aggregation) Types(types map[string]string) map[string]string {
+	if a == nil {
+		return types
+	}
+	out := make(map[string]string, len(types))
+	for key, kind := range types {
+		out[key] = kind
+	}
+	for _, s := range a.specs {
+		switch s.Func {
+		case "mean":
+			out[s.Property] = "float"
+		case "count":
+			out[s.Property] = "int"
+		}
+	}
+	return out
+}
+
+// cellGroups collects rows by cell. Groups keep the order of their first row, so the merged
+// features come out in the same order as an unaggregated build would write them.
+type cellGroups struct {
+	agg    *Aggregation
+	index  map[grid.Cell]int
+	groups []*cellGroup
+}
+
+type cellGroup struct {
+	row    *parquetreader.Row
+	states []aggregateState
+}
+
+type aggregateState struct {
+	n        int64
+	first    any
+	sum      float64
+	intSum   int64
+	min, max any
+	minValue float64
+	maxValue float64
+	// modes counts the distinct values; order lists them as first seen to break ties.
+	modes map[any]int64
+	order []any
+}
+
+func newCellGroups(agg *Aggregation) *cellGroups {
+	return &cellGroups{agg: agg, index: make(map[grid.Cell]int)}
+}
+
+// add merges row into the group of its cell and reports whether it started the group.
+func (g *cellGroups) add(row *parquetreader.Row) bool {
+	i, ok := g.index[row.Cell]
+	if !ok {
+		i = len(g.groups)
+		g.index[row.Cell] = i
+		g.groups = append(g.groups, &cellGroup{row: row, states: make([]aggregateState, len(g.agg.specs))})
+	}
+	group := g.groups[i]
+	for j, s := range g.agg.specs {
+		group.states[j].observe(s.Func, row.Properties[s.Property])
+	}
+	return !ok
+}
+
+// rows returns one row per cell carrying the aggregated properties.
+func (g *cellGroups) rows() []*parquetreader.Row {
+	out := make([]*parquetreader.Row, len(g.groups))
+	for i, group := range g.groups {
+		merged := *group.row
+		merged.Properties = make(map[string]any, len(group.row.Properties))
+		for key, value := range group.row.Properties {
+			merged.Properties[key] = value
+		}
+		for j, s := range g.agg.specs {
+			merged.Properties[s.Property] = group.states[j].value(s.Func, g.agg.kinds[s.Property])
+		}
+		out[i] = &merged
+	}
+	return out
+}
+
+func (s *aggregateState) observe(fn string, value any) {
+	if value == nil {
+		return
+	}
+	switch fn {
+	case "count":
+		s.n++
+	case "first":
+		if s.n == 0 {
+			s.first = value
+		}
+		s.n++
+	case "mode":
+		if s.modes == nil {
+			s.modes = make(map[any]int64)
+		}
+		if _, seen := s.modes[value]; !seen {
+			s.order = append(s.order, value)
+		}
+		s.modes[value]++
+		s.n++
+	default:
+		number, ok := props.Number(value)
+		if !ok {
+			return
+		}
+		if s.n == 0 || number < s.minValue {
+			s.min, s.minValue = value, number
+		}
+		if s.n == 0 || number > s.maxValue {
+			s.max, s.maxValue = value, number
+		}
+		s.n++
+		s.sum += number
+		if i, ok := integer(value); ok {
+			s.intSum += i
+		}
+	}
+}
+
+// value is the aggregate of the observed values, or nil when every value was null.
+func (s *aggregateState) value(fn, kind string) any {
+	if fn == "count" {
+		return s.n
+	}
+	if s.n == 0 {
+		return nil
+	}
+	switch fn {
+	case "sum":
+		if kind == "int" {
+			return s.intSum
+		}
+		return s.sum
+	case "mean":
+		return s.sum / float64(s.n)
+	case "min":
+		return s.min
+	case "max":
+		return s.max
+	case "mode":
+		best := s.order[0]
+		for _, v := range s.order[1:] {
+			if s.modes[v] > s.modes[best] {
+				best = v
+			}
+		}
+		return best
+	default:
+		return s.first
+	}
+}
+
+// groupRows is the grouping stage of --aggregate. It applies --where to the input rows and
+// merges the rows that pass by cell; once the stream ends, the merged rows go to the workers.
+// Rows merged into an earlier row of their cell are reported as such right away, and every
+// row that passes also feeds the --pyramid parents. Rows the workers drop anyway, with a bad
+// cell or outside the resolution filter, pass straight through.
+func groupRows(ctx context.Context, jobs <-chan *parquetreader.Row, results chan<- featureResult, cfg processConfig) <-chan *parquetreader.Row {
+	out := make(chan *parquetreader.Row, cfg.Threads*2)
+	go func() {
+		defer close(out)
+		forward := func(row *parquetreader.Row) bool {
+			select {
+			case out <- row:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		report := func(row *parquetreader.Row, reason string) bool {
+			select {
+			case results <- featureResult{RowNumber: row.RowNumber, CellString: row.CellString, Resolution: row.Resolution, Dropped: true, DropReason: reason}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		groups := newCellGroups(cfg.Aggregate)
+		for {
+			var row *parquetreader.Row
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return
+			case row, ok = <-jobs:
+			}
+			if !ok {
+				cfg.Probe.inputDone()
+				break
+			}
+			sent := true
+			switch {
+			case row.Err != nil || !resolutionAllowed(cfg.Options, row.Resolution):
+				sent = forward(row)
+			case !cfg.Where.Match(row.Properties):
+				sent = report(row, "where")
+			default:
+				if cfg.Pyramid != nil {
+					cfg.Pyramid.observe(row)
+				}
+				if !groups.add(row) {
+					sent = report(row, "aggregated")
+				}
+			}
+			if !sent {
+				return
+			}
+		}
+		for _, row := range groups.rows() {
+			if !forward(row) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func integer(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
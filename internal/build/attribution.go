@@ -0,0 +1,75 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// inheritedKeys lists, for each tileset metadata field, the input metadata keys it is read from
+// in order of preference. A license is the usual attribution when a writer records nothing else.
+var inheritedKeys = []struct {
+	field string
+	keys  []string
+}{
+	{"name", []string{"name", "title"}},
+	{"description", []string{"description", "summary"}},
+	{"attribution", []string{"attribution", "license"}},
+}
+
+// inheritMetadata fills the name, description and attribution left empty by the flags from the
+// key-value metadata of the input. Keys match case-insensitively at the top level or inside the
+// JSON object of a "geo" entry, as GeoParquet writers record extra fields there. Values that
+// fail tiler.CheckMetadataValue are skipped with a warning. It returns the merged metadata and
+// records the fields taken from the input in the report.
+func inheritMetadata(flags map[string]string, kv map[string]string, rep *report.Report) map[string]string {
+	if len(kv) == 0 {
+		return flags
+	}
+	lookup := make(map[string]string)
+	if raw, ok := kv["geo"]; ok {
+		var geo map[string]any
+		if json.Unmarshal([]byte(raw), &geo) == nil {
+			for key, value := range geo {
+				if s, ok := value.(string); ok {
+					lookup[strings.ToLower(key)] = s
+				}
+			}
+		}
+	}
+	// Top-level keys win over the "geo" entry.
+	for key, value := range kv {
+		lookup[strings.ToLower(key)] = value
+	}
+
+	merged := make(map[string]string, len(flags)+len(inheritedKeys))
+	for key, value := range flags {
+		merged[key] = value
+	}
+	var inherited []string
+	for _, entry := range inheritedKeys {
+		if strings.TrimSpace(merged[entry.field]) != "" {
+			continue
+		}
+		for _, key := range entry.keys {
+			value := strings.TrimSpace(lookup[key])
+			if value == "" {
+				continue
+			}
+			if err := tiler.CheckMetadataValue(entry.field, value); err != nil {
+				rep.AddWarning(fmt.Sprintf("input metadata %q not used as the tileset %s: %v", key, entry.field, err))
+				continue
+			}
+			merged[entry.field] = value
+			inherited = append(inherited, entry.field)
+			break
+		}
+	}
+	sort.Strings(inherited)
+	rep.Config.InheritedMetadata = inherited
+	return merged
+}
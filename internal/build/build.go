@@ -2,30 +2,50 @@ package build
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/hexatiles/hexatiles/internal/classify"
+	"github.com/hexatiles/hexatiles/internal/expect"
+	"github.com/hexatiles/hexatiles/internal/grid"
 	h3geom "github.com/hexatiles/hexatiles/internal/h3"
+	"github.com/hexatiles/hexatiles/internal/input"
 	"github.com/hexatiles/hexatiles/internal/ndjson"
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	"github.com/hexatiles/hexatiles/internal/od"
 	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/progress"
 	"github.com/hexatiles/hexatiles/internal/props"
 	"github.com/hexatiles/hexatiles/internal/report"
 	"github.com/hexatiles/hexatiles/internal/tiler"
+	"github.com/hexatiles/hexatiles/internal/trace"
 )
 
 // Options describe a build invocation.
 type Options struct {
-	InputPath       string
-	OutputPMTiles   string
+	InputPath     string
+	InputFormat   string
+	OutputPMTiles string
+	// SkipPMTiles keeps tippecanoe's MBTiles, next to OutputPMTiles, as the primary output.
+	SkipPMTiles bool
+	// DirectPMTiles has tippecanoe 2.17+ write OutputPMTiles itself, with no MBTiles copy.
+	DirectPMTiles bool
+	// OutputFormat is FormatPMTiles, the default, or FormatMBTiles, which is SkipPMTiles.
+	OutputFormat string
+	// Stdout receives the tileset when OutputPMTiles is Stdout; nil means os.Stdout.
+	Stdout          io.Writer
 	KeepNDJSON      bool
+	KeepMBTiles     bool
 	MinZoom         int
 	MaxZoom         int
 	MinResolution   int
@@ -35,15 +55,172 @@ type Options struct {
 	QuantizeSpec    string
 	Simplify        bool
 	Threads         int
+	DecodeThreads   int
+	EncodeThreads   int
 	PropertyByteCap int
 	TippecanoePath  string
 	PMTilesPath     string
 	Metadata        map[string]string
+	Profile         string
+	// Explicit holds the names of the flags given on the command line, which Profile never overrides.
+	Explicit  map[string]bool
+	NonFinite string
+	// ReservedKeys is the props.ReservedKeyPolicy for properties named like the cell or resolution.
+	ReservedKeys   string
+	StringMaxBytes int
+	Grid           string
+	ArcsInput      string
+	// SourceRetries is how many more times a failed read of the input or ArcsInput is attempted.
+	SourceRetries int
+	// KeepGoing tiles without an ArcsInput that fails every attempt; Run then returns a *PartialError.
+	KeepGoing    bool
+	ExtrudeBy    string
+	ExtrudeScale float64
+	Classify     string
+	// KeepUnusable keeps entirely null, constant and binary columns not named in PropertyInclude.
+	KeepUnusable bool
+	// ZoomCap is the deepest zoom the build generates; zero means DefaultZoomCap.
+	ZoomCap int
+	// Strict turns the zoom range and zoom coverage warnings into errors.
+	Strict bool
+	// CoverageThreshold is the share of input tiles each zoom must hold; 0 is the default, <0 none.
+	CoverageThreshold float64
+	// Lenient turns a row count that disagrees with the input footer from an error into a warning.
+	Lenient bool
+	// EmptyTiles is tiler.EmptyTilesElide (the default) or tiler.EmptyTilesWrite.
+	EmptyTiles string
+	// Tiler is tiler.TilerTippecanoe (the default) or tiler.TilerNative, which encodes in-process.
+	Tiler string
+	// ExpectFile is a YAML list of assertions such as "emitted_features >= 1000" that fail the build.
+	ExpectFile string
+	// EmitCommands writes the tippecanoe and pmtiles commands to this script; it implies KeepNDJSON.
+	EmitCommands string
+	// ValueMaps are "prop=table.csv" or "prop:code=table.csv" specs mapping codes to labels or back.
+	ValueMaps []string
+	// Types declares property types, e.g. "score:float,flag:bool"; unconvertible values become null.
+	Types string
+	// FlattenNested keys the leaves of nested Parquet fields by their dotted path, e.g. address.city.
+	FlattenNested bool
+	// Where is a row predicate such as "score > 0 && category != 'test'"; see props.Where.
+	Where string
+	// TopPerParent is "res=5,n=1000,by=score": keep the N highest-ranked cells under each parent.
+	TopPerParent string
+	// FeatureLimit caps the features per tile below the maximum zoom; zero means no limit.
+	FeatureLimit int
+	// Conserve lists numeric properties whose totals dropped cells hand to nearby kept cells.
+	Conserve []string
+	// ExtraTippecanoeArgs are appended to the tippecanoe command in --flag=value form.
+	ExtraTippecanoeArgs []string
+	// NDJSONFormat is ndjson.FormatNDJSON, the default, or ndjson.FormatGeoJSONSeq.
+	NDJSONFormat string
+	// NDJSONBBox writes each feature's bounding box into the NDJSON, which tippecanoe ignores.
+	NDJSONBBox bool
+	// Winding is the ndjson.Winding of the NDJSON polygons: ccw (RFC 7946, the default) or cw.
+	Winding string
+	// Aggregate is "score=mean,count=sum": rows sharing a cell are merged; see Aggregation.
+	Aggregate string
+	// Pyramid is "5,7" or "5:0-6,7:7-9": also tile the cells' parents at these resolutions.
+	Pyramid string
+	// AdaptiveMaxZoom is "10" or "10:4": end the tiles of sparse regions early; see AdaptiveZoom.
+	AdaptiveMaxZoom string
+	// Compact merges complete sibling sets with equal properties into their parent; see Compaction.
+	Compact bool
+	// DissolveBy lists properties whose touching equal-valued cells are unioned; see Dissolve.
+	DissolveBy []string
+	// Trace writes a Chrome trace of the build's stages and queues to this path.
+	Trace string
+	// Progress receives a progress bar redrawn on one line; pass a terminal.
+	Progress io.Writer
+	// ReportFormats lists ReportHTML, ReportJSON, or ReportNone alone; empty writes the HTML report.
+	ReportFormats []string
+	// DebugDrops writes the first rows the property cap drops, with their column sizes, as NDJSON.
+	DebugDrops string
+	// CacheDir keeps the NDJSON and tiles of builds keyed by their inputs and options; see buildCache.
+	CacheDir string
+	// QuickPreview also writes <output>.preview.pmtiles, a small in-process sample of the features.
+	QuickPreview bool
 }
 
+// Report formats for Options.ReportFormats.
+const (
+	ReportHTML = "html"
+	ReportJSON = "json"
+	ReportNone = "none"
+)
+
 // Result contains the report produced by the build.
 type Result struct {
 	Report *report.Report
+	// OutputPath is the tileset written: the PMTiles archive, or the MBTiles with SkipPMTiles,
+	// or Stdout when the tileset was streamed.
+	OutputPath string
+	// PMTilesPath is empty when SkipPMTiles is set.
+	PMTilesPath string
+	// MBTilesPath is the MBTiles kept next to the output for KeepMBTiles, if any.
+	MBTilesPath string
+	// Size is the size of OutputPath in bytes.
+	Size int64
+	// ReportPath is the HTML report next to the output, and ReportJSONPath the JSON one; each
+	// is empty when its format was not requested.
+	ReportPath     string
+	ReportJSONPath string
+	// CommandsPath is the script written for EmitCommands, if any.
+	CommandsPath string
+	// TracePath is the trace written for Options.Trace, if any.
+	TracePath string
+	// DropsPath is the file written for Options.DebugDrops, if any.
+	DropsPath string
+	// PreviewPath is the sampled tileset written for Options.QuickPreview, if any.
+	PreviewPath string
+	// FeatureCount counts the features emitted across every layer; DroppedCount the input rows
+	// that did not become one.
+	FeatureCount int64
+	DroppedCount int64
+	// RollupCount counts the parent cells written for Pyramid levels.
+	RollupCount int64
+	// CompactedCount counts the features written after Compact merged the input cells.
+	CompactedCount int64
+	// DissolvedCount counts the polygons written after DissolveBy merged the input cells.
+	DissolvedCount int64
+	Warnings       []string
+	Durations      PhaseDurations
+}
+
+// PhaseDurations breaks down where a build spent its time.
+type PhaseDurations struct {
+	// Features covers reading the input and writing the NDJSON features.
+	Features time.Duration
+	// Tiling covers tippecanoe and the PMTiles conversion.
+	Tiling time.Duration
+	Total  time.Duration
+}
+
+func newResult(rep *report.Report, reportPath string) *Result {
+	m := rep.Metrics
+	var keptMBTiles string
+	if rep.Config.KeepMBTiles && !rep.Config.SkipPMTiles {
+		keptMBTiles = m.MBTilesPath
+	}
+	return &Result{
+		Report:         rep,
+		OutputPath:     m.OutputPath,
+		PMTilesPath:    m.PMTilesPath,
+		MBTilesPath:    keptMBTiles,
+		PreviewPath:    m.PreviewPath,
+		Size:           m.OutputSize,
+		ReportPath:     reportPath,
+		FeatureCount:   m.EmittedFeatures,
+		DroppedCount:   m.TotalRows - m.EmittedFeatures,
+		RollupCount:    rollupCount(m.PyramidLevels),
+		CompactedCount: m.CompactedFeatures,
+		DissolvedCount: m.DissolvedFeatures,
+		Warnings:       append([]string(nil), m.Warnings...),
+		Durations: PhaseDurations{
+			Features: m.NDJSONDuration,
+			Tiling:   m.TilingDuration,
+			Total:    m.Duration,
+		},
+	}
 }
 
 // Run executes the Parquet → NDJSON → PMTiles pipeline according to Options.
@@ -52,49 +229,137 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 		return nil, err
 	}
 
+	var rec *trace.Recorder
+	if opts.Trace != "" {
+		rec = trace.New()
+		rec.Thread(traceBuild, "build")
+		rec.Thread(traceRead, "read")
+		rec.Thread(traceWrite, "write")
+	}
+	var bar *progress.Bar
+	if opts.Progress != nil {
+		bar = progress.New(opts.Progress)
+		defer bar.Close()
+	}
+
+	opts, profile, err := applyProfile(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.EmitCommands != "" {
+		opts.KeepNDJSON = true
+	}
+
+	cellGrid, err := grid.Lookup(opts.Grid)
+	if err != nil {
+		return nil, err
+	}
+
+	var expectations []expect.Expectation
+	if opts.ExpectFile != "" {
+		expectations, err = expect.Load(opts.ExpectFile, expectationMetricNames())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	threads := opts.Threads
 	if threads <= 0 {
 		threads = runtime.NumCPU()
 	}
+	// Decode is IO-bound on network storage while polygonization is CPU-bound; each stage can be
+	// sized separately and falls back to --threads.
+	decodeThreads := opts.DecodeThreads
+	if decodeThreads <= 0 {
+		decodeThreads = threads
+	}
+	encodeThreads := opts.EncodeThreads
+	if encodeThreads <= 0 {
+		encodeThreads = threads
+	}
 
 	propertyCap := opts.PropertyByteCap
 	if propertyCap <= 0 {
 		propertyCap = 2 * 1024 // 2 KB default cap
 	}
 
-	absInput, err := filepath.Abs(opts.InputPath)
-	if err != nil {
-		return nil, fmt.Errorf("resolve input path: %w", err)
+	absInput := opts.InputPath
+	if !input.IsStream(absInput) {
+		if absInput, err = objstore.Abs(opts.InputPath); err != nil {
+			return nil, fmt.Errorf("resolve input path: %w", err)
+		}
+	}
+	inputFormat := opts.InputFormat
+	if inputFormat == "" {
+		inputFormat = input.DetectFormat(absInput)
 	}
 
-	absOutput, err := filepath.Abs(opts.OutputPMTiles)
+	if opts.OutputFormat == FormatMBTiles {
+		opts.SkipPMTiles = true
+	}
+	stream := opts.OutputPMTiles == Stdout
+	absOutput, outDir, err := resolveOutput(opts.OutputPMTiles)
 	if err != nil {
-		return nil, fmt.Errorf("resolve output path: %w", err)
+		return nil, err
 	}
-
-	outDir := filepath.Dir(absOutput)
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create output directory: %w", err)
 	}
 
-	ndjsonPath := filepath.Join(outDir, "xyz.ndjson")
-	mbtilesPath := filepath.Join(outDir, "tiles.mbtiles")
+	if !stream {
+		// Two builds of the same output would remove and rewrite each other's archive.
+		lock, err := lockOutput(absOutput)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Release()
+	}
 
-	if err := removeIfExists(absOutput); err != nil {
-		return nil, err
+	// Intermediate files live in a directory of their own per run, so concurrent builds of
+	// different tilesets into one output directory never share them.
+	workDir, err := os.MkdirTemp(outDir, ".hexatiles-*")
+	if err != nil {
+		return nil, fmt.Errorf("create work directory: %w", err)
 	}
-	if err := removeIfExists(mbtilesPath); err != nil {
-		return nil, err
+	defer os.RemoveAll(workDir)
+
+	outputBase := strings.TrimSuffix(absOutput, filepath.Ext(absOutput))
+	featuresExt := ".ndjson"
+	if opts.NDJSONFormat == ndjson.FormatGeoJSONSeq {
+		featuresExt = ".geojsons"
 	}
-	if err := removeIfExists(ndjsonPath); err != nil {
-		return nil, err
+	ndjsonPath := filepath.Join(workDir, "xyz"+featuresExt)
+	arcsPath := filepath.Join(workDir, "arcs.ndjson")
+	mbtilesPath := filepath.Join(workDir, "tiles.mbtiles")
+	if opts.SkipPMTiles && !stream {
+		mbtilesPath = outputBase + ".mbtiles"
+	}
+	tilesPath := mbtilesPath
+	if opts.DirectPMTiles {
+		tilesPath = absOutput
+	}
+
+	if !stream {
+		if err := removeIfExists(absOutput); err != nil {
+			return nil, err
+		}
+		if err := removeIfExists(mbtilesPath); err != nil {
+			return nil, err
+		}
 	}
 
 	rep := &report.Report{
 		Config: report.Config{
-			InputPath:        absInput,
 			OutputPMTiles:    absOutput,
+			SkipPMTiles:      opts.SkipPMTiles,
+			DirectPMTiles:    opts.DirectPMTiles,
+			EmptyTiles:       emptyTilesPolicy(opts.EmptyTiles),
+			Tiler:            tilerName(opts.Tiler),
 			KeepNDJSON:       opts.KeepNDJSON,
+			NDJSONFormat:     ndjsonFormat(opts.NDJSONFormat),
+			NDJSONBBox:       opts.NDJSONBBox,
+			QuickPreview:     opts.QuickPreview,
+			KeepMBTiles:      opts.KeepMBTiles,
 			MinZoom:          opts.MinZoom,
 			MaxZoom:          opts.MaxZoom,
 			MinZoomDerived:   opts.MinZoom < 0,
@@ -106,188 +371,929 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 			PropsKeep:        append([]string(nil), opts.PropertyInclude...),
 			PropsDrop:        append([]string(nil), opts.PropertyDrop...),
 			Threads:          threads,
+			DecodeThreads:    decodeThreads,
+			EncodeThreads:    encodeThreads,
 			Simplify:         opts.Simplify,
 			PropertyByteCap:  propertyCap,
+			Profile:          profile.Name,
+			StringMaxBytes:   opts.StringMaxBytes,
+			ExtrudeBy:        opts.ExtrudeBy,
 		},
 		Metrics: report.Metrics{
 			StartedAt: time.Now(),
 		},
 	}
+	cells := rep.AddSource(report.SourceConfig{
+		Layer:       "h3",
+		InputPath:   absInput,
+		InputFormat: inputFormat,
+		Grid:        cellGrid.Name(),
+	})
 
 	quantizer, err := props.Parse(opts.QuantizeSpec)
 	if err != nil {
 		return nil, fmt.Errorf("parse quantize spec: %w", err)
 	}
 
-    // Default per SPEC: --props whitelist; default none (keep none). Drop patterns still applied.
-    // We still add system fields (h3, resolution) later in buildFeature.
-    filter := props.NewFilter(opts.PropertyInclude, opts.PropertyDrop, false)
+	nonFinite, err := props.ParseNonFinitePolicy(opts.NonFinite)
+	if err != nil {
+		return nil, err
+	}
+	rep.Config.NonFinitePolicy = string(nonFinite)
+	reserved, err := props.ParseReservedKeyPolicy(opts.ReservedKeys)
+	if err != nil {
+		return nil, err
+	}
+	rep.Config.ReservedKeyPolicy = string(reserved)
+	winding, err := ndjson.ParseWinding(opts.Winding)
+	if err != nil {
+		return nil, err
+	}
+	rep.Config.Winding = string(winding)
+
+	// Default per SPEC: --props whitelist; default none (keep none). Drop patterns still applied.
+	// We still add system fields (h3, resolution) later in buildFeature.
+	filter := props.NewFilter(opts.PropertyInclude, opts.PropertyDrop, profile.KeepAllProperties)
 
-	reader, err := parquetreader.NewReader(absInput, parquetreader.ReaderOptions{BatchSize: 4096, Parallel: threads})
+	valueMaps, err := props.ParseValueMaps(opts.ValueMaps)
 	if err != nil {
-		return nil, fmt.Errorf("open parquet reader: %w", err)
+		return nil, err
 	}
-	defer reader.Close()
+	rep.Config.ValueMaps = valueMaps.Specs()
 
-	writer, err := ndjson.NewWriter(ndjsonPath)
+	coercions, err := props.ParseCoercions(opts.Types)
 	if err != nil {
-		return nil, fmt.Errorf("create NDJSON writer: %w", err)
+		return nil, err
 	}
-	defer writer.Close()
+	rep.Config.Types = coercions.Specs()
+	rep.Config.FlattenNested = opts.FlattenNested
 
-	err = processRows(ctx, reader, writer, processConfig{
-		Options:     opts,
-		Threads:     threads,
-		PropertyCap: propertyCap,
-		Quantizer:   quantizer,
-		Filter:      filter,
-		Report:      rep,
-	})
+	where, err := props.ParseWhere(opts.Where)
 	if err != nil {
 		return nil, err
 	}
+	rep.Config.Where = where.String()
+	if opts.FeatureLimit < 0 {
+		return nil, fmt.Errorf("feature limit must not be negative, got %d", opts.FeatureLimit)
+	}
+	if len(opts.Conserve) > 0 && opts.FeatureLimit == 0 && tilerName(opts.Tiler) == tiler.TilerNative {
+		return nil, fmt.Errorf("--conserve needs --feature-limit with the native tiler, which otherwise keeps every cell")
+	}
+	rep.Config.FeatureLimit = opts.FeatureLimit
+	rep.Config.Conserve = append([]string(nil), opts.Conserve...)
 
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("close NDJSON writer: %w", err)
+	agg, err := parseAggregation(opts.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+	rep.Config.Aggregate = agg.String()
+
+	stages, err := newFeatureStages(opts, agg, cellGrid, rep)
+	if err != nil {
+		return nil, err
+	}
+	pyramid, dissolve, collect := stages.pyramid, stages.dissolve, stages.collect
+
+	classSpecs, err := classify.ParseSpecs(opts.Classify)
+	if err != nil {
+		return nil, err
 	}
 
-	if info, statErr := os.Stat(ndjsonPath); statErr == nil {
-		rep.Metrics.NDJSONPath = ndjsonPath
-		rep.Metrics.NDJSONSize = info.Size()
+	cache, err := newBuildCache(opts, absInput, valueMaps, rep)
+	if err != nil {
+		return nil, err
 	}
 
-	tippecanoeRunner, err := tiler.NewTippecanoeRunner(opts.TippecanoePath)
+	endPrescan := rec.Begin(traceBuild, "prescan", "prescan")
+	bar.Phase("prescan", 0)
+	scan, err := prescan(ctx, absInput, inputFormat, opts, classSpecs, where, agg, cellGrid, threads, cells)
 	if err != nil {
 		return nil, err
 	}
+	endPrescan(nil)
+	extrusion := scan.Extrusion
+	recordPrescan(opts, scan, pyramid, rep)
+	if err := stages.checkDissolve(filter, scan); err != nil {
+		return nil, err
+	}
 
-	pmtilesConverter, err := tiler.NewPMTilesConverter(opts.PMTilesPath)
+	var reader input.Source
+	err = attemptSource(ctx, cells, opts.SourceRetries, func() (err error) {
+		reader, err = input.Open(absInput, inputFormat, parquetreader.ReaderOptions{
+			BatchSize:     4096,
+			Parallel:      decodeThreads,
+			Grid:          cellGrid,
+			Columns:       projectedColumns(opts, filter, profile, scan, where, agg),
+			FlattenNested: opts.FlattenNested,
+		})
+		return sourceFailure(err)
+	})
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
+	metadata := inheritMetadata(opts.Metadata, reader.KeyValueMetadata(), rep)
 
-	minZoom, maxZoom := deriveZooms(opts, rep)
+	for _, property := range where.Properties() {
+		if _, ok := reader.PropertyTypes()[property]; !ok {
+			rep.AddWarning(fmt.Sprintf("--where reads %q, which the input does not have; it is always null", property))
+		}
+	}
+
+	if !opts.KeepUnusable {
+		if err := excludeUnusableColumns(reader, filter, rep); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := props.NewStats()
+	cardinality := props.NewCardinality()
+	tileStats := props.NewTileStats()
+	if err := agg.check(reader.PropertyTypes()); err != nil {
+		return nil, err
+	}
+	// Aggregated and mapped properties take the kind of their new values from here on.
+	types := coercions.Types(valueMaps.Types(agg.Types(reader.PropertyTypes())))
+	if err := checkConserved(opts.Conserve, deriveAttributeTypes(filter, types, cellGrid.Name())); err != nil {
+		return nil, err
+	}
+	schema := quantizeTypes(types, extrusion, scan.Classifications)
+	featureCfg := processConfig{
+		Options:     opts,
+		Threads:     encodeThreads,
+		PropertyCap: propertyCap,
+		Quantizer:   quantizer.Compile(schema),
+		Encoder:     ndjson.NewPropertyEncoder(append(sortedKeys(schema), cellGrid.Name(), "resolution")),
+		NonFinite:   nonFinite,
+		Reserved:    reserved,
+		Sanitizer:   props.StringSanitizer{MaxBytes: opts.StringMaxBytes},
+		Grid:        cellGrid,
+		Extrusion:   extrusion,
+		Classes:     scan.Classifications,
+		Top:         scan.TopPerParent,
+		Adaptive:    scan.Adaptive,
+		Stats:       stats,
+		Cardinality: cardinality,
+		TileStats:   tileStats,
+		Filter:      filter,
+		ValueMaps:   valueMaps,
+		Coercions:   coercions,
+		Where:       where,
+		Aggregate:   agg,
+		Pyramid:     pyramid,
+		Collect:     collect,
+		Zoom:        pyramid.dataZooms(),
+		Report:      rep,
+		Source:      cells,
+		Trace:       rec,
+		Progress:    bar,
+	}
+	if opts.DebugDrops != "" {
+		featureCfg.Drops = newDropSamples()
+	}
+	// The coverage options are not part of the cache key, so a cached feature stage always
+	// records the coverage for the builds that check it.
+	if (!stream && opts.CoverageThreshold >= 0) || cache.cachesFeatures() {
+		featureCfg.Coverage = newTileCoverage(zoomCapOf(opts))
+	}
+	var summary map[string]props.PropertyStats
+	var layerStats props.TileStatsLayer
+	var arcs *od.Result
+	var failed []*report.Source
+	restoreStart := time.Now()
+	cached, err := cache.restoreFeatures(ndjsonPath, arcsPath)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		// The feature stage ran before with the same inputs and options: take its NDJSON and
+		// the report state it left instead of reading the input again.
+		started := rep.Metrics.StartedAt
+		rep.Metrics, rep.Sources = cached.Metrics, cached.Sources
+		rep.Metrics.StartedAt = started
+		rep.Metrics.NDJSONDuration = time.Since(restoreStart)
+		rep.Metrics.CachedStages = append(rep.Metrics.CachedStages, cachedFeatures)
+		cells = rep.Sources[0]
+		summary, layerStats, arcs = cached.Stats, cached.TileStats, cached.Arcs
+		featureCfg.Coverage = cached.Coverage.restore()
+	} else {
+		writer, err := ndjson.NewFormatWriter(ndjsonPath, opts.NDJSONFormat)
+		if err != nil {
+			return nil, fmt.Errorf("create NDJSON writer: %w", err)
+		}
+		defer writer.Close()
+		if !opts.NDJSONBBox {
+			writer.OmitBBox()
+		}
+		writer.SetWinding(winding)
+
+		endFeatures := rec.Begin(traceBuild, "features", "features")
+		bar.Phase("features", reader.TotalRows())
+		if err := processRows(ctx, reader, writer, featureCfg); err != nil {
+			return nil, err
+		}
+		endFeatures(map[string]any{"rows": cells.Metrics.TotalRows, "features": cells.Metrics.EmittedFeatures})
+		if err := checkRowCount(opts, reader.TotalRows(), cells, rep); err != nil {
+			return nil, err
+		}
+		if collect != nil {
+			if err := collect.write(ctx, writer, featureCfg); err != nil {
+				return nil, err
+			}
+		}
+		if pyramid != nil {
+			endRollups := rec.Begin(traceBuild, "pyramid", "features")
+			bar.Phase("pyramid", 0)
+			if err := writeRollups(ctx, writer, featureCfg); err != nil {
+				return nil, err
+			}
+			endRollups(map[string]any{"features": rollupCount(rep.Metrics.PyramidLevels)})
+			if finest := pyramid.levels[len(pyramid.levels)-1].Resolution; cells.Metrics.MinResolutionSeen <= finest && cells.Metrics.EmittedFeatures > 0 {
+				rep.AddWarning(fmt.Sprintf("--pyramid rolls up to r%d, but the input has r%d cells; they appear unchanged in the pyramid", finest, cells.Metrics.MinResolutionSeen))
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("close NDJSON writer: %w", err)
+		}
+		for _, key := range sortedKeys(rep.Metrics.ReservedKeyConflicts) {
+			n := rep.Metrics.ReservedKeyConflicts[key]
+			switch reserved {
+			case props.ReservedRename:
+				rep.AddWarning(fmt.Sprintf("%d rows had a %s property differing from the one the build writes; kept as %s", n, key, key+props.ReservedSuffix))
+			default:
+				rep.AddWarning(fmt.Sprintf("%d rows had a %s property differing from the one the build writes; dropped", n, key))
+			}
+		}
+		for _, m := range valueMaps {
+			if misses := m.Misses(); misses > 0 {
+				rep.AddWarning(fmt.Sprintf("%d %s values had no entry in %s and were kept unmapped", misses, m.Property, m.Path))
+			}
+		}
+
+		summary = stats.Summary()
+		for _, key := range sortedKeys(summary) {
+			st := summary[key]
+			rep.Metrics.PropertyStats = append(rep.Metrics.PropertyStats, report.PropertyStats{
+				Property:    key,
+				Count:       st.Count,
+				Min:         st.Min,
+				Max:         st.Max,
+				Mean:        st.Mean,
+				Percentiles: st.Percentiles,
+			})
+		}
+
+		cardinalities := cardinality.Summary()
+		// The cell identifier attribute is unique per feature by design.
+		delete(cardinalities, cellGrid.Name())
+		recordCardinality(rep, cardinalities)
+
+		layerStats = tileStats.Layer("h3", "Polygon")
+		// The statistics describe the input cells; merging them and adding parents changes the count.
+		switch {
+		case opts.Compact:
+			layerStats.Count = rep.Metrics.CompactedFeatures
+		case len(opts.DissolveBy) > 0:
+			layerStats.Count = rep.Metrics.DissolvedFeatures
+		}
+		layerStats.Count += rollupCount(rep.Metrics.PyramidLevels)
+
+		rep.Metrics.NDJSONSize = writer.Bytes()
+		rep.Metrics.NDJSONBBoxOmitted = writer.BBoxBytesOmitted()
+		rep.Metrics.RingsRewound = writer.RingsRewound()
+
+		if opts.ArcsInput != "" {
+			endArcs := rec.Begin(traceBuild, "arcs", "features")
+			bar.Phase("arcs", 0)
+			arcsSource := rep.AddSource(report.SourceConfig{Layer: "arcs", InputPath: opts.ArcsInput, InputFormat: input.FormatParquet})
+			if abs, err := objstore.Abs(opts.ArcsInput); err == nil {
+				arcsSource.Config.InputPath = abs
+			}
+			err = attemptSource(ctx, arcsSource, opts.SourceRetries, func() (err error) {
+				arcs, err = writeArcs(ctx, opts, arcsPath, nonFinite, arcsSource, rep)
+				return err
+			})
+			switch {
+			case err != nil && opts.KeepGoing && ctx.Err() == nil:
+				arcsSource.Metrics.Failure = err.Error()
+				failed = append(failed, arcsSource)
+				rep.AddWarning(fmt.Sprintf("left out the arcs layer after %d attempts: %v", arcsSource.Metrics.Retries+1, err))
+			case err != nil:
+				return nil, err
+			default:
+				endArcs(map[string]any{"features": arcs.Emitted})
+			}
+		}
+		// A rerun should try a failed source again rather than reuse the features without it.
+		if len(failed) == 0 {
+			cache.storeFeatures(ndjsonPath, arcsPath, featuresSnapshot{
+				Metrics:   rep.Metrics,
+				Sources:   rep.Sources,
+				Stats:     summary,
+				TileStats: layerStats,
+				Arcs:      arcs,
+				Coverage:  featureCfg.Coverage.snapshot(),
+			}, rep)
+		}
+	}
+	rep.Metrics.NDJSONPath = ndjsonPath
+
+	native := tilerName(opts.Tiler) == tiler.TilerNative
+	var runner tiler.Runner
+	if native {
+		runner = tiler.NewNativeTiler()
+	} else {
+		runner, err = tiler.NewTippecanoeRunner(opts.TippecanoePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pmtilesConverter *tiler.PMTilesConverter
+	if !opts.SkipPMTiles {
+		// Archives are written natively; the CLI is only needed for `pmtiles info`, and the
+		// report simply omits the archive details without it.
+		pmtilesConverter, _ = tiler.NewPMTilesConverter(opts.PMTilesPath)
+	}
+	rep.Config.Environment = captureEnvironment(ctx, outDir, runner, pmtilesConverter)
+
+	zoomCap := zoomCapOf(opts)
+	minZoom, maxZoom := deriveZooms(opts, cells, cellGrid)
+	if opts.MaxZoom > zoomCap {
+		rep.AddWarning(fmt.Sprintf("--maxzoom %d is above the zoom cap; tiles stop at z%d (raise --zoom-cap to go deeper)", opts.MaxZoom, zoomCap))
+	}
+	if err := checkZoomRange(opts, maxZoom, zoomCap, cells, cellGrid, rep); err != nil {
+		return nil, err
+	}
+	// Regions end at most at the ceiling finish derived, so that is what the floor must be below.
+	if adaptive := scan.Adaptive; adaptive != nil && adaptive.Floor >= adaptive.ceiling {
+		rep.AddWarning(fmt.Sprintf("--adaptive-maxzoom floor z%d is not below the maximum zoom z%d; every region is tiled to z%d", adaptive.Floor, adaptive.ceiling, adaptive.ceiling))
+	}
+	if pyramid != nil && pyramid.DataMinZoom() > maxZoom {
+		rep.AddWarning(fmt.Sprintf("the input cells start at z%d after the --pyramid levels, past the maximum zoom z%d; only parent cells are tiled", pyramid.DataMinZoom(), maxZoom))
+	}
+
+	attributes := deriveAttributes(filter, cellGrid.Name())
+	if profile.KeepAllProperties && len(filter.Keys()) == 0 {
+		// Every property survived the filter; let tippecanoe keep them all.
+		attributes = nil
+	}
 
 	tipOpts := tiler.TippecanoeOptions{
-		MinZoom:   minZoom,
-		MaxZoom:   maxZoom,
-		Simplify:  opts.Simplify,
-		SortBy:    "h3",
-		Threads:   threads,
-		LayerName: "h3",
-		Metadata:  opts.Metadata,
-		Attributes: deriveAttributes(filter),
+		MinZoom:        minZoom,
+		MaxZoom:        maxZoom,
+		Simplify:       opts.Simplify,
+		SortBy:         cellGrid.Name(),
+		Threads:        threads,
+		LayerName:      "h3",
+		Metadata:       metadata,
+		Attributes:     attributes,
+		DropStrategy:   profile.DropStrategy,
+		AttributeTypes: deriveAttributeTypes(filter, types, cellGrid.Name()),
+		ZoomCap:        zoomCap,
+		FeatureLimit:   opts.FeatureLimit,
+		Conserve:       opts.Conserve,
+		ExtraArgs:      opts.ExtraTippecanoeArgs,
+		ReadParallel:   readParallel(opts),
+	}
+	if reserved == props.ReservedRename {
+		// Input columns named like the system fields come through renamed where they differ.
+		for _, key := range []string{cellGrid.Name(), "resolution"} {
+			kind, ok := types[key]
+			if !ok || (filter != nil && !filter.Allows(key)) {
+				continue
+			}
+			if tipOpts.Attributes != nil {
+				tipOpts.Attributes = append(tipOpts.Attributes, key+props.ReservedSuffix)
+			}
+			tipOpts.AttributeTypes[key+props.ReservedSuffix] = kind
+		}
+	}
+	if extrusion != nil {
+		if tipOpts.Attributes != nil {
+			tipOpts.Attributes = append(tipOpts.Attributes, HeightAttribute)
+		}
+		tipOpts.AttributeTypes[HeightAttribute] = "float"
+	}
+	for _, c := range scan.Classifications {
+		if tipOpts.Attributes != nil {
+			tipOpts.Attributes = append(tipOpts.Attributes, c.Attribute())
+		}
+		tipOpts.AttributeTypes[c.Attribute()] = "int"
+	}
+	if dissolve != nil {
+		if tipOpts.Attributes != nil {
+			tipOpts.Attributes = append(tipOpts.Attributes, DissolveCellsAttribute)
+		}
+		tipOpts.AttributeTypes[DissolveCellsAttribute] = "int"
+	}
+	if arcs != nil {
+		tipOpts.ExtraLayers = append(tipOpts.ExtraLayers, tiler.Layer{Name: "arcs", Path: arcsPath})
+		if tipOpts.Attributes != nil {
+			tipOpts.Attributes = append(tipOpts.Attributes, arcs.PropertyKeys()...)
+		}
+		for key, kind := range arcs.PropertyTypes {
+			if _, exists := tipOpts.AttributeTypes[key]; !exists {
+				tipOpts.AttributeTypes[key] = kind
+			}
+		}
 	}
 
 	rep.Config.MinZoom = minZoom
 	rep.Config.MaxZoom = maxZoom
 	rep.Config.MinZoomDerived = opts.MinZoom < 0
 	rep.Config.MaxZoomDerived = opts.MaxZoom < 0
+	rep.Config.ZoomCap = zoomCap
 
+	if bar != nil {
+		bar.Phase("tiling ("+tilerName(opts.Tiler)+")", 0)
+		tipOpts.Progress = bar.Percent
+	}
 	tipStart := time.Now()
-	tipOutput, tipArgs, err := tippecanoeRunner.Run(ctx, ndjsonPath, mbtilesPath, tipOpts)
+	tileRunner := cache.runner(runner, rep)
+	tipOutput, tipArgs, err := tileRunner.Run(ctx, ndjsonPath, tilesPath, tipOpts)
 	rep.Metrics.TilingDuration += time.Since(tipStart)
+	tilingSpan := tiler.TilerTippecanoe
+	if native {
+		tilingSpan = "native tiler"
+	}
+	rec.Span(traceBuild, tilingSpan, "tiling", tipStart, time.Now(), map[string]any{"minzoom": minZoom, "maxzoom": maxZoom})
 	rep.Metrics.TippecanoeCommand = append([]string(nil), tipArgs...)
 	rep.Metrics.TippecanoeOutput = tipOutput
 	if err != nil {
 		return nil, err
 	}
+	if conserving, ok := tileRunner.(interface {
+		Conservation() []tiler.ZoomConservation
+	}); ok {
+		recordConservation(conserving.Conservation(), rep)
+	}
+
+	recordEmptyTiles(opts, tilesPath, rep)
 
-	if info, statErr := os.Stat(mbtilesPath); statErr == nil {
+	if info, statErr := os.Stat(mbtilesPath); statErr == nil && !opts.DirectPMTiles {
 		rep.Metrics.MBTilesPath = mbtilesPath
 		rep.Metrics.MBTilesSize = info.Size()
 	}
 
+	// Under "classes", each --classify property keeps its method and breaks, so a style can draw
+	// its legend with the same classes as the tiles.
+	extra := scan.Metadata()
+	if len(summary) > 0 {
+		extra["stats"] = summary
+	}
+	extra["pipeline"] = pipelineMetadata(opts, rep, cellGrid)
+	archiveMetadata := map[string]any{"tilestats": props.TileStatsMetadata(layerStats)}
+	if len(extra) > 0 {
+		archiveMetadata["hexatiles"] = extra
+	}
+
+	switch {
+	case stream:
+		endStream := rec.Begin(traceBuild, "stream to stdout", "tiling")
+		bar.Phase("stream to stdout", 0)
+		if err := streamTileset(ctx, opts, mbtilesPath, archiveMetadata, rep); err != nil {
+			return nil, err
+		}
+		endStream(map[string]any{"bytes": rep.Metrics.OutputSize})
+	case opts.DirectPMTiles:
+		recordPMTiles(ctx, pmtilesConverter, absOutput, archiveMetadata, rep)
+	case opts.SkipPMTiles:
+		if err := tiler.MergeMBTilesMetadata(mbtilesPath, archiveMetadata); err != nil {
+			rep.AddWarning(fmt.Sprintf("record tileset metadata: %v", err))
+		}
+		if info, statErr := os.Stat(mbtilesPath); statErr == nil {
+			rep.Metrics.MBTilesSize = info.Size()
+			rep.Metrics.OutputPath = mbtilesPath
+			rep.Metrics.OutputSize = info.Size()
+		}
+		if meta, err := tiler.MBTilesInfo(mbtilesPath); err == nil {
+			rep.Metrics.PMTilesInfo = meta
+		} else {
+			rep.AddWarning(fmt.Sprintf("mbtiles metadata: %v", err))
+		}
+		if counts, err := tiler.MBTilesTileCounts(mbtilesPath); err == nil {
+			recordTileCounts(counts, rep)
+		} else {
+			rep.AddWarning(fmt.Sprintf("tile counts: %v", err))
+		}
+	default:
+		endConvert := rec.Begin(traceBuild, "convert to PMTiles", "tiling")
+		bar.Phase("convert to PMTiles", 0)
+		if err := convertPMTiles(ctx, pmtilesConverter, mbtilesPath, absOutput, archiveMetadata, rep); err != nil {
+			return nil, err
+		}
+		endConvert(nil)
+		if opts.KeepMBTiles {
+			keepMBTiles(mbtilesPath, outputBase+".mbtiles", archiveMetadata, rep)
+		} else {
+			_ = os.Remove(mbtilesPath)
+		}
+	}
+	var coverageErr error
+	if rep.Metrics.OutputPath != "" && !stream {
+		recordTilesetZooms(rep.Metrics.OutputPath, rep)
+		coverageErr = checkCoverage(opts, rep.Metrics.OutputPath, featureCfg.Coverage, rep)
+	}
+	if opts.QuickPreview {
+		endPreview := rec.Begin(traceBuild, "preview", "tiling")
+		bar.Phase("preview", 0)
+		if err := writePreview(ctx, ndjsonPath, outputBase+previewExt, tipOpts, archiveMetadata, rep); err != nil {
+			rep.AddWarning(fmt.Sprintf("quick preview: %v", err))
+		}
+		endPreview(map[string]any{"features": rep.Metrics.PreviewFeatures})
+	}
+
+	if opts.KeepNDJSON {
+		// Kept features move next to the output, named after it; the work directory goes away.
+		if err := keepFile(ndjsonPath, outputBase+featuresExt); err != nil {
+			rep.AddWarning(fmt.Sprintf("keep NDJSON: %v", err))
+			rep.Metrics.NDJSONPath = ""
+		} else {
+			rep.Metrics.NDJSONPath = outputBase + featuresExt
+		}
+		if arcs != nil {
+			if err := keepFile(arcsPath, outputBase+".arcs.ndjson"); err != nil {
+				rep.AddWarning(fmt.Sprintf("keep arcs NDJSON: %v", err))
+			}
+		}
+	} else {
+		rep.Metrics.NDJSONPath = ""
+	}
+
+	var commandsPath string
+	if opts.EmitCommands != "" {
+		script := commandScript{
+			Output:     absOutput,
+			Tippecanoe: "tippecanoe",
+			PMTiles:    "pmtiles",
+			TilesPath:  outputBase + ".mbtiles",
+			NDJSON:     outputBase + featuresExt,
+			Options:    tipOpts,
+			Convert:    !opts.SkipPMTiles && !opts.DirectPMTiles,
+			Native:     native,
+			Empty:      emptyTilesPolicy(opts.EmptyTiles) == tiler.EmptyTilesWrite,
+		}
+		if tippecanoe, ok := runner.(*tiler.TippecanoeRunner); ok {
+			script.Tippecanoe = tippecanoe.Binary
+		}
+		if pmtilesConverter != nil {
+			script.PMTiles = pmtilesConverter.Binary
+		}
+		if opts.DirectPMTiles {
+			script.TilesPath = absOutput
+		}
+		script.Options.ExtraLayers = nil
+		if arcs != nil {
+			script.Options.ExtraLayers = []tiler.Layer{{Name: "arcs", Path: outputBase + ".arcs.ndjson"}}
+		}
+		commandsPath, err = filepath.Abs(opts.EmitCommands)
+		if err == nil {
+			err = writeCommandScript(commandsPath, script)
+		}
+		if err != nil {
+			rep.AddWarning(fmt.Sprintf("emit commands: %v", err))
+			commandsPath = ""
+		}
+	}
+
+	var tracePath string
+	if rec != nil {
+		tracePath, err = filepath.Abs(opts.Trace)
+		if err == nil {
+			err = rec.WriteFile(tracePath)
+		}
+		if err != nil {
+			rep.AddWarning(fmt.Sprintf("trace: %v", err))
+			tracePath = ""
+		}
+	}
+
+	var dropsPath string
+	if featureCfg.Drops != nil {
+		dropsPath, err = filepath.Abs(opts.DebugDrops)
+		if err == nil {
+			err = featureCfg.Drops.writeFile(dropsPath)
+		}
+		if err != nil {
+			rep.AddWarning(fmt.Sprintf("debug drops: %v", err))
+			dropsPath = ""
+		}
+	}
+
+	rep.Metrics.FinishedAt = time.Now()
+	rep.Metrics.Duration = time.Since(rep.Metrics.StartedAt)
+
+	rep.Summarize()
+	expectErr := checkExpectations(rep, expectations)
+
+	var reportPath, reportJSONPath string
+	if slices.Contains(opts.ReportFormats, ReportJSON) {
+		reportJSONPath = filepath.Join(outDir, "report.json")
+		if err := rep.WriteJSON(reportJSONPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.ReportFormats) == 0 || slices.Contains(opts.ReportFormats, ReportHTML) {
+		reportPath = filepath.Join(outDir, "report.html")
+		if err := rep.WriteHTML(reportPath); err != nil {
+			return nil, err
+		}
+	}
+	if coverageErr != nil {
+		return nil, coverageErr
+	}
+	if expectErr != nil {
+		return nil, expectErr
+	}
+
+	result := newResult(rep, reportPath)
+	result.ReportJSONPath = reportJSONPath
+	result.CommandsPath = commandsPath
+	result.TracePath = tracePath
+	result.DropsPath = dropsPath
+	if len(failed) > 0 {
+		return result, &PartialError{Failed: failed}
+	}
+	return result, nil
+}
+
+// Additional helper functions and types will go here.
+
+// checkRowCount compares the rows read with the count the input footer declares, -1 when the
+// format records none. Readers stop at the first short read, so a truncated or corrupt file
+// would otherwise be tiled partially without notice.
+func checkRowCount(opts Options, footerRows int64, src *report.Source, rep *report.Report) error {
+	if footerRows < 0 {
+		return nil
+	}
+	src.Metrics.FooterRows = footerRows
+	if src.Metrics.TotalRows == footerRows {
+		return nil
+	}
+	msg := fmt.Sprintf("read %d rows but the input footer declares %d; the file may be truncated or corrupt", src.Metrics.TotalRows, footerRows)
+	if !opts.Lenient {
+		return fmt.Errorf("%s (--lenient to tile the rows read)", msg)
+	}
+	rep.AddWarning(msg)
+	return nil
+}
+
+// keepMBTiles moves the MBTiles the PMTiles output was converted from to dst, with the same
+// metadata as the archive, so it can be served by MBTiles tile servers.
+func keepMBTiles(mbtilesPath, dst string, metadata map[string]any, rep *report.Report) {
+	if err := tiler.MergeMBTilesMetadata(mbtilesPath, metadata); err != nil {
+		rep.AddWarning(fmt.Sprintf("record MBTiles metadata: %v", err))
+	}
+	if err := keepFile(mbtilesPath, dst); err != nil {
+		rep.AddWarning(fmt.Sprintf("keep MBTiles: %v", err))
+		rep.Metrics.MBTilesPath = ""
+		return
+	}
+	rep.Metrics.MBTilesPath = dst
+	if info, err := os.Stat(dst); err == nil {
+		rep.Metrics.MBTilesSize = info.Size()
+	}
+}
+
+// convertPMTiles writes the MBTiles to the PMTiles output with the top-level keys of metadata
+// added to its metadata and fills the artifact fields of the report.
+func convertPMTiles(ctx context.Context, converter *tiler.PMTilesConverter, mbtilesPath, output string, metadata map[string]any, rep *report.Report) error {
 	convertStart := time.Now()
-	pmOutput, err := pmtilesConverter.Convert(ctx, mbtilesPath, absOutput)
+	err := tiler.ConvertMBTiles(ctx, mbtilesPath, output, metadata)
 	rep.Metrics.TilingDuration += time.Since(convertStart)
 	if err != nil {
-		rep.Metrics.TippecanoeOutput += "\n" + pmOutput
-		return nil, err
+		return err
+	}
+	// The metadata is already in place, so nothing is merged afterwards.
+	recordPMTiles(ctx, converter, output, nil, rep)
+	return nil
+}
+
+// recordPMTiles merges the top-level keys of metadata into the metadata of the PMTiles output
+// and fills the artifact fields of the report. converter may be nil when the pmtiles CLI is not
+// installed.
+func recordPMTiles(ctx context.Context, converter *tiler.PMTilesConverter, output string, metadata map[string]any, rep *report.Report) {
+	if len(metadata) > 0 {
+		if err := tiler.MergeMetadata(output, metadata); err != nil {
+			rep.AddWarning(fmt.Sprintf("record tileset metadata: %v", err))
+		}
 	}
 
-	if info, statErr := os.Stat(absOutput); statErr == nil {
-		rep.Metrics.PMTilesPath = absOutput
+	if info, statErr := os.Stat(output); statErr == nil {
+		rep.Metrics.PMTilesPath = output
 		rep.Metrics.PMTilesSize = info.Size()
+		rep.Metrics.OutputPath = output
+		rep.Metrics.OutputSize = info.Size()
 	}
 
-	pmMeta, pmRaw, infoErr := pmtilesConverter.Info(ctx, absOutput)
+	if counts, err := tiler.PMTilesTileCounts(output); err == nil {
+		recordTileCounts(counts, rep)
+	} else {
+		rep.AddWarning(fmt.Sprintf("tile counts: %v", err))
+	}
+
+	if converter == nil {
+		return
+	}
+	pmMeta, pmRaw, infoErr := converter.Info(ctx, output)
 	if infoErr == nil {
 		rep.Metrics.PMTilesInfo = pmMeta
 	} else if pmRaw != "" {
 		rep.AddWarning(fmt.Sprintf("pmtiles info: %v", infoErr))
 	}
+}
 
-	if !opts.KeepNDJSON {
-		_ = os.Remove(ndjsonPath)
-		rep.Metrics.NDJSONPath = ""
+func tilerName(name string) string {
+	if name == "" {
+		return tiler.TilerTippecanoe
 	}
-	_ = os.Remove(mbtilesPath)
+	return name
+}
 
-	rep.Metrics.FinishedAt = time.Now()
-	rep.Metrics.Duration = time.Since(rep.Metrics.StartedAt)
+func emptyTilesPolicy(policy string) string {
+	if policy == "" {
+		return tiler.EmptyTilesElide
+	}
+	return policy
+}
 
-	if err := rep.WriteHTML(filepath.Join(outDir, "report.html")); err != nil {
-		return nil, err
+// recordEmptyTiles applies the empty tile policy to the tippecanoe output at tilesPath and
+// records how many featureless tiles were elided or written.
+func recordEmptyTiles(opts Options, tilesPath string, rep *report.Report) {
+	var err error
+	switch {
+	case emptyTilesPolicy(opts.EmptyTiles) == tiler.EmptyTilesWrite:
+		rep.Metrics.EmptyTilesWritten, err = tiler.WriteEmptyTiles(tilesPath)
+	case opts.DirectPMTiles:
+		rep.Metrics.EmptyTilesElided, err = tiler.PMTilesElidedTiles(tilesPath)
+	default:
+		rep.Metrics.EmptyTilesElided, err = tiler.MBTilesElidedTiles(tilesPath)
+	}
+	if err != nil {
+		rep.AddWarning(fmt.Sprintf("empty tiles: %v", err))
+	}
+}
+
+// quantizeTypes adds the derived height and class attributes, which are quantized with the
+// input columns, to the input schema.
+func quantizeTypes(types map[string]string, extrusion *Extrusion, classes []*classify.Classification) map[string]string {
+	out := make(map[string]string, len(types)+len(classes)+1)
+	for key, kind := range types {
+		out[key] = kind
+	}
+	if extrusion != nil {
+		out[HeightAttribute] = "float"
 	}
+	for _, c := range classes {
+		out[c.Attribute()] = "int"
+	}
+	return out
+}
 
-	return &Result{Report: rep}, nil
+func recordTileCounts(counts tiler.TileCounts, rep *report.Report) {
+	rep.Metrics.TilesAddressed = counts.Addressed
+	rep.Metrics.TileContents = counts.Contents
+	rep.Metrics.DedupRatio = counts.DedupRatio()
 }
 
-// Additional helper functions and types will go here.
+// writeArcs builds the origin-destination arc layer from opts.ArcsInput into arcsPath and
+// records it on src.
+func writeArcs(ctx context.Context, opts Options, arcsPath string, nonFinite props.NonFinitePolicy, src *report.Source, rep *report.Report) (*od.Result, error) {
+	if !objstore.IsRemote(opts.ArcsInput) {
+		if _, err := os.Stat(opts.ArcsInput); err != nil {
+			return nil, sourceFailure(fmt.Errorf("arcs input file: %w", err))
+		}
+	}
+
+	writer, err := ndjson.NewWriter(arcsPath)
+	if err != nil {
+		return nil, fmt.Errorf("create arcs NDJSON writer: %w", err)
+	}
+	defer writer.Close()
+	if !opts.NDJSONBBox {
+		writer.OmitBBox()
+	}
+
+	arcs, err := od.WriteArcs(ctx, od.Options{
+		InputPath: opts.ArcsInput,
+		NonFinite: nonFinite,
+		Sanitizer: props.StringSanitizer{MaxBytes: opts.StringMaxBytes},
+	}, writer)
+	if err != nil {
+		return nil, sourceFailure(err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("close arcs NDJSON writer: %w", err)
+	}
+	rep.Metrics.NDJSONBBoxOmitted += writer.BBoxBytesOmitted()
+
+	src.Metrics.TotalRows = arcs.TotalRows
+	src.Metrics.EmittedFeatures = arcs.Emitted
+	src.Metrics.DroppedInvalid = arcs.Skipped
+	if len(arcs.SkipSample) > 0 {
+		msg := fmt.Sprintf("skipped OD rows: %s", strings.Join(arcs.SkipSample, "; "))
+		if arcs.Skipped > int64(len(arcs.SkipSample)) {
+			msg += fmt.Sprintf(" (and %d more)", arcs.Skipped-int64(len(arcs.SkipSample)))
+		}
+		rep.AddWarning(msg)
+	}
+	return arcs, nil
+}
+
+// featureCollector gathers the features of the input cells and writes its own, merged features
+// once the input ends.
+type featureCollector interface {
+	// key identifies the features that may merge; it is computed by the workers.
+	key(properties map[string]any, cfg processConfig) (string, error)
+	add(fr featureResult)
+	write(ctx context.Context, writer *ndjson.Writer, cfg processConfig) error
+}
 
 type processConfig struct {
 	Options     Options
 	Threads     int
 	PropertyCap int
-	Quantizer   props.Quantizer
+	Quantizer   *props.Plan
+	Encoder     *ndjson.PropertyEncoder
+	NonFinite   props.NonFinitePolicy
+	Reserved    props.ReservedKeyPolicy
+	Sanitizer   props.StringSanitizer
+	Grid        grid.CellGeometry
+	Extrusion   *Extrusion
+	Classes     []*classify.Classification
+	Top         *TopPerParent
+	// Adaptive, when set, replaces Zoom on the input cells with the range of their region.
+	Adaptive    *AdaptiveZoom
+	Stats       *props.Stats
+	Cardinality *props.Cardinality
+	TileStats   *props.TileStats
 	Filter      *props.Filter
-	Report      *report.Report
+	ValueMaps   props.ValueMaps
+	Coercions   props.Coercions
+	Where       *props.Where
+	Aggregate   *Aggregation
+	Pyramid     *Pyramid
+	// Collect takes the features in place of the writer for --compact and --dissolve-by, which
+	// need every cell before writing any; the workers then leave them without geometry.
+	Collect featureCollector
+	// Zoom is the zoom range written on every feature; nil leaves features at every zoom.
+	Zoom   *ndjson.ZoomRange
+	Report *report.Report
+	Source *report.Source
+	// Trace receives the spans of the feature stage; nil without --trace.
+	Trace *trace.Recorder
+	// Progress counts rows and features on the progress bar; nil without one.
+	Progress *progress.Bar
+	// Drops samples dropped rows; nil without --debug-drops.
+	Drops *dropSamples
+	// Coverage records the tiles of written features for the zoom coverage check; nil when
+	// it is disabled.
+	Coverage *tileCoverage
+	// Probe is set by processRows for the stages it starts.
+	Probe *pipelineProbe
 }
 
-func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjson.Writer, cfg processConfig) error {
+func processRows(ctx context.Context, reader input.Source, writer *ndjson.Writer, cfg processConfig) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	start := time.Now()
+	probe := &pipelineProbe{rec: cfg.Trace}
+	cfg.Probe = probe
 
-	jobs := make(chan *parquetreader.Row)
+	jobs, readErrs := reader.Stream(ctx)
 	results := make(chan featureResult, cfg.Threads*2)
+	workerCfg := cfg
+	if cfg.Aggregate != nil {
+		jobs = groupRows(ctx, jobs, results, cfg)
+		// The grouping stage applied --where to the input rows; merged rows are not judged again.
+		workerCfg.Where = nil
+	}
 
 	var wg sync.WaitGroup
 	for i := 0; i < cfg.Threads; i++ {
+		cfg.Trace.Thread(traceWorker+i, fmt.Sprintf("worker %d", i+1))
 		wg.Add(1)
-		go func() {
+		go func(id int) {
 			defer wg.Done()
-			workerLoop(ctx, jobs, results, cfg)
-		}()
+			workerLoop(ctx, id, jobs, results, workerCfg)
+		}(i)
 	}
+	stopSampling := make(chan struct{})
+	defer close(stopSampling)
+	go probe.sampleQueues(jobs, results, stopSampling)
 
 	go func() {
-		defer close(jobs)
-		for {
-			row, err := reader.Next()
-			if err == io.EOF {
-				return
-			}
-			if err != nil {
-				select {
-				case results <- featureResult{Err: fmt.Errorf("read parquet: %w", err)}:
-				case <-ctx.Done():
-				}
-				return
-			}
-
+		wg.Wait()
+		// Workers exit once the stream is drained; surface a read failure after them.
+		if err := <-readErrs; err != nil {
 			select {
+			case results <- featureResult{Err: fmt.Errorf("read parquet: %w", err)}:
 			case <-ctx.Done():
-				return
-			case jobs <- row:
 			}
 		}
-	}()
-
-	go func() {
-		wg.Wait()
 		close(results)
 	}()
 
@@ -302,9 +1308,11 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 	pending := make(map[int64]featureResult)
 	propertyWarnings := 0
 	invalidSamples := make([]string, 0, invalidSampleLimit)
+	var coordinateSamples []string
 	minResSeen := 0
 	maxResSeen := 0
 	resInitialised := false
+	var writeBusy time.Duration
 
 	for res := range results {
 		if res.Err != nil {
@@ -323,9 +1331,10 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 			delete(pending, expected)
 			expected++
 
-			cfg.Report.Metrics.TotalRows++
+			cfg.Source.Metrics.TotalRows++
+			cfg.Progress.Row()
 			if fr.Resolution >= 0 {
-				cfg.Report.IncrementHistogram(fr.Resolution)
+				cfg.Source.IncrementHistogram(fr.Resolution)
 				if !resInitialised {
 					minResSeen, maxResSeen = fr.Resolution, fr.Resolution
 					resInitialised = true
@@ -342,9 +1351,15 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 			if fr.Dropped {
 				switch fr.DropReason {
 				case "resolution":
-					cfg.Report.Metrics.DroppedResolution++
+					cfg.Source.Metrics.DroppedResolution++
+				case "where":
+					cfg.Source.Metrics.DroppedWhere++
+				case "top_per_parent":
+					cfg.Source.Metrics.DroppedTopPerParent++
+				case "aggregated":
+					cfg.Source.Metrics.MergedRows++
 				case "property_cap":
-					cfg.Report.Metrics.DroppedPropertyCap++
+					cfg.Source.Metrics.DroppedPropertyCap++
 					if propertyWarnings < propertyWarningLimit {
 						cfg.Report.AddPropertyWarning(report.PropertyWarning{
 							RowNumber:     fr.RowNumber,
@@ -355,8 +1370,9 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 						})
 					}
 					propertyWarnings++
+					cfg.Drops.add(fr, cfg.PropertyCap)
 				case "invalid_h3":
-					cfg.Report.Metrics.DroppedInvalidH3++
+					cfg.Source.Metrics.DroppedInvalid++
 					if len(invalidSamples) < invalidSampleLimit {
 						detail := fr.DropDetail
 						if detail == "" {
@@ -365,19 +1381,53 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 						entry := fmt.Sprintf("row %d (%s): %s", fr.RowNumber, fr.CellString, detail)
 						invalidSamples = append(invalidSamples, entry)
 					}
+				case "bad_coordinates":
+					cfg.Source.Metrics.DroppedBadCoordinates++
+					if len(coordinateSamples) < invalidSampleLimit {
+						coordinateSamples = append(coordinateSamples, fmt.Sprintf("row %d (%s): %s", fr.RowNumber, fr.CellString, fr.DropDetail))
+					}
+				case "missing_column":
+					cfg.Source.Metrics.DroppedMissingColumn++
+				case "null_cell":
+					cfg.Source.Metrics.DroppedNullCell++
 				default:
-					cfg.Report.Metrics.DroppedOther++
+					cfg.Source.Metrics.DroppedOther++
 				}
 				continue
 			}
 
-			if err := writer.WriteFeature(fr.Feature); err != nil {
+			var err error
+			writeStart := time.Now()
+			if cfg.Collect != nil {
+				cfg.Collect.add(fr)
+			} else {
+				err = writer.WriteFeature(fr.Feature)
+			}
+			writeBusy += time.Since(writeStart)
+			cfg.Encoder.Release(fr.Feature.EncodedProperties)
+			if err != nil {
 				cancel()
 				wg.Wait()
 				return fmt.Errorf("write NDJSON feature: %w", err)
 			}
 
-			cfg.Report.Metrics.EmittedFeatures++
+			cfg.Source.Metrics.EmittedFeatures++
+			probe.written.Add(1)
+			cfg.Progress.Feature()
+			cfg.Stats.Observe(fr.Feature.Properties)
+			cfg.Cardinality.Observe(fr.Feature.Properties)
+			cfg.TileStats.Observe(fr.Feature.Properties)
+			cfg.Coverage.observe(fr.Feature.Geometry)
+			cfg.Report.Metrics.SanitizedStrings += int64(fr.SanitizedStrings)
+			for _, failure := range fr.CoercionFailures {
+				cfg.Report.AddCoercionFailure(failure.Property, failure.Kind, fr.RowNumber, failure.Value)
+			}
+			for _, key := range fr.NonFinite {
+				cfg.Report.IncrementNonFinite(key)
+			}
+			for _, key := range fr.ReservedConflicts {
+				cfg.Report.IncrementReservedConflict(key)
+			}
 			if fr.QuantResult.Changes > 0 {
 				cfg.Report.Metrics.QuantizeApplied = true
 				cfg.Report.Metrics.QuantizeChanges += int64(fr.QuantResult.Changes)
@@ -399,23 +1449,49 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 		}
 	}
 
+	// Only the caller can have cancelled ctx here; the stream ended early rather than at EOF.
+	if err := ctx.Err(); err != nil {
+		wg.Wait()
+		return err
+	}
 	cancel()
 	wg.Wait()
 
+	if !probe.readEnd.IsZero() {
+		cfg.Trace.Span(traceRead, "read input", "features", start, probe.readEnd, map[string]any{"rows": cfg.Source.Metrics.TotalRows})
+	}
+	cfg.Trace.Span(traceWrite, "write NDJSON", "features", start, time.Now(), map[string]any{
+		"features": cfg.Source.Metrics.EmittedFeatures,
+		"busy_ms":  writeBusy.Milliseconds(),
+	})
+
 	if resInitialised {
-		cfg.Report.Metrics.MinResolutionSeen = minResSeen
-		cfg.Report.Metrics.MaxResolutionSeen = maxResSeen
+		cfg.Source.Metrics.MinResolutionSeen = minResSeen
+		cfg.Source.Metrics.MaxResolutionSeen = maxResSeen
 		if maxResSeen-minResSeen >= 5 {
 			cfg.Report.AddWarning(fmt.Sprintf("mixed H3 resolutions detected: r%d-r%d", minResSeen, maxResSeen))
 		}
 	}
 	if len(invalidSamples) > 0 {
 		msg := fmt.Sprintf("invalid H3 cells encountered: %s", strings.Join(invalidSamples, "; "))
-		if cfg.Report.Metrics.DroppedInvalidH3 > int64(len(invalidSamples)) {
-			msg += fmt.Sprintf(" (and %d more)", cfg.Report.Metrics.DroppedInvalidH3-int64(len(invalidSamples)))
+		if cfg.Source.Metrics.DroppedInvalid > int64(len(invalidSamples)) {
+			msg += fmt.Sprintf(" (and %d more)", cfg.Source.Metrics.DroppedInvalid-int64(len(invalidSamples)))
+		}
+		cfg.Report.AddWarning(msg)
+	}
+	if len(coordinateSamples) > 0 {
+		msg := fmt.Sprintf("cells with out-of-range boundary coordinates: %s", strings.Join(coordinateSamples, "; "))
+		if cfg.Source.Metrics.DroppedBadCoordinates > int64(len(coordinateSamples)) {
+			msg += fmt.Sprintf(" (and %d more)", cfg.Source.Metrics.DroppedBadCoordinates-int64(len(coordinateSamples)))
 		}
 		cfg.Report.AddWarning(msg)
 	}
+	if n := cfg.Source.Metrics.DroppedMissingColumn; n > 0 {
+		cfg.Report.AddWarning(fmt.Sprintf("%d rows had no %s column (expected one of %s)", n, strings.ToUpper(cfg.Grid.Name()), strings.Join(cfg.Grid.Columns(), ", ")))
+	}
+	if n := cfg.Source.Metrics.DroppedNullCell; n > 0 {
+		cfg.Report.AddWarning(fmt.Sprintf("%d rows had a null or empty %s cell", n, strings.ToUpper(cfg.Grid.Name())))
+	}
 	if propertyWarnings > propertyWarningLimit {
 		cfg.Report.AddWarning(fmt.Sprintf("property warnings truncated (%d total)", propertyWarnings))
 	}
@@ -428,6 +1504,40 @@ func processRows(ctx context.Context, reader *parquetreader.Reader, writer *ndjs
 	return nil
 }
 
+// projectedColumns lists the input columns the features can use, so readers skip the pages
+// of every other column; nil when every property may be kept.
+func projectedColumns(opts Options, filter *props.Filter, profile Profile, scan *prescanResult, where *props.Where, agg *Aggregation) []string {
+	if profile.KeepAllProperties && len(filter.Keys()) == 0 {
+		return nil
+	}
+	columns := append([]string{}, filter.Keys()...)
+	if opts.ExtrudeBy != "" {
+		columns = append(columns, opts.ExtrudeBy)
+	}
+	for _, c := range scan.Classifications {
+		columns = append(columns, c.Property)
+	}
+	if scan.TopPerParent != nil {
+		columns = append(columns, scan.TopPerParent.By)
+	}
+	columns = append(columns, agg.Properties()...)
+	return append(columns, where.Properties()...)
+}
+
+// DefaultOutputDir receives builds that do not name an output path.
+const DefaultOutputDir = "dist"
+
+// DeriveOutput returns the output path (<DefaultOutputDir>/<input-basename>.pmtiles) and tileset
+// name used when --out and --name are omitted.
+func DeriveOutput(inputPath string) (outputPath, name string) {
+	base := objstore.Base(inputPath)
+	name = strings.TrimSuffix(base, filepath.Ext(base))
+	if name == "" || name == "." || name == string(filepath.Separator) || input.IsStream(inputPath) {
+		name = "tiles"
+	}
+	return filepath.Join(DefaultOutputDir, name+".pmtiles"), name
+}
+
 func validateOptions(opts Options) error {
 	if opts.InputPath == "" {
 		return fmt.Errorf("input path is required")
@@ -435,12 +1545,160 @@ func validateOptions(opts Options) error {
 	if opts.OutputPMTiles == "" {
 		return fmt.Errorf("output path is required")
 	}
-	if _, err := os.Stat(opts.InputPath); err != nil {
-		return fmt.Errorf("input file: %w", err)
+	switch opts.OutputFormat {
+	case "", FormatPMTiles:
+	case FormatMBTiles:
+		if opts.DirectPMTiles {
+			return fmt.Errorf("--output-format mbtiles cannot be combined with --direct-pmtiles")
+		}
+	default:
+		return fmt.Errorf("unknown --output-format %q (want %s or %s)", opts.OutputFormat, FormatPMTiles, FormatMBTiles)
+	}
+	switch opts.NDJSONFormat {
+	case "", ndjson.FormatNDJSON, ndjson.FormatGeoJSONSeq:
+	default:
+		return fmt.Errorf("unknown --ndjson-format %q (want %s or %s)", opts.NDJSONFormat, ndjson.FormatNDJSON, ndjson.FormatGeoJSONSeq)
+	}
+	if err := checkTippecanoeArgs(opts); err != nil {
+		return err
+	}
+	if opts.CoverageThreshold > 1 {
+		return fmt.Errorf("--coverage-threshold %g is a share of tiles and must be at most 1", opts.CoverageThreshold)
+	}
+	if opts.KeepMBTiles && opts.DirectPMTiles {
+		return fmt.Errorf("--keep-mbtiles needs the MBTiles step and cannot be combined with --direct-pmtiles")
+	}
+	if opts.OutputPMTiles == Stdout {
+		switch {
+		case opts.DirectPMTiles:
+			return fmt.Errorf("--direct-pmtiles writes a file and cannot stream to stdout")
+		case opts.KeepNDJSON || opts.EmitCommands != "":
+			return fmt.Errorf("--keep-ndjson and --emit-commands keep files named after --out and cannot be used with --out -")
+		case opts.KeepMBTiles:
+			return fmt.Errorf("--keep-mbtiles keeps a file named after --out and cannot be used with --out -")
+		case opts.QuickPreview:
+			return fmt.Errorf("--quick-preview writes a file named after --out and cannot be used with --out -")
+		}
+	}
+	for _, key := range sortedKeys(opts.Metadata) {
+		if value := opts.Metadata[key]; strings.TrimSpace(value) != "" {
+			if err := tiler.CheckMetadataValue(key, value); err != nil {
+				return fmt.Errorf("tileset metadata: %w", err)
+			}
+		}
+	}
+	for _, format := range opts.ReportFormats {
+		switch format {
+		case ReportHTML, ReportJSON:
+		case ReportNone:
+			if len(opts.ReportFormats) > 1 {
+				return fmt.Errorf("--report-format none cannot be combined with other formats")
+			}
+		default:
+			return fmt.Errorf("unknown --report-format %q (want %s, %s or %s)", format, ReportHTML, ReportJSON, ReportNone)
+		}
+	}
+	// Remote inputs and stdin are checked when they are opened.
+	if !objstore.IsRemote(opts.InputPath) && !input.IsStream(opts.InputPath) {
+		if _, err := os.Stat(opts.InputPath); err != nil {
+			return fmt.Errorf("input file: %w", err)
+		}
+	}
+	switch emptyTilesPolicy(opts.EmptyTiles) {
+	case tiler.EmptyTilesElide:
+	case tiler.EmptyTilesWrite:
+		if opts.DirectPMTiles {
+			return fmt.Errorf("--empty-tiles write needs the MBTiles step and cannot be combined with --direct-pmtiles")
+		}
+	default:
+		return fmt.Errorf("unknown --empty-tiles policy %q (want %s or %s)", opts.EmptyTiles, tiler.EmptyTilesElide, tiler.EmptyTilesWrite)
+	}
+	switch tilerName(opts.Tiler) {
+	case tiler.TilerTippecanoe, tiler.TilerNative:
+	default:
+		return fmt.Errorf("unknown --tiler %q (want %s or %s)", opts.Tiler, tiler.TilerTippecanoe, tiler.TilerNative)
+	}
+	if opts.ZoomCap > tiler.MaxTileZoom {
+		return fmt.Errorf("--zoom-cap %d is above z%d, the deepest zoom tippecanoe generates", opts.ZoomCap, tiler.MaxTileZoom)
+	}
+	if opts.DirectPMTiles {
+		if opts.SkipPMTiles {
+			return fmt.Errorf("--direct-pmtiles and --skip-pmtiles are mutually exclusive")
+		}
+		// tippecanoe picks its output format from the extension.
+		if !strings.EqualFold(filepath.Ext(opts.OutputPMTiles), ".pmtiles") {
+			return fmt.Errorf("--direct-pmtiles needs an output path ending in .pmtiles, got %s", opts.OutputPMTiles)
+		}
 	}
 	return nil
 }
 
+// reservedTippecanoeFlags name the output and inputs, which the build sets itself.
+var reservedTippecanoeFlags = []string{"-o", "--output", "-L", "--named-layer"}
+
+// checkTippecanoeArgs rejects extra tippecanoe arguments that are not flags, which tippecanoe
+// would read as inputs, or that replace the output or inputs of the build.
+func checkTippecanoeArgs(opts Options) error {
+	if len(opts.ExtraTippecanoeArgs) == 0 {
+		return nil
+	}
+	if tilerName(opts.Tiler) == tiler.TilerNative {
+		return fmt.Errorf("--tippecanoe-arg needs --tiler %s", tiler.TilerTippecanoe)
+	}
+	for _, arg := range opts.ExtraTippecanoeArgs {
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("--tippecanoe-arg %q is not a flag; pass values as --flag=value", arg)
+		}
+		flag, _, _ := strings.Cut(arg, "=")
+		if slices.Contains(reservedTippecanoeFlags, flag) {
+			return fmt.Errorf("--tippecanoe-arg %s is set by the build and cannot be overridden", flag)
+		}
+	}
+	return nil
+}
+
+// ndjsonFormat resolves the NDJSON format name, defaulting to ndjson.FormatNDJSON.
+func ndjsonFormat(format string) string {
+	if format == "" {
+		return ndjson.FormatNDJSON
+	}
+	return format
+}
+
+// readParallel reports whether tippecanoe gets --read-parallel: for NDJSON, which always holds
+// one feature per line in a named file, unless an extra argument already sets it or asks for
+// the input order, which parallel reading does not keep.
+func readParallel(opts Options) bool {
+	if tilerName(opts.Tiler) == tiler.TilerNative || ndjsonFormat(opts.NDJSONFormat) != ndjson.FormatNDJSON {
+		return false
+	}
+	for _, arg := range opts.ExtraTippecanoeArgs {
+		switch flag, _, _ := strings.Cut(arg, "="); flag {
+		case "-P", "--read-parallel", "--preserve-input-order":
+			return false
+		}
+	}
+	return true
+}
+
+// keepFile moves a finished intermediate file from the work directory to dst.
+func keepFile(src, dst string) error {
+	if err := removeIfExists(dst); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+func resolutionAllowed(opts Options, resolution int) bool {
+	if opts.MinResolution >= 0 && resolution < opts.MinResolution {
+		return false
+	}
+	if opts.MaxResolution >= 0 && resolution > opts.MaxResolution {
+		return false
+	}
+	return true
+}
+
 func removeIfExists(path string) error {
 	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("remove %s: %w", path, err)
@@ -448,7 +1706,42 @@ func removeIfExists(path string) error {
 	return nil
 }
 
-func deriveZooms(opts Options, report *report.Report) (int, int) {
+// pipelineMetadata records the settings that decide which input rows become features and
+// with what values, so `hexatiles check` can replay them without the report.
+func pipelineMetadata(opts Options, rep *report.Report, cellGrid grid.CellGeometry) map[string]any {
+	return map[string]any{
+		"grid":             cellGrid.Name(),
+		"where":            rep.Config.Where,
+		"quantize":         rep.Config.QuantizeSpec,
+		"min_resolution":   opts.MinResolution,
+		"max_resolution":   opts.MaxResolution,
+		"aggregate":        rep.Config.Aggregate,
+		"dissolve_by":      rep.Config.DissolveBy,
+		"flatten_nested":   opts.FlattenNested,
+		"types":            rep.Config.Types,
+		"value_maps":       absValueMaps(opts.ValueMaps),
+		"nonfinite":        rep.Config.NonFinitePolicy,
+		"reserved_keys":    rep.Config.ReservedKeyPolicy,
+		"string_max_bytes": opts.StringMaxBytes,
+	}
+}
+
+// absValueMaps makes the table paths of --value-map specs absolute, so check can load the
+// tables from another directory.
+func absValueMaps(specs []string) []string {
+	out := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		if target, path, ok := strings.Cut(spec, "="); ok {
+			if abs, err := filepath.Abs(strings.TrimSpace(path)); err == nil {
+				spec = target + "=" + abs
+			}
+		}
+		out = append(out, spec)
+	}
+	return out
+}
+
+func deriveZooms(opts Options, cells *report.Source, cellGrid grid.CellGeometry) (int, int) {
 	minZoom := opts.MinZoom
 	if minZoom < 0 {
 		minZoom = 0
@@ -456,31 +1749,141 @@ func deriveZooms(opts Options, report *report.Report) (int, int) {
 
 	maxZoom := opts.MaxZoom
 	if maxZoom < 0 {
-		maxRes := report.Metrics.MaxResolutionSeen
+		maxRes := cells.Metrics.MaxResolutionSeen
 		if maxRes <= 0 {
 			maxZoom = 12
 		} else {
-			computed := maxRes + 2
-			if computed < 12 {
-				computed = 12
-			}
-			if computed > 15 {
-				computed = 15
-			}
-			maxZoom = computed
+			maxZoom = cellGrid.MaxZoom(maxRes)
 		}
 	}
 
+	zoomCap := zoomCapOf(opts)
+	if minZoom > zoomCap {
+		minZoom = zoomCap
+	}
 	if maxZoom < minZoom {
 		maxZoom = minZoom
 	}
-	if maxZoom > 15 {
-		maxZoom = 15
+	if maxZoom > zoomCap {
+		maxZoom = zoomCap
 	}
 
 	return minZoom, maxZoom
 }
 
+// DefaultZoomCap is deep enough for H3 resolutions 12-13 (see `hexatiles zooms`) while keeping
+// coarse datasets from generating needlessly deep pyramids.
+const DefaultZoomCap = 18
+
+func zoomCapOf(opts Options) int {
+	if opts.ZoomCap <= 0 {
+		return DefaultZoomCap
+	}
+	return opts.ZoomCap
+}
+
+// recordTilesetZooms compares the zoom range written to the tileset at path with the requested
+// one, so the report and the archive metadata always agree.
+func recordTilesetZooms(path string, rep *report.Report) {
+	minZoom, maxZoom, err := tiler.TilesetZoomRange(path)
+	if err != nil {
+		rep.AddWarning(fmt.Sprintf("tileset zoom range: %v", err))
+		return
+	}
+	if maxZoom > rep.Config.MaxZoom {
+		rep.AddWarning(fmt.Sprintf("tippecanoe extended the maximum zoom from z%d to z%d because features were still being dropped", rep.Config.MaxZoom, maxZoom))
+	}
+	rep.Config.MinZoom = minZoom
+	rep.Config.MaxZoom = maxZoom
+}
+
+// checkZoomRange compares an explicit --maxzoom with the zooms that suit the finest H3
+// resolution in the data, warning (or failing with Strict) when it is far outside them.
+func checkZoomRange(opts Options, maxZoom, zoomCap int, cells *report.Source, cellGrid grid.CellGeometry, rep *report.Report) error {
+	if opts.MaxZoom < 0 || cellGrid.Name() != "h3" || len(cells.Metrics.ResolutionHistogram) == 0 {
+		return nil
+	}
+	res := cells.Metrics.MaxResolutionSeen
+	suit, err := h3geom.Suitability(res)
+	if err != nil {
+		return nil
+	}
+	var problem string
+	switch {
+	case maxZoom < suit.MinZoom:
+		problem = fmt.Sprintf("--maxzoom %d is too low for H3 resolution %d: cells are under a pixel across until z%d, so detail is merged away (suggested max zoom z%d-z%d; see `hexatiles zooms`)", maxZoom, res, suit.MinZoom, suit.IdealZoom, min(suit.MaxZoom, zoomCap))
+	case maxZoom > suit.MaxZoom:
+		problem = fmt.Sprintf("--maxzoom %d is too high for H3 resolution %d: past z%d tiles only enlarge the same cells, multiplying tile count without detail (suggested max zoom z%d-z%d; see `hexatiles zooms`)", maxZoom, res, suit.MaxZoom, suit.IdealZoom, suit.MaxZoom)
+	default:
+		return nil
+	}
+	if opts.Strict {
+		return errors.New(problem)
+	}
+	rep.AddWarning(problem)
+	return nil
+}
+
+// excludeUnusableColumns removes null, constant and binary columns from the filter when it
+// would otherwise keep them. Columns named in --props are kept with a warning.
+func excludeUnusableColumns(reader input.Source, filter *props.Filter, rep *report.Report) error {
+	unusable, err := reader.UnusableColumns()
+	if err != nil {
+		return fmt.Errorf("inspect columns: %w", err)
+	}
+	for _, col := range unusable {
+		switch {
+		case filter.Included(col.Name):
+			rep.AddWarning(fmt.Sprintf("column %q is %s but was kept because --props names it", col.Name, col.Reason))
+		case filter.Allows(col.Name):
+			filter.Exclude(col.Name)
+			rep.Metrics.ExcludedColumns = append(rep.Metrics.ExcludedColumns, report.ExcludedColumn{Property: col.Name, Reason: col.Reason})
+		}
+	}
+	return nil
+}
+
+const (
+	// highCardinalityThreshold is the distinct-value estimate above which a kept string
+	// property is reported as bloating tiles.
+	highCardinalityThreshold = 10000
+	cardinalityReportLimit   = 10
+)
+
+// recordCardinality reports the string properties with the most distinct values and warns about
+// those above highCardinalityThreshold, which repeat poorly across features and dominate tile size.
+func recordCardinality(rep *report.Report, summary map[string]props.StringCardinality) {
+	entries := make([]report.StringCardinality, 0, len(summary))
+	for _, key := range sortedKeys(summary) {
+		sc := summary[key]
+		entries = append(entries, report.StringCardinality{Property: key, Distinct: sc.Distinct, Values: sc.Values, Bytes: sc.Bytes})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Distinct > entries[j].Distinct })
+	if len(entries) > cardinalityReportLimit {
+		entries = entries[:cardinalityReportLimit]
+	}
+	rep.Metrics.StringCardinality = entries
+
+	var offenders []string
+	for _, e := range entries {
+		if e.Distinct >= highCardinalityThreshold {
+			offenders = append(offenders, fmt.Sprintf("%s (~%d distinct, %d bytes)", e.Property, e.Distinct, e.Bytes))
+		}
+	}
+	if len(offenders) > 0 {
+		rep.AddWarning(fmt.Sprintf("high-cardinality string properties kept: %s; drop them with --props-drop or bucket them upstream to shrink tiles", strings.Join(offenders, ", ")))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func cloneMap(src map[string]any) map[string]any {
 	if src == nil {
 		return nil
@@ -492,97 +1895,272 @@ func cloneMap(src map[string]any) map[string]any {
 	return dst
 }
 
-func deriveAttributes(f *props.Filter) []string {
-    // Always include system fields used downstream
-    base := []string{"h3", "resolution"}
-    if f == nil {
-        return base
-    }
-    keys := f.Keys()
-    if len(keys) == 0 {
-        return base
-    }
-    out := make([]string, 0, len(base)+len(keys))
-    out = append(out, base...)
-    out = append(out, keys...)
-    return out
+func deriveAttributes(f *props.Filter, idField string) []string {
+	// Always include system fields used downstream
+	base := []string{idField, "resolution"}
+	if f == nil {
+		return base
+	}
+	keys := f.Keys()
+	if len(keys) == 0 {
+		return base
+	}
+	out := make([]string, 0, len(base)+len(keys))
+	out = append(out, base...)
+	out = append(out, keys...)
+	return out
+}
+
+// deriveAttributeTypes maps every attribute that can reach the tiles to the type declared by
+// the input schema, so tippecanoe never guesses a different type from individual values.
+func deriveAttributeTypes(f *props.Filter, schemaTypes map[string]string, idField string) map[string]string {
+	types := map[string]string{
+		idField:      "string",
+		"resolution": "int",
+	}
+	for key, kind := range schemaTypes {
+		if _, system := types[key]; system {
+			continue
+		}
+		if f == nil || f.Allows(key) {
+			types[key] = kind
+		}
+	}
+	return types
+}
+
+// checkConserved requires every --conserve property to be a numeric attribute of the tiles.
+func checkConserved(conserve []string, attributeTypes map[string]string) error {
+	for _, property := range conserve {
+		switch kind, ok := attributeTypes[property]; {
+		case !ok:
+			return fmt.Errorf("conserve property %q is not a kept property of the input", property)
+		case kind != "int" && kind != "float":
+			return fmt.Errorf("conserve property %q must be numeric, got %s", property, kind)
+		}
+	}
+	return nil
+}
+
+// recordConservation copies the native tiler's per-zoom thinning into the report and warns
+// when a conserved total drifted beyond floating point rounding.
+func recordConservation(zooms []tiler.ZoomConservation, rep *report.Report) {
+	for _, z := range zooms {
+		entry := report.ZoomConservation{Zoom: z.Zoom, Features: z.Features, Kept: z.Kept}
+		for _, total := range z.Totals {
+			entry.Totals = append(entry.Totals, report.ConservedTotal{Property: total.Property, Input: total.Input, Tiled: total.Tiled})
+			if drift := math.Abs(total.Tiled - total.Input); drift > 1e-9*math.Max(1, math.Abs(total.Input)) {
+				rep.AddWarning(fmt.Sprintf("z%d: %s totals %g in the tiles but %g in the input", z.Zoom, total.Property, total.Tiled, total.Input))
+			}
+		}
+		rep.Metrics.Conservation = append(rep.Metrics.Conservation, entry)
+	}
 }
 
 type featureResult struct {
 	RowNumber     int64
 	CellString    string
 	Resolution    int
+	Cell          grid.Cell
+	GroupKey      string
 	Feature       ndjson.Feature
 	PropertyBytes int
 	PropertyCount int
 	QuantResult   props.Result
-	Dropped       bool
-	DropReason    string
-	DropDetail    string
-	Err           error
+	NonFinite     []string
+	// ReservedConflicts lists the system fields an input property held another value for.
+	ReservedConflicts []string
+	SanitizedStrings  int
+	CoercionFailures  []props.CoercionFailure
+	Dropped           bool
+	DropReason        string
+	DropDetail        string
+	Err               error
 }
 
-func workerLoop(ctx context.Context, jobs <-chan *parquetreader.Row, results chan<- featureResult, cfg processConfig) {
+// polygonBatchSize caps how many queued rows a worker takes at once so their cells can be
+// polygonized in a single call.
+const polygonBatchSize = 256
+
+func workerLoop(ctx context.Context, id int, jobs <-chan *parquetreader.Row, results chan<- featureResult, cfg processConfig) {
+	stats := workerStats{start: time.Now()}
+	defer cfg.Probe.recordWorker(id, &stats)
+
+	batch := make([]*parquetreader.Row, 0, polygonBatchSize)
 	for {
+		batch = batch[:0]
+		waitStart := time.Now()
 		select {
 		case <-ctx.Done():
 			return
 		case row, ok := <-jobs:
 			if !ok {
+				cfg.Probe.inputDone()
 				return
 			}
-			fr := buildFeature(row, cfg)
+			batch = append(batch, row)
+		}
+		// Take whatever else is already queued without waiting for more.
+	fill:
+		for len(batch) < polygonBatchSize {
+			select {
+			case row, ok := <-jobs:
+				if !ok {
+					cfg.Probe.inputDone()
+					break fill
+				}
+				batch = append(batch, row)
+			default:
+				break fill
+			}
+		}
+
+		busyStart := time.Now()
+		stats.waitInput += busyStart.Sub(waitStart)
+		cfg.Probe.busy.Add(1)
+		built := buildFeatures(batch, cfg)
+		cfg.Probe.busy.Add(-1)
+		sendStart := time.Now()
+		stats.busy += sendStart.Sub(busyStart)
+		stats.rows += int64(len(batch))
+		stats.batches++
+
+		for _, fr := range built {
 			select {
 			case results <- fr:
 			case <-ctx.Done():
 				return
 			}
 		}
+		stats.waitResults += time.Since(sendStart)
 	}
 }
 
+// buildFeatures builds the features of a batch of rows, polygonizing the cells of the rows
+// that survive every filter together.
+func buildFeatures(rows []*parquetreader.Row, cfg processConfig) []featureResult {
+	results := make([]featureResult, len(rows))
+	var pending []int
+	var cells []grid.Cell
+	for i, row := range rows {
+		results[i] = buildFeature(row, cfg)
+		if !results[i].Dropped && results[i].Err == nil {
+			pending = append(pending, i)
+			cells = append(cells, row.Cell)
+		}
+	}
+	if len(cells) == 0 || cfg.Collect != nil {
+		return results
+	}
+
+	polygons, errs := grid.Polygons(cfg.Grid, cells)
+	for j, i := range pending {
+		fr := &results[i]
+		if errs[j] != nil {
+			cfg.Encoder.Release(fr.Feature.EncodedProperties)
+			fr.Feature = ndjson.Feature{}
+			fr.Err = fmt.Errorf("polygonize %s: %w", fr.CellString, errs[j])
+			continue
+		}
+		if err := grid.CheckCoordinates(polygons[j]); err != nil {
+			cfg.Encoder.Release(fr.Feature.EncodedProperties)
+			fr.Feature = ndjson.Feature{}
+			fr.Dropped = true
+			fr.DropReason = "bad_coordinates"
+			fr.DropDetail = err.Error()
+			continue
+		}
+		bound := polygons[j].Bound()
+		fr.Feature.Geometry = polygons[j]
+		fr.Feature.BBox = &bound
+	}
+	return results
+}
+
 func buildFeature(row *parquetreader.Row, cfg processConfig) featureResult {
 	result := featureResult{
 		RowNumber:  row.RowNumber,
 		CellString: row.CellString,
 		Resolution: row.Resolution,
+		Cell:       row.Cell,
 	}
 
 	if row.Err != nil {
 		result.Resolution = -1
 		result.Dropped = true
-		result.DropReason = "invalid_h3"
+		switch {
+		case errors.Is(row.Err, parquetreader.ErrNoH3Column):
+			result.DropReason = "missing_column"
+		case errors.Is(row.Err, parquetreader.ErrNullCell):
+			result.DropReason = "null_cell"
+		default:
+			result.DropReason = "invalid_h3"
+		}
 		result.DropDetail = row.Err.Error()
 		return result
 	}
 
-	if cfg.Options.MinResolution >= 0 && row.Resolution < cfg.Options.MinResolution {
+	if !resolutionAllowed(cfg.Options, row.Resolution) {
 		result.Dropped = true
 		result.DropReason = "resolution"
 		return result
 	}
-	if cfg.Options.MaxResolution >= 0 && row.Resolution > cfg.Options.MaxResolution {
+
+	// The predicate sees the decoded values, before value maps and the property filter.
+	if !cfg.Where.Match(row.Properties) {
 		result.Dropped = true
-		result.DropReason = "resolution"
+		result.DropReason = "where"
+		return result
+	}
+	if cfg.Top != nil && !cfg.Top.Keep(row.Cell, row.Properties) {
+		result.Dropped = true
+		result.DropReason = "top_per_parent"
 		return result
 	}
 
-    propsMap := cloneMap(row.Properties)
-    filtered := propsMap
-    if cfg.Filter != nil {
-        filtered = cfg.Filter.Apply(propsMap)
-    }
+	propsMap := cloneMap(row.Properties)
+	filtered := propsMap
+	if cfg.Filter != nil {
+		filtered = cfg.Filter.Apply(propsMap)
+	}
 	if filtered == nil {
 		filtered = make(map[string]any)
 	}
+	cfg.ValueMaps.Apply(filtered)
+	result.CoercionFailures = cfg.Coercions.Apply(filtered)
+	result.SanitizedStrings = cfg.Sanitizer.Apply(filtered)
+
+	// System fields always included regardless of filter
+	for _, system := range [...]struct {
+		key   string
+		value any
+	}{{cfg.Grid.Name(), row.CellString}, {"resolution", row.Resolution}} {
+		conflict, err := cfg.Reserved.Apply(filtered, system.key, system.value)
+		if err != nil {
+			result.Err = fmt.Errorf("row %d: %w (--reserved-keys %s)", row.RowNumber, err, cfg.Reserved)
+			return result
+		}
+		if conflict {
+			result.ReservedConflicts = append(result.ReservedConflicts, system.key)
+		}
+	}
+	filtered[cfg.Grid.Name()] = row.CellString
+	filtered["resolution"] = row.Resolution
+	if cfg.Extrusion != nil {
+		if value, ok := props.Number(row.Properties[cfg.Extrusion.Property]); ok {
+			filtered[HeightAttribute] = cfg.Extrusion.Height(value)
+		}
+	}
+	for _, c := range cfg.Classes {
+		if value, ok := props.Number(row.Properties[c.Property]); ok {
+			filtered[c.Attribute()] = c.Class(value)
+		}
+	}
 
-    // System fields always included regardless of filter
-    filtered["h3"] = row.CellString
-    filtered["resolution"] = row.Resolution
-
+	result.NonFinite = cfg.NonFinite.Apply(filtered)
 	quantResult := cfg.Quantizer.Apply(filtered)
 
-	propJSON, err := json.Marshal(filtered)
+	propJSON, err := cfg.Encoder.Encode(filtered)
 	if err != nil {
 		result.Err = fmt.Errorf("marshal properties: %w", err)
 		return result
@@ -593,23 +2171,32 @@ func buildFeature(row *parquetreader.Row, cfg processConfig) featureResult {
 	result.QuantResult = quantResult
 
 	if cfg.PropertyCap > 0 && result.PropertyBytes > cfg.PropertyCap {
+		cfg.Encoder.Release(propJSON)
 		result.Dropped = true
 		result.DropReason = "property_cap"
+		if cfg.Drops != nil {
+			// Kept for the sample of the payload that went over the cap.
+			result.Feature.Properties = filtered
+		}
 		return result
 	}
-
-	polygon, err := h3geom.PolygonFromCell(row.Cell)
-	if err != nil {
-		result.Err = fmt.Errorf("polygonize %s: %w", row.CellString, err)
-		return result
+	if cfg.Collect != nil {
+		if result.GroupKey, err = cfg.Collect.key(filtered, cfg); err != nil {
+			cfg.Encoder.Release(propJSON)
+			result.Err = err
+			return result
+		}
 	}
 
-	bound := polygon.Bound()
+	// The geometry is attached by buildFeatures once the batch is polygonized.
 	result.Feature = ndjson.Feature{
-		ID:         row.CellString,
-		Geometry:   polygon,
-		Properties: filtered,
-		BBox:       &bound,
+		ID:                row.CellString,
+		Properties:        filtered,
+		EncodedProperties: propJSON,
+		Zoom:              cfg.Zoom,
+	}
+	if cfg.Adaptive != nil {
+		result.Feature.Zoom = cfg.Adaptive.zoomRange(row.Cell)
 	}
 
 	return result
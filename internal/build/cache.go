@@ -0,0 +1,412 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+
+	"github.com/paulmach/orb/maptile"
+
+	"github.com/hexatiles/hexatiles/internal/input"
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	"github.com/hexatiles/hexatiles/internal/od"
+	"github.com/hexatiles/hexatiles/internal/props"
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// cacheFormat changes whenever what an entry holds changes, so older entries are ignored.
+const cacheFormat = "hexatiles-cache-2"
+
+// Cached stages recorded in report.Metrics.CachedStages.
+const (
+	cachedFeatures = "features"
+	cachedTiles    = "tiles"
+)
+
+// errNotCacheable marks inputs that cannot be hashed up front, such as stdin and remote URLs.
+var errNotCacheable = errors.New("input cannot be hashed")
+
+// buildCache keeps the intermediate files of builds in Options.CacheDir. Entries are
+// directories named after a hash of everything that shapes their content, so an entry is
+// never updated and a changed input or option simply misses:
+//
+//   - features-<key> holds the NDJSON, the arcs NDJSON and a snapshot of the report after the
+//     feature stage, keyed by the input contents and the options;
+//   - tiles-<key> holds what the tiler wrote, keyed by the NDJSON contents and the tiler
+//     options, so a build whose features changed but hash the same still reuses its tiles.
+//
+// Nothing is evicted; remove the directory to reclaim the space.
+type buildCache struct {
+	dir string
+	// featuresKey is empty when the features cannot be cached.
+	featuresKey string
+}
+
+// featuresSnapshot is what the feature stage leaves behind besides the NDJSON.
+type featuresSnapshot struct {
+	Metrics   report.Metrics
+	Sources   []*report.Source
+	Stats     map[string]props.PropertyStats
+	TileStats props.TileStatsLayer
+	Arcs      *od.Result
+	Coverage  *coverageSnapshot
+}
+
+type coverageSnapshot struct {
+	Zoom  maptile.Zoom
+	Tiles [][2]uint32
+}
+
+// tilesSnapshot is what the tiler leaves behind besides the tileset.
+type tilesSnapshot struct {
+	Output       string
+	Conservation []tiler.ZoomConservation
+}
+
+// newBuildCache opens the cache of opts, or returns nil without one. Features are not cached
+// when the inputs cannot be hashed or DebugDrops needs the rows; a warning says why.
+func newBuildCache(opts Options, inputPath string, valueMaps props.ValueMaps, rep *report.Report) (*buildCache, error) {
+	if opts.CacheDir == "" {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(opts.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve cache directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	rep.Config.CacheDir = dir
+	c := &buildCache{dir: dir}
+	if opts.DebugDrops != "" {
+		rep.AddWarning("cache: --debug-drops samples rows as they are read, so the features are rebuilt")
+		return c, nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintln(h, cacheFormat, binaryIdentity())
+	paths := []string{inputPath, opts.ArcsInput}
+	for _, m := range valueMaps {
+		paths = append(paths, m.Path)
+	}
+	for _, path := range paths {
+		if err := hashInput(h, path); err != nil {
+			if errors.Is(err, errNotCacheable) {
+				rep.AddWarning(fmt.Sprintf("cache: %s cannot be hashed up front, so the features are rebuilt", path))
+				return c, nil
+			}
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(featureOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("encode cache key: %w", err)
+	}
+	h.Write(encoded)
+	c.featuresKey = hex.EncodeToString(h.Sum(nil))
+	return c, nil
+}
+
+// featureOptions clears the options that do not shape the NDJSON or the report state saved
+// with it: outputs, reports, tools and tiling.
+func featureOptions(opts Options) Options {
+	saved := opts
+	opts.OutputPMTiles, opts.OutputFormat, opts.SkipPMTiles, opts.DirectPMTiles = "", "", false, false
+	opts.Stdout, opts.Progress = nil, nil
+	opts.KeepNDJSON, opts.KeepMBTiles = false, false
+	opts.Threads, opts.DecodeThreads, opts.EncodeThreads = 0, 0, 0
+	opts.TippecanoePath, opts.PMTilesPath, opts.ExtraTippecanoeArgs = "", "", nil
+	opts.Tiler, opts.EmptyTiles, opts.Metadata = "", "", nil
+	opts.MinZoom, opts.MaxZoom, opts.FeatureLimit, opts.Conserve = 0, 0, 0, nil
+	opts.Strict, opts.CoverageThreshold = false, 0
+	opts.ExpectFile, opts.EmitCommands, opts.Trace, opts.ReportFormats = "", "", "", nil
+	opts.CacheDir = ""
+	opts.Explicit = nil
+	opts.SourceRetries, opts.KeepGoing = 0, false
+	if opts.AdaptiveMaxZoom != "" {
+		// The zoom range written on each feature is counted down from the max zoom.
+		opts.MaxZoom = saved.MaxZoom
+	}
+	return opts
+}
+
+// binaryIdentity names the running build of hexatiles, so a new binary never reads entries an
+// older one wrote. The executable's size and time cover development builds without a version.
+func binaryIdentity() string {
+	identity := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		identity = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				identity += " " + setting.Value
+			}
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			identity += fmt.Sprintf(" %d %d", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return identity
+}
+
+// hashInput adds the contents of a local file, or of every file under a directory in path
+// order, to h. An empty path adds nothing.
+func hashInput(h hash.Hash, path string) error {
+	if path == "" {
+		return nil
+	}
+	if input.IsStream(path) || objstore.IsRemote(path) {
+		return errNotCacheable
+	}
+	return filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("hash input: %w", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(path, name)
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+		return hashFile(h, name)
+	})
+}
+
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("hash input: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+	return nil
+}
+
+// cachesFeatures reports whether the feature stage is restored from and stored in the cache.
+func (c *buildCache) cachesFeatures() bool {
+	return c != nil && c.featuresKey != ""
+}
+
+// restoreFeatures links or copies the cached NDJSON to ndjsonPath and arcsPath and returns the
+// saved snapshot, or nil on a miss.
+func (c *buildCache) restoreFeatures(ndjsonPath, arcsPath string) (*featuresSnapshot, error) {
+	if !c.cachesFeatures() {
+		return nil, nil
+	}
+	entry := filepath.Join(c.dir, "features-"+c.featuresKey)
+	var snapshot featuresSnapshot
+	if !readSnapshot(entry, &snapshot) {
+		return nil, nil
+	}
+	if err := linkOrCopy(filepath.Join(entry, filepath.Base(ndjsonPath)), ndjsonPath); err != nil {
+		return nil, fmt.Errorf("restore cached features: %w", err)
+	}
+	if snapshot.Arcs != nil {
+		if err := linkOrCopy(filepath.Join(entry, filepath.Base(arcsPath)), arcsPath); err != nil {
+			return nil, fmt.Errorf("restore cached arcs: %w", err)
+		}
+	}
+	return &snapshot, nil
+}
+
+// storeFeatures saves the NDJSON and snapshot of a finished feature stage. Failing to is not
+// fatal to the build, so it only warns.
+func (c *buildCache) storeFeatures(ndjsonPath, arcsPath string, snapshot featuresSnapshot, rep *report.Report) {
+	if !c.cachesFeatures() {
+		return
+	}
+	files := map[string]string{filepath.Base(ndjsonPath): ndjsonPath}
+	if snapshot.Arcs != nil {
+		files[filepath.Base(arcsPath)] = arcsPath
+	}
+	if err := writeEntry(filepath.Join(c.dir, "features-"+c.featuresKey), files, snapshot, linkOrCopy); err != nil {
+		rep.AddWarning(fmt.Sprintf("cache features: %v", err))
+	}
+}
+
+// runner wraps the tiler so it reuses a cached tileset for the same NDJSON and options.
+func (c *buildCache) runner(runner tiler.Runner, rep *report.Report) tiler.Runner {
+	if c == nil {
+		return runner
+	}
+	return &cachedRunner{runner: runner, cache: c, rep: rep}
+}
+
+// cachedRunner is a tiler.Runner that looks the tiles up in the cache before running the
+// tiler, and saves what the tiler writes.
+type cachedRunner struct {
+	runner       tiler.Runner
+	cache        *buildCache
+	rep          *report.Report
+	conservation []tiler.ZoomConservation
+}
+
+func (r *cachedRunner) Run(ctx context.Context, inputNDJSON, output string, opts tiler.TippecanoeOptions) (string, []string, error) {
+	key, err := r.key(inputNDJSON, output, opts)
+	if err != nil {
+		r.rep.AddWarning(fmt.Sprintf("cache tiles: %v", err))
+		return r.run(ctx, inputNDJSON, output, opts)
+	}
+	entry := filepath.Join(r.cache.dir, "tiles-"+key)
+	var snapshot tilesSnapshot
+	if readSnapshot(entry, &snapshot) {
+		if err := copyFileTo(output, filepath.Join(entry, "tiles"+filepath.Ext(output))); err == nil {
+			r.conservation = snapshot.Conservation
+			r.rep.Metrics.CachedStages = append(r.rep.Metrics.CachedStages, cachedTiles)
+			var args []string
+			if tippecanoe, ok := r.runner.(*tiler.TippecanoeRunner); ok {
+				args = append([]string{tippecanoe.Binary}, tiler.TippecanoeArgs(inputNDJSON, output, opts)...)
+			}
+			return snapshot.Output, args, nil
+		}
+	}
+
+	log, args, err := r.run(ctx, inputNDJSON, output, opts)
+	if err != nil {
+		return log, args, err
+	}
+	snapshot = tilesSnapshot{Output: log, Conservation: r.conservation}
+	// The build edits the tileset in place afterwards, so the entry holds a copy.
+	files := map[string]string{"tiles" + filepath.Ext(output): output}
+	if err := writeEntry(entry, files, snapshot, func(src, dst string) error { return copyFileTo(dst, src) }); err != nil {
+		r.rep.AddWarning(fmt.Sprintf("cache tiles: %v", err))
+	}
+	return log, args, nil
+}
+
+func (r *cachedRunner) run(ctx context.Context, inputNDJSON, output string, opts tiler.TippecanoeOptions) (string, []string, error) {
+	log, args, err := r.runner.Run(ctx, inputNDJSON, output, opts)
+	if native, ok := r.runner.(*tiler.NativeTiler); ok {
+		r.conservation = native.Conservation()
+	}
+	return log, args, err
+}
+
+// Conservation reports what the tiler, or the cached run, kept of the conserved totals.
+func (r *cachedRunner) Conservation() []tiler.ZoomConservation {
+	return r.conservation
+}
+
+// key hashes the NDJSON inputs, the tiler and its version, and the options with the work
+// directory paths left out.
+func (r *cachedRunner) key(inputNDJSON, output string, opts tiler.TippecanoeOptions) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, cacheFormat, binaryIdentity(), r.rep.Config.Tiler, r.rep.Config.Environment.Tippecanoe, filepath.Ext(output))
+	if err := hashFile(h, inputNDJSON); err != nil {
+		return "", err
+	}
+	layers := slices.Clone(opts.ExtraLayers)
+	for i, layer := range layers {
+		if err := hashFile(h, layer.Path); err != nil {
+			return "", err
+		}
+		layers[i].Path = ""
+	}
+	opts.ExtraLayers = layers
+	opts.Threads = 0
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("encode cache key: %w", err)
+	}
+	h.Write(encoded)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readSnapshot loads the state.json of entry into v, reporting whether the entry exists and
+// is complete.
+func readSnapshot(entry string, v any) bool {
+	buf, err := os.ReadFile(filepath.Join(entry, "state.json"))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(buf, v) == nil
+}
+
+// writeEntry assembles an entry in a temporary directory and renames it into place, so a
+// concurrent or interrupted build never sees half an entry. files maps the names in the entry
+// to their sources, which place links or copies in.
+func writeEntry(entry string, files map[string]string, snapshot any, place func(src, dst string) error) error {
+	if _, err := os.Stat(entry); err == nil {
+		return nil
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(entry), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for name, src := range files {
+		if err := place(src, filepath.Join(tmp, name)); err != nil {
+			return err
+		}
+	}
+	buf, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "state.json"), buf, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, entry); err != nil {
+		// Another build stored the same entry first.
+		if _, statErr := os.Stat(entry); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// linkOrCopy hard-links src to dst, copying when they are on different file systems.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFileTo(dst, src)
+}
+
+func copyFileTo(dst, src string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *tileCoverage) snapshot() *coverageSnapshot {
+	if c == nil {
+		return nil
+	}
+	s := &coverageSnapshot{Zoom: c.zoom, Tiles: make([][2]uint32, 0, len(c.tiles))}
+	for xy := range c.tiles {
+		s.Tiles = append(s.Tiles, xy)
+	}
+	return s
+}
+
+func (s *coverageSnapshot) restore() *tileCoverage {
+	if s == nil {
+		return nil
+	}
+	c := &tileCoverage{zoom: s.Zoom, tiles: make(map[[2]uint32]struct{}, len(s.Tiles))}
+	for _, xy := range s.Tiles {
+		c.tiles[xy] = struct{}{}
+	}
+	return c
+}
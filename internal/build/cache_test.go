@@ -0,0 +1,36 @@
+package build
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestCacheKeepsCoverage builds without the coverage check first, so the cached feature stage
+// must still hold the coverage a later build checks.
+func TestCacheKeepsCoverage(t *testing.T) {
+	dir := t.TempDir()
+	input, _ := e2eCells(t, dir)
+	opts := testOptions(input, filepath.Join(dir, "cells.pmtiles"))
+	opts.MinZoom, opts.MaxZoom = 6, 8
+	opts.CacheDir = filepath.Join(dir, "cache")
+
+	opts.CoverageThreshold = -1
+	if _, err := Run(context.Background(), opts); err != nil {
+		t.Fatalf("first build: %v", err)
+	}
+
+	opts.CoverageThreshold = DefaultCoverageThreshold
+	result, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("second build: %v", err)
+	}
+	rep := result.Report
+	if !slices.Contains(rep.Metrics.CachedStages, cachedFeatures) {
+		t.Fatalf("cached stages %v; want the features restored", rep.Metrics.CachedStages)
+	}
+	if rep.Config.CoverageThreshold != DefaultCoverageThreshold {
+		t.Errorf("coverage threshold %g in the report; want the check run at %g", rep.Config.CoverageThreshold, DefaultCoverageThreshold)
+	}
+}
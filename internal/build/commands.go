@@ -0,0 +1,91 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// commandScript describes the tiling stage of a build in terms of the external tools.
+type commandScript struct {
+	Output     string
+	Tippecanoe string
+	PMTiles    string
+	// TilesPath is what tippecanoe writes: an MBTiles file, or Output with DirectPMTiles.
+	TilesPath string
+	NDJSON    string
+	Options   tiler.TippecanoeOptions
+	Convert   bool
+	Native    bool
+	Empty     bool
+}
+
+// writeCommandScript writes a POSIX shell script that re-runs the tiling stage from the kept
+// NDJSON, so the tippecanoe arguments can be tweaked by hand.
+func writeCommandScript(path string, script commandScript) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Tiling stage of the hexatiles build of %s, generated %s.\n", script.Output, time.Now().Format(time.RFC3339))
+	b.WriteString("# The NDJSON features were kept next to the output; edit the arguments below and re-run.\n")
+	if script.Native {
+		b.WriteString("# This build used the native tiler; these are the equivalent tippecanoe arguments.\n")
+	}
+	if script.Empty {
+		b.WriteString("# --empty-tiles write: hexatiles stored explicit empty tiles afterwards; this script does not.\n")
+	}
+	b.WriteString("set -eu\n\n")
+
+	if script.Options.Threads > 0 {
+		fmt.Fprintf(&b, "TIPPECANOE_MAX_THREADS=%d ", script.Options.Threads)
+	}
+	b.WriteString(shellCommand(script.Tippecanoe, tiler.TippecanoeArgs(script.NDJSON, script.TilesPath, script.Options)))
+	b.WriteString("\n")
+
+	if script.Convert {
+		b.WriteString("\n# hexatiles writes the archive itself and adds its legend metadata under \"hexatiles\";\n")
+		b.WriteString("# pmtiles convert stores the same tiles without it.\n")
+		b.WriteString(shellCommand(script.PMTiles, []string{"convert", script.TilesPath, script.Output}))
+		b.WriteString("\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0o755); err != nil {
+		return fmt.Errorf("write command script: %w", err)
+	}
+	return nil
+}
+
+// shellCommand joins a command line, quoting arguments that the shell would otherwise split or
+// expand. Long argument lists are continued over several lines.
+func shellCommand(binary string, args []string) string {
+	var b strings.Builder
+	b.WriteString(shellQuote(binary))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			b.WriteString(" \\\n  ")
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(shellQuote(arg))
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:=,+@%", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
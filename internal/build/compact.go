@@ -0,0 +1,151 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+)
+
+// Compaction collects the features of the input cells and replaces every complete set of
+// sibling cells with identical properties by their parent, recursively, as H3 CompactCells
+// does. Properties are compared after value maps, classification and quantization, so
+// quantizing coarsely lets more cells merge. The features are held in memory until the input
+// ends; a dataset whose values rarely repeat gains nothing and keeps one group per cell.
+type Compaction struct {
+	index  map[string]int
+	groups []*compactGroup
+}
+
+type compactGroup struct {
+	properties map[string]any
+	zoom       *ndjson.ZoomRange
+	cells      []h3.Cell
+}
+
+func newCompaction(enabled bool, g grid.CellGeometry) (*Compaction, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if g.Name() != "h3" {
+		return nil, fmt.Errorf("--compact needs the h3 grid, not %s", g.Name())
+	}
+	return &Compaction{index: make(map[string]int)}, nil
+}
+
+// key identifies the properties of a feature apart from its cell: the encoded properties
+// without the cell token, prefixed by the resolution, since only cells of one resolution
+// compact together.
+func (c *Compaction) key(properties map[string]any, cfg processConfig) (string, error) {
+	name := cfg.Grid.Name()
+	token, res := properties[name], properties["resolution"]
+	delete(properties, name)
+	delete(properties, "resolution")
+	encoded, err := cfg.Encoder.Encode(properties)
+	properties[name], properties["resolution"] = token, res
+	if err != nil {
+		return "", fmt.Errorf("marshal properties: %w", err)
+	}
+	key := strconv.Itoa(res.(int)) + ":" + string(encoded)
+	cfg.Encoder.Release(encoded)
+	return key, nil
+}
+
+// add files the feature of an input cell under its properties.
+func (c *Compaction) add(fr featureResult) {
+	i, ok := c.index[fr.GroupKey]
+	if !ok {
+		i = len(c.groups)
+		c.index[fr.GroupKey] = i
+		c.groups = append(c.groups, &compactGroup{properties: fr.Feature.Properties, zoom: fr.Feature.Zoom})
+	}
+	c.groups[i].cells = append(c.groups[i].cells, h3.Cell(fr.Cell))
+}
+
+// write compacts every group and writes the resulting cells in cell order.
+func (c *Compaction) write(ctx context.Context, writer *ndjson.Writer, cfg processConfig) error {
+	end := cfg.Trace.Begin(traceBuild, "compact", "features")
+	written, err := c.writeCells(ctx, writer, cfg)
+	if err != nil {
+		return err
+	}
+	cfg.Report.Metrics.CompactedFeatures = written
+	end(map[string]any{"cells": cfg.Source.Metrics.EmittedFeatures, "features": written})
+	return nil
+}
+
+func (c *Compaction) writeCells(ctx context.Context, writer *ndjson.Writer, cfg processConfig) (int64, error) {
+	type compacted struct {
+		cell  h3.Cell
+		group *compactGroup
+	}
+	var out []compacted
+	for _, g := range c.groups {
+		// Rows repeating a cell with the same values collapse; CompactCells rejects duplicates.
+		sort.Slice(g.cells, func(a, b int) bool { return g.cells[a] < g.cells[b] })
+		cells := g.cells[:0]
+		for i, cell := range g.cells {
+			if i == 0 || cell != g.cells[i-1] {
+				cells = append(cells, cell)
+			}
+		}
+		merged, err := h3.CompactCells(cells)
+		if err != nil {
+			return 0, fmt.Errorf("compact cells: %w", err)
+		}
+		for _, cell := range merged {
+			out = append(out, compacted{cell, g})
+		}
+		g.cells = nil
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].cell < out[b].cell })
+
+	var written int64
+	cells := make([]grid.Cell, 0, polygonBatchSize)
+	for start := 0; start < len(out); start += polygonBatchSize {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		batch := out[start:min(start+polygonBatchSize, len(out))]
+		cells = cells[:0]
+		for _, o := range batch {
+			cells = append(cells, grid.Cell(o.cell))
+		}
+		polygons, errs := grid.Polygons(cfg.Grid, cells)
+		for j, o := range batch {
+			token := cfg.Grid.Token(cells[j])
+			if errs[j] != nil {
+				return written, fmt.Errorf("polygonize %s: %w", token, errs[j])
+			}
+			if err := grid.CheckCoordinates(polygons[j]); err != nil {
+				return written, fmt.Errorf("polygonize %s: %w", token, err)
+			}
+			properties := cloneMap(o.group.properties)
+			properties[cfg.Grid.Name()] = token
+			properties["resolution"] = o.cell.Resolution()
+			encoded, err := cfg.Encoder.Encode(properties)
+			if err != nil {
+				return written, fmt.Errorf("marshal properties: %w", err)
+			}
+			bound := polygons[j].Bound()
+			err = writer.WriteFeature(ndjson.Feature{
+				ID:                token,
+				Geometry:          polygons[j],
+				BBox:              &bound,
+				Properties:        properties,
+				EncodedProperties: encoded,
+				Zoom:              o.group.zoom,
+			})
+			cfg.Encoder.Release(encoded)
+			if err != nil {
+				return written, fmt.Errorf("write NDJSON feature: %w", err)
+			}
+			written++
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,132 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+const (
+	// DefaultCoverageThreshold is the share of expected tiles a zoom must contain when
+	// Options.CoverageThreshold is zero.
+	DefaultCoverageThreshold = 0.9
+	// coverageMaxZoom is the finest zoom whose tiles are tracked.
+	coverageMaxZoom = 16
+	// coverageMaxTiles bounds the tiles tracked; past it the tracked zoom drops by one, which
+	// roughly quarters the set.
+	coverageMaxTiles = 1 << 20
+)
+
+// tileCoverage records the tiles holding the center of at least one written feature. Every
+// such tile should be in the tileset at every zoom, since tippecanoe's drop strategies thin
+// features within a tile rather than emptying it. Tiles of coarser zooms follow by halving
+// the coordinates, so only the finest zoom is kept.
+type tileCoverage struct {
+	zoom  maptile.Zoom
+	tiles map[[2]uint32]struct{}
+}
+
+func newTileCoverage(maxZoom int) *tileCoverage {
+	return &tileCoverage{zoom: maptile.Zoom(min(maxZoom, coverageMaxZoom)), tiles: make(map[[2]uint32]struct{})}
+}
+
+// observe records the tile of the center of a feature geometry. It is a no-op on a nil
+// receiver or geometry.
+func (c *tileCoverage) observe(geometry orb.Geometry) {
+	if c == nil || geometry == nil {
+		return
+	}
+	t := maptile.At(geometry.Bound().Center(), c.zoom)
+	c.tiles[[2]uint32{t.X, t.Y}] = struct{}{}
+	for len(c.tiles) > coverageMaxTiles && c.zoom > 0 {
+		c.zoom--
+		coarser := make(map[[2]uint32]struct{}, len(c.tiles)/4)
+		for xy := range c.tiles {
+			coarser[[2]uint32{xy[0] >> 1, xy[1] >> 1}] = struct{}{}
+		}
+		c.tiles = coarser
+	}
+}
+
+// at returns the expected tiles of zoom z, or nil past the tracked zoom.
+func (c *tileCoverage) at(z int) []maptile.Tile {
+	if z < 0 || maptile.Zoom(z) > c.zoom {
+		return nil
+	}
+	shift := uint32(c.zoom) - uint32(z)
+	seen := make(map[[2]uint32]struct{})
+	var tiles []maptile.Tile
+	for xy := range c.tiles {
+		key := [2]uint32{xy[0] >> shift, xy[1] >> shift}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		tiles = append(tiles, maptile.New(key[0], key[1], maptile.Zoom(z)))
+	}
+	return tiles
+}
+
+// checkCoverage compares, per zoom of the tileset at path, the tiles it contains with the
+// tiles holding the input cells, and flags zooms below the coverage threshold: a warning, or an
+// error with Strict. A negative threshold skips the check.
+func checkCoverage(opts Options, path string, coverage *tileCoverage, rep *report.Report) error {
+	threshold := opts.CoverageThreshold
+	if threshold == 0 {
+		threshold = DefaultCoverageThreshold
+	}
+	if coverage == nil || len(coverage.tiles) == 0 || threshold < 0 {
+		return nil
+	}
+	rep.Config.CoverageThreshold = threshold
+
+	var expected []maptile.Tile
+	var zooms, starts []int
+	for z := rep.Config.MinZoom; z <= rep.Config.MaxZoom; z++ {
+		tiles := coverage.at(z)
+		if len(tiles) == 0 {
+			continue
+		}
+		zooms, starts = append(zooms, z), append(starts, len(expected))
+		expected = append(expected, tiles...)
+	}
+	present, err := tiler.TilesPresent(path, expected)
+	if err != nil {
+		rep.AddWarning(fmt.Sprintf("zoom coverage: %v", err))
+		return nil
+	}
+
+	var problems []string
+	for i, z := range zooms {
+		end := len(expected)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		row := report.ZoomCoverage{Zoom: z, Expected: end - starts[i]}
+		for _, ok := range present[starts[i]:end] {
+			if ok {
+				row.Present++
+			}
+		}
+		row.Ratio = float64(row.Present) / float64(row.Expected)
+		rep.Metrics.ZoomCoverage = append(rep.Metrics.ZoomCoverage, row)
+		if row.Ratio < threshold {
+			problems = append(problems, fmt.Sprintf("z%d has %d of the %d tiles holding input cells (%.0f%%, below %.0f%%)", z, row.Present, row.Expected, 100*row.Ratio, 100*threshold))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	problem := "sparse zoom coverage, tiles may have been dropped too aggressively: " + strings.Join(problems, "; ")
+	if opts.Strict {
+		return errors.New(problem)
+	}
+	rep.AddWarning(problem)
+	return nil
+}
@@ -0,0 +1,217 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// DissolveCellsAttribute counts the input cells a dissolved polygon covers.
+const DissolveCellsAttribute = "cells"
+
+// Dissolve unions touching cells that share the values of its properties into one polygon per
+// connected region, holes included. A region carries those values, its resolution and the
+// number of cells it covers; other properties differ between its cells and are not kept.
+// Values are compared after value maps, classification and quantization, so a derived
+// <prop>_class attribute can be dissolved on too. Like Compaction, it holds the cells in
+// memory until the input ends.
+type Dissolve struct {
+	Properties []string
+	index      map[string]int
+	groups     []*dissolveGroup
+}
+
+type dissolveGroup struct {
+	properties map[string]any
+	zoom       *ndjson.ZoomRange
+	cells      []h3.Cell
+}
+
+func newDissolve(properties []string, g grid.CellGeometry) (*Dissolve, error) {
+	if len(properties) == 0 {
+		return nil, nil
+	}
+	if g.Name() != "h3" {
+		return nil, fmt.Errorf("--dissolve-by needs the h3 grid, not %s", g.Name())
+	}
+	seen := make(map[string]bool, len(properties))
+	for _, p := range properties {
+		switch {
+		case p == g.Name() || p == "resolution" || p == DissolveCellsAttribute:
+			return nil, fmt.Errorf("--dissolve-by %s: %s is written by hexatiles and cannot be dissolved on", p, p)
+		case seen[p]:
+			return nil, fmt.Errorf("--dissolve-by lists %s twice", p)
+		}
+		seen[p] = true
+	}
+	return &Dissolve{Properties: properties, index: make(map[string]int)}, nil
+}
+
+// check verifies that every property reaches the features: it is kept by the property filter
+// or derived by --extrude-by or --classify.
+func (d *Dissolve) check(filter *props.Filter, derived []string) error {
+	for _, p := range d.Properties {
+		if filter.Allows(p) || slices.Contains(derived, p) {
+			continue
+		}
+		return fmt.Errorf("--dissolve-by %s: the property is not kept; add it to --props", p)
+	}
+	return nil
+}
+
+// values returns the dissolved properties of a feature with its resolution.
+func (d *Dissolve) values(properties map[string]any) map[string]any {
+	out := make(map[string]any, len(d.Properties)+1)
+	for _, p := range d.Properties {
+		if value, ok := properties[p]; ok {
+			out[p] = value
+		}
+	}
+	out["resolution"] = properties["resolution"]
+	return out
+}
+
+// key encodes the dissolved properties and the resolution; cells of different resolutions
+// never share edges.
+func (d *Dissolve) key(properties map[string]any, cfg processConfig) (string, error) {
+	values := d.values(properties)
+	res := values["resolution"].(int)
+	delete(values, "resolution")
+	encoded, err := cfg.Encoder.Encode(values)
+	if err != nil {
+		return "", fmt.Errorf("marshal properties: %w", err)
+	}
+	key := strconv.Itoa(res) + ":" + string(encoded)
+	cfg.Encoder.Release(encoded)
+	return key, nil
+}
+
+// add files the cell of a feature under its dissolved values.
+func (d *Dissolve) add(fr featureResult) {
+	i, ok := d.index[fr.GroupKey]
+	if !ok {
+		i = len(d.groups)
+		d.index[fr.GroupKey] = i
+		d.groups = append(d.groups, &dissolveGroup{properties: d.values(fr.Feature.Properties), zoom: fr.Feature.Zoom})
+	}
+	d.groups[i].cells = append(d.groups[i].cells, h3.Cell(fr.Cell))
+}
+
+// write splits every group into connected regions and writes one polygon per region.
+func (d *Dissolve) write(ctx context.Context, writer *ndjson.Writer, cfg processConfig) error {
+	end := cfg.Trace.Begin(traceBuild, "dissolve", "features")
+	var written int64
+	for _, g := range d.groups {
+		regions, err := connectedRegions(g.cells)
+		if err != nil {
+			return err
+		}
+		g.cells = nil
+		for _, region := range regions {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			geometry, err := regionGeometry(region)
+			if err != nil {
+				return err
+			}
+			properties := cloneMap(g.properties)
+			properties[DissolveCellsAttribute] = len(region)
+			encoded, err := cfg.Encoder.Encode(properties)
+			if err != nil {
+				return fmt.Errorf("marshal properties: %w", err)
+			}
+			bound := geometry.Bound()
+			err = writer.WriteFeature(ndjson.Feature{
+				ID:                region[0].String(),
+				Geometry:          geometry,
+				BBox:              &bound,
+				Properties:        properties,
+				EncodedProperties: encoded,
+				Zoom:              g.zoom,
+			})
+			cfg.Encoder.Release(encoded)
+			if err != nil {
+				return fmt.Errorf("write NDJSON feature: %w", err)
+			}
+			written++
+		}
+	}
+	cfg.Report.Metrics.DissolvedFeatures = written
+	end(map[string]any{"cells": cfg.Source.Metrics.EmittedFeatures, "features": written})
+	return nil
+}
+
+// connectedRegions splits cells into sets of edge-adjacent cells, each sorted, in the order of
+// their smallest cell. Repeated cells count once.
+func connectedRegions(cells []h3.Cell) ([][]h3.Cell, error) {
+	sort.Slice(cells, func(a, b int) bool { return cells[a] < cells[b] })
+	member := make(map[h3.Cell]bool, len(cells))
+	for _, cell := range cells {
+		member[cell] = true
+	}
+	var regions [][]h3.Cell
+	for _, start := range cells {
+		if !member[start] {
+			continue
+		}
+		delete(member, start)
+		region := []h3.Cell{start}
+		for i := 0; i < len(region); i++ {
+			neighbours, err := region[i].GridDisk(1)
+			if err != nil {
+				return nil, fmt.Errorf("neighbours of %s: %w", region[i], err)
+			}
+			for _, n := range neighbours {
+				if member[n] {
+					delete(member, n)
+					region = append(region, n)
+				}
+			}
+		}
+		sort.Slice(region, func(a, b int) bool { return region[a] < region[b] })
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// regionGeometry outlines a region: a Polygon, or a MultiPolygon in the rare case H3 traces
+// more than one outline, such as cells meeting only at a pentagon.
+func regionGeometry(region []h3.Cell) (orb.Geometry, error) {
+	outlines, err := h3.CellsToMultiPolygon(region)
+	if err != nil {
+		return nil, fmt.Errorf("outline %d cells from %s: %w", len(region), region[0], err)
+	}
+	polygons := make(orb.MultiPolygon, 0, len(outlines))
+	for _, outline := range outlines {
+		polygon := orb.Polygon{loopRing(outline.GeoLoop)}
+		for _, hole := range outline.Holes {
+			polygon = append(polygon, loopRing(hole))
+		}
+		polygons = append(polygons, polygon)
+	}
+	if len(polygons) == 1 {
+		return polygons[0], nil
+	}
+	return polygons, nil
+}
+
+func loopRing(loop h3.GeoLoop) orb.Ring {
+	ring := make(orb.Ring, 0, len(loop)+1)
+	for _, ll := range loop {
+		ring = append(ring, orb.Point{ll.Lng, ll.Lat})
+	}
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+	return ring
+}
@@ -0,0 +1,95 @@
+package build
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// dropSampleLimit caps the rows recorded per drop reason.
+const dropSampleLimit = 20
+
+// dropSamples keeps the first rows dropped for each reason with their full property payload,
+// for Options.DebugDrops. Only property_cap drops carry properties: they show which columns
+// blew the byte budget rather than only the payload size.
+type dropSamples struct {
+	samples []dropSample
+	counts  map[string]int
+}
+
+type dropSample struct {
+	Reason string `json:"reason"`
+	Row    int64  `json:"row"`
+	Cell   string `json:"cell"`
+	Bytes  int    `json:"bytes"`
+	Cap    int    `json:"cap,omitempty"`
+	// Columns lists the encoded size of every property, largest first.
+	Columns    []dropColumn   `json:"columns"`
+	Properties map[string]any `json:"properties"`
+}
+
+type dropColumn struct {
+	Name  string `json:"name"`
+	Bytes int    `json:"bytes"`
+}
+
+func newDropSamples() *dropSamples {
+	return &dropSamples{counts: make(map[string]int)}
+}
+
+// add records fr, dropped for a property cap of limit bytes, unless its reason has enough
+// samples already. It is a no-op on a nil receiver.
+func (d *dropSamples) add(fr featureResult, limit int) {
+	if d == nil || fr.DropReason != "property_cap" || d.counts[fr.DropReason] >= dropSampleLimit {
+		return
+	}
+	d.counts[fr.DropReason]++
+	sample := dropSample{
+		Reason:     fr.DropReason,
+		Row:        fr.RowNumber,
+		Cell:       fr.CellString,
+		Bytes:      fr.PropertyBytes,
+		Cap:        limit,
+		Columns:    make([]dropColumn, 0, len(fr.Feature.Properties)),
+		Properties: fr.Feature.Properties,
+	}
+	for name, value := range fr.Feature.Properties {
+		key, _ := json.Marshal(name)
+		encoded, _ := json.Marshal(value)
+		// "name":value plus the separating comma.
+		sample.Columns = append(sample.Columns, dropColumn{Name: name, Bytes: len(key) + len(encoded) + 2})
+	}
+	slices.SortFunc(sample.Columns, func(a, b dropColumn) int {
+		if c := cmp.Compare(b.Bytes, a.Bytes); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	d.samples = append(d.samples, sample)
+}
+
+// writeFile writes the samples to path as NDJSON, one dropped row per line in input order.
+func (d *dropSamples) writeFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create drop samples: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, sample := range d.samples {
+		if err := enc.Encode(sample); err != nil {
+			return fmt.Errorf("encode drop sample: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write drop samples: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close drop samples: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// The stub tools re-execute the test binary, which acts as the tool before running any test.
+func TestMain(m *testing.M) {
+	tiler.RunFakeTool()
+	os.Exit(m.Run())
+}
+
+// e2eCells writes an NDJSON input of the cells within two steps of a resolution 8 cell, each
+// scored by its position, and returns its path with the score of every cell.
+func e2eCells(t *testing.T, dir string) (string, map[string]float64) {
+	t.Helper()
+	cells, err := h3.GridDisk(h3.Cell(h3.IndexFromString("8828308281fffff")), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := make(map[string]float64, len(cells))
+	var lines strings.Builder
+	for i, c := range cells {
+		scores[c.String()] = float64(i) + 0.5
+		fmt.Fprintf(&lines, "{\"h3\": %q, \"score\": %g}\n", c.String(), scores[c.String()])
+	}
+	path := filepath.Join(dir, "cells.ndjson")
+	if err := os.WriteFile(path, []byte(lines.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, scores
+}
+
+// e2eOptions builds input with tippecanoe and pmtiles resolved to tools, from z6 to z10.
+func e2eOptions(input, output string, tools tiler.FakeTools) Options {
+	opts := testOptions(input, output)
+	opts.Tiler = tiler.TilerTippecanoe
+	opts.TippecanoePath, opts.PMTilesPath = tools.Tippecanoe, tools.PMTiles
+	opts.MinZoom, opts.MaxZoom = 6, 10
+	opts.PropertyInclude = []string{"score"}
+	return opts
+}
+
+func installFakeTools(t *testing.T) tiler.FakeTools {
+	t.Helper()
+	tools, err := tiler.InstallFakeTools(filepath.Join(t.TempDir(), "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tools
+}
+
+func TestFakeToolsBuildPMTiles(t *testing.T) {
+	dir := t.TempDir()
+	input, scores := e2eCells(t, dir)
+	output := filepath.Join(dir, "out", "cells.pmtiles")
+
+	result, err := Run(context.Background(), e2eOptions(input, output, installFakeTools(t)))
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if result.OutputPath != output || result.PMTilesPath != output {
+		t.Errorf("output %q, PMTiles %q; want %q", result.OutputPath, result.PMTilesPath, output)
+	}
+	if result.FeatureCount != int64(len(scores)) || result.DroppedCount != 0 {
+		t.Errorf("%d features, %d dropped; want %d, 0", result.FeatureCount, result.DroppedCount, len(scores))
+	}
+	env := result.Report.Config.Environment
+	if !strings.Contains(env.Tippecanoe, tiler.FakeToolVersion) || !strings.Contains(env.PMTiles, tiler.FakeToolVersion) {
+		t.Errorf("tool versions %q, %q; want the fake tools", env.Tippecanoe, env.PMTiles)
+	}
+	if info := result.Report.Metrics.PMTilesInfo; info == nil || info["metadata"] == nil {
+		t.Errorf("pmtiles info --json was not recorded: %v", info)
+	}
+
+	archive, err := tiler.OpenPMTiles(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if h := archive.Header(); h.MinZoom != 6 || h.MaxZoom != 10 {
+		t.Errorf("zooms %d-%d, want 6-10", h.MinZoom, h.MaxZoom)
+	}
+	metadata, err := archive.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metadata["hexatiles"]; !ok {
+		t.Errorf("metadata has no hexatiles key: %v", metadata)
+	}
+
+	seen := make(map[string]bool)
+	err = archive.WalkZoom(10, func(z, x, y int, data []byte) error {
+		layers, err := mvt.UnmarshalGzipped(data)
+		if err != nil {
+			if layers, err = mvt.Unmarshal(data); err != nil {
+				return err
+			}
+		}
+		for _, layer := range layers {
+			for _, feature := range layer.Features {
+				cell, _ := feature.Properties["h3"].(string)
+				score, ok := feature.Properties["score"].(float64)
+				if want, known := scores[cell]; !known || !ok || score != want {
+					return fmt.Errorf("tile %d/%d/%d: feature %v, want one of the input cells with its score", z, x, y, feature.Properties)
+				}
+				seen[cell] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(scores) {
+		t.Errorf("z10 holds %d of the %d input cells", len(seen), len(scores))
+	}
+}
+
+func TestFakeToolsSkipPMTiles(t *testing.T) {
+	dir := t.TempDir()
+	input, _ := e2eCells(t, dir)
+	opts := e2eOptions(input, filepath.Join(dir, "cells.pmtiles"), installFakeTools(t))
+	opts.SkipPMTiles = true
+
+	result, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	want := filepath.Join(dir, "cells.mbtiles")
+	if result.OutputPath != want || result.PMTilesPath != "" {
+		t.Errorf("output %q, PMTiles %q; want %q and none", result.OutputPath, result.PMTilesPath, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cells.pmtiles")); !os.IsNotExist(err) {
+		t.Errorf("a PMTiles archive was written: %v", err)
+	}
+}
+
+// TestFakeToolsEnv resolves the tools through FakeToolsEnv alone, as `make e2e` does.
+func TestFakeToolsEnv(t *testing.T) {
+	t.Setenv(tiler.FakeToolsEnv, "1")
+	t.Setenv("TIPPECANOE_PATH", "")
+	t.Setenv("PMTILES_PATH", "")
+	dir := t.TempDir()
+	input, scores := e2eCells(t, dir)
+
+	result, err := Run(context.Background(), e2eOptions(input, filepath.Join(dir, "cells.pmtiles"), tiler.FakeTools{}))
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if !strings.Contains(result.Report.Config.Environment.Tippecanoe, tiler.FakeToolVersion) {
+		t.Errorf("tippecanoe %q; want the fake tool", result.Report.Config.Environment.Tippecanoe)
+	}
+	if result.FeatureCount != int64(len(scores)) {
+		t.Errorf("%d features, want %d", result.FeatureCount, len(scores))
+	}
+}
+
+// TestFakeToolsInvalidCells checks that a row with an invalid cell is dropped with a warning
+// rather than failing the build.
+func TestFakeToolsInvalidCells(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "invalid.ndjson")
+	if err := os.WriteFile(input, []byte("{\"h3\": \"8828308281fffff\", \"score\": 1}\n{\"h3\": \"not a cell\", \"score\": 2}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(context.Background(), e2eOptions(input, filepath.Join(dir, "cells.pmtiles"), installFakeTools(t)))
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if result.FeatureCount != 1 || result.DroppedCount != 1 {
+		t.Errorf("%d features, %d dropped; want 1, 1", result.FeatureCount, result.DroppedCount)
+	}
+	if warnings := strings.Join(result.Report.Metrics.Warnings, "\n"); !strings.Contains(warnings, "not a cell") {
+		t.Errorf("no warning names the invalid cell: %s", warnings)
+	}
+}
+
+func TestFakeToolsErrors(t *testing.T) {
+	tools := installFakeTools(t)
+	dir := t.TempDir()
+	input, _ := e2eCells(t, dir)
+
+	for _, tc := range []struct {
+		name  string
+		setup func(*Options)
+		want  string
+	}{
+		{"missing input", func(o *Options) { o.InputPath = filepath.Join(dir, "missing.ndjson") }, "missing.ndjson"},
+		{"unknown input format", func(o *Options) { o.InputFormat = "shapefile" }, "shapefile"},
+		{"tippecanoe not found", func(o *Options) { o.TippecanoePath = filepath.Join(dir, "no-such-tippecanoe") }, "tippecanoe CLI not found"},
+		{"tippecanoe fails", func(o *Options) { o.TippecanoePath = failingTool(t, dir) }, "tippecanoe failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "cells.pmtiles")
+			opts := e2eOptions(input, output, tools)
+			tc.setup(&opts)
+			_, err := Run(context.Background(), opts)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error %v; want one mentioning %q", err, tc.want)
+			}
+			if _, statErr := os.Stat(output); !os.IsNotExist(statErr) {
+				t.Errorf("%s was left behind after the failed build", output)
+			}
+		})
+	}
+}
+
+// failingTool writes a stub that runs the test binary as an unknown fake tool, which prints
+// an error and exits 1.
+func failingTool(t *testing.T, dir string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the failing stub is a shell script")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "failing-tippecanoe")
+	script := fmt.Sprintf("#!/bin/sh\nHEXATILES_FAKE_TOOL=failing exec '%s' \"$@\"\n", exe)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
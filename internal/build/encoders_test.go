@@ -0,0 +1,198 @@
+package build
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// encoderZoom is deep enough that no two vertices of a resolution 8 or 10 cell snap together.
+const encoderZoom = 13
+
+// tileRing is how one encoder wrote the exterior ring of a cell.
+type tileRing struct {
+	vertices  int  // distinct vertices
+	clockwise bool // in tile coordinates, y down, as MVT requires of exterior rings
+}
+
+// TestEncodersAgreeOnRings builds the same cells with the native encoder and with tippecanoe
+// and checks that every cell lying wholly inside a tile has a clockwise exterior ring with the
+// cell's vertex count in both. Without tippecanoe on PATH or in TIPPECANOE_PATH only the native
+// half runs.
+func TestEncodersAgreeOnRings(t *testing.T) {
+	origin := h3.Cell(h3.IndexFromString("8828308281fffff"))
+	cells, err := h3.GridDisk(origin, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A pentagon's neighbourhood, so five-vertex rings are covered too.
+	pentagon := h3.Cell(h3.IndexFromString("8a0800000007fff"))
+	around, err := h3.GridDisk(pentagon, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells = append(cells, around...)
+
+	want := make(map[string]int, len(cells))
+	var lines []string
+	for _, c := range cells {
+		boundary, err := c.Boundary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[c.String()] = len(boundary)
+		lines = append(lines, c.String())
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "cells.txt")
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	native := encodeRings(t, input, filepath.Join(dir, "native.pmtiles"), tiler.TilerNative, "")
+	checkRings(t, "native", native, want)
+	if native[pentagon.String()].vertices != 5 {
+		t.Fatalf("pentagon %s was not checked: %+v", pentagon, native[pentagon.String()])
+	}
+
+	tippecanoe := os.Getenv("TIPPECANOE_PATH")
+	if tippecanoe == "" {
+		tippecanoe, _ = exec.LookPath("tippecanoe")
+	}
+	if tippecanoe == "" {
+		t.Skip("tippecanoe not installed; checked the native encoder only")
+	}
+	other := encodeRings(t, input, filepath.Join(dir, "tippecanoe.pmtiles"), tiler.TilerTippecanoe, tippecanoe)
+	checkRings(t, "tippecanoe", other, want)
+	for cell, ring := range native {
+		if got, ok := other[cell]; ok && got != ring {
+			t.Errorf("cell %s: native ring %+v, tippecanoe ring %+v", cell, ring, got)
+		}
+	}
+}
+
+// encodeRings builds input with the given tiler and returns the exterior ring of each cell that
+// lies wholly inside one of the tiles at encoderZoom, keyed by its h3 attribute.
+func encodeRings(t *testing.T, input, output, tilerName, tippecanoePath string) map[string]tileRing {
+	t.Helper()
+	opts := testOptions(input, output)
+	opts.Tiler, opts.TippecanoePath = tilerName, tippecanoePath
+	opts.MinZoom, opts.MaxZoom = encoderZoom, encoderZoom
+	if _, err := Run(context.Background(), opts); err != nil {
+		t.Fatalf("%s build: %v", tilerName, err)
+	}
+	archive, err := tiler.OpenPMTiles(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	rings := make(map[string]tileRing)
+	err = archive.WalkZoom(encoderZoom, func(z, x, y int, data []byte) error {
+		layers, err := mvt.UnmarshalGzipped(data)
+		if err != nil {
+			if layers, err = mvt.Unmarshal(data); err != nil {
+				return err
+			}
+		}
+		for _, layer := range layers {
+			for _, feature := range layer.Features {
+				cell, _ := feature.Properties["h3"].(string)
+				polygon, ok := feature.Geometry.(orb.Polygon)
+				if cell == "" || !ok || !insideTile(polygon[0], layer.Extent) {
+					continue
+				}
+				if _, seen := rings[cell]; seen {
+					continue
+				}
+				rings[cell] = tileRing{vertices: distinctVertices(polygon[0]), clockwise: tileArea(polygon[0]) > 0}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read %s: %v", output, err)
+	}
+	return rings
+}
+
+// testOptions returns the options of `hexatiles build --in input --out output` with the
+// command's flag defaults, writing no report.
+func testOptions(input, output string) Options {
+	return Options{
+		InputPath:         input,
+		OutputPMTiles:     output,
+		OutputFormat:      FormatPMTiles,
+		Grid:              "h3",
+		Tiler:             tiler.TilerNative,
+		ZoomCap:           DefaultZoomCap,
+		CoverageThreshold: DefaultCoverageThreshold,
+		MinZoom:           -1,
+		MaxZoom:           -1,
+		MinResolution:     -1,
+		MaxResolution:     -1,
+		NonFinite:         "null",
+		ReservedKeys:      "rename",
+		PropertyByteCap:   2048,
+		ReportFormats:     []string{"none"},
+	}
+}
+
+func checkRings(t *testing.T, encoder string, got map[string]tileRing, want map[string]int) {
+	t.Helper()
+	if len(got) == 0 {
+		t.Fatalf("%s: no cell lies wholly inside a tile", encoder)
+	}
+	var cells []string
+	for cell := range got {
+		cells = append(cells, cell)
+	}
+	sort.Strings(cells)
+	for _, cell := range cells {
+		ring := got[cell]
+		if !ring.clockwise {
+			t.Errorf("%s: cell %s exterior ring is counter-clockwise in tile coordinates", encoder, cell)
+		}
+		if n, ok := want[cell]; !ok || ring.vertices != n {
+			t.Errorf("%s: cell %s has %d vertices, want %d", encoder, cell, ring.vertices, n)
+		}
+	}
+}
+
+// insideTile reports whether ring stays within the tile's extent, so no encoder clipped it.
+func insideTile(ring orb.Ring, extent uint32) bool {
+	for _, p := range ring {
+		if p[0] <= 0 || p[1] <= 0 || p[0] >= float64(extent) || p[1] >= float64(extent) {
+			return false
+		}
+	}
+	return true
+}
+
+func distinctVertices(ring orb.Ring) int {
+	n := len(ring)
+	if n > 1 && ring[0] == ring[n-1] {
+		n--
+	}
+	return n
+}
+
+// tileArea is twice the shoelace area of ring; positive is clockwise with y pointing down.
+func tileArea(ring orb.Ring) float64 {
+	var area float64
+	for i := range ring {
+		p, q := ring[i], ring[(i+1)%len(ring)]
+		area += p[0]*q[1] - q[0]*p[1]
+	}
+	return area
+}
@@ -0,0 +1,27 @@
+package build
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// captureEnvironment records the machine and tool versions for the report. Probes that fail
+// leave their field empty rather than failing the build.
+func captureEnvironment(ctx context.Context, outDir string, runner tiler.Runner, converter *tiler.PMTilesConverter) report.Environment {
+	env := report.Environment{
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		CPUs:            runtime.NumCPU(),
+		MemoryAvailable: availableMemory(),
+		GoVersion:       runtime.Version(),
+		PMTiles:         converter.Version(ctx),
+		Disk:            diskType(outDir),
+	}
+	if tippecanoe, ok := runner.(*tiler.TippecanoeRunner); ok {
+		env.Tippecanoe = tippecanoe.Version(ctx)
+	}
+	return env
+}
@@ -0,0 +1,81 @@
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// availableMemory reads MemAvailable from /proc/meminfo, in bytes.
+func availableMemory() int64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// diskType reports ssd or hdd from the rotational flag of the block device holding dir, and
+// the filesystem type for storage without one (network mounts, tmpfs, overlay).
+func diskType(dir string) string {
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return ""
+	}
+	device := fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		// Partitions keep their queue settings on the parent disk.
+		if _, err := os.Stat(filepath.Join(resolved, "partition")); err == nil {
+			resolved = filepath.Dir(resolved)
+		}
+		if raw, err := os.ReadFile(filepath.Join(resolved, "queue", "rotational")); err == nil {
+			if strings.TrimSpace(string(raw)) == "1" {
+				return "hdd"
+			}
+			return "ssd"
+		}
+	}
+	return mountType(dir)
+}
+
+// mountType returns the filesystem type of the deepest mount point containing dir.
+func mountType(dir string) string {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	var best, kind string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mount := fields[1]
+		if dir != mount && !strings.HasPrefix(dir, strings.TrimSuffix(mount, "/")+"/") {
+			continue
+		}
+		if len(mount) >= len(best) {
+			best, kind = mount, fields[2]
+		}
+	}
+	return kind
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package build
+
+// availableMemory is not determined on this platform.
+func availableMemory() int64 { return 0 }
+
+// diskType is not determined on this platform.
+func diskType(string) string { return "" }
@@ -0,0 +1,71 @@
+package build
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/expect"
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// expectationMetrics are the report values that --expect assertions can reference. Row counts
+// combine every source; sizes are bytes and durations seconds.
+var expectationMetrics = map[string]func(*report.Report) float64{
+	"total_rows":              func(r *report.Report) float64 { return float64(r.Metrics.TotalRows) },
+	"emitted_features":        func(r *report.Report) float64 { return float64(r.Metrics.EmittedFeatures) },
+	"dropped_features":        func(r *report.Report) float64 { return float64(r.Metrics.TotalRows - r.Metrics.EmittedFeatures) },
+	"dropped_invalid_h3":      func(r *report.Report) float64 { return float64(r.Metrics.DroppedInvalid) },
+	"dropped_bad_coordinates": func(r *report.Report) float64 { return float64(r.Metrics.DroppedBadCoordinates) },
+	"dropped_null_cell":       func(r *report.Report) float64 { return float64(r.Metrics.DroppedNullCell) },
+	"dropped_missing_column":  func(r *report.Report) float64 { return float64(r.Metrics.DroppedMissingColumn) },
+	"dropped_resolution":      func(r *report.Report) float64 { return float64(r.Metrics.DroppedResolution) },
+	"dropped_where":           func(r *report.Report) float64 { return float64(r.Metrics.DroppedWhere) },
+	"dropped_top_per_parent":  func(r *report.Report) float64 { return float64(r.Metrics.DroppedTopPerParent) },
+	"dropped_property_cap":    func(r *report.Report) float64 { return float64(r.Metrics.DroppedPropertyCap) },
+	"dropped_other":           func(r *report.Report) float64 { return float64(r.Metrics.DroppedOther) },
+	"merged_rows":             func(r *report.Report) float64 { return float64(r.Metrics.MergedRows) },
+	"rollup_features":         func(r *report.Report) float64 { return float64(rollupCount(r.Metrics.PyramidLevels)) },
+	"compacted_features":      func(r *report.Report) float64 { return float64(r.Metrics.CompactedFeatures) },
+	"dissolved_features":      func(r *report.Report) float64 { return float64(r.Metrics.DissolvedFeatures) },
+	"sanitized_strings":       func(r *report.Report) float64 { return float64(r.Metrics.SanitizedStrings) },
+	"warnings":                func(r *report.Report) float64 { return float64(len(r.Metrics.Warnings)) },
+	"output_size":             func(r *report.Report) float64 { return float64(r.Metrics.OutputSize) },
+	"pmtiles_size":            func(r *report.Report) float64 { return float64(r.Metrics.PMTilesSize) },
+	"mbtiles_size":            func(r *report.Report) float64 { return float64(r.Metrics.MBTilesSize) },
+	"ndjson_size":             func(r *report.Report) float64 { return float64(r.Metrics.NDJSONSize) },
+	"empty_tiles_elided":      func(r *report.Report) float64 { return float64(r.Metrics.EmptyTilesElided) },
+	"empty_tiles_written":     func(r *report.Report) float64 { return float64(r.Metrics.EmptyTilesWritten) },
+	"dedup_ratio":             func(r *report.Report) float64 { return r.Metrics.DedupRatio },
+	"duration":                func(r *report.Report) float64 { return r.Metrics.Duration.Seconds() },
+}
+
+func expectationMetricNames() []string {
+	names := make([]string, 0, len(expectationMetrics))
+	for name := range expectationMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkExpectations records the outcome of every expectation in the report and returns an error
+// listing the failures, if any.
+func checkExpectations(rep *report.Report, expectations []expect.Expectation) error {
+	var failed []string
+	for _, e := range expectations {
+		res := e.Check(expectationMetrics[e.Metric](rep))
+		rep.Metrics.Expectations = append(rep.Metrics.Expectations, report.Expectation{
+			Expr:   res.Expr,
+			Actual: res.Actual,
+			Passed: res.Passed,
+		})
+		if !res.Passed {
+			failed = append(failed, fmt.Sprintf("%s (actual %g)", res.Expr, res.Actual))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d expectations failed: %s", len(failed), len(expectations), strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package build
+
+import (
+	"fmt"
+	"math"
+)
+
+// HeightAttribute is the feature property written by --extrude-by, in meters.
+const HeightAttribute = "height"
+
+// defaultExtrudeScale is the height in meters given to the largest value.
+const defaultExtrudeScale = 1000
+
+// Extrusion normalizes a numeric property into HeightAttribute for fill-extrusion styling.
+type Extrusion struct {
+	Property string
+	Scale    float64
+	Min      float64
+	Max      float64
+}
+
+// Height maps value linearly from [Min, Max] onto [0, Scale]. When every value is equal the
+// full scale is used so features remain visible.
+func (e *Extrusion) Height(value float64) float64 {
+	if e.Max <= e.Min {
+		return e.Scale
+	}
+	return (value - e.Min) / (e.Max - e.Min) * e.Scale
+}
+
+// Metadata returns the extrusion description recorded in the PMTiles metadata.
+func (e *Extrusion) Metadata() map[string]any {
+	return map[string]any{
+		"attribute": HeightAttribute,
+		"property":  e.Property,
+		"min":       e.Min,
+		"max":       e.Max,
+		"scale":     e.Scale,
+	}
+}
+
+func newExtrusion(opts Options) (*Extrusion, error) {
+	scale := opts.ExtrudeScale
+	if scale == 0 {
+		scale = defaultExtrudeScale
+	}
+	if scale < 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		return nil, fmt.Errorf("extrude scale must be a positive number, got %v", opts.ExtrudeScale)
+	}
+	return &Extrusion{Property: opts.ExtrudeBy, Scale: scale, Min: math.Inf(1), Max: math.Inf(-1)}, nil
+}
+
+func (e *Extrusion) observe(value float64) {
+	e.Min = math.Min(e.Min, value)
+	e.Max = math.Max(e.Max, value)
+}
@@ -0,0 +1,80 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrBuildInProgress reports that another process holds the lock on the output path.
+var ErrBuildInProgress = errors.New("build already in progress")
+
+// outputLock is an advisory lock on an output path, held through a <output>.lock file that
+// records the owning PID. The operating system drops the lock when its holder exits, so a
+// crashed build never leaves a stale lock behind.
+type outputLock struct {
+	path string
+	file *os.File
+}
+
+// lockOutput takes the lock for output without waiting, failing with ErrBuildInProgress and
+// the owner's PID when another build holds it.
+func lockOutput(output string) (*outputLock, error) {
+	path := output + ".lock"
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open lock file: %w", err)
+		}
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if !locked {
+			owner := readLockOwner(file)
+			file.Close()
+			if owner > 0 {
+				return nil, fmt.Errorf("%w for %s (pid %d holds %s)", ErrBuildInProgress, output, owner, path)
+			}
+			return nil, fmt.Errorf("%w for %s (%s is held)", ErrBuildInProgress, output, path)
+		}
+
+		// The previous holder removes the file on release; if that happened between our open
+		// and lock, we locked an unlinked file and must start over.
+		held, statErr := file.Stat()
+		current, err := os.Stat(path)
+		if statErr != nil || err != nil || !os.SameFile(held, current) {
+			file.Close()
+			continue
+		}
+
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("write lock file: %w", err)
+		}
+		if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("write lock file: %w", err)
+		}
+		return &outputLock{path: path, file: file}, nil
+	}
+}
+
+// Release removes the lock file and drops the lock.
+func (l *outputLock) Release() {
+	os.Remove(l.path)
+	l.file.Close()
+}
+
+func readLockOwner(file *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
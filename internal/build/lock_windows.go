@@ -0,0 +1,25 @@
+//go:build windows
+
+package build
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffset places the locked byte far past the PID so other processes can still read it;
+// Windows locks are mandatory for the locked range.
+const lockOffset = 1 << 30
+
+// tryLockFile takes an exclusive LockFileEx lock on file, reporting false when another process
+// holds it.
+func tryLockFile(file *os.File) (bool, error) {
+	overlapped := &windows.Overlapped{Offset: lockOffset}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,209 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hexatiles/hexatiles/internal/classify"
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/input"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/props"
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// prescanResult holds what must be known about the whole dataset before features are written.
+type prescanResult struct {
+	Extrusion       *Extrusion
+	Classifications []*classify.Classification
+	TopPerParent    *TopPerParent
+	// Adaptive holds the cell counts per region; the build finishes it once the pyramid is
+	// known.
+	Adaptive *AdaptiveZoom
+}
+
+// Metadata returns the entries recorded under "hexatiles" in the PMTiles metadata.
+func (r *prescanResult) Metadata() map[string]any {
+	meta := make(map[string]any)
+	if r.Extrusion != nil {
+		meta["extrusion"] = r.Extrusion.Metadata()
+	}
+	if len(r.Classifications) > 0 {
+		classes := make(map[string]any, len(r.Classifications))
+		for _, c := range r.Classifications {
+			classes[c.Property] = c.Metadata()
+		}
+		meta["classes"] = classes
+	}
+	if r.TopPerParent != nil {
+		meta["top_per_parent"] = r.TopPerParent.Metadata()
+	}
+	if r.Adaptive != nil {
+		meta["adaptive_maxzoom"] = r.Adaptive.Metadata()
+	}
+	return meta
+}
+
+// prescan reads the input once ahead of the main pass when --extrude-by, --classify or
+// --top-per-parent need the range or distribution of a property, or --adaptive-maxzoom the
+// density of the cells. Only rows that pass the resolution filter and --where are counted, and
+// --adaptive-maxzoom counts only those --top-per-parent keeps. With --aggregate, the rows of
+// each cell are merged first, so ranges and rankings describe the features the build writes.
+// The options are checked once; only failures to open or read the input are retried, up to
+// opts.SourceRetries times, and counted on src.
+func prescan(ctx context.Context, path, format string, opts Options, specs []classify.Spec, where *props.Where, agg *Aggregation, cellGrid grid.CellGeometry, threads int, src *report.Source) (*prescanResult, error) {
+	top, err := parseTopPerParent(opts.TopPerParent, cellGrid)
+	if err != nil {
+		return nil, err
+	}
+	adaptive, err := parseAdaptiveZoom(opts.AdaptiveMaxZoom, cellGrid)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ExtrudeBy == "" && len(specs) == 0 && top == nil && adaptive == nil {
+		return &prescanResult{}, nil
+	}
+	if input.IsStream(path) {
+		return nil, fmt.Errorf("--extrude-by, --classify, --top-per-parent and --adaptive-maxzoom read the input twice and cannot be used with --in %s", path)
+	}
+
+	var res *prescanResult
+	err = attemptSource(ctx, src, opts.SourceRetries, func() (err error) {
+		top.reset()
+		adaptive.reset()
+		res, err = scanInput(ctx, path, format, opts, specs, where, agg, cellGrid, threads, top, adaptive)
+		return err
+	})
+	return res, err
+}
+
+// scanInput is one prescan pass over the input, observing the rows into top and adaptive.
+func scanInput(ctx context.Context, path, format string, opts Options, specs []classify.Spec, where *props.Where, agg *Aggregation, cellGrid grid.CellGeometry, threads int, top *TopPerParent, adaptive *AdaptiveZoom) (*prescanResult, error) {
+	res := &prescanResult{}
+	columns := make([]string, 0, len(specs)+2)
+	if opts.ExtrudeBy != "" {
+		columns = append(columns, opts.ExtrudeBy)
+	}
+	for _, spec := range specs {
+		columns = append(columns, spec.Property)
+	}
+	if top != nil {
+		columns = append(columns, top.By)
+	}
+	columns = append(columns, where.Properties()...)
+	columns = append(columns, agg.Properties()...)
+	reader, err := input.Open(path, format, parquetreader.ReaderOptions{BatchSize: 4096, Parallel: threads, Grid: cellGrid, Columns: columns, FlattenNested: opts.FlattenNested})
+	if err != nil {
+		return nil, sourceFailure(err)
+	}
+	defer reader.Close()
+
+	schema := reader.PropertyTypes()
+	if err := agg.check(schema); err != nil {
+		return nil, err
+	}
+	schema = agg.Types(schema)
+	if opts.ExtrudeBy != "" {
+		if err := requireNumeric(schema, opts.ExtrudeBy, "extrude"); err != nil {
+			return nil, err
+		}
+		if res.Extrusion, err = newExtrusion(opts); err != nil {
+			return nil, err
+		}
+	}
+	values := make([][]float64, len(specs))
+	for _, spec := range specs {
+		if err := requireNumeric(schema, spec.Property, "classify"); err != nil {
+			return nil, err
+		}
+	}
+	if top != nil {
+		if err := requireNumeric(schema, top.By, "top-per-parent"); err != nil {
+			return nil, err
+		}
+	}
+
+	observe := func(row *parquetreader.Row) {
+		if res.Extrusion != nil {
+			if value, ok := props.Number(row.Properties[res.Extrusion.Property]); ok {
+				res.Extrusion.observe(value)
+			}
+		}
+		for i, spec := range specs {
+			if value, ok := props.Number(row.Properties[spec.Property]); ok {
+				values[i] = append(values[i], value)
+			}
+		}
+		if top != nil {
+			top.observe(row.Cell, row.Properties)
+		} else if adaptive != nil {
+			adaptive.observe(row.Cell)
+		}
+	}
+	var groups *cellGroups
+	if agg != nil {
+		groups = newCellGroups(agg)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		row, err := reader.NextContext(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, sourceFailure(fmt.Errorf("read parquet: %w", err))
+		}
+		if row.Err != nil || !resolutionAllowed(opts, row.Resolution) || !where.Match(row.Properties) {
+			continue
+		}
+		if groups != nil {
+			groups.add(row)
+			continue
+		}
+		observe(row)
+	}
+	if groups != nil {
+		for _, row := range groups.rows() {
+			observe(row)
+		}
+	}
+
+	if res.Extrusion != nil && res.Extrusion.Min > res.Extrusion.Max {
+		return nil, fmt.Errorf("extrude property %q has no finite values", opts.ExtrudeBy)
+	}
+	for i, spec := range specs {
+		c, err := classify.New(spec, values[i])
+		if err != nil {
+			return nil, err
+		}
+		res.Classifications = append(res.Classifications, c)
+	}
+	if top != nil {
+		// Only the cells --top-per-parent keeps are written, so the regions count those.
+		if adaptive != nil {
+			top.eachKept(adaptive.observe)
+		}
+		top.finish()
+		res.TopPerParent = top
+	}
+	res.Adaptive = adaptive
+	return res, nil
+}
+
+func requireNumeric(schema map[string]string, property, flag string) error {
+	switch kind := schema[property]; kind {
+	case "int", "float":
+		return nil
+	case "":
+		return fmt.Errorf("%s property %q not found in input", flag, property)
+	default:
+		return fmt.Errorf("%s property %q must be numeric, got %s", flag, property, kind)
+	}
+}
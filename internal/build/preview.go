@@ -0,0 +1,128 @@
+package build
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+const (
+	// PreviewFraction is the share of features sampled into the QuickPreview tileset.
+	PreviewFraction = 0.01
+	// PreviewMaxZoom is the deepest zoom of the QuickPreview tileset; the full build's own
+	// maximum zoom applies when lower.
+	PreviewMaxZoom = 8
+	// previewExt names the preview tileset after the output.
+	previewExt = ".preview.pmtiles"
+)
+
+// writePreview samples the features of ndjsonPath into a small tileset for QuickPreview, tiled
+// in-process over the low zooms of tipOpts. The sample is taken by a hash of each feature, so a
+// rebuild of the same data previews the same cells. The preview carries the metadata of the
+// full tileset plus the fingerprint of the features it was sampled from.
+func writePreview(ctx context.Context, ndjsonPath, previewPath string, tipOpts tiler.TippecanoeOptions, metadata map[string]any, rep *report.Report) error {
+	samplePath := filepath.Join(filepath.Dir(ndjsonPath), "preview"+filepath.Ext(ndjsonPath))
+	sampled, fingerprint, err := samplePreview(ndjsonPath, samplePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(samplePath)
+	rep.Metrics.FeaturesFingerprint = fingerprint
+	if sampled == 0 {
+		return fmt.Errorf("no features were sampled")
+	}
+
+	opts := tipOpts
+	opts.MaxZoom = max(min(opts.MaxZoom, PreviewMaxZoom), opts.MinZoom)
+	opts.ExtraLayers = nil
+	opts.Progress = nil
+	if _, _, err := tiler.NewNativeTiler().Run(ctx, samplePath, previewPath, opts); err != nil {
+		return err
+	}
+
+	// Copy rather than add to the maps of the full tileset.
+	previewMetadata := make(map[string]any, len(metadata)+1)
+	for key, value := range metadata {
+		previewMetadata[key] = value
+	}
+	own := map[string]any{}
+	if full, ok := metadata["hexatiles"].(map[string]any); ok {
+		for key, value := range full {
+			own[key] = value
+		}
+	}
+	own["preview"] = map[string]any{
+		"fraction":    PreviewFraction,
+		"features":    sampled,
+		"fingerprint": fingerprint,
+	}
+	previewMetadata["hexatiles"] = own
+	if err := tiler.MergeMetadata(previewPath, previewMetadata); err != nil {
+		return fmt.Errorf("record preview metadata: %w", err)
+	}
+
+	info, err := os.Stat(previewPath)
+	if err != nil {
+		return err
+	}
+	rep.Metrics.PreviewPath = previewPath
+	rep.Metrics.PreviewSize = info.Size()
+	rep.Metrics.PreviewFeatures = sampled
+	rep.Metrics.PreviewMaxZoom = opts.MaxZoom
+	return nil
+}
+
+// samplePreview copies about PreviewFraction of the features of path to samplePath and returns
+// how many it copied and the SHA-256 of every feature read, which names the dataset the
+// sample came from.
+func samplePreview(path, samplePath string) (int64, string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("open features: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(samplePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("create preview features: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	digest := sha256.New()
+	fraction := PreviewFraction
+	threshold := uint64(fraction * (1 << 32))
+	var sampled int64
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 1<<20), 1<<30)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		digest.Write(line)
+		digest.Write([]byte{'\n'})
+		h := fnv.New64a()
+		h.Write(line)
+		if h.Sum64()&(1<<32-1) >= threshold {
+			continue
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+		sampled++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, "", fmt.Errorf("read features: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, "", fmt.Errorf("write preview features: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, "", fmt.Errorf("write preview features: %w", err)
+	}
+	return sampled, hex.EncodeToString(digest.Sum(nil)), nil
+}
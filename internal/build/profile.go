@@ -0,0 +1,105 @@
+package build
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// Profile bundles tiling defaults for a common use case. Explicit options always win over
+// the values supplied by a profile.
+type Profile struct {
+	Name              string
+	MinZoom           int
+	MaxZoom           int
+	Simplify          bool
+	DropStrategy      string
+	KeepAllProperties bool
+	PropertyByteCap   int
+}
+
+var profiles = map[string]Profile{
+	// Filled polygons coloured by a few attributes: coalesce rather than drop so the
+	// surface stays gap-free at low zooms.
+	"choropleth": {
+		Name:            "choropleth",
+		MinZoom:         0,
+		MaxZoom:         -1,
+		DropStrategy:    tiler.DropStrategyCoalesce,
+		PropertyByteCap: 2 * 1024,
+	},
+	// Density-style rendering where individual cells matter less than overall shape:
+	// shallower zooms, aggressive dropping and small payloads.
+	"heatmap": {
+		Name:            "heatmap",
+		MinZoom:         0,
+		MaxZoom:         10,
+		Simplify:        true,
+		DropStrategy:    tiler.DropStrategyDensest,
+		PropertyByteCap: 512,
+	},
+	// Every cell and every attribute preserved for inspection and querying.
+	"analysis": {
+		Name:              "analysis",
+		MinZoom:           -1,
+		MaxZoom:           -1,
+		DropStrategy:      tiler.DropStrategyNone,
+		KeepAllProperties: true,
+		PropertyByteCap:   16 * 1024,
+	},
+}
+
+// LookupProfile returns the named preset.
+func LookupProfile(name string) (Profile, error) {
+	p, ok := profiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q (expected one of: %s)", name, strings.Join(ProfileNames(), ", "))
+	}
+	return p, nil
+}
+
+// ProfileNames lists the available presets in sorted order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile fills the options not given explicitly from the selected profile. Without
+// opts.Explicit, a negative zoom, a zero property cap and simplification left off count as
+// not given.
+func applyProfile(opts Options) (Options, Profile, error) {
+	if strings.TrimSpace(opts.Profile) == "" {
+		return opts, Profile{}, nil
+	}
+
+	p, err := LookupProfile(opts.Profile)
+	if err != nil {
+		return opts, Profile{}, err
+	}
+
+	given := func(flag string, set bool) bool {
+		if opts.Explicit != nil {
+			return opts.Explicit[flag]
+		}
+		return set
+	}
+	if !given("minzoom", opts.MinZoom >= 0) {
+		opts.MinZoom = p.MinZoom
+	}
+	if !given("maxzoom", opts.MaxZoom >= 0) {
+		opts.MaxZoom = p.MaxZoom
+	}
+	if !given("property-cap", opts.PropertyByteCap > 0) {
+		opts.PropertyByteCap = p.PropertyByteCap
+	}
+	if !given("simplify", opts.Simplify) {
+		opts.Simplify = p.Simplify
+	}
+	return opts, p, nil
+}
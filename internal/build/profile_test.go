@@ -0,0 +1,29 @@
+package build
+
+import "testing"
+
+func TestApplyProfileKeepsExplicitFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		simplify bool
+		maxZoom  int
+		cap      int
+	}{
+		{"profile fills", Options{Profile: "heatmap", MaxZoom: -1, PropertyByteCap: 2048, Explicit: map[string]bool{}}, true, 10, 512},
+		{"simplify off", Options{Profile: "heatmap", MaxZoom: -1, PropertyByteCap: 2048, Explicit: map[string]bool{"simplify": true}}, false, 10, 512},
+		{"explicit defaults", Options{Profile: "heatmap", MaxZoom: 12, PropertyByteCap: 2048, Explicit: map[string]bool{"maxzoom": true, "property-cap": true}}, true, 12, 2048},
+		{"no flag set", Options{Profile: "heatmap", MaxZoom: -1}, true, 10, 512},
+		{"library caller", Options{Profile: "heatmap", MaxZoom: 8, PropertyByteCap: 1024}, true, 8, 1024},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, _, err := applyProfile(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Simplify != tc.simplify || opts.MaxZoom != tc.maxZoom || opts.PropertyByteCap != tc.cap {
+				t.Errorf("simplify %v, maxzoom %d, property cap %d; want %v, %d, %d", opts.Simplify, opts.MaxZoom, opts.PropertyByteCap, tc.simplify, tc.maxZoom, tc.cap)
+			}
+		})
+	}
+}
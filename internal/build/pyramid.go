@@ -0,0 +1,202 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	h3geom "github.com/hexatiles/hexatiles/internal/h3"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// Pyramid rolls the input cells up to coarser resolutions for the low zooms: each level tiles
+// the parents of the input cells at one resolution over its own zoom range, and the input
+// cells take the zooms after the last level. Parent values combine every input row under the
+// parent that passes --where, using the --aggregate functions; other properties are not
+// carried up.
+type Pyramid struct {
+	levels []*pyramidLevel
+	agg    *Aggregation
+	grid   grid.CellGeometry
+}
+
+type pyramidLevel struct {
+	Resolution int
+	MinZoom    int
+	MaxZoom    int
+	index      map[grid.Cell]int
+	cells      []grid.Cell
+	states     [][]aggregateState
+}
+
+// parsePyramid reads "5,7" or "5:0-6,7:7-9". A level without zooms starts right after the
+// previous one, or at z0, and ends one zoom past the ideal zoom of its H3 resolution (see
+// `hexatiles zooms`), where its cells grow large enough to hand over to finer ones. Other grids
+// need explicit zooms.
+func parsePyramid(spec string, agg *Aggregation, g grid.CellGeometry) (*Pyramid, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	if agg == nil {
+		return nil, fmt.Errorf("--pyramid needs --aggregate to say how values roll up to parent cells")
+	}
+	p := &Pyramid{agg: agg, grid: g}
+	nextZoom := 0
+	for _, part := range strings.Split(spec, ",") {
+		resPart, zoomPart, explicit := strings.Cut(strings.TrimSpace(part), ":")
+		res, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(resPart), "r"))
+		if err != nil || res < 0 {
+			return nil, fmt.Errorf("invalid --pyramid %q: %q is not a resolution", spec, resPart)
+		}
+		level := &pyramidLevel{Resolution: res, MinZoom: nextZoom, index: make(map[grid.Cell]int)}
+		if !explicit {
+			if g.Name() != "h3" {
+				return nil, fmt.Errorf("invalid --pyramid %q: give the zooms of every %s level, such as %d:0-6", spec, g.Name(), res)
+			}
+			suit, err := h3geom.Suitability(res)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --pyramid %q: %w", spec, err)
+			}
+			level.MaxZoom = max(nextZoom, suit.IdealZoom+1)
+		} else {
+			minPart, maxPart, ok := strings.Cut(zoomPart, "-")
+			minZoom, minErr := strconv.Atoi(strings.TrimSpace(minPart))
+			maxZoom, maxErr := strconv.Atoi(strings.TrimSpace(maxPart))
+			if !ok || minErr != nil || maxErr != nil || minZoom < 0 || maxZoom < minZoom {
+				return nil, fmt.Errorf("invalid --pyramid %q: %q is not a zoom range such as 0-6", spec, zoomPart)
+			}
+			if len(p.levels) > 0 && minZoom != nextZoom {
+				return nil, fmt.Errorf("invalid --pyramid %q: r%d starts at z%d, but the previous level ends at z%d", spec, res, minZoom, nextZoom-1)
+			}
+			level.MinZoom, level.MaxZoom = minZoom, maxZoom
+		}
+		if n := len(p.levels); n > 0 && res <= p.levels[n-1].Resolution {
+			return nil, fmt.Errorf("invalid --pyramid %q: resolutions must increase", spec)
+		}
+		p.levels = append(p.levels, level)
+		nextZoom = level.MaxZoom + 1
+	}
+	return p, nil
+}
+
+// String returns the resolved levels, such as "5:0-7,7:8-9".
+func (p *Pyramid) String() string {
+	if p == nil {
+		return ""
+	}
+	parts := make([]string, len(p.levels))
+	for i, l := range p.levels {
+		parts[i] = fmt.Sprintf("%d:%d-%d", l.Resolution, l.MinZoom, l.MaxZoom)
+	}
+	return strings.Join(parts, ",")
+}
+
+// DataMinZoom is the first zoom of the input cells.
+func (p *Pyramid) DataMinZoom() int {
+	return p.levels[len(p.levels)-1].MaxZoom + 1
+}
+
+// dataZooms is the range written on the features of the input cells.
+func (p *Pyramid) dataZooms() *ndjson.ZoomRange {
+	if p == nil {
+		return nil
+	}
+	return &ndjson.ZoomRange{Min: p.DataMinZoom(), Max: -1}
+}
+
+// observe adds an input row to its parent on every level.
+func (p *Pyramid) observe(row *parquetreader.Row) {
+	for _, l := range p.levels {
+		parent := p.grid.Parent(row.Cell, l.Resolution)
+		i, ok := l.index[parent]
+		if !ok {
+			i = len(l.cells)
+			l.index[parent] = i
+			l.cells = append(l.cells, parent)
+			l.states = append(l.states, make([]aggregateState, len(p.agg.specs)))
+		}
+		for j, s := range p.agg.specs {
+			l.states[i][j].observe(s.Func, row.Properties[s.Property])
+		}
+	}
+}
+
+// rows returns one row per parent cell of the level, in cell order, carrying only the
+// aggregated properties.
+func (p *Pyramid) rows(l *pyramidLevel) []*parquetreader.Row {
+	order := make([]int, len(l.cells))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return l.cells[order[a]] < l.cells[order[b]] })
+	out := make([]*parquetreader.Row, len(order))
+	for n, i := range order {
+		cell := l.cells[i]
+		properties := make(map[string]any, len(p.agg.specs))
+		for j, s := range p.agg.specs {
+			properties[s.Property] = l.states[i][j].value(s.Func, p.agg.kinds[s.Property])
+		}
+		out[n] = &parquetreader.Row{
+			Cell:       cell,
+			CellString: p.grid.Token(cell),
+			Resolution: p.grid.Resolution(cell),
+			Properties: properties,
+		}
+	}
+	return out
+}
+
+// writeRollups writes the parent cells of every level after the input cells, through the same
+// property pipeline but without --where, the resolution filter or top-per-parent, which
+// already applied to the rows beneath them. The values do not feed the property statistics,
+// which describe the input cells. Each level keeps its own zoom range under --adaptive-maxzoom.
+func writeRollups(ctx context.Context, writer *ndjson.Writer, cfg processConfig) error {
+	p := cfg.Pyramid
+	levelCfg := cfg
+	levelCfg.Where = nil
+	levelCfg.Top = nil
+	levelCfg.Collect = nil
+	levelCfg.Adaptive = nil
+	levelCfg.Options.MinResolution, levelCfg.Options.MaxResolution = -1, -1
+	for _, l := range p.levels {
+		levelCfg.Zoom = &ndjson.ZoomRange{Min: l.MinZoom, Max: l.MaxZoom}
+		metrics := report.PyramidLevel{Resolution: l.Resolution, MinZoom: l.MinZoom, MaxZoom: l.MaxZoom}
+		rows := p.rows(l)
+		for start := 0; start < len(rows); start += polygonBatchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, fr := range buildFeatures(rows[start:min(start+polygonBatchSize, len(rows))], levelCfg) {
+				if fr.Err != nil {
+					return fmt.Errorf("pyramid r%d: %w", l.Resolution, fr.Err)
+				}
+				if fr.Dropped {
+					metrics.Dropped++
+					continue
+				}
+				err := writer.WriteFeature(fr.Feature)
+				cfg.Encoder.Release(fr.Feature.EncodedProperties)
+				if err != nil {
+					return fmt.Errorf("write NDJSON feature: %w", err)
+				}
+				metrics.Features++
+			}
+		}
+		cfg.Report.Metrics.PyramidLevels = append(cfg.Report.Metrics.PyramidLevels, metrics)
+	}
+	cfg.Report.Metrics.PyramidMinZoom = p.DataMinZoom()
+	return nil
+}
+
+func rollupCount(levels []report.PyramidLevel) int64 {
+	var n int64
+	for _, l := range levels {
+		n += l.Features
+	}
+	return n
+}
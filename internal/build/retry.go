@@ -0,0 +1,67 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// retryDelay is the wait before the first retry of a source read; it doubles with each retry.
+var retryDelay = time.Second
+
+// PartialError lists the sources a KeepGoing build left out after they failed every attempt.
+// Run returns it together with the Result: the tileset and reports were written without them.
+type PartialError struct {
+	Failed []*report.Source
+}
+
+func (e *PartialError) Error() string {
+	parts := make([]string, len(e.Failed))
+	for i, src := range e.Failed {
+		parts[i] = fmt.Sprintf("%s layer from %s after %d attempts: %s", src.Config.Layer, src.Config.InputPath, src.Metrics.Retries+1, src.Metrics.Failure)
+	}
+	return "built without the " + strings.Join(parts, "; ")
+}
+
+// sourceError marks a failure to open or read a source, which a later attempt may not hit.
+// Problems with the options or the contents of the source are left unmarked.
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string { return e.err.Error() }
+func (e *sourceError) Unwrap() error { return e.err }
+
+// sourceFailure marks err, if any, as a failure to open or read a source.
+func sourceFailure(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &sourceError{err: err}
+}
+
+// attemptSource runs read, one read of src, until it succeeds or has failed 1+retries times,
+// waiting retryDelay before the first retry and twice as long before each next one. Only
+// errors marked by sourceFailure are retried. The retries are counted on src and the last
+// error is returned.
+func attemptSource(ctx context.Context, src *report.Source, retries int, read func() error) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := read()
+		var failure *sourceError
+		if err == nil || !errors.As(err, &failure) || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		src.Metrics.Retries++
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
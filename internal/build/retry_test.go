@@ -0,0 +1,105 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+func TestKeepGoingWithoutArcs(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	dir := t.TempDir()
+	input, scores := e2eCells(t, dir)
+	opts := testOptions(input, filepath.Join(dir, "cells.pmtiles"))
+	opts.MinZoom, opts.MaxZoom = 8, 8
+	opts.ArcsInput = filepath.Join(dir, "missing-flows.parquet")
+	opts.SourceRetries = 2
+
+	if _, err := Run(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "missing-flows.parquet") {
+		t.Fatalf("build without KeepGoing: error %v; want the arcs input's", err)
+	}
+
+	opts.KeepGoing = true
+	result, err := Run(context.Background(), opts)
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("error %v; want a *PartialError", err)
+	}
+	if result == nil || result.FeatureCount != int64(len(scores)) {
+		t.Fatalf("result %+v; want the %d cells built", result, len(scores))
+	}
+	if len(partial.Failed) != 1 || partial.Failed[0].Config.Layer != "arcs" {
+		t.Fatalf("left out %+v; want the arcs source", partial.Failed)
+	}
+	if src := partial.Failed[0]; src.Metrics.Retries != 2 || src.Metrics.Failure == "" {
+		t.Errorf("arcs source retried %d times with failure %q; want 2 and the last error", src.Metrics.Retries, src.Metrics.Failure)
+	}
+
+	archive, err := tiler.OpenPMTiles(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	tiles := 0
+	err = archive.WalkZoom(8, func(z, x, y int, data []byte) error {
+		layers, err := mvt.UnmarshalGzipped(data)
+		if err != nil {
+			if layers, err = mvt.Unmarshal(data); err != nil {
+				return err
+			}
+		}
+		for _, layer := range layers {
+			if layer.Name == "arcs" {
+				t.Errorf("tile %d/%d/%d has an arcs layer", z, x, y)
+			}
+		}
+		tiles++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tiles == 0 {
+		t.Error("no z8 tiles were written")
+	}
+}
+
+func TestAttemptSourceRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	src := &report.Source{}
+	calls := 0
+	err := attemptSource(context.Background(), src, 3, func() error {
+		if calls++; calls < 3 {
+			return sourceFailure(errors.New("transient"))
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || src.Metrics.Retries != 2 {
+		t.Errorf("error %v after %d calls, %d retries; want success on the third call", err, calls, src.Metrics.Retries)
+	}
+
+	// Problems with the options or the data fail the same way on every attempt.
+	calls = 0
+	if err := attemptSource(context.Background(), &report.Source{}, 3, func() error { calls++; return errors.New("not numeric") }); err == nil || calls != 1 {
+		t.Errorf("unmarked: error %v after %d calls; want the first error", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := attemptSource(ctx, &report.Source{}, 3, func() error { calls++; return sourceFailure(errors.New("down")) }); err == nil || calls != 1 {
+		t.Errorf("cancelled: error %v after %d calls; want the first error", err, calls)
+	}
+}
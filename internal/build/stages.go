@@ -0,0 +1,103 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/props"
+	"github.com/hexatiles/hexatiles/internal/report"
+)
+
+// featureStages are the optional steps that reshape features between reading and tiling: the
+// --pyramid roll-ups and the collector that merges cells for --compact or --dissolve-by.
+type featureStages struct {
+	pyramid  *Pyramid
+	dissolve *Dissolve
+	collect  featureCollector
+}
+
+// newFeatureStages parses the reshaping options, rejecting combinations that cannot work
+// together, and records them in the report.
+func newFeatureStages(opts Options, agg *Aggregation, cellGrid grid.CellGeometry, rep *report.Report) (featureStages, error) {
+	var stages featureStages
+	pyramid, err := parsePyramid(opts.Pyramid, agg, cellGrid)
+	if err != nil {
+		return stages, err
+	}
+	stages.pyramid = pyramid
+	rep.Config.Pyramid = pyramid.String()
+
+	compaction, err := newCompaction(opts.Compact, cellGrid)
+	if err != nil {
+		return stages, err
+	}
+	if compaction != nil && len(opts.Conserve) > 0 {
+		return stages, fmt.Errorf("--compact cannot be combined with --conserve: a merged hexagon carries the value of one input cell, not the total of the cells it covers")
+	}
+	rep.Config.Compact = opts.Compact
+
+	dissolve, err := newDissolve(opts.DissolveBy, cellGrid)
+	if err != nil {
+		return stages, err
+	}
+	switch {
+	case compaction != nil && dissolve != nil:
+		return stages, fmt.Errorf("--compact and --dissolve-by are mutually exclusive")
+	case dissolve != nil && len(opts.Conserve) > 0:
+		return stages, fmt.Errorf("--dissolve-by cannot be combined with --conserve: dissolved polygons only carry the --dissolve-by properties")
+	case compaction != nil:
+		stages.collect = compaction
+	case dissolve != nil:
+		stages.dissolve, stages.collect = dissolve, dissolve
+	}
+	rep.Config.DissolveBy = append([]string(nil), opts.DissolveBy...)
+	if stages.collect != nil && strings.TrimSpace(opts.AdaptiveMaxZoom) != "" {
+		return stages, fmt.Errorf("--adaptive-maxzoom cannot be combined with --compact or --dissolve-by: merged polygons span regions of different zooms")
+	}
+	return stages, nil
+}
+
+// checkDissolve checks that the --dissolve-by properties reach the features, counting the
+// attributes the prescan derives.
+func (s featureStages) checkDissolve(filter *props.Filter, scan *prescanResult) error {
+	if s.dissolve == nil {
+		return nil
+	}
+	var derived []string
+	if scan.Extrusion != nil {
+		derived = append(derived, HeightAttribute)
+	}
+	for _, c := range scan.Classifications {
+		derived = append(derived, c.Attribute())
+	}
+	return s.dissolve.check(filter, derived)
+}
+
+// recordPrescan finishes the adaptive zooms, which start where the pyramid levels end, and
+// records what the prescan found in the report.
+func recordPrescan(opts Options, scan *prescanResult, pyramid *Pyramid, rep *report.Report) {
+	if extrusion := scan.Extrusion; extrusion != nil {
+		rep.Config.ExtrudeScale = extrusion.Scale
+		rep.Metrics.ExtrudeMin = extrusion.Min
+		rep.Metrics.ExtrudeMax = extrusion.Max
+	}
+	for _, c := range scan.Classifications {
+		rep.Metrics.Classifications = append(rep.Metrics.Classifications, report.Classification{
+			Property:  c.Property,
+			Attribute: c.Attribute(),
+			Method:    c.Method,
+			Breaks:    c.Breaks,
+		})
+	}
+	if top := scan.TopPerParent; top != nil {
+		rep.Config.TopPerParent = top.String()
+		rep.Metrics.TopParents = top.Parents
+		rep.Metrics.TopParentsCapped = top.Capped
+	}
+	if adaptive := scan.Adaptive; adaptive != nil {
+		adaptive.finish(opts, pyramid.dataZooms())
+		rep.Config.AdaptiveMaxZoom = adaptive.String()
+		rep.Metrics.AdaptiveZooms = adaptive.Zooms()
+	}
+}
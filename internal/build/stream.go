@@ -0,0 +1,106 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hexatiles/hexatiles/internal/report"
+	"github.com/hexatiles/hexatiles/internal/tiler"
+)
+
+// Stdout as OutputPMTiles streams the tileset to Options.Stdout instead of writing a file.
+const Stdout = "-"
+
+// Output formats for Options.OutputFormat.
+const (
+	FormatPMTiles = "pmtiles"
+	FormatMBTiles = "mbtiles"
+)
+
+// resolveOutput returns the absolute output path and the directory that holds the work
+// directory and report. A streamed build keeps them in the current directory.
+func resolveOutput(output string) (string, string, error) {
+	if output == Stdout {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", "", fmt.Errorf("resolve working directory: %w", err)
+		}
+		return Stdout, dir, nil
+	}
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return "", "", fmt.Errorf("resolve output path: %w", err)
+	}
+	return abs, filepath.Dir(abs), nil
+}
+
+// streamTileset writes the finished tileset to opts.Stdout: the MBTiles as they are with
+// SkipPMTiles, otherwise a PMTiles archive converted on the fly, so the MBTiles in the work
+// directory are the only copy on disk. The report describes the MBTiles, which hold the same
+// tiles.
+func streamTileset(ctx context.Context, opts Options, mbtilesPath string, metadata map[string]any, rep *report.Report) error {
+	recordTilesetZooms(mbtilesPath, rep)
+	if opts.SkipPMTiles && len(metadata) > 0 {
+		if err := tiler.MergeMBTilesMetadata(mbtilesPath, metadata); err != nil {
+			rep.AddWarning(fmt.Sprintf("record tileset metadata: %v", err))
+		}
+	}
+	if meta, err := tiler.MBTilesInfo(mbtilesPath); err == nil {
+		for key, value := range metadata {
+			meta[key] = value
+		}
+		rep.Metrics.PMTilesInfo = meta
+	} else {
+		rep.AddWarning(fmt.Sprintf("mbtiles metadata: %v", err))
+	}
+	if counts, err := tiler.MBTilesTileCounts(mbtilesPath); err == nil {
+		recordTileCounts(counts, rep)
+	} else {
+		rep.AddWarning(fmt.Sprintf("tile counts: %v", err))
+	}
+
+	dst := opts.Stdout
+	if dst == nil {
+		dst = os.Stdout
+	}
+	out := &countingWriter{w: dst}
+	start := time.Now()
+	var err error
+	if opts.SkipPMTiles {
+		err = copyFile(out, mbtilesPath)
+	} else {
+		err = tiler.WritePMTiles(ctx, mbtilesPath, out, metadata)
+	}
+	rep.Metrics.TilingDuration += time.Since(start)
+	if err != nil {
+		return fmt.Errorf("stream tileset: %w", err)
+	}
+	rep.Metrics.OutputPath = Stdout
+	rep.Metrics.OutputSize = out.n
+	return nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,184 @@
+package build
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// TopPerParent keeps at most N cells under each parent cell at Resolution, ranked by the
+// numeric property By. Ties are broken by the smaller cell ID so the selection does not
+// depend on row order, and rows without a numeric value rank last.
+type TopPerParent struct {
+	Resolution int
+	N          int
+	By         string
+	// Parents counts the parent cells seen; Capped counts those with more than N children.
+	Parents int
+	Capped  int
+
+	grid  grid.CellGeometry
+	heaps map[grid.Cell]*rankHeap
+	// cutoffs holds the lowest-ranked kept child of every capped parent.
+	cutoffs map[grid.Cell]rankedCell
+}
+
+// parseTopPerParent reads "res=5,n=1000,by=score".
+func parseTopPerParent(spec string, cellGrid grid.CellGeometry) (*TopPerParent, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	t := &TopPerParent{Resolution: -1, grid: cellGrid}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid --top-per-parent %q (expected res=<resolution>,n=<count>,by=<property>)", spec)
+		}
+		var err error
+		switch key {
+		case "res", "resolution":
+			t.Resolution, err = strconv.Atoi(value)
+			if err == nil && t.Resolution < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "n":
+			t.N, err = strconv.Atoi(value)
+			if err == nil && t.N < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "by":
+			t.By = value
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid --top-per-parent %s=%s: %w", key, value, err)
+		}
+	}
+	if t.Resolution < 0 || t.N == 0 || t.By == "" {
+		return nil, fmt.Errorf("invalid --top-per-parent %q: res, n and by are all required", spec)
+	}
+	t.heaps = make(map[grid.Cell]*rankHeap)
+	return t, nil
+}
+
+// reset forgets the cells observed so far, for a prescan that starts over.
+func (t *TopPerParent) reset() {
+	if t != nil {
+		t.heaps = make(map[grid.Cell]*rankHeap)
+	}
+}
+
+// String returns the normalized spec for the report.
+func (t *TopPerParent) String() string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("res=%d,n=%d,by=%s", t.Resolution, t.N, t.By)
+}
+
+// observe ranks a row during the prescan.
+func (t *TopPerParent) observe(cell grid.Cell, properties map[string]any) {
+	parent := t.grid.Parent(cell, t.Resolution)
+	h := t.heaps[parent]
+	if h == nil {
+		h = &rankHeap{}
+		t.heaps[parent] = h
+	}
+	entry := rankedCell{value: rankValue(properties[t.By]), cell: cell}
+	if h.Len() < t.N {
+		heap.Push(h, entry)
+		return
+	}
+	if h.entries[0].below(entry) {
+		h.entries[0] = entry
+		heap.Fix(h, 0)
+	}
+	h.overflow = true
+}
+
+// eachKept calls fn with every child observe ranked among the top N of its parent. It must be
+// called before finish.
+func (t *TopPerParent) eachKept(fn func(grid.Cell)) {
+	for _, h := range t.heaps {
+		for _, entry := range h.entries {
+			fn(entry.cell)
+		}
+	}
+}
+
+// finish turns the ranked children into per-parent cutoffs and frees them.
+func (t *TopPerParent) finish() {
+	t.cutoffs = make(map[grid.Cell]rankedCell)
+	t.Parents = len(t.heaps)
+	for parent, h := range t.heaps {
+		if h.overflow {
+			t.cutoffs[parent] = h.entries[0]
+		}
+	}
+	t.Capped = len(t.cutoffs)
+	t.heaps = nil
+}
+
+// Keep reports whether a row is among the top N of its parent.
+func (t *TopPerParent) Keep(cell grid.Cell, properties map[string]any) bool {
+	cutoff, ok := t.cutoffs[t.grid.Parent(cell, t.Resolution)]
+	if !ok {
+		return true
+	}
+	return !(rankedCell{value: rankValue(properties[t.By]), cell: cell}).below(cutoff)
+}
+
+// Metadata returns the selection recorded in the PMTiles metadata.
+func (t *TopPerParent) Metadata() map[string]any {
+	return map[string]any{
+		"resolution": t.Resolution,
+		"n":          t.N,
+		"by":         t.By,
+		"parents":    t.Parents,
+		"capped":     t.Capped,
+	}
+}
+
+type rankedCell struct {
+	value float64
+	cell  grid.Cell
+}
+
+// below reports whether r ranks after other: a smaller value, or an equal value and a larger cell.
+func (r rankedCell) below(other rankedCell) bool {
+	if r.value != other.value {
+		return r.value < other.value
+	}
+	return r.cell > other.cell
+}
+
+func rankValue(value any) float64 {
+	if f, ok := props.Number(value); ok && !math.IsNaN(f) {
+		return f
+	}
+	return math.Inf(-1)
+}
+
+// rankHeap is a min-heap whose root is the lowest-ranked child kept so far.
+type rankHeap struct {
+	entries  []rankedCell
+	overflow bool
+}
+
+func (h *rankHeap) Len() int           { return len(h.entries) }
+func (h *rankHeap) Less(i, j int) bool { return h.entries[i].below(h.entries[j]) }
+func (h *rankHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *rankHeap) Push(x any)         { h.entries = append(h.entries, x.(rankedCell)) }
+
+func (h *rankHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
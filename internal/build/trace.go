@@ -0,0 +1,78 @@
+package build
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/trace"
+)
+
+// Tracks of the --trace output. Workers get one track each, numbered from traceWorker.
+const (
+	traceBuild = iota + 1
+	traceRead
+	traceWrite
+	traceWorker = 100
+)
+
+// queueSampleInterval spaces the queue counters; a 3-hour build records about 43,000 samples.
+const queueSampleInterval = 250 * time.Millisecond
+
+// pipelineProbe follows the feature stage for the trace: when the input ran dry, how many
+// workers are busy and how many features were written. Workers update it whether or not a
+// trace is recorded; that costs a few clock reads per batch.
+type pipelineProbe struct {
+	rec      *trace.Recorder
+	busy     atomic.Int32
+	written  atomic.Int64
+	readOnce sync.Once
+	readEnd  time.Time
+}
+
+// inputDone notes the first moment a stage saw the end of the input stream.
+func (p *pipelineProbe) inputDone() {
+	p.readOnce.Do(func() { p.readEnd = time.Now() })
+}
+
+// workerStats accumulates where one worker spent its time.
+type workerStats struct {
+	start       time.Time
+	rows        int64
+	batches     int64
+	busy        time.Duration
+	waitInput   time.Duration
+	waitResults time.Duration
+}
+
+func (p *pipelineProbe) recordWorker(id int, s *workerStats) {
+	p.rec.Span(traceWorker+id, "polygonize", "features", s.start, time.Now(), map[string]any{
+		"rows":            s.rows,
+		"batches":         s.batches,
+		"busy_ms":         s.busy.Milliseconds(),
+		"wait_input_ms":   s.waitInput.Milliseconds(),
+		"wait_results_ms": s.waitResults.Milliseconds(),
+	})
+}
+
+// sampleQueues records the fill of the worker input and result queues, the busy workers and
+// the features written until stop is closed. A full input queue with idle workers points at
+// the writer; an empty one at the reader.
+func (p *pipelineProbe) sampleQueues(jobs <-chan *parquetreader.Row, results chan featureResult, stop <-chan struct{}) {
+	if p.rec == nil {
+		return
+	}
+	ticker := time.NewTicker(queueSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			p.rec.Counter("queued rows", now, map[string]any{"input": len(jobs), "results": len(results)})
+			p.rec.Counter("busy workers", now, map[string]any{"busy": p.busy.Load()})
+			p.rec.Counter("features written", now, map[string]any{"features": p.written.Load()})
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package classify
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Method names accepted in a classification spec.
+const (
+	Quantile      = "quantile"
+	Jenks         = "jenks"
+	EqualInterval = "equal-interval"
+)
+
+const (
+	defaultClasses = 5
+	maxClasses     = 32
+	// jenksSampleSize bounds the O(k·n²) natural-breaks search; larger inputs are sampled evenly
+	// from the sorted values.
+	jenksSampleSize = 2000
+)
+
+// Spec requests that a numeric property be classified into a fixed number of classes.
+type Spec struct {
+	Property string
+	Method   string
+	Classes  int
+}
+
+// Attribute is the name of the class property written to features.
+func (s Spec) Attribute() string { return s.Property + "_class" }
+
+// ParseSpecs parses a comma-separated list such as "score:quantile:7,pop:jenks". The method
+// defaults to quantile and the class count to 5.
+func ParseSpecs(value string) ([]Spec, error) {
+	var specs []Spec
+	seen := make(map[string]bool)
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		parts := strings.Split(token, ":")
+		if len(parts) > 3 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid classify spec %q (expected property[:method[:classes]])", token)
+		}
+
+		spec := Spec{Property: strings.TrimSpace(parts[0]), Method: Quantile, Classes: defaultClasses}
+		if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+			spec.Method = strings.ToLower(strings.TrimSpace(parts[1]))
+		}
+		switch spec.Method {
+		case Quantile, Jenks, EqualInterval:
+		case "equal":
+			spec.Method = EqualInterval
+		default:
+			return nil, fmt.Errorf("invalid classify method %q in %q (expected quantile, jenks or equal-interval)", spec.Method, token)
+		}
+		if len(parts) > 2 {
+			n, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+			if err != nil || n < 2 || n > maxClasses {
+				return nil, fmt.Errorf("invalid class count in %q (expected 2-%d)", token, maxClasses)
+			}
+			spec.Classes = n
+		}
+		if seen[spec.Property] {
+			return nil, fmt.Errorf("property %q classified more than once", spec.Property)
+		}
+		seen[spec.Property] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Classification maps values of one property onto class indexes 0..Classes-1.
+type Classification struct {
+	Spec
+	// Breaks holds Classes+1 ascending boundaries, from the minimum to the maximum value.
+	Breaks []float64
+}
+
+// New computes breaks for spec from the observed values. values is sorted in place.
+func New(spec Spec, values []float64) (*Classification, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("classify %q: no finite values", spec.Property)
+	}
+	sort.Float64s(values)
+
+	var breaks []float64
+	switch spec.Method {
+	case Quantile:
+		breaks = quantileBreaks(values, spec.Classes)
+	case Jenks:
+		breaks = jenksBreaks(sample(values, jenksSampleSize), spec.Classes)
+	default:
+		breaks = equalIntervalBreaks(values[0], values[len(values)-1], spec.Classes)
+	}
+	return &Classification{Spec: spec, Breaks: breaks}, nil
+}
+
+// Class returns the class index of value. Values outside the observed range fall into the
+// first or last class.
+func (c *Classification) Class(value float64) int {
+	// Interior breaks start a new class; a value equal to a break belongs to the upper class.
+	interior := c.Breaks[1 : len(c.Breaks)-1]
+	return sort.Search(len(interior), func(i int) bool { return interior[i] > value })
+}
+
+// Metadata returns the description recorded in the PMTiles metadata.
+func (c *Classification) Metadata() map[string]any {
+	return map[string]any{
+		"attribute": c.Attribute(),
+		"method":    c.Method,
+		"classes":   c.Classes,
+		"breaks":    c.Breaks,
+	}
+}
+
+func quantileBreaks(sorted []float64, k int) []float64 {
+	n := len(sorted)
+	breaks := make([]float64, k+1)
+	breaks[0] = sorted[0]
+	for i := 1; i < k; i++ {
+		breaks[i] = sorted[i*n/k]
+	}
+	breaks[k] = sorted[n-1]
+	return breaks
+}
+
+func equalIntervalBreaks(min, max float64, k int) []float64 {
+	breaks := make([]float64, k+1)
+	step := (max - min) / float64(k)
+	for i := 0; i < k; i++ {
+		breaks[i] = min + float64(i)*step
+	}
+	breaks[k] = max
+	return breaks
+}
+
+// jenksBreaks implements Jenks natural breaks by dynamic programming over the sorted values,
+// minimising the within-class sum of squared deviations.
+func jenksBreaks(sorted []float64, k int) []float64 {
+	n := len(sorted)
+	if k >= n {
+		breaks := make([]float64, k+1)
+		for i := range breaks {
+			breaks[i] = sorted[min(i, n-1)]
+		}
+		return breaks
+	}
+
+	// lower[l][j] is the 1-based index where class j starts in the best split of the first l values;
+	// cost[l][j] is that split's total variance.
+	lower := make([][]int, n+1)
+	cost := make([][]float64, n+1)
+	for l := range lower {
+		lower[l] = make([]int, k+1)
+		cost[l] = make([]float64, k+1)
+		for j := 1; j <= k; j++ {
+			cost[l][j] = math.Inf(1)
+		}
+	}
+	for j := 1; j <= k; j++ {
+		lower[1][j] = 1
+		cost[1][j] = 0
+	}
+
+	for l := 2; l <= n; l++ {
+		var sum, sumSq, w float64
+		for m := 1; m <= l; m++ {
+			i := l - m + 1
+			v := sorted[i-1]
+			w++
+			sum += v
+			sumSq += v * v
+			variance := sumSq - sum*sum/w
+			if i == 1 {
+				continue
+			}
+			for j := 2; j <= k; j++ {
+				if c := variance + cost[i-1][j-1]; c <= cost[l][j] {
+					lower[l][j] = i
+					cost[l][j] = c
+				}
+			}
+		}
+		lower[l][1] = 1
+		cost[l][1] = sumSq - sum*sum/w
+	}
+
+	breaks := make([]float64, k+1)
+	breaks[k] = sorted[n-1]
+	breaks[0] = sorted[0]
+	l := n
+	for j := k; j >= 2; j-- {
+		start := lower[l][j]
+		breaks[j-1] = sorted[start-1]
+		l = start - 1
+	}
+	return breaks
+}
+
+// sample picks up to size evenly spaced values from sorted, always keeping both ends.
+func sample(sorted []float64, size int) []float64 {
+	n := len(sorted)
+	if n <= size {
+		return sorted
+	}
+	out := make([]float64, size)
+	for i := range out {
+		out[i] = sorted[i*(n-1)/(size-1)]
+	}
+	return out
+}
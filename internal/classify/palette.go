@@ -0,0 +1,87 @@
+package classify
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// palettes holds the colour stops of each named ramp, from low to high values. The sequential
+// ramps are the matplotlib perceptually uniform maps and the ColorBrewer single-hue and
+// diverging schemes, sampled at evenly spaced stops.
+var palettes = map[string][]string{
+	"viridis":  {"#440154", "#482878", "#3e4989", "#31688e", "#26828e", "#1f9e89", "#35b779", "#6ece58", "#b5de2b", "#fde725"},
+	"magma":    {"#000004", "#180f3d", "#440f76", "#721f81", "#9e2f7f", "#cd4071", "#f1605d", "#fd9668", "#feca8d", "#fcfdbf"},
+	"inferno":  {"#000004", "#1b0c41", "#4a0c6b", "#781c6d", "#a52c60", "#cf4446", "#ed6925", "#fb9b06", "#f7d13d", "#fcffa4"},
+	"plasma":   {"#0d0887", "#46039f", "#7201a8", "#9c179e", "#bd3786", "#d8576b", "#ed7953", "#fb9f3a", "#fdca26", "#f0f921"},
+	"cividis":  {"#00224e", "#123570", "#3b496c", "#575d6d", "#707173", "#8a8678", "#a59c74", "#c3b369", "#e1cc55", "#fee838"},
+	"blues":    {"#f7fbff", "#deebf7", "#c6dbef", "#9ecae1", "#6baed6", "#4292c6", "#2171b5", "#08519c", "#08306b"},
+	"greens":   {"#f7fcf5", "#e5f5e0", "#c7e9c0", "#a1d99b", "#74c476", "#41ab5d", "#238b45", "#006d2c", "#00441b"},
+	"reds":     {"#fff5f0", "#fee0d2", "#fcbba1", "#fc9272", "#fb6a4a", "#ef3b2c", "#cb181d", "#a50f15", "#67000d"},
+	"ylorrd":   {"#ffffcc", "#ffeda0", "#fed976", "#feb24c", "#fd8d3c", "#fc4e2a", "#e31a1c", "#bd0026", "#800026"},
+	"rdylbu":   {"#a50026", "#d73027", "#f46d43", "#fdae61", "#fee090", "#e0f3f8", "#abd9e9", "#74add1", "#4575b4", "#313695"},
+	"spectral": {"#9e0142", "#d53e4f", "#f46d43", "#fdae61", "#fee08b", "#e6f598", "#abdda4", "#66c2a5", "#3288bd", "#5e4fa2"},
+}
+
+// DefaultPalette is the ramp used when none is named.
+const DefaultPalette = "viridis"
+
+// Palettes lists the palette names in sorted order.
+func Palettes() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Palette returns n colours evenly spread over the named ramp, interpolated in RGB between its
+// stops. A name prefixed with "-", such as -viridis, reverses the ramp.
+func Palette(name string, n int) ([]string, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	reverse := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	if key == "" {
+		key = DefaultPalette
+	}
+	stops, ok := palettes[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette %q (expected one of: %s)", name, strings.Join(Palettes(), ", "))
+	}
+	colors := make([]string, n)
+	for i := range colors {
+		t := 0.5
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		if reverse {
+			t = 1 - t
+		}
+		colors[i] = rampColor(stops, t)
+	}
+	return colors, nil
+}
+
+// rampColor interpolates stops at t in [0, 1].
+func rampColor(stops []string, t float64) string {
+	pos := t * float64(len(stops)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	a, b := hexRGB(stops[lo]), hexRGB(stops[lo+1])
+	f := pos - float64(lo)
+	var out [3]int
+	for i := range out {
+		out[i] = int(math.Round(float64(a[i]) + f*float64(b[i]-a[i])))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", out[0], out[1], out[2])
+}
+
+func hexRGB(color string) [3]int {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	return [3]int{int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)}
+}
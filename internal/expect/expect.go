@@ -0,0 +1,143 @@
+package expect
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Expectation is a single assertion such as "emitted_features >= 1_000_000".
+type Expectation struct {
+	Expr   string
+	Metric string
+	Op     string
+	Value  float64
+}
+
+// Result is the outcome of checking one expectation.
+type Result struct {
+	Expectation
+	Actual float64
+	Passed bool
+}
+
+// file is the on-disk layout: either a bare list of expressions or a list under "expect".
+type file struct {
+	Expect []string `yaml:"expect"`
+}
+
+// operators are matched longest first so "<=" is not read as "<".
+var operators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// byteUnits are binary multiples, matching how the report prints sizes.
+var byteUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// Load reads expectations from a YAML file and checks every metric name against known.
+func Load(path string, known []string) ([]Expectation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read expectations: %w", err)
+	}
+
+	var exprs []string
+	var doc file
+	if err := yaml.Unmarshal(data, &doc); err == nil && doc.Expect != nil {
+		exprs = doc.Expect
+	} else if err := yaml.Unmarshal(data, &exprs); err != nil {
+		return nil, fmt.Errorf("parse expectations %s: expected a list of expressions, optionally under \"expect\"", path)
+	}
+
+	valid := make(map[string]bool, len(known))
+	for _, name := range known {
+		valid[name] = true
+	}
+	out := make([]Expectation, 0, len(exprs))
+	for _, expr := range exprs {
+		e, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		if !valid[e.Metric] {
+			return nil, fmt.Errorf("expectation %q: unknown metric %q (known: %s)", expr, e.Metric, strings.Join(known, ", "))
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Parse parses "<metric> <op> <value>". Values may use underscores as digit separators, a byte
+// suffix (KB, MB, GB, TB; binary multiples) or a Go duration such as 90s or 5m, read as seconds.
+func Parse(expr string) (Expectation, error) {
+	e := Expectation{Expr: strings.TrimSpace(expr)}
+	for _, op := range operators {
+		metric, value, found := strings.Cut(e.Expr, op)
+		if !found {
+			continue
+		}
+		e.Metric = strings.TrimSpace(metric)
+		e.Op = op
+		if e.Metric == "" {
+			return e, fmt.Errorf("expectation %q: missing metric name", expr)
+		}
+		v, err := parseValue(value)
+		if err != nil {
+			return e, fmt.Errorf("expectation %q: %w", expr, err)
+		}
+		e.Value = v
+		return e, nil
+	}
+	return e, fmt.Errorf("expectation %q: expected <metric> <op> <value> with op one of %s", expr, strings.Join(operators, " "))
+}
+
+// Check evaluates the expectation against actual.
+func (e Expectation) Check(actual float64) Result {
+	var ok bool
+	switch e.Op {
+	case "==":
+		ok = actual == e.Value
+	case "!=":
+		ok = actual != e.Value
+	case "<=":
+		ok = actual <= e.Value
+	case ">=":
+		ok = actual >= e.Value
+	case "<":
+		ok = actual < e.Value
+	case ">":
+		ok = actual > e.Value
+	}
+	return Result{Expectation: e, Actual: actual, Passed: ok}
+}
+
+func parseValue(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "_", "")
+	if s == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	upper := strings.ToUpper(s)
+	for _, unit := range byteUnits {
+		if number, found := strings.CutSuffix(upper, unit.suffix); found {
+			v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil {
+				break
+			}
+			return v * unit.factor, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), nil
+	}
+	return 0, fmt.Errorf("invalid value %q", s)
+}
@@ -0,0 +1,132 @@
+package grid
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+)
+
+func init() {
+	Register(geohashGrid{})
+}
+
+const (
+	geohashAlphabet     = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geohashMaxPrecision = 12
+)
+
+// geohashGrid polygonizes geohash strings. Cells are packed as the 5-bit character codes
+// followed by a 4-bit precision so they fit the shared Cell type.
+type geohashGrid struct{}
+
+func (geohashGrid) Name() string { return "geohash" }
+
+func (geohashGrid) Columns() []string {
+	return []string{"geohash", "geohash_id", "gh", "cell", "cell_id"}
+}
+
+func (geohashGrid) Valid(cell Cell) bool {
+	p := geohashPrecision(cell)
+	return p >= 1 && p <= geohashMaxPrecision && uint64(cell)>>(4+5*p) == 0
+}
+
+func (geohashGrid) Token(cell Cell) string {
+	p := geohashPrecision(cell)
+	bits := uint64(cell) >> 4
+	out := make([]byte, p)
+	for i := p - 1; i >= 0; i-- {
+		out[i] = geohashAlphabet[bits&31]
+		bits >>= 5
+	}
+	return string(out)
+}
+
+func (geohashGrid) Resolution(cell Cell) int { return geohashPrecision(cell) }
+
+// Parent is the geohash prefix of the given precision.
+func (geohashGrid) Parent(cell Cell, precision int) Cell {
+	p := geohashPrecision(cell)
+	if precision < 1 || precision >= p {
+		return cell
+	}
+	bits := uint64(cell) >> 4 >> (5 * (p - precision))
+	return Cell(bits<<4 | uint64(precision))
+}
+
+func (g geohashGrid) Polygon(cell Cell) (orb.Polygon, error) {
+	if !g.Valid(cell) {
+		return nil, fmt.Errorf("%w: geohash %d", ErrInvalidCell, uint64(cell))
+	}
+
+	p := geohashPrecision(cell)
+	bits := uint64(cell) >> 4
+	minLng, maxLng := -180.0, 180.0
+	minLat, maxLat := -90.0, 90.0
+	total := 5 * p
+	for i := 0; i < total; i++ {
+		bit := (bits >> (total - 1 - i)) & 1
+		// Even bits refine longitude, odd bits latitude.
+		if i%2 == 0 {
+			mid := (minLng + maxLng) / 2
+			if bit == 1 {
+				minLng = mid
+			} else {
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if bit == 1 {
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+	}
+
+	bound := orb.Bound{Min: orb.Point{minLng, minLat}, Max: orb.Point{maxLng, maxLat}}
+	return bound.ToPolygon(), nil
+}
+
+// MaxZoom picks the zoom at which a cell spans about an eighth of a tile, in line with the
+// H3 heuristic (precision 6 → z12).
+func (geohashGrid) MaxZoom(precision int) int {
+	lngBits := (5*precision + 1) / 2
+	return clampZoom(lngBits - 3)
+}
+
+func (geohashGrid) Parse(value any) (Cell, string, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return 0, "", nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	trimmed := strings.ToLower(strings.TrimSpace(s))
+	if trimmed == "" {
+		return 0, "", nil
+	}
+	if len(trimmed) > geohashMaxPrecision {
+		return 0, trimmed, fmt.Errorf("%w: geohash %q longer than %d characters", ErrInvalidCell, trimmed, geohashMaxPrecision)
+	}
+
+	var bits uint64
+	for _, r := range trimmed {
+		idx := strings.IndexRune(geohashAlphabet, r)
+		if idx < 0 {
+			return 0, trimmed, fmt.Errorf("%w: geohash %q contains %q", ErrInvalidCell, trimmed, r)
+		}
+		bits = bits<<5 | uint64(idx)
+	}
+	return Cell(bits<<4 | uint64(len(trimmed))), trimmed, nil
+}
+
+func geohashPrecision(cell Cell) int {
+	return int(uint64(cell) & 0xF)
+}
@@ -0,0 +1,168 @@
+package grid
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+)
+
+// Cell is a packed 64-bit cell identifier. Its interpretation belongs to the CellGeometry that produced it.
+type Cell uint64
+
+// CellGeometry abstracts a discrete global grid system so the pipeline can read, validate and
+// polygonize cells without knowing which grid they come from.
+type CellGeometry interface {
+	// Name is the short identifier used for --grid and as the feature ID property.
+	Name() string
+	// Columns lists the lower-case column names recognised as holding cell identifiers.
+	Columns() []string
+	// Parse converts a raw column value into a cell. Empty values return (0, "", nil).
+	Parse(value any) (Cell, string, error)
+	// Valid reports whether the cell is a valid identifier for this grid.
+	Valid(cell Cell) bool
+	// Token returns the canonical string form of the cell.
+	Token(cell Cell) string
+	// Resolution returns the cell's level of detail.
+	Resolution(cell Cell) int
+	// Parent returns the cell's ancestor at a coarser resolution. A cell at or above that
+	// resolution is returned unchanged.
+	Parent(cell Cell, resolution int) Cell
+	// Polygon returns the cell boundary as a closed GeoJSON ring.
+	Polygon(cell Cell) (orb.Polygon, error)
+	// MaxZoom suggests the deepest tile zoom worth generating for the given resolution.
+	MaxZoom(resolution int) int
+}
+
+// BatchPolygonizer is implemented by grids that polygonize many cells faster together than one
+// at a time.
+type BatchPolygonizer interface {
+	// Polygons returns, for each cell, what Polygon would return for it.
+	Polygons(cells []Cell) ([]orb.Polygon, []error)
+}
+
+// Polygons polygonizes cells in one batch when g supports it and one by one otherwise.
+func Polygons(g CellGeometry, cells []Cell) ([]orb.Polygon, []error) {
+	if b, ok := g.(BatchPolygonizer); ok {
+		return b.Polygons(cells)
+	}
+	polygons := make([]orb.Polygon, len(cells))
+	errs := make([]error, len(cells))
+	for i, cell := range cells {
+		polygons[i], errs[i] = g.Polygon(cell)
+	}
+	return polygons, errs
+}
+
+// ErrInvalidCell is wrapped by Parse and Polygon errors for malformed identifiers.
+var ErrInvalidCell = errors.New("invalid cell")
+
+// ErrCoordinates is wrapped by CheckCoordinates errors for boundaries outside the globe.
+var ErrCoordinates = errors.New("coordinates out of range")
+
+// coordinateSlack is how far past ±90 latitude or ±180 longitude a vertex may lie and still be
+// taken for rounding noise of a cell touching a pole or the antimeridian.
+const coordinateSlack = 1e-9
+
+// CheckCoordinates verifies that every vertex of p is finite with a latitude within ±90 and a
+// longitude within ±180. Corrupt indexes can pass Valid yet yield boundaries far off the globe.
+// Vertices within rounding noise of a limit are normalized onto it in place.
+func CheckCoordinates(p orb.Polygon) error {
+	for _, ring := range p {
+		for i, pt := range ring {
+			lng, lat := pt[0], pt[1]
+			if math.IsNaN(lng) || math.IsNaN(lat) || math.IsInf(lng, 0) || math.IsInf(lat, 0) {
+				return fmt.Errorf("%w: vertex (%g, %g) is not finite", ErrCoordinates, lng, lat)
+			}
+			if math.Abs(lat) > 90+coordinateSlack {
+				return fmt.Errorf("%w: latitude %g outside ±90", ErrCoordinates, lat)
+			}
+			if math.Abs(lng) > 180+coordinateSlack {
+				return fmt.Errorf("%w: longitude %g outside ±180", ErrCoordinates, lng)
+			}
+			ring[i] = orb.Point{math.Max(-180, math.Min(180, lng)), math.Max(-90, math.Min(90, lat))}
+		}
+	}
+	return nil
+}
+
+var registry = map[string]CellGeometry{}
+
+// Register makes a grid available to Lookup. It panics on duplicate names.
+func Register(g CellGeometry) {
+	name := strings.ToLower(g.Name())
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("grid %q already registered", name))
+	}
+	registry[name] = g
+}
+
+// Lookup returns the named grid. An empty name selects H3.
+func Lookup(name string) (CellGeometry, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		key = "h3"
+	}
+	g, ok := registry[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown grid %q (expected one of: %s)", name, strings.Join(Names(), ", "))
+	}
+	return g, nil
+}
+
+// Default returns the H3 grid.
+func Default() CellGeometry {
+	g, _ := Lookup("h3")
+	return g
+}
+
+// Names lists the registered grids in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsCellColumn reports whether name is one of the grid's identifier columns.
+func IsCellColumn(g CellGeometry, name string) bool {
+	lname := strings.ToLower(name)
+	for _, candidate := range g.Columns() {
+		if lname == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSuggestedZoom bounds the grid heuristics at the deepest zoom tippecanoe can generate; the
+// build applies its own, lower zoom cap on top.
+const maxSuggestedZoom = 24
+
+// clampZoom applies the shared zoom heuristic: at least 12 so sparse datasets still render
+// nicely, and at most maxSuggestedZoom.
+func clampZoom(zoom int) int {
+	if zoom < 12 {
+		zoom = 12
+	}
+	if zoom > maxSuggestedZoom {
+		zoom = maxSuggestedZoom
+	}
+	return zoom
+}
+
+func closeRing(ring orb.Ring) orb.Ring {
+	if len(ring) == 0 {
+		return ring
+	}
+	first, last := ring[0], ring[len(ring)-1]
+	if first[0] != last[0] || first[1] != last[1] {
+		ring = append(ring, first)
+	}
+	return ring
+}
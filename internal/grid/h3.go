@@ -0,0 +1,122 @@
+package grid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+
+	h3geom "github.com/hexatiles/hexatiles/internal/h3"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+func init() {
+	Register(h3Grid{})
+}
+
+// h3Grid adapts internal/h3 to the CellGeometry interface.
+type h3Grid struct{}
+
+func (h3Grid) Name() string { return "h3" }
+
+func (h3Grid) Columns() []string {
+	return []string{"h3", "h3_id", "h3index", "h3_index", "h3id", "cell", "cell_id"}
+}
+
+func (h3Grid) Valid(cell Cell) bool { return h3.Cell(cell).IsValid() }
+
+func (h3Grid) Token(cell Cell) string { return h3.IndexToString(uint64(cell)) }
+
+func (h3Grid) Resolution(cell Cell) int { return h3.Cell(cell).Resolution() }
+
+func (h3Grid) Parent(cell Cell, resolution int) Cell {
+	c := h3.Cell(cell)
+	if resolution < 0 || resolution >= c.Resolution() {
+		return cell
+	}
+	parent, err := c.Parent(resolution)
+	if err != nil {
+		return cell
+	}
+	return Cell(parent)
+}
+
+func (h3Grid) Polygon(cell Cell) (orb.Polygon, error) {
+	return h3geom.PolygonFromCell(h3.Cell(cell))
+}
+
+// Polygons resolves the whole batch in one cgo call.
+func (h3Grid) Polygons(cells []Cell) ([]orb.Polygon, []error) {
+	ids := make([]h3.Cell, len(cells))
+	for i, cell := range cells {
+		ids[i] = h3.Cell(cell)
+	}
+	return h3geom.PolygonsFromCells(ids)
+}
+
+func (h3Grid) MaxZoom(resolution int) int { return clampZoom(resolution + 2) }
+
+func (h3Grid) Parse(value any) (Cell, string, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, "", nil
+	case string:
+		return parseH3String(v)
+	case []byte:
+		return parseH3String(string(v))
+	case fmt.Stringer:
+		return parseH3String(v.String())
+	case int:
+		return h3FromInt(int64(v))
+	case int32:
+		return h3FromInt(int64(v))
+	case int64:
+		return h3FromInt(v)
+	case uint:
+		return h3FromUint(uint64(v))
+	case uint32:
+		return h3FromUint(uint64(v))
+	case uint64:
+		return h3FromUint(v)
+	case float32:
+		if v < 0 {
+			return 0, fmt.Sprint(v), fmt.Errorf("negative float %f", v)
+		}
+		return h3FromUint(uint64(v))
+	case float64:
+		if v < 0 {
+			return 0, fmt.Sprint(v), fmt.Errorf("negative float %f", v)
+		}
+		return h3FromUint(uint64(v))
+	default:
+		return parseH3String(fmt.Sprint(v))
+	}
+}
+
+func h3FromInt(v int64) (Cell, string, error) {
+	if v < 0 {
+		return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+	}
+	return h3FromUint(uint64(v))
+}
+
+func h3FromUint(v uint64) (Cell, string, error) {
+	if err := h3geom.CheckIndex(v); err != nil {
+		return 0, strconv.FormatUint(v, 10), fmt.Errorf("H3 index %d: %w", v, err)
+	}
+	return Cell(v), h3.IndexToString(v), nil
+}
+
+// parseH3String applies the normalization rules of h3geom.ParseCell; blank strings are nulls.
+func parseH3String(s string) (Cell, string, error) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return 0, "", nil
+	}
+	cell, err := h3geom.ParseCell(trimmed)
+	if err != nil {
+		return 0, trimmed, err
+	}
+	return Cell(cell), h3.IndexToString(uint64(cell)), nil
+}
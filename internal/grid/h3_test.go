@@ -0,0 +1,34 @@
+package grid
+
+import "testing"
+
+// FuzzH3Parse checks that Parse never panics on strings, signed or unsigned integers, and that
+// every cell it accepts round-trips through its token and its integer form.
+func FuzzH3Parse(f *testing.F) {
+	f.Add("8828308281fffff", int64(0x8828308281fffff), uint64(0x8828308281fffff))
+	f.Add(" 0X8828308281FFFFF ", int64(-1), uint64(0))
+	f.Add("613196570331545599", int64(0), ^uint64(0))
+	f.Add("8009fffffffffff", int64(0x8009fffffffffff), uint64(0xc828308281fffff))
+	f.Add("not a cell", int64(1), uint64(1))
+	g := h3Grid{}
+	f.Fuzz(func(t *testing.T, s string, i int64, u uint64) {
+		for _, value := range []any{s, []byte(s), i, u} {
+			cell, token, err := g.Parse(value)
+			if err != nil || (cell == 0 && token == "") {
+				continue
+			}
+			if !g.Valid(cell) {
+				t.Fatalf("Parse(%#v) = %x, an invalid cell", value, uint64(cell))
+			}
+			if token != g.Token(cell) {
+				t.Fatalf("Parse(%#v) token %q, want %q", value, token, g.Token(cell))
+			}
+			for _, form := range []any{g.Token(cell), uint64(cell), int64(cell)} {
+				again, _, err := g.Parse(form)
+				if err != nil || again != cell {
+					t.Fatalf("Parse(%#v) = %x, %v; want %x", form, uint64(again), err, uint64(cell))
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package grid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+)
+
+func init() {
+	Register(quadbinGrid{})
+}
+
+// Quadbin layout (CARTO): header bit 62, mode 1 in bits 59-61, resolution in bits 52-56 and the
+// interleaved tile x/y in the remaining 52 bits, with unused trailing bits set to 1.
+const (
+	quadbinHeader     = uint64(0x4000000000000000)
+	quadbinModeCell   = uint64(1) << 59
+	quadbinModeMask   = uint64(7) << 59
+	quadbinFooter     = uint64(0xFFFFFFFFFFFFF)
+	quadbinMaxRes     = 26
+	quadbinResShift   = 52
+	quadbinResMask    = uint64(0x1F)
+	quadbinPayloadLen = 52
+)
+
+// quadbinGrid polygonizes CARTO quadbin cells, which are Web Mercator tiles packed into 64 bits.
+type quadbinGrid struct{}
+
+func (quadbinGrid) Name() string { return "quadbin" }
+
+func (quadbinGrid) Columns() []string {
+	return []string{"quadbin", "quadbin_id", "qb", "cell", "cell_id"}
+}
+
+func (quadbinGrid) Valid(cell Cell) bool {
+	v := uint64(cell)
+	if v&quadbinHeader == 0 || v&quadbinModeMask != quadbinModeCell {
+		return false
+	}
+	res := int((v >> quadbinResShift) & quadbinResMask)
+	if res > quadbinMaxRes {
+		return false
+	}
+	unused := quadbinFooter >> (2 * res)
+	return v&unused == unused
+}
+
+func (quadbinGrid) Token(cell Cell) string { return strconv.FormatUint(uint64(cell), 16) }
+
+func (quadbinGrid) Resolution(cell Cell) int {
+	return int((uint64(cell) >> quadbinResShift) & quadbinResMask)
+}
+
+// Parent keeps the leading 2*resolution bits of the tile key and refills the rest with ones.
+func (g quadbinGrid) Parent(cell Cell, resolution int) Cell {
+	res := g.Resolution(cell)
+	if resolution < 0 || resolution >= res {
+		return cell
+	}
+	v := uint64(cell)
+	key := (v & quadbinFooter) >> (quadbinPayloadLen - 2*res) >> (2 * (res - resolution))
+	out := quadbinHeader | quadbinModeCell | uint64(resolution)<<quadbinResShift
+	if resolution > 0 {
+		out |= key << (quadbinPayloadLen - 2*resolution)
+	}
+	return Cell(out | quadbinFooter>>(2*resolution))
+}
+
+func (g quadbinGrid) Polygon(cell Cell) (orb.Polygon, error) {
+	if !g.Valid(cell) {
+		return nil, fmt.Errorf("%w: quadbin %x", ErrInvalidCell, uint64(cell))
+	}
+	tile := quadbinTile(cell)
+	return tile.Bound().ToPolygon(), nil
+}
+
+// MaxZoom maps a quadbin resolution to the zoom at which each cell is exactly one tile.
+func (quadbinGrid) MaxZoom(resolution int) int { return clampZoom(resolution) }
+
+func (quadbinGrid) Parse(value any) (Cell, string, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, "", nil
+	case string:
+		return parseQuadbinString(v)
+	case []byte:
+		return parseQuadbinString(string(v))
+	case int64:
+		// BigQuery and Snowflake export quadbins as signed INT64; the header bit keeps them positive.
+		if v < 0 {
+			return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+		}
+		return Cell(v), strconv.FormatUint(uint64(v), 16), nil
+	case uint64:
+		return Cell(v), strconv.FormatUint(v, 16), nil
+	default:
+		return parseQuadbinString(fmt.Sprint(v))
+	}
+}
+
+func parseQuadbinString(s string) (Cell, string, error) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return 0, "", nil
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(trimmed, "0x"), "0X")
+	// Quadbins are 16 hex digits; longer strings are the decimal form.
+	base := 16
+	if len(digits) > 16 {
+		base = 10
+	}
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, trimmed, fmt.Errorf("parse quadbin %q: %w", trimmed, err)
+	}
+	return Cell(value), strconv.FormatUint(value, 16), nil
+}
+
+func quadbinTile(cell Cell) maptile.Tile {
+	v := uint64(cell)
+	z := int((v >> quadbinResShift) & quadbinResMask)
+	key := (v & quadbinFooter) >> (quadbinPayloadLen - 2*z)
+	return maptile.FromQuadkey(key, maptile.Zoom(z))
+}
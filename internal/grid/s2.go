@@ -0,0 +1,109 @@
+package grid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/paulmach/orb"
+)
+
+func init() {
+	Register(s2Grid{})
+}
+
+// s2Grid polygonizes S2 cells given as tokens ("89c25") or 64-bit cell IDs.
+type s2Grid struct{}
+
+func (s2Grid) Name() string { return "s2" }
+
+func (s2Grid) Columns() []string {
+	return []string{"s2", "s2_id", "s2id", "s2_cell", "s2cell", "s2_token", "cell", "cell_id"}
+}
+
+func (s2Grid) Valid(cell Cell) bool { return s2.CellID(cell).IsValid() }
+
+func (s2Grid) Token(cell Cell) string { return s2.CellID(cell).ToToken() }
+
+func (s2Grid) Resolution(cell Cell) int { return s2.CellID(cell).Level() }
+
+func (s2Grid) Parent(cell Cell, level int) Cell {
+	id := s2.CellID(cell)
+	if level < 0 || level >= id.Level() {
+		return cell
+	}
+	return Cell(id.Parent(level))
+}
+
+func (s2Grid) Polygon(cell Cell) (orb.Polygon, error) {
+	id := s2.CellID(cell)
+	if !id.IsValid() {
+		return nil, fmt.Errorf("%w: S2 cell %d", ErrInvalidCell, uint64(cell))
+	}
+	c := s2.CellFromCellID(id)
+	ring := make(orb.Ring, 0, 5)
+	for k := 0; k < 4; k++ {
+		ll := s2.LatLngFromPoint(c.Vertex(k))
+		ring = append(ring, orb.Point{ll.Lng.Degrees(), ll.Lat.Degrees()})
+	}
+	return orb.Polygon{closeRing(ring)}, nil
+}
+
+// MaxZoom maps S2 levels onto tile zooms; a level-L cell spans roughly one zoom-L tile.
+func (s2Grid) MaxZoom(level int) int { return clampZoom(level + 2) }
+
+func (s2Grid) Parse(value any) (Cell, string, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, "", nil
+	case string:
+		return parseS2String(v)
+	case []byte:
+		return parseS2String(string(v))
+	case int32:
+		return s2FromInt(int64(v))
+	case int64:
+		// Signed 64-bit columns commonly carry S2 IDs with the top bit set (BigQuery INT64).
+		return s2FromUint(uint64(v))
+	case int:
+		return s2FromInt(int64(v))
+	case uint32:
+		return s2FromUint(uint64(v))
+	case uint64:
+		return s2FromUint(v)
+	default:
+		return parseS2String(fmt.Sprint(v))
+	}
+}
+
+func s2FromInt(v int64) (Cell, string, error) {
+	if v < 0 {
+		return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+	}
+	return s2FromUint(uint64(v))
+}
+
+func s2FromUint(v uint64) (Cell, string, error) {
+	return Cell(v), s2.CellID(v).ToToken(), nil
+}
+
+func parseS2String(s string) (Cell, string, error) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return 0, "", nil
+	}
+	// Decimal cell IDs are 19-20 digits; tokens are at most 16 hex characters.
+	if len(trimmed) > 16 {
+		value, err := strconv.ParseUint(trimmed, 10, 64)
+		if err != nil {
+			return 0, trimmed, fmt.Errorf("parse S2 cell ID %q: %w", trimmed, err)
+		}
+		return s2FromUint(value)
+	}
+	id := s2.CellIDFromToken(trimmed)
+	if id == 0 || !id.IsValid() {
+		return 0, trimmed, fmt.Errorf("%w: S2 token %q", ErrInvalidCell, trimmed)
+	}
+	return Cell(id), id.ToToken(), nil
+}
@@ -0,0 +1,170 @@
+package h3geom
+
+/*
+#include <stdint.h>
+
+// Declarations of the H3 library functions internal/h3lib links, either compiled into
+// github.com/uber/h3-go or, under -tags h3_system, from libh3; the layouts match h3api.h.
+typedef uint64_t H3Index;
+typedef uint32_t H3Error;
+typedef struct { double lat; double lng; } LatLng;
+typedef struct { int numVerts; LatLng verts[10]; } CellBoundary;
+
+int isValidCell(H3Index h);
+H3Error cellToBoundary(H3Index h3, CellBoundary *gp);
+H3Error cellToVertexes(H3Index origin, H3Index *vertexes);
+H3Error vertexToLatLng(H3Index vertex, LatLng *point);
+
+// The vertex cache remembers resolved vertices within one batch. Each vertex is shared by
+// three cells, and resolving one costs a full boundary computation of its owner cell, so cells
+// that are neighbours in the batch skip most of that work. It holds 1<<bits entries.
+typedef struct { H3Index id; LatLng ll; } vertexEntry;
+
+static int cachedVertex(vertexEntry *cache, int bits, H3Index id, LatLng *out) {
+	uint64_t slot = (id * 0x9E3779B97F4A7C15ull) >> (64 - bits);
+	while (cache[slot].id != 0) {
+		if (cache[slot].id == id) {
+			*out = cache[slot].ll;
+			return 0;
+		}
+		slot = (slot + 1) & ((1ull << bits) - 1);
+	}
+	if (vertexToLatLng(id, out) != 0) {
+		return 1;
+	}
+	cache[slot].id = id;
+	cache[slot].ll = *out;
+	return 0;
+}
+
+// hexatiles_polygonize resolves the boundary and the canonical vertices of n cells in one
+// call. status[i] is zero when cell i succeeded; otherwise the caller works out the error.
+static void hexatiles_polygonize(const H3Index *cells, int n, CellBoundary *boundaries,
+		LatLng *vertexes, int *numVertexes, int *status, vertexEntry *cache, int cacheBits) {
+	for (int i = 0; i < n; i++) {
+		status[i] = 1;
+		numVertexes[i] = 0;
+		if (!isValidCell(cells[i]) || cellToBoundary(cells[i], &boundaries[i]) != 0 ||
+				boundaries[i].numVerts == 0) {
+			continue;
+		}
+		H3Index ids[6];
+		if (cellToVertexes(cells[i], ids) != 0) {
+			continue;
+		}
+		int ok = 1;
+		for (int v = 0; v < 6; v++) {
+			// Pentagons have five vertices; the sixth slot is H3_NULL.
+			if (ids[v] == 0) {
+				continue;
+			}
+			if (cachedVertex(cache, cacheBits, ids[v], &vertexes[i*6+numVertexes[i]]) != 0) {
+				ok = 0;
+				break;
+			}
+			numVertexes[i]++;
+		}
+		if (ok) {
+			status[i] = 0;
+		}
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/paulmach/orb"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+// maxBatch bounds the C scratch buffers of one PolygonsFromCells call; larger batches are
+// processed in chunks.
+const maxBatch = 1024
+
+// PolygonsFromCells polygonizes a batch of cells as PolygonFromCell does, but the H3 work for
+// the whole batch is done in a single cgo call, which matters at fine resolutions where the
+// call overhead rivals the geometry itself, and each shared vertex is resolved only once.
+func PolygonsFromCells(cells []h3.Cell) ([]orb.Polygon, []error) {
+	polygons := make([]orb.Polygon, len(cells))
+	errs := make([]error, len(cells))
+	for start := 0; start < len(cells); start += maxBatch {
+		end := min(start+maxBatch, len(cells))
+		polygonizeChunk(cells[start:end], polygons[start:end], errs[start:end])
+	}
+	return polygons, errs
+}
+
+func polygonizeChunk(cells []h3.Cell, polygons []orb.Polygon, errs []error) {
+	n := len(cells)
+	if n == 0 {
+		return
+	}
+	ids := make([]C.H3Index, n)
+	for i, cell := range cells {
+		ids[i] = C.H3Index(cell)
+	}
+	boundaries := make([]C.CellBoundary, n)
+	vertexes := make([]C.LatLng, n*6)
+	numVertexes := make([]C.int, n)
+	status := make([]C.int, n)
+	// Room for 6 vertices per cell at a load factor of at most 3/4.
+	cacheBits := bits.Len(uint(8*n - 1))
+	cache := make([]C.vertexEntry, 1<<cacheBits)
+	C.hexatiles_polygonize(&ids[0], C.int(n), &boundaries[0], &vertexes[0], &numVertexes[0], &status[0], &cache[0], C.int(cacheBits))
+
+	canonical := make([]orb.Point, 0, 6)
+	for i := range cells {
+		if status[i] != 0 {
+			errs[i] = cellError(cells[i])
+			continue
+		}
+		canonical = canonical[:0]
+		for _, v := range vertexes[i*6 : i*6+int(numVertexes[i])] {
+			canonical = append(canonical, degrees(v))
+		}
+		b := &boundaries[i]
+		ring := make(orb.Ring, 0, int(b.numVerts)+1)
+		for _, v := range b.verts[:b.numVerts] {
+			ring = append(ring, snapVertex(degrees(v), canonical))
+		}
+		if !ringClosed(ring) {
+			ring = append(ring, ring[0])
+		}
+		windCounterClockwise(ring)
+		polygons[i] = orb.Polygon{ring}
+	}
+}
+
+// cellError works out why the batch could not polygonize cell.
+func cellError(cell h3.Cell) error {
+	if !cell.IsValid() {
+		return fmt.Errorf("invalid H3 cell index")
+	}
+	boundary, err := cell.Boundary()
+	if err != nil {
+		return fmt.Errorf("compute boundary: %w", err)
+	}
+	if len(boundary) == 0 {
+		return fmt.Errorf("empty boundary for cell %s", cell.String())
+	}
+	vertexes, err := h3.CellToVertexes(cell)
+	if err != nil {
+		return fmt.Errorf("compute vertexes: %w", err)
+	}
+	for _, vertex := range vertexes {
+		if _, err := h3.VertexToLatLng(vertex); err != nil {
+			return fmt.Errorf("compute vertex %s: %w", vertex.String(), err)
+		}
+	}
+	return fmt.Errorf("polygonize cell %s", cell.String())
+}
+
+// degrees converts a C coordinate the way h3-go does, so batch and single-cell polygons are
+// bit-identical.
+func degrees(ll C.LatLng) orb.Point {
+	return orb.Point{h3.RadsToDegs * float64(ll.lng), h3.RadsToDegs * float64(ll.lat)}
+}
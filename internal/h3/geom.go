@@ -1,36 +1,62 @@
 package h3geom
 
 import (
-	"fmt"
+	"math"
 
 	"github.com/paulmach/orb"
-	h3 "github.com/uber/h3-go/v4"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
 )
 
+// vertexSnapTolerance is the maximum distance (in degrees) between a boundary vertex and a
+// canonical H3 vertex for the two to be considered the same point. It must exceed the
+// rounding difference between cellToBoundary and vertexToLatLng, around 1e-13°, and stay
+// well below the distance between two vertices of one cell, about 5e-6° at resolution 15.
+// Snapping moves a point by at most 1e-9°, a fifth of the MVT quantization step at z24
+// (360° / 2^24 / 4096 ≈ 5.4e-9°), so it never shifts a vertex by more than the grid rounds
+// it anyway; it only makes neighbouring cells round a shared vertex the same way.
+const vertexSnapTolerance = 1e-9
+
 // PolygonFromCell returns the GeoJSON polygon representing the boundary of an H3 cell.
+//
+// Boundary vertices shared with neighbouring cells are snapped to the coordinates of
+// their canonical H3 vertex index, so adjacent cells emit bit-identical shared edges and
+// tile quantization cannot open hairline gaps or overlaps between them. The work is one cgo
+// call; polygonize many cells with PolygonsFromCells, which resolves each shared vertex once.
 func PolygonFromCell(cell h3.Cell) (orb.Polygon, error) {
-	if !cell.IsValid() {
-		return nil, fmt.Errorf("invalid H3 cell index")
-	}
+	polygons, errs := PolygonsFromCells([]h3.Cell{cell})
+	return polygons[0], errs[0]
+}
 
-	boundary, err := cell.Boundary()
-	if err != nil {
-		return nil, fmt.Errorf("compute boundary: %w", err)
-	}
-	if len(boundary) == 0 {
-		return nil, fmt.Errorf("empty boundary for cell %s", cell.String())
+// snapVertex replaces p with the matching canonical vertex. Distortion vertices introduced on
+// icosahedron edges have no canonical counterpart and are returned unchanged.
+func snapVertex(p orb.Point, canonical []orb.Point) orb.Point {
+	for _, c := range canonical {
+		if math.Abs(p[0]-c[0]) <= vertexSnapTolerance && math.Abs(p[1]-c[1]) <= vertexSnapTolerance {
+			return c
+		}
 	}
+	return p
+}
 
-	ring := make(orb.Ring, 0, len(boundary)+1)
-	for _, vertex := range boundary {
-		ring = append(ring, orb.Point{vertex.Lng, vertex.Lat})
+// windCounterClockwise reverses ring unless it runs counter-clockwise, as RFC 7946 requires of
+// exterior rings. H3 returns boundaries in that order; the check guards the cells whose
+// vertices straddle the antimeridian: the shoelace sum is taken over longitude differences
+// folded into [-180, 180], so the jump between +180 and -180 does not flip the sign.
+func windCounterClockwise(ring orb.Ring) {
+	var area float64
+	for i := 0; i+1 < len(ring); i++ {
+		d := ring[i+1][0] - ring[i][0]
+		if d > 180 {
+			d -= 360
+		} else if d < -180 {
+			d += 360
+		}
+		area -= d * (ring[i][1] + ring[i+1][1])
 	}
-
-	if !ringClosed(ring) {
-		ring = append(ring, ring[0])
+	if area < 0 {
+		ring.Reverse()
 	}
-
-	return orb.Polygon{ring}, nil
 }
 
 func ringClosed(ring orb.Ring) bool {
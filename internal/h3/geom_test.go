@@ -0,0 +1,63 @@
+package h3geom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+// TestSharedVerticesSnap checks that neighbouring cells emit bit-identical shared vertices
+// and that single-cell and batch polygons agree, including across batch chunks.
+func TestSharedVerticesSnap(t *testing.T) {
+	var cells []h3.Cell
+	for _, origin := range []string{"8828308281fffff", "8a0800000007fff"} {
+		disk, err := h3.GridDisk(h3.Cell(h3.IndexFromString(origin)), 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cells = append(cells, disk...)
+	}
+	if len(cells) <= maxBatch {
+		t.Fatalf("%d cells fit in one batch; the test needs several", len(cells))
+	}
+
+	polygons, errs := PolygonsFromCells(cells)
+	uses := make(map[orb.Point]int)
+	for i, cell := range cells {
+		if errs[i] != nil {
+			t.Fatalf("cell %s: %v", cell, errs[i])
+		}
+		single, err := PolygonFromCell(cell)
+		if err != nil || !reflect.DeepEqual(single, polygons[i]) {
+			t.Fatalf("cell %s: PolygonFromCell = %v, %v; batch gave %v", cell, single, err, polygons[i])
+		}
+		ring := polygons[i][0]
+		for _, p := range ring[:len(ring)-1] {
+			uses[p]++
+		}
+	}
+	// Inside the disks every vertex is shared by three cells; only unsnapped vertices would
+	// appear once or twice there, and the rim accounts for the rest.
+	shared := 0
+	for _, n := range uses {
+		if n == 3 {
+			shared++
+		}
+	}
+	if shared < len(uses)/2 {
+		t.Errorf("%d of %d distinct vertices are shared by three cells", shared, len(uses))
+	}
+}
+
+func TestPolygonFromInvalidCell(t *testing.T) {
+	if _, err := PolygonFromCell(h3.Cell(h3.IndexFromString("0828308281fffff"))); err == nil || err.Error() != "invalid H3 cell index" {
+		t.Errorf("error %v, want invalid H3 cell index", err)
+	}
+	polygons, errs := PolygonsFromCells([]h3.Cell{h3.Cell(h3.IndexFromString("8828308281fffff")), 0})
+	if errs[0] != nil || polygons[0] == nil || errs[1] == nil || polygons[1] != nil {
+		t.Errorf("batch of a valid and an invalid cell: %v, %v", polygons, errs)
+	}
+}
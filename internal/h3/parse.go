@@ -0,0 +1,121 @@
+package h3geom
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+// H3 index bit layout (https://h3geo.org/docs/core-library/h3Indexing).
+const (
+	h3ReservedBit   = 63
+	h3ModeOffset    = 59
+	h3ModeReserved  = 56
+	h3ResOffset     = 52
+	h3BaseOffset    = 45
+	h3DigitBits     = 3
+	h3MaxResolution = 15
+	h3NumBaseCells  = 122
+	h3CellMode      = 1
+	h3UnusedDigit   = 7
+)
+
+// ErrEmptyCell is returned by ParseCell for blank input.
+var ErrEmptyCell = errors.New("empty H3 index")
+
+// ParseCell parses a textual H3 cell index using these normalization rules:
+//
+//   - Surrounding whitespace is ignored; blank input is ErrEmptyCell.
+//   - Input is hexadecimal, case-insensitive, with an optional 0x/0X prefix and at most 16 digits.
+//   - Unprefixed all-digit input that is not a valid cell as hex is read as a decimal uint64,
+//     the form some exporters use. The decimal reading must itself be a valid cell.
+//   - The result must pass CheckIndex: reserved bits clear, cell mode, and a valid layout.
+func ParseCell(s string) (h3.Cell, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrEmptyCell
+	}
+
+	digits, prefixed := strings.CutPrefix(s, "0x")
+	if !prefixed {
+		digits, prefixed = strings.CutPrefix(s, "0X")
+	}
+	decimal := !prefixed && isDecimal(digits)
+
+	var hexErr error
+	switch value, err := strconv.ParseUint(digits, 16, 64); {
+	case digits == "" || len(digits) > 16 || err != nil:
+		hexErr = errors.New("expected 1-16 hex digits")
+	default:
+		if hexErr = CheckIndex(value); hexErr == nil {
+			return h3.Cell(value), nil
+		}
+	}
+	if !decimal {
+		return 0, fmt.Errorf("H3 index %q: %w", s, hexErr)
+	}
+
+	value, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		err = errors.New("out of uint64 range")
+	} else {
+		err = CheckIndex(value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("H3 index %q: not a valid cell as hex (%v) or decimal (%v)", s, hexErr, err)
+	}
+	return h3.Cell(value), nil
+}
+
+// NormalizeCell parses s with ParseCell and returns the canonical lowercase hex form.
+func NormalizeCell(s string) (string, error) {
+	cell, err := ParseCell(s)
+	if err != nil {
+		return "", err
+	}
+	return h3.IndexToString(uint64(cell)), nil
+}
+
+// CheckIndex reports why v is not a valid H3 cell index, or nil if it is. Set reserved bits are
+// rejected rather than masked, so an index is never silently turned into a different cell.
+func CheckIndex(v uint64) error {
+	if v>>h3ReservedBit&1 != 0 {
+		return errors.New("reserved high bit is set")
+	}
+	if mode := v >> h3ModeOffset & 0xf; mode != h3CellMode {
+		return fmt.Errorf("index mode %d is not a cell (mode 1)", mode)
+	}
+	if v>>h3ModeReserved&0x7 != 0 {
+		return errors.New("reserved mode bits are set")
+	}
+	res := int(v >> h3ResOffset & 0xf)
+	if base := v >> h3BaseOffset & 0x7f; base >= h3NumBaseCells {
+		return fmt.Errorf("base cell %d out of range", base)
+	}
+	for r := 1; r <= h3MaxResolution; r++ {
+		digit := v >> ((h3MaxResolution - r) * h3DigitBits) & 0x7
+		if r <= res && digit == h3UnusedDigit {
+			return fmt.Errorf("digit %d is unused (7) within resolution %d", r, res)
+		}
+		if r > res && digit != h3UnusedDigit {
+			return fmt.Errorf("digit %d below resolution %d is not 7", r, res)
+		}
+	}
+	if !h3.Cell(v).IsValid() {
+		// Remaining case: a pentagon cell on the deleted k-axis subsequence.
+		return errors.New("deleted pentagon subsequence")
+	}
+	return nil
+}
+
+func isDecimal(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
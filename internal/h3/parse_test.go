@@ -0,0 +1,81 @@
+package h3geom
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+var parseSeeds = []string{
+	"8828308281fffff",
+	"8828308281FFFFF",
+	"  0x8828308281fffff\n",
+	"0X8828308281FFFFF",
+	"613196570331545599", // 8828308281fffff in decimal
+	"8009fffffffffff",    // resolution 0 pentagon
+	"c828308281fffff",    // reserved high bit set
+	"0828308281fffff",    // mode 0
+	"88283082817ffff",    // unused digit within the resolution
+	"18446744073709551615",
+	"",
+	"0x",
+	"ffffffffffffffffff",
+	"-1",
+}
+
+// FuzzParseCell checks that ParseCell never panics, only returns valid cells, and that every
+// spelling the normalization rules allow of a parsed cell parses back to the same cell.
+func FuzzParseCell(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		cell, err := ParseCell(s)
+		if err != nil {
+			if cell != 0 {
+				t.Fatalf("ParseCell(%q) returned %x with error %v", s, uint64(cell), err)
+			}
+			return
+		}
+		if err := CheckIndex(uint64(cell)); err != nil {
+			t.Fatalf("ParseCell(%q) = %x, which CheckIndex rejects: %v", s, uint64(cell), err)
+		}
+		canonical := h3.IndexToString(uint64(cell))
+		for _, form := range []string{canonical, strings.ToUpper(canonical), "0x" + canonical, " \t" + canonical + "\n"} {
+			again, err := ParseCell(form)
+			if err != nil || again != cell {
+				t.Fatalf("ParseCell(%q) = %x, %v; want %x", form, uint64(again), err, uint64(cell))
+			}
+		}
+		normalized, err := NormalizeCell(s)
+		if err != nil || normalized != canonical {
+			t.Fatalf("NormalizeCell(%q) = %q, %v; want %q", s, normalized, err, canonical)
+		}
+	})
+}
+
+// FuzzCheckIndex checks that CheckIndex never panics, and that the hex form of every index it
+// accepts parses back to the same cell.
+func FuzzCheckIndex(f *testing.F) {
+	for _, s := range parseSeeds {
+		if v, err := strconv.ParseUint(strings.TrimSpace(s), 16, 64); err == nil {
+			f.Add(v)
+		}
+	}
+	f.Add(uint64(0))
+	f.Add(^uint64(0))
+	f.Fuzz(func(t *testing.T, v uint64) {
+		if err := CheckIndex(v); err != nil {
+			if _, err := ParseCell(h3.IndexToString(v)); err == nil {
+				t.Fatalf("CheckIndex(%x) rejects the index but ParseCell accepts its hex form", v)
+			}
+			return
+		}
+		cell, err := ParseCell(h3.IndexToString(v))
+		if err != nil || uint64(cell) != v {
+			t.Fatalf("ParseCell(%q) = %x, %v; want %x", h3.IndexToString(v), uint64(cell), err, v)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package h3geom
+
+import (
+	"fmt"
+	"math"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+)
+
+// Tile zooms are sized for 512 px vector tiles, as MapLibre renders them.
+const (
+	earthCircumferenceM = 40075016.686
+	tilePixels          = 512
+	// idealEdgePixels is how many pixels an average cell edge should span at the ideal zoom:
+	// enough to tell neighbouring cells apart without drawing them needlessly large.
+	idealEdgePixels = 4
+	// extraZooms is how far past the ideal zoom cells still gain useful detail; each further zoom
+	// quadruples the tile count while cells only get bigger.
+	extraZooms = 4
+)
+
+// ZoomSuitability describes which tile zooms suit one H3 resolution.
+type ZoomSuitability struct {
+	Resolution int
+	// EdgeMeters is the average hexagon edge length.
+	EdgeMeters float64
+	// MinZoom is the first zoom at which an average cell edge spans a whole pixel. Below it,
+	// cells blur together and tippecanoe drops or merges them.
+	MinZoom int
+	// IdealZoom is the zoom at which an average cell edge spans about four pixels.
+	IdealZoom int
+	// MaxZoom is the last zoom worth generating; past it tiles only enlarge the same cells.
+	MaxZoom int
+}
+
+// ZoomTable returns the suitability of every H3 resolution, 0 to 15.
+func ZoomTable() []ZoomSuitability {
+	table := make([]ZoomSuitability, 0, h3.MaxResolution+1)
+	for res := 0; res <= h3.MaxResolution; res++ {
+		s, _ := Suitability(res)
+		table = append(table, s)
+	}
+	return table
+}
+
+// Suitability returns the zoom range that suits cells of resolution res.
+func Suitability(res int) (ZoomSuitability, error) {
+	edge, err := h3.HexagonEdgeLengthAvgM(res)
+	if err != nil {
+		return ZoomSuitability{}, fmt.Errorf("H3 resolution %d: %w", res, err)
+	}
+	// At zoom z one pixel covers earthCircumferenceM / (tilePixels * 2^z) meters at the equator.
+	zoomFor := func(pixels float64) int {
+		return max(0, int(math.Round(math.Log2(earthCircumferenceM*pixels/(tilePixels*edge)))))
+	}
+	ideal := zoomFor(idealEdgePixels)
+	return ZoomSuitability{
+		Resolution: res,
+		EdgeMeters: edge,
+		MinZoom:    zoomFor(1),
+		IdealZoom:  ideal,
+		MaxZoom:    ideal + extraZooms,
+	}, nil
+}
@@ -0,0 +1,51 @@
+//go:build !h3_system
+
+package h3lib
+
+import h3 "github.com/uber/h3-go/v4"
+
+type (
+	Cell            = h3.Cell
+	CellBoundary    = h3.CellBoundary
+	LatLng          = h3.LatLng
+	GeoLoop         = h3.GeoLoop
+	GeoPolygon      = h3.GeoPolygon
+	ContainmentMode = h3.ContainmentMode
+)
+
+const (
+	MaxResolution = h3.MaxResolution
+	RadsToDegs    = h3.RadsToDegs
+
+	ContainmentCenter      = h3.ContainmentCenter
+	ContainmentFull        = h3.ContainmentFull
+	ContainmentOverlapping = h3.ContainmentOverlapping
+)
+
+func LatLngToCell(latLng LatLng, resolution int) (Cell, error) {
+	return h3.LatLngToCell(latLng, resolution)
+}
+
+func IndexToString(i uint64) string { return h3.IndexToString(i) }
+
+func IndexFromString(s string) uint64 { return h3.IndexFromString(s) }
+
+func GridDisk(origin Cell, k int) ([]Cell, error) { return h3.GridDisk(origin, k) }
+
+func CompactCells(in []Cell) ([]Cell, error) { return h3.CompactCells(in) }
+
+func CellsToMultiPolygon(cells []Cell) ([]GeoPolygon, error) { return h3.CellsToMultiPolygon(cells) }
+
+func PolygonToCellsExperimental(polygon GeoPolygon, resolution int, mode ContainmentMode, maxNumCellsReturn ...int64) ([]Cell, error) {
+	return h3.PolygonToCellsExperimental(polygon, resolution, mode, maxNumCellsReturn...)
+}
+
+func CellToVertexes(c Cell) ([]Cell, error) { return h3.CellToVertexes(c) }
+
+func VertexToLatLng(vertex Cell) (LatLng, error) { return h3.VertexToLatLng(vertex) }
+
+func HexagonAreaAvgM2(resolution int) (float64, error) { return h3.HexagonAreaAvgM2(resolution) }
+
+func HexagonEdgeLengthAvgM(resolution int) (float64, error) {
+	return h3.HexagonEdgeLengthAvgM(resolution)
+}
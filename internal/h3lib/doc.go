@@ -0,0 +1,10 @@
+// Package h3lib is the H3 library hexatiles is built against, selected by build tag:
+//
+//   - By default it is github.com/uber/h3-go, which compiles the H3 C sources it bundles.
+//   - With -tags h3_system it binds a prebuilt libh3 (4.2 or later) found by the C toolchain,
+//     such as a static libh3.a built once per target, so cross-compiling does not rebuild H3.
+//
+// Both expose the subset of the h3-go API hexatiles uses, with the same types and results; the
+// parity test checks fixed cells against the same expected values under either tag. Import it
+// as h3.
+package h3lib
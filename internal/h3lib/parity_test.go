@@ -0,0 +1,163 @@
+package h3lib
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+// The expected values below come from the bundled h3-go build. Running this file with and
+// without -tags h3_system checks that both libraries give hexatiles the same answers.
+
+const tolerance = 1e-9
+
+type cellCase struct {
+	cell       string
+	resolution int
+	parent     string // at resolution/2
+	center     LatLng
+	vertices   int
+	firstVert  LatLng
+	disk       int // GridDisk(cell, 1)
+	diskFirst  string
+	diskLast   string
+	outline    int // vertices of the outline of GridDisk(cell, 1), 0 if it has none
+	polyfill   [3][2]int
+}
+
+var cellCases = []cellCase{
+	{
+		cell: "8828308281fffff", resolution: 8, parent: "8428309ffffffff",
+		center: at(37.773515097, -122.418271037), vertices: 6, firstVert: at(37.768823088, -122.416823237),
+		disk: 7, diskFirst: "8828308281fffff", diskLast: "882830828dfffff", outline: 18,
+		polyfill: [3][2]int{{7, 1}, {1, 1}, {19, 13}},
+	},
+	{
+		// A resolution 0 pentagon: five vertices, and an outline H3 cannot trace.
+		cell: "8009fffffffffff", resolution: 0, parent: "8009fffffffffff",
+		center: at(64.700000128, 10.536199075), vertices: 5, firstVert: at(63.095054078, -10.444977545),
+		disk: 6, diskFirst: "8001fffffffffff", diskLast: "801ffffffffffff", outline: 0,
+		polyfill: [3][2]int{{6, 1}, {1, 1}, {16, 11}},
+	},
+	{
+		cell: "85283473fffffff", resolution: 5, parent: "822837fffffffff",
+		center: at(37.345793375, -121.976375973), vertices: 6, firstVert: at(37.271355867, -121.915080327),
+		disk: 7, diskFirst: "8528340bfffffff", diskLast: "8528347bfffffff", outline: 18,
+		polyfill: [3][2]int{{7, 1}, {1, 1}, {19, 13}},
+	},
+	{
+		cell: "8f2830828052d25", resolution: 15, parent: "872830828ffffff",
+		center: at(37.775235880, -122.419755018), vertices: 6, firstVert: at(37.775231494, -122.419751345),
+		disk: 7, diskFirst: "8f2830828052d20", diskLast: "8f28308280566d6", outline: 18,
+	},
+	{
+		cell: "821c07fffffffff", resolution: 2, parent: "811c3ffffffffff",
+		center: at(50.103201482, -143.478490015), vertices: 5, firstVert: at(51.311333257, -143.064496135),
+		disk: 6, diskFirst: "821c07fffffffff", diskLast: "821c37fffffffff", outline: 15,
+		polyfill: [3][2]int{{6, 1}, {1, 1}, {15, 10}},
+	},
+}
+
+func TestCellParity(t *testing.T) {
+	for _, tc := range cellCases {
+		t.Run(tc.cell, func(t *testing.T) {
+			c := Cell(IndexFromString(tc.cell))
+			if !c.IsValid() || c.String() != tc.cell || c.Resolution() != tc.resolution {
+				t.Fatalf("cell %s: valid %v, string %s, resolution %d", tc.cell, c.IsValid(), c, c.Resolution())
+			}
+			if parent, err := c.Parent(tc.resolution / 2); err != nil || parent.String() != tc.parent {
+				t.Errorf("Parent = %s, %v; want %s", parent, err, tc.parent)
+			}
+			if center, err := c.LatLng(); err != nil || !near(center, tc.center) {
+				t.Errorf("LatLng = %v, %v; want %v", center, err, tc.center)
+			}
+
+			boundary, err := c.Boundary()
+			if err != nil || len(boundary) != tc.vertices || !near(boundary[0], tc.firstVert) {
+				t.Fatalf("Boundary = %v, %v; want %d vertices from %v", boundary, err, tc.vertices, tc.firstVert)
+			}
+			vertexes, err := CellToVertexes(c)
+			if err != nil || len(vertexes) != tc.vertices {
+				t.Fatalf("CellToVertexes = %v, %v; want %d", vertexes, err, tc.vertices)
+			}
+			for _, v := range vertexes {
+				ll, err := VertexToLatLng(v)
+				if err != nil || !onBoundary(ll, boundary) {
+					t.Errorf("VertexToLatLng(%s) = %v, %v; not a boundary vertex", v, ll, err)
+				}
+			}
+
+			disk, err := GridDisk(c, 1)
+			sort.Slice(disk, func(i, j int) bool { return disk[i] < disk[j] })
+			if err != nil || len(disk) != tc.disk || disk[0].String() != tc.diskFirst || disk[len(disk)-1].String() != tc.diskLast {
+				t.Errorf("GridDisk = %v, %v; want %d cells from %s to %s", disk, err, tc.disk, tc.diskFirst, tc.diskLast)
+			}
+			outline, err := CellsToMultiPolygon(disk)
+			switch {
+			case tc.outline == 0 && err == nil:
+				t.Errorf("CellsToMultiPolygon = %v; want an error", outline)
+			case tc.outline > 0 && (err != nil || len(outline) != 1 || len(outline[0].GeoLoop) != tc.outline || len(outline[0].Holes) != 0):
+				t.Errorf("CellsToMultiPolygon = %v, %v; want one ring of %d vertices", outline, err, tc.outline)
+			}
+
+			if tc.resolution == MaxResolution {
+				return
+			}
+			shape := GeoPolygon{GeoLoop: GeoLoop(boundary)}
+			for i, mode := range []ContainmentMode{ContainmentCenter, ContainmentFull, ContainmentOverlapping} {
+				cells, err := PolygonToCellsExperimental(shape, tc.resolution+1, mode)
+				if err != nil || len(cells) != tc.polyfill[i][0] {
+					t.Errorf("PolygonToCellsExperimental(mode %d) = %d cells, %v; want %d", mode, len(cells), err, tc.polyfill[i][0])
+					continue
+				}
+				if compact, err := CompactCells(cells); err != nil || len(compact) != tc.polyfill[i][1] {
+					t.Errorf("CompactCells(mode %d) = %d cells, %v; want %d", mode, len(compact), err, tc.polyfill[i][1])
+				}
+			}
+		})
+	}
+}
+
+func TestIndexingParity(t *testing.T) {
+	for _, tc := range []struct {
+		point LatLng
+		want  string
+	}{
+		{at(37.775938728915946, -122.41795063018799), "8928308280fffff"},
+		{at(0, 0), "89754e64993ffff"},
+		{at(-33.8688, 151.2093), "89be0e35cbbffff"},
+		{at(89.9, 45), "89032630ac3ffff"},
+	} {
+		if c, err := LatLngToCell(tc.point, 9); err != nil || c.String() != tc.want {
+			t.Errorf("LatLngToCell(%v, 9) = %s, %v; want %s", tc.point, c, err, tc.want)
+		}
+	}
+	if _, err := LatLngToCell(LatLng{}, MaxResolution+1); err == nil || err.Error() != "resolution argument was outside of acceptable range" {
+		t.Errorf("LatLngToCell at resolution %d: error %v", MaxResolution+1, err)
+	}
+
+	if area, err := HexagonAreaAvgM2(8); err != nil || math.Abs(area-737327.597594) > 1e-6 {
+		t.Errorf("HexagonAreaAvgM2(8) = %f, %v", area, err)
+	}
+	if edge, err := HexagonEdgeLengthAvgM(8); err != nil || math.Abs(edge-531.414010) > 1e-6 {
+		t.Errorf("HexagonEdgeLengthAvgM(8) = %f, %v", edge, err)
+	}
+	if s := IndexToString(IndexFromString("0x8828308281FFFFF")); s != "8828308281fffff" {
+		t.Errorf("IndexToString(IndexFromString) = %s", s)
+	}
+}
+
+func at(lat, lng float64) LatLng { return LatLng{Lat: lat, Lng: lng} }
+
+func near(a, b LatLng) bool {
+	return math.Abs(a.Lat-b.Lat) < tolerance && math.Abs(a.Lng-b.Lng) < tolerance
+}
+
+func onBoundary(ll LatLng, boundary CellBoundary) bool {
+	for _, v := range boundary {
+		if near(ll, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+//go:build h3_system
+
+package h3lib
+
+// The conversions below follow github.com/uber/h3-go (Copyright 2018 Uber Technologies, Inc.,
+// Apache License 2.0), so results match the bundled build bit for bit.
+
+/*
+#cgo LDFLAGS: -lh3 -lm
+#include <stdlib.h>
+#include <h3/h3api.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type (
+	// Cell is an H3 index of a cell, or of a vertex where the API says so.
+	Cell int64
+
+	// CellBoundary is the vertices of a cell in counter-clockwise order.
+	CellBoundary []LatLng
+
+	// GeoLoop is a ring of points.
+	GeoLoop []LatLng
+
+	// LatLng is a coordinate in degrees.
+	LatLng struct {
+		Lat, Lng float64
+	}
+
+	// GeoPolygon is an outer ring with zero or more holes.
+	GeoPolygon struct {
+		GeoLoop GeoLoop
+		Holes   []GeoLoop
+	}
+
+	// ContainmentMode selects which cells PolygonToCellsExperimental returns.
+	ContainmentMode C.uint32_t
+)
+
+const (
+	MaxResolution = 15
+	RadsToDegs    = 180.0 / math.Pi
+	degsToRads    = math.Pi / 180.0
+
+	ContainmentCenter      ContainmentMode = C.CONTAINMENT_CENTER
+	ContainmentFull        ContainmentMode = C.CONTAINMENT_FULL
+	ContainmentOverlapping ContainmentMode = C.CONTAINMENT_OVERLAPPING
+)
+
+// errs holds h3-go's error for each H3Error code, so messages read the same under either tag.
+var errs = []error{
+	nil,
+	errors.New("the operation failed"),
+	errors.New("argument was outside of acceptable range"),
+	errors.New("latitude or longitude arguments were outside of acceptable range"),
+	errors.New("resolution argument was outside of acceptable range"),
+	errors.New("H3Index cell argument was not valid"),
+	errors.New("H3Index directed edge argument was not valid"),
+	errors.New("H3Index undirected edge argument was not valid"),
+	errors.New("H3Index vertex argument was not valid"),
+	errors.New("pentagon distortion was encountered"),
+	errors.New("duplicate input was encountered in the arguments"),
+	errors.New("H3Index cell arguments were not neighbors"),
+	errors.New("H3Index cell arguments had incompatible resolutions"),
+	errors.New("necessary memory allocation failed"),
+	errors.New("bounds of provided memory were not large enough"),
+	errors.New("mode or flags argument was not valid"),
+}
+
+var errUnknown = errors.New("unknown error code returned by H3")
+
+func toErr(code C.H3Error) error {
+	if int(code) < len(errs) {
+		return errs[code]
+	}
+	return errUnknown
+}
+
+func LatLngToCell(latLng LatLng, resolution int) (Cell, error) {
+	var out C.H3Index
+	code := C.latLngToCell(latLng.toC(), C.int(resolution), &out)
+	return Cell(out), toErr(code)
+}
+
+func IndexToString(i uint64) string { return strconv.FormatUint(i, 16) }
+
+func IndexFromString(s string) uint64 {
+	if len(s) > 2 && strings.ToLower(s[:2]) == "0x" {
+		s = s[2:]
+	}
+	i, _ := strconv.ParseUint(s, 16, 64)
+	return i
+}
+
+func GridDisk(origin Cell, k int) ([]Cell, error) {
+	out := make([]C.H3Index, 3*k*(k+1)+1)
+	code := C.gridDisk(C.H3Index(origin), C.int(k), &out[0])
+	return cellsFromC(out), toErr(code)
+}
+
+func CompactCells(in []Cell) ([]Cell, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make([]C.H3Index, len(in))
+	code := C.compactCells(cellsToC(in), &out[0], C.int64_t(len(in)))
+	return cellsFromC(out), toErr(code)
+}
+
+func CellsToMultiPolygon(cells []Cell) ([]GeoPolygon, error) {
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	var linked C.LinkedGeoPolygon
+	if err := toErr(C.cellsToLinkedMultiPolygon(cellsToC(cells), C.int(len(cells)), &linked)); err != nil {
+		return nil, err
+	}
+	defer C.destroyLinkedMultiPolygon(&linked)
+
+	var polygons []GeoPolygon
+	for poly := &linked; poly != nil; poly = poly.next {
+		var loops []GeoLoop
+		for loop := poly.first; loop != nil; loop = loop.next {
+			var ring GeoLoop
+			for pt := loop.first; pt != nil; pt = pt.next {
+				ring = append(ring, latLngFromC(pt.vertex))
+			}
+			loops = append(loops, ring)
+		}
+		if len(loops) == 0 {
+			continue
+		}
+		polygons = append(polygons, GeoPolygon{GeoLoop: loops[0], Holes: loops[1:]})
+	}
+	return polygons, nil
+}
+
+func PolygonToCellsExperimental(polygon GeoPolygon, resolution int, mode ContainmentMode, maxNumCellsReturn ...int64) ([]Cell, error) {
+	maxCells := int64(math.MaxInt64)
+	if len(maxNumCellsReturn) > 0 {
+		maxCells = maxNumCellsReturn[0]
+	}
+	if len(polygon.GeoLoop) == 0 {
+		return nil, nil
+	}
+	cpoly := newCGeoPolygon(polygon)
+	defer freeCGeoPolygon(&cpoly)
+
+	var size C.int64_t
+	if err := toErr(C.maxPolygonToCellsSizeExperimental(&cpoly, C.int(resolution), C.uint32_t(mode), &size)); err != nil {
+		return nil, err
+	}
+	out := make([]C.H3Index, size)
+	code := C.polygonToCellsExperimental(&cpoly, C.int(resolution), C.uint32_t(mode), C.int64_t(maxCells), &out[0])
+	return cellsFromC(out), toErr(code)
+}
+
+func CellToVertexes(c Cell) ([]Cell, error) {
+	out := make([]C.H3Index, 6)
+	if err := toErr(C.cellToVertexes(C.H3Index(c), &out[0])); err != nil {
+		return nil, err
+	}
+	return cellsFromC(out), nil
+}
+
+func VertexToLatLng(vertex Cell) (LatLng, error) {
+	var out C.LatLng
+	code := C.vertexToLatLng(C.H3Index(vertex), &out)
+	return latLngFromC(out), toErr(code)
+}
+
+func HexagonAreaAvgM2(resolution int) (float64, error) {
+	var out C.double
+	code := C.getHexagonAreaAvgM2(C.int(resolution), &out)
+	return float64(out), toErr(code)
+}
+
+func HexagonEdgeLengthAvgM(resolution int) (float64, error) {
+	var out C.double
+	code := C.getHexagonEdgeLengthAvgM(C.int(resolution), &out)
+	return float64(out), toErr(code)
+}
+
+func (c Cell) GridDisk(k int) ([]Cell, error) { return GridDisk(c, k) }
+
+func (c Cell) IsValid() bool { return c != 0 && C.isValidCell(C.H3Index(c)) == 1 }
+
+func (c Cell) Resolution() int { return int(C.getResolution(C.H3Index(c))) }
+
+func (c Cell) String() string { return IndexToString(uint64(c)) }
+
+func (c Cell) Parent(resolution int) (Cell, error) {
+	var out C.H3Index
+	code := C.cellToParent(C.H3Index(c), C.int(resolution), &out)
+	return Cell(out), toErr(code)
+}
+
+func (c Cell) LatLng() (LatLng, error) {
+	var out C.LatLng
+	code := C.cellToLatLng(C.H3Index(c), &out)
+	return latLngFromC(out), toErr(code)
+}
+
+func (c Cell) Boundary() (CellBoundary, error) {
+	var out C.CellBoundary
+	code := C.cellToBoundary(C.H3Index(c), &out)
+	boundary := make(CellBoundary, 0, int(out.numVerts))
+	for i := C.int(0); i < out.numVerts; i++ {
+		boundary = append(boundary, latLngFromC(out.verts[i]))
+	}
+	return boundary, toErr(code)
+}
+
+func latLngFromC(ll C.LatLng) LatLng {
+	return LatLng{Lat: RadsToDegs * float64(ll.lat), Lng: RadsToDegs * float64(ll.lng)}
+}
+
+func (g LatLng) toC() *C.LatLng {
+	return &C.LatLng{lat: C.double(degsToRads * g.Lat), lng: C.double(degsToRads * g.Lng)}
+}
+
+// cellsFromC drops the zero and negative slots the library leaves in fixed-size outputs.
+func cellsFromC(in []C.H3Index) []Cell {
+	out := make([]Cell, 0, len(in))
+	for _, h := range in {
+		if int64(h) > 0 {
+			out = append(out, Cell(h))
+		}
+	}
+	return out
+}
+
+func cellsToC(cells []Cell) *C.H3Index {
+	return (*C.H3Index)(unsafe.Pointer(&cells[0]))
+}
+
+// newCGeoPolygon copies polygon into C memory that freeCGeoPolygon releases.
+func newCGeoPolygon(polygon GeoPolygon) C.GeoPolygon {
+	cpoly := C.GeoPolygon{geoloop: newCGeoLoop(polygon.GeoLoop), numHoles: C.int(len(polygon.Holes))}
+	if len(polygon.Holes) > 0 {
+		cpoly.holes = (*C.GeoLoop)(C.malloc(C.size_t(C.sizeof_GeoLoop * len(polygon.Holes))))
+		holes := unsafe.Slice(cpoly.holes, len(polygon.Holes))
+		for i, hole := range polygon.Holes {
+			holes[i] = newCGeoLoop(hole)
+		}
+	}
+	return cpoly
+}
+
+func newCGeoLoop(loop GeoLoop) C.GeoLoop {
+	if len(loop) == 0 {
+		return C.GeoLoop{}
+	}
+	verts := (*C.LatLng)(C.malloc(C.size_t(C.sizeof_LatLng * len(loop))))
+	out := unsafe.Slice(verts, len(loop))
+	for i, ll := range loop {
+		out[i] = *ll.toC()
+	}
+	return C.GeoLoop{numVerts: C.int(len(loop)), verts: verts}
+}
+
+func freeCGeoPolygon(cpoly *C.GeoPolygon) {
+	C.free(unsafe.Pointer(cpoly.geoloop.verts))
+	if cpoly.numHoles > 0 {
+		for _, hole := range unsafe.Slice(cpoly.holes, int(cpoly.numHoles)) {
+			C.free(unsafe.Pointer(hole.verts))
+		}
+		C.free(unsafe.Pointer(cpoly.holes))
+	}
+	*cpoly = C.GeoPolygon{}
+}
@@ -0,0 +1,97 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// aggregate is one output column of an aggregated run.
+type aggregate struct {
+	fn       string
+	property string
+	column   string
+	kind     string
+}
+
+func parseAggregate(spec string, types map[string]string) (aggregate, error) {
+	spec = strings.TrimSpace(spec)
+	fn, property, hasProperty := strings.Cut(spec, ":")
+	fn, property = strings.ToLower(strings.TrimSpace(fn)), strings.TrimSpace(property)
+	if fn == "count" && !hasProperty {
+		return aggregate{fn: fn, column: "count", kind: "int"}, nil
+	}
+	switch fn {
+	case "sum", "mean", "min", "max":
+	default:
+		return aggregate{}, fmt.Errorf("invalid aggregate %q (expected count, sum:prop, mean:prop, min:prop or max:prop)", spec)
+	}
+	if property == "" {
+		return aggregate{}, fmt.Errorf("invalid aggregate %q: %s needs a property", spec, fn)
+	}
+	kind, ok := types[property]
+	switch {
+	case !ok:
+		return aggregate{}, fmt.Errorf("aggregate property %q not found in input", property)
+	case kind != "int" && kind != "float":
+		return aggregate{}, fmt.Errorf("aggregate property %q must be numeric, got %s", property, kind)
+	}
+	// Means are fractional; sums, minima and maxima of integers stay integers.
+	if fn == "mean" {
+		kind = "float"
+	}
+	return aggregate{fn: fn, property: property, column: property + "_" + fn, kind: kind}, nil
+}
+
+// aggState accumulates one aggregate over the rows of one cell.
+type aggState struct {
+	n   int64
+	sum float64
+	min float64
+	max float64
+}
+
+func (s *aggState) observe(agg aggregate, row map[string]any) {
+	if agg.fn == "count" {
+		s.n++
+		return
+	}
+	value, ok := props.Number(row[agg.property])
+	if !ok || math.IsNaN(value) {
+		return
+	}
+	if s.n == 0 {
+		s.min, s.max = value, value
+	}
+	s.n++
+	s.sum += value
+	s.min = math.Min(s.min, value)
+	s.max = math.Max(s.max, value)
+}
+
+// value is the aggregate of the observed rows, or nil when none had a value.
+func (s *aggState) value(agg aggregate) any {
+	if agg.fn == "count" {
+		return s.n
+	}
+	if s.n == 0 {
+		return nil
+	}
+	var v float64
+	switch agg.fn {
+	case "sum":
+		v = s.sum
+	case "mean":
+		v = s.sum / float64(s.n)
+	case "min":
+		v = s.min
+	case "max":
+		v = s.max
+	}
+	if agg.kind == "int" {
+		return int64(v)
+	}
+	return v
+}
@@ -0,0 +1,163 @@
+package index
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/input"
+	"github.com/hexatiles/hexatiles/internal/objstore"
+)
+
+// csvSource reads a delimited file with a header row. Column kinds are inferred from every
+// value in a first pass, so the file is read twice; empty fields are nulls.
+type csvSource struct {
+	object objstore.Object
+	comma  rune
+	header []string
+	kinds  []string
+	reader *csv.Reader
+}
+
+func newCSVSource(path string) (*csvSource, error) {
+	if path == input.Stdin {
+		return nil, fmt.Errorf("CSV input is read twice and cannot come from standard input")
+	}
+	object, err := objstore.Open(context.Background(), path)
+	if err != nil {
+		return nil, fmt.Errorf("open CSV input: %w", err)
+	}
+	s := &csvSource{object: object, comma: ','}
+	if strings.EqualFold(filepath.Ext(objstore.Base(path)), ".tsv") {
+		s.comma = '\t'
+	}
+	if err := s.infer(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	if err := s.rewind(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// rewind starts reading at the first data row.
+func (s *csvSource) rewind() error {
+	s.reader = csv.NewReader(io.NewSectionReader(s.object, 0, s.object.Size()))
+	s.reader.Comma = s.comma
+	s.reader.FieldsPerRecord = -1
+	s.reader.ReuseRecord = true
+	header, err := s.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("CSV input is empty")
+	}
+	if err != nil {
+		return fmt.Errorf("read CSV header: %w", err)
+	}
+	if s.header == nil {
+		s.header = make([]string, len(header))
+		for i, name := range header {
+			s.header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		}
+	}
+	return nil
+}
+
+func (s *csvSource) infer() error {
+	if err := s.rewind(); err != nil {
+		return err
+	}
+	s.kinds = make([]string, len(s.header))
+	for {
+		record, err := s.reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read CSV input: %w", err)
+		}
+		for i, field := range record {
+			if i < len(s.kinds) {
+				s.kinds[i] = input.MergeKind(s.kinds[i], fieldKind(strings.TrimSpace(field)))
+			}
+		}
+	}
+	for i, kind := range s.kinds {
+		if kind == "" {
+			// Only empty fields; strings are the safest guess.
+			s.kinds[i] = "string"
+		}
+	}
+	return nil
+}
+
+func (s *csvSource) PropertyTypes() map[string]string {
+	types := make(map[string]string, len(s.header))
+	for i, name := range s.header {
+		if name != "" {
+			types[name] = s.kinds[i]
+		}
+	}
+	return types
+}
+
+func (s *csvSource) Next() (map[string]any, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("read CSV input: %w", err)
+	}
+	row := make(map[string]any, len(s.header))
+	for i, name := range s.header {
+		if name == "" || i >= len(record) {
+			continue
+		}
+		field := strings.TrimSpace(record[i])
+		if field == "" {
+			continue
+		}
+		row[name] = fieldValue(field, s.kinds[i])
+	}
+	return row, nil
+}
+
+func (s *csvSource) Close() error { return s.object.Close() }
+
+func fieldKind(field string) string {
+	if field == "" {
+		return ""
+	}
+	if _, err := strconv.ParseInt(field, 10, 64); err == nil {
+		return "int"
+	}
+	if _, err := strconv.ParseFloat(field, 64); err == nil {
+		return "float"
+	}
+	if strings.EqualFold(field, "true") || strings.EqualFold(field, "false") {
+		return "bool"
+	}
+	return "string"
+}
+
+func fieldValue(field, kind string) any {
+	switch kind {
+	case "int":
+		v, _ := strconv.ParseInt(field, 10, 64)
+		return v
+	case "float":
+		v, _ := strconv.ParseFloat(field, 64)
+		return v
+	case "bool":
+		return strings.EqualFold(field, "true")
+	default:
+		return field
+	}
+}
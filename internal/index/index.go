@@ -0,0 +1,292 @@
+// Package index turns point data with latitude/longitude columns into H3 Parquet that the
+// build command reads directly.
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/input"
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// Options configures an index run.
+type Options struct {
+	InputPath   string
+	InputFormat string
+	OutputPath  string
+	Resolution  int
+	// Lat and Lng name the coordinate columns. Empty names pick the first column called
+	// lat/latitude and lng/lon/long/longitude, ignoring case.
+	Lat string
+	Lng string
+	// KeepCoordinates writes the coordinate columns next to the cell instead of dropping them.
+	KeepCoordinates bool
+	// Aggregate merges the rows of each cell into one, with one column per aggregate:
+	// "count", or "sum:prop", "mean:prop", "min:prop" and "max:prop" written as prop_sum and
+	// so on. Empty writes one row per input row.
+	Aggregate []string
+}
+
+// Result summarises an index run.
+type Result struct {
+	Rows    int64
+	Written int64
+	// Skipped counts rows whose coordinates were missing, not numbers or out of range.
+	Skipped int64
+	Lat     string
+	Lng     string
+	// Columns lists the property columns written next to h3.
+	Columns  []string
+	Duration time.Duration
+}
+
+// FormatCSV is read by index only: a delimited file with a header row. Tab-separated values
+// are read when the file ends in .tsv.
+const FormatCSV = "csv"
+
+var (
+	latNames = []string{"lat", "latitude"}
+	lngNames = []string{"lng", "lon", "long", "longitude"}
+)
+
+// Run reads opts.InputPath and writes opts.OutputPath with an h3 column at opts.Resolution.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	start := time.Now()
+	if opts.Resolution < 0 || opts.Resolution > 15 {
+		return nil, fmt.Errorf("resolution must be between 0 and 15, got %d", opts.Resolution)
+	}
+
+	src, err := openSource(opts.InputPath, opts.InputFormat)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	types := src.PropertyTypes()
+	res := &Result{}
+	if res.Lat, err = pickColumn(types, opts.Lat, latNames, "latitude"); err != nil {
+		return nil, err
+	}
+	if res.Lng, err = pickColumn(types, opts.Lng, lngNames, "longitude"); err != nil {
+		return nil, err
+	}
+
+	var aggs []aggregate
+	for _, spec := range opts.Aggregate {
+		agg, err := parseAggregate(spec, types)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, agg)
+	}
+
+	var columns []parquetreader.Column
+	if len(aggs) > 0 {
+		for _, agg := range aggs {
+			columns = append(columns, parquetreader.Column{Name: agg.column, Kind: agg.kind})
+		}
+	} else {
+		for _, name := range sortedKeys(types) {
+			if !opts.KeepCoordinates && (name == res.Lat || name == res.Lng) {
+				continue
+			}
+			columns = append(columns, parquetreader.Column{Name: name, Kind: types[name]})
+		}
+	}
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		if seen[col.Name] {
+			return nil, fmt.Errorf("column %q would be written twice", col.Name)
+		}
+		seen[col.Name] = true
+		res.Columns = append(res.Columns, col.Name)
+	}
+
+	writer, err := parquetreader.NewWriter(opts.OutputPath, columns)
+	if err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+
+	cells := make(map[h3.Cell][]aggState)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Rows++
+
+		cell, ok := cellOf(row[res.Lat], row[res.Lng], opts.Resolution)
+		if !ok {
+			res.Skipped++
+			continue
+		}
+		if len(aggs) > 0 {
+			states := cells[cell]
+			if states == nil {
+				states = make([]aggState, len(aggs))
+				cells[cell] = states
+			}
+			for i, agg := range aggs {
+				states[i].observe(agg, row)
+			}
+			continue
+		}
+
+		out := make(map[string]any, len(columns))
+		for _, col := range columns {
+			out[col.Name] = row[col.Name]
+		}
+		if err := writer.Write(h3.IndexToString(uint64(cell)), out); err != nil {
+			return nil, fmt.Errorf("row %d: %w", res.Rows, err)
+		}
+	}
+
+	if len(aggs) > 0 {
+		// Cells are written in index order so the output does not depend on map iteration.
+		ordered := make([]h3.Cell, 0, len(cells))
+		for cell := range cells {
+			ordered = append(ordered, cell)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i] < ordered[j] })
+		for _, cell := range ordered {
+			out := make(map[string]any, len(aggs))
+			for i, agg := range aggs {
+				out[agg.column] = cells[cell][i].value(agg)
+			}
+			if err := writer.Write(h3.IndexToString(uint64(cell)), out); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	res.Written = writer.Rows()
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// DeriveOutput returns the output used when none is given: <input-basename>_h3.parquet in
+// the input's directory, or the working directory for remote inputs.
+func DeriveOutput(inputPath string) string {
+	base := objstore.Base(inputPath)
+	name := strings.TrimSuffix(base, filepath.Ext(base)) + "_h3.parquet"
+	if objstore.IsRemote(inputPath) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(inputPath), name)
+}
+
+// source yields rows as property maps keyed by column name.
+type source interface {
+	PropertyTypes() map[string]string
+	Next() (map[string]any, error)
+	Close() error
+}
+
+func openSource(path, format string) (source, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(objstore.Base(path))) {
+		case ".csv", ".tsv":
+			format = FormatCSV
+		default:
+			format = input.DetectFormat(path)
+		}
+	}
+	switch format {
+	case FormatCSV:
+		return newCSVSource(path)
+	case input.FormatH3Text:
+		return nil, fmt.Errorf("index reads Parquet, CSV with a header row or NDJSON, not %s input", format)
+	}
+	reader, err := input.Open(path, format, parquetreader.ReaderOptions{BatchSize: 4096, Grid: grid.Default()})
+	if err != nil {
+		return nil, err
+	}
+	return &inputSource{reader: reader}, nil
+}
+
+// inputSource reads the formats the build command reads. Rows need no cell column here, so
+// the reader's missing-cell errors are ignored.
+type inputSource struct {
+	reader input.Source
+}
+
+func (s *inputSource) PropertyTypes() map[string]string { return s.reader.PropertyTypes() }
+
+func (s *inputSource) Next() (map[string]any, error) {
+	row, err := s.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	return row.Properties, nil
+}
+
+func (s *inputSource) Close() error { return s.reader.Close() }
+
+// pickColumn returns the named column, or the first present candidate when name is empty.
+func pickColumn(types map[string]string, name string, candidates []string, what string) (string, error) {
+	if name != "" {
+		kind, ok := types[name]
+		if !ok {
+			return "", fmt.Errorf("%s column %q not found in input", what, name)
+		}
+		if kind != "int" && kind != "float" {
+			return "", fmt.Errorf("%s column %q must be numeric, got %s", what, name, kind)
+		}
+		return name, nil
+	}
+	for _, candidate := range candidates {
+		for _, column := range sortedKeys(types) {
+			if strings.EqualFold(column, candidate) {
+				return pickColumn(types, column, nil, what)
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s column found (expected one of %s; name it with --%s)", what, strings.Join(candidates, ", "), candidates[0])
+}
+
+func cellOf(latValue, lngValue any, resolution int) (h3.Cell, bool) {
+	lat, ok := props.Number(latValue)
+	if !ok || math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return 0, false
+	}
+	lng, ok := props.Number(lngValue)
+	if !ok || math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return 0, false
+	}
+	cell, err := h3.LatLngToCell(h3.LatLng{Lat: lat, Lng: lng}, resolution)
+	if err != nil {
+		return 0, false
+	}
+	return cell, true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,321 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+// featureTypeSample is how many leading lines are decoded up front to learn property kinds.
+const featureTypeSample = 1000
+
+// featureReader reads newline-delimited JSON: one GeoJSON feature, whose properties hold the
+// cell, or one plain object per line. Geometries are ignored; cells are polygonized as for
+// Parquet input. Property kinds are inferred from the first lines, which are buffered so the
+// input can be a pipe.
+type featureReader struct {
+	src    *bufio.Reader
+	closer io.Closer
+	grid   grid.CellGeometry
+	// pending holds the sampled lines not yet returned.
+	pending [][]byte
+	types   map[string]string
+	rows    int64
+}
+
+func newFeatureReader(path string, opts parquetreader.ReaderOptions) (*featureReader, error) {
+	stream, closer, err := openStream(path)
+	if err != nil {
+		return nil, fmt.Errorf("open NDJSON input: %w", err)
+	}
+	cellGrid := opts.Grid
+	if cellGrid == nil {
+		cellGrid = grid.Default()
+	}
+	r := &featureReader{
+		src:    bufio.NewReaderSize(stream, 1<<20),
+		closer: closer,
+		grid:   cellGrid,
+		types:  make(map[string]string),
+	}
+
+	for len(r.pending) < featureTypeSample {
+		line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		r.pending = append(r.pending, line)
+		if props, err := r.parse(line); err == nil {
+			for key, value := range props {
+				if !grid.IsCellColumn(cellGrid, key) {
+					r.types[key] = MergeKind(r.types[key], ValueKind(value))
+				}
+			}
+		}
+	}
+	for key, kind := range r.types {
+		if kind == "" {
+			// Only nulls were sampled; strings are the safest guess.
+			r.types[key] = "string"
+		}
+	}
+	return r, nil
+}
+
+// readLine returns the next non-blank line, or io.EOF.
+func (r *featureReader) readLine() ([]byte, error) {
+	for {
+		line, err := r.src.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("read NDJSON input: %w", err)
+		}
+		// RFC 8142 GeoJSON text sequences prefix each record with an RS character.
+		line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte{0x1e}))
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, io.EOF
+		}
+	}
+}
+
+// nextLine returns a buffered sample line first, then reads on.
+func (r *featureReader) nextLine() ([]byte, error) {
+	if len(r.pending) > 0 {
+		line := r.pending[0]
+		r.pending[0] = nil
+		r.pending = r.pending[1:]
+		return line, nil
+	}
+	return r.readLine()
+}
+
+// parse returns the properties of a feature, or the object itself when it is not a feature.
+func (r *featureReader) parse(line []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if kind, _ := object["type"].(string); kind == "Feature" {
+		props, _ := object["properties"].(map[string]any)
+		if props == nil {
+			props = map[string]any{}
+		}
+		// A feature ID stands in for a missing cell property.
+		if id, ok := object["id"]; ok && !hasCellKey(r.grid, props) {
+			props[r.grid.Name()] = id
+		}
+		object = props
+	}
+	for key, value := range object {
+		object[key] = PlainValue(value)
+	}
+	return object, nil
+}
+
+func (r *featureReader) Next() (*parquetreader.Row, error) {
+	return r.NextContext(context.Background())
+}
+
+// NextContext checks ctx between lines; a single line read is not interruptible.
+func (r *featureReader) NextContext(ctx context.Context) (*parquetreader.Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	line, err := r.nextLine()
+	if err != nil {
+		return nil, err
+	}
+	r.rows++
+	return r.decode(line), nil
+}
+
+func (r *featureReader) decode(line []byte) *parquetreader.Row {
+	row := &parquetreader.Row{RowNumber: r.rows, Resolution: -1, Properties: map[string]any{}}
+	props, err := r.parse(line)
+	if err != nil {
+		row.Err = fmt.Errorf("row %d: %w", r.rows, err)
+		return row
+	}
+
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	found := false
+	for _, key := range keys {
+		if !grid.IsCellColumn(r.grid, key) {
+			row.Properties[key] = props[key]
+			continue
+		}
+		if row.Cell != 0 {
+			continue
+		}
+		found = true
+		cell, cellString, err := r.grid.Parse(props[key])
+		switch {
+		case err != nil:
+			row.Err = fmt.Errorf("row %d: property %s: %w", r.rows, key, err)
+		case cell == 0:
+			continue
+		case !r.grid.Valid(cell):
+			row.Err = fmt.Errorf("row %d: property %s: invalid %s cell", r.rows, key, strings.ToUpper(r.grid.Name()))
+		default:
+			row.Err = nil
+			row.Cell = cell
+			row.Resolution = r.grid.Resolution(cell)
+		}
+		row.CellString = cellString
+		if row.CellString == "" && cell != 0 {
+			row.CellString = r.grid.Token(cell)
+		}
+	}
+	switch {
+	case row.Cell != 0 || row.Err != nil:
+	case found:
+		row.Err = fmt.Errorf("row %d: %w", r.rows, parquetreader.ErrNullCell)
+	default:
+		row.Err = fmt.Errorf("row %d: no %s property (%w)", r.rows, r.grid.Name(), parquetreader.ErrNoH3Column)
+	}
+	return row
+}
+
+func (r *featureReader) Skip(n int64) error {
+	for ; n > 0; n-- {
+		if _, err := r.nextLine(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r.rows++
+	}
+	return nil
+}
+
+// Stream reads sequentially; JSON lines have no row groups to split across goroutines.
+func (r *featureReader) Stream(ctx context.Context) (<-chan *parquetreader.Row, <-chan error) {
+	rows := make(chan *parquetreader.Row, 1024)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(rows)
+		for {
+			row, err := r.NextContext(ctx)
+			if err == io.EOF || ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case rows <- row:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rows, errs
+}
+
+// PropertyTypes returns the kinds inferred from the first lines. Integers mixed with floats
+// are floats; any other mix is a string.
+func (r *featureReader) PropertyTypes() map[string]string {
+	types := make(map[string]string, len(r.types))
+	for key, kind := range r.types {
+		types[key] = kind
+	}
+	return types
+}
+
+// UnusableColumns reports nothing: JSON lines carry no statistics to find them without a scan.
+func (r *featureReader) UnusableColumns() ([]parquetreader.UnusableColumn, error) { return nil, nil }
+
+func (r *featureReader) TotalRows() int64 { return -1 }
+
+func (r *featureReader) KeyValueMetadata() map[string]string { return nil }
+
+func (r *featureReader) Close() error { return r.closer.Close() }
+
+func hasCellKey(g grid.CellGeometry, props map[string]any) bool {
+	for key := range props {
+		if grid.IsCellColumn(g, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlainValue converts decoded JSON to the scalar values the Parquet reader produces. Nested
+// objects and arrays are kept as their JSON text.
+func PlainValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any, []any:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(encoded)
+	default:
+		return v
+	}
+}
+
+// ValueKind is the property kind of a value PlainValue returns, or "" for null.
+func ValueKind(value any) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// MergeKind combines the kinds seen in one column: integers mixed with floats widen to floats
+// and any other mix to strings.
+func MergeKind(current, next string) string {
+	switch {
+	case current == "" || current == next:
+		return next
+	case next == "":
+		return current
+	case (current == "int" && next == "float") || (current == "float" && next == "int"):
+		return "float"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,145 @@
+package input
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+// textReader reads one cell index per line. Blank lines and lines starting with '#' are
+// skipped, as is a first-line header naming a cell column (e.g. "h3"). For CSV input only the
+// first field is used; rows carry no properties.
+type textReader struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+	grid    grid.CellGeometry
+	rows    int64
+	started bool
+}
+
+func newTextReader(path string, opts parquetreader.ReaderOptions) (*textReader, error) {
+	stream, closer, err := openStream(path)
+	if err != nil {
+		return nil, fmt.Errorf("open text input: %w", err)
+	}
+	cellGrid := opts.Grid
+	if cellGrid == nil {
+		cellGrid = grid.Default()
+	}
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &textReader{closer: closer, scanner: scanner, grid: cellGrid}, nil
+}
+
+func (r *textReader) Next() (*parquetreader.Row, error) {
+	return r.NextContext(context.Background())
+}
+
+// NextContext checks ctx between lines; a single line read is not interruptible.
+func (r *textReader) NextContext(ctx context.Context) (*parquetreader.Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	field, err := r.nextField()
+	if err != nil {
+		return nil, err
+	}
+	return r.decode(field), nil
+}
+
+func (r *textReader) Skip(n int64) error {
+	for ; n > 0; n-- {
+		if _, err := r.nextField(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextField advances to the next data line and returns its cell field.
+func (r *textReader) nextField() (string, error) {
+	for r.scanner.Scan() {
+		field := firstField(r.scanner.Text())
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+		if !r.started {
+			r.started = true
+			if grid.IsCellColumn(r.grid, field) {
+				continue
+			}
+		}
+		r.rows++
+		return field, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", fmt.Errorf("read text input: %w", err)
+	}
+	return "", io.EOF
+}
+
+func (r *textReader) decode(field string) *parquetreader.Row {
+	row := &parquetreader.Row{RowNumber: r.rows, Resolution: -1, Properties: map[string]any{}}
+	cell, cellString, err := r.grid.Parse(field)
+	row.CellString = cellString
+	switch {
+	case err != nil:
+		row.Err = fmt.Errorf("row %d: %w", r.rows, err)
+	case !r.grid.Valid(cell):
+		row.Err = fmt.Errorf("row %d: invalid %s cell", r.rows, strings.ToUpper(r.grid.Name()))
+	default:
+		row.Cell = cell
+		row.Resolution = r.grid.Resolution(cell)
+	}
+	return row
+}
+
+// Stream reads sequentially; text files have no row groups to split across goroutines.
+func (r *textReader) Stream(ctx context.Context) (<-chan *parquetreader.Row, <-chan error) {
+	rows := make(chan *parquetreader.Row, 1024)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(rows)
+		for {
+			row, err := r.NextContext(ctx)
+			if err == io.EOF || ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case rows <- row:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rows, errs
+}
+
+func (r *textReader) PropertyTypes() map[string]string { return map[string]string{} }
+
+func (r *textReader) UnusableColumns() ([]parquetreader.UnusableColumn, error) { return nil, nil }
+
+func (r *textReader) TotalRows() int64 { return -1 }
+
+func (r *textReader) KeyValueMetadata() map[string]string { return nil }
+
+func (r *textReader) Close() error { return r.closer.Close() }
+
+func firstField(line string) string {
+	if i := strings.IndexAny(line, ",\t;"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Trim(strings.TrimSpace(line), `"'`)
+}
@@ -0,0 +1,111 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+// Input formats accepted by Open.
+const (
+	FormatParquet = "parquet"
+	FormatH3Text  = "h3txt"
+	FormatNDJSON  = "ndjson"
+)
+
+// Stdin is the input path that reads standard input, for the line-based formats.
+const Stdin = "-"
+
+// Source streams decoded cell rows from an input file, whatever its format.
+type Source interface {
+	// Next returns the next row in file order, or io.EOF.
+	Next() (*parquetreader.Row, error)
+	// NextContext is Next, returning ctx.Err() once ctx is done.
+	NextContext(ctx context.Context) (*parquetreader.Row, error)
+	// Skip discards the next n rows without decoding them; skipping past the end is not an error.
+	Skip(n int64) error
+	// Stream sends every row on the returned channel; see parquet.Reader.Stream.
+	Stream(ctx context.Context) (<-chan *parquetreader.Row, <-chan error)
+	// PropertyTypes maps each property column to its kind (string, int, float or bool).
+	PropertyTypes() map[string]string
+	// UnusableColumns lists property columns that are null, constant or binary; see
+	// parquet.Reader.UnusableColumns.
+	UnusableColumns() ([]parquetreader.UnusableColumn, error)
+	// TotalRows returns the row count when known up front, or -1.
+	TotalRows() int64
+	// KeyValueMetadata returns the file-level key-value metadata, or nil for formats that
+	// carry none.
+	KeyValueMetadata() map[string]string
+	Close() error
+}
+
+// Formats lists the accepted --input-format values.
+func Formats() []string { return []string{FormatParquet, FormatH3Text, FormatNDJSON} }
+
+// Open opens path in the given format. An empty format is detected from the file extension:
+// .txt, .csv and .h3 files are read as h3txt, .ndjson, .jsonl and .geojsonl as ndjson, and
+// everything else as Parquet. A directory is read as a Hive-partitioned Parquet dataset, and
+// Stdin as ndjson unless the format says otherwise.
+func Open(path, format string, opts parquetreader.ReaderOptions) (Source, error) {
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	switch strings.ToLower(format) {
+	case FormatParquet:
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dataset, err := parquetreader.NewDataset(path, opts)
+			if err != nil {
+				return nil, fmt.Errorf("open parquet dataset: %w", err)
+			}
+			return dataset, nil
+		}
+		reader, err := parquetreader.NewReader(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("open parquet reader: %w", err)
+		}
+		return reader, nil
+	case FormatH3Text:
+		return newTextReader(path, opts)
+	case FormatNDJSON:
+		return newFeatureReader(path, opts)
+	default:
+		return nil, fmt.Errorf("unknown input format %q (expected %s)", format, strings.Join(Formats(), ", "))
+	}
+}
+
+// DetectFormat guesses the input format from the file extension.
+func DetectFormat(path string) string {
+	if path == Stdin {
+		return FormatNDJSON
+	}
+	switch strings.ToLower(filepath.Ext(objstore.Base(path))) {
+	case ".txt", ".csv", ".h3":
+		return FormatH3Text
+	case ".ndjson", ".jsonl", ".geojsonl", ".geojsons", ".geojsonseq":
+		return FormatNDJSON
+	default:
+		return FormatParquet
+	}
+}
+
+// IsStream reports whether path can only be read once, so it cannot be scanned twice.
+func IsStream(path string) bool { return path == Stdin }
+
+// openStream opens a line-based input for sequential reading: standard input, a local file or
+// a remote object.
+func openStream(path string) (io.Reader, io.Closer, error) {
+	if path == Stdin {
+		return os.Stdin, io.NopCloser(nil), nil
+	}
+	object, err := objstore.Open(context.Background(), path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NewSectionReader(object, 0, object.Size()), object, nil
+}
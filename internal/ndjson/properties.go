@@ -0,0 +1,224 @@
+package ndjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// PropertyEncoder writes feature properties as a JSON object with the schema keys in a fixed,
+// sorted order. Key prefixes are encoded once and values are appended without reflection, so
+// wide tables avoid the per-row map sort and reflection of json.Marshal. Keys outside the schema
+// are still written, sorted, after the schema keys.
+type PropertyEncoder struct {
+	keys  []string
+	names [][]byte
+	pool  sync.Pool
+}
+
+// NewPropertyEncoder prepares an encoder for the given property keys.
+func NewPropertyEncoder(keys []string) *PropertyEncoder {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	e := &PropertyEncoder{}
+	for i, key := range sorted {
+		if i > 0 && key == sorted[i-1] {
+			continue
+		}
+		e.keys = append(e.keys, key)
+		e.names = append(e.names, appendKey(nil, key))
+	}
+	e.pool.New = func() any {
+		buf := make([]byte, 0, 512)
+		return &buf
+	}
+	return e
+}
+
+// Encode returns the JSON object for properties in a pooled buffer. Hand the buffer back with
+// Release once it has been written.
+func (e *PropertyEncoder) Encode(properties map[string]any) ([]byte, error) {
+	buf := (*e.pool.Get().(*[]byte))[:0]
+	buf = append(buf, '{')
+	written := 0
+	for i, key := range e.keys {
+		value, ok := properties[key]
+		if !ok {
+			continue
+		}
+		if written > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, e.names[i]...)
+		var err error
+		if buf, err = appendValue(buf, value); err != nil {
+			e.Release(buf)
+			return nil, fmt.Errorf("property %s: %w", key, err)
+		}
+		written++
+	}
+	if written < len(properties) {
+		extra := make([]string, 0, len(properties)-written)
+		for key := range properties {
+			if !e.known(key) {
+				extra = append(extra, key)
+			}
+		}
+		sort.Strings(extra)
+		for _, key := range extra {
+			if written > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendKey(buf, key)
+			var err error
+			if buf, err = appendValue(buf, properties[key]); err != nil {
+				e.Release(buf)
+				return nil, fmt.Errorf("property %s: %w", key, err)
+			}
+			written++
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+// Release returns a buffer obtained from Encode to the pool.
+func (e *PropertyEncoder) Release(buf []byte) {
+	if buf == nil {
+		return
+	}
+	buf = buf[:0]
+	e.pool.Put(&buf)
+}
+
+func (e *PropertyEncoder) known(key string) bool {
+	i := sort.SearchStrings(e.keys, key)
+	return i < len(e.keys) && e.keys[i] == key
+}
+
+func appendKey(buf []byte, key string) []byte {
+	buf = appendString(buf, key)
+	return append(buf, ':')
+}
+
+// appendValue encodes the scalar types produced by the readers; anything else falls back to
+// encoding/json.
+func appendValue(buf []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case string:
+		return appendString(buf, v), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float32:
+		return appendFloat(buf, float64(v), 32)
+	case float64:
+		return appendFloat(buf, v, 64)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return buf, err
+		}
+		return append(buf, encoded...), nil
+	}
+}
+
+// appendFloat formats like encoding/json: the shortest representation, in exponent form only
+// for very small or very large magnitudes.
+func appendFloat(buf []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return buf, fmt.Errorf("unsupported value %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	start := len(buf)
+	buf = strconv.AppendFloat(buf, f, format, -1, bits)
+	if format == 'e' {
+		// Shorten e-09 to e-9 as encoding/json does.
+		n := len(buf) - start
+		if n >= 4 && buf[len(buf)-4] == 'e' && buf[len(buf)-3] == '-' && buf[len(buf)-2] == '0' {
+			buf[len(buf)-2] = buf[len(buf)-1]
+			buf = buf[:len(buf)-1]
+		}
+	}
+	return buf, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString quotes s like an encoding/json encoder with HTML escaping disabled.
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 break JavaScript parsers that read JSON as script.
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
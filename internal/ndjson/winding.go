@@ -0,0 +1,81 @@
+package ndjson
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+)
+
+// Winding is the ring order of the polygons a Writer emits.
+type Winding string
+
+const (
+	// WindingCCW winds exterior rings counter-clockwise and holes clockwise, the right-hand
+	// rule of RFC 7946. It is the default.
+	WindingCCW Winding = "ccw"
+	// WindingCW winds exterior rings clockwise, for consumers written against the older
+	// GeoJSON draft or the d3-geo convention.
+	WindingCW Winding = "cw"
+)
+
+// ParseWinding validates a winding name. An empty value selects WindingCCW.
+func ParseWinding(value string) (Winding, error) {
+	switch Winding(strings.ToLower(strings.TrimSpace(value))) {
+	case "", WindingCCW:
+		return WindingCCW, nil
+	case WindingCW:
+		return WindingCW, nil
+	default:
+		return "", fmt.Errorf("invalid winding %q (expected ccw or cw)", value)
+	}
+}
+
+// Orient rewinds the rings of a Polygon or MultiPolygon in place so exterior rings follow
+// winding and holes the opposite order, and returns the number of rings it reversed. Other
+// geometries are left alone.
+func Orient(g orb.Geometry, winding Winding) int {
+	reversed := 0
+	switch g := g.(type) {
+	case orb.Polygon:
+		for i, ring := range g {
+			clockwise := (winding == WindingCW) == (i == 0)
+			if area := signedArea(ring); area != 0 && (area < 0) != clockwise {
+				ring.Reverse()
+				reversed++
+			}
+		}
+	case orb.MultiPolygon:
+		for _, p := range g {
+			reversed += Orient(p, winding)
+		}
+	}
+	return reversed
+}
+
+// signedArea is twice the shoelace area of ring in degrees, positive when it runs
+// counter-clockwise. It is summed over longitude differences folded into [-180, 180], so a cell
+// crossing the antimeridian, whose vertices jump between +180 and -180, keeps the sign of its
+// true orientation.
+func signedArea(ring orb.Ring) float64 {
+	if len(ring) < 3 {
+		return 0
+	}
+	var area float64
+	for i := range ring {
+		p, q := ring[i], ring[(i+1)%len(ring)]
+		area -= unwrapLongitude(q[0]-p[0]) * (p[1] + q[1])
+	}
+	return area
+}
+
+// unwrapLongitude maps a longitude difference into [-180, 180].
+func unwrapLongitude(d float64) float64 {
+	for d > 180 {
+		d -= 360
+	}
+	for d < -180 {
+		d += 360
+	}
+	return d
+}
@@ -1,10 +1,14 @@
 package ndjson
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 
 	"github.com/paulmach/orb"
@@ -16,21 +20,95 @@ type Feature struct {
 	ID         string
 	Geometry   orb.Geometry
 	Properties map[string]any
-	BBox       *orb.Bound
+	// EncodedProperties, when set, is the JSON object written in place of Properties, as
+	// produced by a PropertyEncoder.
+	EncodedProperties []byte
+	BBox              *orb.Bound
+	// Zoom, when set, limits the zooms the feature is tiled at.
+	Zoom *ZoomRange
 }
 
+// ZoomRange is written as tippecanoe's per-feature "tippecanoe" member. A negative Max leaves
+// the feature in every zoom from Min down.
+type ZoomRange struct {
+	Min int
+	Max int
+}
+
+func appendZoomRange(buf []byte, zoom *ZoomRange) []byte {
+	buf = append(buf, `,"tippecanoe":{"minzoom":`...)
+	buf = strconv.AppendInt(buf, int64(zoom.Min), 10)
+	if zoom.Max >= 0 {
+		buf = append(buf, `,"maxzoom":`...)
+		buf = strconv.AppendInt(buf, int64(zoom.Max), 10)
+	}
+	return append(buf, '}')
+}
+
+// Output formats accepted by NewFormatWriter.
+const (
+	// FormatNDJSON writes one feature per line.
+	FormatNDJSON = "ndjson"
+	// FormatGeoJSONSeq writes an RFC 8142 GeoJSON text sequence: every line starts with the
+	// record separator, which tippecanoe takes as the cue to split the file among its reading
+	// threads.
+	FormatGeoJSONSeq = "geojsonseq"
+)
+
+// recordSeparator starts every record of a GeoJSON text sequence.
+const recordSeparator = 0x1e
+
+// writeBufferSize is the buffer in front of the file. A feature is a few hundred bytes, so one
+// write to the file carries thousands of them.
+const writeBufferSize = 1 << 20
+
 // Writer streams GeoJSON features as newline-delimited JSON.
 type Writer struct {
-	mu           sync.Mutex
-	file         *os.File
-	encoder      *json.Encoder
-	path         string
-	count        int64
-	bytesWritten int64
+	mu       sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	out      *countingWriter
+	encoder  *json.Encoder
+	path     string
+	separate bool
+	count    int64
+	line     []byte
+	// omitBBox drops the bbox member of every feature; bboxOmitted counts the bytes it would
+	// have taken.
+	omitBBox    bool
+	bboxOmitted int64
+	// winding is the ring order polygons are written in; rewound counts the rings reversed
+	// to follow it.
+	winding Winding
+	rewound int64
+}
+
+// countingWriter counts the bytes that pass through it, so the size of the output is known
+// without asking the file system.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // NewWriter creates a writer that outputs to the specified path, creating parent directories as needed.
 func NewWriter(path string) (*Writer, error) {
+	return NewFormatWriter(path, FormatNDJSON)
+}
+
+// NewFormatWriter is NewWriter for FormatNDJSON or FormatGeoJSONSeq; an empty format means
+// FormatNDJSON.
+func NewFormatWriter(path, format string) (*Writer, error) {
+	switch format {
+	case "", FormatNDJSON, FormatGeoJSONSeq:
+	default:
+		return nil, fmt.Errorf("unknown NDJSON format %q (want %s or %s)", format, FormatNDJSON, FormatGeoJSONSeq)
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, fmt.Errorf("create NDJSON directory: %w", err)
 	}
@@ -40,10 +118,12 @@ func NewWriter(path string) (*Writer, error) {
 		return nil, fmt.Errorf("create NDJSON file: %w", err)
 	}
 
-	enc := json.NewEncoder(f)
+	buf := bufio.NewWriterSize(f, writeBufferSize)
+	out := &countingWriter{w: buf}
+	enc := json.NewEncoder(out)
 	enc.SetEscapeHTML(false)
 
-	return &Writer{file: f, encoder: enc, path: path}, nil
+	return &Writer{file: f, buf: buf, out: out, encoder: enc, path: path, separate: format == FormatGeoJSONSeq}, nil
 }
 
 // Close flushes and closes the underlying file.
@@ -55,7 +135,10 @@ func (w *Writer) Close() error {
 		return nil
 	}
 
-	err := w.file.Close()
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
 	w.file = nil
 	return err
 }
@@ -72,22 +155,86 @@ func (w *Writer) Count() int64 {
 	return w.count
 }
 
-// Bytes returns the total bytes written so far (best-effort).
+// Bytes returns the total bytes written so far, including those still buffered.
 func (w *Writer) Bytes() int64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.bytesWritten
+	return w.out.n
 }
 
-// WriteFeature appends a feature as a single NDJSON line.
+// OmitBBox stops writing the bbox member of features. tippecanoe computes the bounds it
+// needs from the geometry, so the member only adds to the file; BBoxBytesOmitted tells by how
+// much.
+func (w *Writer) OmitBBox() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.omitBBox = true
+}
+
+// BBoxBytesOmitted returns the bytes the bbox members left out by OmitBBox would have taken.
+func (w *Writer) BBoxBytesOmitted() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bboxOmitted
+}
+
+// SetWinding sets the ring order of the polygons written, WindingCCW unless set.
+func (w *Writer) SetWinding(winding Winding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.winding = winding
+}
+
+// RingsRewound returns the number of polygon rings reversed to follow the writer's winding.
+func (w *Writer) RingsRewound() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rewound
+}
+
+// WriteFeature appends a feature as a single NDJSON line. Polygon rings are rewound in place
+// to the writer's winding.
 func (w *Writer) WriteFeature(feature Feature) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.encoder == nil {
+	if w.file == nil {
 		return fmt.Errorf("writer closed")
 	}
 
+	if w.omitBBox && feature.BBox != nil {
+		member, err := appendBBox(w.line[:0], *feature.BBox)
+		if err != nil {
+			return fmt.Errorf("encode feature: %w", err)
+		}
+		w.line = member
+		w.bboxOmitted += int64(len(member))
+		feature.BBox = nil
+	}
+
+	winding := w.winding
+	if winding == "" {
+		winding = WindingCCW
+	}
+	w.rewound += int64(Orient(feature.Geometry, winding))
+
+	if feature.EncodedProperties != nil {
+		line := w.line[:0]
+		if w.separate {
+			line = append(line, recordSeparator)
+		}
+		line, err := appendFeature(line, feature)
+		if err != nil {
+			return fmt.Errorf("encode feature: %w", err)
+		}
+		w.line = line
+		if _, err := w.out.Write(line); err != nil {
+			return fmt.Errorf("encode feature: %w", err)
+		}
+		w.count++
+		return nil
+	}
+
 	payload := geojson.NewFeature(feature.Geometry)
 	if feature.Properties != nil {
 		payload.Properties = feature.Properties
@@ -100,18 +247,29 @@ func (w *Writer) WriteFeature(feature Feature) error {
 		payload.ID = feature.ID
 	}
 
-	if err := w.encoder.Encode(payload); err != nil {
-		return fmt.Errorf("encode feature: %w", err)
+	if w.separate {
+		if _, err := w.out.Write([]byte{recordSeparator}); err != nil {
+			return fmt.Errorf("encode feature: %w", err)
+		}
 	}
-
-	w.count++
-
-	if w.file != nil {
-		if info, err := w.file.Stat(); err == nil {
-			w.bytesWritten = info.Size()
+	if feature.Zoom != nil {
+		// geojson.Feature has no foreign members; splice the zoom range in before the close.
+		var encoded bytes.Buffer
+		enc := json.NewEncoder(&encoded)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(payload); err != nil {
+			return fmt.Errorf("encode feature: %w", err)
 		}
+		line := bytes.TrimRight(encoded.Bytes(), "\n")
+		line = append(appendZoomRange(line[:len(line)-1], feature.Zoom), '}', '\n')
+		if _, err := w.out.Write(line); err != nil {
+			return fmt.Errorf("encode feature: %w", err)
+		}
+	} else if err := w.encoder.Encode(payload); err != nil {
+		return fmt.Errorf("encode feature: %w", err)
 	}
 
+	w.count++
 	return nil
 }
 
@@ -130,3 +288,76 @@ func MarshalFeature(feature Feature) ([]byte, error) {
 	}
 	return json.Marshal(payload)
 }
+
+// appendBBox writes the bbox member of a feature, with its trailing comma.
+func appendBBox(buf []byte, bound orb.Bound) ([]byte, error) {
+	buf = append(buf, `"bbox":[`...)
+	for i, v := range []float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]} {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		var err error
+		if buf, err = appendFloat(buf, v, 64); err != nil {
+			return nil, err
+		}
+	}
+	return append(buf, "],"...), nil
+}
+
+// appendFeature writes a feature with pre-encoded properties as one NDJSON line, with the
+// members in the order geojson.Feature uses. Polygons, the geometry of every cell, are encoded
+// directly; other geometries go through geojson.
+func appendFeature(buf []byte, feature Feature) ([]byte, error) {
+	buf = append(buf, '{')
+	if feature.ID != "" {
+		buf = append(buf, `"id":`...)
+		buf = appendString(buf, feature.ID)
+		buf = append(buf, ',')
+	}
+	buf = append(buf, `"type":"Feature",`...)
+	if feature.BBox != nil {
+		var err error
+		if buf, err = appendBBox(buf, *feature.BBox); err != nil {
+			return nil, err
+		}
+	}
+	buf = append(buf, `"geometry":`...)
+	if polygon, ok := feature.Geometry.(orb.Polygon); ok {
+		buf = append(buf, `{"type":"Polygon","coordinates":[`...)
+		for i, ring := range polygon {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, '[')
+			for j, point := range ring {
+				if j > 0 {
+					buf = append(buf, ',')
+				}
+				buf = append(buf, '[')
+				var err error
+				if buf, err = appendFloat(buf, point[0], 64); err != nil {
+					return nil, err
+				}
+				buf = append(buf, ',')
+				if buf, err = appendFloat(buf, point[1], 64); err != nil {
+					return nil, err
+				}
+				buf = append(buf, ']')
+			}
+			buf = append(buf, ']')
+		}
+		buf = append(buf, "]}"...)
+	} else {
+		encoded, err := json.Marshal(geojson.NewGeometry(feature.Geometry))
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, encoded...)
+	}
+	buf = append(buf, `,"properties":`...)
+	buf = append(buf, feature.EncodedProperties...)
+	if feature.Zoom != nil {
+		buf = appendZoomRange(buf, feature.Zoom)
+	}
+	return append(buf, '}', '\n'), nil
+}
@@ -0,0 +1,48 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openGCS reads gs://bucket/object through the Cloud Storage XML API. An OAuth token in
+// GOOGLE_OAUTH_ACCESS_TOKEN (for example from `gcloud auth print-access-token`) is sent as a
+// bearer token; without one, requests are anonymous, which works for public objects.
+// STORAGE_EMULATOR_HOST points at a local emulator.
+func openGCS(ctx context.Context, u *url.URL) (*remoteObject, error) {
+	endpoint, sign, err := gcsEndpoint(u)
+	if err != nil {
+		return nil, err
+	}
+	return openRemote(ctx, u.String(), endpoint, sign)
+}
+
+// gcsEndpoint resolves gs://bucket/object to its XML API URL and the request signer, nil
+// without a token, as openGCS describes.
+func gcsEndpoint(u *url.URL) (string, func(*http.Request) error, error) {
+	bucket := u.Host
+	object := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || object == "" {
+		return "", nil, fmt.Errorf("invalid GCS URL %q: expected gs://bucket/object", u.String())
+	}
+	host := "https://storage.googleapis.com"
+	if emulator := firstEnv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		host = strings.TrimSuffix(emulator, "/")
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+	}
+	endpoint := host + "/" + bucket + "/" + escapePath(object)
+
+	var sign func(*http.Request) error
+	if token := firstEnv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		sign = func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		}
+	}
+	return endpoint, sign, nil
+}
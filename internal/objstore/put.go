@@ -0,0 +1,90 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maxS3Put is the largest object S3 accepts in a single PUT request.
+const maxS3Put = 5 << 30
+
+// PutOptions sets the headers stored with an uploaded object.
+type PutOptions struct {
+	ContentType  string
+	CacheControl string
+	// Endpoint is the S3-compatible endpoint of s3:// destinations, such as
+	// https://<account>.r2.cloudflarestorage.com; empty uses AWS_ENDPOINT_URL or AWS.
+	Endpoint string
+}
+
+// Put uploads the local file src to dest, an s3:// or gs:// URL, in one PUT request
+// authenticated from the environment as Open authenticates reads; AWS_ENDPOINT_URL reaches R2
+// and other S3-compatible stores. Transient failures are retried. A single request limits S3
+// objects to 5 GB.
+func Put(ctx context.Context, src, dest string, opts PutOptions) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return fmt.Errorf("parse destination URL: %w", err)
+	}
+	var endpoint string
+	var sign func(*http.Request) error
+	switch strings.ToLower(u.Scheme) {
+	case "s3":
+		endpoint, sign, err = s3Endpoint(u, opts.Endpoint)
+	case "gs":
+		endpoint, sign, err = gcsEndpoint(u)
+	default:
+		return fmt.Errorf("cannot upload to %q: expected an s3:// or gs:// URL", dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+	size := info.Size()
+	if strings.EqualFold(u.Scheme, "s3") && size > maxS3Put {
+		return fmt.Errorf("%s is %d bytes; S3 takes at most 5 GB in one upload", src, size)
+	}
+
+	return retry(ctx, dest, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dest, err)
+		}
+		req.ContentLength = size
+		if opts.ContentType != "" {
+			req.Header.Set("Content-Type", opts.ContentType)
+		}
+		if opts.CacheControl != "" {
+			req.Header.Set("Cache-Control", opts.CacheControl)
+		}
+		if sign != nil {
+			if err := sign(req); err != nil {
+				return nil, fmt.Errorf("%s: %w", dest, err)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, retryable{fmt.Errorf("%s: %w", dest, err)}
+		}
+		if resp.StatusCode/100 != 2 {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, nil
+	})
+}
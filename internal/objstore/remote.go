@@ -0,0 +1,341 @@
+package objstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// blockSize is the granularity of range requests. Parquet pages are read a few KB at a time,
+	// so reads are rounded up to whole blocks and served from the cache afterwards.
+	blockSize = 1 << 20
+	// cacheBlocks bounds the memory held by an object's block cache.
+	cacheBlocks = 128
+	// fetchParallel is how many blocks of one large read are requested concurrently.
+	fetchParallel = 8
+	// prefetchBlocks bounds the blocks one Prefetch call loads, leaving most of the cache to
+	// the blocks being decoded.
+	prefetchBlocks = cacheBlocks / 4
+	// fetchAttempts covers transient network errors and 429/5xx responses.
+	fetchAttempts = 4
+)
+
+// remoteObject reads an HTTP(S) resource with range requests through an LRU block cache.
+type remoteObject struct {
+	name   string
+	url    string
+	client *http.Client
+	// sign adds credentials to each request; nil for anonymous access.
+	sign func(*http.Request) error
+	size int64
+
+	mu       sync.Mutex
+	blocks   map[int64]*list.Element
+	lru      *list.List
+	inflight map[int64]*blockFetch
+}
+
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+// blockFetch lets concurrent readers of the same block share one request.
+type blockFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func openRemote(ctx context.Context, name, rawURL string, sign func(*http.Request) error) (*remoteObject, error) {
+	o := &remoteObject{
+		name:     name,
+		url:      rawURL,
+		client:   http.DefaultClient,
+		sign:     sign,
+		blocks:   make(map[int64]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[int64]*blockFetch),
+	}
+	size, err := o.fetchSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.size = size
+	return o, nil
+}
+
+func (o *remoteObject) Size() int64 { return o.size }
+
+func (o *remoteObject) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.blocks = make(map[int64]*list.Element)
+	o.lru.Init()
+	return nil
+}
+
+func (o *remoteObject) ReadAt(p []byte, off int64) (int, error) {
+	return o.ReadAtContext(context.Background(), p, off)
+}
+
+func (o *remoteObject) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%s: negative offset", o.name)
+	}
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), o.size)
+	first, last := off/blockSize, (end-1)/blockSize
+
+	blocks := make([][]byte, last-first+1)
+	if len(blocks) == 1 {
+		data, err := o.block(ctx, first)
+		if err != nil {
+			return 0, err
+		}
+		blocks[0] = data
+	} else {
+		var wg sync.WaitGroup
+		errs := make([]error, len(blocks))
+		sem := make(chan struct{}, fetchParallel)
+		for i := range blocks {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				blocks[i], errs[i] = o.block(ctx, first+int64(i))
+			}(i)
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for i, data := range blocks {
+		start := int64(0)
+		if i == 0 {
+			start = off - first*blockSize
+		}
+		n += copy(p[n:], data[start:])
+	}
+	if int64(n) < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (o *remoteObject) Prefetch(ctx context.Context, off, length int64) (int64, error) {
+	if off < 0 || length <= 0 || off >= o.size {
+		return 0, nil
+	}
+	end := min(off+length, o.size)
+	first, last := off/blockSize, (end-1)/blockSize
+	skipped := int64(0)
+	if last-first+1 > prefetchBlocks {
+		last = first + prefetchBlocks - 1
+		skipped = end - (last+1)*blockSize
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, last-first+1)
+	sem := make(chan struct{}, fetchParallel)
+	for index := first; index <= last; index++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(index int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, errs[index-first] = o.block(ctx, index)
+		}(index)
+	}
+	wg.Wait()
+	return skipped, errors.Join(errs...)
+}
+
+// block returns block index from the cache, fetching it if needed.
+func (o *remoteObject) block(ctx context.Context, index int64) ([]byte, error) {
+	o.mu.Lock()
+	if elem, ok := o.blocks[index]; ok {
+		o.lru.MoveToFront(elem)
+		o.mu.Unlock()
+		return elem.Value.(*cachedBlock).data, nil
+	}
+	if fetch, ok := o.inflight[index]; ok {
+		o.mu.Unlock()
+		select {
+		case <-fetch.done:
+			return fetch.data, fetch.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	fetch := &blockFetch{done: make(chan struct{})}
+	o.inflight[index] = fetch
+	o.mu.Unlock()
+
+	start := index * blockSize
+	end := min(start+blockSize, o.size)
+	fetch.data, fetch.err = o.fetchRange(ctx, start, end)
+
+	o.mu.Lock()
+	delete(o.inflight, index)
+	if fetch.err == nil {
+		o.blocks[index] = o.lru.PushFront(&cachedBlock{index: index, data: fetch.data})
+		for o.lru.Len() > cacheBlocks {
+			oldest := o.lru.Back()
+			o.lru.Remove(oldest)
+			delete(o.blocks, oldest.Value.(*cachedBlock).index)
+		}
+	}
+	o.mu.Unlock()
+	close(fetch.done)
+	return fetch.data, fetch.err
+}
+
+// fetchRange downloads bytes [start, end).
+func (o *remoteObject) fetchRange(ctx context.Context, start, end int64) ([]byte, error) {
+	var data []byte
+	err := retry(ctx, o.name, func() (*http.Response, error) {
+		resp, err := o.do(ctx, http.MethodGet, fmt.Sprintf("bytes=%d-%d", start, end-1))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusPartialContent:
+		case resp.StatusCode == http.StatusOK && start == 0 && end == o.size:
+		case resp.StatusCode == http.StatusOK:
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: server does not support range requests", o.name)
+		default:
+			return resp, nil
+		}
+		defer resp.Body.Close()
+		data = make([]byte, end-start)
+		if _, err := io.ReadFull(resp.Body, data); err != nil {
+			return nil, fmt.Errorf("read %s: %w", o.name, err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetchSize learns the object size with HEAD, falling back to a one-byte range GET for servers
+// and presigned URLs that only allow GET.
+func (o *remoteObject) fetchSize(ctx context.Context) (int64, error) {
+	var size int64 = -1
+	err := retry(ctx, o.name, func() (*http.Response, error) {
+		resp, err := o.do(ctx, http.MethodHead, "")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+			resp.Body.Close()
+			size = resp.ContentLength
+			return nil, nil
+		}
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		resp, err = o.do(ctx, http.MethodGet, "bytes=0-0")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			return resp, nil
+		}
+		resp.Body.Close()
+		_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		if size, err = strconv.ParseInt(total, 10, 64); !ok || err != nil {
+			return nil, fmt.Errorf("%s: server does not report the object size", o.name)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (o *remoteObject) do(ctx context.Context, method, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, o.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", o.name, err)
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	if o.sign != nil {
+		if err := o.sign(req); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.name, err)
+		}
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, retryable{fmt.Errorf("%s: %w", o.name, err)}
+	}
+	return resp, nil
+}
+
+// retryable marks errors worth another attempt.
+type retryable struct{ error }
+
+func (r retryable) Unwrap() error { return r.error }
+
+// retry runs attempt until it succeeds. attempt returns a response only for an unexpected
+// status, which retry turns into an error naming name and retries when it is 429 or 5xx.
+func retry(ctx context.Context, name string, attempt func() (*http.Response, error)) error {
+	var err error
+	for i := 0; i < fetchAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(i*i) * 250 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		var resp *http.Response
+		resp, err = attempt()
+		if resp != nil {
+			err = statusError(name, resp)
+		}
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		var again retryable
+		if !errors.As(err, &again) {
+			return err
+		}
+	}
+	return err
+}
+
+func statusError(name string, resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s: %s", name, resp.Status)
+	if detail := strings.TrimSpace(string(body)); detail != "" {
+		err = fmt.Errorf("%s: %s: %s", name, resp.Status, detail)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return retryable{err}
+	}
+	return err
+}
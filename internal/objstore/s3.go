@@ -0,0 +1,221 @@
+package objstore
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Credentials are the static keys used to sign S3 requests.
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// openS3 reads s3://bucket/key. Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN, then the AWS_PROFILE (or default) section of the shared credentials
+// file; without either, requests are anonymous, which works for public buckets. The region is
+// AWS_REGION or AWS_DEFAULT_REGION (default us-east-1), and AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL point at S3-compatible stores such as MinIO or R2 using path-style URLs.
+func openS3(ctx context.Context, u *url.URL) (*remoteObject, error) {
+	endpoint, sign, err := s3Endpoint(u, "")
+	if err != nil {
+		return nil, err
+	}
+	return openRemote(ctx, u.String(), endpoint, sign)
+}
+
+// s3Endpoint resolves s3://bucket/key to its HTTPS URL and the request signer, nil without
+// credentials, as openS3 describes. A non-empty custom endpoint replaces the environment's.
+func s3Endpoint(u *url.URL, custom string) (string, func(*http.Request) error, error) {
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return "", nil, fmt.Errorf("invalid S3 URL %q: expected s3://bucket/key", u.String())
+	}
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var endpoint string
+	if custom == "" {
+		custom = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if custom != "" {
+		endpoint = strings.TrimSuffix(custom, "/") + "/" + bucket + "/" + escapePath(key)
+	} else if strings.Contains(bucket, ".") {
+		// Virtual-hosted names with dots fail TLS verification against *.s3 certificates.
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", region, bucket, escapePath(key))
+	} else {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapePath(key))
+	}
+
+	var sign func(*http.Request) error
+	if creds, ok := loadS3Credentials(); ok {
+		sign = func(req *http.Request) error {
+			signS3(req, creds, region, time.Now().UTC())
+			return nil
+		}
+	}
+	return endpoint, sign, nil
+}
+
+func loadS3Credentials() (s3Credentials, bool) {
+	creds := s3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, true
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return s3Credentials{}, false
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return s3Credentials{}, false
+	}
+	defer file.Close()
+
+	creds = s3Credentials{}
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	return creds, creds.AccessKeyID != "" && creds.SecretAccessKey != ""
+}
+
+// signS3 adds an AWS Signature Version 4 Authorization header to a request. The payload is
+// left unsigned, which S3 accepts over HTTPS, so uploads are not read twice.
+func signS3(req *http.Request, creds s3Credentials, region string, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if creds.SessionToken != "" {
+		headers["x-amz-security-token"] = creds.SessionToken
+	}
+	if r := req.Header.Get("Range"); r != "" {
+		headers["range"] = r
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath percent-encodes an object key as S3 expects in the canonical URI: everything but
+// unreserved characters and the "/" separators.
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,274 @@
+package od
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// Column names holding the origin and destination cells of a flow.
+const (
+	OriginColumn      = "h3_origin"
+	DestinationColumn = "h3_dest"
+)
+
+// Options configures an arc layer build.
+type Options struct {
+	InputPath string
+	// Segments is the number of great-circle segments per arc (default 32).
+	Segments  int
+	NonFinite props.NonFinitePolicy
+	Sanitizer props.StringSanitizer
+}
+
+// Result summarises an arc layer build.
+type Result struct {
+	TotalRows  int64
+	Emitted    int64
+	Skipped    int64
+	SkipSample []string
+	// PropertyTypes maps every carried property to its schema kind.
+	PropertyTypes map[string]string
+}
+
+const skipSampleLimit = 10
+
+// WriteArcs reads origin-destination rows and writes one great-circle line per row between
+// the origin and destination cell centers. All other columns (typically count) are carried as properties.
+func WriteArcs(ctx context.Context, opts Options, writer *ndjson.Writer) (*Result, error) {
+	segments := opts.Segments
+	if segments <= 0 {
+		segments = 32
+	}
+
+	reader, err := parquetreader.NewReader(opts.InputPath, parquetreader.ReaderOptions{BatchSize: 4096, Parallel: 1})
+	if err != nil {
+		return nil, fmt.Errorf("open OD parquet reader: %w", err)
+	}
+	defer reader.Close()
+
+	res := &Result{PropertyTypes: reader.PropertyTypes()}
+	res.PropertyTypes[OriginColumn] = "string"
+	res.PropertyTypes[DestinationColumn] = "string"
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		row, err := reader.NextContext(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read OD row: %w", err)
+		}
+		res.TotalRows++
+
+		feature, err := arcFeature(row, segments, opts)
+		if err != nil {
+			res.Skipped++
+			if len(res.SkipSample) < skipSampleLimit {
+				res.SkipSample = append(res.SkipSample, fmt.Sprintf("row %d: %v", row.RowNumber, err))
+			}
+			continue
+		}
+
+		if err := writer.WriteFeature(feature); err != nil {
+			return nil, fmt.Errorf("write arc feature: %w", err)
+		}
+		res.Emitted++
+	}
+
+	return res, nil
+}
+
+// PropertyKeys returns the carried property names in sorted order.
+func (r *Result) PropertyKeys() []string {
+	keys := make([]string, 0, len(r.PropertyTypes))
+	for key := range r.PropertyTypes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func arcFeature(row *parquetreader.Row, segments int, opts Options) (ndjson.Feature, error) {
+	origin, originStr, err := cellFromProperty(row.Properties, OriginColumn)
+	if err != nil {
+		return ndjson.Feature{}, err
+	}
+	dest, destStr, err := cellFromProperty(row.Properties, DestinationColumn)
+	if err != nil {
+		return ndjson.Feature{}, err
+	}
+
+	from, err := origin.LatLng()
+	if err != nil {
+		return ndjson.Feature{}, fmt.Errorf("origin center: %w", err)
+	}
+	to, err := dest.LatLng()
+	if err != nil {
+		return ndjson.Feature{}, fmt.Errorf("destination center: %w", err)
+	}
+
+	properties := make(map[string]any, len(row.Properties))
+	for key, value := range row.Properties {
+		properties[key] = value
+	}
+	properties[OriginColumn] = originStr
+	properties[DestinationColumn] = destStr
+	opts.NonFinite.Apply(properties)
+	opts.Sanitizer.Apply(properties)
+
+	geometry := GreatCircle(orb.Point{from.Lng, from.Lat}, orb.Point{to.Lng, to.Lat}, segments)
+	bound := geometry.Bound()
+	return ndjson.Feature{
+		ID:         originStr + "-" + destStr,
+		Geometry:   geometry,
+		Properties: properties,
+		BBox:       &bound,
+	}, nil
+}
+
+func cellFromProperty(properties map[string]any, column string) (h3.Cell, string, error) {
+	var raw any
+	for key, value := range properties {
+		if strings.EqualFold(key, column) {
+			raw = value
+			break
+		}
+	}
+
+	var s string
+	switch v := raw.(type) {
+	case nil:
+		return 0, "", fmt.Errorf("missing %s", column)
+	case string:
+		s = strings.TrimSpace(v)
+	case int64:
+		s = h3.IndexToString(uint64(v))
+	case uint64:
+		s = h3.IndexToString(v)
+	default:
+		s = strings.TrimSpace(fmt.Sprint(v))
+	}
+
+	cell := h3.Cell(h3.IndexFromString(s))
+	if !cell.IsValid() {
+		return 0, s, fmt.Errorf("invalid H3 cell %q in %s", s, column)
+	}
+	return cell, cell.String(), nil
+}
+
+// GreatCircle interpolates the shortest great-circle path between two lon/lat points. Paths
+// that cross the antimeridian are split so every part stays within [-180, 180].
+func GreatCircle(from, to orb.Point, segments int) orb.Geometry {
+	a := toVector(from)
+	b := toVector(to)
+
+	var line orb.LineString
+	if math.Acos(clamp(dot(a, b), -1, 1)) > math.Pi-1e-9 {
+		// Antipodes have no unique great circle; route through a point a quarter turn away.
+		via := perpendicular(a)
+		half := (segments + 1) / 2
+		line = slerp(a, via, half)
+		line = append(line, slerp(via, b, segments-half)[1:]...)
+	} else {
+		line = slerp(a, b, segments)
+	}
+
+	return splitAntimeridian(line)
+}
+
+func slerp(a, b [3]float64, segments int) orb.LineString {
+	omega := math.Acos(clamp(dot(a, b), -1, 1))
+	line := make(orb.LineString, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		t := float64(i) / float64(segments)
+		p := a
+		if omega >= 1e-12 {
+			sa := math.Sin((1-t)*omega) / math.Sin(omega)
+			sb := math.Sin(t*omega) / math.Sin(omega)
+			p = [3]float64{sa*a[0] + sb*b[0], sa*a[1] + sb*b[1], sa*a[2] + sb*b[2]}
+		}
+		line = append(line, fromVector(p))
+	}
+	return line
+}
+
+// perpendicular returns a unit vector at 90° from v, preferring a path over the nearer pole.
+func perpendicular(v [3]float64) [3]float64 {
+	axis := [3]float64{0, 0, 1}
+	if math.Abs(v[2]) > 0.9 {
+		axis = [3]float64{1, 0, 0}
+	}
+	// Project the axis onto the plane orthogonal to v.
+	d := dot(axis, v)
+	p := [3]float64{axis[0] - d*v[0], axis[1] - d*v[1], axis[2] - d*v[2]}
+	n := math.Sqrt(dot(p, p))
+	return [3]float64{p[0] / n, p[1] / n, p[2] / n}
+}
+
+func splitAntimeridian(line orb.LineString) orb.Geometry {
+	parts := orb.MultiLineString{}
+	current := orb.LineString{line[0]}
+	for i := 1; i < len(line); i++ {
+		prev, next := line[i-1], line[i]
+		if math.Abs(next[0]-prev[0]) <= 180 {
+			current = append(current, next)
+			continue
+		}
+
+		// Interpolate the latitude where the segment meets the antimeridian.
+		edge := 180.0
+		if prev[0] < 0 {
+			edge = -180
+		}
+		unwrapped := next[0] + 2*edge
+		frac := (edge - prev[0]) / (unwrapped - prev[0])
+		lat := prev[1] + frac*(next[1]-prev[1])
+
+		current = append(current, orb.Point{edge, lat})
+		parts = append(parts, current)
+		current = orb.LineString{{-edge, lat}, next}
+	}
+	parts = append(parts, current)
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return parts
+}
+
+func toVector(p orb.Point) [3]float64 {
+	lng := p[0] * math.Pi / 180
+	lat := p[1] * math.Pi / 180
+	return [3]float64{math.Cos(lat) * math.Cos(lng), math.Cos(lat) * math.Sin(lng), math.Sin(lat)}
+}
+
+func fromVector(v [3]float64) orb.Point {
+	lng := math.Atan2(v[1], v[0]) * 180 / math.Pi
+	lat := math.Atan2(v[2], math.Hypot(v[0], v[1])) * 180 / math.Pi
+	return orb.Point{lng, lat}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
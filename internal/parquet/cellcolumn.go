@@ -0,0 +1,129 @@
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+)
+
+const (
+	// cellColumnSample is how many leading rows are checked before an integer column is
+	// accepted as holding cell indexes.
+	cellColumnSample = 1000
+	// minCellColumnValidity is the share of sampled non-null values that must be valid cells.
+	// Real index columns sit near 100%; sequential IDs named "cell" or "cell_id" sit near 0%.
+	minCellColumnValidity = 0.5
+)
+
+// screenIntegerCellColumns samples integer columns whose names match the grid's identifier
+// columns and records those that do not look like cell indexes in r.notCells, so they are
+// read as properties instead. String columns are not screened: their format is distinctive
+// enough that a name match is trusted. If every candidate column is rejected the file has no
+// cell column, and the returned error wraps ErrNoH3Column with the reason.
+func (r *Reader) screenIntegerCellColumns() error {
+	schema := r.schema
+	columns := schema.Columns()
+
+	var candidates []int
+	var names []string
+	for i, path := range columns {
+		name := strings.Join(path, ".")
+		if !grid.IsCellColumn(r.opts.Grid, name) {
+			continue
+		}
+		names = append(names, name)
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			continue
+		}
+		if kind := leaf.Node.Type().Kind(); kind == parquet.Int32 || kind == parquet.Int64 {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	seen := make(map[int]int, len(candidates))
+	valid := make(map[int]int, len(candidates))
+	if err := r.sampleRows(cellColumnSample, func(row parquet.Row) {
+		for _, value := range row {
+			col := value.Column()
+			if value.IsNull() || !slices.Contains(candidates, col) {
+				continue
+			}
+			seen[col]++
+			cell, _, err := r.opts.Grid.Parse(valueToGo(value))
+			if err == nil && cell != 0 && r.opts.Grid.Valid(cell) {
+				valid[col]++
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	var reasons []string
+	for _, col := range candidates {
+		if seen[col] == 0 {
+			continue
+		}
+		rate := float64(valid[col]) / float64(seen[col])
+		if rate >= minCellColumnValidity {
+			continue
+		}
+		name := strings.Join(columns[col], ".")
+		if r.notCells == nil {
+			r.notCells = make(map[string]bool)
+		}
+		r.notCells[name] = true
+		reasons = append(reasons, fmt.Sprintf("integer column %q has only %d of %d sampled values (%.1f%%) that are valid %s cells, below the %.0f%% needed to treat it as a cell index; it looks like a plain ID",
+			name, valid[col], seen[col], rate*100, strings.ToUpper(r.opts.Grid.Name()), minCellColumnValidity*100))
+	}
+
+	if len(r.notCells) > 0 && len(r.notCells) == len(names) {
+		return fmt.Errorf("%w: %s", ErrNoH3Column, strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+// sampleRows passes up to limit leading rows of the file to fn without moving the main reader.
+func (r *Reader) sampleRows(limit int, fn func(parquet.Row)) error {
+	pf, err := r.openFile()
+	if err != nil {
+		return err
+	}
+	buf := make([]parquet.Row, min(limit, r.opts.BatchSize))
+	for _, group := range r.rowGroups(pf) {
+		rows := group.Rows()
+		for limit > 0 {
+			n, err := rows.ReadRows(buf[:min(limit, len(buf))])
+			for _, row := range buf[:n] {
+				fn(row)
+			}
+			limit -= n
+			if errors.Is(err, io.EOF) || (err == nil && n == 0) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("sample parquet rows: %w", err)
+			}
+		}
+		rows.Close()
+		if limit <= 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// isCellColumn reports whether name holds cell indexes, honouring screenIntegerCellColumns.
+func (r *Reader) isCellColumn(name string) bool {
+	return grid.IsCellColumn(r.opts.Grid, name) && !r.notCells[name]
+}
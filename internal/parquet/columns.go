@@ -0,0 +1,112 @@
+package parquet
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+// Reasons a property column is considered unusable.
+const (
+	UnusableAllNull  = "entirely null"
+	UnusableConstant = "constant"
+	UnusableBinary   = "binary blob"
+)
+
+// UnusableColumn names a property column that carries no information for map features.
+type UnusableColumn struct {
+	Name   string
+	Reason string
+	// value is the encoded value of a constant column, so Dataset can tell whether files agree.
+	value []byte
+}
+
+// UnusableColumns finds property columns that are entirely null, hold a single value, or store
+// raw bytes without a string annotation. Null and constant columns are detected from the column
+// chunk statistics in the footer, so no rows are read; columns without statistics are never
+// reported as null or constant.
+func (r *Reader) UnusableColumns() ([]UnusableColumn, error) {
+	pf, err := r.openFile()
+	if err != nil {
+		return nil, err
+	}
+	schema := pf.Schema()
+
+	leaves := leafColumnsOf(schema, r.opts.FlattenNested)
+	var out []UnusableColumn
+	for i, path := range schema.Columns() {
+		name := strings.Join(path, ".")
+		// A list or nested field is one property, which no single leaf speaks for.
+		if r.isCellColumn(name) || leaves[i].structured() {
+			continue
+		}
+		if _, projected := r.schema.Lookup(path...); !projected {
+			continue
+		}
+		if leaf, ok := schema.Lookup(path...); ok && isBinaryBlob(leaf.Node.Type()) {
+			out = append(out, UnusableColumn{Name: name, Reason: UnusableBinary})
+			continue
+		}
+		if reason, value := chunkStatsReason(pf, i); reason != "" {
+			out = append(out, UnusableColumn{Name: name, Reason: reason, value: value})
+		}
+	}
+	return out, nil
+}
+
+// chunkStatsReason combines the statistics of column col across every row group. For a constant
+// column it also returns the value.
+func chunkStatsReason(pf *parquet.File, col int) (string, []byte) {
+	var values, nulls int64
+	var value []byte
+	constant := true
+	for _, group := range pf.Metadata().RowGroups {
+		if col >= len(group.Columns) {
+			return "", nil
+		}
+		meta := group.Columns[col].MetaData
+		stats := meta.Statistics
+		values += meta.NumValues
+		nulls += stats.NullCount
+		if stats.NullCount == meta.NumValues {
+			continue
+		}
+		if stats.MinValue == nil || !bytes.Equal(stats.MinValue, stats.MaxValue) {
+			constant = false
+			continue
+		}
+		if value == nil {
+			value = stats.MinValue
+		} else if !bytes.Equal(value, stats.MinValue) {
+			constant = false
+		}
+	}
+	switch {
+	case values == 0:
+		return "", nil
+	case nulls == values:
+		return UnusableAllNull, nil
+	case constant && nulls == 0 && value != nil:
+		return UnusableConstant, value
+	default:
+		return "", nil
+	}
+}
+
+// isBinaryBlob reports byte array columns that are raw bytes or BSON.
+func isBinaryBlob(t parquet.Type) bool {
+	if kind := t.Kind(); kind != parquet.ByteArray && kind != parquet.FixedLenByteArray {
+		return false
+	}
+	// Any annotation other than BSON (string, enum, JSON, UUID, decimal) gives the bytes meaning.
+	if lt := t.LogicalType(); lt != nil && lt.Bson == nil {
+		return false
+	}
+	// Files from older writers only carry the converted type.
+	if ct := t.ConvertedType(); ct != nil && *ct != deprecated.Bson {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,390 @@
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// hiveDefaultPartition is the directory value Hive, Spark and DuckDB write for a null key.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// Dataset reads a directory of Parquet files as one input. Hive-style directory names such as
+// region=us/res=8 become properties of every row in the files below them, typed as int or
+// float when every value of a key parses as one and as string otherwise. Files and directories
+// whose names start with "_" or "." (_SUCCESS, _delta_log, .crc files) are ignored, as Spark
+// does. Row numbers run across the files in path order.
+type Dataset struct {
+	dir       string
+	opts      ReaderOptions
+	readers   []*Reader
+	totalRows int64
+
+	mu      sync.Mutex
+	current int
+}
+
+// NewDataset opens every Parquet file below dir.
+func NewDataset(dir string, opts ReaderOptions) (*Dataset, error) {
+	files, err := datasetFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .parquet files found under %s", dir)
+	}
+
+	partitions := make([]map[string]string, len(files))
+	for i, file := range files {
+		partitions[i], err = hivePartition(dir, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	values, types := typePartitions(partitions)
+
+	d := &Dataset{dir: filepath.Clean(dir), opts: opts}
+	for i, file := range files {
+		reader, err := NewReader(file, opts)
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		reader.partition = values[i]
+		reader.partitionTypes = types
+		reader.rowBase = d.totalRows
+		d.totalRows += reader.TotalRows()
+		d.readers = append(d.readers, reader)
+	}
+	return d, nil
+}
+
+// datasetFiles lists the .parquet files below dir in lexical path order.
+func datasetFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if path != dir && (strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(name), ".parquet") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list dataset files: %w", err)
+	}
+	return files, nil
+}
+
+// hivePartition parses the key=value directory names between dir and file. A null partition
+// maps to an empty value.
+func hivePartition(dir, file string) (map[string]string, error) {
+	rel, err := filepath.Rel(dir, filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("partition of %s: %w", file, err)
+	}
+	partition := make(map[string]string)
+	if rel == "." {
+		return partition, nil
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+		key, value, ok := strings.Cut(segment, "=")
+		if !ok || key == "" {
+			continue
+		}
+		// Writers percent-encode characters that are not safe in paths.
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		if value == hiveDefaultPartition {
+			value = ""
+		}
+		partition[key] = value
+	}
+	return partition, nil
+}
+
+// typePartitions converts the partition values of every file to a common kind per key. Keys
+// missing from a file's path are null for its rows.
+func typePartitions(partitions []map[string]string) ([]map[string]any, map[string]string) {
+	types := make(map[string]string)
+	for _, partition := range partitions {
+		for key, value := range partition {
+			kind, seen := types[key]
+			if !seen {
+				kind = "int"
+			}
+			if value == "" {
+				types[key] = kind
+				continue
+			}
+			if kind == "int" {
+				if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+					kind = "float"
+				}
+			}
+			if kind == "float" {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					kind = "string"
+				}
+			}
+			types[key] = kind
+		}
+	}
+
+	values := make([]map[string]any, len(partitions))
+	for i, partition := range partitions {
+		values[i] = make(map[string]any, len(types))
+		for key, kind := range types {
+			raw, ok := partition[key]
+			if !ok || raw == "" {
+				values[i][key] = nil
+				continue
+			}
+			switch kind {
+			case "int":
+				v, _ := strconv.ParseInt(raw, 10, 64)
+				values[i][key] = v
+			case "float":
+				v, _ := strconv.ParseFloat(raw, 64)
+				values[i][key] = v
+			default:
+				values[i][key] = raw
+			}
+		}
+	}
+	return values, types
+}
+
+// Close releases every file of the dataset.
+func (d *Dataset) Close() error {
+	for _, reader := range d.readers {
+		reader.Close()
+	}
+	return nil
+}
+
+// Next returns the next decoded row across the files, or io.EOF.
+func (d *Dataset) Next() (*Row, error) {
+	return d.NextContext(context.Background())
+}
+
+// NextContext is Next, returning ctx.Err() once ctx is done.
+func (d *Dataset) NextContext(ctx context.Context) (*Row, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.current < len(d.readers) {
+		row, err := d.readers[d.current].NextContext(ctx)
+		if !errors.Is(err, io.EOF) {
+			return row, err
+		}
+		d.current++
+	}
+	return nil, io.EOF
+}
+
+// Skip discards the next n rows, moving on to later files as needed.
+func (d *Dataset) Skip(n int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for n > 0 && d.current < len(d.readers) {
+		reader := d.readers[d.current]
+		remaining := reader.remaining()
+		if n < remaining {
+			return reader.Skip(n)
+		}
+		if err := reader.Skip(remaining); err != nil {
+			return err
+		}
+		n -= remaining
+		d.current++
+	}
+	return nil
+}
+
+// Stream decodes the row groups of every file on opts.Parallel goroutines, so small partition
+// files are read concurrently too. See Reader.Stream.
+func (d *Dataset) Stream(ctx context.Context) (<-chan *Row, <-chan error) {
+	rows := make(chan *Row, d.readers[0].opts.BatchSize)
+	errs := make(chan error, 1)
+
+	type job struct {
+		reader *Reader
+		group  parquet.RowGroup
+		first  int64
+		leaves []leafColumn
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		for _, reader := range d.readers {
+			file, err := reader.openFileContext(ctx)
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+				cancel()
+				return
+			}
+			leaves := reader.leafColumns()
+			first := reader.rowBase + 1
+			for _, group := range reader.rowGroups(file) {
+				select {
+				case jobs <- job{reader: reader, group: group, first: first, leaves: leaves}:
+				case <-ctx.Done():
+					return
+				}
+				first += group.NumRows()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.readers[0].opts.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := j.reader.streamGroup(ctx, j.group, j.first, j.leaves, rows); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(rows)
+		close(errs)
+	}()
+
+	return rows, errs
+}
+
+// TotalRows returns the row count summed over every file footer.
+func (d *Dataset) TotalRows() int64 {
+	return d.totalRows
+}
+
+// PropertyTypes merges the property kinds of every file, including the partition keys. A column
+// keeps the kind of the first file that declares it.
+func (d *Dataset) PropertyTypes() map[string]string {
+	types := make(map[string]string)
+	for _, reader := range d.readers {
+		for key, kind := range reader.PropertyTypes() {
+			if _, exists := types[key]; !exists {
+				types[key] = kind
+			}
+		}
+	}
+	return types
+}
+
+// KeyValueMetadata merges the key-value metadata of the files; the first file in path order
+// that holds a key decides its value.
+func (d *Dataset) KeyValueMetadata() map[string]string {
+	var merged map[string]string
+	for _, reader := range d.readers {
+		for key, value := range reader.KeyValueMetadata() {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			if _, exists := merged[key]; !exists {
+				merged[key] = value
+			}
+		}
+	}
+	return merged
+}
+
+// UnusableColumns reports the columns that are unusable for the same reason in every file,
+// constant columns only when every file holds the same value, and partition keys that are null
+// or take a single value across the dataset.
+func (d *Dataset) UnusableColumns() ([]UnusableColumn, error) {
+	var common map[string]UnusableColumn
+	for i, reader := range d.readers {
+		cols, err := reader.UnusableColumns()
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]UnusableColumn, len(cols))
+		for _, col := range cols {
+			if _, partition := reader.partition[col.Name]; partition {
+				continue
+			}
+			if i == 0 {
+				found[col.Name] = col
+				continue
+			}
+			prev, ok := common[col.Name]
+			if ok && prev.Reason == col.Reason && bytes.Equal(prev.value, col.value) {
+				found[col.Name] = col
+			}
+		}
+		common = found
+	}
+
+	out := make([]UnusableColumn, 0, len(common))
+	for _, col := range common {
+		out = append(out, col)
+	}
+	out = append(out, d.unusablePartitionKeys()...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (d *Dataset) unusablePartitionKeys() []UnusableColumn {
+	var out []UnusableColumn
+	for key := range d.readers[0].partitionTypes {
+		distinct := make(map[any]bool)
+		nulls := 0
+		for _, reader := range d.readers {
+			if value := reader.partition[key]; value == nil {
+				nulls++
+			} else {
+				distinct[value] = true
+			}
+		}
+		switch {
+		case nulls == len(d.readers):
+			out = append(out, UnusableColumn{Name: key, Reason: UnusableAllNull})
+		case nulls == 0 && len(distinct) == 1:
+			out = append(out, UnusableColumn{Name: key, Reason: UnusableConstant})
+		}
+	}
+	return out
+}
+
+// remaining is how many rows Next has not yet returned or skipped.
+func (r *Reader) remaining() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totalRows - r.read + int64(len(r.buffer)-r.cursor)
+}
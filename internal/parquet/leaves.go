@@ -0,0 +1,153 @@
+package parquet
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// leafColumn is where the values of one leaf column go among the properties of a row.
+type leafColumn struct {
+	// key is the property: the top-level field, or the dotted leaf path with FlattenNested.
+	key string
+	// path locates the leaf inside the JSON object of a nested field kept as one property,
+	// such as [city] for address.city; it is empty for every other leaf.
+	path []string
+	// repeated leaves sit inside a list and hold any number of values per row.
+	repeated bool
+	kind     parquet.Kind
+}
+
+// leafColumns maps the leaf columns of r.schema, in column order, to property keys.
+func (r *Reader) leafColumns() []leafColumn {
+	return leafColumnsOf(r.schema, r.opts.FlattenNested)
+}
+
+// leafColumnsOf walks schema depth first, which visits the leaves in column order. The
+// repeated "list" group and "element" field of the standard LIST encoding add nothing to a
+// key, so a list of strings named tags is the property tags rather than tags.list.element.
+func leafColumnsOf(schema *parquet.Schema, flatten bool) []leafColumn {
+	var leaves []leafColumn
+	var walk func(node parquet.Node, path []string, repeated bool)
+	walk = func(node parquet.Node, path []string, repeated bool) {
+		repeated = repeated || node.Repeated()
+		if node.Leaf() {
+			leaf := leafColumn{key: strings.Join(path, "."), repeated: repeated, kind: node.Type().Kind()}
+			if !flatten && len(path) > 1 {
+				leaf.key, leaf.path = path[0], path[1:]
+			}
+			leaves = append(leaves, leaf)
+			return
+		}
+		if element, ok := listElement(node); ok {
+			walk(element, path, true)
+			return
+		}
+		for _, field := range node.Fields() {
+			walk(field, append(path[:len(path):len(path)], field.Name()), repeated)
+		}
+	}
+	for _, field := range schema.Fields() {
+		walk(field, []string{field.Name()}, false)
+	}
+	return leaves
+}
+
+// listElement returns the element field of a list in the standard LIST encoding, a group
+// holding only a repeated group named list of one field. File schemas drop the LIST annotation
+// of groups, so the shape is matched instead.
+func listElement(node parquet.Node) (parquet.Node, bool) {
+	fields := node.Fields()
+	if len(fields) != 1 || fields[0].Name() != "list" || fields[0].Leaf() || !fields[0].Repeated() {
+		return nil, false
+	}
+	if inner := fields[0].Fields(); len(inner) == 1 {
+		return inner[0], true
+	}
+	return nil, false
+}
+
+// structured reports whether the leaf is read into a list or a nested field kept as one
+// property rather than as a property of its own.
+func (l leafColumn) structured() bool {
+	return l.repeated || len(l.path) > 0
+}
+
+// propertyKind is the kind a leaf's values have as a property. Lists and nested fields are
+// JSON text.
+func (l leafColumn) propertyKind() string {
+	if l.structured() {
+		return "string"
+	}
+	return kindName(l.kind)
+}
+
+// assembleRow turns the values of a raw row into a map keyed by property. A repeated leaf
+// collects its values into an array and a nested field kept as one property into an object,
+// and both are then written as their JSON text, the form the NDJSON reader gives nested
+// values. A list or nested field without any non-null value is null.
+func assembleRow(raw parquet.Row, leaves []leafColumn) map[string]any {
+	row := make(map[string]any, len(leaves))
+	structured := make(map[string]bool)
+	for _, value := range raw {
+		col := value.Column()
+		if col < 0 || col >= len(leaves) {
+			continue
+		}
+		leaf := leaves[col]
+		if !leaf.structured() {
+			row[leaf.key] = valueToGo(value)
+			continue
+		}
+		structured[leaf.key] = true
+		if value.IsNull() {
+			if _, ok := row[leaf.key]; !ok {
+				row[leaf.key] = nil
+			}
+			continue
+		}
+		if len(leaf.path) == 0 {
+			list, _ := row[leaf.key].([]any)
+			row[leaf.key] = append(list, valueToGo(value))
+			continue
+		}
+		object, _ := row[leaf.key].(map[string]any)
+		if object == nil {
+			object = make(map[string]any)
+			row[leaf.key] = object
+		}
+		setNested(object, leaf.path, valueToGo(value), leaf.repeated)
+	}
+	for key := range structured {
+		if row[key] == nil {
+			continue
+		}
+		encoded, err := json.Marshal(row[key])
+		if err != nil {
+			row[key] = nil
+			continue
+		}
+		row[key] = string(encoded)
+	}
+	return row
+}
+
+// setNested stores value at path inside object, appending it to an array for a repeated leaf.
+func setNested(object map[string]any, path []string, value any, repeated bool) {
+	for _, name := range path[:len(path)-1] {
+		child, _ := object[name].(map[string]any)
+		if child == nil {
+			child = make(map[string]any)
+			object[name] = child
+		}
+		object = child
+	}
+	name := path[len(path)-1]
+	if !repeated {
+		object[name] = value
+		return
+	}
+	list, _ := object[name].([]any)
+	object[name] = append(list, value)
+}
@@ -0,0 +1,99 @@
+package parquet
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type nestedAddress struct {
+	City string `parquet:"city"`
+	Zip  int32  `parquet:"zip"`
+}
+
+type nestedRow struct {
+	H3      string         `parquet:"h3"`
+	Score   float32        `parquet:"score"`
+	Count   int32          `parquet:"count"`
+	Address nestedAddress  `parquet:"address"`
+	Tags    []string       `parquet:"tags,list"`
+	Visits  []int64        `parquet:"visits"`
+	Owner   *nestedAddress `parquet:"owner,optional"`
+}
+
+func writeNested(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nested.parquet")
+	rows := []nestedRow{{
+		H3: "8828308281fffff", Score: 1.5, Count: 3,
+		Address: nestedAddress{City: "Oakland", Zip: 94607},
+		Tags:    []string{"a", "b"},
+		Visits:  []int64{4, 5},
+	}}
+	if err := parquet.WriteFile(path, rows); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readOne(t *testing.T, path string, opts ReaderOptions) (*Row, map[string]string) {
+	t.Helper()
+	r, err := NewReader(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	row, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Err != nil {
+		t.Fatal(row.Err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("second row: %v, want io.EOF", err)
+	}
+	return row, r.PropertyTypes()
+}
+
+func TestNestedFieldsAsJSON(t *testing.T) {
+	row, types := readOne(t, writeNested(t), ReaderOptions{})
+	want := map[string]any{
+		"score":   float64(1.5),
+		"count":   int64(3),
+		"address": `{"city":"Oakland","zip":94607}`,
+		"tags":    `["a","b"]`,
+		"visits":  `[4,5]`,
+		"owner":   nil,
+	}
+	if !reflect.DeepEqual(row.Properties, want) {
+		t.Errorf("properties %#v\nwant %#v", row.Properties, want)
+	}
+	wantTypes := map[string]string{"score": "float", "count": "int", "address": "string", "tags": "string", "visits": "string", "owner": "string"}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Errorf("types %v, want %v", types, wantTypes)
+	}
+}
+
+func TestFlattenNested(t *testing.T) {
+	row, types := readOne(t, writeNested(t), ReaderOptions{FlattenNested: true})
+	want := map[string]any{
+		"score":        float64(1.5),
+		"count":        int64(3),
+		"address.city": "Oakland",
+		"address.zip":  int64(94607),
+		"tags":         `["a","b"]`,
+		"visits":       `[4,5]`,
+		"owner.city":   nil,
+		"owner.zip":    nil,
+	}
+	if !reflect.DeepEqual(row.Properties, want) {
+		t.Errorf("properties %#v\nwant %#v", row.Properties, want)
+	}
+	if types["address.zip"] != "int" || types["tags"] != "string" {
+		t.Errorf("types %v: want address.zip int and tags string", types)
+	}
+}
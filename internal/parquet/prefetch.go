@@ -0,0 +1,95 @@
+package parquet
+
+import (
+	"context"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+)
+
+// defaultPrefetch is how many row groups of a remote file Stream downloads ahead of the ones
+// being decoded when ReaderOptions.Prefetch is zero.
+const defaultPrefetch = 2
+
+// byteRange is one column chunk in the file.
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// prefetcher downloads the projected column chunks of upcoming row groups of a remote file in
+// the background, so decoding one row group overlaps the download of the next. The window
+// bounds how far ahead of the last dispatched row group it runs, and with it the memory used.
+type prefetcher struct {
+	groups   [][]byteRange
+	window   int
+	next     int
+	requests chan int
+}
+
+// newPrefetcher starts a prefetcher for the row groups of pf, or returns nil for local files
+// and when prefetching is disabled. It stops once ctx is done or finish is called.
+func (r *Reader) newPrefetcher(ctx context.Context, pf *parquet.File) *prefetcher {
+	window := r.opts.Prefetch
+	if window == 0 {
+		window = defaultPrefetch
+	}
+	if window < 0 || !objstore.IsRemote(r.filePath) {
+		return nil
+	}
+
+	projected := make(map[string]bool)
+	for _, path := range r.schema.Columns() {
+		projected[strings.Join(path, ".")] = true
+	}
+	rowGroups := pf.Metadata().RowGroups
+	p := &prefetcher{groups: make([][]byteRange, len(rowGroups)), window: window, requests: make(chan int, len(rowGroups))}
+	for i, group := range rowGroups {
+		for _, chunk := range group.Columns {
+			meta := chunk.MetaData
+			if !projected[strings.Join(meta.PathInSchema, ".")] {
+				continue
+			}
+			start := meta.DataPageOffset
+			if meta.DictionaryPageOffset > 0 && meta.DictionaryPageOffset < start {
+				start = meta.DictionaryPageOffset
+			}
+			p.groups[i] = append(p.groups[i], byteRange{offset: start, length: meta.TotalCompressedSize})
+		}
+	}
+
+	object := r.object
+	go func() {
+		for i := range p.requests {
+			for _, chunk := range p.groups[i] {
+				// Errors surface when the row group is read; a failed prefetch only costs time.
+				if _, err := object.Prefetch(ctx, chunk.offset, chunk.length); err != nil || ctx.Err() != nil {
+					return
+				}
+			}
+		}
+	}()
+	return p
+}
+
+// dispatched requests the row groups up to window past group, the one about to be decoded.
+func (p *prefetcher) dispatched(group int) {
+	if p == nil {
+		return
+	}
+	if p.next <= group {
+		p.next = group + 1
+	}
+	for ; p.next < len(p.groups) && p.next <= group+p.window; p.next++ {
+		p.requests <- p.next
+	}
+}
+
+// finish stops the prefetcher once every request is served.
+func (p *prefetcher) finish() {
+	if p != nil {
+		close(p.requests)
+	}
+}
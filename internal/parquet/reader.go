@@ -1,33 +1,46 @@
 package parquet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 
-	h3 "github.com/uber/h3-go/v4"
 	"github.com/parquet-go/parquet-go"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/objstore"
 )
 
 // ReaderOptions controls how Parquet rows are streamed.
 type ReaderOptions struct {
 	// BatchSize controls how many rows are fetched per request.
 	BatchSize int
-	// Parallel controls the number of goroutines spawned by parquet-go when decoding row groups.
+	// Parallel controls how many row groups Stream reads and decodes concurrently.
 	Parallel int
+	// Grid interprets the cell identifier column. Defaults to H3.
+	Grid grid.CellGeometry
+	// Columns projects the file onto these property columns plus the cell columns, so the
+	// pages of other columns are never read; dotted names select their top-level field. Nil
+	// reads every column.
+	Columns []string
+	// FlattenNested keys each leaf of a nested field by its dotted path, such as address.city,
+	// instead of keeping the field as one property holding its JSON text.
+	FlattenNested bool
+	// Prefetch is how many row groups of a remote file Stream downloads ahead of the ones it
+	// decodes. Zero uses the default of 2; a negative value disables prefetching.
+	Prefetch int
 }
 
-// Row represents a fully decoded Parquet row that contains an H3 index and optional properties.
+// Row represents a fully decoded Parquet row that contains a grid cell (H3 by default) and optional properties.
 type Row struct {
 	RowNumber  int64
-	Cell       h3.Cell
+	Cell       grid.Cell
 	CellString string
 	Resolution int
 	Properties map[string]any
@@ -36,15 +49,34 @@ type Row struct {
 
 // Reader streams H3 rows from a Parquet file.
 type Reader struct {
-	opts      ReaderOptions
-	filePath  string
-	reader    *parquet.Reader
+	opts     ReaderOptions
+	filePath string
+	reader   *parquet.Reader
+	// source backs reader; NextContext points it at the caller's context for the duration of
+	// each read.
+	source *contextReaderAt
+	// object is the local file or remote object shared by every parquet.File of the reader.
+	object objstore.Object
+	// schema is the file schema projected onto opts.Columns; conv converts row groups to it
+	// and is nil when nothing is projected away.
+	schema    *parquet.Schema
+	conv      parquet.Conversion
 	totalRows int64
-
-	mu     sync.Mutex
-	buffer []*Row
-	cursor int
-	read   int64
+	// keyValues is the key-value metadata of the file footer.
+	keyValues map[string]string
+
+	mu sync.Mutex
+	// notCells lists identifier-named columns rejected by screenIntegerCellColumns.
+	notCells map[string]bool
+	buffer   []*Row
+	cursor   int
+	read     int64
+
+	// Set by Dataset: partition values added to every row, their property kinds, and the
+	// number of dataset rows in the files before this one.
+	partition      map[string]any
+	partitionTypes map[string]string
+	rowBase        int64
 }
 
 // NewReader opens a Parquet file and prepares it for streaming rows.
@@ -55,22 +87,50 @@ func NewReader(path string, opts ReaderOptions) (*Reader, error) {
 	if opts.Parallel <= 0 {
 		opts.Parallel = runtime.NumCPU()
 	}
+	if opts.Grid == nil {
+		opts.Grid = grid.Default()
+	}
 
-	file, err := os.Open(path)
+	object, err := objstore.Open(context.Background(), path)
 	if err != nil {
 		return nil, fmt.Errorf("open parquet file: %w", err)
 	}
-
-	reader := parquet.NewReader(file)
-
-	// Get total rows from metadata
-	total := reader.NumRows()
+	source := &contextReaderAt{object: object, ctx: context.Background()}
+	file, err := parquet.OpenFile(source, object.Size())
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("open parquet file: %w", err)
+	}
 
 	r := &Reader{
-		opts:      opts,
-		filePath:  filepath.Clean(path),
-		reader:    reader,
-		totalRows: total,
+		opts:     opts,
+		filePath: path,
+		source:   source,
+		object:   object,
+		schema:   file.Schema(),
+	}
+	if kv := file.Metadata().KeyValueMetadata; len(kv) > 0 {
+		r.keyValues = make(map[string]string, len(kv))
+		for _, entry := range kv {
+			r.keyValues[entry.Key] = entry.Value
+		}
+	}
+	if !objstore.IsRemote(path) {
+		r.filePath = filepath.Clean(path)
+	}
+	if err := r.project(file.Schema()); err != nil {
+		object.Close()
+		return nil, err
+	}
+	if r.conv != nil {
+		r.reader = parquet.NewReader(file, r.schema)
+	} else {
+		r.reader = parquet.NewReader(file)
+	}
+	r.totalRows = r.reader.NumRows()
+	if err := r.screenIntegerCellColumns(); err != nil {
+		r.Close()
+		return nil, err
 	}
 
 	return r, nil
@@ -85,6 +145,10 @@ func (r *Reader) Close() error {
 		r.reader.Close()
 		r.reader = nil
 	}
+	if r.object != nil {
+		r.object.Close()
+		r.object = nil
+	}
 	r.buffer = nil
 	return nil
 }
@@ -92,20 +156,38 @@ func (r *Reader) Close() error {
 // ErrNoH3Column is returned when the Parquet file does not contain a recognizable H3 column.
 var ErrNoH3Column = errors.New("parquet file missing required H3 column")
 
+// ErrNullCell is returned for a row whose cell column is present but null or empty.
+var ErrNullCell = errors.New("cell value is null or empty")
+
 // Next returns the next decoded H3 row. It returns io.EOF when all rows are consumed.
 func (r *Reader) Next() (*Row, error) {
+	return r.NextContext(context.Background())
+}
+
+// NextContext is Next, but stops with ctx.Err() once ctx is done, including while a batch is
+// being read from storage.
+func (r *Reader) NextContext(ctx context.Context) (*Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if r.reader == nil {
 		return nil, fmt.Errorf("reader closed")
 	}
+	r.source.ctx = ctx
+	defer func() { r.source.ctx = context.Background() }()
 
 	if r.cursor >= len(r.buffer) {
 		if err := r.fillBuffer(); err != nil {
 			if errors.Is(err, io.EOF) {
 				return nil, io.EOF
 			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
 			return nil, err
 		}
 	}
@@ -119,6 +201,31 @@ func (r *Reader) Next() (*Row, error) {
 	return row, nil
 }
 
+// Skip discards the next n rows without decoding them. Later rows keep their file row numbers.
+func (r *Reader) Skip(n int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reader == nil {
+		return fmt.Errorf("reader closed")
+	}
+	buffered := int64(len(r.buffer) - r.cursor)
+	if n <= buffered {
+		r.cursor += int(n)
+		return nil
+	}
+	n -= buffered
+	r.buffer = r.buffer[:0]
+	r.cursor = 0
+
+	target := min(r.read+n, r.totalRows)
+	if err := r.reader.SeekToRow(target); err != nil {
+		return fmt.Errorf("seek parquet rows: %w", err)
+	}
+	r.read = target
+	return nil
+}
+
 func (r *Reader) fillBuffer() error {
 	if r.read >= r.totalRows {
 		return io.EOF
@@ -144,219 +251,318 @@ func (r *Reader) fillBuffer() error {
 	r.buffer = r.buffer[:0]
 	r.cursor = 0
 
-	// Get schema to understand column structure
-	schema := r.reader.Schema()
-	
+	leaves := r.leafColumns()
 	for i := 0; i < n; i++ {
-		rowNumber := r.read + 1
-		
-		// Convert parquet.Row to map[string]any
-		rowMap := make(map[string]any)
-		for j, value := range rows[i] {
-			if j < len(schema.Fields()) {
-				field := schema.Fields()[j]
-				rowMap[field.Name()] = value
-			}
-		}
+		r.read++
+		r.buffer = append(r.buffer, r.decodeRow(rows[i], leaves, r.rowBase+r.read))
+	}
 
-		props := extractProperties(rowMap)
-		cell, cellString, cellErr := extractCell(rowMap)
-		
-		if cellErr != nil {
-			r.buffer = append(r.buffer, &Row{
-				RowNumber:  rowNumber,
-				CellString: cellString,
-				Resolution: -1,
-				Properties: props,
-				Err:        fmt.Errorf("row %d: %w", rowNumber, cellErr),
-			})
-			r.read++
-			continue
-		}
+	return nil
+}
 
-		if cell == 0 {
-			r.buffer = append(r.buffer, &Row{
-				RowNumber:  rowNumber,
-				CellString: cellString,
-				Resolution: -1,
-				Properties: props,
-				Err:        fmt.Errorf("row %d: %w", rowNumber, ErrNoH3Column),
-			})
-			r.read++
-			continue
-		}
+// decodeRow converts a raw Parquet row into a Row. rowNumber is the 1-based position in the file,
+// or in the dataset the file belongs to.
+func (r *Reader) decodeRow(raw parquet.Row, leaves []leafColumn, rowNumber int64) *Row {
+	rowMap := assembleRow(raw, leaves)
 
-		if cellString == "" {
-			cellString = h3.IndexToString(uint64(cell))
-		}
+	props := r.extractProperties(rowMap)
+	cell, cellString, cellErr := r.extractCell(rowMap)
 
-		r.buffer = append(r.buffer, &Row{
+	if cellErr != nil {
+		return &Row{
 			RowNumber:  rowNumber,
-			Cell:       cell,
 			CellString: cellString,
-			Resolution: cell.Resolution(),
+			Resolution: -1,
 			Properties: props,
-		})
-		r.read++
+			Err:        fmt.Errorf("row %d: %w", rowNumber, cellErr),
+		}
 	}
 
-	return nil
-}
+	if cellString == "" {
+		cellString = r.opts.Grid.Token(cell)
+	}
 
-// TotalRows returns the number of rows reported by the Parquet footer.
-func (r *Reader) TotalRows() int64 {
-	return r.totalRows
+	return &Row{
+		RowNumber:  rowNumber,
+		Cell:       cell,
+		CellString: cellString,
+		Resolution: r.opts.Grid.Resolution(cell),
+		Properties: props,
+	}
 }
 
-var possibleH3Names = []string{"h3", "h3_id", "h3index", "h3_index", "h3id", "cell", "cell_id"}
+// Stream decodes the file's row groups on opts.Parallel goroutines, so slow storage can be read
+// concurrently, and sends every row on the returned channel. Rows of different row groups
+// interleave but keep their absolute RowNumber. The error channel yields at most one error and
+// is closed together with the row channel. Stream is independent of Next.
+func (r *Reader) Stream(ctx context.Context) (<-chan *Row, <-chan error) {
+	rows := make(chan *Row, r.opts.BatchSize)
+	errs := make(chan error, 1)
 
-func extractCell(row map[string]any) (h3.Cell, string, error) {
-	if len(row) == 0 {
-		return 0, "", nil
+	file, err := r.openFileContext(ctx)
+	if err != nil {
+		errs <- err
+		close(rows)
+		close(errs)
+		return rows, errs
 	}
 
-	keys := make([]string, 0, len(row))
-	for key := range row {
-		keys = append(keys, key)
+	type job struct {
+		group parquet.RowGroup
+		first int64
 	}
-	sort.Strings(keys)
-
-	for _, key := range keys {
-		if isH3Column(key) {
-			idx, cellString, err := parseCell(row[key])
-			if err != nil {
-				return 0, cellString, fmt.Errorf("column %s: %w", key, err)
+	ctx, cancel := context.WithCancel(ctx)
+	jobs := make(chan job)
+	prefetch := r.newPrefetcher(ctx, file)
+	go func() {
+		defer close(jobs)
+		defer prefetch.finish()
+		first := r.rowBase + 1
+		for i, group := range r.rowGroups(file) {
+			prefetch.dispatched(i)
+			select {
+			case jobs <- job{group: group, first: first}:
+			case <-ctx.Done():
+				return
 			}
-			if idx != 0 {
-				if !idx.IsValid() {
-					if cellString == "" {
-						cellString = h3.IndexToString(uint64(idx))
+			first += group.NumRows()
+		}
+	}()
+
+	leaves := r.leafColumns()
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := r.streamGroup(ctx, j.group, j.first, leaves, rows); err != nil {
+					select {
+					case errs <- err:
+					default:
 					}
-					return 0, cellString, fmt.Errorf("column %s: invalid H3 cell", key)
+					cancel()
+					return
 				}
-				if cellString == "" {
-					cellString = h3.IndexToString(uint64(idx))
-				}
-				return idx, cellString, nil
 			}
-		}
+		}()
 	}
 
-	return 0, "", ErrNoH3Column
-}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(rows)
+		close(errs)
+	}()
 
-func isH3Column(name string) bool {
-	lname := strings.ToLower(name)
-	for _, candidate := range possibleH3Names {
-		if lname == candidate {
-			return true
-		}
-	}
-	return false
+	return rows, errs
 }
 
-func parseCell(value any) (h3.Cell, string, error) {
-	switch v := value.(type) {
-	case nil:
-		return 0, "", nil
-	case string:
-		trimmed := strings.TrimSpace(v)
-		if trimmed == "" {
-			return 0, "", nil
-		}
-		cell, err := stringToCell(trimmed)
-		if err != nil {
-			return 0, trimmed, err
+func (r *Reader) streamGroup(ctx context.Context, group parquet.RowGroup, first int64, leaves []leafColumn, out chan<- *Row) error {
+	groupRows := group.Rows()
+	defer groupRows.Close()
+
+	batch := make([]parquet.Row, r.opts.BatchSize)
+	rowNumber := first
+	for {
+		if ctx.Err() != nil {
+			return nil
 		}
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case []byte:
-		trimmed := strings.TrimSpace(string(v))
-		if trimmed == "" {
-			return 0, "", nil
+		n, err := groupRows.ReadRows(batch)
+		for i := 0; i < n; i++ {
+			select {
+			case out <- r.decodeRow(batch[i], leaves, rowNumber):
+			case <-ctx.Done():
+				return nil
+			}
+			rowNumber++
 		}
-		cell, err := stringToCell(trimmed)
-		if err != nil {
-			return 0, trimmed, err
+		if err == io.EOF || (err == nil && n == 0) {
+			return nil
 		}
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case fmt.Stringer:
-		trimmed := strings.TrimSpace(v.String())
-		if trimmed == "" {
-			return 0, "", nil
+		if ctx.Err() != nil {
+			return nil
 		}
-		cell, err := stringToCell(trimmed)
 		if err != nil {
-			return 0, trimmed, err
-		}
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case int:
-		if v < 0 {
-			return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+			return fmt.Errorf("read parquet rows: %w", err)
 		}
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case int32:
-		if v < 0 {
-			return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+	}
+}
+
+func (r *Reader) openFile() (*parquet.File, error) {
+	return r.openFileContext(context.Background())
+}
+
+// openFileContext opens the file for random access; reads fail with ctx.Err() once ctx is done,
+// so a decode blocked on slow storage stops at its next page read. Remote objects abandon the
+// request in flight.
+func (r *Reader) openFileContext(ctx context.Context) (*parquet.File, error) {
+	r.mu.Lock()
+	object := r.object
+	r.mu.Unlock()
+	if object == nil {
+		return nil, fmt.Errorf("reader closed")
+	}
+	pf, err := parquet.OpenFile(&contextReaderAt{object: object, ctx: ctx}, object.Size())
+	if err != nil {
+		return nil, fmt.Errorf("open parquet file: %w", err)
+	}
+	return pf, nil
+}
+
+// project narrows r.schema to the top-level fields named in opts.Columns and the cell columns.
+func (r *Reader) project(full *parquet.Schema) error {
+	if r.opts.Columns == nil {
+		return nil
+	}
+	wanted := make(map[string]bool, len(r.opts.Columns))
+	for _, name := range r.opts.Columns {
+		top, _, _ := strings.Cut(name, ".")
+		wanted[top] = true
+	}
+	group := make(parquet.Group)
+	for _, field := range full.Fields() {
+		if wanted[field.Name()] || grid.IsCellColumn(r.opts.Grid, field.Name()) {
+			group[field.Name()] = field
 		}
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case int64:
-		if v < 0 {
-			return 0, fmt.Sprint(v), fmt.Errorf("negative integer %d", v)
+	}
+	if len(group) == len(full.Fields()) {
+		return nil
+	}
+	schema := parquet.NewSchema(full.Name(), group)
+	conv, err := parquet.Convert(schema, full)
+	if err != nil {
+		return fmt.Errorf("project parquet columns: %w", err)
+	}
+	r.schema, r.conv = schema, conv
+	return nil
+}
+
+// rowGroups returns the row groups of pf, projected onto r.schema.
+func (r *Reader) rowGroups(pf *parquet.File) []parquet.RowGroup {
+	groups := pf.RowGroups()
+	if r.conv == nil {
+		return groups
+	}
+	projected := make([]parquet.RowGroup, len(groups))
+	for i, group := range groups {
+		projected[i] = parquet.ConvertRowGroup(group, r.conv)
+	}
+	return projected
+}
+
+// TotalRows returns the number of rows reported by the Parquet footer.
+func (r *Reader) TotalRows() int64 {
+	return r.totalRows
+}
+
+// KeyValueMetadata returns the key-value metadata of the file footer, such as the "geo" entry
+// of GeoParquet writers, or nil when the file has none.
+func (r *Reader) KeyValueMetadata() map[string]string {
+	return r.keyValues
+}
+
+// PropertyTypes returns the property kind (string, int, float or bool) declared by the
+// Parquet schema for every property that does not hold cell identifiers. Lists and nested
+// fields are strings, the JSON text they are read as.
+func (r *Reader) PropertyTypes() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reader == nil {
+		return nil
+	}
+
+	types := make(map[string]string)
+	for _, leaf := range r.leafColumns() {
+		if r.isCellColumn(leaf.key) {
+			continue
 		}
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case uint:
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case uint32:
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case uint64:
-		cell := h3.Cell(v)
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case float32:
-		if v < 0 {
-			return 0, fmt.Sprint(v), fmt.Errorf("negative float %f", v)
+		if kind := leaf.propertyKind(); kind != "" {
+			types[leaf.key] = kind
 		}
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
-	case float64:
-		if v < 0 {
-			return 0, fmt.Sprint(v), fmt.Errorf("negative float %f", v)
+	}
+	for key, kind := range r.partitionTypes {
+		if _, exists := types[key]; !exists {
+			types[key] = kind
 		}
-		cell := h3.Cell(uint64(v))
-		return cell, h3.IndexToString(uint64(cell)), nil
+	}
+	return types
+}
+
+func kindName(kind parquet.Kind) string {
+	switch kind {
+	case parquet.Boolean:
+		return "bool"
+	case parquet.Int32, parquet.Int64:
+		return "int"
+	case parquet.Float, parquet.Double:
+		return "float"
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return "string"
 	default:
-		s := strings.TrimSpace(fmt.Sprint(v))
-		if s == "" {
-			return 0, "", nil
-		}
-		cell, err := stringToCell(s)
-		if err != nil {
-			return 0, s, err
-		}
-		return cell, h3.IndexToString(uint64(cell)), nil
+		return ""
 	}
 }
 
-func stringToCell(s string) (h3.Cell, error) {
-	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
-		s = s[2:]
+// valueToGo converts a Parquet value into the plain Go value used for feature properties:
+// integers widen to int64 and floats to float64, the types the NDJSON reader produces.
+func valueToGo(v parquet.Value) any {
+	if v.IsNull() {
+		return nil
 	}
-	value, err := strconv.ParseUint(s, 16, 64)
-	if err != nil {
-		// User may have passed a decimal value; fall back once.
-		value, err = strconv.ParseUint(s, 10, 64)
-		if err != nil {
-			return 0, fmt.Errorf("parse H3 string %q: %w", s, err)
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return int64(v.Int32())
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return float64(v.Float())
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	default:
+		return v.String()
+	}
+}
+
+func (r *Reader) extractCell(row map[string]any) (grid.Cell, string, error) {
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	found := false
+	for _, key := range keys {
+		if r.isCellColumn(key) {
+			found = true
+			idx, cellString, err := r.opts.Grid.Parse(row[key])
+			if err != nil {
+				return 0, cellString, fmt.Errorf("column %s: %w", key, err)
+			}
+			if idx != 0 {
+				if cellString == "" {
+					cellString = r.opts.Grid.Token(idx)
+				}
+				if !r.opts.Grid.Valid(idx) {
+					return 0, cellString, fmt.Errorf("column %s: invalid %s cell", key, strings.ToUpper(r.opts.Grid.Name()))
+				}
+				return idx, cellString, nil
+			}
 		}
 	}
-	return h3.Cell(value), nil
+
+	if found {
+		return 0, "", ErrNullCell
+	}
+	return 0, "", ErrNoH3Column
 }
 
-func extractProperties(row map[string]any) map[string]any {
+func (r *Reader) extractProperties(row map[string]any) map[string]any {
 	props := make(map[string]any, len(row))
 	keys := make([]string, 0, len(row))
 	for key := range row {
@@ -365,11 +571,17 @@ func extractProperties(row map[string]any) map[string]any {
 	sort.Strings(keys)
 
 	for _, key := range keys {
-		if isH3Column(key) {
+		if r.isCellColumn(key) {
 			continue
 		}
 		props[key] = normalizeValue(row[key])
 	}
+	// A column stored in the file wins over a partition value of the same name.
+	for key, value := range r.partition {
+		if _, exists := props[key]; !exists {
+			props[key] = value
+		}
+	}
 
 	return props
 }
@@ -382,3 +594,17 @@ func normalizeValue(v any) any {
 		return val
 	}
 }
+
+// contextReaderAt fails reads once ctx is done. parquet-go reads pages through the ReaderAt, so
+// this bounds how long a cancelled decode keeps running to a single page read.
+type contextReaderAt struct {
+	object objstore.Object
+	ctx    context.Context
+}
+
+// Size lets parquet-go find the footer without seeking.
+func (c *contextReaderAt) Size() int64 { return c.object.Size() }
+
+func (c *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return c.object.ReadAtContext(c.ctx, p, off)
+}
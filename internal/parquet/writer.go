@@ -0,0 +1,201 @@
+package parquet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// writerBatchSize is how many rows the Writer buffers before handing them to parquet-go.
+const writerBatchSize = 4096
+
+// Column declares a property column written next to the h3 column. Kind is one of the names
+// reported by Reader.PropertyTypes: string, int, float or bool.
+type Column struct {
+	Name string
+	Kind string
+}
+
+// Writer writes H3 rows with a fixed schema: a required "h3" string column followed by
+// optional, typed property columns. Files it writes read back through Reader unchanged.
+type Writer struct {
+	file    *os.File
+	writer  *parquet.Writer
+	indexes map[string]int // column name -> leaf column index
+	kinds   map[string]string
+	cell    int
+	width   int
+	batch   []parquet.Row
+	rows    int64
+}
+
+// NewWriter creates path (and its directory) and prepares it for rows with the given properties.
+func NewWriter(path string, columns []Column) (*Writer, error) {
+	group := parquet.Group{"h3": parquet.String()}
+	kinds := make(map[string]string, len(columns))
+	for _, col := range columns {
+		if _, dup := group[col.Name]; dup {
+			return nil, fmt.Errorf("duplicate parquet column %q", col.Name)
+		}
+		node, err := columnNode(col.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", col.Name, err)
+		}
+		group[col.Name] = parquet.Optional(node)
+		kinds[col.Name] = col.Kind
+	}
+	schema := parquet.NewSchema("h3", group)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create output directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create parquet file: %w", err)
+	}
+
+	// Group fields are laid out in name order; remember where each one landed.
+	indexes := make(map[string]int, len(group))
+	for i, leaf := range schema.Columns() {
+		indexes[leaf[0]] = i
+	}
+
+	return &Writer{
+		file:    file,
+		writer:  parquet.NewWriter(file, schema),
+		indexes: indexes,
+		kinds:   kinds,
+		cell:    indexes["h3"],
+		width:   len(group),
+		batch:   make([]parquet.Row, 0, writerBatchSize),
+	}, nil
+}
+
+// Write appends one row. Properties missing from props are written as nulls; keys that were not
+// declared as columns are rejected so every output of a command shares one schema.
+func (w *Writer) Write(cell string, props map[string]any) error {
+	row := make(parquet.Row, w.width)
+	for i := range row {
+		row[i] = parquet.NullValue().Level(0, 0, i)
+	}
+	row[w.cell] = parquet.ByteArrayValue([]byte(cell)).Level(0, 0, w.cell)
+
+	for name, value := range props {
+		i, ok := w.indexes[name]
+		if !ok || i == w.cell {
+			return fmt.Errorf("property %q is not a declared parquet column", name)
+		}
+		if value == nil {
+			continue
+		}
+		v, err := convertValue(w.kinds[name], value)
+		if err != nil {
+			return fmt.Errorf("property %q: %w", name, err)
+		}
+		row[i] = v.Level(0, 1, i)
+	}
+
+	w.batch = append(w.batch, row)
+	if len(w.batch) == cap(w.batch) {
+		return w.flush()
+	}
+	return nil
+}
+
+// Rows returns the number of rows written so far.
+func (w *Writer) Rows() int64 {
+	return w.rows + int64(len(w.batch))
+}
+
+// Close flushes buffered rows and finalises the file footer.
+func (w *Writer) Close() error {
+	if w.writer == nil {
+		return nil
+	}
+	defer w.file.Close()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("close parquet writer: %w", err)
+	}
+	w.writer = nil
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close parquet file: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	if _, err := w.writer.WriteRows(w.batch); err != nil {
+		return fmt.Errorf("write parquet rows: %w", err)
+	}
+	w.rows += int64(len(w.batch))
+	w.batch = w.batch[:0]
+	return nil
+}
+
+func columnNode(kind string) (parquet.Node, error) {
+	switch kind {
+	case "string":
+		return parquet.String(), nil
+	case "int":
+		return parquet.Int(64), nil
+	case "float":
+		return parquet.Leaf(parquet.DoubleType), nil
+	case "bool":
+		return parquet.Leaf(parquet.BooleanType), nil
+	default:
+		return nil, fmt.Errorf("unsupported column kind %q (expected string, int, float or bool)", kind)
+	}
+}
+
+// convertValue coerces a property value to the column kind. Integers widen to float columns;
+// other mismatches are errors rather than silent conversions.
+func convertValue(kind string, value any) (parquet.Value, error) {
+	switch kind {
+	case "string":
+		if s, ok := value.(string); ok {
+			return parquet.ByteArrayValue([]byte(s)), nil
+		}
+	case "int":
+		if i, ok := toInt64(value); ok {
+			return parquet.Int64Value(i), nil
+		}
+	case "float":
+		switch v := value.(type) {
+		case float64:
+			return parquet.DoubleValue(v), nil
+		case float32:
+			return parquet.DoubleValue(float64(v)), nil
+		}
+		if i, ok := toInt64(value); ok {
+			return parquet.DoubleValue(float64(i)), nil
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return parquet.BooleanValue(b), nil
+		}
+	}
+	return parquet.Value{}, fmt.Errorf("cannot write %T to a %s column", value, kind)
+}
+
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
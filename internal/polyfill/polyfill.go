@@ -0,0 +1,265 @@
+// Package polyfill covers polygon features with H3 cells and writes them as H3 Parquet that
+// the build command reads directly.
+package polyfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+
+	h3 "github.com/hexatiles/hexatiles/internal/h3lib"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+// Options configures a polyfill run.
+type Options struct {
+	InputPath   string
+	InputFormat string
+	OutputPath  string
+	Resolution  int
+	// Properties lists the attributes copied to every cell of a feature. Nil copies every
+	// attribute.
+	Properties []string
+	// Geometry names the WKB geometry column of GeoParquet input. Empty picks the first column
+	// called geometry, geom, wkb_geometry or the_geom.
+	Geometry string
+	// Containment decides which cells cover a polygon: ContainCenter, ContainFull or
+	// ContainOverlap. Empty means ContainCenter.
+	Containment string
+	// MaxCells stops the run before a feature would be covered by more cells than this,
+	// estimated from its area. Zero means DefaultMaxCells.
+	MaxCells int64
+}
+
+// Result summarises a polyfill run.
+type Result struct {
+	Features int64
+	// Covered counts features that produced at least one cell.
+	Covered int64
+	// Empty counts polygons too small to hold a cell under the containment mode.
+	Empty int64
+	// Skipped counts features without a polygon geometry.
+	Skipped int64
+	// Duplicates counts cells already written for an earlier feature; the first feature wins.
+	Duplicates int64
+	Written    int64
+	Geometry   string
+	// Columns lists the property columns written next to h3.
+	Columns  []string
+	Duration time.Duration
+}
+
+// Input formats read by polyfill.
+const (
+	FormatGeoJSON    = "geojson"
+	FormatGeoParquet = "geoparquet"
+)
+
+// Containment modes.
+const (
+	ContainCenter  = "center"
+	ContainFull    = "full"
+	ContainOverlap = "overlap"
+)
+
+// DefaultMaxCells bounds the cells of a single feature unless Options.MaxCells is set.
+const DefaultMaxCells = 50_000_000
+
+var geometryNames = []string{"geometry", "geom", "wkb_geometry", "the_geom"}
+
+// Run reads opts.InputPath and writes opts.OutputPath with one row per covering cell.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	start := time.Now()
+	if opts.Resolution < 0 || opts.Resolution > 15 {
+		return nil, fmt.Errorf("resolution must be between 0 and 15, got %d", opts.Resolution)
+	}
+	mode, err := containmentMode(opts.Containment)
+	if err != nil {
+		return nil, err
+	}
+	maxCells := opts.MaxCells
+	if maxCells <= 0 {
+		maxCells = DefaultMaxCells
+	}
+	cellArea, err := h3.HexagonAreaAvgM2(opts.Resolution)
+	if err != nil {
+		return nil, fmt.Errorf("cell area at r%d: %w", opts.Resolution, err)
+	}
+
+	src, err := openSource(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	res := &Result{Geometry: src.GeometryName()}
+	types := src.PropertyTypes()
+	var columns []parquetreader.Column
+	if opts.Properties == nil {
+		for _, name := range sortedKeys(types) {
+			columns = append(columns, parquetreader.Column{Name: name, Kind: types[name]})
+		}
+	} else {
+		for _, name := range opts.Properties {
+			kind, ok := types[name]
+			if !ok {
+				return nil, fmt.Errorf("property %q not found in input", name)
+			}
+			columns = append(columns, parquetreader.Column{Name: name, Kind: kind})
+		}
+	}
+	for _, col := range columns {
+		if strings.EqualFold(col.Name, "h3") {
+			return nil, fmt.Errorf("property %q would clash with the h3 column; leave it out with --props", col.Name)
+		}
+		res.Columns = append(res.Columns, col.Name)
+	}
+
+	writer, err := parquetreader.NewWriter(opts.OutputPath, columns)
+	if err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+
+	written := make(map[h3.Cell]struct{})
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		geometry, properties, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Features++
+
+		polygons := polygonsOf(geometry)
+		if len(polygons) == 0 {
+			res.Skipped++
+			continue
+		}
+		var area float64
+		for _, polygon := range polygons {
+			area += geo.Area(polygon)
+		}
+		if estimate := area / cellArea; estimate > float64(maxCells) {
+			return nil, fmt.Errorf("feature %d would need about %.0f cells at r%d, more than %d; use a coarser resolution or raise --max-cells", res.Features, estimate, opts.Resolution, maxCells)
+		}
+
+		out := make(map[string]any, len(columns))
+		for _, col := range columns {
+			out[col.Name] = properties[col.Name]
+		}
+		covered := false
+		for _, polygon := range polygons {
+			cells, err := h3.PolygonToCellsExperimental(geoPolygon(polygon), opts.Resolution, mode)
+			if err != nil {
+				return nil, fmt.Errorf("feature %d: polyfill: %w", res.Features, err)
+			}
+			// Cells are written in index order so the output does not depend on how H3 traces
+			// the polygon.
+			sort.Slice(cells, func(i, j int) bool { return cells[i] < cells[j] })
+			for _, cell := range cells {
+				covered = true
+				if _, dup := written[cell]; dup {
+					res.Duplicates++
+					continue
+				}
+				written[cell] = struct{}{}
+				if err := writer.Write(h3.IndexToString(uint64(cell)), out); err != nil {
+					return nil, fmt.Errorf("feature %d: %w", res.Features, err)
+				}
+			}
+		}
+		if covered {
+			res.Covered++
+		} else {
+			res.Empty++
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	res.Written = writer.Rows()
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+func containmentMode(name string) (h3.ContainmentMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", ContainCenter:
+		return h3.ContainmentCenter, nil
+	case ContainFull:
+		return h3.ContainmentFull, nil
+	case ContainOverlap:
+		return h3.ContainmentOverlapping, nil
+	default:
+		return 0, fmt.Errorf("invalid containment %q (expected %s, %s or %s)", name, ContainCenter, ContainFull, ContainOverlap)
+	}
+}
+
+// polygonsOf returns the polygons of a geometry; other geometry types have none.
+func polygonsOf(g orb.Geometry) []orb.Polygon {
+	switch v := g.(type) {
+	case orb.Polygon:
+		if len(v) == 0 || len(v[0]) == 0 {
+			return nil
+		}
+		return []orb.Polygon{v}
+	case orb.MultiPolygon:
+		var out []orb.Polygon
+		for _, polygon := range v {
+			out = append(out, polygonsOf(polygon)...)
+		}
+		return out
+	case orb.Collection:
+		var out []orb.Polygon
+		for _, member := range v {
+			out = append(out, polygonsOf(member)...)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func geoPolygon(polygon orb.Polygon) h3.GeoPolygon {
+	out := h3.GeoPolygon{GeoLoop: geoLoop(polygon[0])}
+	for _, hole := range polygon[1:] {
+		if len(hole) > 0 {
+			out.Holes = append(out.Holes, geoLoop(hole))
+		}
+	}
+	return out
+}
+
+// geoLoop converts a ring; H3 closes loops itself, so a repeated first point is dropped.
+func geoLoop(ring orb.Ring) h3.GeoLoop {
+	if ring.Closed() && len(ring) > 1 {
+		ring = ring[:len(ring)-1]
+	}
+	loop := make(h3.GeoLoop, len(ring))
+	for i, p := range ring {
+		loop[i] = h3.LatLng{Lat: p[1], Lng: p[0]}
+	}
+	return loop
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,259 @@
+package polyfill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/geojson"
+
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/input"
+	"github.com/hexatiles/hexatiles/internal/objstore"
+	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
+)
+
+// source yields features as a geometry and a property map keyed by attribute name.
+type source interface {
+	// GeometryName describes where geometries come from, for the summary.
+	GeometryName() string
+	PropertyTypes() map[string]string
+	// Next returns a nil geometry for features without one.
+	Next() (orb.Geometry, map[string]any, error)
+	Close() error
+}
+
+func openSource(opts Options) (source, error) {
+	format := strings.ToLower(opts.InputFormat)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(objstore.Base(opts.InputPath))) {
+		case ".geojson", ".json":
+			format = FormatGeoJSON
+		default:
+			format = FormatGeoParquet
+		}
+	}
+	switch format {
+	case FormatGeoJSON:
+		return newGeoJSONSource(opts.InputPath)
+	case FormatGeoParquet, input.FormatParquet:
+		return newGeoParquetSource(opts.InputPath, opts.Geometry)
+	default:
+		return nil, fmt.Errorf("invalid input format %q (expected %s or %s)", opts.InputFormat, FormatGeoJSON, FormatGeoParquet)
+	}
+}
+
+// geoJSONSource reads a FeatureCollection, a single Feature or a bare geometry. The document
+// is decoded whole; attribute kinds are inferred from every feature like NDJSON input.
+type geoJSONSource struct {
+	features []geoJSONFeature
+	kinds    map[string]string
+	next     int
+}
+
+type geoJSONFeature struct {
+	geometry   orb.Geometry
+	properties map[string]any
+}
+
+func newGeoJSONSource(path string) (*geoJSONSource, error) {
+	data, err := readAll(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Type     string            `json:"type"`
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse GeoJSON: %w", err)
+	}
+
+	s := &geoJSONSource{kinds: make(map[string]string)}
+	switch doc.Type {
+	case "FeatureCollection":
+		for i, raw := range doc.Features {
+			f, err := decodeFeature(raw)
+			if err != nil {
+				return nil, fmt.Errorf("parse GeoJSON feature %d: %w", i+1, err)
+			}
+			s.add(f)
+		}
+	case "Feature":
+		f, err := decodeFeature(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse GeoJSON feature: %w", err)
+		}
+		s.add(f)
+	default:
+		g, err := geojson.UnmarshalGeometry(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse GeoJSON: %w", err)
+		}
+		s.add(geoJSONFeature{geometry: g.Geometry()})
+	}
+	for _, f := range s.features {
+		for key, value := range f.properties {
+			if s.kinds[key] == "string" {
+				f.properties[key] = stringValue(value)
+			}
+		}
+	}
+	return s, nil
+}
+
+func decodeFeature(raw json.RawMessage) (geoJSONFeature, error) {
+	var f struct {
+		Geometry   json.RawMessage `json:"geometry"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return geoJSONFeature{}, err
+	}
+	out := geoJSONFeature{properties: make(map[string]any)}
+	if len(f.Geometry) > 0 && !bytes.Equal(f.Geometry, []byte("null")) {
+		g, err := geojson.UnmarshalGeometry(f.Geometry)
+		if err != nil {
+			return geoJSONFeature{}, err
+		}
+		out.geometry = g.Geometry()
+	}
+	if len(f.Properties) > 0 && !bytes.Equal(f.Properties, []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(f.Properties))
+		decoder.UseNumber()
+		var properties map[string]any
+		if err := decoder.Decode(&properties); err != nil {
+			return geoJSONFeature{}, fmt.Errorf("properties: %w", err)
+		}
+		for key, value := range properties {
+			out.properties[key] = input.PlainValue(value)
+		}
+	}
+	return out, nil
+}
+
+func (s *geoJSONSource) add(f geoJSONFeature) {
+	for key, value := range f.properties {
+		s.kinds[key] = input.MergeKind(s.kinds[key], input.ValueKind(value))
+	}
+	s.features = append(s.features, f)
+}
+
+func (s *geoJSONSource) GeometryName() string { return "GeoJSON" }
+
+func (s *geoJSONSource) PropertyTypes() map[string]string {
+	types := make(map[string]string, len(s.kinds))
+	for key, kind := range s.kinds {
+		if kind == "" {
+			// Only nulls; strings are the safest guess.
+			kind = "string"
+		}
+		types[key] = kind
+	}
+	return types
+}
+
+func (s *geoJSONSource) Next() (orb.Geometry, map[string]any, error) {
+	if s.next >= len(s.features) {
+		return nil, nil, io.EOF
+	}
+	f := s.features[s.next]
+	s.features[s.next] = geoJSONFeature{}
+	s.next++
+	return f.geometry, f.properties, nil
+}
+
+func (s *geoJSONSource) Close() error { return nil }
+
+// geoParquetSource reads WKB geometries from a Parquet file or Hive-partitioned directory,
+// such as GeoParquet written by GDAL, DuckDB or GeoPandas.
+type geoParquetSource struct {
+	reader input.Source
+	column string
+	row    int64
+}
+
+func newGeoParquetSource(path, column string) (*geoParquetSource, error) {
+	reader, err := input.Open(path, input.FormatParquet, parquetreader.ReaderOptions{BatchSize: 4096, Grid: grid.Default()})
+	if err != nil {
+		return nil, err
+	}
+	types := reader.PropertyTypes()
+	if column == "" {
+		for _, name := range geometryNames {
+			if types[name] == "string" {
+				column = name
+				break
+			}
+		}
+		if column == "" {
+			reader.Close()
+			return nil, fmt.Errorf("no WKB geometry column found (expected one of %s; name it with --geometry)", strings.Join(geometryNames, ", "))
+		}
+	} else if kind, ok := types[column]; !ok || kind != "string" {
+		reader.Close()
+		return nil, fmt.Errorf("geometry column %q not found in input or not binary", column)
+	}
+	return &geoParquetSource{reader: reader, column: column}, nil
+}
+
+func (s *geoParquetSource) GeometryName() string { return s.column }
+
+func (s *geoParquetSource) PropertyTypes() map[string]string {
+	types := s.reader.PropertyTypes()
+	delete(types, s.column)
+	return types
+}
+
+// Next ignores the reader's missing-cell errors; polygon input has no cell column.
+func (s *geoParquetSource) Next() (orb.Geometry, map[string]any, error) {
+	row, err := s.reader.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.row++
+	raw, _ := row.Properties[s.column].(string)
+	delete(row.Properties, s.column)
+	if raw == "" {
+		return nil, row.Properties, nil
+	}
+	g, err := wkb.Unmarshal([]byte(raw))
+	if err != nil {
+		return nil, nil, fmt.Errorf("row %d: decode %s: %w", s.row, s.column, err)
+	}
+	return g, row.Properties, nil
+}
+
+func (s *geoParquetSource) Close() error { return s.reader.Close() }
+
+func readAll(path string) ([]byte, error) {
+	if path == input.Stdin {
+		return nil, fmt.Errorf("polyfill cannot read standard input; pass a file")
+	}
+	object, err := objstore.Open(context.Background(), path)
+	if err != nil {
+		return nil, fmt.Errorf("open GeoJSON input: %w", err)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(io.NewSectionReader(object, 0, object.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("read GeoJSON input: %w", err)
+	}
+	return data, nil
+}
+
+// stringValue renders a value of a column whose kinds were mixed.
+func stringValue(value any) any {
+	switch v := value.(type) {
+	case nil, string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,182 @@
+// Package progress redraws a one-line summary of a running build on a terminal: the phase,
+// rows read against the input's row count, features emitted and an estimate of the time left.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// redrawInterval spaces the redraws; counters are read, not pushed, so rows cost an atomic
+	// add each.
+	redrawInterval = 200 * time.Millisecond
+	// barWidth is the number of cells of the bar itself.
+	barWidth = 24
+	// etaAfter is how long a phase runs before its rate is trusted for an estimate.
+	etaAfter = time.Second
+)
+
+// Bar draws the progress of a build. It is safe for concurrent use, and a nil Bar ignores
+// every call, so callers need not check whether progress is shown.
+type Bar struct {
+	w        io.Writer
+	rows     atomic.Int64
+	features atomic.Int64
+
+	mu      sync.Mutex
+	phase   string
+	total   int64
+	started time.Time
+	// percent is the share of the phase done as reported by the phase itself, such as
+	// tippecanoe's own progress, or negative when it reports none.
+	percent float64
+	drawn   int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New starts redrawing a bar on w, which should be a terminal: every redraw returns to the
+// start of the line.
+func New(w io.Writer) *Bar {
+	b := &Bar{w: w, started: time.Now(), percent: -1, stop: make(chan struct{}), done: make(chan struct{})}
+	go b.loop()
+	return b
+}
+
+// Phase starts a named phase. total is the row count the phase reads, from the input footer,
+// or zero or negative when unknown; the bar then shows the elapsed time only.
+func (b *Bar) Phase(name string, total int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.phase, b.total, b.started, b.percent = name, total, time.Now(), -1
+	b.rows.Store(0)
+	b.mu.Unlock()
+}
+
+// Row counts a row read in the current phase.
+func (b *Bar) Row() {
+	if b != nil {
+		b.rows.Add(1)
+	}
+}
+
+// Feature counts a feature emitted.
+func (b *Bar) Feature() {
+	if b != nil {
+		b.features.Add(1)
+	}
+}
+
+// Percent records how far the current phase is, from 0 to 100, when the phase measures it
+// itself rather than by rows.
+func (b *Bar) Percent(percent float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.percent = min(max(percent, 0), 100)
+	b.mu.Unlock()
+}
+
+// Close stops redrawing and clears the line, so output that follows starts on a clean line.
+func (b *Bar) Close() {
+	if b == nil {
+		return
+	}
+	select {
+	case <-b.stop:
+		return
+	default:
+	}
+	close(b.stop)
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.drawn > 0 {
+		fmt.Fprintf(b.w, "\r%s\r", strings.Repeat(" ", b.drawn))
+		b.drawn = 0
+	}
+}
+
+func (b *Bar) loop() {
+	defer close(b.done)
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case now := <-ticker.C:
+			b.draw(now)
+		}
+	}
+}
+
+func (b *Bar) draw(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.phase == "" {
+		return
+	}
+	line := b.line(now)
+	// Pad over the tail of a longer previous line.
+	pad := max(b.drawn-len([]rune(line)), 0)
+	fmt.Fprintf(b.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	b.drawn = len([]rune(line))
+}
+
+// line renders the bar, e.g.
+// "features [██████████░░░░░░░░░░░░░░]  42%  1.2M/2.9M rows  1.1M features  ETA 1m12s".
+func (b *Bar) line(now time.Time) string {
+	elapsed := now.Sub(b.started)
+	rows := b.rows.Load()
+	fraction := -1.0
+	switch {
+	case b.percent >= 0:
+		fraction = b.percent / 100
+	case b.total > 0:
+		fraction = min(float64(rows)/float64(b.total), 1)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.phase)
+	if fraction >= 0 {
+		filled := int(fraction * barWidth)
+		fmt.Fprintf(&sb, " [%s%s] %3.0f%%", strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), 100*fraction)
+	}
+	if b.total > 0 {
+		fmt.Fprintf(&sb, "  %s/%s rows", count(rows), count(b.total))
+	} else if rows > 0 {
+		fmt.Fprintf(&sb, "  %s rows", count(rows))
+	}
+	if features := b.features.Load(); features > 0 {
+		fmt.Fprintf(&sb, "  %s features", count(features))
+	}
+	if fraction > 0 && fraction < 1 && elapsed >= etaAfter {
+		left := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+		fmt.Fprintf(&sb, "  ETA %s", left.Round(time.Second))
+	} else {
+		fmt.Fprintf(&sb, "  %s", elapsed.Round(time.Second))
+	}
+	return sb.String()
+}
+
+// count shortens a count to three significant figures, e.g. 1.23M.
+func count(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.3gB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.3gM", float64(n)/1e6)
+	case n >= 1e4:
+		return fmt.Sprintf("%.3gk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,105 @@
+package props
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision gives 2^14 registers per property: about 0.8% standard error in 16 KB.
+const hllPrecision = 14
+
+// Cardinality estimates the number of distinct values of every string property with a
+// HyperLogLog sketch, along with how many bytes those values add to the features.
+type Cardinality struct {
+	props map[string]*stringAccumulator
+}
+
+// StringCardinality summarises one string property.
+type StringCardinality struct {
+	// Distinct is the estimated number of distinct values.
+	Distinct uint64
+	Values   int64
+	Bytes    int64
+}
+
+type stringAccumulator struct {
+	registers []uint8
+	values    int64
+	bytes     int64
+}
+
+// NewCardinality returns an empty accumulator.
+func NewCardinality() *Cardinality {
+	return &Cardinality{props: make(map[string]*stringAccumulator)}
+}
+
+// Observe records every non-empty string value in props.
+func (c *Cardinality) Observe(props map[string]any) {
+	for key, value := range props {
+		s, ok := value.(string)
+		if !ok || s == "" {
+			continue
+		}
+		acc := c.props[key]
+		if acc == nil {
+			acc = &stringAccumulator{registers: make([]uint8, 1<<hllPrecision)}
+			c.props[key] = acc
+		}
+		acc.values++
+		acc.bytes += int64(len(s))
+
+		h := hashString(s)
+		idx := h >> (64 - hllPrecision)
+		rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1)) + 1)
+		if rank > acc.registers[idx] {
+			acc.registers[idx] = rank
+		}
+	}
+}
+
+// Summary returns the estimate for every string property seen.
+func (c *Cardinality) Summary() map[string]StringCardinality {
+	out := make(map[string]StringCardinality, len(c.props))
+	for key, acc := range c.props {
+		out[key] = StringCardinality{
+			Distinct: min(acc.estimate(), uint64(acc.values)),
+			Values:   acc.values,
+			Bytes:    acc.bytes,
+		}
+	}
+	return out
+}
+
+func (a *stringAccumulator) estimate() uint64 {
+	m := float64(len(a.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range a.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate while many registers are still empty.
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(est))
+}
+
+// hashString is FNV-1a followed by the splitmix64 finalizer, which spreads FNV's weak low bits
+// across the whole word as HyperLogLog requires. Fixed hashing keeps estimates reproducible.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
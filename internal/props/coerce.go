@@ -0,0 +1,170 @@
+package props
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Coercion converts the values of one property to a declared kind: int, float, bool or
+// string.
+type Coercion struct {
+	Property string
+	Kind     string
+}
+
+// Coercions applies declared property types, at most one per property.
+type Coercions []Coercion
+
+// CoercionFailure is a value that could not be converted to the declared kind of its property.
+type CoercionFailure struct {
+	Property string
+	Kind     string
+	Value    any
+}
+
+// ParseCoercions parses a spec such as "score:float,flag:bool,zip:string".
+func ParseCoercions(spec string) (Coercions, error) {
+	var out Coercions
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		property, kind, ok := strings.Cut(part, ":")
+		property, kind = strings.TrimSpace(property), strings.ToLower(strings.TrimSpace(kind))
+		if !ok || property == "" {
+			return nil, fmt.Errorf("invalid --types entry %q (expected prop:type)", part)
+		}
+		switch kind {
+		case "int", "float", "bool", "string":
+		default:
+			return nil, fmt.Errorf("invalid --types type %q for %s (expected int, float, bool or string)", kind, property)
+		}
+		if seen[property] {
+			return nil, fmt.Errorf("property %q typed more than once", property)
+		}
+		seen[property] = true
+		out = append(out, Coercion{Property: property, Kind: kind})
+	}
+	return out, nil
+}
+
+// Apply converts the typed properties of props in place. Values that cannot be converted
+// become null and are returned; nulls and empty strings become null without failing.
+func (cs Coercions) Apply(props map[string]any) []CoercionFailure {
+	var failures []CoercionFailure
+	for _, c := range cs {
+		value, ok := props[c.Property]
+		if !ok || value == nil {
+			continue
+		}
+		if s, isString := value.(string); isString && strings.TrimSpace(s) == "" && c.Kind != "string" {
+			props[c.Property] = nil
+			continue
+		}
+		converted, ok := coerce(value, c.Kind)
+		if !ok {
+			failures = append(failures, CoercionFailure{Property: c.Property, Kind: c.Kind, Value: value})
+			converted = nil
+		}
+		props[c.Property] = converted
+	}
+	return failures
+}
+
+// Types returns schema with the declared kinds of the typed properties, including properties
+// the schema does not list, such as the columns of CSV input.
+func (cs Coercions) Types(schema map[string]string) map[string]string {
+	if len(cs) == 0 {
+		return schema
+	}
+	out := make(map[string]string, len(schema)+len(cs))
+	for key, kind := range schema {
+		out[key] = kind
+	}
+	for _, c := range cs {
+		out[c.Property] = c.Kind
+	}
+	return out
+}
+
+// Specs describes the declared types for the report, e.g. "score:float".
+func (cs Coercions) Specs() []string {
+	out := make([]string, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, c.Property+":"+c.Kind)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func coerce(value any, kind string) (any, bool) {
+	switch kind {
+	case "float":
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case float32:
+			return float64(v), true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+		f, ok := Number(value)
+		return f, ok
+	case "int":
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case string:
+			s := strings.TrimSpace(v)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, true
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, false
+			}
+			value = f
+		case bool:
+			return nil, false
+		}
+		f, ok := Number(value)
+		if !ok || f != math.Trunc(f) || math.Abs(f) >= 1<<63 {
+			return nil, false
+		}
+		return int64(f), true
+	case "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "t", "yes", "y", "1":
+				return true, true
+			case "false", "f", "no", "n", "0":
+				return false, true
+			}
+			return nil, false
+		}
+		f, ok := Number(value)
+		if !ok || (f != 0 && f != 1) {
+			return nil, false
+		}
+		return f == 1, true
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case bool:
+			return strconv.FormatBool(v), true
+		case float64, float32, int, int32, int64, uint32, uint64:
+			return valueKey(v), true
+		}
+		return nil, false
+	}
+}
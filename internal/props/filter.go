@@ -8,10 +8,11 @@ import (
 
 // Filter controls which properties are retained on features.
 type Filter struct {
-	includes     map[string]struct{}
-	includeOrder []string
-	dropPatterns []string
-    keepAllByDefault bool
+	includes         map[string]struct{}
+	includeOrder     []string
+	dropPatterns     []string
+	excluded         map[string]struct{}
+	keepAllByDefault bool
 }
 
 // NewFilter constructs a filter from comma-separated include and drop lists.
@@ -79,12 +80,38 @@ func (f *Filter) Apply(props map[string]any) map[string]any {
 	return filtered
 }
 
+// Allows reports whether Apply would retain a property with the given key.
+func (f *Filter) Allows(key string) bool {
+	if len(f.includes) > 0 || f.keepAllByDefault {
+		return f.shouldKeep(key)
+	}
+	return false
+}
+
+// Included reports whether key was named explicitly in the include list.
+func (f *Filter) Included(key string) bool {
+	_, ok := f.includes[key]
+	return ok
+}
+
+// Exclude drops key even when keep-all would retain it. It is used for columns found to be
+// unusable; explicit includes are left to the caller to honour.
+func (f *Filter) Exclude(key string) {
+	if f.excluded == nil {
+		f.excluded = make(map[string]struct{})
+	}
+	f.excluded[key] = struct{}{}
+}
+
 // Keys returns the list of explicitly included keys, preserving CLI order.
 func (f *Filter) Keys() []string {
 	return append([]string(nil), f.includeOrder...)
 }
 
 func (f *Filter) shouldKeep(key string) bool {
+	if _, ok := f.excluded[key]; ok {
+		return false
+	}
 	if len(f.dropPatterns) > 0 {
 		for _, pattern := range f.dropPatterns {
 			if ok, _ := filepath.Match(pattern, key); ok {
@@ -0,0 +1,73 @@
+package props
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// NonFinitePolicy decides what happens to NaN and ±Inf property values, which cannot be
+// represented in JSON.
+type NonFinitePolicy string
+
+const (
+	// NonFiniteDrop removes the property from the feature.
+	NonFiniteDrop NonFinitePolicy = "drop"
+	// NonFiniteNull keeps the property with a null value.
+	NonFiniteNull NonFinitePolicy = "null"
+	// NonFiniteClamp replaces ±Inf with the largest finite value of the same type; NaN becomes null.
+	NonFiniteClamp NonFinitePolicy = "clamp"
+)
+
+// ParseNonFinitePolicy validates a policy name. An empty value selects NonFiniteNull.
+func ParseNonFinitePolicy(value string) (NonFinitePolicy, error) {
+	switch NonFinitePolicy(strings.ToLower(strings.TrimSpace(value))) {
+	case "", NonFiniteNull:
+		return NonFiniteNull, nil
+	case NonFiniteDrop:
+		return NonFiniteDrop, nil
+	case NonFiniteClamp:
+		return NonFiniteClamp, nil
+	default:
+		return "", fmt.Errorf("invalid non-finite policy %q (expected drop, null or clamp)", value)
+	}
+}
+
+// Apply rewrites non-finite values in props according to the policy, mutating props in place.
+// It returns the keys whose values were non-finite.
+func (p NonFinitePolicy) Apply(props map[string]any) []string {
+	var affected []string
+	for key, value := range props {
+		switch v := value.(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				affected = append(affected, key)
+				p.replace(props, key, v, math.MaxFloat64)
+			}
+		case float32:
+			f := float64(v)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				affected = append(affected, key)
+				p.replace(props, key, f, math.MaxFloat32)
+			}
+		}
+	}
+	return affected
+}
+
+func (p NonFinitePolicy) replace(props map[string]any, key string, value, max float64) {
+	switch p {
+	case NonFiniteDrop:
+		delete(props, key)
+	case NonFiniteClamp:
+		if math.IsNaN(value) {
+			props[key] = nil
+		} else if value > 0 {
+			props[key] = max
+		} else {
+			props[key] = -max
+		}
+	default:
+		props[key] = nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -91,97 +92,121 @@ func (q Quantizer) Apply(props map[string]any) Result {
 		return Result{}
 	}
 
-	res := Result{FieldErrors: make(map[string]float64)}
-
+	var res Result
 	for key, value := range props {
 		if value == nil {
 			continue
 		}
+		res.apply(props, key, value, q.lookupStep(key, value))
+	}
+	return res
+}
 
-		step := q.lookupStep(key, value)
-		if step <= 0 {
-			continue
-		}
+// Plan is a Quantizer compiled against a property schema: the step of every column is resolved
+// once, so Apply visits only the columns that are quantized instead of looking up overrides and
+// switching on the type of every value of every row. A Plan is immutable and safe for concurrent
+// use.
+type Plan struct {
+	fields []plannedField
+}
+
+type plannedField struct {
+	key  string
+	step float64
+}
 
-		switch v := value.(type) {
-		case float64:
-			quantized, diff, changed := quantizeFloat64(v, step)
-			if changed {
-				props[key] = quantized
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case float32:
-			quantized, diff, changed := quantizeFloat64(float64(v), step)
-			if changed {
-				props[key] = float32(quantized)
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case int64:
-			quantized, diff, changed := quantizeInt64(v, step)
-			if changed {
-				props[key] = quantized
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case int32:
-			quantized, diff, changed := quantizeInt64(int64(v), step)
-			if changed {
-				props[key] = int32(quantized)
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case int:
-			quantized, diff, changed := quantizeInt64(int64(v), step)
-			if changed {
-				props[key] = int(quantized)
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case uint64:
-			quantized, diff, changed := quantizeInt64(int64(v), step)
-			if changed {
-				props[key] = uint64(quantized)
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case uint32:
-			quantized, diff, changed := quantizeInt64(int64(v), step)
-			if changed {
-				props[key] = uint32(quantized)
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
-		case json.Number:
-			f, err := v.Float64()
-			if err != nil {
-				continue
-			}
-			quantized, diff, changed := quantizeFloat64(f, step)
-			if changed {
-				props[key] = quantized
-				res.TotalAbsError += diff
-				res.FieldErrors[key] += diff
-				res.Changes++
-			}
+// Compile resolves the step of each column in types (kinds as reported by the input reader:
+// string, int, float or bool). Per-field overrides apply whatever the column kind; columns absent
+// from types are only quantized when they have an override.
+func (q Quantizer) Compile(types map[string]string) *Plan {
+	steps := make(map[string]float64, len(types)+len(q.FieldSteps))
+	for key, kind := range types {
+		switch kind {
+		case "float":
+			steps[key] = q.FloatStep
+		case "int":
+			steps[key] = q.IntStep
 		}
 	}
+	for key, step := range q.FieldSteps {
+		steps[key] = step
+	}
 
-	if len(res.FieldErrors) == 0 {
-		res.FieldErrors = nil
+	plan := &Plan{}
+	for key, step := range steps {
+		if step > 0 {
+			plan.fields = append(plan.fields, plannedField{key: key, step: step})
+		}
 	}
+	sort.Slice(plan.fields, func(i, j int) bool { return plan.fields[i].key < plan.fields[j].key })
+	return plan
+}
 
+// Apply rounds the planned columns of props in place.
+func (p *Plan) Apply(props map[string]any) Result {
+	var res Result
+	if len(props) == 0 {
+		return res
+	}
+	for _, f := range p.fields {
+		if value, ok := props[f.key]; ok && value != nil {
+			res.apply(props, f.key, value, f.step)
+		}
+	}
 	return res
 }
 
+// apply quantizes props[key] and records the error. FieldErrors is allocated on first change.
+func (res *Result) apply(props map[string]any, key string, value any, step float64) {
+	if step <= 0 {
+		return
+	}
+	quantized, diff, changed := quantizeValue(value, step)
+	if !changed {
+		return
+	}
+	props[key] = quantized
+	if res.FieldErrors == nil {
+		res.FieldErrors = make(map[string]float64)
+	}
+	res.TotalAbsError += diff
+	res.FieldErrors[key] += diff
+	res.Changes++
+}
+
+// quantizeValue rounds a numeric value to step, keeping its Go type.
+func quantizeValue(value any, step float64) (any, float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return quantizeFloat64(v, step)
+	case float32:
+		q, diff, changed := quantizeFloat64(float64(v), step)
+		return float32(q), diff, changed
+	case int64:
+		return quantizeInt64(v, step)
+	case int32:
+		q, diff, changed := quantizeInt64(int64(v), step)
+		return int32(q), diff, changed
+	case int:
+		q, diff, changed := quantizeInt64(int64(v), step)
+		return int(q), diff, changed
+	case uint64:
+		q, diff, changed := quantizeInt64(int64(v), step)
+		return uint64(q), diff, changed
+	case uint32:
+		q, diff, changed := quantizeInt64(int64(v), step)
+		return uint32(q), diff, changed
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return value, 0, false
+		}
+		return quantizeFloat64(f, step)
+	default:
+		return value, 0, false
+	}
+}
+
 func (q Quantizer) lookupStep(key string, value any) float64 {
 	if q.FieldSteps != nil {
 		if step, ok := q.FieldSteps[key]; ok {
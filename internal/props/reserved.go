@@ -0,0 +1,65 @@
+package props
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReservedKeyPolicy decides what happens to an input property named like a field the build
+// writes itself, such as h3 or resolution, when the two values differ.
+type ReservedKeyPolicy string
+
+const (
+	// ReservedRename keeps the input value under the key with ReservedSuffix appended.
+	ReservedRename ReservedKeyPolicy = "rename"
+	// ReservedDrop discards the input value.
+	ReservedDrop ReservedKeyPolicy = "drop"
+	// ReservedFail stops the build.
+	ReservedFail ReservedKeyPolicy = "fail"
+)
+
+// ReservedSuffix is appended to a conflicting property under ReservedRename.
+const ReservedSuffix = "_src"
+
+// ParseReservedKeyPolicy validates a policy name. An empty value selects ReservedRename.
+func ParseReservedKeyPolicy(value string) (ReservedKeyPolicy, error) {
+	switch ReservedKeyPolicy(strings.ToLower(strings.TrimSpace(value))) {
+	case "", ReservedRename:
+		return ReservedRename, nil
+	case ReservedDrop:
+		return ReservedDrop, nil
+	case ReservedFail:
+		return ReservedFail, nil
+	default:
+		return "", fmt.Errorf("invalid reserved key policy %q (expected rename, drop or fail)", value)
+	}
+}
+
+// Apply resolves props[key] before the system value is written over it, mutating props in
+// place. It reports whether the property held a different value; an equal value carries no
+// information and is left to be overwritten. With ReservedFail a conflict is an error.
+func (p ReservedKeyPolicy) Apply(props map[string]any, key string, system any) (bool, error) {
+	value, ok := props[key]
+	if !ok || value == nil || sameValue(value, system) {
+		return false, nil
+	}
+	switch p {
+	case ReservedFail:
+		return true, fmt.Errorf("property %q is %v, but the build writes %v there", key, value, system)
+	case ReservedDrop:
+	default:
+		props[key+ReservedSuffix] = value
+	}
+	delete(props, key)
+	return true, nil
+}
+
+// sameValue compares numbers by value, whatever their Go type, and anything else by its
+// printed form.
+func sameValue(a, b any) bool {
+	if x, ok := Number(a); ok {
+		y, ok := Number(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,60 @@
+package props
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// StringSanitizer cleans string property values so malformed upstream text cannot produce
+// invalid NDJSON or broken popups. Values are repaired to valid UTF-8, normalised to NFC and
+// stripped of control characters (tabs and line breaks become spaces).
+type StringSanitizer struct {
+	MaxBytes int // Truncate values longer than this many bytes when >0, on a rune boundary.
+}
+
+// Apply sanitises string values in props, mutating props in place, and returns how many were changed.
+func (s StringSanitizer) Apply(props map[string]any) int {
+	changed := 0
+	for key, value := range props {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		clean := s.Clean(str)
+		if clean != str {
+			props[key] = clean
+			changed++
+		}
+	}
+	return changed
+}
+
+// Clean returns the sanitised form of a single string.
+func (s StringSanitizer) Clean(value string) string {
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "�")
+	}
+	value = norm.NFC.String(value)
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		default:
+			return r
+		}
+	}, value)
+
+	if s.MaxBytes > 0 && len(value) > s.MaxBytes {
+		cut := s.MaxBytes
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+	}
+	return value
+}
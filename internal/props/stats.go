@@ -0,0 +1,144 @@
+package props
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// statsSampleSize bounds the values kept per property for percentile estimates.
+const statsSampleSize = 10000
+
+// Percentiles reported by Stats.
+var statsPercentiles = []int{5, 25, 50, 75, 95}
+
+// PropertyStats summarises one numeric property. Min, Max and Mean are exact; percentiles are
+// estimated from a fixed-size reservoir sample.
+type PropertyStats struct {
+	Count       int64              `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Mean        float64            `json:"mean"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// Stats accumulates numeric property statistics. Features must be observed in a stable order
+// for the percentile sample to be reproducible.
+type Stats struct {
+	props map[string]*propertyAccumulator
+}
+
+type propertyAccumulator struct {
+	count    int64
+	min, max float64
+	sum      float64
+	sample   []float64
+	rng      *rand.Rand
+}
+
+// NewStats returns an empty accumulator.
+func NewStats() *Stats {
+	return &Stats{props: make(map[string]*propertyAccumulator)}
+}
+
+// Observe records every finite numeric value in props.
+func (s *Stats) Observe(props map[string]any) {
+	for key, value := range props {
+		f, ok := Number(value)
+		if !ok {
+			continue
+		}
+		acc := s.props[key]
+		if acc == nil {
+			// Each property samples from its own seeded source, so map iteration order is irrelevant.
+			acc = &propertyAccumulator{min: f, max: f, rng: rand.New(rand.NewSource(1))}
+			s.props[key] = acc
+		}
+		acc.count++
+		acc.sum += f
+		acc.min = math.Min(acc.min, f)
+		acc.max = math.Max(acc.max, f)
+		if len(acc.sample) < statsSampleSize {
+			acc.sample = append(acc.sample, f)
+		} else if j := acc.rng.Int63n(acc.count); j < statsSampleSize {
+			acc.sample[j] = f
+		}
+	}
+}
+
+// Summary returns statistics for every property that had at least one numeric value.
+func (s *Stats) Summary() map[string]PropertyStats {
+	out := make(map[string]PropertyStats, len(s.props))
+	for key, acc := range s.props {
+		sorted := append([]float64(nil), acc.sample...)
+		sort.Float64s(sorted)
+		percentiles := make(map[string]float64, len(statsPercentiles))
+		for _, p := range statsPercentiles {
+			percentiles[fmt.Sprintf("p%d", p)] = percentile(sorted, p)
+		}
+		out[key] = PropertyStats{
+			Count:       acc.count,
+			Min:         acc.min,
+			Max:         acc.max,
+			Mean:        acc.sum / float64(acc.count),
+			Percentiles: percentiles,
+		}
+	}
+	return out
+}
+
+// MergePropertyStats combines the statistics of two disjoint sets of features, such as two
+// tilesets built from separate regions. Count, range and mean are exact; percentiles cannot be
+// recombined from the summaries and are left out.
+func MergePropertyStats(a, b PropertyStats) PropertyStats {
+	count := a.Count + b.Count
+	if count == 0 {
+		return PropertyStats{}
+	}
+	return PropertyStats{
+		Count: count,
+		Min:   math.Min(a.Min, b.Min),
+		Max:   math.Max(a.Max, b.Max),
+		Mean:  (a.Mean*float64(a.Count) + b.Mean*float64(b.Count)) / float64(count),
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of sorted.
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := float64(p) / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (rank-float64(lo))*(sorted[hi]-sorted[lo])
+}
+
+// Number converts a decoded numeric property to float64, rejecting nulls, non-numeric values
+// and NaN/Inf.
+func Number(value any) (float64, bool) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint32:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
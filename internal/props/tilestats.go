@@ -0,0 +1,211 @@
+package props
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// Limits of the mapbox-geostats format: distinct values are counted up to tileStatsMaxCount
+// and at most tileStatsMaxValues of them are listed.
+const (
+	tileStatsMaxCount  = 1000
+	tileStatsMaxValues = 100
+)
+
+// TileStats accumulates the statistics of one tile layer in the "tilestats" format Mapbox
+// Studio, Felt and Maputnik read to populate their styling UIs.
+type TileStats struct {
+	count int64
+	attrs map[string]*tileStatsAccumulator
+}
+
+type tileStatsAccumulator struct {
+	types    map[string]bool
+	distinct map[any]struct{}
+	min, max float64
+	numbers  bool
+}
+
+// TileStatsLayer describes one layer of the tilestats metadata.
+type TileStatsLayer struct {
+	Layer          string               `json:"layer"`
+	Count          int64                `json:"count"`
+	Geometry       string               `json:"geometry"`
+	AttributeCount int                  `json:"attributeCount"`
+	Attributes     []TileStatsAttribute `json:"attributes"`
+}
+
+// TileStatsAttribute describes one attribute of a layer. Count is the number of distinct
+// values, capped at 1000; Values lists up to 100 of them in sorted order.
+type TileStatsAttribute struct {
+	Attribute string   `json:"attribute"`
+	Count     int      `json:"count"`
+	Type      string   `json:"type"`
+	Values    []any    `json:"values"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+}
+
+// NewTileStats returns an empty accumulator.
+func NewTileStats() *TileStats {
+	return &TileStats{attrs: make(map[string]*tileStatsAccumulator)}
+}
+
+// Observe records the properties of one feature. Null values and NaN/Inf are skipped.
+func (t *TileStats) Observe(props map[string]any) {
+	t.count++
+	for key, value := range props {
+		var kind string
+		switch value.(type) {
+		case string:
+			kind = "string"
+		case bool:
+			kind = "boolean"
+		case nil:
+			continue
+		default:
+			f, ok := Number(value)
+			if !ok {
+				continue
+			}
+			kind, value = "number", f
+		}
+		acc := t.attrs[key]
+		if acc == nil {
+			acc = &tileStatsAccumulator{types: make(map[string]bool, 1), distinct: make(map[any]struct{})}
+			t.attrs[key] = acc
+		}
+		acc.types[kind] = true
+		if f, ok := value.(float64); ok {
+			if !acc.numbers || f < acc.min {
+				acc.min = f
+			}
+			if !acc.numbers || f > acc.max {
+				acc.max = f
+			}
+			acc.numbers = true
+		}
+		if len(acc.distinct) < tileStatsMaxCount {
+			acc.distinct[value] = struct{}{}
+		}
+	}
+}
+
+// Layer summarises the observed features as the layer name with the given geometry type.
+func (t *TileStats) Layer(name, geometry string) TileStatsLayer {
+	layer := TileStatsLayer{Layer: name, Count: t.count, Geometry: geometry, Attributes: []TileStatsAttribute{}}
+	keys := make([]string, 0, len(t.attrs))
+	for key := range t.attrs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		acc := t.attrs[key]
+		attr := TileStatsAttribute{Attribute: key, Count: len(acc.distinct), Type: "mixed"}
+		if len(acc.types) == 1 {
+			for kind := range acc.types {
+				attr.Type = kind
+			}
+		}
+		values := make([]any, 0, len(acc.distinct))
+		for value := range acc.distinct {
+			values = append(values, value)
+		}
+		slices.SortFunc(values, compareTileStatsValues)
+		attr.Values = values[:min(len(values), tileStatsMaxValues)]
+		if acc.numbers {
+			attr.Min, attr.Max = &acc.min, &acc.max
+		}
+		layer.Attributes = append(layer.Attributes, attr)
+	}
+	layer.AttributeCount = len(layer.Attributes)
+	return layer
+}
+
+// MergeTileStatsLayers combines the summaries of one layer over two disjoint sets of features.
+// Feature counts and ranges are exact. The distinct values of an attribute are only known while
+// both lists are complete, below the 100 listed; past that its count is the larger of the two.
+func MergeTileStatsLayers(a, b TileStatsLayer) TileStatsLayer {
+	merged := TileStatsLayer{Layer: a.Layer, Count: a.Count + b.Count, Geometry: a.Geometry, Attributes: []TileStatsAttribute{}}
+	if merged.Geometry != b.Geometry {
+		merged.Geometry = "Unknown"
+	}
+	attrs := make(map[string]TileStatsAttribute, len(a.Attributes)+len(b.Attributes))
+	for _, attr := range a.Attributes {
+		attrs[attr.Attribute] = attr
+	}
+	for _, attr := range b.Attributes {
+		if prev, ok := attrs[attr.Attribute]; ok {
+			attr = mergeTileStatsAttributes(prev, attr)
+		}
+		attrs[attr.Attribute] = attr
+	}
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		merged.Attributes = append(merged.Attributes, attrs[key])
+	}
+	merged.AttributeCount = len(merged.Attributes)
+	return merged
+}
+
+func mergeTileStatsAttributes(a, b TileStatsAttribute) TileStatsAttribute {
+	merged := TileStatsAttribute{Attribute: a.Attribute, Type: a.Type}
+	if a.Type != b.Type {
+		merged.Type = "mixed"
+	}
+	complete := len(a.Values) == a.Count && len(b.Values) == b.Count
+	values := slices.Concat(a.Values, b.Values)
+	slices.SortFunc(values, compareTileStatsValues)
+	values = slices.CompactFunc(values, func(x, y any) bool { return compareTileStatsValues(x, y) == 0 })
+	if complete {
+		merged.Count = min(len(values), tileStatsMaxCount)
+	} else {
+		merged.Count = max(a.Count, b.Count, len(values))
+	}
+	merged.Values = values[:min(len(values), tileStatsMaxValues)]
+	merged.Min, merged.Max = a.Min, a.Max
+	if b.Min != nil && (merged.Min == nil || *b.Min < *merged.Min) {
+		merged.Min = b.Min
+	}
+	if b.Max != nil && (merged.Max == nil || *b.Max > *merged.Max) {
+		merged.Max = b.Max
+	}
+	return merged
+}
+
+// compareTileStatsValues orders booleans before numbers before strings, each in natural order.
+func compareTileStatsValues(a, b any) int {
+	rank := func(v any) int {
+		switch v.(type) {
+		case bool:
+			return 0
+		case float64:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+	switch a := a.(type) {
+	case bool:
+		return cmp.Compare(boolRank(a), boolRank(b.(bool)))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	default:
+		return cmp.Compare(a.(string), b.(string))
+	}
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// TileStatsMetadata wraps layer summaries into the "tilestats" metadata object.
+func TileStatsMetadata(layers ...TileStatsLayer) map[string]any {
+	return map[string]any{"layerCount": len(layers), "layers": layers}
+}
@@ -0,0 +1,219 @@
+package props
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Value map directions: replace codes with labels (the default) or labels with codes.
+const (
+	ToLabel = "label"
+	ToCode  = "code"
+)
+
+// ValueMap replaces the values of one property using a two-column code,label CSV table.
+// Values without an entry are kept as they are and counted in Misses.
+type ValueMap struct {
+	Property  string
+	Path      string
+	Direction string
+	table     map[string]any
+	kind      string
+	misses    atomic.Int64
+}
+
+// ValueMaps applies a set of value maps, at most one per property.
+type ValueMaps []*ValueMap
+
+// ParseValueMaps loads specs of the form "prop=codes.csv" or "prop:code=codes.csv". The first
+// CSV column holds codes and the second labels; a header row naming the property, "code" or
+// "key" is skipped.
+func ParseValueMaps(specs []string) (ValueMaps, error) {
+	var maps ValueMaps
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		target, path, ok := strings.Cut(spec, "=")
+		target, path = strings.TrimSpace(target), strings.TrimSpace(path)
+		if !ok || target == "" || path == "" {
+			return nil, fmt.Errorf("invalid --value-map %q (expected prop=table.csv or prop:code=table.csv)", spec)
+		}
+		property, direction, _ := strings.Cut(target, ":")
+		switch direction = strings.ToLower(strings.TrimSpace(direction)); direction {
+		case "":
+			direction = ToLabel
+		case ToLabel, ToCode:
+		default:
+			return nil, fmt.Errorf("invalid --value-map direction %q for %s (expected %s or %s)", direction, property, ToLabel, ToCode)
+		}
+		if seen[property] {
+			return nil, fmt.Errorf("property %q value-mapped more than once", property)
+		}
+		seen[property] = true
+
+		m := &ValueMap{Property: property, Path: path, Direction: direction}
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
+
+func (m *ValueMap) load() error {
+	file, err := os.Open(m.Path)
+	if err != nil {
+		return fmt.Errorf("value map for %s: %w", m.Property, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	pairs := make(map[string]string)
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("value map %s: %w", m.Path, err)
+		}
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+		if len(record) < 2 {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("value map %s: line %d: expected code,label", m.Path, line)
+		}
+		code, label := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if first {
+			first = false
+			switch strings.ToLower(code) {
+			case strings.ToLower(m.Property), "code", "key":
+				continue
+			}
+		}
+		from, to := code, label
+		if m.Direction == ToCode {
+			from, to = label, code
+		}
+		if previous, exists := pairs[from]; exists && previous != to {
+			return fmt.Errorf("value map %s: %q maps to both %q and %q", m.Path, from, previous, to)
+		}
+		pairs[from] = to
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("value map %s has no entries", m.Path)
+	}
+
+	// Codes keep a numeric type when every one of them is a number.
+	m.kind = "string"
+	if m.Direction == ToCode {
+		m.kind = numericKind(pairs)
+	}
+	m.table = make(map[string]any, len(pairs))
+	for from, to := range pairs {
+		m.table[from] = typedValue(to, m.kind)
+	}
+	return nil
+}
+
+// Kind is the property kind of mapped values.
+func (m *ValueMap) Kind() string { return m.kind }
+
+// Misses counts the values that had no entry in the table.
+func (m *ValueMap) Misses() int64 { return m.misses.Load() }
+
+// Apply rewrites the mapped properties in place.
+func (ms ValueMaps) Apply(props map[string]any) {
+	for _, m := range ms {
+		value, ok := props[m.Property]
+		if !ok || value == nil {
+			continue
+		}
+		if mapped, ok := m.table[valueKey(value)]; ok {
+			props[m.Property] = mapped
+		} else {
+			m.misses.Add(1)
+		}
+	}
+}
+
+// Types returns schema with the kinds of the mapped properties replaced. Mapping a value
+// that has no entry keeps its original type, so a partial table can leave mixed values.
+func (ms ValueMaps) Types(schema map[string]string) map[string]string {
+	if len(ms) == 0 {
+		return schema
+	}
+	out := make(map[string]string, len(schema))
+	for key, kind := range schema {
+		out[key] = kind
+	}
+	for _, m := range ms {
+		if _, ok := out[m.Property]; ok {
+			out[m.Property] = m.kind
+		}
+	}
+	return out
+}
+
+// Specs describes the loaded maps for the report, e.g. "category → label (codes.csv)".
+func (ms ValueMaps) Specs() []string {
+	out := make([]string, 0, len(ms))
+	for _, m := range ms {
+		out = append(out, fmt.Sprintf("%s → %s (%s, %d entries)", m.Property, m.Direction, m.Path, len(m.table)))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// valueKey renders a property value the way it would be written in the CSV table.
+func valueKey(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func numericKind(pairs map[string]string) string {
+	kind := "int"
+	for _, to := range pairs {
+		if _, err := strconv.ParseInt(to, 10, 64); err == nil {
+			continue
+		}
+		if f, err := strconv.ParseFloat(to, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			kind = "float"
+			continue
+		}
+		return "string"
+	}
+	return kind
+}
+
+func typedValue(raw, kind string) any {
+	switch kind {
+	case "int":
+		v, _ := strconv.ParseInt(raw, 10, 64)
+		return v
+	case "float":
+		v, _ := strconv.ParseFloat(raw, 64)
+		return v
+	default:
+		return raw
+	}
+}
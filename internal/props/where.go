@@ -0,0 +1,462 @@
+package props
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Where is a row predicate such as "score > 0 && category != 'test'". Operands are property
+// names, numbers, 'quoted' or "quoted" strings, true, false and null; `backticks` quote
+// property names that are not plain identifiers. Comparisons are ==, !=, <, <=, > and >=,
+// combined with &&, || and ! and grouped with parentheses. && and || short-circuit, so
+// properties on the skipped side are never looked up.
+//
+// A missing property is null. Null equals only null and never orders against anything;
+// numbers compare numerically whatever their column type, strings lexically, and values of
+// different kinds are simply unequal. A bare operand is true unless it is null, false, zero
+// or the empty string.
+type Where struct {
+	expr       string
+	root       whereNode
+	properties []string
+}
+
+// ParseWhere compiles a --where expression. An empty expression returns nil, which matches
+// every row.
+func ParseWhere(expr string) (*Where, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lexWhere(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --where %q: %w", expr, err)
+	}
+	p := &whereParser{tokens: tokens, seen: make(map[string]bool)}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokEnd {
+		err = fmt.Errorf("unexpected %s at offset %d", p.peek(), p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid --where %q: %w", expr, err)
+	}
+	properties := make([]string, 0, len(p.seen))
+	for name := range p.seen {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	return &Where{expr: strings.TrimSpace(expr), root: root, properties: properties}, nil
+}
+
+// String returns the expression as written.
+func (w *Where) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.expr
+}
+
+// Properties lists the property names the expression reads.
+func (w *Where) Properties() []string {
+	if w == nil {
+		return nil
+	}
+	return w.properties
+}
+
+// Match reports whether a row's properties satisfy the expression. A nil Where matches
+// everything.
+func (w *Where) Match(props map[string]any) bool {
+	if w == nil {
+		return true
+	}
+	return truthy(w.root.eval(props))
+}
+
+type whereNode interface {
+	eval(props map[string]any) any
+}
+
+type (
+	whereLiteral  struct{ value any }
+	whereProperty struct{ name string }
+	whereNot      struct{ operand whereNode }
+	whereAnd      struct{ left, right whereNode }
+	whereOr       struct{ left, right whereNode }
+	whereCompare  struct {
+		op          string
+		left, right whereNode
+	}
+)
+
+func (n whereLiteral) eval(map[string]any) any { return n.value }
+
+func (n whereProperty) eval(props map[string]any) any { return props[n.name] }
+
+func (n whereNot) eval(props map[string]any) any { return !truthy(n.operand.eval(props)) }
+
+func (n whereAnd) eval(props map[string]any) any {
+	return truthy(n.left.eval(props)) && truthy(n.right.eval(props))
+}
+
+func (n whereOr) eval(props map[string]any) any {
+	return truthy(n.left.eval(props)) || truthy(n.right.eval(props))
+}
+
+func (n whereCompare) eval(props map[string]any) any {
+	left, right := n.left.eval(props), n.right.eval(props)
+	if n.op == "==" || n.op == "!=" {
+		return equalValues(left, right) == (n.op == "==")
+	}
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if f, ok := toFloat(value); ok {
+		// NaN is neither zero nor a usable value.
+		return f != 0 && !math.IsNaN(f)
+	}
+	return true
+}
+
+func equalValues(left, right any) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	if cmp, ok := compareValues(left, right); ok {
+		return cmp == 0
+	}
+	if l, ok := left.(bool); ok {
+		r, ok := right.(bool)
+		return ok && l == r
+	}
+	return false
+}
+
+// compareValues orders two numbers or two strings; ok is false for any other pair.
+func compareValues(left, right any) (int, bool) {
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(l, r), true
+	}
+	if c, ok := compareIntegers(left, right); ok {
+		return c, true
+	}
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if !lok || !rok || math.IsNaN(l) || math.IsNaN(r) {
+		return 0, false
+	}
+	switch {
+	case l < r:
+		return -1, true
+	case l > r:
+		return 1, true
+	}
+	return 0, true
+}
+
+// compareIntegers orders two integers exactly, including uint64 values beyond the int64 range,
+// which float64 would round together with their neighbours.
+func compareIntegers(left, right any) (int, bool) {
+	lu, lwide := left.(uint64)
+	lwide = lwide && lu > math.MaxInt64
+	ru, rwide := right.(uint64)
+	rwide = rwide && ru > math.MaxInt64
+	_, lint := toInt(left)
+	_, rint := toInt(right)
+	switch {
+	case lwide && rwide:
+		return cmp.Compare(lu, ru), true
+	case lwide && rint:
+		return 1, true
+	case rwide && lint:
+		return -1, true
+	case lint && rint:
+		li, _ := toInt(left)
+		ri, _ := toInt(right)
+		return cmp.Compare(li, ri), true
+	}
+	return 0, false
+}
+
+func toInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	}
+	if i, ok := toInt(value); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+type tokenKind int
+
+const (
+	tokEnd tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokOpen
+	tokClose
+)
+
+type whereToken struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+func (t whereToken) String() string {
+	if t.kind == tokEnd {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// whereOperators are matched longest first so "<=" is not read as "<".
+var whereOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"}
+
+func lexWhere(expr string) ([]whereToken, error) {
+	var tokens []whereToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			kind := tokOpen
+			if c == ')' {
+				kind = tokClose
+			}
+			tokens = append(tokens, whereToken{kind: kind, text: string(c), pos: i})
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c at offset %d", c, i)
+			}
+			text := expr[i+1 : i+1+end]
+			kind := tokString
+			if c == '`' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, whereToken{kind: kind, text: text, value: text, pos: i})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' || c == '-' && i+1 < len(expr) && (expr[i+1] >= '0' && expr[i+1] <= '9' || expr[i+1] == '.'):
+			j := i + 1
+			for j < len(expr) && (isIdentByte(expr[j]) || expr[j] == '.' || (expr[j] == '+' || expr[j] == '-') && (expr[j-1] == 'e' || expr[j-1] == 'E')) {
+				j++
+			}
+			text := expr[i:j]
+			token := whereToken{kind: tokNumber, text: text, pos: i}
+			if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+				token.value = v
+			} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+				token.value = f
+			} else {
+				return nil, fmt.Errorf("invalid number %q at offset %d", text, i)
+			}
+			tokens = append(tokens, token)
+			i = j
+		case isIdentByte(c):
+			j := i + 1
+			for j < len(expr) && (isIdentByte(expr[j]) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, whereToken{kind: tokIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, op := range whereOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, whereToken{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at offset %d", expr[i:i+1], i)
+			}
+		}
+	}
+	return append(tokens, whereToken{kind: tokEnd, pos: len(expr)}), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || c >= '0' && c <= '9'
+}
+
+// whereParser is a recursive descent parser; precedence from loosest is ||, &&, !, comparison.
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+	seen   map[string]bool
+}
+
+func (p *whereParser) peek() whereToken { return p.tokens[p.pos] }
+
+func (p *whereParser) next() whereToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *whereParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *whereParser) or() (whereNode, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right whereNode
+		if right, err = p.and(); err == nil {
+			left = whereOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) and() (whereNode, error) {
+	left, err := p.not()
+	for err == nil && p.accept("&&") {
+		var right whereNode
+		if right, err = p.not(); err == nil {
+			left = whereAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) not() (whereNode, error) {
+	if p.accept("!") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return whereNot{operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *whereParser) comparison() (whereNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.pos++
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return whereCompare{op: t.text, left: left, right: right}, nil
+}
+
+func (p *whereParser) operand() (whereNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokOpen:
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokClose {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", t.pos)
+		}
+		return inner, nil
+	case tokNumber, tokString:
+		return whereLiteral{t.value}, nil
+	case tokIdent:
+		if t.value == nil {
+			switch t.text {
+			case "true":
+				return whereLiteral{true}, nil
+			case "false":
+				return whereLiteral{false}, nil
+			case "null":
+				return whereLiteral{nil}, nil
+			}
+		}
+		p.seen[t.text] = true
+		return whereProperty{t.text}, nil
+	default:
+		return nil, fmt.Errorf("expected a property or value, got %s at offset %d", t, t.pos)
+	}
+}
@@ -0,0 +1,151 @@
+package props
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhereMatch(t *testing.T) {
+	row := map[string]any{
+		"a":         int64(1),
+		"b":         int64(2),
+		"yes":       true,
+		"no":        false,
+		"score":     float64(2.5),
+		"small":     int32(3),
+		"half":      float32(0.5),
+		"big":       uint64(9007199254740993),
+		"huge":      uint64(1 << 63),
+		"neg":       int64(-1),
+		"milli":     float64(0.001),
+		"thousand":  int64(1000),
+		"nan":       math.NaN(),
+		"name":      "oak",
+		"digits":    "1",
+		"empty":     "",
+		"score (m)": int64(3),
+	}
+	for _, tc := range []struct {
+		expr string
+		want bool
+	}{
+		// ! binds looser than a comparison, && tighter than ||.
+		{"!a == b", true},
+		{"!(a == b)", true},
+		{"(!a) == b", false},
+		{"yes || no && no", true},
+		{"(yes || no) && no", false},
+		{"!!yes", true},
+
+		// A missing property is null: it equals only null and never orders.
+		{"missing == null", true},
+		{"missing != 1", true},
+		{"missing < 1", false},
+		{"missing >= 1", false},
+		{"!(missing < 1)", true},
+		{"missing == missing", true},
+		{"null == 0", false},
+		{"missing", false},
+
+		// Numbers compare by value across column types, integers exactly.
+		{"small == 3.0", true},
+		{"half < 1", true},
+		{"score > 2 && score < 3", true},
+		{"big > 9007199254740992", true},
+		{"big == 9007199254740993", true},
+		{"huge > 9223372036854775807", true},
+		{"huge > big && big < huge", true},
+		{"huge == 9.223372036854775808e18", true},
+		{"a <= 1.0", true},
+		{"nan == nan", false},
+		{"nan < 1 || nan >= 1", false},
+		{"nan", false},
+
+		// Negative and exponent literals.
+		{"neg > -1.5", true},
+		{"neg == -1", true},
+		{"-.5 < neg", false},
+		{"thousand == 1e3", true},
+		{"milli < 2.5E-3 && milli > 1e-4", true},
+
+		// Strings order lexically and never equal numbers.
+		{"name == 'oak'", true},
+		{`name != "elm"`, true},
+		{"name > 'elm'", true},
+		{"digits == 1", false},
+		{"digits < 2", false},
+		{"empty", false},
+		{"name", true},
+
+		// Booleans and bare operands.
+		{"yes == true", true},
+		{"no == false && !no", true},
+		{"yes == 1", false},
+		{"a", true},
+
+		// Backticks quote property names.
+		{"`score (m)` > 2", true},
+		{"`name` == 'oak'", true},
+	} {
+		w, err := ParseWhere(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := w.Match(row); got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestWhereProperties(t *testing.T) {
+	w, err := ParseWhere(" `score (m)` > 2 || name == 'x' && !missing && true != null ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"missing", "name", "score (m)"}; !reflect.DeepEqual(w.Properties(), want) {
+		t.Errorf("properties %q, want %q", w.Properties(), want)
+	}
+	if want := "`score (m)` > 2 || name == 'x' && !missing && true != null"; w.String() != want {
+		t.Errorf("String() = %q, want %q", w.String(), want)
+	}
+
+	w, err = ParseWhere("  ")
+	if err != nil || w != nil {
+		t.Fatalf("empty expression: %v, %v; want nil", w, err)
+	}
+	if !w.Match(nil) || w.Properties() != nil || w.String() != "" {
+		t.Error("a nil Where must match everything and read nothing")
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, want string
+	}{
+		{"score >", "expected a property or value, got end of expression at offset 7"},
+		{"(a == 1", "missing ) for ( at offset 0"},
+		{"a == (b || (c)", "missing ) for ( at offset 5"},
+		{"name == 'oak", "unterminated ' at offset 8"},
+		{"`score > 1", "unterminated ` at offset 0"},
+		{"a == 1 b", `unexpected "b" at offset 7`},
+		{"a = 1", `unexpected "=" at offset 2`},
+		{"a == 1.2.3", `invalid number "1.2.3" at offset 5`},
+		{"a == 1e", `invalid number "1e" at offset 5`},
+		{"a && || b", `expected a property or value, got "||" at offset 5`},
+		{"a == b == c", `unexpected "==" at offset 7`},
+		{"a ~ 1", `unexpected "~" at offset 2`},
+		{"a - 1", `unexpected "-" at offset 2`},
+	} {
+		_, err := ParseWhere(tc.expr)
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tc.expr, tc.want)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "invalid --where ") || !strings.HasSuffix(err.Error(), ": "+tc.want) {
+			t.Errorf("%s: error %q, want %q", tc.expr, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	Register("file", newFilePublisher)
+}
+
+// filePublisher copies artifacts into a local directory, such as a web server's document root
+// or a mounted network share.
+type filePublisher struct {
+	dir string
+}
+
+func newFilePublisher(spec string) (Publisher, error) {
+	dir := spec
+	if rest, ok := strings.CutPrefix(spec, "file://"); ok {
+		u, err := url.Parse(spec)
+		if err != nil || (u.Host != "" && u.Host != "localhost") {
+			return nil, fmt.Errorf("expected file:///path, got %q", "file://"+rest)
+		}
+		dir = filepath.FromSlash(u.Path)
+	}
+	if dir == "" {
+		return nil, errors.New("empty directory")
+	}
+	return filePublisher{dir: dir}, nil
+}
+
+func (filePublisher) Name() string { return "file" }
+
+func (p filePublisher) Validate(ctx context.Context) error {
+	info, err := os.Stat(p.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", p.dir)
+	}
+	return nil
+}
+
+// Publish writes the copy under a temporary name and renames it, so readers never see a
+// partial file.
+func (p filePublisher) Publish(ctx context.Context, artifact Artifact, meta Meta) (string, error) {
+	dest := filepath.Join(p.dir, filepath.FromSlash(artifact.Name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("create %s: %w", filepath.Dir(dest), err)
+	}
+	src, err := os.Open(artifact.Path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", artifact.Path, err)
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("create %s: %w", dest, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("copy %s to %s: %w", artifact.Path, dest, err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("copy %s to %s: %w", artifact.Path, dest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("copy %s to %s: %w", artifact.Path, dest, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", fmt.Errorf("copy %s to %s: %w", artifact.Path, dest, err)
+	}
+	return dest, nil
+}
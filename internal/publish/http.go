@@ -0,0 +1,98 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TokenEnv holds a bearer token sent with HTTP PUT uploads.
+const TokenEnv = "HEXATILES_PUBLISH_TOKEN"
+
+func init() {
+	Register("http", newHTTPPublisher)
+	Register("https", newHTTPPublisher)
+}
+
+// httpPublisher PUTs artifacts under a base URL, for WebDAV shares, artifact repositories and
+// storage gateways. The request carries Authorization: Bearer $HEXATILES_PUBLISH_TOKEN when it
+// is set, and X-Hexatiles-Tileset and X-Hexatiles-Version for servers that catalogue uploads.
+type httpPublisher struct {
+	scheme string
+	base   string
+}
+
+func newHTTPPublisher(spec string) (Publisher, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("expected %s://host/path", u.Scheme)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("a query or fragment cannot be combined with object names")
+	}
+	return httpPublisher{scheme: strings.ToLower(u.Scheme), base: u.String()}, nil
+}
+
+func (p httpPublisher) Name() string { return p.scheme }
+
+func (httpPublisher) Validate(ctx context.Context) error { return nil }
+
+func (p httpPublisher) Publish(ctx context.Context, artifact Artifact, meta Meta) (string, error) {
+	dest := join(p.base, escapeName(artifact.Name))
+	f, err := os.Open(artifact.Path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", artifact.Path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat %s: %w", artifact.Path, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dest, f)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", dest, err)
+	}
+	req.ContentLength = info.Size()
+	if artifact.ContentType != "" {
+		req.Header.Set("Content-Type", artifact.ContentType)
+	}
+	if artifact.CacheControl != "" {
+		req.Header.Set("Cache-Control", artifact.CacheControl)
+	}
+	if token := os.Getenv(TokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if meta.Tileset != "" {
+		req.Header.Set("X-Hexatiles-Tileset", meta.Tileset)
+	}
+	if meta.Version != "" {
+		req.Header.Set("X-Hexatiles-Version", meta.Version)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", dest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("%s: %s %s", dest, resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return dest, nil
+}
+
+// escapeName escapes each segment of a slash-separated object name for a URL path.
+func escapeName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
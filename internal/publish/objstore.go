@@ -0,0 +1,76 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+)
+
+func init() {
+	Register("s3", newBucketPublisher)
+	Register("gs", newBucketPublisher)
+	Register("r2", newBucketPublisher)
+}
+
+// bucketPublisher uploads artifacts to S3, GCS or Cloudflare R2 with objstore.Put, which
+// authenticates from the environment. r2://bucket/prefix is S3 at the endpoint of the account
+// in R2_ACCOUNT_ID or CLOUDFLARE_ACCOUNT_ID, signed with the R2 API token's S3 keys in
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type bucketPublisher struct {
+	scheme string
+	// prefix is the destination as objstore.Put takes it, s3:// for R2.
+	prefix   string
+	endpoint string
+}
+
+func newBucketPublisher(spec string) (Publisher, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("expected %s://bucket/prefix", u.Scheme)
+	}
+	p := bucketPublisher{scheme: strings.ToLower(u.Scheme), prefix: strings.ToLower(u.Scheme) + "://" + u.Host + u.Path}
+	if p.scheme == "r2" {
+		account := os.Getenv("R2_ACCOUNT_ID")
+		if account == "" {
+			account = os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+		}
+		p.prefix = "s3://" + u.Host + u.Path
+		if account != "" {
+			p.endpoint = "https://" + account + ".r2.cloudflarestorage.com"
+		}
+	}
+	return p, nil
+}
+
+func (p bucketPublisher) Name() string { return p.scheme }
+
+func (p bucketPublisher) Validate(ctx context.Context) error {
+	if p.scheme == "r2" && p.endpoint == "" {
+		return errors.New("set R2_ACCOUNT_ID to the Cloudflare account that owns the bucket")
+	}
+	return nil
+}
+
+func (p bucketPublisher) Publish(ctx context.Context, artifact Artifact, meta Meta) (string, error) {
+	dest := join(p.prefix, artifact.Name)
+	err := objstore.Put(ctx, artifact.Path, dest, objstore.PutOptions{
+		ContentType:  artifact.ContentType,
+		CacheControl: artifact.CacheControl,
+		Endpoint:     p.endpoint,
+	})
+	if err != nil {
+		return "", err
+	}
+	if p.scheme == "r2" {
+		return "r2://" + strings.TrimPrefix(dest, "s3://"), nil
+	}
+	return dest, nil
+}
@@ -0,0 +1,89 @@
+// Package publish copies build outputs to their destinations. A destination is a spec: a URL
+// whose scheme selects the Publisher (s3://, r2://, gs://, http(s):// PUT) or a local directory.
+// Other storage systems plug in with Register.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Artifact is a local file to publish.
+type Artifact struct {
+	// Path is the file on local disk.
+	Path string
+	// Name is the object name under the destination, slash-separated; it may hold a version
+	// prefix such as 3f2a9c1b0d4e/metrics.pmtiles.
+	Name         string
+	ContentType  string
+	CacheControl string
+}
+
+// Meta describes the build the artifacts come from, for publishers that catalogue tilesets.
+type Meta struct {
+	// Tileset is the tileset name.
+	Tileset string
+	// Version is the version prefix of Artifact.Name, empty when the upload is unversioned.
+	Version string
+}
+
+// Publisher stores artifacts at one destination.
+type Publisher interface {
+	// Name is the scheme the publisher is registered under.
+	Name() string
+	// Validate checks the destination and credentials that can be checked without writing, so
+	// a bad spec fails before a long build rather than after it.
+	Validate(ctx context.Context) error
+	// Publish stores the artifact and returns where it was stored.
+	Publish(ctx context.Context, artifact Artifact, meta Meta) (string, error)
+}
+
+// Factory returns the Publisher for a spec of its scheme.
+type Factory func(spec string) (Publisher, error)
+
+var registry = map[string]Factory{}
+
+// Register makes a scheme available to Open. It panics on duplicate schemes.
+func Register(scheme string, factory Factory) {
+	key := strings.ToLower(scheme)
+	if _, exists := registry[key]; exists {
+		panic(fmt.Sprintf("publisher %q already registered", key))
+	}
+	registry[key] = factory
+}
+
+// Open returns the Publisher for spec, selected by its URL scheme. A spec without a scheme, or
+// a Windows drive path, is a local directory.
+func Open(spec string) (Publisher, error) {
+	scheme, _, ok := strings.Cut(spec, "://")
+	if !ok || filepath.VolumeName(spec) != "" {
+		scheme = "file"
+	}
+	factory, ok := registry[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unknown publish destination %q (expected a directory or one of: %s)", spec, strings.Join(Names(), ", "))
+	}
+	p, err := factory(spec)
+	if err != nil {
+		return nil, fmt.Errorf("publish destination %q: %w", spec, err)
+	}
+	return p, nil
+}
+
+// Names lists the registered schemes in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name+"://")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// join appends an artifact name to a destination prefix.
+func join(prefix, name string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(name, "/")
+}
@@ -13,22 +13,135 @@ import (
 
 // Config summarises the build configuration used for a run.
 type Config struct {
-	InputPath        string
-	OutputPMTiles    string
-	KeepNDJSON       bool
-	MinZoom          int
-	MaxZoom          int
-	MinZoomDerived   bool
-	MaxZoomDerived   bool
-	MinResolution    int
-	MaxResolution    int
-	ResolutionFilter bool
-	QuantizeSpec     string
-	PropsKeep        []string
-	PropsDrop        []string
-	Threads          int
-	Simplify         bool
-	PropertyByteCap  int
+	OutputPMTiles     string
+	SkipPMTiles       bool
+	DirectPMTiles     bool
+	EmptyTiles        string
+	Tiler             string
+	KeepNDJSON        bool
+	NDJSONFormat      string
+	NDJSONBBox        bool
+	Winding           string
+	QuickPreview      bool
+	KeepMBTiles       bool
+	MinZoom           int
+	MaxZoom           int
+	MinZoomDerived    bool
+	MaxZoomDerived    bool
+	ZoomCap           int
+	CoverageThreshold float64
+	CacheDir          string
+	MinResolution     int
+	MaxResolution     int
+	ResolutionFilter  bool
+	QuantizeSpec      string
+	PropsKeep         []string
+	PropsDrop         []string
+	Threads           int
+	DecodeThreads     int
+	EncodeThreads     int
+	Simplify          bool
+	PropertyByteCap   int
+	Profile           string
+	NonFinitePolicy   string
+	ReservedKeyPolicy string
+	StringMaxBytes    int
+	ExtrudeBy         string
+	ExtrudeScale      float64
+	ValueMaps         []string
+	Types             []string
+	FlattenNested     bool
+	Where             string
+	TopPerParent      string
+	FeatureLimit      int
+	Conserve          []string
+	Aggregate         string
+	Pyramid           string
+	AdaptiveMaxZoom   string
+	Compact           bool
+	DissolveBy        []string
+	// InheritedMetadata lists the tileset metadata fields taken from the input file.
+	InheritedMetadata []string
+	Environment       Environment
+}
+
+// Environment describes the machine a build ran on, so performance reports can be reproduced.
+// Fields that could not be determined are left empty.
+type Environment struct {
+	OS              string
+	Arch            string
+	CPUs            int
+	MemoryAvailable int64
+	GoVersion       string
+	Tippecanoe      string
+	PMTiles         string
+	// Disk is the kind of storage holding the output directory: ssd, hdd or a filesystem
+	// type such as nfs or tmpfs.
+	Disk string
+}
+
+// ZoomConservation describes how one zoom was thinned to the feature limit and whether the
+// conserved totals survived.
+type ZoomConservation struct {
+	Zoom     int
+	Features int
+	Kept     int
+	Totals   []ConservedTotal
+}
+
+// ConservedTotal compares the input total of a conserved property with the tiled total.
+type ConservedTotal struct {
+	Property string
+	Input    float64
+	Tiled    float64
+}
+
+// SourceConfig describes one input and the tile layer it feeds.
+type SourceConfig struct {
+	Layer       string
+	InputPath   string
+	InputFormat string
+	Grid        string
+}
+
+// SourceMetrics holds the row accounting of a single source.
+type SourceMetrics struct {
+	TotalRows             int64
+	EmittedFeatures       int64
+	DroppedInvalid        int64
+	DroppedBadCoordinates int64
+	DroppedNullCell       int64
+	DroppedMissingColumn  int64
+	DroppedResolution     int64
+	DroppedWhere          int64
+	DroppedTopPerParent   int64
+	DroppedPropertyCap    int64
+	DroppedOther          int64
+	MergedRows            int64
+	MinResolutionSeen     int
+	MaxResolutionSeen     int
+	ResolutionHistogram   map[int]int64
+	ResolutionEntries     []HistogramEntry
+	// FooterRows is the row count the input footer declares, zero when the format records none.
+	FooterRows int64
+	// Retries counts the reads of the source that failed and were attempted again.
+	Retries int
+	// Failure is the last error of a source the build left out after every attempt failed.
+	Failure string
+}
+
+// Source ties a source's configuration to its metrics.
+type Source struct {
+	Config  SourceConfig
+	Metrics SourceMetrics
+}
+
+// IncrementHistogram increments the source's resolution histogram.
+func (s *Source) IncrementHistogram(resolution int) {
+	if s.Metrics.ResolutionHistogram == nil {
+		s.Metrics.ResolutionHistogram = make(map[int]int64)
+	}
+	s.Metrics.ResolutionHistogram[resolution]++
 }
 
 // PropertyWarning captures over-sized property payloads.
@@ -40,6 +153,71 @@ type PropertyWarning struct {
 	Message       string
 }
 
+// PyramidLevel describes the parent cells tiled for one --pyramid resolution.
+type PyramidLevel struct {
+	Resolution int
+	MinZoom    int
+	MaxZoom    int
+	Features   int64
+	// Dropped counts parents over the property cap.
+	Dropped int64
+}
+
+// AdaptiveZoom counts the --adaptive-maxzoom regions whose tiles end at one zoom.
+type AdaptiveZoom struct {
+	MaxZoom int
+	Regions int
+	Cells   int64
+}
+
+// Classification records the breaks computed for a --classify property.
+type Classification struct {
+	Property  string
+	Attribute string
+	Method    string
+	Breaks    []float64
+}
+
+// PropertyStats summarises one numeric property of the emitted features.
+type PropertyStats struct {
+	Property    string
+	Count       int64
+	Min         float64
+	Max         float64
+	Mean        float64
+	Percentiles map[string]float64
+}
+
+// StringCardinality describes the distinct values of one string property of the emitted features.
+type StringCardinality struct {
+	Property string
+	Distinct uint64
+	Values   int64
+	Bytes    int64
+}
+
+// Expectation is the outcome of one --expect assertion.
+type Expectation struct {
+	Expr   string
+	Actual float64
+	Passed bool
+}
+
+// ZoomCoverage compares, for one zoom, the tiles holding the centers of the input cells with
+// those the tileset contains.
+type ZoomCoverage struct {
+	Zoom     int
+	Expected int
+	Present  int
+	Ratio    float64
+}
+
+// ExcludedColumn is a property column dropped automatically because it carries no information.
+type ExcludedColumn struct {
+	Property string
+	Reason   string
+}
+
 // HistogramEntry is used to render deterministic resolution histograms.
 type HistogramEntry struct {
 	Resolution int
@@ -48,41 +226,91 @@ type HistogramEntry struct {
 
 // Metrics holds runtime statistics gathered during a build.
 type Metrics struct {
-	StartedAt           time.Time
-	FinishedAt          time.Time
-	Duration            time.Duration
-	NDJSONDuration      time.Duration
-	TilingDuration      time.Duration
-	TotalRows           int64
-	EmittedFeatures     int64
-	DroppedInvalidH3    int64
-	DroppedResolution   int64
-	DroppedPropertyCap  int64
-	DroppedOther        int64
-	PropertyWarnings    []PropertyWarning
-	MinResolutionSeen   int
-	MaxResolutionSeen   int
-	ResolutionHistogram map[int]int64
-	ResolutionEntries   []HistogramEntry
-	QuantizeApplied     bool
-	QuantizeChanges     int64
-	QuantizeTotalError  float64
-	NDJSONPath          string
-	NDJSONSize          int64
-	MBTilesPath         string
-	MBTilesSize         int64
-	PMTilesPath         string
-	PMTilesSize         int64
-	TippecanoeCommand   []string
-	TippecanoeOutput    string
-	PMTilesInfo         map[string]any
-	Warnings            []string
+	StartedAt      time.Time
+	FinishedAt     time.Time
+	Duration       time.Duration
+	NDJSONDuration time.Duration
+	TilingDuration time.Duration
+	// Row totals and ResolutionEntries combine every source and are filled in by WriteHTML.
+	TotalRows             int64
+	EmittedFeatures       int64
+	DroppedInvalid        int64
+	DroppedBadCoordinates int64
+	DroppedNullCell       int64
+	DroppedMissingColumn  int64
+	DroppedResolution     int64
+	DroppedWhere          int64
+	DroppedTopPerParent   int64
+	DroppedPropertyCap    int64
+	DroppedOther          int64
+	MergedRows            int64
+	PropertyWarnings      []PropertyWarning
+	ResolutionEntries     []HistogramEntry
+	QuantizeApplied       bool
+	QuantizeChanges       int64
+	QuantizeTotalError    float64
+	NonFiniteCounts       map[string]int64
+	ReservedKeyConflicts  map[string]int64
+	CoercionFailures      map[string]*CoercionFailures
+	SanitizedStrings      int64
+	ExtrudeMin            float64
+	ExtrudeMax            float64
+	Classifications       []Classification
+	Conservation          []ZoomConservation
+	PyramidLevels         []PyramidLevel
+	PyramidMinZoom        int
+	AdaptiveZooms         []AdaptiveZoom
+	CompactedFeatures     int64
+	DissolvedFeatures     int64
+	TopParents            int
+	TopParentsCapped      int
+	PropertyStats         []PropertyStats
+	StringCardinality     []StringCardinality
+	ExcludedColumns       []ExcludedColumn
+	Expectations          []Expectation
+	NDJSONPath            string
+	NDJSONSize            int64
+	NDJSONBBoxOmitted     int64
+	RingsRewound          int64
+	MBTilesPath           string
+	MBTilesSize           int64
+	PMTilesPath           string
+	PMTilesSize           int64
+	OutputPath            string
+	OutputSize            int64
+	TilesAddressed        uint64
+	ZoomCoverage          []ZoomCoverage
+	TileContents          uint64
+	DedupRatio            float64
+	EmptyTilesElided      uint64
+	EmptyTilesWritten     uint64
+	// CachedStages lists the stages reused from the build cache: features, tiles.
+	CachedStages      []string
+	TippecanoeCommand []string
+	TippecanoeOutput  string
+	PMTilesInfo       map[string]any
+	Warnings          []string
+	// FeaturesFingerprint is the SHA-256 of the NDJSON features, recorded by QuickPreview so
+	// the preview can be matched to the full tileset.
+	FeaturesFingerprint string
+	PreviewPath         string
+	PreviewSize         int64
+	PreviewFeatures     int64
+	PreviewMaxZoom      int
 }
 
 // Report ties together configuration and metrics.
 type Report struct {
 	Config  Config
 	Metrics Metrics
+	Sources []*Source
+}
+
+// AddSource registers an input and returns the Source its metrics are recorded on.
+func (r *Report) AddSource(cfg SourceConfig) *Source {
+	src := &Source{Config: cfg}
+	r.Sources = append(r.Sources, src)
+	return src
 }
 
 // AddWarning appends a human-readable warning to the report.
@@ -95,27 +323,104 @@ func (r *Report) AddPropertyWarning(w PropertyWarning) {
 	r.Metrics.PropertyWarnings = append(r.Metrics.PropertyWarnings, w)
 }
 
-// IncrementHistogram increments the resolution histogram.
-func (r *Report) IncrementHistogram(resolution int) {
-	if r.Metrics.ResolutionHistogram == nil {
-		r.Metrics.ResolutionHistogram = make(map[int]int64)
+// coercionSampleLimit caps the failed values listed per property.
+const coercionSampleLimit = 5
+
+// CoercionFailures counts the values of one property that could not be converted to its
+// declared type, with the first few of them.
+type CoercionFailures struct {
+	Type    string
+	Count   int64
+	Samples []string
+}
+
+// AddCoercionFailure counts a value of the given property that could not be converted to kind.
+func (r *Report) AddCoercionFailure(property, kind string, rowNumber int64, value any) {
+	if r.Metrics.CoercionFailures == nil {
+		r.Metrics.CoercionFailures = make(map[string]*CoercionFailures)
+	}
+	failures := r.Metrics.CoercionFailures[property]
+	if failures == nil {
+		failures = &CoercionFailures{Type: kind}
+		r.Metrics.CoercionFailures[property] = failures
+	}
+	failures.Count++
+	if len(failures.Samples) < coercionSampleLimit {
+		failures.Samples = append(failures.Samples, fmt.Sprintf("row %d: %#v", rowNumber, value))
+	}
+}
+
+// IncrementNonFinite counts a NaN/Inf value encountered for the given property.
+func (r *Report) IncrementNonFinite(key string) {
+	if r.Metrics.NonFiniteCounts == nil {
+		r.Metrics.NonFiniteCounts = make(map[string]int64)
+	}
+	r.Metrics.NonFiniteCounts[key]++
+}
+
+// IncrementReservedConflict counts a row whose property named like a system field held
+// another value.
+func (r *Report) IncrementReservedConflict(key string) {
+	if r.Metrics.ReservedKeyConflicts == nil {
+		r.Metrics.ReservedKeyConflicts = make(map[string]int64)
 	}
-	r.Metrics.ResolutionHistogram[resolution]++
+	r.Metrics.ReservedKeyConflicts[key]++
 }
 
+// Summarize fills the combined row totals from the sources. WriteHTML does this itself; call it
+// to read the totals before the report is written.
+func (r *Report) Summarize() { r.prepare() }
+
 // Prepare final derived metrics (called before rendering).
 func (r *Report) prepare() {
-	if len(r.Metrics.ResolutionHistogram) > 0 {
-		keys := make([]int, 0, len(r.Metrics.ResolutionHistogram))
-		for k := range r.Metrics.ResolutionHistogram {
-			keys = append(keys, k)
-		}
-		sort.Ints(keys)
-		r.Metrics.ResolutionEntries = make([]HistogramEntry, 0, len(keys))
-		for _, k := range keys {
-			r.Metrics.ResolutionEntries = append(r.Metrics.ResolutionEntries, HistogramEntry{Resolution: k, Count: r.Metrics.ResolutionHistogram[k]})
+	m := &r.Metrics
+	m.TotalRows, m.EmittedFeatures = 0, 0
+	m.DroppedInvalid, m.DroppedNullCell, m.DroppedMissingColumn = 0, 0, 0
+	m.DroppedResolution, m.DroppedWhere, m.DroppedTopPerParent = 0, 0, 0
+	m.DroppedPropertyCap, m.DroppedOther, m.MergedRows = 0, 0, 0
+	m.DroppedBadCoordinates = 0
+	combined := make(map[int]int64)
+	for _, src := range r.Sources {
+		sm := &src.Metrics
+		m.TotalRows += sm.TotalRows
+		m.EmittedFeatures += sm.EmittedFeatures
+		m.DroppedInvalid += sm.DroppedInvalid
+		m.DroppedBadCoordinates += sm.DroppedBadCoordinates
+		m.DroppedNullCell += sm.DroppedNullCell
+		m.DroppedMissingColumn += sm.DroppedMissingColumn
+		m.DroppedResolution += sm.DroppedResolution
+		m.DroppedWhere += sm.DroppedWhere
+		m.DroppedTopPerParent += sm.DroppedTopPerParent
+		m.DroppedPropertyCap += sm.DroppedPropertyCap
+		m.DroppedOther += sm.DroppedOther
+		m.MergedRows += sm.MergedRows
+		for res, count := range sm.ResolutionHistogram {
+			combined[res] += count
 		}
+		sm.ResolutionEntries = histogramEntries(sm.ResolutionHistogram)
 	}
+	m.ResolutionEntries = histogramEntries(combined)
+}
+
+// Dropped is the number of rows the source did not emit, merged rows included.
+func (m SourceMetrics) Dropped() int64 {
+	return m.DroppedInvalid + m.DroppedBadCoordinates + m.DroppedNullCell + m.DroppedMissingColumn + m.DroppedResolution + m.DroppedWhere + m.DroppedTopPerParent + m.DroppedPropertyCap + m.DroppedOther + m.MergedRows
+}
+
+func histogramEntries(histogram map[int]int64) []HistogramEntry {
+	if len(histogram) == 0 {
+		return nil
+	}
+	keys := make([]int, 0, len(histogram))
+	for k := range histogram {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	entries := make([]HistogramEntry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, HistogramEntry{Resolution: k, Count: histogram[k]})
+	}
+	return entries
 }
 
 // WriteHTML renders the report as an HTML file at the given path.
@@ -141,6 +446,9 @@ func (r *Report) WriteHTML(path string) error {
 			return string(buf)
 		},
 		"Join": strings.Join,
+		"Percent": func(ratio float64) float64 {
+			return 100 * ratio
+		},
 		"int64": func(i int) int64 {
 			return int64(i)
 		},
@@ -163,6 +471,37 @@ func (r *Report) WriteHTML(path string) error {
 	return nil
 }
 
+// JSONSchemaVersion is the schema_version of report.json; it changes when fields are renamed or
+// removed, not when new ones are added.
+const JSONSchemaVersion = 1
+
+type jsonReport struct {
+	SchemaVersion int       `json:"schema_version"`
+	Config        Config    `json:"config"`
+	Metrics       Metrics   `json:"metrics"`
+	Sources       []*Source `json:"sources"`
+}
+
+// WriteJSON writes the full Config, Metrics and Sources as a JSON document for CI pipelines
+// and dashboards. Field names follow the Go structs and durations are in nanoseconds.
+func (r *Report) WriteJSON(path string) error {
+	r.prepare()
+
+	buf, err := json.MarshalIndent(jsonReport{
+		SchemaVersion: JSONSchemaVersion,
+		Config:        r.Config,
+		Metrics:       r.Metrics,
+		Sources:       r.Sources,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(buf, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
+
 func formatBytes(value int64) string {
 	if value <= 0 {
 		return "0 B"
@@ -198,28 +537,57 @@ th { background: #f0f4f8; }
 code { background: #f1f5f9; padding: 2px 4px; border-radius: 4px; }
 ul { padding-left: 20px; }
 .warning { color: #b43403; }
+.passed { color: #1a7f37; }
+.failed { color: #b42318; font-weight: 600; }
 pre { background: #0f172a; color: #e2e8f0; padding: 16px; border-radius: 6px; overflow-x: auto; font-size: 13px; }
 </style>
 </head>
 <body>
 <header>
   <h1>HexaTiles Build Report</h1>
-  <p>Input: <code>{{ .Config.InputPath }}</code> &middot; Output: <code>{{ .Config.OutputPMTiles }}</code></p>
+  <p>Input: {{ range $i, $s := .Sources }}{{ if $i }}, {{ end }}<code>{{ $s.Config.InputPath }}</code>{{ end }} &middot; Output: <code>{{ if .Metrics.OutputPath }}{{ .Metrics.OutputPath }}{{ else }}{{ .Config.OutputPMTiles }}{{ end }}</code></p>
   <p>Started {{ .Metrics.StartedAt.Format "2006-01-02 15:04:05" }} &middot; Duration {{ FormatDuration .Metrics.Duration }}</p>
 </header>
 
 <section>
   <h2>Configuration</h2>
   <table>
+    <tr><th>Profile</th><td>{{ if .Config.Profile }}{{ .Config.Profile }}{{ else }}none{{ end }}</td></tr>
     <tr><th>Keep NDJSON</th><td>{{ if .Config.KeepNDJSON }}yes{{ else }}no{{ end }}</td></tr>
-    <tr><th>Zooms</th><td>{{ .Config.MinZoom }} &rarr; {{ .Config.MaxZoom }}{{ if .Config.MinZoomDerived }} (min derived){{ end }}{{ if .Config.MaxZoomDerived }} (max derived){{ end }}</td></tr>
+    {{ if .Config.NDJSONFormat }}<tr><th>NDJSON format</th><td>{{ .Config.NDJSONFormat }}</td></tr>{{ end }}
+    <tr><th>NDJSON bounding boxes</th><td>{{ if .Config.NDJSONBBox }}written{{ else }}omitted{{ end }}</td></tr>
+    <tr><th>Polygon winding</th><td>{{ if eq .Config.Winding "cw" }}clockwise exteriors{{ else }}counter-clockwise exteriors (RFC 7946){{ end }}{{ if .Metrics.RingsRewound }} &middot; {{ .Metrics.RingsRewound }} rings rewound{{ end }}</td></tr>
+    {{ if .Config.CacheDir }}<tr><th>Build cache</th><td><code>{{ .Config.CacheDir }}</code> &middot; {{ if .Metrics.CachedStages }}reused {{ Join .Metrics.CachedStages ", " }}{{ else }}nothing reused{{ end }}</td></tr>{{ end }}
+    <tr><th>Zooms</th><td>{{ .Config.MinZoom }} &rarr; {{ .Config.MaxZoom }}{{ if .Config.MinZoomDerived }} (min derived){{ end }}{{ if .Config.MaxZoomDerived }} (max derived){{ end }}{{ if .Config.ZoomCap }} &middot; cap z{{ .Config.ZoomCap }}{{ end }}</td></tr>
     <tr><th>Resolution Filter</th><td>{{ if .Config.ResolutionFilter }}r{{ .Config.MinResolution }} &rarr; r{{ .Config.MaxResolution }}{{ else }}none{{ end }}</td></tr>
     <tr><th>Quantization</th><td>{{ if .Config.QuantizeSpec }}{{ .Config.QuantizeSpec }}{{ else }}disabled{{ end }}</td></tr>
+    <tr><th>Non-finite values</th><td>{{ .Config.NonFinitePolicy }}</td></tr>
+    <tr><th>Reserved keys</th><td>{{ .Config.ReservedKeyPolicy }}</td></tr>
+    <tr><th>String Limit</th><td>{{ if gt .Config.StringMaxBytes 0 }}{{ FormatBytes (int64 .Config.StringMaxBytes) }}{{ else }}not set{{ end }}</td></tr>
     <tr><th>Property Cap</th><td>{{ if gt .Config.PropertyByteCap 0 }}{{ FormatBytes (int64 .Config.PropertyByteCap) }}{{ else }}not set{{ end }}</td></tr>
-    <tr><th>Threads</th><td>{{ .Config.Threads }}</td></tr>
+    <tr><th>Threads</th><td>{{ .Config.Threads }} (decode {{ .Config.DecodeThreads }}, encode {{ .Config.EncodeThreads }})</td></tr>
     <tr><th>Simplify</th><td>{{ if .Config.Simplify }}enabled{{ else }}disabled{{ end }}</td></tr>
     <tr><th>Keep Properties</th><td>{{ if .Config.PropsKeep }}{{ Join .Config.PropsKeep ", " }}{{ else }}all{{ end }}</td></tr>
+    <tr><th>Extrusion</th><td>{{ if .Config.ExtrudeBy }}<code>{{ .Config.ExtrudeBy }}</code> {{ printf "%g" .Metrics.ExtrudeMin }} &rarr; {{ printf "%g" .Metrics.ExtrudeMax }} mapped to <code>height</code> 0 &rarr; {{ printf "%g" .Config.ExtrudeScale }} m{{ else }}disabled{{ end }}</td></tr>
+    <tr><th>Where</th><td>{{ if .Config.Where }}<code>{{ .Config.Where }}</code>{{ else }}none{{ end }}</td></tr>
+    <tr><th>Feature Limit</th><td>{{ if gt .Config.FeatureLimit 0 }}{{ .Config.FeatureLimit }} per tile{{ if .Config.Conserve }}, conserving {{ Join .Config.Conserve ", " }}{{ end }}{{ else }}none{{ end }}</td></tr>
+    <tr><th>Top per Parent</th><td>{{ if .Config.TopPerParent }}<code>{{ .Config.TopPerParent }}</code> &middot; {{ .Metrics.TopParentsCapped }} of {{ .Metrics.TopParents }} parents capped{{ else }}none{{ end }}</td></tr>
+    <tr><th>Aggregate</th><td>{{ if .Config.Aggregate }}<code>{{ .Config.Aggregate }}</code>{{ else }}none{{ end }}</td></tr>
+    <tr><th>Pyramid</th><td>{{ if .Config.Pyramid }}<code>{{ .Config.Pyramid }}</code>{{ else }}none{{ end }}</td></tr>
+    <tr><th>Adaptive Max Zoom</th><td>{{ if .Config.AdaptiveMaxZoom }}<code>{{ .Config.AdaptiveMaxZoom }}</code>{{ else }}none{{ end }}</td></tr>
+    <tr><th>Compact</th><td>{{ if .Config.Compact }}yes{{ else }}no{{ end }}</td></tr>
+    <tr><th>Dissolve by</th><td>{{ if .Config.DissolveBy }}<code>{{ Join .Config.DissolveBy ", " }}</code>{{ else }}none{{ end }}</td></tr>
+    <tr><th>Metadata from input</th><td>{{ if .Config.InheritedMetadata }}{{ Join .Config.InheritedMetadata ", " }}{{ else }}none{{ end }}</td></tr>
+    <tr><th>Value Maps</th><td>{{ if .Config.ValueMaps }}{{ Join .Config.ValueMaps "; " }}{{ else }}none{{ end }}</td></tr>
+    <tr><th>Nested Fields</th><td>{{ if .Config.FlattenNested }}flattened to dotted keys{{ else }}JSON text{{ end }}</td></tr>
+    <tr><th>Property Types</th><td>{{ if .Config.Types }}{{ Join .Config.Types ", " }}{{ else }}as read{{ end }}</td></tr>
     <tr><th>Drop Patterns</th><td>{{ if .Config.PropsDrop }}{{ Join .Config.PropsDrop ", " }}{{ else }}none{{ end }}</td></tr>
+    {{ with .Config.Environment }}
+    <tr><th>Platform</th><td>{{ .OS }}/{{ .Arch }} &middot; {{ .CPUs }} CPUs &middot; {{ if gt .MemoryAvailable 0 }}{{ FormatBytes .MemoryAvailable }} memory available{{ else }}memory unknown{{ end }} &middot; {{ .GoVersion }}</td></tr>
+    <tr><th>Output Disk</th><td>{{ if .Disk }}{{ .Disk }}{{ else }}unknown{{ end }}</td></tr>
+    <tr><th>Tippecanoe</th><td>{{ if .Tippecanoe }}{{ .Tippecanoe }}{{ else }}not used{{ end }}</td></tr>
+    <tr><th>pmtiles CLI</th><td>{{ if .PMTiles }}{{ .PMTiles }}{{ else }}not found{{ end }}</td></tr>
+    {{ end }}
   </table>
 </section>
 
@@ -228,10 +596,125 @@ pre { background: #0f172a; color: #e2e8f0; padding: 16px; border-radius: 6px; ov
   <table>
     <tr><th>Total rows</th><td>{{ .Metrics.TotalRows }}</td></tr>
     <tr><th>Features emitted</th><td>{{ .Metrics.EmittedFeatures }}</td></tr>
-    <tr><th>Dropped (invalid H3)</th><td>{{ .Metrics.DroppedInvalidH3 }}</td></tr>
+    {{ if .Config.Compact }}<tr><th>Features after --compact</th><td>{{ .Metrics.CompactedFeatures }}</td></tr>{{ end }}
+    {{ if .Config.DissolveBy }}<tr><th>Polygons after --dissolve-by</th><td>{{ .Metrics.DissolvedFeatures }}</td></tr>{{ end }}
+    <tr><th>Dropped (invalid)</th><td>{{ .Metrics.DroppedInvalid }}</td></tr>
+    <tr><th>Dropped (out-of-range coordinates)</th><td>{{ .Metrics.DroppedBadCoordinates }}</td></tr>
+    <tr><th>Dropped (null cell)</th><td>{{ .Metrics.DroppedNullCell }}</td></tr>
+    <tr><th>Dropped (missing cell column)</th><td>{{ .Metrics.DroppedMissingColumn }}</td></tr>
     <tr><th>Dropped (resolution filter)</th><td>{{ .Metrics.DroppedResolution }}</td></tr>
+    <tr><th>Dropped (--where)</th><td>{{ .Metrics.DroppedWhere }}</td></tr>
+    <tr><th>Dropped (top per parent)</th><td>{{ .Metrics.DroppedTopPerParent }}</td></tr>
     <tr><th>Dropped (property cap)</th><td>{{ .Metrics.DroppedPropertyCap }}</td></tr>
-    <tr><th>Resolution span</th><td>{{ if gt .Metrics.TotalRows 0 }}r{{ .Metrics.MinResolutionSeen }} → r{{ .Metrics.MaxResolutionSeen }}{{ else }}n/a{{ end }}</td></tr>
+    <tr><th>Dropped (other)</th><td>{{ .Metrics.DroppedOther }}</td></tr>
+    <tr><th>Merged (--aggregate)</th><td>{{ .Metrics.MergedRows }}</td></tr>
+    <tr><th>Sanitized strings</th><td>{{ .Metrics.SanitizedStrings }}</td></tr>
+  </table>
+  {{ if gt (len .Sources) 1 }}
+  <h3>Sources</h3>
+  <table>
+    <tr><th>Layer</th><th>Input</th><th>Rows</th><th>Emitted</th><th>Dropped</th></tr>
+    {{ range .Sources }}
+    <tr><td><code>{{ .Config.Layer }}</code></td><td><code>{{ .Config.InputPath }}</code></td><td>{{ .Metrics.TotalRows }}</td><td>{{ .Metrics.EmittedFeatures }}</td><td>{{ .Metrics.Dropped }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.PropertyStats }}
+  <h3>Property statistics</h3>
+  <table>
+    <tr><th>Property</th><th>Count</th><th>Min</th><th>p5</th><th>p25</th><th>Median</th><th>Mean</th><th>p75</th><th>p95</th><th>Max</th></tr>
+    {{ range .Metrics.PropertyStats }}
+    <tr><td><code>{{ .Property }}</code></td><td>{{ .Count }}</td><td>{{ printf "%.6g" .Min }}</td><td>{{ printf "%.6g" (index .Percentiles "p5") }}</td><td>{{ printf "%.6g" (index .Percentiles "p25") }}</td><td>{{ printf "%.6g" (index .Percentiles "p50") }}</td><td>{{ printf "%.6g" .Mean }}</td><td>{{ printf "%.6g" (index .Percentiles "p75") }}</td><td>{{ printf "%.6g" (index .Percentiles "p95") }}</td><td>{{ printf "%.6g" .Max }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.ExcludedColumns }}
+  <h3>Excluded columns</h3>
+  <p>These columns would have been kept but carry no information, so they were left out. Pass <code>--keep-unusable</code> or name them in <code>--props</code> to keep them.</p>
+  <table>
+    <tr><th>Column</th><th>Reason</th></tr>
+    {{ range .Metrics.ExcludedColumns }}
+    <tr><td><code>{{ .Property }}</code></td><td>{{ .Reason }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.StringCardinality }}
+  <h3>String cardinality</h3>
+  <table>
+    <tr><th>Property</th><th>Distinct (est.)</th><th>Values</th><th>Bytes</th></tr>
+    {{ range .Metrics.StringCardinality }}
+    <tr><td><code>{{ .Property }}</code></td><td>~{{ .Distinct }}</td><td>{{ .Values }}</td><td>{{ FormatBytes .Bytes }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.Classifications }}
+  <h3>Classification</h3>
+  <table>
+    <tr><th>Property</th><th>Attribute</th><th>Method</th><th>Breaks</th></tr>
+    {{ range .Metrics.Classifications }}
+    <tr><td><code>{{ .Property }}</code></td><td><code>{{ .Attribute }}</code></td><td>{{ .Method }}</td><td>{{ range $i, $b := .Breaks }}{{ if $i }}, {{ end }}{{ printf "%g" $b }}{{ end }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.PyramidLevels }}
+  <h3>Pyramid</h3>
+  <table>
+    <tr><th>Resolution</th><th>Zooms</th><th>Features</th><th>Dropped (property cap)</th></tr>
+    {{ range .Metrics.PyramidLevels }}
+    <tr><td>r{{ .Resolution }} parents</td><td>z{{ .MinZoom }}&ndash;z{{ .MaxZoom }}</td><td>{{ .Features }}</td><td>{{ .Dropped }}</td></tr>
+    {{ end }}
+    <tr><td>input cells</td><td>z{{ .Metrics.PyramidMinZoom }}+</td><td>{{ .Metrics.EmittedFeatures }}</td><td>{{ .Metrics.DroppedPropertyCap }}</td></tr>
+  </table>
+  {{ end }}
+  {{ if .Metrics.AdaptiveZooms }}
+  <h3>Adaptive max zoom</h3>
+  <table>
+    <tr><th>Max zoom</th><th>Regions</th><th>Cells</th></tr>
+    {{ range .Metrics.AdaptiveZooms }}
+    <tr><td>z{{ .MaxZoom }}</td><td>{{ .Regions }}</td><td>{{ .Cells }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.Conservation }}
+  <h3>Thinning (at most {{ .Config.FeatureLimit }} features per tile)</h3>
+  <table>
+    <tr><th>Zoom</th><th>Kept</th><th>Conserved totals (input &rarr; tiles)</th></tr>
+    {{ range .Metrics.Conservation }}
+    <tr><td>z{{ .Zoom }}</td><td>{{ .Kept }} of {{ .Features }}</td><td>{{ range $i, $t := .Totals }}{{ if $i }}; {{ end }}<code>{{ $t.Property }}</code> {{ printf "%g" $t.Input }} &rarr; {{ printf "%g" $t.Tiled }}{{ else }}none{{ end }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.ResolutionEntries }}
+  <h3>Resolution histogram{{ if gt (len .Sources) 1 }} (all sources){{ end }}</h3>
+  <table>
+    <tr><th>Resolution</th><th>Rows</th></tr>
+    {{ range .Metrics.ResolutionEntries }}
+    <tr><td>r{{ .Resolution }}</td><td>{{ .Count }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+</section>
+{{ range .Sources }}
+<section>
+  <h2>Source: {{ .Config.Layer }}</h2>
+  <table>
+    <tr><th>Input</th><td><code>{{ .Config.InputPath }}</code></td></tr>
+    <tr><th>Input Format</th><td>{{ if .Config.InputFormat }}{{ .Config.InputFormat }}{{ else }}parquet{{ end }}</td></tr>
+    <tr><th>Grid</th><td>{{ if .Config.Grid }}{{ .Config.Grid }}{{ else }}h3{{ end }}</td></tr>
+    <tr><th>Total rows</th><td>{{ .Metrics.TotalRows }}</td></tr>
+    {{ if .Metrics.FooterRows }}<tr><th>Footer rows</th><td>{{ .Metrics.FooterRows }}{{ if ne .Metrics.FooterRows .Metrics.TotalRows }} &middot; <strong>{{ .Metrics.TotalRows }} read</strong> (--lenient){{ end }}</td></tr>{{ end }}
+    <tr><th>Features emitted</th><td>{{ .Metrics.EmittedFeatures }}</td></tr>
+    <tr><th>Dropped (invalid)</th><td>{{ .Metrics.DroppedInvalid }}</td></tr>
+    <tr><th>Dropped (out-of-range coordinates)</th><td>{{ .Metrics.DroppedBadCoordinates }}</td></tr>
+    <tr><th>Dropped (null cell)</th><td>{{ .Metrics.DroppedNullCell }}</td></tr>
+    <tr><th>Dropped (missing cell column)</th><td>{{ .Metrics.DroppedMissingColumn }}</td></tr>
+    <tr><th>Dropped (resolution filter)</th><td>{{ .Metrics.DroppedResolution }}</td></tr>
+    <tr><th>Dropped (--where)</th><td>{{ .Metrics.DroppedWhere }}</td></tr>
+    <tr><th>Dropped (top per parent)</th><td>{{ .Metrics.DroppedTopPerParent }}</td></tr>
+    <tr><th>Dropped (property cap)</th><td>{{ .Metrics.DroppedPropertyCap }}</td></tr>
+    <tr><th>Dropped (other)</th><td>{{ .Metrics.DroppedOther }}</td></tr>
+    <tr><th>Merged (--aggregate)</th><td>{{ .Metrics.MergedRows }}</td></tr>
+    {{ if .Metrics.ResolutionEntries }}<tr><th>Resolution span</th><td>r{{ .Metrics.MinResolutionSeen }} → r{{ .Metrics.MaxResolutionSeen }}</td></tr>{{ end }}
   </table>
   {{ if .Metrics.ResolutionEntries }}
   <h3>Resolution histogram</h3>
@@ -243,16 +726,45 @@ pre { background: #0f172a; color: #e2e8f0; padding: 16px; border-radius: 6px; ov
   </table>
   {{ end }}
 </section>
+{{ end }}
 
 <section>
   <h2>Artifacts</h2>
   <table>
-    <tr><th>NDJSON</th><td>{{ if .Metrics.NDJSONPath }}<code>{{ .Metrics.NDJSONPath }}</code> ({{ FormatBytes .Metrics.NDJSONSize }}){{ else }}not kept{{ end }}</td></tr>
-    <tr><th>MBTiles</th><td>{{ if .Metrics.MBTilesPath }}<code>{{ .Metrics.MBTilesPath }}</code> ({{ FormatBytes .Metrics.MBTilesSize }}){{ else }}temporary{{ end }}</td></tr>
-    <tr><th>PMTiles</th><td><code>{{ .Metrics.PMTilesPath }}</code> ({{ FormatBytes .Metrics.PMTilesSize }})</td></tr>
+    <tr><th>NDJSON</th><td>{{ if .Metrics.NDJSONPath }}<code>{{ .Metrics.NDJSONPath }}</code> ({{ FormatBytes .Metrics.NDJSONSize }}{{ if .Metrics.NDJSONBBoxOmitted }}, {{ FormatBytes .Metrics.NDJSONBBoxOmitted }} of bounding boxes left out{{ end }}){{ else }}not kept{{ end }}</td></tr>
+    <tr><th>MBTiles</th><td>{{ if .Metrics.MBTilesPath }}<code>{{ .Metrics.MBTilesPath }}</code> ({{ FormatBytes .Metrics.MBTilesSize }}){{ if .Config.SkipPMTiles }} &middot; primary output{{ else if .Config.KeepMBTiles }} &middot; kept{{ end }}{{ else if .Config.DirectPMTiles }}not written (--direct-pmtiles){{ else }}temporary{{ end }}</td></tr>
+    <tr><th>PMTiles</th><td>{{ if .Config.SkipPMTiles }}skipped (--skip-pmtiles){{ else }}<code>{{ .Metrics.PMTilesPath }}</code> ({{ FormatBytes .Metrics.PMTilesSize }}){{ end }}</td></tr>
+    {{ if .Config.QuickPreview }}<tr><th>Preview</th><td>{{ if .Metrics.PreviewPath }}<code>{{ .Metrics.PreviewPath }}</code> ({{ FormatBytes .Metrics.PreviewSize }}) &middot; {{ .Metrics.PreviewFeatures }} sampled features up to z{{ .Metrics.PreviewMaxZoom }} &middot; open with <code>hexatiles preview --pmtiles {{ .Metrics.PreviewPath }}</code>{{ else }}not written{{ end }}</td></tr>{{ end }}
+    {{ if .Metrics.FeaturesFingerprint }}<tr><th>Features SHA-256</th><td><code>{{ .Metrics.FeaturesFingerprint }}</code></td></tr>{{ end }}
+    <tr><th>Empty Tiles</th><td>{{ if eq .Config.EmptyTiles "write" }}{{ .Metrics.EmptyTilesWritten }} written{{ else }}{{ .Metrics.EmptyTilesElided }} elided{{ end }} (--empty-tiles {{ .Config.EmptyTiles }})</td></tr>
+    {{ if .Metrics.TilesAddressed }}
+    <tr><th>Tiles</th><td>{{ .Metrics.TilesAddressed }} addressed, {{ .Metrics.TileContents }} {{ if .Config.SkipPMTiles }}distinct{{ else }}stored{{ end }} &middot; dedup ratio {{ printf "%.2f" .Metrics.DedupRatio }}&times;</td></tr>
+    {{ end }}
+  </table>
+  {{ if .Metrics.ZoomCoverage }}
+  <h3>Zoom coverage</h3>
+  <p>Tiles holding the center of an input cell, and how many of them the tileset contains. Zooms below {{ printf "%.0f" (Percent .Config.CoverageThreshold) }}% are flagged.</p>
+  <table>
+    <tr><th>Zoom</th><th>Expected</th><th>Present</th><th>Coverage</th></tr>
+    {{ range .Metrics.ZoomCoverage }}
+    <tr><td>z{{ .Zoom }}</td><td>{{ .Expected }}</td><td>{{ .Present }}</td><td>{{ if lt .Ratio $.Config.CoverageThreshold }}<span class="failed">{{ printf "%.1f" (Percent .Ratio) }}%</span>{{ else }}{{ printf "%.1f" (Percent .Ratio) }}%{{ end }}</td></tr>
+    {{ end }}
   </table>
+  {{ end }}
 </section>
 
+{{ if .Metrics.Expectations }}
+<section>
+  <h2>Expectations</h2>
+  <table>
+    <tr><th>Expectation</th><th>Actual</th><th>Result</th></tr>
+    {{ range .Metrics.Expectations }}
+    <tr><td><code>{{ .Expr }}</code></td><td>{{ printf "%g" .Actual }}</td><td>{{ if .Passed }}<span class="passed">passed</span>{{ else }}<span class="failed">failed</span>{{ end }}</td></tr>
+    {{ end }}
+  </table>
+</section>
+{{ end }}
+
 {{ if or .Metrics.PropertyWarnings .Metrics.Warnings }}
 <section>
   <h2>Warnings</h2>
@@ -277,10 +789,37 @@ pre { background: #0f172a; color: #e2e8f0; padding: 16px; border-radius: 6px; ov
   <table>
     <tr><th>Applied</th><td>{{ if .Metrics.QuantizeApplied }}yes ({{ .Metrics.QuantizeChanges }} adjustments, total error {{ printf "%.4f" .Metrics.QuantizeTotalError }}){{ else }}no{{ end }}</td></tr>
   </table>
+  {{ if .Metrics.NonFiniteCounts }}
+  <h3>Non-finite values ({{ .Config.NonFinitePolicy }})</h3>
+  <table>
+    <tr><th>Property</th><th>Values</th></tr>
+    {{ range $key, $count := .Metrics.NonFiniteCounts }}
+    <tr><td><code>{{ $key }}</code></td><td>{{ $count }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.ReservedKeyConflicts }}
+  <h3>Properties named like system fields ({{ .Config.ReservedKeyPolicy }})</h3>
+  <table>
+    <tr><th>Field</th><th>Rows with another value</th></tr>
+    {{ range $key, $count := .Metrics.ReservedKeyConflicts }}
+    <tr><td><code>{{ $key }}</code></td><td>{{ $count }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+  {{ if .Metrics.CoercionFailures }}
+  <h3>Type coercion failures (written as null)</h3>
+  <table>
+    <tr><th>Property</th><th>Type</th><th>Values</th><th>Samples</th></tr>
+    {{ range $key, $failures := .Metrics.CoercionFailures }}
+    <tr><td><code>{{ $key }}</code></td><td>{{ $failures.Type }}</td><td>{{ $failures.Count }}</td><td>{{ Join $failures.Samples "; " }}</td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
 </section>
 
 <section>
-  <h2>Tippecanoe</h2>
+  <h2>{{ if eq .Config.Tiler "native" }}Native tiler{{ else }}Tippecanoe{{ end }}</h2>
   <table>
     <tr><th>Command</th><td>{{ if .Metrics.TippecanoeCommand }}<code>{{ Join .Metrics.TippecanoeCommand " " }}</code>{{ else }}n/a{{ end }}</td></tr>
     <tr><th>Duration</th><td>{{ FormatDuration .Metrics.TilingDuration }}</td></tr>
@@ -291,10 +830,40 @@ pre { background: #0f172a; color: #e2e8f0; padding: 16px; border-radius: 6px; ov
 </section>
 
 <section>
-  <h2>PMTiles Metadata</h2>
+  <h2>{{ if .Config.SkipPMTiles }}MBTiles{{ else }}PMTiles{{ end }} Metadata</h2>
   <pre>{{ FormatJSON .Metrics.PMTilesInfo }}</pre>
 </section>
 
+{{ with .Usage }}
+<section>
+  <h2>How to use</h2>
+  {{ if .PMTiles }}
+  <p>Upload the archive to any host that serves HTTP range requests and point MapLibre GL JS at it through the <a href="https://github.com/protomaps/PMTiles">pmtiles</a> protocol. Replace <code>https://example.com/</code> with the archive's location:</p>
+  <pre>{{ .URL }}</pre>
+  <pre>import maplibregl from "maplibre-gl";
+import { Protocol } from "pmtiles";
+
+const protocol = new Protocol();
+maplibregl.addProtocol("pmtiles", protocol.tile);</pre>
+  {{ else }}
+  <p>Serve the MBTiles from a tile server and replace the placeholder tile URL with its XYZ endpoint.</p>
+  {{ end }}
+  <p>Source:</p>
+  <pre>map.addSource("hexatiles", {{ .Source }});</pre>
+  <p>Layers{{ if .ColorBy }}, coloured by <code>{{ .ColorBy }}</code>{{ end }}:</p>
+  <pre>{{ .Layers }}.forEach((layer) =&gt; map.addLayer(layer));</pre>
+  {{ if .Attributes }}
+  <p>Attributes of the <code>h3</code> layer for expressions, filters and popups:</p>
+  <table>
+    <tr><th>Attribute</th><th>Type</th><th>Example</th></tr>
+    {{ range .Attributes }}
+    <tr><td><code>{{ .Name }}</code></td><td>{{ .Type }}</td><td><code>{{ .Example }}</code></td></tr>
+    {{ end }}
+  </table>
+  {{ end }}
+</section>
+{{ end }}
+
 <footer>
   <p>HexaTiles — static H3 tiling pipeline. Generated {{ .Metrics.FinishedAt.Format "2006-01-02 15:04:05" }}.</p>
 </footer>
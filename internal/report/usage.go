@@ -0,0 +1,192 @@
+package report
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// usagePalette colours the example layers, from low to high values.
+var usagePalette = []string{"#440154", "#3b528b", "#21918c", "#5ec962", "#fde725"}
+
+// usageSourceID names the source in the example MapLibre snippets.
+const usageSourceID = "hexatiles"
+
+// Usage holds the copy-pasteable MapLibre snippets of the report's "How to use" section.
+type Usage struct {
+	// URL is the pmtiles:// URL of the archive on a placeholder host, or the XYZ tile URL
+	// template for MBTiles output.
+	URL    string
+	Source string
+	Layers string
+	// ColorBy is the attribute the example fill colour is driven by, empty for a constant colour.
+	ColorBy    string
+	Attributes []UsageAttribute
+	PMTiles    bool
+}
+
+// UsageAttribute describes one attribute of the h3 layer for the "How to use" section.
+type UsageAttribute struct {
+	Name    string
+	Type    string
+	Example string
+}
+
+// Usage builds the MapLibre source and layer definitions for the tileset, with the fill colour
+// driven by a classification, else by the first numeric property.
+func (r *Report) Usage() Usage {
+	u := Usage{PMTiles: !r.Config.SkipPMTiles}
+	source := map[string]any{"type": "vector", "minzoom": r.Config.MinZoom, "maxzoom": r.Config.MaxZoom}
+	if u.PMTiles {
+		u.URL = "pmtiles://https://example.com/" + r.outputName(".pmtiles")
+		source["url"] = u.URL
+	} else {
+		u.URL = "https://example.com/tiles/{z}/{x}/{y}"
+		source["tiles"] = []string{u.URL}
+	}
+	u.Source = usageJSON(source)
+
+	u.Attributes = r.usageAttributes()
+	var color any = usagePalette[2]
+	if len(r.Metrics.Classifications) > 0 {
+		c := r.Metrics.Classifications[0]
+		u.ColorBy = c.Attribute
+		color = classColor(c.Attribute, len(c.Breaks)-1)
+	} else if stats, ok := r.colorStats(); ok {
+		u.ColorBy = stats.Property
+		color = interpolateColor(stats)
+	}
+
+	layers := []map[string]any{}
+	if r.Config.ExtrudeBy != "" {
+		layers = append(layers, map[string]any{
+			"id":           "h3-extrusion",
+			"type":         "fill-extrusion",
+			"source":       usageSourceID,
+			"source-layer": "h3",
+			"paint": map[string]any{
+				"fill-extrusion-color":   color,
+				"fill-extrusion-height":  []any{"get", "height"},
+				"fill-extrusion-opacity": 0.8,
+			},
+		})
+	} else {
+		layers = append(layers, map[string]any{
+			"id":           "h3-fill",
+			"type":         "fill",
+			"source":       usageSourceID,
+			"source-layer": "h3",
+			"paint": map[string]any{
+				"fill-color":         color,
+				"fill-opacity":       0.7,
+				"fill-outline-color": "rgba(255, 255, 255, 0.3)",
+			},
+		})
+	}
+	for _, src := range r.Sources {
+		if src.Config.Layer == "arcs" {
+			layers = append(layers, map[string]any{
+				"id":           "arcs-line",
+				"type":         "line",
+				"source":       usageSourceID,
+				"source-layer": "arcs",
+				"paint":        map[string]any{"line-color": "#e4572e", "line-width": 1.5},
+			})
+		}
+	}
+	u.Layers = usageJSON(layers)
+	return u
+}
+
+// outputName is the file name of the tileset, with a placeholder for a streamed build.
+func (r *Report) outputName(ext string) string {
+	name := filepath.Base(r.Config.OutputPMTiles)
+	if r.Config.OutputPMTiles == "" || r.Config.OutputPMTiles == "-" || name == "." {
+		return "tiles" + ext
+	}
+	return name
+}
+
+// colorStats picks the numeric property the example colour is driven by, skipping the values
+// hexatiles writes itself.
+func (r *Report) colorStats() (PropertyStats, bool) {
+	for _, stats := range r.Metrics.PropertyStats {
+		if stats.Property == "resolution" || stats.Property == "height" || stats.Property == "cells" {
+			continue
+		}
+		if stats.Count > 0 && stats.Max > stats.Min {
+			return stats, true
+		}
+	}
+	return PropertyStats{}, false
+}
+
+func (r *Report) usageAttributes() []UsageAttribute {
+	var attrs []UsageAttribute
+	for _, stats := range r.Metrics.PropertyStats {
+		attrs = append(attrs, UsageAttribute{
+			Name:    stats.Property,
+			Type:    "number",
+			Example: fmt.Sprintf(`["get", %q] → %s to %s`, stats.Property, formatNumber(stats.Min), formatNumber(stats.Max)),
+		})
+	}
+	for _, card := range r.Metrics.StringCardinality {
+		attrs = append(attrs, UsageAttribute{
+			Name:    card.Property,
+			Type:    "string",
+			Example: fmt.Sprintf(`["==", ["get", %q], "…"] (%d distinct)`, card.Property, card.Distinct),
+		})
+	}
+	slices.SortFunc(attrs, func(a, b UsageAttribute) int { return cmp.Compare(a.Name, b.Name) })
+	return attrs
+}
+
+// classColor steps through the palette by class number, spreading it over the classes.
+func classColor(attribute string, classes int) []any {
+	expr := []any{"step", []any{"get", attribute}, paletteColor(0, classes)}
+	for class := 1; class < classes; class++ {
+		expr = append(expr, class, paletteColor(class, classes))
+	}
+	return expr
+}
+
+// interpolateColor ramps the palette between the 5th and 95th percentiles, or the range
+// when the percentiles are missing, so outliers do not wash out the map.
+func interpolateColor(stats PropertyStats) []any {
+	low, high := stats.Min, stats.Max
+	if p, ok := stats.Percentiles["p5"]; ok {
+		low = p
+	}
+	if p, ok := stats.Percentiles["p95"]; ok {
+		high = p
+	}
+	if high <= low {
+		low, high = stats.Min, stats.Max
+	}
+	expr := []any{"interpolate", []any{"linear"}, []any{"get", stats.Property}}
+	for i, color := range usagePalette {
+		expr = append(expr, low+(high-low)*float64(i)/float64(len(usagePalette)-1), color)
+	}
+	return expr
+}
+
+func paletteColor(class, classes int) string {
+	if classes <= 1 {
+		return usagePalette[0]
+	}
+	return usagePalette[class*(len(usagePalette)-1)/(classes-1)]
+}
+
+func formatNumber(v float64) string {
+	return fmt.Sprintf("%.6g", v)
+}
+
+func usageJSON(v any) string {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("(error: %v)", err)
+	}
+	return string(buf)
+}
@@ -0,0 +1,304 @@
+// Package telemetry records anonymous usage events when the user opts in. It is off unless
+// telemetry.json in the user config directory enables it, and HEXATILES_TELEMETRY=off or
+// DO_NOT_TRACK turn it off whatever the file says. Events carry the command, its duration, a row
+// count bucket and the platform, never paths, property names or values. They are appended to a
+// local queue, which is sent to the configured endpoint as NDJSON; without an endpoint they
+// stay on disk, where `hexatiles telemetry status` shows them.
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvVar overrides the config file: a false value (off, 0, false) disables telemetry.
+const EnvVar = "HEXATILES_TELEMETRY"
+
+// maxQueued bounds the queue; the oldest events are dropped beyond it.
+const maxQueued = 1000
+
+// flushTimeout bounds the time a command waits for the endpoint after it finished.
+const flushTimeout = 2 * time.Second
+
+// Config is the content of telemetry.json.
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint receives queued events in POST requests with an application/x-ndjson body.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Event is one command run.
+type Event struct {
+	Command    string `json:"command"`
+	DurationMS int64  `json:"duration_ms"`
+	// Rows is the bucket of the input rows read, empty for commands that read none.
+	Rows    string `json:"rows,omitempty"`
+	Success bool   `json:"success"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Version string `json:"version"`
+}
+
+// ConfigPath is the telemetry.json that opts in.
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "hexatiles", "telemetry.json"), nil
+}
+
+// QueuePath is the file events wait in until they are sent.
+func QueuePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locate cache directory: %w", err)
+	}
+	return filepath.Join(dir, "hexatiles", "telemetry-queue.ndjson"), nil
+}
+
+// LoadConfig reads telemetry.json. A missing file is the default, disabled configuration.
+func LoadConfig() (Config, error) {
+	var cfg Config
+	path, err := ConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// SaveConfig writes telemetry.json. Disabling also deletes the queue, so nothing recorded
+// before is sent later.
+func SaveConfig(cfg Config) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if !cfg.Enabled {
+		return ClearQueue()
+	}
+	return nil
+}
+
+// Disabled returns the environment variable that turns telemetry off, if one does.
+func Disabled() string {
+	if value, ok := os.LookupEnv(EnvVar); ok {
+		if on, err := strconv.ParseBool(value); (err == nil && !on) || strings.EqualFold(value, "off") {
+			return EnvVar
+		}
+	}
+	if value := os.Getenv("DO_NOT_TRACK"); value != "" && value != "0" {
+		return "DO_NOT_TRACK"
+	}
+	return ""
+}
+
+// RowBucket rounds a row count to an order of magnitude, so events do not reveal dataset sizes.
+func RowBucket(rows int64) string {
+	switch {
+	case rows < 0:
+		return ""
+	case rows < 1_000:
+		return "<1K"
+	case rows < 100_000:
+		return "1K-100K"
+	case rows < 10_000_000:
+		return "100K-10M"
+	case rows < 1_000_000_000:
+		return "10M-1B"
+	default:
+		return ">1B"
+	}
+}
+
+// Usage collects what a command reports about its run. Commands reach it through their context.
+type Usage struct {
+	rows int64
+}
+
+type usageKey struct{}
+
+// WithUsage returns a context carrying a Usage for the command run under it.
+func WithUsage(ctx context.Context) (context.Context, *Usage) {
+	u := &Usage{rows: -1}
+	return context.WithValue(ctx, usageKey{}, u), u
+}
+
+// SetRows records the input rows a command read. It does nothing outside WithUsage.
+func SetRows(ctx context.Context, rows int64) {
+	if u, ok := ctx.Value(usageKey{}).(*Usage); ok {
+		u.rows = rows
+	}
+}
+
+// Record queues the event for a finished command and sends the queue when an endpoint is
+// configured. It does nothing unless the user opted in. Errors are returned for the caller to
+// ignore: telemetry never fails a command.
+func Record(ctx context.Context, command string, duration time.Duration, success bool, u *Usage, version string) error {
+	if Disabled() != "" {
+		return nil
+	}
+	cfg, err := LoadConfig()
+	if err != nil || !cfg.Enabled {
+		return err
+	}
+	ev := Event{
+		Command:    command,
+		DurationMS: duration.Milliseconds(),
+		Success:    success,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Version:    version,
+	}
+	if u != nil {
+		ev.Rows = RowBucket(u.rows)
+	}
+	if err := enqueue(ev); err != nil {
+		return err
+	}
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+	defer cancel()
+	return Flush(ctx, cfg.Endpoint)
+}
+
+// Queued returns the events waiting to be sent.
+func Queued() ([]Event, error) {
+	path, err := QueuePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if json.Unmarshal(scanner.Bytes(), &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return events, nil
+}
+
+// ClearQueue deletes the queued events.
+func ClearQueue() error {
+	path, err := QueuePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// Flush sends the queued events to endpoint in one request and clears the queue once it is
+// accepted. Events stay queued when the endpoint fails, up to maxQueued.
+func Flush(ctx context.Context, endpoint string) error {
+	events, err := Queued()
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	body, err := encode(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("telemetry endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("telemetry endpoint: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint: %s", resp.Status)
+	}
+	return ClearQueue()
+}
+
+// enqueue appends ev to the queue, dropping the oldest events beyond maxQueued.
+func enqueue(ev Event) error {
+	events, err := Queued()
+	if err != nil {
+		return err
+	}
+	events = append(events, ev)
+	if len(events) > maxQueued {
+		events = events[len(events)-maxQueued:]
+	}
+	path, err := QueuePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	body, err := encode(events)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+func encode(events []Event) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
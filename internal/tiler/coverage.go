@@ -0,0 +1,86 @@
+package tiler
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/paulmach/orb/maptile"
+)
+
+// TilesPresent reports, for each tile, whether the PMTiles archive or MBTiles file at path
+// addresses it.
+func TilesPresent(path string, tiles []maptile.Tile) ([]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open tileset: %w", err)
+	}
+	magic := make([]byte, 7)
+	_, readErr := io.ReadFull(f, magic)
+	f.Close()
+	if readErr == nil && bytes.Equal(magic, []byte("PMTiles")) {
+		return pmtilesTilesPresent(path, tiles)
+	}
+	return mbtilesTilesPresent(path, tiles)
+}
+
+func pmtilesTilesPresent(path string, tiles []maptile.Tile) ([]bool, error) {
+	archive, err := OpenPMTiles(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	present := make([]bool, len(tiles))
+	for i, t := range tiles {
+		if present[i], err = archive.Has(int(t.Z), int(t.X), int(t.Y)); err != nil {
+			return nil, err
+		}
+	}
+	return present, nil
+}
+
+// mbtilesTilesPresent loads the tile coordinates of each zoom asked about once; MBTiles rows
+// count from the south (TMS), so they are flipped to XYZ.
+func mbtilesTilesPresent(path string, tiles []maptile.Tile) ([]bool, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	stored := make(map[maptile.Zoom]map[[2]uint32]bool)
+	present := make([]bool, len(tiles))
+	for i, t := range tiles {
+		set, ok := stored[t.Z]
+		if !ok {
+			if set, err = mbtilesZoomTiles(db, t.Z); err != nil {
+				return nil, err
+			}
+			stored[t.Z] = set
+		}
+		present[i] = set[[2]uint32{t.X, t.Y}]
+	}
+	return present, nil
+}
+
+func mbtilesZoomTiles(db *sql.DB, z maptile.Zoom) (map[[2]uint32]bool, error) {
+	rows, err := db.Query(`SELECT tile_column, tile_row FROM tiles WHERE zoom_level = ?`, int(z))
+	if err != nil {
+		return nil, fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	defer rows.Close()
+	set := make(map[[2]uint32]bool)
+	for rows.Next() {
+		var x, row uint32
+		if err := rows.Scan(&x, &row); err != nil {
+			return nil, fmt.Errorf("read mbtiles tiles: %w", err)
+		}
+		set[[2]uint32{x, (uint32(1)<<z - 1) - row}] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	return set, nil
+}
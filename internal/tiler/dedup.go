@@ -0,0 +1,89 @@
+package tiler
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PMTiles v3 header counters; zero means the writer left them unset.
+const (
+	pmtilesAddressedTilesOffset = 72
+	pmtilesTileContentsOffset   = 88
+)
+
+// TileCounts describes how many tiles an archive addresses and how many distinct tile payloads
+// it stores. Both tippecanoe's PMTiles writer and `pmtiles convert` hash tile contents and store
+// identical tiles (typically empty ocean or uniform low-zoom tiles) once.
+type TileCounts struct {
+	Addressed uint64
+	Contents  uint64
+}
+
+// DedupRatio is addressed tiles per stored payload; 1 means no tile was shared.
+func (c TileCounts) DedupRatio() float64 {
+	if c.Contents == 0 {
+		return 0
+	}
+	return float64(c.Addressed) / float64(c.Contents)
+}
+
+// PMTilesTileCounts reads the tile counters from a PMTiles v3 header.
+func PMTilesTileCounts(path string) (TileCounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return TileCounts{}, fmt.Errorf("open pmtiles: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, pmtilesHeaderLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return TileCounts{}, fmt.Errorf("read pmtiles header: %w", err)
+	}
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		return TileCounts{}, fmt.Errorf("%s is not a PMTiles v3 archive", path)
+	}
+	counts := TileCounts{
+		Addressed: binary.LittleEndian.Uint64(header[pmtilesAddressedTilesOffset:]),
+		Contents:  binary.LittleEndian.Uint64(header[pmtilesTileContentsOffset:]),
+	}
+	if counts.Addressed == 0 || counts.Contents == 0 {
+		return TileCounts{}, fmt.Errorf("%s does not record tile counts", path)
+	}
+	return counts, nil
+}
+
+// MBTilesTileCounts hashes every tile of an MBTiles file. tippecanoe's MBTiles stores each tile
+// separately, so Contents is what a deduplicating PMTiles conversion would keep.
+func MBTilesTileCounts(path string) (TileCounts, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return TileCounts{}, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT tile_data FROM tiles`)
+	if err != nil {
+		return TileCounts{}, fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[[sha256.Size]byte]struct{})
+	var counts TileCounts
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return TileCounts{}, fmt.Errorf("read mbtiles tiles: %w", err)
+		}
+		counts.Addressed++
+		seen[sha256.Sum256(data)] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return TileCounts{}, fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	counts.Contents = uint64(len(seen))
+	return counts, nil
+}
@@ -0,0 +1,327 @@
+package tiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// ZoomDiff compares the tiles of one zoom. Sizes are the stored, compressed tile bytes.
+type ZoomDiff struct {
+	Zoom      int    `json:"zoom"`
+	TilesA    uint64 `json:"tiles_a"`
+	TilesB    uint64 `json:"tiles_b"`
+	Added     uint64 `json:"added"`
+	Removed   uint64 `json:"removed"`
+	Changed   uint64 `json:"changed"`
+	Unchanged uint64 `json:"unchanged"`
+	BytesA    int64  `json:"bytes_a"`
+	BytesB    int64  `json:"bytes_b"`
+}
+
+// SchemaChange is a layer or field of vector_layers that differs. Field is empty for a layer
+// added or removed; Before and After are the field types, empty where it is missing.
+type SchemaChange struct {
+	Layer  string `json:"layer"`
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// MetadataChange is a header field or metadata key whose value differs, formatted as JSON.
+// Keys under hexatiles are compared one by one, as hexatiles.<key>.
+type MetadataChange struct {
+	Key    string `json:"key"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// PMTilesDiff describes how archive B differs from archive A.
+type PMTilesDiff struct {
+	Zooms    []ZoomDiff       `json:"zooms"`
+	Schema   []SchemaChange   `json:"schema"`
+	Metadata []MetadataChange `json:"metadata"`
+}
+
+// Total sums the zooms.
+func (d PMTilesDiff) Total() ZoomDiff {
+	total := ZoomDiff{Zoom: -1}
+	for _, z := range d.Zooms {
+		total.TilesA += z.TilesA
+		total.TilesB += z.TilesB
+		total.Added += z.Added
+		total.Removed += z.Removed
+		total.Changed += z.Changed
+		total.Unchanged += z.Unchanged
+		total.BytesA += z.BytesA
+		total.BytesB += z.BytesB
+	}
+	return total
+}
+
+// Identical reports whether the archives hold the same tiles, schema and metadata.
+func (d PMTilesDiff) Identical() bool {
+	total := d.Total()
+	return total.Added == 0 && total.Removed == 0 && total.Changed == 0 && len(d.Schema) == 0 && len(d.Metadata) == 0
+}
+
+// diffTile is what DiffPMTiles keeps of a tile of archive A.
+type diffTile struct {
+	sum  [sha256.Size]byte
+	seen bool
+}
+
+// DiffPMTiles compares two archives tile by tile. Tiles are compared by their decompressed
+// contents, so archives written with different tile compression can still match. The schema
+// comes from vector_layers, the rest of the metadata is compared key by key, and tilestats,
+// which follows the tile contents, is left out.
+func DiffPMTiles(ctx context.Context, pathA, pathB string) (PMTilesDiff, error) {
+	var diff PMTilesDiff
+	a, err := OpenPMTiles(pathA)
+	if err != nil {
+		return diff, err
+	}
+	defer a.Close()
+	b, err := OpenPMTiles(pathB)
+	if err != nil {
+		return diff, err
+	}
+	defer b.Close()
+
+	zooms := make(map[int]*ZoomDiff)
+	zoom := func(z int) *ZoomDiff {
+		if zooms[z] == nil {
+			zooms[z] = &ZoomDiff{Zoom: z}
+		}
+		return zooms[z]
+	}
+
+	tilesA := make(map[uint64]*diffTile)
+	gzippedA := a.Header().TileGzip
+	err = a.Walk(func(z, x, y int, tile []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sum, err := tileSum(tile, gzippedA)
+		if err != nil {
+			return fmt.Errorf("%s: tile %d/%d/%d: %w", pathA, z, x, y, err)
+		}
+		tilesA[zxyToTileID(uint8(z), uint32(x), uint32(y))] = &diffTile{sum: sum}
+		zd := zoom(z)
+		zd.TilesA++
+		zd.BytesA += int64(len(tile))
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+
+	gzippedB := b.Header().TileGzip
+	err = b.Walk(func(z, x, y int, tile []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sum, err := tileSum(tile, gzippedB)
+		if err != nil {
+			return fmt.Errorf("%s: tile %d/%d/%d: %w", pathB, z, x, y, err)
+		}
+		zd := zoom(z)
+		zd.TilesB++
+		zd.BytesB += int64(len(tile))
+		prev, ok := tilesA[zxyToTileID(uint8(z), uint32(x), uint32(y))]
+		switch {
+		case !ok:
+			zd.Added++
+		case prev.sum == sum:
+			zd.Unchanged++
+		default:
+			zd.Changed++
+		}
+		if ok {
+			prev.seen = true
+		}
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+	for id, tile := range tilesA {
+		if !tile.seen {
+			z, _, _ := tileIDToZxy(id)
+			zoom(int(z)).Removed++
+		}
+	}
+	for _, z := range slices.Sorted(maps.Keys(zooms)) {
+		diff.Zooms = append(diff.Zooms, *zooms[z])
+	}
+
+	metaA, err := a.Metadata()
+	if err != nil {
+		return diff, fmt.Errorf("%s: %w", pathA, err)
+	}
+	metaB, err := b.Metadata()
+	if err != nil {
+		return diff, fmt.Errorf("%s: %w", pathB, err)
+	}
+	diff.Schema = diffSchema(metaA["vector_layers"], metaB["vector_layers"])
+	diff.Metadata = diffHeaders(a.Header(), b.Header())
+	diff.Metadata = append(diff.Metadata, diffMetadata(metaA, metaB)...)
+	return diff, nil
+}
+
+// tileSum hashes the decompressed contents of a tile.
+func tileSum(tile []byte, gzipped bool) ([sha256.Size]byte, error) {
+	if !gzipped {
+		return sha256.Sum256(tile), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(tile))
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, zr); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+// diffSchema compares two vector_layers values. Layers and fields are listed in name order.
+func diffSchema(before, after any) []SchemaChange {
+	var layersA, layersB []vectorLayerMetadata
+	remarshal(before, &layersA)
+	remarshal(after, &layersB)
+	byID := func(layers []vectorLayerMetadata) map[string]vectorLayerMetadata {
+		out := make(map[string]vectorLayerMetadata, len(layers))
+		for _, layer := range layers {
+			out[layer.ID] = layer
+		}
+		return out
+	}
+	a, b := byID(layersA), byID(layersB)
+
+	var changes []SchemaChange
+	ids := slices.Sorted(maps.Keys(a))
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		la, okA := a[id]
+		lb, okB := b[id]
+		if !okA || !okB {
+			change := SchemaChange{Layer: id}
+			if okA {
+				change.Before = "layer"
+			} else {
+				change.After = "layer"
+			}
+			changes = append(changes, change)
+			continue
+		}
+		fields := slices.Sorted(maps.Keys(la.Fields))
+		for field := range lb.Fields {
+			if _, ok := la.Fields[field]; !ok {
+				fields = append(fields, field)
+			}
+		}
+		slices.Sort(fields)
+		for _, field := range fields {
+			if la.Fields[field] != lb.Fields[field] {
+				changes = append(changes, SchemaChange{Layer: id, Field: field, Before: la.Fields[field], After: lb.Fields[field]})
+			}
+		}
+	}
+	return changes
+}
+
+// diffHeaders compares the tileset fields of two archive headers.
+func diffHeaders(a, b PMTilesHeader) []MetadataChange {
+	var changes []MetadataChange
+	fields := []struct {
+		key    string
+		before any
+		after  any
+	}{
+		{"minzoom", a.MinZoom, b.MinZoom},
+		{"maxzoom", a.MaxZoom, b.MaxZoom},
+		{"bounds", a.Bounds, b.Bounds},
+		{"center", a.Center, b.Center},
+		{"tile_type", a.TileType, b.TileType},
+		{"tile_gzip", a.TileGzip, b.TileGzip},
+	}
+	for _, f := range fields {
+		if f.before != f.after {
+			changes = append(changes, MetadataChange{Key: f.key, Before: metadataString(f.before), After: metadataString(f.after)})
+		}
+	}
+	return changes
+}
+
+// diffMetadata compares the metadata keys other than vector_layers, which diffSchema covers,
+// and tilestats. The objects under hexatiles, such as the statistics of each property, are
+// compared entry by entry so the change names the property.
+func diffMetadata(a, b map[string]any) []MetadataChange {
+	delete(a, "vector_layers")
+	delete(a, "tilestats")
+	delete(b, "vector_layers")
+	delete(b, "tilestats")
+	return diffMetadataKeys("", a, b, 0)
+}
+
+// diffMetadataKeys compares a and b key by key, descending into objects present on both sides
+// for up to levels levels. The top-level hexatiles object is always descended into, with one
+// level below it.
+func diffMetadataKeys(prefix string, a, b map[string]any, levels int) []MetadataChange {
+	keys := slices.Sorted(maps.Keys(a))
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	var changes []MetadataChange
+	for _, key := range keys {
+		before, okA := a[key]
+		after, okB := b[key]
+		if okA && okB && reflect.DeepEqual(jsonValue(before), jsonValue(after)) {
+			continue
+		}
+		objA, isObjA := before.(map[string]any)
+		objB, isObjB := after.(map[string]any)
+		descend, next := levels > 0, levels-1
+		if prefix == "" && key == "hexatiles" {
+			descend, next = true, 1
+		}
+		if isObjA && isObjB && descend {
+			changes = append(changes, diffMetadataKeys(prefix+key+".", objA, objB, next)...)
+			continue
+		}
+		change := MetadataChange{Key: prefix + key}
+		if okA {
+			change.Before = metadataString(before)
+		}
+		if okB {
+			change.After = metadataString(after)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// metadataString formats a changed value for display.
+func metadataString(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
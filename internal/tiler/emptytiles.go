@@ -0,0 +1,245 @@
+package tiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Empty tile policies accepted by the build.
+const (
+	// EmptyTilesElide leaves tiles without features out of the archive; clients treat a missing
+	// tile inside the bounds as empty. This is what tippecanoe does.
+	EmptyTilesElide = "elide"
+	// EmptyTilesWrite stores an explicit empty vector tile for every featureless tile inside the
+	// bounds, for clients that treat a missing tile as an error. Deduplication keeps the cost to
+	// one payload plus directory entries.
+	EmptyTilesWrite = "write"
+)
+
+// PMTiles v3 header zoom and bounds fields.
+const (
+	pmtilesMinZoomOffset = 100
+	pmtilesMaxZoomOffset = 101
+	pmtilesBoundsOffset  = 102
+)
+
+// webMercatorMaxLat is the latitude at which Web Mercator tiles end.
+const webMercatorMaxLat = 85.0511287798066
+
+// tileBounds is a tileset extent in degrees: west, south, east, north.
+type tileBounds [4]float64
+
+// PMTilesElidedTiles returns how many tiles inside the archive's bounds and zoom range were not
+// written, from the header alone.
+func PMTilesElidedTiles(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open pmtiles: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, pmtilesHeaderLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0, fmt.Errorf("read pmtiles header: %w", err)
+	}
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		return 0, fmt.Errorf("%s is not a PMTiles v3 archive", path)
+	}
+	var bounds tileBounds
+	for i := range bounds {
+		e7 := int32(binary.LittleEndian.Uint32(header[pmtilesBoundsOffset+4*i:]))
+		bounds[i] = float64(e7) / 1e7
+	}
+	addressed := binary.LittleEndian.Uint64(header[pmtilesAddressedTilesOffset:])
+	covered := bounds.tileCount(int(header[pmtilesMinZoomOffset]), int(header[pmtilesMaxZoomOffset]))
+	if addressed >= covered {
+		return 0, nil
+	}
+	return covered - addressed, nil
+}
+
+// MBTilesElidedTiles returns how many tiles inside the bounds and zoom range recorded in the
+// MBTiles metadata have no row in the tiles table.
+func MBTilesElidedTiles(path string) (uint64, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	bounds, minZoom, maxZoom, err := mbtilesExtent(db)
+	if err != nil {
+		return 0, err
+	}
+	var present uint64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM tiles WHERE zoom_level BETWEEN ? AND ?`, minZoom, maxZoom).Scan(&present); err != nil {
+		return 0, fmt.Errorf("count mbtiles tiles: %w", err)
+	}
+	covered := bounds.tileCount(minZoom, maxZoom)
+	if present >= covered {
+		return 0, nil
+	}
+	return covered - present, nil
+}
+
+// WriteEmptyTiles inserts an empty vector tile for every tile inside the MBTiles bounds and zoom
+// range that has no row yet, and returns how many were inserted.
+func WriteEmptyTiles(path string) (uint64, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	bounds, minZoom, maxZoom, err := mbtilesExtent(db)
+	if err != nil {
+		return 0, err
+	}
+	empty, err := emptyTile()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("write empty tiles: %w", err)
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare(`INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("write empty tiles: %w", err)
+	}
+	defer insert.Close()
+
+	var written uint64
+	for z := minZoom; z <= maxZoom; z++ {
+		present, err := presentTiles(tx, z)
+		if err != nil {
+			return 0, err
+		}
+		x0, y0, x1, y1 := bounds.tileRange(z)
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				// MBTiles rows use TMS numbering, with y counted from the south.
+				row := (1 << z) - 1 - y
+				if present[[2]int{x, row}] {
+					continue
+				}
+				if _, err := insert.Exec(z, x, row, empty); err != nil {
+					return 0, fmt.Errorf("write empty tiles: %w", err)
+				}
+				written++
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("write empty tiles: %w", err)
+	}
+	return written, nil
+}
+
+func presentTiles(tx *sql.Tx, zoom int) (map[[2]int]bool, error) {
+	rows, err := tx.Query(`SELECT tile_column, tile_row FROM tiles WHERE zoom_level = ?`, zoom)
+	if err != nil {
+		return nil, fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	defer rows.Close()
+	present := make(map[[2]int]bool)
+	for rows.Next() {
+		var x, y int
+		if err := rows.Scan(&x, &y); err != nil {
+			return nil, fmt.Errorf("read mbtiles tiles: %w", err)
+		}
+		present[[2]int{x, y}] = true
+	}
+	return present, rows.Err()
+}
+
+// mbtilesExtent reads the bounds, minzoom and maxzoom rows that tippecanoe writes.
+func mbtilesExtent(db *sql.DB) (tileBounds, int, int, error) {
+	values := make(map[string]string)
+	rows, err := db.Query(`SELECT name, value FROM metadata WHERE name IN ('bounds', 'minzoom', 'maxzoom')`)
+	if err != nil {
+		return tileBounds{}, 0, 0, fmt.Errorf("read mbtiles metadata: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return tileBounds{}, 0, 0, fmt.Errorf("read mbtiles metadata: %w", err)
+		}
+		values[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return tileBounds{}, 0, 0, fmt.Errorf("read mbtiles metadata: %w", err)
+	}
+
+	parts := strings.Split(values["bounds"], ",")
+	if len(parts) != 4 {
+		return tileBounds{}, 0, 0, fmt.Errorf("mbtiles metadata has no bounds")
+	}
+	var bounds tileBounds
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return tileBounds{}, 0, 0, fmt.Errorf("mbtiles bounds %q: %w", values["bounds"], err)
+		}
+		bounds[i] = v
+	}
+	minZoom, err := strconv.Atoi(values["minzoom"])
+	if err != nil {
+		return tileBounds{}, 0, 0, fmt.Errorf("mbtiles minzoom %q: %w", values["minzoom"], err)
+	}
+	maxZoom, err := strconv.Atoi(values["maxzoom"])
+	if err != nil {
+		return tileBounds{}, 0, 0, fmt.Errorf("mbtiles maxzoom %q: %w", values["maxzoom"], err)
+	}
+	return bounds, minZoom, maxZoom, nil
+}
+
+// tileCount is the number of tiles intersecting the bounds over the zoom range.
+func (b tileBounds) tileCount(minZoom, maxZoom int) uint64 {
+	var total uint64
+	for z := minZoom; z <= maxZoom; z++ {
+		x0, y0, x1, y1 := b.tileRange(z)
+		total += uint64(x1-x0+1) * uint64(y1-y0+1)
+	}
+	return total
+}
+
+// tileRange returns the XYZ tile columns and rows intersecting the bounds at zoom.
+func (b tileBounds) tileRange(zoom int) (x0, y0, x1, y1 int) {
+	x0, y1 = lonLatToTile(b[0], b[1], zoom)
+	x1, y0 = lonLatToTile(b[2], b[3], zoom)
+	return x0, y0, x1, y1
+}
+
+func lonLatToTile(lon, lat float64, zoom int) (int, int) {
+	n := float64(int(1) << zoom)
+	lat = math.Max(-webMercatorMaxLat, math.Min(webMercatorMaxLat, lat))
+	x := (lon + 180) / 360 * n
+	rad := lat * math.Pi / 180
+	y := (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n
+	clamp := func(v float64) int {
+		return int(math.Max(0, math.Min(n-1, math.Floor(v))))
+	}
+	return clamp(x), clamp(y)
+}
+
+// emptyTile is a vector tile with no layers, gzip-compressed like tippecanoe's tiles.
+func emptyTile() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("encode empty tile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,290 @@
+package tiler
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeToolsEnv switches the tippecanoe, pmtiles and tile-join lookups to stub binaries that run
+// the native tiler, PMTiles writer and merger in-process, so the whole build pipeline can run in
+// CI or in an embedder's integration tests without the external tools installed. Explicit
+// paths, from flags or TIPPECANOE_PATH, PMTILES_PATH and TILE_JOIN_PATH, still win.
+const FakeToolsEnv = "HEXATILES_FAKE_TOOLS"
+
+// fakeToolEnv names the tool a stub binary stands in for. The stubs re-execute the current
+// executable with it set, which then must call RunFakeTool before anything else.
+const fakeToolEnv = "HEXATILES_FAKE_TOOL"
+
+// FakeToolVersion is what the stubs print when asked for their version.
+const FakeToolVersion = "hexatiles fake tools"
+
+// FakeTools holds the paths of installed stub binaries.
+type FakeTools struct {
+	Tippecanoe string
+	PMTiles    string
+	TileJoin   string
+}
+
+// FakeToolsEnabled reports whether FakeToolsEnv is set to a true value.
+func FakeToolsEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(FakeToolsEnv))
+	return enabled
+}
+
+// InstallFakeTools writes tippecanoe, pmtiles and tile-join stubs into dir. Each stub re-executes the
+// current executable, so a test binary using them must call RunFakeTool from TestMain.
+func InstallFakeTools(dir string) (FakeTools, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return FakeTools{}, fmt.Errorf("locate executable for fake tools: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return FakeTools{}, fmt.Errorf("create fake tools directory: %w", err)
+	}
+	var tools FakeTools
+	for _, tool := range []struct {
+		name string
+		path *string
+	}{{"tippecanoe", &tools.Tippecanoe}, {"pmtiles", &tools.PMTiles}, {"tile-join", &tools.TileJoin}} {
+		path, script := filepath.Join(dir, tool.name), stubScript(exe, tool.name)
+		if runtime.GOOS == "windows" {
+			path += ".bat"
+		}
+		if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+			return FakeTools{}, fmt.Errorf("write fake %s: %w", tool.name, err)
+		}
+		*tool.path = path
+	}
+	return tools, nil
+}
+
+func stubScript(exe, tool string) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf("@echo off\r\nset %s=%s\r\n\"%s\" %%*\r\n", fakeToolEnv, tool, exe)
+	}
+	return fmt.Sprintf("#!/bin/sh\n%s=%s exec '%s' \"$@\"\n", fakeToolEnv, tool, strings.ReplaceAll(exe, "'", `'\''`))
+}
+
+var fakeTools struct {
+	once  sync.Once
+	tools FakeTools
+	err   error
+}
+
+// fakeToolPath returns the stub for tool, installing the stubs into a temporary directory on
+// first use.
+func fakeToolPath(tool string) (string, error) {
+	fakeTools.once.Do(func() {
+		dir, err := os.MkdirTemp("", "hexatiles-fake-tools-")
+		if err != nil {
+			fakeTools.err = fmt.Errorf("create fake tools directory: %w", err)
+			return
+		}
+		fakeTools.tools, fakeTools.err = InstallFakeTools(dir)
+	})
+	if fakeTools.err != nil {
+		return "", fakeTools.err
+	}
+	switch tool {
+	case "pmtiles":
+		return fakeTools.tools.PMTiles, nil
+	case "tile-join":
+		return fakeTools.tools.TileJoin, nil
+	}
+	return fakeTools.tools.Tippecanoe, nil
+}
+
+// RunFakeTool acts as the stub tool when the process was started by one, and exits; otherwise
+// it returns at once. Call it first thing in main, and in TestMain of tests that use the stubs.
+func RunFakeTool() {
+	tool := os.Getenv(fakeToolEnv)
+	if tool == "" {
+		return
+	}
+	var err error
+	switch tool {
+	case "tippecanoe":
+		err = fakeTippecanoe(context.Background(), os.Args[1:], os.Stderr)
+	case "pmtiles":
+		err = fakePMTiles(context.Background(), os.Args[1:], os.Stdout)
+	case "tile-join":
+		err = fakeTileJoin(context.Background(), os.Args[1:], os.Stderr)
+	default:
+		err = fmt.Errorf("unknown fake tool %q", tool)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake %s: %v\n", tool, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// fakeTippecanoe reads the arguments TippecanoeArgs produces and tiles with the native tiler.
+// Flags the native tiler has no use for, such as the drop strategy, are ignored.
+func fakeTippecanoe(ctx context.Context, args []string, stderr io.Writer) error {
+	if len(args) == 1 && (args[0] == "--version" || args[0] == "-v") {
+		fmt.Fprintf(stderr, "tippecanoe v0.0.0 (%s)\n", FakeToolVersion)
+		return nil
+	}
+
+	opts := TippecanoeOptions{MinZoom: 0, MaxZoom: 14, Metadata: make(map[string]string), AttributeTypes: make(map[string]string)}
+	var output, input string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch {
+		case arg == "-o" || arg == "--output":
+			output, err = value()
+		case arg == "-l" || arg == "--layer":
+			opts.LayerName, err = value()
+		case arg == "-Z" || arg == "--minimum-zoom":
+			var v string
+			if v, err = value(); err == nil {
+				opts.MinZoom, err = strconv.Atoi(v)
+			}
+		case arg == "-z" || arg == "--maximum-zoom":
+			var v string
+			if v, err = value(); err == nil {
+				opts.MaxZoom, err = strconv.Atoi(v)
+			}
+		case arg == "-L":
+			var v string
+			if v, err = value(); err == nil {
+				name, path, ok := strings.Cut(v, ":")
+				switch {
+				case !ok:
+					err = fmt.Errorf("-L %s: expected name:path", v)
+				case input == "":
+					opts.LayerName, input = name, path
+				default:
+					opts.ExtraLayers = append(opts.ExtraLayers, Layer{Name: name, Path: path})
+				}
+			}
+		case arg == "--name" || arg == "--description" || arg == "--attribution" || arg == "--version":
+			var v string
+			if v, err = value(); err == nil {
+				opts.Metadata[strings.TrimPrefix(arg, "--")] = v
+			}
+		case metadataFlag(arg):
+			key, v, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			opts.Metadata[key] = v
+		case strings.HasPrefix(arg, "--maximum-tile-features="):
+			opts.FeatureLimit, err = strconv.Atoi(strings.TrimPrefix(arg, "--maximum-tile-features="))
+		case strings.HasPrefix(arg, "--order-by="):
+			opts.SortBy = strings.TrimPrefix(arg, "--order-by=")
+		case strings.HasPrefix(arg, "--accumulate-attribute="):
+			attr, _, _ := strings.Cut(strings.TrimPrefix(arg, "--accumulate-attribute="), ":")
+			opts.Conserve = append(opts.Conserve, attr)
+		case strings.HasPrefix(arg, "--include="):
+			opts.Attributes = append(opts.Attributes, strings.TrimPrefix(arg, "--include="))
+		case strings.HasPrefix(arg, "--attribute-type="):
+			key, kind, _ := strings.Cut(strings.TrimPrefix(arg, "--attribute-type="), ":")
+			opts.AttributeTypes[key] = kind
+		case strings.HasPrefix(arg, "-"):
+		default:
+			if input != "" {
+				return fmt.Errorf("more than one input: %s and %s", input, arg)
+			}
+			input = arg
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if output == "" || input == "" {
+		return fmt.Errorf("usage: tippecanoe -o OUTPUT [options] INPUT")
+	}
+
+	log, _, err := NewNativeTiler().Run(ctx, input, output, opts)
+	fmt.Fprint(stderr, log)
+	return err
+}
+
+// metadataFlag reports whether arg is --name=, --description=, --attribution= or --version=.
+func metadataFlag(arg string) bool {
+	for _, key := range []string{"name", "description", "attribution", "version"} {
+		if strings.HasPrefix(arg, "--"+key+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// fakePMTiles implements the version, convert and info --json subcommands of the pmtiles CLI.
+func fakePMTiles(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: pmtiles version|convert|info")
+	}
+	switch args[0] {
+	case "version":
+		fmt.Fprintf(stdout, "pmtiles v0.0.0 (%s)\n", FakeToolVersion)
+		return nil
+	case "convert":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: pmtiles convert INPUT.mbtiles OUTPUT.pmtiles")
+		}
+		return ConvertMBTiles(ctx, args[1], args[2], nil)
+	case "info":
+		var paths []string
+		for _, arg := range args[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				paths = append(paths, arg)
+			}
+		}
+		if len(paths) != 1 {
+			return fmt.Errorf("usage: pmtiles info --json INPUT.pmtiles")
+		}
+		info, err := pmtilesInfo(paths[0])
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	default:
+		return fmt.Errorf("unsupported subcommand %q", args[0])
+	}
+}
+
+// pmtilesInfo decodes the header and metadata of a PMTiles v3 archive.
+func pmtilesInfo(path string) (map[string]any, error) {
+	archive, err := OpenPMTiles(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	metadata, err := archive.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	h, raw := archive.Header(), archive.header
+	return map[string]any{
+		"spec_version":    3,
+		"tile_type":       h.TileType,
+		"min_zoom":        h.MinZoom,
+		"max_zoom":        h.MaxZoom,
+		"bounds":          h.Bounds[:],
+		"center":          h.Center[:],
+		"addressed_tiles": binary.LittleEndian.Uint64(raw[pmtilesAddressedTilesOffset:]),
+		"tile_entries":    binary.LittleEndian.Uint64(raw[pmtilesTileEntriesOffset:]),
+		"tile_contents":   binary.LittleEndian.Uint64(raw[pmtilesTileContentsOffset:]),
+		"clustered":       raw[pmtilesClusteredByte] == 1,
+		"metadata":        metadata,
+	}, nil
+}
@@ -0,0 +1,302 @@
+package tiler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// JoinOptions configures JoinProperties.
+type JoinOptions struct {
+	// Key is the feature property holding the cell identifier, the grid name of the build;
+	// "h3" when empty.
+	Key string
+	// Columns lists the properties refreshed. A matched feature loses those its row leaves
+	// null; the key and resolution are never replaced.
+	Columns []string
+}
+
+// JoinResult describes a joined archive. Features are counted once per tile, so a cell drawn at
+// every zoom counts at every zoom.
+type JoinResult struct {
+	// Tiles counts the tiles of the archive; Rewritten those holding a matched feature, which
+	// were re-encoded. The others are copied byte for byte.
+	Tiles     uint64
+	Rewritten uint64
+	// Features counts the features carrying the key, Updated those whose cell had a row and
+	// Unmatched those that kept their old values.
+	Features  uint64
+	Updated   uint64
+	Unmatched uint64
+	// Unused counts the rows whose cell no feature carries.
+	Unused int
+	// Warnings lists metadata that could not be brought up to date.
+	Warnings []string
+}
+
+// JoinProperties rewrites the attributes of an existing tileset from values, keyed by cell,
+// without re-tiling: each tile is decoded, the Columns of features whose cell has a row are
+// replaced and the tile is re-encoded, so geometry, simplification and the tile layout are
+// exactly those of the build. vector_layers, tilestats and the property statistics HexaTiles
+// records are recomputed for the refreshed columns from the rows that matched. output may be
+// input, which is then replaced once the new archive is complete.
+func JoinProperties(ctx context.Context, input, output string, values map[string]map[string]any, opts JoinOptions) (JoinResult, error) {
+	var result JoinResult
+	key := opts.Key
+	if key == "" {
+		key = "h3"
+	}
+	columns := make([]string, 0, len(opts.Columns))
+	for _, column := range opts.Columns {
+		if column != key && column != "resolution" && !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return result, fmt.Errorf("no property columns to join")
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return result, fmt.Errorf("resolve output: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(absOutput), 0o755); err != nil {
+		return result, fmt.Errorf("create output directory: %w", err)
+	}
+
+	a, err := OpenPMTiles(input)
+	if err != nil {
+		return result, err
+	}
+	defer a.Close()
+	if h := a.Header(); h.TileType != "mvt" {
+		return result, fmt.Errorf("%s holds %s tiles, not vector tiles", input, h.TileType)
+	}
+	metadata, err := a.Metadata()
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", input, err)
+	}
+
+	mbtilesPath, db, err := createTempMBTiles(filepath.Dir(absOutput), ".join-*.mbtiles")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(mbtilesPath)
+	defer db.Close()
+
+	matched := make(map[string]bool)
+	layers := make(map[string]bool)
+	gzipped := a.Header().TileGzip
+	err = mergeArchiveTiles(ctx, db, a, func(z, x, y int, tile []byte) ([]byte, bool, error) {
+		result.Tiles++
+		var decoded mvt.Layers
+		var err error
+		if gzipped {
+			decoded, err = mvt.UnmarshalGzipped(tile)
+		} else {
+			decoded, err = mvt.Unmarshal(tile)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("decode tile %d/%d/%d: %w", z, x, y, err)
+		}
+		changed := false
+		for _, layer := range decoded {
+			for _, feature := range layer.Features {
+				id, _ := feature.Properties[key].(string)
+				if id == "" {
+					continue
+				}
+				result.Features++
+				row, ok := values[id]
+				if !ok {
+					result.Unmatched++
+					continue
+				}
+				result.Updated++
+				matched[id] = true
+				layers[layer.Name] = true
+				for _, column := range columns {
+					if value := row[column]; value != nil {
+						feature.Properties[column] = joinValue(value)
+					} else {
+						delete(feature.Properties, column)
+					}
+				}
+				changed = true
+			}
+		}
+		if !changed {
+			if !gzipped {
+				tile, err = gzipTile(tile)
+			}
+			return tile, false, err
+		}
+		result.Rewritten++
+		tile, err = mvt.MarshalGzipped(decoded)
+		if err != nil {
+			return nil, false, fmt.Errorf("encode tile %d/%d/%d: %w", z, x, y, err)
+		}
+		return tile, false, nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", input, err)
+	}
+	result.Unused = len(values) - len(matched)
+
+	joined, warnings := joinMetadata(metadata, values, matched, layers, columns)
+	result.Warnings = warnings
+	if result.Unmatched > 0 {
+		result.Warnings = append(result.Warnings, "the statistics of the joined columns describe the joined rows only, not the features that kept their values")
+	}
+	if err := writeMergedMetadata(db, []*PMTilesArchive{a}, joined); err != nil {
+		return result, err
+	}
+	if err := db.Close(); err != nil {
+		return result, fmt.Errorf("close mbtiles: %w", err)
+	}
+	for _, key := range []string{"bounds", "center", "minzoom", "maxzoom", "format"} {
+		delete(joined, key)
+	}
+
+	// Write beside the output and rename, so a failure leaves the input intact when the two
+	// are the same file.
+	tmp, err := os.CreateTemp(filepath.Dir(absOutput), ".join-*.pmtiles")
+	if err != nil {
+		return result, fmt.Errorf("create temporary pmtiles: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := ConvertMBTiles(ctx, mbtilesPath, tmp.Name(), joined); err != nil {
+		return result, err
+	}
+	// CreateTemp makes the file private; give it the permissions of the input instead.
+	if info, err := os.Stat(input); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	a.Close()
+	if err := os.Rename(tmp.Name(), absOutput); err != nil {
+		return result, fmt.Errorf("replace %s: %w", output, err)
+	}
+	return result, nil
+}
+
+// joinValue converts a row value to one the vector tile encoder accepts; nested values are
+// written as JSON, as the native tiler writes them.
+func joinValue(value any) any {
+	switch v := value.(type) {
+	case string, bool, float64, float32, int, int32, int64, uint32, uint64:
+		return v
+	case map[string]any, []any:
+		if encoded, err := json.Marshal(v); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// joinMetadata brings the metadata of the refreshed columns up to date: vector_layers field
+// types, tilestats attributes of the layers that were rewritten and the hexatiles property
+// statistics are recomputed from the matched rows. Classification breaks cannot be redrawn
+// without the rest of the build, so a refreshed classified column is only reported.
+func joinMetadata(metadata map[string]any, values map[string]map[string]any, matched, layers map[string]bool, columns []string) (map[string]any, []string) {
+	var warnings []string
+	stats := props.NewStats()
+	tileStats := props.NewTileStats()
+	fields := make(map[string]string, len(columns))
+	// Sorted, so the percentile sample is the same on every run.
+	for _, id := range slices.Sorted(maps.Keys(matched)) {
+		row := make(map[string]any, len(columns))
+		for _, column := range columns {
+			if value := values[id][column]; value != nil {
+				value = joinValue(value)
+				row[column] = value
+				fields[column] = mergeFieldType(fields[column], value)
+			}
+		}
+		stats.Observe(row)
+		tileStats.Observe(row)
+	}
+	summary := stats.Summary()
+	attributes := tileStats.Layer("", "").Attributes
+
+	joined := maps.Clone(metadata)
+	if value, ok := metadata["vector_layers"]; ok {
+		var vectorLayers []vectorLayerMetadata
+		if err := remarshal(value, &vectorLayers); err != nil {
+			warnings = append(warnings, fmt.Sprintf("vector_layers metadata: %v", err))
+		} else {
+			for i := range vectorLayers {
+				if !layers[vectorLayers[i].ID] {
+					continue
+				}
+				if vectorLayers[i].Fields == nil {
+					vectorLayers[i].Fields = make(map[string]string, len(fields))
+				}
+				for _, column := range columns {
+					if kind, ok := fields[column]; ok {
+						vectorLayers[i].Fields[column] = kind
+					} else {
+						delete(vectorLayers[i].Fields, column)
+					}
+				}
+			}
+			joined["vector_layers"] = vectorLayers
+		}
+	}
+	if value, ok := metadata["tilestats"]; ok {
+		var ts tileStatsMetadata
+		if err := remarshal(value, &ts); err != nil {
+			warnings = append(warnings, fmt.Sprintf("tilestats metadata: %v", err))
+		} else {
+			for i, layer := range ts.Layers {
+				if !layers[layer.Layer] {
+					continue
+				}
+				kept := slices.DeleteFunc(layer.Attributes, func(attr props.TileStatsAttribute) bool {
+					return slices.Contains(columns, attr.Attribute)
+				})
+				kept = append(kept, attributes...)
+				slices.SortFunc(kept, func(a, b props.TileStatsAttribute) int {
+					return cmp.Compare(a.Attribute, b.Attribute)
+				})
+				ts.Layers[i].Attributes = kept
+				ts.Layers[i].AttributeCount = len(kept)
+			}
+			joined["tilestats"] = ts
+		}
+	}
+	if own, ok := metadata["hexatiles"].(map[string]any); ok {
+		own = maps.Clone(own)
+		if value, ok := own["stats"]; ok {
+			var previous map[string]props.PropertyStats
+			if err := remarshal(value, &previous); err != nil {
+				warnings = append(warnings, fmt.Sprintf("hexatiles.stats metadata: %v", err))
+			} else {
+				for _, column := range columns {
+					delete(previous, column)
+					if st, ok := summary[column]; ok {
+						previous[column] = st
+					}
+				}
+				own["stats"] = previous
+			}
+		}
+		if classes, ok := own["classes"].(map[string]any); ok {
+			for _, column := range columns {
+				if _, ok := classes[column]; ok {
+					warnings = append(warnings, fmt.Sprintf("hexatiles.classes.%s holds the breaks of the earlier values; rebuild to reclassify", column))
+				}
+			}
+		}
+		joined["hexatiles"] = own
+	}
+	return joined, warnings
+}
@@ -0,0 +1,96 @@
+package tiler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// MergeMBTilesMetadata adds the top-level keys of extra to the "json" row of an MBTiles metadata
+// table, where tippecanoe keeps vector_layers. `pmtiles convert` lifts the same keys to the top
+// level, so archives converted later match those produced by MergeMetadata.
+func MergeMBTilesMetadata(path string, extra map[string]any) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	metadata := make(map[string]any)
+	var raw string
+	switch err := db.QueryRow(`SELECT value FROM metadata WHERE name = 'json'`).Scan(&raw); {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("read mbtiles metadata: %w", err)
+	default:
+		if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+			return fmt.Errorf("decode mbtiles json metadata: %w", err)
+		}
+	}
+
+	for key, value := range extra {
+		metadata[key] = value
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("encode mbtiles metadata: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("update mbtiles metadata: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE name = 'json'`); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update mbtiles metadata: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO metadata (name, value) VALUES ('json', ?)`, string(encoded)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update mbtiles metadata: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("update mbtiles metadata: %w", err)
+	}
+	return nil
+}
+
+// MBTilesInfo returns the MBTiles metadata table as a map, with the "json" row expanded into
+// its keys, mirroring what `pmtiles info` reports for converted archives.
+func MBTilesInfo(path string) (map[string]any, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		return nil, fmt.Errorf("read mbtiles metadata: %w", err)
+	}
+	defer rows.Close()
+
+	info := make(map[string]any)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("read mbtiles metadata: %w", err)
+		}
+		if name != "json" {
+			info[name] = value
+			continue
+		}
+		nested := make(map[string]any)
+		if err := json.Unmarshal([]byte(value), &nested); err != nil {
+			return nil, fmt.Errorf("decode mbtiles json metadata: %w", err)
+		}
+		for key, v := range nested {
+			info[key] = v
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read mbtiles metadata: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,558 @@
+package tiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// Joiners accepted by MergeOptions.
+const (
+	// JoinerNative merges the archives in-process.
+	JoinerNative = "native"
+	// JoinerTileJoin runs tippecanoe's tile-join.
+	JoinerTileJoin = "tile-join"
+)
+
+// MergeOptions configures MergePMTiles.
+type MergeOptions struct {
+	// Joiner is JoinerNative, the default, or JoinerTileJoin.
+	Joiner string
+	// TileJoinPath overrides the tile-join binary; TILE_JOIN_PATH is read otherwise.
+	TileJoinPath string
+	// Name, when set, replaces the name the merged archive takes from the first input.
+	Name string
+}
+
+// MergeResult describes a merged archive.
+type MergeResult struct {
+	// Tiles counts the tiles the merged archive addresses; Overlapping those present in more
+	// than one input, whose layers were combined.
+	Tiles       uint64
+	Overlapping uint64
+	// Command is the tile-join argument list and Output its log, for JoinerTileJoin.
+	Command []string
+	Output  string
+	// Warnings lists metadata the inputs disagree on.
+	Warnings []string
+}
+
+// MergePMTiles combines PMTiles archives, typically builds of separate regions, into output.
+// Tiles present in one input are copied; tiles present in several are decoded and their layers
+// unioned, features of a layer shared by the inputs appended in input order. The bounds and
+// zoom range cover every input, vector_layers and tilestats describe the union and the
+// property statistics HexaTiles records are recombined. Other metadata comes from the first
+// input that has it.
+func MergePMTiles(ctx context.Context, inputs []string, output string, opts MergeOptions) (MergeResult, error) {
+	if len(inputs) < 2 {
+		return MergeResult{}, fmt.Errorf("merge needs at least two archives")
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("resolve output: %w", err)
+	}
+	for _, input := range inputs {
+		if absInput, err := filepath.Abs(input); err == nil && absInput == absOutput {
+			return MergeResult{}, fmt.Errorf("output %s is also an input", output)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(absOutput), 0o755); err != nil {
+		return MergeResult{}, fmt.Errorf("create output directory: %w", err)
+	}
+
+	switch opts.Joiner {
+	case "", JoinerNative:
+		return mergeNative(ctx, inputs, absOutput, opts)
+	case JoinerTileJoin:
+		return mergeTileJoin(ctx, inputs, absOutput, opts)
+	default:
+		return MergeResult{}, fmt.Errorf("unknown joiner %q (want %s or %s)", opts.Joiner, JoinerNative, JoinerTileJoin)
+	}
+}
+
+func mergeNative(ctx context.Context, inputs []string, output string, opts MergeOptions) (MergeResult, error) {
+	var result MergeResult
+	archives := make([]*PMTilesArchive, 0, len(inputs))
+	defer func() {
+		for _, a := range archives {
+			a.Close()
+		}
+	}()
+	metadata := make([]map[string]any, 0, len(inputs))
+	for _, input := range inputs {
+		a, err := OpenPMTiles(input)
+		if err != nil {
+			return result, err
+		}
+		archives = append(archives, a)
+		if h := a.Header(); h.TileType != "mvt" {
+			return result, fmt.Errorf("%s holds %s tiles, not vector tiles", input, h.TileType)
+		}
+		meta, err := a.Metadata()
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", input, err)
+		}
+		metadata = append(metadata, meta)
+	}
+
+	mbtilesPath, db, err := createTempMBTiles(filepath.Dir(output), ".merge-*.mbtiles")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(mbtilesPath)
+	defer db.Close()
+
+	seen := make(map[uint64]bool)
+	for i, a := range archives {
+		gzipped := a.Header().TileGzip
+		err := mergeArchiveTiles(ctx, db, a, func(z, x, y int, tile []byte) ([]byte, bool, error) {
+			if !gzipped {
+				var err error
+				if tile, err = gzipTile(tile); err != nil {
+					return nil, false, err
+				}
+			}
+			id := zxyToTileID(uint8(z), uint32(x), uint32(y))
+			if !seen[id] {
+				seen[id] = true
+				return tile, false, nil
+			}
+			result.Overlapping++
+			return tile, true, nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", inputs[i], err)
+		}
+	}
+	result.Tiles = uint64(len(seen))
+
+	merged, warnings := mergeMetadata(metadata, inputs)
+	result.Warnings = warnings
+	if opts.Name != "" {
+		merged["name"] = opts.Name
+	}
+	if err := writeMergedMetadata(db, archives, merged); err != nil {
+		return result, err
+	}
+	if err := db.Close(); err != nil {
+		return result, fmt.Errorf("close mbtiles: %w", err)
+	}
+	for _, key := range []string{"bounds", "center", "minzoom", "maxzoom", "format"} {
+		delete(merged, key)
+	}
+	return result, ConvertMBTiles(ctx, mbtilesPath, output, merged)
+}
+
+// createTempMBTiles creates an empty MBTiles file in dir, named by pattern as os.CreateTemp
+// does. The caller removes it.
+func createTempMBTiles(dir, pattern string) (string, *sql.DB, error) {
+	tmp, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("create temporary mbtiles: %w", err)
+	}
+	tmp.Close()
+	path := tmp.Name()
+	if err := os.Remove(path); err != nil {
+		return "", nil, fmt.Errorf("remove %s: %w", path, err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return "", nil, fmt.Errorf("open mbtiles: %w", err)
+	}
+	if err := createMBTiles(db); err != nil {
+		db.Close()
+		os.Remove(path)
+		return "", nil, err
+	}
+	return path, db, nil
+}
+
+// mergeArchiveTiles copies the tiles of a into db in one transaction. prepare returns the
+// gzip-compressed tile and whether db already holds a tile there, in which case the two are
+// combined.
+func mergeArchiveTiles(ctx context.Context, db *sql.DB, a *PMTilesArchive, prepare func(z, x, y int, tile []byte) ([]byte, bool, error)) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer tx.Rollback()
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer insert.Close()
+	lookup, err := tx.PrepareContext(ctx, `SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`)
+	if err != nil {
+		return fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer lookup.Close()
+	update, err := tx.PrepareContext(ctx, `UPDATE tiles SET tile_data = ? WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`)
+	if err != nil {
+		return fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer update.Close()
+
+	err = a.Walk(func(z, x, y int, tile []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tile, overlaps, err := prepare(z, x, y, tile)
+		if err != nil {
+			return err
+		}
+		row := (1 << z) - 1 - y
+		if !overlaps {
+			if _, err := insert.ExecContext(ctx, z, x, row, tile); err != nil {
+				return fmt.Errorf("write tile %d/%d/%d: %w", z, x, y, err)
+			}
+			return nil
+		}
+		var existing []byte
+		if err := lookup.QueryRowContext(ctx, z, x, row).Scan(&existing); err != nil {
+			return fmt.Errorf("read tile %d/%d/%d: %w", z, x, y, err)
+		}
+		merged, err := mergeTiles(existing, tile)
+		if err != nil {
+			return fmt.Errorf("merge tile %d/%d/%d: %w", z, x, y, err)
+		}
+		if _, err := update.ExecContext(ctx, merged, z, x, row); err != nil {
+			return fmt.Errorf("write tile %d/%d/%d: %w", z, x, y, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	return nil
+}
+
+// mergeTiles unions the layers of two gzip-compressed vector tiles. Features of a layer in both
+// follow those of a; the layers must share an extent, as tiles of the same tiler do.
+func mergeTiles(a, b []byte) ([]byte, error) {
+	layers, err := mvt.UnmarshalGzipped(a)
+	if err != nil {
+		return nil, err
+	}
+	other, err := mvt.UnmarshalGzipped(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range other {
+		i := slices.IndexFunc(layers, func(l *mvt.Layer) bool { return l.Name == layer.Name })
+		if i < 0 {
+			layers = append(layers, layer)
+			continue
+		}
+		if layers[i].Extent != layer.Extent {
+			return nil, fmt.Errorf("layer %s has extent %d in one archive and %d in another", layer.Name, layers[i].Extent, layer.Extent)
+		}
+		layers[i].Features = append(layers[i].Features, layer.Features...)
+	}
+	return mvt.MarshalGzipped(layers)
+}
+
+func gzipTile(tile []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(tile); err != nil {
+		return nil, fmt.Errorf("compress tile: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress tile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMergedMetadata writes the metadata rows WritePMTiles reads: the zoom range and bounds
+// covering every archive, and the name and format.
+func writeMergedMetadata(db *sql.DB, archives []*PMTilesArchive, merged map[string]any) error {
+	minZoom, maxZoom := MaxTileZoom, 0
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, a := range archives {
+		h := a.Header()
+		minZoom, maxZoom = min(minZoom, h.MinZoom), max(maxZoom, h.MaxZoom)
+		bounds[0], bounds[1] = min(bounds[0], h.Bounds[0]), min(bounds[1], h.Bounds[1])
+		bounds[2], bounds[3] = max(bounds[2], h.Bounds[2]), max(bounds[3], h.Bounds[3])
+	}
+	name, _ := merged["name"].(string)
+	if name == "" {
+		name = "h3"
+	}
+	rows := map[string]string{
+		"name":    name,
+		"format":  "pbf",
+		"minzoom": strconv.Itoa(minZoom),
+		"maxzoom": strconv.Itoa(maxZoom),
+		"bounds":  fmt.Sprintf("%f,%f,%f,%f", bounds[0], bounds[1], bounds[2], bounds[3]),
+	}
+	for name, value := range rows {
+		if _, err := db.Exec(`INSERT INTO metadata (name, value) VALUES (?, ?)`, name, value); err != nil {
+			return fmt.Errorf("write mbtiles metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// vectorLayerMetadata is an entry of the vector_layers metadata.
+type vectorLayerMetadata struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description,omitempty"`
+	Fields      map[string]string `json:"fields"`
+	MinZoom     int               `json:"minzoom"`
+	MaxZoom     int               `json:"maxzoom"`
+}
+
+// tileStatsMetadata is the tilestats metadata object.
+type tileStatsMetadata struct {
+	LayerCount int                    `json:"layerCount"`
+	Layers     []props.TileStatsLayer `json:"layers"`
+}
+
+// mergeMetadata combines the JSON metadata of the archives at paths. The first archive's keys
+// win unless merged here; the hexatiles keys other than stats, such as classification breaks,
+// were computed per input, so differences are reported rather than resolved.
+func mergeMetadata(metadata []map[string]any, paths []string) (map[string]any, []string) {
+	var warnings []string
+	merged := make(map[string]any, len(metadata[0]))
+	var layers []vectorLayerMetadata
+	var tileStats *tileStatsMetadata
+	var hexatiles map[string]any
+	for i, meta := range metadata {
+		for key, value := range meta {
+			var err error
+			switch key {
+			case "vector_layers":
+				layers, err = mergeVectorLayers(layers, value)
+			case "tilestats":
+				tileStats, err = mergeTileStats(tileStats, value)
+			case "hexatiles":
+				own, ok := value.(map[string]any)
+				if !ok {
+					err = fmt.Errorf("not an object")
+					break
+				}
+				if hexatiles == nil {
+					hexatiles = make(map[string]any, len(own))
+				}
+				for _, sub := range mergeHexaTilesMetadata(hexatiles, own) {
+					warnings = append(warnings, fmt.Sprintf("%s: hexatiles.%s differs from the earlier inputs; kept the first", paths[i], sub))
+				}
+			default:
+				if _, ok := merged[key]; !ok {
+					merged[key] = value
+				}
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %s metadata: %v", paths[i], key, err))
+			}
+		}
+	}
+	if layers != nil {
+		merged["vector_layers"] = layers
+	}
+	if tileStats != nil {
+		tileStats.LayerCount = len(tileStats.Layers)
+		merged["tilestats"] = tileStats
+	}
+	if hexatiles != nil {
+		merged["hexatiles"] = hexatiles
+	}
+	return merged, warnings
+}
+
+// mergeVectorLayers adds the layers of value to layers: zoom ranges widen and a field typed
+// differently by two inputs becomes Mixed.
+func mergeVectorLayers(layers []vectorLayerMetadata, value any) ([]vectorLayerMetadata, error) {
+	var more []vectorLayerMetadata
+	if err := remarshal(value, &more); err != nil {
+		return layers, err
+	}
+	for _, layer := range more {
+		i := slices.IndexFunc(layers, func(l vectorLayerMetadata) bool { return l.ID == layer.ID })
+		if i < 0 {
+			layers = append(layers, layer)
+			continue
+		}
+		prev := &layers[i]
+		prev.MinZoom, prev.MaxZoom = min(prev.MinZoom, layer.MinZoom), max(prev.MaxZoom, layer.MaxZoom)
+		if prev.Fields == nil {
+			prev.Fields = make(map[string]string, len(layer.Fields))
+		}
+		for field, kind := range layer.Fields {
+			if current, ok := prev.Fields[field]; ok && current != kind {
+				kind = "Mixed"
+			}
+			prev.Fields[field] = kind
+		}
+	}
+	return layers, nil
+}
+
+// mergeTileStats adds the layers of value to stats with props.MergeTileStatsLayers.
+func mergeTileStats(stats *tileStatsMetadata, value any) (*tileStatsMetadata, error) {
+	var more tileStatsMetadata
+	if err := remarshal(value, &more); err != nil {
+		return stats, err
+	}
+	if stats == nil {
+		return &more, nil
+	}
+	for _, layer := range more.Layers {
+		i := slices.IndexFunc(stats.Layers, func(l props.TileStatsLayer) bool { return l.Layer == layer.Layer })
+		if i < 0 {
+			stats.Layers = append(stats.Layers, layer)
+			continue
+		}
+		stats.Layers[i] = props.MergeTileStatsLayers(stats.Layers[i], layer)
+	}
+	return stats, nil
+}
+
+// mergeHexaTilesMetadata adds the hexatiles metadata of one input to merged. The property
+// statistics are recombined; it returns the other keys whose value differs from merged's.
+func mergeHexaTilesMetadata(merged, own map[string]any) []string {
+	var differing []string
+	for _, key := range slices.Sorted(maps.Keys(own)) {
+		value := own[key]
+		prev, ok := merged[key]
+		switch {
+		case !ok:
+			merged[key] = value
+		case key == "stats":
+			var a, b map[string]props.PropertyStats
+			if remarshal(prev, &a) != nil || remarshal(value, &b) != nil {
+				differing = append(differing, key)
+				continue
+			}
+			for property, st := range b {
+				if current, ok := a[property]; ok {
+					st = props.MergePropertyStats(current, st)
+				}
+				a[property] = st
+			}
+			merged[key] = a
+		case !reflect.DeepEqual(jsonValue(prev), jsonValue(value)):
+			differing = append(differing, key)
+		}
+	}
+	return differing
+}
+
+// jsonValue normalises a metadata value to what encoding/json decodes it as, so values
+// recombined here compare equal to those read from an archive.
+func jsonValue(value any) any {
+	var decoded any
+	if remarshal(value, &decoded) != nil {
+		return value
+	}
+	return decoded
+}
+
+func remarshal(value, out any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+// mergeTileJoin runs tile-join, which reads and writes PMTiles directly since tippecanoe 2.17.
+func mergeTileJoin(ctx context.Context, inputs []string, output string, opts MergeOptions) (MergeResult, error) {
+	binary, err := tileJoinBinary(opts.TileJoinPath)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	args := []string{"--force", "--no-tile-size-limit", "-o", output}
+	if opts.Name != "" {
+		args = append(args, "--name="+opts.Name)
+	}
+	args = append(args, inputs...)
+	result := MergeResult{Command: append([]string{binary}, args...)}
+
+	var log bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stdout = &log
+	cmd.Stderr = &log
+	err = cmd.Run()
+	result.Output = log.String()
+	if err != nil {
+		return result, fmt.Errorf("tile-join failed: %w\n%s", err, strings.TrimSpace(result.Output))
+	}
+	if counts, err := PMTilesTileCounts(output); err == nil {
+		result.Tiles = counts.Addressed
+	}
+	return result, nil
+}
+
+// tileJoinBinary resolves tile-join like NewTippecanoeRunner resolves tippecanoe.
+func tileJoinBinary(pathOverride string) (string, error) {
+	candidate := pathOverride
+	if candidate == "" {
+		candidate = os.Getenv("TILE_JOIN_PATH")
+	}
+	if candidate == "" && FakeToolsEnabled() {
+		fake, err := fakeToolPath("tile-join")
+		if err != nil {
+			return "", err
+		}
+		candidate = fake
+	}
+	if candidate == "" {
+		candidate = "tile-join"
+	}
+	resolved, err := exec.LookPath(candidate)
+	if err != nil {
+		return "", fmt.Errorf("tile-join not found; it ships with tippecanoe (https://github.com/felt/tippecanoe), or use --joiner native")
+	}
+	return resolved, nil
+}
+
+// fakeTileJoin merges with the native joiner, taking the arguments mergeTileJoin passes.
+func fakeTileJoin(ctx context.Context, args []string, stderr io.Writer) error {
+	var output, name string
+	var inputs []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-o" || arg == "--output":
+			if i+1 >= len(args) {
+				return errors.New("-o needs a value")
+			}
+			i++
+			output = args[i]
+		case strings.HasPrefix(arg, "--name="):
+			name = strings.TrimPrefix(arg, "--name=")
+		case strings.HasPrefix(arg, "-"):
+		default:
+			inputs = append(inputs, arg)
+		}
+	}
+	if output == "" || len(inputs) == 0 {
+		return fmt.Errorf("usage: tile-join -o OUTPUT.pmtiles INPUT.pmtiles...")
+	}
+	result, err := mergeNative(ctx, inputs, output, MergeOptions{Name: name})
+	for _, warning := range result.Warnings {
+		fmt.Fprintln(stderr, warning)
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package tiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// metadataLimits bounds the length in bytes of the tileset metadata values, which end up on
+// the tippecanoe command line and in every copy of the archive metadata.
+var metadataLimits = map[string]int{
+	"name":        256,
+	"version":     64,
+	"description": 4096,
+	"attribution": 4096,
+}
+
+// CheckMetadataValue rejects a metadata value that is not valid UTF-8, holds control
+// characters or line separators, or exceeds the length limit of its key. Descriptions and
+// attributions may span lines and contain tabs.
+func CheckMetadataValue(key, value string) error {
+	key = strings.ToLower(key)
+	limit, ok := metadataLimits[key]
+	if !ok {
+		return fmt.Errorf("unknown metadata key %q", key)
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%s is not valid UTF-8", key)
+	}
+	if len(value) > limit {
+		return fmt.Errorf("%s is %d bytes, over the %d byte limit", key, len(value), limit)
+	}
+	multiline := key == "description" || key == "attribution"
+	for i, r := range value {
+		if multiline && (r == '\n' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return fmt.Errorf("%s has disallowed character %U at byte %d", key, r, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,603 @@
+package tiler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+
+	"github.com/hexatiles/hexatiles/internal/ndjson"
+)
+
+// Tilers accepted by the build.
+const (
+	TilerTippecanoe = "tippecanoe"
+	// TilerNative encodes the NDJSON features in-process, so tippecanoe need not be installed.
+	TilerNative = "native"
+)
+
+// Runner turns NDJSON features into a tileset. It returns the tiler's log output and, for
+// external tilers, the exact argument list.
+type Runner interface {
+	Run(ctx context.Context, inputNDJSON, output string, opts TippecanoeOptions) (string, []string, error)
+}
+
+// nativeTileBuffer is how far, in tile extent units, geometry is kept beyond the tile edge. It
+// matches tippecanoe's default buffer of 5 pixels in a 256 pixel tile.
+const nativeTileBuffer = mvt.DefaultExtent * 5 / 256
+
+// NativeTiler generates MVT tiles without external tools. H3 cells are small, simple polygons,
+// so every feature is kept at every zoom of its range unless FeatureLimit thins crowded tiles:
+// the drop strategies of TippecanoeOptions do not apply and the maximum zoom is never extended.
+// A feature's range is the whole tileset unless its "tippecanoe" member narrows it.
+type NativeTiler struct {
+	conservation []ZoomConservation
+}
+
+// NewNativeTiler returns the in-process tiler.
+func NewNativeTiler() *NativeTiler {
+	return &NativeTiler{}
+}
+
+// Run tiles inputNDJSON and any extra layers into output, an MBTiles file or, when output ends
+// in .pmtiles, a PMTiles archive assembled from a temporary MBTiles. The returned log lists the
+// tiles written per zoom; the argument list is always nil.
+func (t *NativeTiler) Run(ctx context.Context, inputNDJSON, output string, opts TippecanoeOptions) (string, []string, error) {
+	if opts.MinZoom < 0 || opts.MaxZoom < opts.MinZoom || opts.MaxZoom > MaxTileZoom {
+		return "", nil, fmt.Errorf("native tiler: invalid zoom range z%d-z%d", opts.MinZoom, opts.MaxZoom)
+	}
+
+	layer := opts.LayerName
+	if layer == "" {
+		layer = "h3"
+	}
+	set := newNativeTileset(opts)
+	if err := set.load(ctx, layer, inputNDJSON); err != nil {
+		return "", nil, err
+	}
+	for _, extra := range opts.ExtraLayers {
+		if err := set.load(ctx, extra.Name, extra.Path); err != nil {
+			return "", nil, err
+		}
+	}
+	set.sortFeatures(opts.SortBy)
+
+	mbtilesPath := output
+	direct := strings.EqualFold(filepath.Ext(output), ".pmtiles")
+	if direct {
+		tmp, err := os.CreateTemp(filepath.Dir(output), ".tiles-*.mbtiles")
+		if err != nil {
+			return "", nil, fmt.Errorf("create temporary mbtiles: %w", err)
+		}
+		tmp.Close()
+		mbtilesPath = tmp.Name()
+		defer os.Remove(mbtilesPath)
+	}
+	if err := os.Remove(mbtilesPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", nil, fmt.Errorf("remove %s: %w", mbtilesPath, err)
+	}
+
+	var log strings.Builder
+	err := set.writeMBTiles(ctx, mbtilesPath, &log)
+	t.conservation = set.conservation
+	if err != nil {
+		return log.String(), nil, err
+	}
+	if direct {
+		if err := ConvertMBTiles(ctx, mbtilesPath, output, nil); err != nil {
+			return log.String(), nil, err
+		}
+	}
+	return log.String(), nil, nil
+}
+
+// Conservation reports, for every zoom the last Run thinned, the features kept and the totals
+// of the conserved properties. It is empty when no FeatureLimit was set.
+func (t *NativeTiler) Conservation() []ZoomConservation {
+	return t.conservation
+}
+
+// nativeFeature is an input feature with its properties already filtered and typed.
+type nativeFeature struct {
+	layer   int
+	feature *geojson.Feature
+	bound   orb.Bound
+	// minZoom and maxZoom come from the feature's "tippecanoe" member; maxZoom is
+	// MaxTileZoom when it sets none.
+	minZoom int
+	maxZoom int
+}
+
+// visible reports whether the feature belongs in tiles of zoom z.
+func (f nativeFeature) visible(z maptile.Zoom) bool {
+	return int(z) >= f.minZoom && int(z) <= f.maxZoom
+}
+
+// featureZooms reads the per-feature zoom range tippecanoe honours, as written for pyramid
+// levels. Lines without a "tippecanoe" member are not decoded twice.
+func featureZooms(line []byte) (int, int, error) {
+	if !bytes.Contains(line, []byte(`"tippecanoe"`)) {
+		return 0, MaxTileZoom, nil
+	}
+	var member struct {
+		Tippecanoe struct {
+			MinZoom *int `json:"minzoom"`
+			MaxZoom *int `json:"maxzoom"`
+		} `json:"tippecanoe"`
+	}
+	if err := json.Unmarshal(line, &member); err != nil {
+		return 0, 0, err
+	}
+	minZoom, maxZoom := 0, MaxTileZoom
+	if member.Tippecanoe.MinZoom != nil {
+		minZoom = *member.Tippecanoe.MinZoom
+	}
+	if member.Tippecanoe.MaxZoom != nil {
+		maxZoom = *member.Tippecanoe.MaxZoom
+	}
+	return minZoom, maxZoom, nil
+}
+
+type nativeTileset struct {
+	opts     TippecanoeOptions
+	keep     map[string]bool
+	layers   []string
+	fields   []map[string]string
+	features []nativeFeature
+	bound    orb.Bound
+	hasBound bool
+	// conservation collects the thinning statistics of each zoom written.
+	conservation []ZoomConservation
+}
+
+func newNativeTileset(opts TippecanoeOptions) *nativeTileset {
+	set := &nativeTileset{opts: opts}
+	if opts.Attributes != nil {
+		set.keep = make(map[string]bool, len(opts.Attributes))
+		for _, attr := range opts.Attributes {
+			set.keep[attr] = true
+		}
+	}
+	return set
+}
+
+// load reads one NDJSON file into a named layer.
+func (s *nativeTileset) load(ctx context.Context, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open NDJSON: %w", err)
+	}
+	defer f.Close()
+
+	layer := len(s.layers)
+	s.layers = append(s.layers, name)
+	s.fields = append(s.fields, make(map[string]string))
+
+	reader := bufio.NewReaderSize(f, 1<<20)
+	for line := 1; ; line++ {
+		if line%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("read %s: %w", path, readErr)
+		}
+		// A GeoJSON text sequence starts every record with the record separator.
+		if trimmed := bytes.TrimSpace(bytes.TrimPrefix(raw, []byte{0x1e})); len(trimmed) > 0 {
+			feature, err := geojson.UnmarshalFeature(trimmed)
+			if err != nil {
+				return fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			minZoom, maxZoom, err := featureZooms(trimmed)
+			if err != nil {
+				return fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			if feature.Geometry != nil {
+				// Read rings in RFC 7946 order, so clipping and simplification start from the same
+				// vertex whichever winding the features were written in.
+				ndjson.Orient(feature.Geometry, ndjson.WindingCCW)
+				s.add(layer, feature, minZoom, maxZoom)
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (s *nativeTileset) add(layer int, feature *geojson.Feature, minZoom, maxZoom int) {
+	properties := make(geojson.Properties, len(feature.Properties))
+	for key, value := range feature.Properties {
+		// tippecanoe omits null attributes rather than encoding them.
+		if value == nil || (s.keep != nil && !s.keep[key]) {
+			continue
+		}
+		value = coerceAttribute(value, s.opts.AttributeTypes[key])
+		properties[key] = value
+		s.fields[layer][key] = mergeFieldType(s.fields[layer][key], value)
+	}
+	feature.Properties = properties
+	feature.BBox = nil
+
+	bound := feature.Geometry.Bound()
+	if s.hasBound {
+		s.bound = s.bound.Union(bound)
+	} else {
+		s.bound, s.hasBound = bound, true
+	}
+	s.features = append(s.features, nativeFeature{layer: layer, feature: feature, bound: bound, minZoom: minZoom, maxZoom: maxZoom})
+}
+
+// sortFeatures orders each layer by the sort attribute, like tippecanoe's --order-by, so tiles
+// are identical across builds whatever order the encode workers wrote the features in.
+func (s *nativeTileset) sortFeatures(sortBy string) {
+	if sortBy == "" {
+		sortBy = "h3"
+	}
+	sort.SliceStable(s.features, func(i, j int) bool {
+		a, b := s.features[i], s.features[j]
+		if a.layer != b.layer {
+			return a.layer < b.layer
+		}
+		return fmt.Sprint(a.feature.Properties[sortBy]) < fmt.Sprint(b.feature.Properties[sortBy])
+	})
+}
+
+// coerceAttribute applies a tippecanoe --attribute-type to a decoded JSON value.
+func coerceAttribute(value any, kind string) any {
+	switch kind {
+	case "int":
+		if f, ok := value.(float64); ok {
+			return int64(math.Round(f))
+		}
+	case "float":
+		if f, ok := value.(float64); ok {
+			return f
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Sprint(value)
+		}
+	case "bool":
+		if f, ok := value.(float64); ok {
+			return f != 0
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		// Integral JSON numbers are stored as integers, as tippecanoe does.
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	case map[string]any, []any:
+		encoded, err := json.Marshal(v)
+		if err == nil {
+			return string(encoded)
+		}
+	}
+	return value
+}
+
+// mergeFieldType folds a value into the vector_layers field type seen so far.
+func mergeFieldType(current string, value any) string {
+	var kind string
+	switch value.(type) {
+	case string:
+		kind = "String"
+	case bool:
+		kind = "Boolean"
+	default:
+		kind = "Number"
+	}
+	if current == "" || current == kind {
+		return kind
+	}
+	return "Mixed"
+}
+
+// writeMBTiles encodes every zoom into a new MBTiles file at path.
+func (s *nativeTileset) writeMBTiles(ctx context.Context, path string, log io.Writer) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+	if err := createMBTiles(db); err != nil {
+		return err
+	}
+
+	for z := s.opts.MinZoom; z <= s.opts.MaxZoom; z++ {
+		written, err := s.writeZoom(ctx, db, maptile.Zoom(z))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "z%d: %d tiles", z, written)
+		if n := len(s.conservation); n > 0 && s.conservation[n-1].Zoom == z {
+			fmt.Fprintf(log, ", %d of %d features kept", s.conservation[n-1].Kept, s.conservation[n-1].Features)
+		}
+		fmt.Fprintln(log)
+	}
+	fmt.Fprintf(log, "%d features in %d layers\n", len(s.features), len(s.layers))
+
+	return s.writeMetadata(db)
+}
+
+// createMBTiles creates the metadata and tiles tables of an empty MBTiles file.
+func createMBTiles(db *sql.DB) error {
+	for _, stmt := range []string{
+		`CREATE TABLE metadata (name text, value text)`,
+		`CREATE UNIQUE INDEX name ON metadata (name)`,
+		`CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob)`,
+		`CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("create mbtiles: %w", err)
+		}
+	}
+	return nil
+}
+
+type encodedTile struct {
+	tile maptile.Tile
+	data []byte
+	err  error
+}
+
+// writeZoom encodes the tiles of one zoom on the configured number of workers and inserts them
+// in a single transaction.
+func (s *nativeTileset) writeZoom(ctx context.Context, db *sql.DB, zoom maptile.Zoom) (int, error) {
+	// The deepest zoom always carries every feature, as with tippecanoe's drop strategies.
+	var thinning *zoomThinning
+	if s.opts.FeatureLimit > 0 && int(zoom) < s.opts.MaxZoom {
+		var stats ZoomConservation
+		thinning, stats = s.thin(zoom)
+		s.conservation = append(s.conservation, stats)
+	}
+
+	members := make(map[maptile.Tile][]int32)
+	for i, f := range s.features {
+		if !f.visible(zoom) || (thinning != nil && thinning.dropped != nil && thinning.dropped[i]) {
+			continue
+		}
+		x0, y0 := lonLatToTile(f.bound.Min[0], f.bound.Max[1], int(zoom))
+		x1, y1 := lonLatToTile(f.bound.Max[0], f.bound.Min[1], int(zoom))
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				tile := maptile.New(uint32(x), uint32(y), zoom)
+				members[tile] = append(members[tile], int32(i))
+			}
+		}
+	}
+	tiles := make([]maptile.Tile, 0, len(members))
+	for tile := range members {
+		tiles = append(tiles, tile)
+	}
+	sort.Slice(tiles, func(i, j int) bool {
+		if tiles[i].X != tiles[j].X {
+			return tiles[i].X < tiles[j].X
+		}
+		return tiles[i].Y < tiles[j].Y
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	threads := s.opts.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	jobs := make(chan maptile.Tile)
+	results := make(chan encodedTile, threads*2)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range jobs {
+				data, err := s.encodeTile(tile, members[tile], thinning)
+				select {
+				case results <- encodedTile{tile: tile, data: data, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, tile := range tiles {
+			select {
+			case jobs <- tile:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare(`INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	defer insert.Close()
+
+	written := 0
+	for res := range results {
+		if res.err != nil {
+			cancel()
+			return 0, fmt.Errorf("encode tile %d/%d/%d: %w", res.tile.Z, res.tile.X, res.tile.Y, res.err)
+		}
+		if res.data == nil {
+			continue
+		}
+		// MBTiles rows use TMS numbering, with y counted from the south.
+		row := (1 << zoom) - 1 - int(res.tile.Y)
+		if _, err := insert.Exec(int(zoom), int(res.tile.X), row, res.data); err != nil {
+			cancel()
+			return 0, fmt.Errorf("write mbtiles tiles: %w", err)
+		}
+		written++
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("write mbtiles tiles: %w", err)
+	}
+	return written, nil
+}
+
+// encodeTile projects, clips and encodes the member features of a tile. It returns nil when no
+// geometry is left inside the tile.
+func (s *nativeTileset) encodeTile(tile maptile.Tile, members []int32, thinning *zoomThinning) ([]byte, error) {
+	clipBound := orb.Bound{
+		Min: orb.Point{-nativeTileBuffer, -nativeTileBuffer},
+		Max: orb.Point{mvt.DefaultExtent + nativeTileBuffer, mvt.DefaultExtent + nativeTileBuffer},
+	}
+
+	layers := make(mvt.Layers, len(s.layers))
+	for i, name := range s.layers {
+		layers[i] = &mvt.Layer{Name: name, Version: 2, Extent: mvt.DefaultExtent}
+	}
+	for _, i := range members {
+		f := s.features[i]
+		clone := geojson.NewFeature(orb.Clone(f.feature.Geometry))
+		clone.ID = f.feature.ID
+		clone.Properties = f.feature.Properties
+		if thinning != nil {
+			if merged, ok := thinning.properties[i]; ok {
+				clone.Properties = merged
+			}
+		}
+		layers[f.layer].Features = append(layers[f.layer].Features, clone)
+	}
+
+	layers.ProjectToTile(tile)
+	layers.Clip(clipBound)
+	if s.opts.Simplify {
+		layers.Simplify(simplify.DouglasPeucker(1))
+	}
+
+	kept := layers[:0]
+	for _, layer := range layers {
+		if len(layer.Features) == 0 {
+			continue
+		}
+		for _, f := range layer.Features {
+			f.Geometry = orientForMVT(f.Geometry)
+		}
+		kept = append(kept, layer)
+	}
+	if len(kept) == 0 {
+		return nil, nil
+	}
+	return mvt.MarshalGzipped(kept)
+}
+
+// orientForMVT winds exterior rings clockwise and holes counter-clockwise on screen, as the MVT
+// specification requires. In tile coordinates y grows downwards, so a clockwise ring has a
+// positive shoelace area, which orb reports as orb.CCW.
+func orientForMVT(g orb.Geometry) orb.Geometry {
+	switch g := g.(type) {
+	case orb.Polygon:
+		for i, ring := range g {
+			exterior := i == 0
+			if (ring.Orientation() == orb.CCW) != exterior {
+				ring.Reverse()
+			}
+		}
+	case orb.MultiPolygon:
+		for _, p := range g {
+			orientForMVT(p)
+		}
+	}
+	return g
+}
+
+// writeMetadata fills the metadata table the way tippecanoe does, including the vector_layers
+// description in the "json" row.
+func (s *nativeTileset) writeMetadata(db *sql.DB) error {
+	type vectorLayer struct {
+		ID      string            `json:"id"`
+		Fields  map[string]string `json:"fields"`
+		MinZoom int               `json:"minzoom"`
+		MaxZoom int               `json:"maxzoom"`
+	}
+	layers := make([]vectorLayer, len(s.layers))
+	for i, name := range s.layers {
+		layers[i] = vectorLayer{ID: name, Fields: s.fields[i], MinZoom: s.opts.MinZoom, MaxZoom: s.opts.MaxZoom}
+	}
+	encoded, err := json.Marshal(map[string]any{"vector_layers": layers})
+	if err != nil {
+		return fmt.Errorf("encode mbtiles metadata: %w", err)
+	}
+
+	bound := s.bound
+	if !s.hasBound {
+		bound = orb.Bound{Min: orb.Point{-180, -webMercatorMaxLat}, Max: orb.Point{180, webMercatorMaxLat}}
+	}
+	center := bound.Center()
+	rows := map[string]string{
+		"name":      "h3",
+		"format":    "pbf",
+		"type":      "overlay",
+		"generator": "hexatiles native tiler",
+		"minzoom":   strconv.Itoa(s.opts.MinZoom),
+		"maxzoom":   strconv.Itoa(s.opts.MaxZoom),
+		"bounds":    fmt.Sprintf("%f,%f,%f,%f", bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]),
+		"center":    fmt.Sprintf("%f,%f,%d", center[0], center[1], s.opts.MaxZoom),
+		"json":      string(encoded),
+	}
+	for key, value := range s.opts.Metadata {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		switch key = strings.ToLower(key); key {
+		case "name", "description", "attribution", "version":
+			rows[key] = value
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("write mbtiles metadata: %w", err)
+	}
+	defer tx.Rollback()
+	for name, value := range rows {
+		if _, err := tx.Exec(`INSERT INTO metadata (name, value) VALUES (?, ?)`, name, value); err != nil {
+			return fmt.Errorf("write mbtiles metadata: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("write mbtiles metadata: %w", err)
+	}
+	return nil
+}
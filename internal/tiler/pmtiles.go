@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // PMTilesConverter wraps the pmtiles CLI for MBTiles→PMTiles conversion and inspection.
@@ -14,12 +15,20 @@ type PMTilesConverter struct {
 	Binary string
 }
 
-// NewPMTilesConverter resolves the pmtiles binary from PATH or explicit override.
+// NewPMTilesConverter resolves the pmtiles binary from PATH or explicit override, or uses the
+// fake tools stub like NewTippecanoeRunner.
 func NewPMTilesConverter(pathOverride string) (*PMTilesConverter, error) {
 	candidate := pathOverride
 	if candidate == "" {
 		candidate = os.Getenv("PMTILES_PATH")
 	}
+	if candidate == "" && FakeToolsEnabled() {
+		fake, err := fakeToolPath("pmtiles")
+		if err != nil {
+			return nil, err
+		}
+		candidate = fake
+	}
 	if candidate == "" {
 		candidate = "pmtiles"
 	}
@@ -32,6 +41,14 @@ func NewPMTilesConverter(pathOverride string) (*PMTilesConverter, error) {
 	return &PMTilesConverter{Binary: resolved}, nil
 }
 
+// Version returns the first line of `pmtiles version`, or "" when it cannot be run.
+func (c *PMTilesConverter) Version(ctx context.Context) string {
+	if c == nil || c.Binary == "" {
+		return ""
+	}
+	return commandVersion(ctx, c.Binary, "version")
+}
+
 // Convert invokes `pmtiles convert` and returns combined stdout/stderr output.
 func (c *PMTilesConverter) Convert(ctx context.Context, inputMBTiles, outputPMTiles string) (string, error) {
 	if c == nil || c.Binary == "" {
@@ -74,3 +91,16 @@ func (c *PMTilesConverter) Info(ctx context.Context, pmtilesPath string) (map[st
 
 	return data, output.String(), nil
 }
+
+// commandVersion runs a version subcommand, which some tools print to stderr.
+func commandVersion(ctx context.Context, binary string, args ...string) string {
+	cmd := exec.CommandContext(ctx, binary, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(output.String()), "\n")
+	return strings.TrimSpace(line)
+}
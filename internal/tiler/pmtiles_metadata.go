@@ -0,0 +1,185 @@
+package tiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// PMTiles v3 header layout (https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md).
+const (
+	pmtilesHeaderLen       = 127
+	pmtilesRootOffset      = 8
+	pmtilesMetadataOffset  = 24
+	pmtilesLeafOffset      = 40
+	pmtilesTileDataOffset  = 56
+	pmtilesCompressionByte = 97
+
+	pmtilesCompressionNone = 1
+	pmtilesCompressionGzip = 2
+)
+
+// MergeMetadata adds the top-level keys of extra to the JSON metadata of a PMTiles v3 archive,
+// rewriting the file in place. The pmtiles CLI cannot set arbitrary keys, so the archive is
+// re-laid out as header, root directory, metadata, leaf directories and tile data.
+func MergeMetadata(path string, extra map[string]any) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open pmtiles: %w", err)
+	}
+	defer src.Close()
+
+	header := make([]byte, pmtilesHeaderLen)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return fmt.Errorf("read pmtiles header: %w", err)
+	}
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		return fmt.Errorf("%s is not a PMTiles v3 archive", path)
+	}
+
+	root := readSection(header, pmtilesRootOffset)
+	meta := readSection(header, pmtilesMetadataOffset)
+	leaves := readSection(header, pmtilesLeafOffset)
+	tiles := readSection(header, pmtilesTileDataOffset)
+	compression := header[pmtilesCompressionByte]
+
+	raw := make([]byte, meta.length)
+	if _, err := src.ReadAt(raw, int64(meta.offset)); err != nil {
+		return fmt.Errorf("read pmtiles metadata: %w", err)
+	}
+	decoded, err := decompressMetadata(raw, compression)
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]any)
+	if len(bytes.TrimSpace(decoded)) > 0 {
+		if err := json.Unmarshal(decoded, &metadata); err != nil {
+			return fmt.Errorf("decode pmtiles metadata: %w", err)
+		}
+	}
+	for key, value := range extra {
+		metadata[key] = value
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("encode pmtiles metadata: %w", err)
+	}
+	encoded, err = compressMetadata(encoded, compression)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pmtiles-*")
+	if err != nil {
+		return fmt.Errorf("create temporary archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	offset := uint64(pmtilesHeaderLen)
+	newRoot := section{offset, root.length}
+	offset += root.length
+	newMeta := section{offset, uint64(len(encoded))}
+	offset += newMeta.length
+	newLeaves := section{offset, leaves.length}
+	offset += leaves.length
+	newTiles := section{offset, tiles.length}
+
+	writeSection(header, pmtilesRootOffset, newRoot)
+	writeSection(header, pmtilesMetadataOffset, newMeta)
+	writeSection(header, pmtilesLeafOffset, newLeaves)
+	writeSection(header, pmtilesTileDataOffset, newTiles)
+
+	if _, err := tmp.Write(header); err != nil {
+		return fmt.Errorf("write pmtiles header: %w", err)
+	}
+	if err := copySection(tmp, src, root); err != nil {
+		return err
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		return fmt.Errorf("write pmtiles metadata: %w", err)
+	}
+	if err := copySection(tmp, src, leaves); err != nil {
+		return err
+	}
+	if err := copySection(tmp, src, tiles); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return fmt.Errorf("chmod temporary archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary archive: %w", err)
+	}
+	src.Close()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace pmtiles archive: %w", err)
+	}
+	return nil
+}
+
+type section struct {
+	offset uint64
+	length uint64
+}
+
+func readSection(header []byte, at int) section {
+	return section{
+		offset: binary.LittleEndian.Uint64(header[at:]),
+		length: binary.LittleEndian.Uint64(header[at+8:]),
+	}
+}
+
+func writeSection(header []byte, at int, s section) {
+	binary.LittleEndian.PutUint64(header[at:], s.offset)
+	binary.LittleEndian.PutUint64(header[at+8:], s.length)
+}
+
+func copySection(dst io.Writer, src io.ReaderAt, s section) error {
+	if _, err := io.Copy(dst, io.NewSectionReader(src, int64(s.offset), int64(s.length))); err != nil {
+		return fmt.Errorf("copy pmtiles section: %w", err)
+	}
+	return nil
+}
+
+func decompressMetadata(raw []byte, compression byte) ([]byte, error) {
+	switch compression {
+	case pmtilesCompressionNone:
+		return raw, nil
+	case pmtilesCompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("decompress pmtiles metadata: %w", err)
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("decompress pmtiles metadata: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported pmtiles internal compression %d", compression)
+	}
+}
+
+func compressMetadata(data []byte, compression byte) ([]byte, error) {
+	if compression == pmtilesCompressionNone {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("compress pmtiles metadata: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress pmtiles metadata: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,358 @@
+package tiler
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+)
+
+// pmtilesMaxDepth bounds the directory levels followed for one tile; the spec allows a root
+// and at most a few levels of leaves, so deeper nesting means a corrupt archive.
+const pmtilesMaxDepth = 4
+
+// PMTilesArchive reads tiles and metadata from a PMTiles v3 archive. It is safe for concurrent
+// use.
+type PMTilesArchive struct {
+	f      pmtilesFile
+	size   int64
+	header []byte
+	root   []pmtilesEntry
+
+	mu     sync.Mutex
+	leaves map[uint64][]pmtilesEntry
+}
+
+// PMTilesHeader holds the header fields that describe the tileset.
+type PMTilesHeader struct {
+	MinZoom int
+	MaxZoom int
+	// Bounds is west, south, east, north; Center is longitude, latitude, zoom.
+	Bounds [4]float64
+	Center [3]float64
+	// TileType is mvt, png, jpeg, webp, avif or unknown.
+	TileType string
+	// TileGzip reports whether the stored tiles are gzip-compressed.
+	TileGzip bool
+}
+
+// pmtilesFile is the storage an archive is read from: a local file or an objstore.Object.
+type pmtilesFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// OpenPMTiles opens a local archive and reads its root directory.
+func OpenPMTiles(path string) (*PMTilesArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open pmtiles: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open pmtiles: %w", err)
+	}
+	return openPMTiles(path, f, info.Size())
+}
+
+// OpenPMTilesObject opens an archive on local disk or in object storage, as objstore.Open
+// does, so a remote archive is read with HTTP range requests for the directories and tiles
+// used.
+func OpenPMTilesObject(ctx context.Context, path string) (*PMTilesArchive, error) {
+	obj, err := objstore.Open(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("open pmtiles: %w", err)
+	}
+	return openPMTiles(path, obj, obj.Size())
+}
+
+func openPMTiles(path string, f pmtilesFile, size int64) (*PMTilesArchive, error) {
+	header := make([]byte, pmtilesHeaderLen)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read pmtiles header: %w", err)
+	}
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a PMTiles v3 archive", path)
+	}
+	a := &PMTilesArchive{f: f, size: size, header: header, leaves: make(map[uint64][]pmtilesEntry)}
+	var err error
+	if a.root, err = a.readDirectory(readSection(header, pmtilesRootOffset)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close closes the archive file.
+func (a *PMTilesArchive) Close() error {
+	return a.f.Close()
+}
+
+// Contents reads the whole archive file, for serving it to clients that fetch byte ranges
+// themselves.
+func (a *PMTilesArchive) Contents() *io.SectionReader {
+	return io.NewSectionReader(a.f, 0, a.size)
+}
+
+// Header returns the tileset fields of the archive header.
+func (a *PMTilesArchive) Header() PMTilesHeader {
+	e7 := func(at int) float64 { return float64(int32(binary.LittleEndian.Uint32(a.header[at:]))) / 1e7 }
+	tileType := map[byte]string{1: "mvt", 2: "png", 3: "jpeg", 4: "webp", 5: "avif"}[a.header[pmtilesTileTypeByte]]
+	if tileType == "" {
+		tileType = "unknown"
+	}
+	return PMTilesHeader{
+		MinZoom:  int(a.header[pmtilesMinZoomOffset]),
+		MaxZoom:  int(a.header[pmtilesMaxZoomOffset]),
+		Bounds:   [4]float64{e7(pmtilesBoundsOffset), e7(pmtilesBoundsOffset + 4), e7(pmtilesBoundsOffset + 8), e7(pmtilesBoundsOffset + 12)},
+		Center:   [3]float64{e7(pmtilesCenterOffset), e7(pmtilesCenterOffset + 4), float64(a.header[pmtilesCenterZoomOffset])},
+		TileType: tileType,
+		TileGzip: a.header[pmtilesTileCompression] == pmtilesCompressionGzip,
+	}
+}
+
+// Metadata decodes the JSON metadata of the archive.
+func (a *PMTilesArchive) Metadata() (map[string]any, error) {
+	meta := readSection(a.header, pmtilesMetadataOffset)
+	raw := make([]byte, meta.length)
+	if _, err := a.f.ReadAt(raw, int64(meta.offset)); err != nil {
+		return nil, fmt.Errorf("read pmtiles metadata: %w", err)
+	}
+	decoded, err := decompressMetadata(raw, a.header[pmtilesCompressionByte])
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]any)
+	if len(decoded) > 0 {
+		if err := json.Unmarshal(decoded, &metadata); err != nil {
+			return nil, fmt.Errorf("decode pmtiles metadata: %w", err)
+		}
+	}
+	return metadata, nil
+}
+
+// Tile returns the stored bytes of a tile, compressed as Header().TileGzip says, or nil when
+// the archive does not address it.
+func (a *PMTilesArchive) Tile(z, x, y int) ([]byte, error) {
+	entry, ok, err := a.entry(z, x, y)
+	if err != nil || !ok {
+		return nil, err
+	}
+	data := readSection(a.header, pmtilesTileDataOffset)
+	tile := make([]byte, entry.Length)
+	if _, err := a.f.ReadAt(tile, int64(data.offset+entry.Offset)); err != nil {
+		return nil, fmt.Errorf("read tile %d/%d/%d: %w", z, x, y, err)
+	}
+	return tile, nil
+}
+
+// Has reports whether the archive addresses a tile, without reading it.
+func (a *PMTilesArchive) Has(z, x, y int) (bool, error) {
+	_, ok, err := a.entry(z, x, y)
+	return ok, err
+}
+
+// entry returns the directory entry of the run holding a tile.
+func (a *PMTilesArchive) entry(z, x, y int) (pmtilesEntry, bool, error) {
+	if z < 0 || z > MaxTileZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return pmtilesEntry{}, false, nil
+	}
+	id := zxyToTileID(uint8(z), uint32(x), uint32(y))
+	entries := a.root
+	for depth := 0; depth < pmtilesMaxDepth; depth++ {
+		entry, ok := findEntry(entries, id)
+		if !ok {
+			return pmtilesEntry{}, false, nil
+		}
+		if entry.RunLength > 0 {
+			return entry, true, nil
+		}
+		leaf, err := a.leaf(entry)
+		if err != nil {
+			return pmtilesEntry{}, false, err
+		}
+		entries = leaf
+	}
+	return pmtilesEntry{}, false, fmt.Errorf("read tile %d/%d/%d: directories nested deeper than %d levels", z, x, y, pmtilesMaxDepth)
+}
+
+// Layers decodes a vector tile of the archive, or returns nil when the archive does not
+// address it.
+func (a *PMTilesArchive) Layers(z, x, y int) (mvt.Layers, error) {
+	h := a.Header()
+	if h.TileType != "mvt" {
+		return nil, fmt.Errorf("archive holds %s tiles, not vector tiles", h.TileType)
+	}
+	tile, err := a.Tile(z, x, y)
+	if err != nil || tile == nil {
+		return nil, err
+	}
+	var layers mvt.Layers
+	if h.TileGzip {
+		layers, err = mvt.UnmarshalGzipped(tile)
+	} else {
+		layers, err = mvt.Unmarshal(tile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode tile %d/%d/%d: %w", z, x, y, err)
+	}
+	return layers, nil
+}
+
+// Walk calls fn with every tile the archive addresses, in tile ID order, and its stored bytes,
+// compressed as Header().TileGzip says. Tiles of a run share the same slice.
+func (a *PMTilesArchive) Walk(fn func(z, x, y int, tile []byte) error) error {
+	return a.walk(a.root, 0, 0, math.MaxUint64, fn)
+}
+
+// WalkZoom is Walk restricted to the tiles of zoom z. Tile IDs are ordered by zoom, so the
+// directories and tiles of other zooms are not read.
+func (a *PMTilesArchive) WalkZoom(z int, fn func(z, x, y int, tile []byte) error) error {
+	if z < 0 || z > MaxTileZoom {
+		return nil
+	}
+	hi := uint64(math.MaxUint64)
+	if z < MaxTileZoom {
+		hi = zxyToTileID(uint8(z+1), 0, 0)
+	}
+	return a.walk(a.root, 0, zxyToTileID(uint8(z), 0, 0), hi, fn)
+}
+
+// walk visits the tiles with IDs in [lo, hi) under entries.
+func (a *PMTilesArchive) walk(entries []pmtilesEntry, depth int, lo, hi uint64, fn func(z, x, y int, tile []byte) error) error {
+	if depth >= pmtilesMaxDepth {
+		return fmt.Errorf("walk pmtiles: directories nested deeper than %d levels", pmtilesMaxDepth)
+	}
+	data := readSection(a.header, pmtilesTileDataOffset)
+	for i, entry := range entries {
+		if entry.TileID >= hi {
+			break
+		}
+		if entry.RunLength == 0 {
+			// A leaf holds the IDs up to the next entry's.
+			if i+1 < len(entries) && entries[i+1].TileID <= lo {
+				continue
+			}
+			leaf, err := a.leaf(entry)
+			if err != nil {
+				return err
+			}
+			if err := a.walk(leaf, depth+1, lo, hi, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		first, end := max(entry.TileID, lo), min(entry.TileID+uint64(entry.RunLength), hi)
+		if first >= end {
+			continue
+		}
+		tile := make([]byte, entry.Length)
+		if _, err := a.f.ReadAt(tile, int64(data.offset+entry.Offset)); err != nil {
+			return fmt.Errorf("read tile %d: %w", entry.TileID, err)
+		}
+		for id := first; id < end; id++ {
+			z, x, y := tileIDToZxy(id)
+			if err := fn(int(z), int(x), int(y), tile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findEntry returns the entry covering id: the last one starting at or before it, if its run
+// reaches id or it points to a leaf directory.
+func findEntry(entries []pmtilesEntry, id uint64) (pmtilesEntry, bool) {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].TileID > id }) - 1
+	if i < 0 {
+		return pmtilesEntry{}, false
+	}
+	e := entries[i]
+	if e.RunLength == 0 || id < e.TileID+uint64(e.RunLength) {
+		return e, true
+	}
+	return pmtilesEntry{}, false
+}
+
+func (a *PMTilesArchive) leaf(entry pmtilesEntry) ([]pmtilesEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if leaf, ok := a.leaves[entry.Offset]; ok {
+		return leaf, nil
+	}
+	leaves := readSection(a.header, pmtilesLeafOffset)
+	leaf, err := a.readDirectory(section{leaves.offset + entry.Offset, uint64(entry.Length)})
+	if err != nil {
+		return nil, err
+	}
+	a.leaves[entry.Offset] = leaf
+	return leaf, nil
+}
+
+// readDirectory decodes the directory serializeDirectory writes.
+func (a *PMTilesArchive) readDirectory(s section) ([]pmtilesEntry, error) {
+	raw := make([]byte, s.length)
+	if _, err := a.f.ReadAt(raw, int64(s.offset)); err != nil {
+		return nil, fmt.Errorf("read pmtiles directory: %w", err)
+	}
+	decoded, err := decompressMetadata(raw, a.header[pmtilesCompressionByte])
+	if err != nil {
+		return nil, fmt.Errorf("pmtiles directory: %w", err)
+	}
+	r := &uvarintReader{buf: decoded}
+	n := r.next()
+	if n > uint64(len(decoded)) {
+		return nil, fmt.Errorf("pmtiles directory claims %d entries in %d bytes", n, len(decoded))
+	}
+	entries := make([]pmtilesEntry, n)
+	var lastID uint64
+	for i := range entries {
+		lastID += r.next()
+		entries[i].TileID = lastID
+	}
+	for i := range entries {
+		entries[i].RunLength = uint32(r.next())
+	}
+	for i := range entries {
+		entries[i].Length = uint32(r.next())
+	}
+	for i := range entries {
+		offset := r.next()
+		if offset == 0 && i > 0 {
+			entries[i].Offset = entries[i-1].Offset + uint64(entries[i-1].Length)
+		} else {
+			entries[i].Offset = offset - 1
+		}
+	}
+	if r.err {
+		return nil, fmt.Errorf("pmtiles directory is truncated")
+	}
+	return entries, nil
+}
+
+type uvarintReader struct {
+	buf []byte
+	err bool
+}
+
+func (r *uvarintReader) next() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
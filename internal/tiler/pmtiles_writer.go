@@ -0,0 +1,338 @@
+package tiler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// PMTiles v3 header fields written by ConvertMBTiles in addition to the section offsets.
+const (
+	pmtilesTileEntriesOffset = 80
+	pmtilesClusteredByte     = 96
+	pmtilesTileCompression   = 98
+	pmtilesTileTypeByte      = 99
+	pmtilesCenterZoomOffset  = 118
+	pmtilesCenterOffset      = 119
+
+	pmtilesTileTypeMVT = 1
+
+	// pmtilesRootMaxLen keeps the header and root directory within the first 16 KiB, which
+	// clients fetch in one request.
+	pmtilesRootMaxLen = 16384 - pmtilesHeaderLen
+)
+
+// pmtilesEntry is a directory entry. RunLength 0 marks a pointer to a leaf directory.
+type pmtilesEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint32
+	RunLength uint32
+}
+
+// ConvertMBTiles writes the gzip-compressed vector tiles of an MBTiles file to a PMTiles v3
+// archive, like `pmtiles convert`: identical tiles are stored once, and the metadata rows become
+// the archive's JSON metadata with the "json" row lifted to the top level. The top-level keys of
+// extra are added to that metadata, so no MergeMetadata rewrite is needed afterwards.
+func ConvertMBTiles(ctx context.Context, mbtilesPath, pmtilesPath string, extra map[string]any) error {
+	out, err := os.Create(pmtilesPath)
+	if err != nil {
+		return fmt.Errorf("create pmtiles: %w", err)
+	}
+	defer out.Close()
+	if err := WritePMTiles(ctx, mbtilesPath, out, extra); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close pmtiles: %w", err)
+	}
+	return nil
+}
+
+// WritePMTiles writes the archive ConvertMBTiles would create to w. The archive is written
+// front to back, so w can be a pipe.
+func WritePMTiles(ctx context.Context, mbtilesPath string, out io.Writer, extra map[string]any) error {
+	db, err := sql.Open("sqlite", mbtilesPath)
+	if err != nil {
+		return fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	bounds, minZoom, maxZoom, err := mbtilesExtent(db)
+	if err != nil {
+		return err
+	}
+	metadata, err := MBTilesInfo(mbtilesPath)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"bounds", "center", "minzoom", "maxzoom", "format"} {
+		delete(metadata, key)
+	}
+	for key, value := range extra {
+		metadata[key] = value
+	}
+	encodedMeta, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("encode pmtiles metadata: %w", err)
+	}
+	encodedMeta, err = compressMetadata(encodedMeta, pmtilesCompressionGzip)
+	if err != nil {
+		return err
+	}
+
+	// First pass: learn every tile's ID, length and content hash without keeping the data.
+	type tileRef struct {
+		id   uint64
+		z    int
+		x    int
+		row  int
+		hash [sha256.Size]byte
+		size uint32
+	}
+	rows, err := db.QueryContext(ctx, `SELECT zoom_level, tile_column, tile_row, tile_data FROM tiles`)
+	if err != nil {
+		return fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	var refs []tileRef
+	for rows.Next() {
+		var ref tileRef
+		var data []byte
+		if err := rows.Scan(&ref.z, &ref.x, &ref.row, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("read mbtiles tiles: %w", err)
+		}
+		y := (1 << ref.z) - 1 - ref.row
+		ref.id = zxyToTileID(uint8(ref.z), uint32(ref.x), uint32(y))
+		ref.hash = sha256.Sum256(data)
+		ref.size = uint32(len(data))
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	rows.Close()
+	sort.Slice(refs, func(i, j int) bool { return refs[i].id < refs[j].id })
+
+	// Lay out the tile data in tile ID order, storing each distinct payload at its first use.
+	offsets := make(map[[sha256.Size]byte]uint64)
+	entries := make([]pmtilesEntry, 0, len(refs))
+	var unique []tileRef
+	var dataLen uint64
+	for _, ref := range refs {
+		offset, seen := offsets[ref.hash]
+		if !seen {
+			offset = dataLen
+			offsets[ref.hash] = offset
+			dataLen += uint64(ref.size)
+			unique = append(unique, ref)
+		}
+		if n := len(entries); n > 0 {
+			last := &entries[n-1]
+			if last.Offset == offset && last.TileID+uint64(last.RunLength) == ref.id {
+				last.RunLength++
+				continue
+			}
+		}
+		entries = append(entries, pmtilesEntry{TileID: ref.id, Offset: offset, Length: ref.size, RunLength: 1})
+	}
+
+	root, leaves, err := buildDirectories(entries)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, pmtilesHeaderLen)
+	copy(header, "PMTiles")
+	header[7] = 3
+	offset := uint64(pmtilesHeaderLen)
+	writeSection(header, pmtilesRootOffset, section{offset, uint64(len(root))})
+	offset += uint64(len(root))
+	writeSection(header, pmtilesMetadataOffset, section{offset, uint64(len(encodedMeta))})
+	offset += uint64(len(encodedMeta))
+	writeSection(header, pmtilesLeafOffset, section{offset, uint64(len(leaves))})
+	offset += uint64(len(leaves))
+	writeSection(header, pmtilesTileDataOffset, section{offset, dataLen})
+	binary.LittleEndian.PutUint64(header[pmtilesAddressedTilesOffset:], uint64(len(refs)))
+	binary.LittleEndian.PutUint64(header[pmtilesTileEntriesOffset:], uint64(len(entries)))
+	binary.LittleEndian.PutUint64(header[pmtilesTileContentsOffset:], uint64(len(unique)))
+	header[pmtilesClusteredByte] = 1
+	header[pmtilesCompressionByte] = pmtilesCompressionGzip
+	header[pmtilesTileCompression] = pmtilesCompressionGzip
+	header[pmtilesTileTypeByte] = pmtilesTileTypeMVT
+	header[pmtilesMinZoomOffset] = byte(minZoom)
+	header[pmtilesMaxZoomOffset] = byte(maxZoom)
+	for i, v := range bounds {
+		binary.LittleEndian.PutUint32(header[pmtilesBoundsOffset+4*i:], uint32(int32(v*1e7)))
+	}
+	header[pmtilesCenterZoomOffset] = byte(maxZoom)
+	binary.LittleEndian.PutUint32(header[pmtilesCenterOffset:], uint32(int32((bounds[0]+bounds[2])/2*1e7)))
+	binary.LittleEndian.PutUint32(header[pmtilesCenterOffset+4:], uint32(int32((bounds[1]+bounds[3])/2*1e7)))
+
+	w := bufio.NewWriterSize(out, 1<<20)
+	for _, part := range [][]byte{header, root, encodedMeta, leaves} {
+		if _, err := w.Write(part); err != nil {
+			return fmt.Errorf("write pmtiles: %w", err)
+		}
+	}
+
+	// Second pass: copy each distinct payload in layout order.
+	lookup, err := db.PrepareContext(ctx, `SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`)
+	if err != nil {
+		return fmt.Errorf("read mbtiles tiles: %w", err)
+	}
+	defer lookup.Close()
+	for _, ref := range unique {
+		var data []byte
+		if err := lookup.QueryRowContext(ctx, ref.z, ref.x, ref.row).Scan(&data); err != nil {
+			return fmt.Errorf("read mbtiles tiles: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("write pmtiles: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write pmtiles: %w", err)
+	}
+	return nil
+}
+
+// buildDirectories serializes the entries into a root directory small enough for the first
+// request, splitting them into leaf directories when they do not fit.
+func buildDirectories(entries []pmtilesEntry) ([]byte, []byte, error) {
+	root, err := serializeDirectory(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(root) <= pmtilesRootMaxLen {
+		return root, nil, nil
+	}
+
+	for leafSize := 4096; ; leafSize += leafSize / 5 {
+		var leaves bytes.Buffer
+		var rootEntries []pmtilesEntry
+		for start := 0; start < len(entries); start += leafSize {
+			end := min(start+leafSize, len(entries))
+			leaf, err := serializeDirectory(entries[start:end])
+			if err != nil {
+				return nil, nil, err
+			}
+			rootEntries = append(rootEntries, pmtilesEntry{
+				TileID: entries[start].TileID,
+				Offset: uint64(leaves.Len()),
+				Length: uint32(len(leaf)),
+			})
+			leaves.Write(leaf)
+		}
+		root, err := serializeDirectory(rootEntries)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(root) <= pmtilesRootMaxLen {
+			return root, leaves.Bytes(), nil
+		}
+	}
+}
+
+// serializeDirectory encodes entries column by column as varints and gzips the result.
+func serializeDirectory(entries []pmtilesEntry) ([]byte, error) {
+	var raw []byte
+	raw = binary.AppendUvarint(raw, uint64(len(entries)))
+	var lastID uint64
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, e.TileID-lastID)
+		lastID = e.TileID
+	}
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, uint64(e.RunLength))
+	}
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, uint64(e.Length))
+	}
+	for i, e := range entries {
+		// Zero means the entry directly follows the previous one.
+		if i > 0 && e.Offset == entries[i-1].Offset+uint64(entries[i-1].Length) {
+			raw = binary.AppendUvarint(raw, 0)
+		} else {
+			raw = binary.AppendUvarint(raw, e.Offset+1)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, fmt.Errorf("compress pmtiles directory: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress pmtiles directory: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// zxyToTileID maps a tile to its PMTiles ID: tiles of lower zooms first, then the position on
+// the zoom's Hilbert curve.
+func zxyToTileID(z uint8, x, y uint32) uint64 {
+	var acc uint64
+	for t := uint8(0); t < z; t++ {
+		acc += uint64(1) << (2 * t)
+	}
+	n := uint32(1) << z
+	var d uint64
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint32
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return acc + d
+}
+
+// tileIDToZxy is the inverse of zxyToTileID.
+func tileIDToZxy(id uint64) (uint8, uint32, uint32) {
+	var z uint8
+	for acc := uint64(0); ; z++ {
+		n := uint64(1) << (2 * z)
+		if id < acc+n {
+			id -= acc
+			break
+		}
+		acc += n
+	}
+	var x, y uint32
+	for s := uint32(1); s < uint32(1)<<z; s *= 2 {
+		rx := uint32(1 & (id / 2))
+		ry := uint32(1 & (id ^ uint64(rx)))
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		id /= 4
+	}
+	return z, x, y
+}
@@ -0,0 +1,56 @@
+package tiler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/paulmach/orb/encoding/mvt"
+
+	"github.com/hexatiles/hexatiles/internal/props"
+)
+
+// PropertySample draws up to size finite values of property from the features of the
+// archive's deepest zoom, where no feature has been dropped or thinned, and counts the values
+// seen. Cells cut by tile edges count once per tile they reach. The sample is seeded, so the
+// same archive always yields the same values.
+func PropertySample(ctx context.Context, archive *PMTilesArchive, property string, size int) ([]float64, int64, error) {
+	h := archive.Header()
+	if h.TileType != "mvt" {
+		return nil, 0, fmt.Errorf("archive holds %s tiles, not vector tiles", h.TileType)
+	}
+	rng := rand.New(rand.NewSource(1))
+	var sample []float64
+	var seen int64
+	err := archive.WalkZoom(h.MaxZoom, func(z, x, y int, tile []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var layers mvt.Layers
+		var err error
+		if h.TileGzip {
+			layers, err = mvt.UnmarshalGzipped(tile)
+		} else {
+			layers, err = mvt.Unmarshal(tile)
+		}
+		if err != nil {
+			return fmt.Errorf("decode tile %d/%d/%d: %w", z, x, y, err)
+		}
+		for _, layer := range layers {
+			for _, f := range layer.Features {
+				value, ok := props.Number(f.Properties[property])
+				if !ok {
+					continue
+				}
+				seen++
+				if len(sample) < size {
+					sample = append(sample, value)
+				} else if j := rng.Int63n(seen); j < int64(size) {
+					sample[j] = value
+				}
+			}
+		}
+		return nil
+	})
+	return sample, seen, err
+}
@@ -0,0 +1,153 @@
+package tiler
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+// ZoomConservation records how the native tiler thinned one zoom of the main layer and how the
+// conserved totals compare with the input. A feature is counted once, in the tile holding the
+// centre of its bounds, even when its geometry reaches into neighbouring tiles.
+type ZoomConservation struct {
+	Zoom     int
+	Features int
+	Kept     int
+	// Totals holds, per conserved property, the input total and the total over kept features.
+	Totals []ConservedTotal
+}
+
+// ConservedTotal compares the input total of a property with the total the tiles carry.
+type ConservedTotal struct {
+	Property string
+	Input    float64
+	Tiled    float64
+}
+
+// zoomThinning is the outcome of thinning one zoom: which features are dropped and the
+// properties of kept features that absorbed the values of dropped ones.
+type zoomThinning struct {
+	dropped    []bool
+	properties map[int32]geojson.Properties
+}
+
+// thin keeps at most opts.FeatureLimit main-layer features in each tile of zoom. The features
+// of a crowded tile are split, in sort order, into FeatureLimit runs of consecutive features;
+// the middle feature of each run is kept and the conserved properties of the others are added
+// to it. Cells sorted by index are spatially clustered, so values move only to nearby cells
+// and the total of every conserved property is unchanged at every zoom.
+func (s *nativeTileset) thin(zoom maptile.Zoom) (*zoomThinning, ZoomConservation) {
+	stats := ZoomConservation{Zoom: int(zoom)}
+	homes := make(map[maptile.Tile][]int32)
+	for i, f := range s.features {
+		if f.layer != 0 || !f.visible(zoom) {
+			continue
+		}
+		center := f.bound.Center()
+		x, y := lonLatToTile(center[0], center[1], int(zoom))
+		tile := maptile.New(uint32(x), uint32(y), zoom)
+		homes[tile] = append(homes[tile], int32(i))
+		stats.Features++
+	}
+
+	result := &zoomThinning{properties: make(map[int32]geojson.Properties)}
+	limit := s.opts.FeatureLimit
+	for _, members := range homes {
+		if len(members) <= limit {
+			continue
+		}
+		if result.dropped == nil {
+			result.dropped = make([]bool, len(s.features))
+		}
+		for run := 0; run < limit; run++ {
+			start, end := run*len(members)/limit, (run+1)*len(members)/limit
+			keep := members[start+(end-start)/2]
+			var merged geojson.Properties
+			for _, i := range members[start:end] {
+				if i == keep {
+					continue
+				}
+				result.dropped[i] = true
+				if len(s.opts.Conserve) == 0 {
+					continue
+				}
+				if merged == nil {
+					merged = s.features[keep].feature.Properties.Clone()
+				}
+				for _, key := range s.opts.Conserve {
+					merged[key] = addConserved(merged[key], s.features[i].feature.Properties[key])
+				}
+			}
+			if merged != nil {
+				result.properties[keep] = merged
+			}
+		}
+	}
+
+	for _, key := range s.opts.Conserve {
+		total := ConservedTotal{Property: key}
+		for i, f := range s.features {
+			if f.layer != 0 || !f.visible(zoom) {
+				continue
+			}
+			value, _ := conservedNumber(f.feature.Properties[key])
+			total.Input += value
+			if result.dropped != nil && result.dropped[i] {
+				continue
+			}
+			if merged, ok := result.properties[int32(i)]; ok {
+				value, _ = conservedNumber(merged[key])
+			}
+			total.Tiled += value
+		}
+		stats.Totals = append(stats.Totals, total)
+	}
+	stats.Kept = stats.Features
+	for _, dropped := range result.dropped {
+		if dropped {
+			stats.Kept--
+		}
+	}
+	sort.Slice(stats.Totals, func(i, j int) bool { return stats.Totals[i].Property < stats.Totals[j].Property })
+	return result, stats
+}
+
+// addConserved sums two property values. Integers stay integers; a missing value counts as
+// zero, and the sum is missing only when both are.
+func addConserved(a, b any) any {
+	ai, aInt := a.(int64)
+	bi, bInt := b.(int64)
+	switch {
+	case b == nil:
+		return a
+	case a == nil:
+		return b
+	case aInt && bInt:
+		return ai + bi
+	}
+	af, aok := conservedNumber(a)
+	bf, bok := conservedNumber(b)
+	if !aok {
+		return b
+	}
+	if !bok {
+		return a
+	}
+	return af + bf
+}
+
+func conservedNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -20,19 +23,62 @@ type TippecanoeOptions struct {
 	LayerName string
 	Metadata  map[string]string
     Attributes []string
+	DropStrategy string
+	AttributeTypes map[string]string
+	ExtraLayers    []Layer
+	// ZoomCap is the deepest zoom --extend-zooms-if-still-dropping may reach, so the tileset
+	// never exceeds the build's zoom policy. Zero leaves tippecanoe's own limit.
+	ZoomCap int
+	// FeatureLimit caps the features per tile below MaxZoom; zero means no limit. tippecanoe
+	// meets it with the drop strategy; the native tiler thins the main layer itself.
+	FeatureLimit int
+	// Conserve lists numeric attributes whose totals survive dropping: the values of dropped
+	// features are added to kept ones (tippecanoe's --accumulate-attribute with sum).
+	Conserve []string
+	// ReadParallel passes --read-parallel, which splits each line-delimited input among
+	// tippecanoe's reading threads. GeoJSON text sequences are read that way without it.
+	ReadParallel bool
+	// Progress, when set, receives tippecanoe's own progress through the tiles, 0 to 100,
+	// as it reports it.
+	Progress func(percent float64) `json:"-"`
+	// ExtraArgs are passed to tippecanoe after the arguments derived from the other options,
+	// so a flag given here overrides an earlier one where tippecanoe keeps the last value.
+	ExtraArgs []string
 }
 
+// Layer is an additional named NDJSON input tiled alongside the main layer.
+type Layer struct {
+	Name string
+	Path string
+}
+
+// Drop strategies accepted by TippecanoeOptions.DropStrategy.
+const (
+	DropStrategyDefault  = ""
+	DropStrategyDensest  = "drop-densest"
+	DropStrategyCoalesce = "coalesce-densest"
+	DropStrategyNone     = "none"
+)
+
 // TippecanoeRunner wraps calls to the tippecanoe CLI.
 type TippecanoeRunner struct {
 	Binary string
 }
 
-// NewTippecanoeRunner resolves the tippecanoe binary from PATH or an explicit override.
+// NewTippecanoeRunner resolves the tippecanoe binary from PATH or an explicit override. With
+// HEXATILES_FAKE_TOOLS set and no override, it uses the stub from the fake tools.
 func NewTippecanoeRunner(pathOverride string) (*TippecanoeRunner, error) {
 	candidate := pathOverride
 	if candidate == "" {
 		candidate = os.Getenv("TIPPECANOE_PATH")
 	}
+	if candidate == "" && FakeToolsEnabled() {
+		fake, err := fakeToolPath("tippecanoe")
+		if err != nil {
+			return nil, err
+		}
+		candidate = fake
+	}
 	if candidate == "" {
 		candidate = "tippecanoe"
 	}
@@ -45,12 +91,45 @@ func NewTippecanoeRunner(pathOverride string) (*TippecanoeRunner, error) {
 	return &TippecanoeRunner{Binary: resolved}, nil
 }
 
+// Version returns the first line of `tippecanoe --version`, or "" when it cannot be run.
+func (r *TippecanoeRunner) Version(ctx context.Context) string {
+	if r == nil || r.Binary == "" {
+		return ""
+	}
+	return commandVersion(ctx, r.Binary, "--version")
+}
+
 // Run executes tippecanoe with deterministic defaults. It returns combined stdout/stderr output and the exact argument list.
 func (r *TippecanoeRunner) Run(ctx context.Context, inputNDJSON, outputMBTiles string, opts TippecanoeOptions) (string, []string, error) {
 	if r == nil || r.Binary == "" {
 		return "", nil, fmt.Errorf("tippecanoe runner is not initialised")
 	}
 
+	cmd := exec.CommandContext(ctx, r.Binary, TippecanoeArgs(inputNDJSON, outputMBTiles, opts)...)
+
+	env := os.Environ()
+	if opts.Threads > 0 {
+		env = append(env, fmt.Sprintf("TIPPECANOE_MAX_THREADS=%d", opts.Threads))
+	}
+	cmd.Env = env
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if opts.Progress != nil {
+		cmd.Stderr = &progressWriter{w: &output, report: opts.Progress}
+	}
+
+	if err := cmd.Run(); err != nil {
+		return output.String(), cmd.Args, fmt.Errorf("tippecanoe failed: %w", err)
+	}
+
+	return output.String(), cmd.Args, nil
+}
+
+// TippecanoeArgs returns the tippecanoe arguments, without the binary, that Run uses to tile
+// inputNDJSON into output.
+func TippecanoeArgs(inputNDJSON, output string, opts TippecanoeOptions) []string {
 	layer := opts.LayerName
 	if layer == "" {
 		layer = "h3"
@@ -62,15 +141,27 @@ func (r *TippecanoeRunner) Run(ctx context.Context, inputNDJSON, outputMBTiles s
 	}
 
 	args := []string{
-		"-o", outputMBTiles,
+		"-o", output,
 		"--force",
-		"--layer", layer,
-		"--drop-densest-as-needed",
-		"--extend-zooms-if-still-dropping",
-		"--coalesce-densest-as-needed",
-		"--no-feature-limit",
+	}
+	if len(opts.ExtraLayers) == 0 {
+		args = append(args, "--layer", layer)
+	}
+	args = append(args, zoomExtensionArgs(dropStrategyArgs(opts.DropStrategy), opts.MaxZoom, opts.ZoomCap)...)
+	if opts.FeatureLimit > 0 {
+		args = append(args, "--maximum-tile-features="+strconv.Itoa(opts.FeatureLimit))
+	} else {
+		args = append(args, "--no-feature-limit")
+	}
+	args = append(args,
 		"--no-tile-size-limit",
-		"--order-by=" + sortBy,
+		"--order-by="+sortBy,
+	)
+	if opts.ReadParallel {
+		args = append(args, "--read-parallel")
+	}
+	for _, attr := range opts.Conserve {
+		args = append(args, "--accumulate-attribute="+attr+":sum")
 	}
 
 	if !opts.Simplify {
@@ -87,45 +178,102 @@ func (r *TippecanoeRunner) Run(ctx context.Context, inputNDJSON, outputMBTiles s
     // Note: tippecanoe doesn't have an --attributes option
     // Attributes are controlled by --include/--exclude options
     if len(opts.Attributes) > 0 {
-        // For now, we'll include all specified attributes
+		// Exclude everything explicitly, then re-admit only the kept attributes
+		args = append(args, "--exclude-all")
         for _, attr := range opts.Attributes {
             args = append(args, "--include=" + attr)
         }
     }
 
-	for key, value := range opts.Metadata {
+	// Pin attribute types to the input schema rather than tippecanoe's per-value inference
+	typeKeys := make([]string, 0, len(opts.AttributeTypes))
+	for key := range opts.AttributeTypes {
+		typeKeys = append(typeKeys, key)
+	}
+	sort.Strings(typeKeys)
+	for _, key := range typeKeys {
+		args = append(args, "--attribute-type="+key+":"+opts.AttributeTypes[key])
+	}
+
+	metaKeys := make([]string, 0, len(opts.Metadata))
+	for key := range opts.Metadata {
+		metaKeys = append(metaKeys, key)
+	}
+	sort.Strings(metaKeys)
+	for _, key := range metaKeys {
+		value := opts.Metadata[key]
 		if strings.TrimSpace(value) == "" {
 			continue
 		}
-		switch strings.ToLower(key) {
-		case "name":
-			args = append(args, "--name", value)
-		case "description":
-			args = append(args, "--description", value)
-		case "attribution":
-			args = append(args, "--attribution", value)
-		case "version":
-			args = append(args, "--version", value)
+		// The --flag=value form keeps a value starting with "-" from being read as an option.
+		switch key = strings.ToLower(key); key {
+		case "name", "description", "attribution", "version":
+			args = append(args, "--"+key+"="+value)
 		}
 	}
 
-	args = append(args, inputNDJSON)
+	args = append(args, opts.ExtraArgs...)
 
-	cmd := exec.CommandContext(ctx, r.Binary, args...)
+	if len(opts.ExtraLayers) == 0 {
+		args = append(args, inputNDJSON)
+	} else {
+		// Named layers must all be passed via -L; positional inputs would land in a default layer.
+		args = append(args, "-L", layer+":"+inputNDJSON)
+		for _, extra := range opts.ExtraLayers {
+			args = append(args, "-L", extra.Name+":"+extra.Path)
+		}
+	}
+	return args
+}
 
-	env := os.Environ()
-	if opts.Threads > 0 {
-		env = append(env, fmt.Sprintf("TIPPECANOE_MAX_THREADS=%d", opts.Threads))
+// progressWriter passes tippecanoe's output through, reporting the last percentage of each
+// write: tippecanoe redraws "  42.1%  12/2048/1361" on one line as it writes tiles.
+type progressWriter struct {
+	w      io.Writer
+	report func(percent float64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	if m := progressPattern.FindAllSubmatch(b, -1); len(m) > 0 {
+		if percent, err := strconv.ParseFloat(string(m[len(m)-1][1]), 64); err == nil {
+			p.report(percent)
+		}
 	}
-	cmd.Env = env
+	return p.w.Write(b)
+}
 
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
+// progressPattern matches the progress line only, not percentages in messages such as "Going
+// to try keeping the sparsest 90.00% of the features".
+var progressPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)%\s+\d+/\d+/\d+`)
 
-	if err := cmd.Run(); err != nil {
-		return output.String(), cmd.Args, fmt.Errorf("tippecanoe failed: %w", err)
+// zoomExtensionArgs bounds --extend-zooms-if-still-dropping by the zoom cap, or removes it when
+// the maximum zoom already sits at the cap.
+func zoomExtensionArgs(args []string, maxZoom, zoomCap int) []string {
+	if zoomCap <= 0 || maxZoom < 0 {
+		return args
 	}
+	out := make([]string, 0, len(args)+1)
+	for _, arg := range args {
+		if arg != "--extend-zooms-if-still-dropping" {
+			out = append(out, arg)
+			continue
+		}
+		if extra := zoomCap - maxZoom; extra > 0 {
+			out = append(out, arg, "--extend-zooms-if-still-dropping-maximum="+strconv.Itoa(extra))
+		}
+	}
+	return out
+}
 
-	return output.String(), cmd.Args, nil
+func dropStrategyArgs(strategy string) []string {
+	switch strategy {
+	case DropStrategyDensest:
+		return []string{"--drop-densest-as-needed", "--extend-zooms-if-still-dropping"}
+	case DropStrategyCoalesce:
+		return []string{"--coalesce-densest-as-needed", "--extend-zooms-if-still-dropping"}
+	case DropStrategyNone:
+		return []string{"--no-tiny-polygon-reduction"}
+	default:
+		return []string{"--drop-densest-as-needed", "--extend-zooms-if-still-dropping", "--coalesce-densest-as-needed"}
+	}
 }
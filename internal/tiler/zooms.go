@@ -0,0 +1,42 @@
+package tiler
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MaxTileZoom is the deepest zoom tippecanoe can generate.
+const MaxTileZoom = 24
+
+// TilesetZoomRange returns the minimum and maximum zoom recorded in a PMTiles header or in the
+// metadata table of an MBTiles file, which may differ from the requested range when tippecanoe
+// extends zooms to avoid dropping features.
+func TilesetZoomRange(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open tileset: %w", err)
+	}
+	header := make([]byte, pmtilesHeaderLen)
+	_, readErr := io.ReadFull(f, header)
+	f.Close()
+	if readErr == nil && bytes.HasPrefix(header, []byte("PMTiles")) {
+		if header[7] != 3 {
+			return 0, 0, fmt.Errorf("%s is not a PMTiles v3 archive", path)
+		}
+		return int(header[pmtilesMinZoomOffset]), int(header[pmtilesMaxZoomOffset]), nil
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open mbtiles: %w", err)
+	}
+	defer db.Close()
+	_, minZoom, maxZoom, err := mbtilesExtent(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	return minZoom, maxZoom, nil
+}
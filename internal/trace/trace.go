@@ -0,0 +1,134 @@
+// Package trace records pipeline spans and counters in the Chrome trace event format, which
+// Perfetto (ui.perfetto.dev) and chrome://tracing open directly.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder collects events in memory until WriteFile. It is safe for concurrent use, and a nil
+// Recorder ignores every call, so callers need not check whether tracing is enabled.
+type Recorder struct {
+	mu      sync.Mutex
+	start   time.Time
+	threads map[int]string
+	events  []event
+}
+
+// event is one entry of traceEvents; ts and dur are microseconds since the recorder started.
+type event struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Phase string         `json:"ph"`
+	TS    float64        `json:"ts"`
+	Dur   float64        `json:"dur,omitempty"`
+	PID   int            `json:"pid"`
+	TID   int            `json:"tid"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// New returns a recorder whose timeline starts now.
+func New() *Recorder {
+	return &Recorder{start: time.Now(), threads: make(map[int]string)}
+}
+
+// Thread names the track that events with tid are drawn on.
+func (r *Recorder) Thread(tid int, name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.threads[tid] = name
+	r.mu.Unlock()
+}
+
+// Span records a complete span from start to end on track tid.
+func (r *Recorder) Span(tid int, name, cat string, start, end time.Time, args map[string]any) {
+	if r == nil {
+		return
+	}
+	r.add(event{Name: name, Cat: cat, Phase: "X", TS: r.micros(start), Dur: float64(end.Sub(start).Nanoseconds()) / 1e3, TID: tid, Args: args})
+}
+
+// Begin starts a span on track tid that ends when the returned function is called, with the
+// arguments passed to it.
+func (r *Recorder) Begin(tid int, name, cat string) func(args map[string]any) {
+	if r == nil {
+		return func(map[string]any) {}
+	}
+	start := time.Now()
+	return func(args map[string]any) {
+		r.Span(tid, name, cat, start, time.Now(), args)
+	}
+}
+
+// Counter records the values of a counter track at time at; each key becomes a series.
+func (r *Recorder) Counter(name string, at time.Time, values map[string]any) {
+	if r == nil {
+		return
+	}
+	r.add(event{Name: name, Phase: "C", TS: r.micros(at), Args: values})
+}
+
+func (r *Recorder) add(e event) {
+	e.PID = 1
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *Recorder) micros(t time.Time) float64 {
+	return float64(t.Sub(r.start).Nanoseconds()) / 1e3
+}
+
+// WriteFile writes the trace as a JSON object with the events in time order.
+func (r *Recorder) WriteFile(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	events := make([]event, 0, len(r.threads)+len(r.events))
+	tids := make([]int, 0, len(r.threads))
+	for tid := range r.threads {
+		tids = append(tids, tid)
+	}
+	sort.Ints(tids)
+	for _, tid := range tids {
+		events = append(events,
+			event{Name: "thread_name", Phase: "M", PID: 1, TID: tid, Args: map[string]any{"name": r.threads[tid]}},
+			event{Name: "thread_sort_index", Phase: "M", PID: 1, TID: tid, Args: map[string]any{"sort_index": tid}},
+		)
+	}
+	spans := append([]event(nil), r.events...)
+	r.mu.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].TS < spans[j].TS })
+	events = append(events, spans...)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create trace: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	doc := struct {
+		TraceEvents     []event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{events, "ms"}
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		f.Close()
+		return fmt.Errorf("write trace: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write trace: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write trace: %w", err)
+	}
+	return nil
+}
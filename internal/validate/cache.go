@@ -0,0 +1,182 @@
+package validate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hexatiles/hexatiles/internal/objstore"
+)
+
+// cacheVersion is bumped whenever Result or the validation rules change, which invalidates
+// every cached entry.
+const cacheVersion = 1
+
+// Cache remembers the results of full validations of local files, keyed by path, so files
+// that have not changed since are not read again. A file counts as unchanged when its size and
+// modification time match the cached entry, or, when only the time differs, its SHA-256
+// checksum does. Entries also record the options that decide the result, so changing
+// --min-res or --grid revalidates. A cached full result also answers runs with a row limit or
+// time budget. Partial results, runs with an offset, remote objects and directories are never
+// cached.
+type Cache struct {
+	path    string
+	entries map[string]cacheEntry
+	dirty   bool
+}
+
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Checksum string    `json:"sha256"`
+	Options  string    `json:"options"`
+	Result   *Result   `json:"result"`
+}
+
+// OpenCache loads the cache stored at path; a missing file, or one written by another version,
+// starts an empty cache.
+func OpenCache(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: make(map[string]cacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read validate cache: %w", err)
+	}
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode validate cache %s: %w", path, err)
+	}
+	if file.Version == cacheVersion && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// RunCached returns the cached result for an unchanged file and runs validation otherwise,
+// recording full results. A cached result has Cached set.
+func RunCached(ctx context.Context, opts Options, cache *Cache) (*Result, error) {
+	if cache == nil {
+		return Run(ctx, opts)
+	}
+	key, info, ok := cacheable(opts)
+	if !ok {
+		return Run(ctx, opts)
+	}
+	fingerprint := optionsFingerprint(opts)
+	entry, found := cache.entries[key]
+	found = found && entry.Options == fingerprint && entry.Size == info.Size()
+	if found && entry.ModTime.Equal(info.ModTime()) {
+		return cachedResult(entry), nil
+	}
+
+	checksum, err := fileChecksum(opts.InputPath)
+	if err != nil {
+		return nil, err
+	}
+	if found && entry.Checksum == checksum {
+		// Touched but unchanged: remember the new time so the next run skips the checksum.
+		entry.ModTime = info.ModTime()
+		cache.entries[key] = entry
+		cache.dirty = true
+		return cachedResult(entry), nil
+	}
+
+	res, err := Run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.Partial() {
+		return res, nil
+	}
+	cache.entries[key] = cacheEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Checksum: checksum,
+		Options:  fingerprint,
+		Result:   res,
+	}
+	cache.dirty = true
+	return res, nil
+}
+
+// Save writes the cache back when it changed, replacing the file atomically.
+func (c *Cache) Save() error {
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Entries: c.entries})
+	if err != nil {
+		return fmt.Errorf("encode validate cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create validate cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write validate cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close validate cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("replace validate cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// cacheable returns the cache key and file info of a local regular input file.
+func cacheable(opts Options) (string, os.FileInfo, bool) {
+	if opts.Offset > 0 || opts.InputPath == "" || opts.InputPath == "-" || objstore.IsRemote(opts.InputPath) {
+		return "", nil, false
+	}
+	abs, err := filepath.Abs(opts.InputPath)
+	if err != nil {
+		return "", nil, false
+	}
+	info, err := os.Stat(abs)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, false
+	}
+	return abs, info, true
+}
+
+// optionsFingerprint encodes the options a full result depends on.
+func optionsFingerprint(opts Options) string {
+	return fmt.Sprintf("format=%s grid=%s min-res=%d max-res=%d sample=%d", opts.InputFormat, opts.Grid, opts.MinResolution, opts.MaxResolution, opts.SampleLimit)
+}
+
+func cachedResult(entry cacheEntry) *Result {
+	res := *entry.Result
+	res.Cached = true
+	return &res
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("checksum input: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("checksum input: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
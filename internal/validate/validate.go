@@ -2,21 +2,59 @@ package validate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"time"
 
+	"github.com/hexatiles/hexatiles/internal/grid"
+	"github.com/hexatiles/hexatiles/internal/input"
 	parquetreader "github.com/hexatiles/hexatiles/internal/parquet"
 )
 
 // Options configures a validation run.
 type Options struct {
 	InputPath       string
+	InputFormat     string
 	MinResolution   int
 	MaxResolution   int
 	SampleLimit     int
 	ReaderBatchSize int
 	ReaderParallel  int
+	Grid            string
+	// Offset skips that many rows before validation starts.
+	Offset int64
+	// LimitRows stops after that many rows have been checked; 0 checks the rest of the file.
+	LimitRows int64
+	// TimeBudget stops validation once it has run this long; 0 means no limit.
+	TimeBudget time.Duration
+}
+
+// Stop reasons reported when validation ends before the end of the file.
+const (
+	StopRowLimit   = "row limit"
+	StopTimeBudget = "time budget"
+)
+
+// budgetCheckInterval is how many rows are read between time budget checks.
+const budgetCheckInterval = 1024
+
+// z95 is the standard normal quantile for a two-sided 95% confidence interval.
+const z95 = 1.959964
+
+// Estimate extrapolates the invalid rate of a partial scan to the whole file. The interval is a
+// 95% Wilson score interval, which assumes the scanned rows are representative of the rest.
+type Estimate struct {
+	InvalidRate float64
+	RateLow     float64
+	RateHigh    float64
+	// FileRows is the row count of the whole file, or -1 when the format does not record it;
+	// the Invalid* counts are only set when it is known.
+	FileRows    int64
+	Invalid     int64
+	InvalidLow  int64
+	InvalidHigh int64
 }
 
 // Issue captures an invalid row sample.
@@ -28,15 +66,33 @@ type Issue struct {
 
 // Result summarises validation findings for a single file.
 type Result struct {
-	TotalRows           int64
-	ValidRows           int64
-	InvalidCells        int64
+	TotalRows    int64
+	ValidRows    int64
+	InvalidCells int64
+	// NullCells counts rows whose cell column was null or empty.
+	NullCells int64
+	// MissingColumn counts rows without a recognisable cell column, a schema problem.
+	MissingColumn       int64
 	ResolutionFiltered  int64
 	ResolutionHistogram map[int]int64
 	InvalidSamples      []Issue
 	MinResolutionSeen   int
 	MaxResolutionSeen   int
 	Duration            time.Duration
+	// Offset is the number of rows skipped before validation.
+	Offset int64
+	// Stopped names why validation ended early (StopRowLimit or StopTimeBudget), or is empty
+	// when every row after Offset was checked.
+	Stopped string
+	// Estimate is set when only part of the file was checked.
+	Estimate *Estimate
+	// Cached reports that the result was read from a Cache for an unchanged file.
+	Cached bool `json:"-"`
+}
+
+// Partial reports whether rows were skipped or left unchecked.
+func (r *Result) Partial() bool {
+	return r.Offset > 0 || r.Stopped != ""
 }
 
 // Run executes validation on a single Parquet file.
@@ -51,9 +107,14 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 		opts.ReaderParallel = 1
 	}
 
-	reader, err := parquetreader.NewReader(opts.InputPath, parquetreader.ReaderOptions{BatchSize: opts.ReaderBatchSize, Parallel: opts.ReaderParallel})
+	cellGrid, err := grid.Lookup(opts.Grid)
 	if err != nil {
-		return nil, fmt.Errorf("open parquet reader: %w", err)
+		return nil, err
+	}
+
+	reader, err := input.Open(opts.InputPath, opts.InputFormat, parquetreader.ReaderOptions{BatchSize: opts.ReaderBatchSize, Parallel: opts.ReaderParallel, Grid: cellGrid})
+	if err != nil {
+		return nil, err
 	}
 	defer reader.Close()
 
@@ -61,10 +122,17 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 		ResolutionHistogram: make(map[int]int64),
 		MinResolutionSeen:   -1,
 		MaxResolutionSeen:   -1,
+		Offset:              opts.Offset,
 	}
 
 	start := time.Now()
 
+	if opts.Offset > 0 {
+		if err := reader.Skip(opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -72,7 +140,16 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 		default:
 		}
 
-		row, err := reader.Next()
+		if opts.LimitRows > 0 && res.TotalRows >= opts.LimitRows {
+			res.Stopped = StopRowLimit
+			break
+		}
+		if opts.TimeBudget > 0 && res.TotalRows > 0 && res.TotalRows%budgetCheckInterval == 0 && time.Since(start) >= opts.TimeBudget {
+			res.Stopped = StopTimeBudget
+			break
+		}
+
+		row, err := reader.NextContext(ctx)
 		if err == io.EOF {
 			break
 		}
@@ -83,6 +160,14 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 		res.TotalRows++
 
 		if row.Err != nil {
+			switch {
+			case errors.Is(row.Err, parquetreader.ErrNoH3Column):
+				res.MissingColumn++
+				continue
+			case errors.Is(row.Err, parquetreader.ErrNullCell):
+				res.NullCells++
+				continue
+			}
 			res.InvalidCells++
 			if len(res.InvalidSamples) < opts.SampleLimit {
 				res.InvalidSamples = append(res.InvalidSamples, Issue{
@@ -114,5 +199,37 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 	}
 
 	res.Duration = time.Since(start)
+	if res.Stopped != "" {
+		// Reaching the limit exactly at the end of the file is still a full scan.
+		if _, err := reader.Next(); err == io.EOF {
+			res.Stopped = ""
+		}
+	}
+	if res.Partial() && res.TotalRows > 0 {
+		res.Estimate = estimate(res.InvalidCells, res.TotalRows, reader.TotalRows())
+	}
 	return res, nil
 }
+
+// estimate extrapolates invalid out of checked rows to a file of fileRows rows (-1 if unknown).
+func estimate(invalid, checked, fileRows int64) *Estimate {
+	n := float64(checked)
+	p := float64(invalid) / n
+	denom := 1 + z95*z95/n
+	center := (p + z95*z95/(2*n)) / denom
+	half := z95 * math.Sqrt(p*(1-p)/n+z95*z95/(4*n*n)) / denom
+
+	est := &Estimate{
+		InvalidRate: p,
+		RateLow:     math.Max(0, center-half),
+		RateHigh:    math.Min(1, center+half),
+		FileRows:    fileRows,
+	}
+	if fileRows >= 0 {
+		rows := float64(fileRows)
+		est.Invalid = int64(math.Round(p * rows))
+		est.InvalidLow = int64(math.Round(est.RateLow * rows))
+		est.InvalidHigh = int64(math.Round(est.RateHigh * rows))
+	}
+	return est
+}